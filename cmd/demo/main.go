@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"runtime"
@@ -43,7 +44,7 @@ func main() {
 	}
 	
 	// Start the engine (this starts the dashboard too)
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	fmt.Println("Descry engine started!")
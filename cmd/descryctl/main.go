@@ -0,0 +1,234 @@
+// Command descryctl works with running Descry engines from the command line.
+//
+// Record an hour of a production engine's metrics through its dashboard:
+//
+//	descryctl record --url https://descry.internal:9090 --duration 1h --out capture.dscrpack
+//
+// Replay the capture against local rules to see which would have fired, and
+// where they disagree with what the production rules of the same names did:
+//
+//	descryctl replay --rules ./rules capture.dscrpack
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry"
+)
+
+const usage = `Usage:
+  descryctl record [--url URL] [--duration D] [--interval D] [--out FILE] [--header "Name: value"]...
+  descryctl replay --rules DIR|FILE CAPTURE
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "record":
+		err = record(ctx, os.Args[2:])
+	case "replay":
+		err = replay(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("descryctl %s: %v", os.Args[1], err)
+	}
+}
+
+// headerFlags collects repeated --header flags
+type headerFlags []string
+
+func (h *headerFlags) String() string { return strings.Join(*h, ", ") }
+
+func (h *headerFlags) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header must be \"Name: value\"")
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// durationFlag is a duration flag read with the rule DSL's units, so 2d
+// and 5M mean what they do in rules
+type durationFlag time.Duration
+
+func (d *durationFlag) String() string { return time.Duration(*d).String() }
+
+func (d *durationFlag) Set(value string) error {
+	duration, err := descry.ParseDurationDSL(value)
+	if err != nil {
+		return err
+	}
+	*d = durationFlag(duration)
+	return nil
+}
+
+// record polls a dashboard's /api/capture endpoint and writes the samples to
+// a capture file. Interrupting it ends the capture early; the frames recorded
+// so far are kept.
+func record(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("record", flag.ExitOnError)
+	url := flags.String("url", "http://localhost:9090", "dashboard URL of the engine to record")
+	recordFor, sampleEvery := durationFlag(time.Hour), durationFlag(time.Second)
+	flags.Var(&recordFor, "duration", "how long to record, e.g. 30m or 2d")
+	flags.Var(&sampleEvery, "interval", "how often to sample metrics, e.g. 500ms or 1s")
+	out := flags.String("out", "capture.dscrpack", "capture file to write")
+	var headers headerFlags
+	flags.Var(&headers, "header", "request header for an authenticating proxy, e.g. \"X-Descry-Role: sre\" (repeatable)")
+	flags.Parse(args)
+	duration, interval := time.Duration(recordFor), time.Duration(sampleEvery)
+
+	if duration <= 0 || interval <= 0 {
+		return fmt.Errorf("duration and interval must be positive")
+	}
+	endpoint := strings.TrimRight(*url, "/") + "/api/capture"
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	capture, err := descry.NewCaptureWriter(file, *url, interval)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, duration)
+	defer cancel()
+	client := &http.Client{Timeout: interval + 10*time.Second}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	frames := 0
+	log.Printf("Recording %s for %v to %s", *url, duration, *out)
+	for {
+		frame, err := fetchFrame(ctx, client, endpoint, headers)
+		switch {
+		case err == nil:
+			if err := capture.WriteFrame(frame); err != nil {
+				return err
+			}
+			frames++
+		case ctx.Err() == nil:
+			// Keep recording through transient failures
+			log.Printf("Sample failed: %v", err)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if err := capture.Close(); err != nil {
+				return err
+			}
+			log.Printf("Recorded %d frames to %s", frames, *out)
+			return file.Close()
+		}
+	}
+}
+
+// fetchFrame samples the engine's metrics once
+func fetchFrame(ctx context.Context, client *http.Client, endpoint string, headers headerFlags) (descry.CaptureFrame, error) {
+	var frame descry.CaptureFrame
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return frame, err
+	}
+	for _, header := range headers {
+		name, value, _ := strings.Cut(header, ":")
+		req.Header.Set(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return frame, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return frame, fmt.Errorf("%s returned status %d", endpoint, resp.StatusCode)
+	}
+
+	var body struct {
+		Data descry.CaptureFrame `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return frame, fmt.Errorf("invalid response from %s: %w", endpoint, err)
+	}
+	return body.Data, nil
+}
+
+// replay evaluates local rules against a capture and prints when each would
+// have fired
+func replay(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	rules := flags.String("rules", "", "rules directory or .dscr file to replay")
+	flags.Parse(args)
+	if *rules == "" || flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	engine := descry.NewEngineWithConfig(descry.EngineConfig{
+		DisableDashboard: true,
+		Logger:           log.New(io.Discard, "", 0),
+		DiagnosticLogger: slog.New(slog.DiscardHandler),
+	})
+	info, err := os.Stat(*rules)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		_, err = engine.LoadRulesFromDir(*rules)
+	} else {
+		_, err = engine.AddRuleFile(*rules)
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := engine.ReplayCapture(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, rule := range result.Rules {
+		switch {
+		case rule.Error != "":
+			fmt.Printf("%s: error: %s\n", rule.Rule, rule.Error)
+		case rule.Triggers == 0:
+			fmt.Printf("%s: never fired\n", rule.Rule)
+		default:
+			first := result.Start.Add(*rule.FirstTrigger).UTC().Format(time.RFC3339)
+			fmt.Printf("%s: fired %d times, first at %s\n", rule.Rule, rule.Triggers, first)
+		}
+		if rule.Mismatches > 0 {
+			first := result.Start.Add(*rule.FirstMismatch).UTC().Format(time.RFC3339)
+			fmt.Printf("  differs from production in %d of %d evaluations, first at %s\n", rule.Mismatches, rule.Compared, first)
+		} else if rule.Compared > 0 {
+			fmt.Printf("  matches production in all %d evaluations\n", rule.Compared)
+		}
+	}
+	return nil
+}
@@ -22,19 +22,21 @@
 // Usage:
 //   go run descry-example/cmd/server/main.go
 //
-// The server will load monitoring rules from ./rules/*.dscr files and begin
-// monitoring application performance and business metrics automatically.
+// The server will load monitoring rules from ./rules/*.dscr files, reloading
+// them as they change, and begin monitoring application performance and
+// business metrics automatically.
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/chosenoffset/descry/descry-example/internal/ledger"
@@ -45,16 +47,24 @@ func main() {
 	// Initialize Descry engine
 	engine := descry.NewEngine()
 	
-	// Load monitoring rules from files
-	if err := loadRules(engine, "./rules"); err != nil {
+	// Load monitoring rules from files and reload them as they change.
+	// Invalid rule files are reported as rule_error events.
+	if err := engine.WatchRulesDir("./rules", 0); err != nil {
 		log.Fatalf("Failed to load rules: %v", err)
 	}
 	
-	// Start the Descry engine (metrics collection and rule evaluation)
-	engine.Start()
+	// Stop on Ctrl-C or SIGTERM
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	
+	// Start the Descry engine (metrics collection and rule evaluation); it
+	// stops by itself when ctx is cancelled
+	engine.Start(ctx)
 	defer engine.Stop()
 	
-	// Initialize ledger
+	// Initialize ledger. The ledger keeps accounts in memory; one backed by
+	// database/sql would also register its pool, read in rules as db.*:
+	//	engine.RegisterMetricProvider(metrics.NewSQLCollector("db", db))
 	l := ledger.NewLedger()
 	
 	// Get HTTP middleware for monitoring
@@ -71,6 +81,7 @@ func main() {
 	mux.HandleFunc("/descry/rules", handleDescryRules(engine))
 	mux.HandleFunc("/descry/events", handleDescryEvents(engine))
 	mux.HandleFunc("/descry/status", handleDescryStatus(engine))
+	mux.Handle("/debug/descry", engine.DebugHandler())
 	
 	server := &http.Server{
 		Addr:         ":8080",
@@ -84,46 +95,17 @@ func main() {
 	log.Println("Descry dashboard available at http://localhost:9090")
 	log.Printf("Loaded %d monitoring rules", len(engine.GetRules()))
 	
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("server error: %v", err)
-	}
-}
-
-// loadRules loads all .dscr files from the specified directory
-func loadRules(engine *descry.Engine, rulesDir string) error {
-	files, err := filepath.Glob(filepath.Join(rulesDir, "*.dscr"))
-	if err != nil {
-		return fmt.Errorf("failed to scan rules directory: %w", err)
-	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
 	
-	if len(files) == 0 {
-		log.Println("Warning: No rule files found in", rulesDir)
-		return nil
-	}
-	
-	for _, file := range files {
-		content, err := os.ReadFile(file)
-		if err != nil {
-			log.Printf("Warning: Failed to read rule file %s: %v", file, err)
-			continue
-		}
-		
-		// Skip empty files
-		if len(strings.TrimSpace(string(content))) == 0 {
-			log.Printf("Warning: Skipping empty rule file %s", file)
-			continue
-		}
-		
-		ruleName := strings.TrimSuffix(filepath.Base(file), ".dscr")
-		if err := engine.AddRule(ruleName, string(content)); err != nil {
-			log.Printf("Warning: Failed to load rule %s: %v", ruleName, err)
-			continue
-		}
-		
-		log.Printf("Loaded rule file: %s", file)
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("server error: %v", err)
 	}
-	
-	return nil
+	log.Println("Shutting down")
 }
 
 // handleDescryMetrics exposes current metrics as JSON
@@ -152,6 +134,8 @@ func handleDescryMetrics(engine *descry.Engine) http.HandlerFunc {
 				"error_rate":           httpStats.ErrorRate,
 				"avg_response_time_ms": float64(httpStats.AvgResponseTime) / 1000000,
 				"max_response_time_ms": float64(httpStats.MaxResponseTime) / 1000000,
+				"p95_response_time_ms": float64(httpStats.P95ResponseTime) / 1000000,
+				"p99_response_time_ms": float64(httpStats.P99ResponseTime) / 1000000,
 				"pending_requests":     httpStats.PendingRequests,
 			},
 		}
@@ -215,10 +199,24 @@ func handleDescryEvents(engine *descry.Engine) http.HandlerFunc {
 			}
 		}
 		
-		eventType := query.Get("type") // optional filter by type
+		filter := descry.EventQuery{Limit: limit, Rule: query.Get("rule")}
+		eventType := query.Get("type") // optional filter by type, comma-separated
+		if eventType != "" {
+			filter.Types = strings.Split(eventType, ",")
+		}
+		for name, bound := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+			if value := query.Get(name); value != "" {
+				parsed, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					http.Error(w, name+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+					return
+				}
+				*bound = parsed
+			}
+		}
 		
 		// Get event history from engine
-		events := engine.GetEventHistory(limit, eventType)
+		events := engine.QueryEvents(filter)
 		
 		response := map[string]interface{}{
 			"events":      events,
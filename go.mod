@@ -2,4 +2,9 @@ module github.com/chosenoffset/descry
 
 go 1.24.5
 
-require github.com/gorilla/websocket v1.5.3
+require (
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/gorilla/websocket v1.5.3
+)
+
+require golang.org/x/sys v0.13.0 // indirect
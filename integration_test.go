@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -57,7 +58,7 @@ func testEngineLifecycle(t *testing.T) {
 	}
 	
 	// Test engine start
-	engine.Start()
+	engine.Start(context.Background())
 	if !engine.IsRunning() {
 		t.Error("Engine should be running after start")
 	}
@@ -122,7 +123,7 @@ func testRuleProcessing(t *testing.T) {
 	}
 	
 	// Test rule evaluation
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	time.Sleep(300 * time.Millisecond) // Allow some evaluations
@@ -183,7 +184,7 @@ func testMetricCollection(t *testing.T) {
 		t.Fatalf("Failed to load aggregation rule: %v", err)
 	}
 	
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	// Update metrics to build history
@@ -294,7 +295,7 @@ func testConcurrentOperations(t *testing.T) {
 	numGoroutines := 10
 	rulesPerGoroutine := 5
 	
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	// Concurrent rule loading
@@ -360,7 +361,7 @@ func testErrorHandling(t *testing.T) {
 		t.Errorf("Engine should still work after error conditions: %v", err)
 	}
 	
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	// Test metric update edge cases
@@ -402,7 +403,7 @@ func testPerformanceUnderLoad(t *testing.T) {
 		}
 	}
 	
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	// Generate sustained load
@@ -7,6 +7,23 @@
 //   - ConsoleAlertHandler: Prints alerts to stdout
 //   - LogHandler: Writes to Go's standard logger
 //   - DashboardHandler: Sends events to the web dashboard
+//   - WebhookHandler: Posts actions as JSON to an HTTP endpoint, honoring
+//     proxy and custom CA settings from TransportConfig
+//
+// Handler credentials such as webhook URLs and tokens can be given as
+// secret:// references resolved through a SecretsProvider (environment,
+// files or Vault) instead of plaintext values.
+//
+// Actions are fanned out to every handler registered for their type unless a
+// RoutingConfig is installed, in which case routes select named handlers by
+// action type, severity, rule name and tags.
+//
+// Storm detection, enabled with SetStormDetection, collapses bursts of many
+// distinct alerts into a single storm alert and switches handlers to periodic
+// digests until the burst subsides.
+//
+// Quotas, set with SetQuotas, cap how often handlers execute within a
+// sliding window, globally and per named handler.
 //
 // Example usage:
 //
@@ -27,6 +44,8 @@ package actions
 import (
 	"fmt"
 	"log"
+	"reflect"
+	"strings"
 	"sync"
 	"time"
 )
@@ -38,6 +57,12 @@ const (
 	AlertAction     ActionType = "alert"
 	LogAction       ActionType = "log"
 	DashboardAction ActionType = "dashboard"
+	// MetricAction records a derived metric written by a rule with set_metric()
+	MetricAction    ActionType = "metric"
+	// LimitAction reports a rule evaluation stopped by a resource limit. The
+	// engine raises it rather than a rule, and it needs no handler: without
+	// one it only reaches the observers.
+	LimitAction     ActionType = "limit"
 )
 
 // Action represents an action to be executed when a rule triggers
@@ -50,6 +75,18 @@ type Action struct {
 	Timestamp time.Time
 	// RuleName identifies which rule triggered this action
 	RuleName  string
+	// Severity classifies the action (low, medium, high, critical) for routing
+	Severity  string
+	// Tags carry additional labels used by routing matchers, including the
+	// labels of the rule that raised the action
+	Tags      map[string]string
+	// Metric and Value hold the custom metric written by a MetricAction
+	Metric    string
+	Value     float64
+	// Details carry context gathered when the action was raised, such as
+	// the goroutine leak suspects behind an alert. Values must be
+	// JSON-encodable.
+	Details   map[string]interface{}
 }
 
 // ActionHandler is the interface that action processors must implement
@@ -59,10 +96,17 @@ type ActionHandler interface {
 	Handle(action Action) error
 }
 
-// ConsoleAlertHandler prints alert messages to stdout with timestamps
-type ConsoleAlertHandler struct{}
+// ConsoleAlertHandler prints alert messages to stdout with timestamps, or to
+// Logger if one is set
+type ConsoleAlertHandler struct {
+	Logger *log.Logger
+}
 
 func (h *ConsoleAlertHandler) Handle(action Action) error {
+	if h.Logger != nil {
+		h.Logger.Printf("ALERT [%s]: %s", action.RuleName, action.Message)
+		return nil
+	}
 	timestamp := action.Timestamp.Format("15:04:05")
 	fmt.Printf("[%s] ALERT [%s]: %s\n", timestamp, action.RuleName, action.Message)
 	return nil
@@ -90,14 +134,26 @@ func (h *LogHandler) Handle(action Action) error {
 
 // ActionRegistry manages action handlers and executes actions when triggered.
 // Multiple handlers can be registered for the same action type.
+//
+// By default every action is fanned out to all handlers registered for its
+// type. Installing a RoutingConfig replaces that fan-out with declarative
+// routes over named handlers. Observers receive every action either way.
 type ActionRegistry struct {
-	mu       sync.RWMutex
-	handlers map[ActionType][]ActionHandler
+	mu            sync.RWMutex
+	handlers      map[ActionType][]ActionHandler
+	namedHandlers map[string]ActionHandler
+	observers     []ActionHandler
+	routing       *RoutingConfig
+	storm         *stormDetector
+	quotas        *quotaLimiter
+	onQuotaExceeded func(QuotaOverflow)
+	redact        func(Action) Action
 }
 
 func NewActionRegistry() *ActionRegistry {
 	return &ActionRegistry{
-		handlers: make(map[ActionType][]ActionHandler),
+		handlers:      make(map[ActionType][]ActionHandler),
+		namedHandlers: make(map[string]ActionHandler),
 	}
 }
 
@@ -107,28 +163,249 @@ func (r *ActionRegistry) RegisterHandler(actionType ActionType, handler ActionHa
 	r.handlers[actionType] = append(r.handlers[actionType], handler)
 }
 
-func (r *ActionRegistry) ExecuteAction(action Action) error {
+// RegisterNamedHandler registers a handler that routing configurations can
+// reference by name. Registering an existing name replaces the handler.
+func (r *ActionRegistry) RegisterNamedHandler(name string, handler ActionHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.namedHandlers[name] = handler
+}
+
+// RegisterObserver registers a handler that receives every action regardless
+// of routing, such as event history recording or the dashboard feed.
+func (r *ActionRegistry) RegisterObserver(handler ActionHandler) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.observers = append(r.observers, handler)
+}
+
+// SetRedactor installs a function applied to every action before it reaches
+// observers and handlers, to strip sensitive data from messages and details.
+// A nil function removes it.
+func (r *ActionRegistry) SetRedactor(redact func(Action) Action) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.redact = redact
+}
+
+// HandlerRegistrations describes the handlers registered with an
+// ActionRegistry by their Go types, such as "*actions.WebhookHandler", for
+// diagnostics
+type HandlerRegistrations struct {
+	ByType    map[ActionType][]string // Handlers of the default fan-out, per action type
+	Named     map[string]string       // Handlers routing configurations can reference
+	Observers []string
+}
+
+// Registrations returns the registered handlers
+func (r *ActionRegistry) Registrations() HandlerRegistrations {
 	r.mu.RLock()
-	handlers, exists := r.handlers[action.Type]
-	if !exists {
-		r.mu.RUnlock()
-		return fmt.Errorf("no handlers registered for action type: %s", action.Type)
+	defer r.mu.RUnlock()
+
+	registrations := HandlerRegistrations{
+		ByType: make(map[ActionType][]string, len(r.handlers)),
+		Named:  make(map[string]string, len(r.namedHandlers)),
 	}
-	
-	// Copy handlers to release lock quickly
-	handlersCopy := make([]ActionHandler, len(handlers))
-	copy(handlersCopy, handlers)
+	for actionType, handlers := range r.handlers {
+		for _, handler := range handlers {
+			registrations.ByType[actionType] = append(registrations.ByType[actionType], fmt.Sprintf("%T", handler))
+		}
+	}
+	for name, handler := range r.namedHandlers {
+		registrations.Named[name] = fmt.Sprintf("%T", handler)
+	}
+	for _, observer := range r.observers {
+		registrations.Observers = append(registrations.Observers, fmt.Sprintf("%T", observer))
+	}
+	return registrations
+}
+
+// SetRouting installs a routing configuration. Every handler name it references
+// must already be registered. Passing nil restores the default fan-out.
+func (r *ActionRegistry) SetRouting(config *RoutingConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.validateRoutingLocked(config); err != nil {
+		return err
+	}
+	r.routing = config
+	return nil
+}
+
+// ValidateRouting checks a routing configuration as SetRouting would,
+// without installing it
+func (r *ActionRegistry) ValidateRouting(config *RoutingConfig) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.validateRoutingLocked(config)
+}
+
+// validateRoutingLocked checks that every handler a configuration names is
+// registered. The caller must hold r.mu.
+func (r *ActionRegistry) validateRoutingLocked(config *RoutingConfig) error {
+	if config != nil {
+		for _, name := range config.handlerNames() {
+			if _, exists := r.namedHandlers[name]; !exists {
+				return fmt.Errorf("routing config references unknown handler: %s", name)
+			}
+		}
+	}
+	return nil
+}
+
+// GetRouting returns the installed routing configuration, or nil if actions
+// use the default fan-out
+func (r *ActionRegistry) GetRouting() *RoutingConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.routing
+}
+
+// NotifyObservers delivers an action to the observers only, bypassing handlers
+// and routing. It is used for actions whose effect has already been applied,
+// such as metric writes, that should still appear in history and the dashboard.
+func (r *ActionRegistry) NotifyObservers(action Action) error {
+	r.mu.RLock()
+	observers := make([]ActionHandler, len(r.observers))
+	copy(observers, r.observers)
+	redact := r.redact
 	r.mu.RUnlock()
 
-	for _, handler := range handlersCopy {
+	if redact != nil {
+		action = redact(action)
+	}
+
+	for _, handler := range observers {
 		if err := handler.Handle(action); err != nil {
-			return fmt.Errorf("handler error for %s: %w", action.Type, err)
+			return fmt.Errorf("observer error for %s: %w", action.Type, err)
+		}
+	}
+	return nil
+}
+
+// ExecuteAction delivers an action to the observers and to the handlers chosen
+// by routing. When storm detection is enabled, alerts may be replaced by a
+// storm alert or held back for a digest before reaching handlers.
+func (r *ActionRegistry) ExecuteAction(action Action) error {
+	r.mu.RLock()
+	observers := make([]ActionHandler, len(r.observers))
+	copy(observers, r.observers)
+	storm := r.storm
+	redact := r.redact
+	r.mu.RUnlock()
+
+	if redact != nil {
+		action = redact(action)
+	}
+	observed := []Action{action}
+	deliver := []Action{action}
+	if storm != nil && action.Type == AlertAction && action.RuleName != StormRuleName {
+		var started bool
+		deliver, started = storm.admit(action)
+		if started {
+			observed = append(observed, deliver...)
+		}
+	}
+
+	handlers := make([][]routedHandler, len(deliver))
+	for i, a := range deliver {
+		resolved, err := r.handlersFor(a)
+		if err != nil {
+			return err
+		}
+		handlers[i] = resolved
+	}
+
+	for _, a := range observed {
+		for _, handler := range observers {
+			if err := handler.Handle(a); err != nil {
+				return fmt.Errorf("observer error for %s: %w", a.Type, err)
+			}
+		}
+	}
+
+	for i, a := range deliver {
+		if err := r.run(a, handlers[i]); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
+// deliver sends an action to its handlers only, bypassing observers
+func (r *ActionRegistry) deliver(action Action) error {
+	handlers, err := r.handlersFor(action)
+	if err != nil {
+		return err
+	}
+	return r.run(action, handlers)
+}
+
+// run executes an action on each handler its quotas allow
+func (r *ActionRegistry) run(action Action, handlers []routedHandler) error {
+	for _, handler := range handlers {
+		if !r.admitExecution(handler.name, action) {
+			continue
+		}
+		if err := handler.Handle(action); err != nil {
+			return fmt.Errorf("handler error for %s: %w", action.Type, err)
+		}
+	}
+	return nil
+}
+
+// routedHandler is a handler an action is routed to, with the name it is
+// registered under, if any, for quotas
+type routedHandler struct {
+	ActionHandler
+	name string
+}
+
+// handlersFor returns the handlers an action is routed to
+func (r *ActionRegistry) handlersFor(action Action) ([]routedHandler, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.routing != nil {
+		var handlers []routedHandler
+		for _, name := range r.routing.resolve(action) {
+			handlers = append(handlers, routedHandler{r.namedHandlers[name], name})
+		}
+		return handlers, nil
+	}
+
+	handlers, exists := r.handlers[action.Type]
+	if !exists {
+		if action.Type == LimitAction {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("no handlers registered for action type: %s", action.Type)
+	}
+	// Copy handlers to release lock quickly
+	handlersCopy := make([]routedHandler, len(handlers))
+	for i, handler := range handlers {
+		handlersCopy[i] = routedHandler{handler, r.nameOfLocked(handler)}
+	}
+	return handlersCopy, nil
+}
+
+// nameOfLocked returns the name a handler is also registered under, so
+// quotas of named handlers apply to the default fan-out too. Callers hold
+// r.mu.
+func (r *ActionRegistry) nameOfLocked(handler ActionHandler) string {
+	if r.quotas == nil || !reflect.TypeOf(handler).Comparable() {
+		return ""
+	}
+	for name, named := range r.namedHandlers {
+		if named == handler {
+			return name
+		}
+	}
+	return ""
+}
+
 type DashboardHandler struct {
 	sendEvent func(eventType, message, rule string, data interface{})
 }
@@ -140,10 +417,29 @@ func NewDashboardHandler(sendEvent func(eventType, message, rule string, data in
 func (h *DashboardHandler) Handle(action Action) error {
 	if h.sendEvent != nil {
 		eventType := "alert"
-		if action.Type == LogAction {
+		switch action.Type {
+		case LogAction:
 			eventType = "log"
+		case MetricAction:
+			eventType = "metric"
+		case LimitAction:
+			eventType = "limit"
+		}
+		fields := make(map[string]interface{})
+		if action.Severity != "" {
+			fields["severity"] = action.Severity
+		}
+		if len(action.Tags) > 0 {
+			fields["labels"] = action.Tags
 		}
-		h.sendEvent(eventType, action.Message, action.RuleName, nil)
+		for key, value := range action.Details {
+			fields[key] = value
+		}
+		var data interface{}
+		if len(fields) > 0 {
+			data = fields
+		}
+		h.sendEvent(eventType, action.Message, action.RuleName, data)
 	}
 	return nil
 }
@@ -154,5 +450,35 @@ func (r *ActionRegistry) CreateAction(actionType ActionType, message, ruleName s
 		Message:   message,
 		Timestamp: time.Now(),
 		RuleName:  ruleName,
+		Severity:  ClassifySeverity(message),
+	}
+}
+
+// Severities lists the recognised action severity levels in increasing order
+var Severities = []string{"low", "medium", "high", "critical"}
+
+// IsValidSeverity reports whether severity is one of Severities
+func IsValidSeverity(severity string) bool {
+	for _, s := range Severities {
+		if s == severity {
+			return true
+		}
+	}
+	return false
+}
+
+// ClassifySeverity derives a severity level from keywords in an action message.
+// It is used when a rule does not specify a severity explicitly.
+func ClassifySeverity(message string) string {
+	msgLower := strings.ToLower(message)
+	switch {
+	case strings.Contains(msgLower, "critical") || strings.Contains(msgLower, "leak"):
+		return "critical"
+	case strings.Contains(msgLower, "high") || strings.Contains(msgLower, "warning"):
+		return "high"
+	case strings.Contains(msgLower, "info"):
+		return "low"
+	default:
+		return "medium"
 	}
 }
\ No newline at end of file
@@ -0,0 +1,229 @@
+package actions
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// GlobalQuota is the name quota statuses and overflows use for the quota
+// shared by every handler
+const GlobalQuota = "global"
+
+// QuotaConfig caps how often action handlers execute, protecting downstream
+// notification systems such as webhooks and pagers from a runaway rule. Each
+// quota allows a number of executions within a sliding Window; executions
+// beyond it are dropped, not queued. Observers such as event history and the
+// dashboard are not subject to quotas.
+type QuotaConfig struct {
+	// Window is the period quotas are counted over (default 1h)
+	Window time.Duration `json:"window"`
+	// Global caps the executions of all handlers together; zero is unlimited
+	Global int `json:"global,omitempty"`
+	// Handlers caps the executions of named handlers, e.g. {"webhook": 100}
+	Handlers map[string]int `json:"handlers,omitempty"`
+}
+
+// QuotaStatus describes the use of one quota
+type QuotaStatus struct {
+	// Name is a handler name, or GlobalQuota
+	Name  string `json:"name"`
+	Limit int    `json:"limit"`
+	// Used is the number of executions within the current window
+	Used int `json:"used"`
+	// Dropped counts executions dropped since the quota was configured
+	Dropped int64 `json:"dropped"`
+	// Exceeded reports whether the latest execution was dropped
+	Exceeded bool          `json:"exceeded"`
+	Window   time.Duration `json:"window"`
+}
+
+// QuotaOverflow reports a quota that started dropping executions. It is
+// reported once each time a quota overflows, not for every dropped execution.
+type QuotaOverflow struct {
+	// Quota is the handler name, or GlobalQuota
+	Quota  string
+	Limit  int
+	Window time.Duration
+	// Handler is the handler whose execution was dropped
+	Handler string
+	// Action is the first action dropped
+	Action Action
+}
+
+func (o QuotaOverflow) String() string {
+	if o.Quota == GlobalQuota {
+		return fmt.Sprintf("Action quota exceeded: more than %d handler executions in %s, dropping %s for %s", o.Limit, o.Window, o.Action.Type, o.Handler)
+	}
+	return fmt.Sprintf("Action quota exceeded: handler %s ran more than %d times in %s, dropping %s", o.Quota, o.Limit, o.Window, o.Action.Type)
+}
+
+// quotaCounter keeps the times of the executions within the window
+type quotaCounter struct {
+	limit    int
+	used     []time.Time
+	dropped  int64
+	exceeded bool
+}
+
+// prune drops executions older than the window
+func (c *quotaCounter) prune(cutoff time.Time) {
+	i := 0
+	for i < len(c.used) && !c.used[i].After(cutoff) {
+		i++
+	}
+	c.used = c.used[i:]
+}
+
+// quotaLimiter applies a QuotaConfig
+type quotaLimiter struct {
+	mu       sync.Mutex
+	window   time.Duration
+	global   *quotaCounter
+	handlers map[string]*quotaCounter
+}
+
+func newQuotaLimiter(config QuotaConfig) *quotaLimiter {
+	if config.Window <= 0 {
+		config.Window = time.Hour
+	}
+	limiter := &quotaLimiter{window: config.Window, handlers: make(map[string]*quotaCounter)}
+	if config.Global > 0 {
+		limiter.global = &quotaCounter{limit: config.Global}
+	}
+	for name, limit := range config.Handlers {
+		if limit > 0 {
+			limiter.handlers[name] = &quotaCounter{limit: limit}
+		}
+	}
+	return limiter
+}
+
+// admit counts an execution of the named handler at the action's time if
+// every quota that applies allows it. overflow is set when the execution is
+// the first a quota drops since it was last within its limit.
+func (l *quotaLimiter) admit(handler string, action Action) (allowed bool, overflow *QuotaOverflow) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := action.Timestamp
+	cutoff := now.Add(-l.window)
+	var counters []*quotaCounter
+	names := []string{}
+	if counter := l.handlers[handler]; counter != nil && handler != "" {
+		counters = append(counters, counter)
+		names = append(names, handler)
+	}
+	if l.global != nil {
+		counters = append(counters, l.global)
+		names = append(names, GlobalQuota)
+	}
+
+	for i, counter := range counters {
+		counter.prune(cutoff)
+		if len(counter.used) < counter.limit {
+			continue
+		}
+		counter.dropped++
+		if !counter.exceeded {
+			counter.exceeded = true
+			overflow = &QuotaOverflow{Quota: names[i], Limit: counter.limit, Window: l.window, Handler: handler, Action: action}
+		}
+		return false, overflow
+	}
+	for _, counter := range counters {
+		counter.used = append(counter.used, now)
+		counter.exceeded = false
+	}
+	return true, nil
+}
+
+// status reports the use of every quota at now, the global quota first and
+// handlers by name
+func (l *quotaLimiter) status(now time.Time) []QuotaStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := now.Add(-l.window)
+	describe := func(name string, counter *quotaCounter) QuotaStatus {
+		counter.prune(cutoff)
+		return QuotaStatus{Name: name, Limit: counter.limit, Used: len(counter.used), Dropped: counter.dropped,
+			Exceeded: counter.exceeded, Window: l.window}
+	}
+
+	var statuses []QuotaStatus
+	if l.global != nil {
+		statuses = append(statuses, describe(GlobalQuota, l.global))
+	}
+	names := make([]string, 0, len(l.handlers))
+	for name := range l.handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		statuses = append(statuses, describe(name, l.handlers[name]))
+	}
+	return statuses
+}
+
+// SetQuotas installs execution quotas, replacing any set before and resetting
+// their counts. Every handler name must already be registered. Passing nil
+// removes the quotas.
+func (r *ActionRegistry) SetQuotas(config *QuotaConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if config == nil {
+		r.quotas = nil
+		return nil
+	}
+	for name, limit := range config.Handlers {
+		if _, exists := r.namedHandlers[name]; !exists {
+			return fmt.Errorf("quota references unknown handler %q", name)
+		}
+		if limit < 0 {
+			return fmt.Errorf("quota for handler %q must not be negative", name)
+		}
+	}
+	if config.Global < 0 {
+		return fmt.Errorf("global quota must not be negative")
+	}
+	r.quotas = newQuotaLimiter(*config)
+	return nil
+}
+
+// GetQuotaStatus returns the use of every configured quota at now, or nil if
+// no quotas are set
+func (r *ActionRegistry) GetQuotaStatus(now time.Time) []QuotaStatus {
+	r.mu.RLock()
+	quotas := r.quotas
+	r.mu.RUnlock()
+	if quotas == nil {
+		return nil
+	}
+	return quotas.status(now)
+}
+
+// OnQuotaExceeded registers a callback for quotas that start dropping
+// executions. It replaces any callback registered before.
+func (r *ActionRegistry) OnQuotaExceeded(handler func(QuotaOverflow)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onQuotaExceeded = handler
+}
+
+// admitExecution reports whether quotas allow the named handler to execute
+// an action, reporting an overflow to the OnQuotaExceeded callback
+func (r *ActionRegistry) admitExecution(handler string, action Action) bool {
+	r.mu.RLock()
+	quotas, onExceeded := r.quotas, r.onQuotaExceeded
+	r.mu.RUnlock()
+	if quotas == nil {
+		return true
+	}
+	allowed, overflow := quotas.admit(handler, action)
+	if overflow != nil && onExceeded != nil {
+		onExceeded(*overflow)
+	}
+	return allowed
+}
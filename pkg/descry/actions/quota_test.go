@@ -0,0 +1,65 @@
+package actions
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuotas(t *testing.T) {
+	var paged, logged, observed []Action
+	registry := NewActionRegistry()
+	pager := &capturingHandler{actions: &paged}
+	registry.RegisterHandler(AlertAction, pager)
+	registry.RegisterNamedHandler("pager", pager)
+	registry.RegisterHandler(AlertAction, &capturingHandler{actions: &logged})
+	registry.RegisterObserver(&capturingHandler{actions: &observed})
+
+	if err := registry.SetQuotas(&QuotaConfig{Handlers: map[string]int{"missing": 1}}); err == nil {
+		t.Error("expected an error for a quota on an unknown handler")
+	}
+	if err := registry.SetQuotas(&QuotaConfig{Window: time.Hour, Global: 5, Handlers: map[string]int{"pager": 2}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var overflows []QuotaOverflow
+	registry.OnQuotaExceeded(func(overflow QuotaOverflow) { overflows = append(overflows, overflow) })
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	alert := func(offset time.Duration) {
+		t.Helper()
+		action := Action{Type: AlertAction, RuleName: "runaway", Message: "Queue backing up", Timestamp: start.Add(offset)}
+		if err := registry.ExecuteAction(action); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		alert(time.Duration(i) * time.Minute)
+	}
+
+	// The pager stops after 2, and the global quota of 5 executions is
+	// shared by both handlers
+	if len(paged) != 2 || len(logged) != 3 || len(observed) != 4 {
+		t.Errorf("expected 2 pages, 3 logs and every action observed, got %d, %d and %d", len(paged), len(logged), len(observed))
+	}
+	if len(overflows) != 2 || overflows[0].Quota != "pager" || overflows[1].Quota != GlobalQuota || overflows[1].Handler != "" {
+		t.Errorf("expected one overflow per quota, got %+v", overflows)
+	}
+
+	status := registry.GetQuotaStatus(start.Add(4 * time.Minute))
+	if len(status) != 2 || status[0].Name != GlobalQuota || status[0].Used != 5 || status[0].Dropped != 1 ||
+		status[1].Name != "pager" || status[1].Used != 2 || status[1].Dropped != 2 || !status[1].Exceeded {
+		t.Errorf("unexpected quota status: %+v", status)
+	}
+
+	// Executions leave the quota after the window
+	alert(time.Hour + time.Minute)
+	if len(paged) != 3 {
+		t.Errorf("expected the pager to run again after the window, got %d pages", len(paged))
+	}
+	if status := registry.GetQuotaStatus(start.Add(time.Hour + time.Minute)); status[1].Used != 1 || status[1].Exceeded {
+		t.Errorf("expected the pager quota to recover, got %+v", status[1])
+	}
+
+	if err := registry.SetQuotas(nil); err != nil || registry.GetQuotaStatus(start) != nil {
+		t.Error("expected quotas to be removed")
+	}
+}
@@ -0,0 +1,179 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+// RoutingConfig declares which named handlers receive which actions. It replaces
+// the default behaviour of fanning every action out to all handlers registered
+// for its type.
+//
+// Routes are evaluated in order. When a route matches, its child routes are
+// evaluated; the deepest matching route supplies the handler chain. Evaluation
+// stops at the first matching top-level route unless it sets Continue. Actions
+// matching no route are sent to the Fallback handlers.
+//
+// Example routes.json:
+//
+//	{
+//	  "routes": [
+//	    {
+//	      "match": {"severity": ["critical"]},
+//	      "handlers": ["pagerduty", "slack"],
+//	      "routes": [
+//	        {"match": {"rules": ["billing_*"]}, "handlers": ["billing-oncall"]}
+//	      ]
+//	    },
+//	    {"match": {"types": ["log"]}, "handlers": ["log"]}
+//	  ],
+//	  "fallback": ["console"]
+//	}
+type RoutingConfig struct {
+	Routes   []Route  `json:"routes"`
+	Fallback []string `json:"fallback,omitempty"`
+}
+
+// Route sends matching actions to a chain of named handlers
+type Route struct {
+	// Match selects the actions this route applies to
+	Match RouteMatch `json:"match"`
+	// Handlers are the names of handlers executed in order for matching actions
+	Handlers []string `json:"handlers,omitempty"`
+	// Routes are nested routes that refine this route's match
+	Routes []Route `json:"routes,omitempty"`
+	// Continue keeps evaluating sibling routes after this route matches
+	Continue bool `json:"continue,omitempty"`
+}
+
+// RouteMatch describes the actions a route applies to. Every non-empty field
+// must match; an empty RouteMatch matches all actions.
+type RouteMatch struct {
+	// Types matches the action type (alert, log, ...)
+	Types []ActionType `json:"types,omitempty"`
+	// Severity matches the action severity (low, medium, high, critical)
+	Severity []string `json:"severity,omitempty"`
+	// Rules matches the rule name using shell-style patterns (e.g. "billing_*")
+	Rules []string `json:"rules,omitempty"`
+	// Tags requires each listed tag to be present with the given value
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// LoadRoutingConfig reads a routing configuration from a JSON file
+func LoadRoutingConfig(filename string) (*RoutingConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing config: %w", err)
+	}
+	return ParseRoutingConfig(data)
+}
+
+// ParseRoutingConfig decodes a routing configuration from JSON
+func ParseRoutingConfig(data []byte) (*RoutingConfig, error) {
+	var config RoutingConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid routing config: %w", err)
+	}
+	return &config, nil
+}
+
+// matches reports whether the action satisfies every condition of the match
+func (m RouteMatch) matches(action Action) bool {
+	if len(m.Types) > 0 {
+		found := false
+		for _, t := range m.Types {
+			if t == action.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(m.Severity) > 0 {
+		found := false
+		for _, severity := range m.Severity {
+			if severity == action.Severity {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(m.Rules) > 0 {
+		found := false
+		for _, pattern := range m.Rules {
+			if ok, _ := path.Match(pattern, action.RuleName); ok {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	for key, value := range m.Tags {
+		if action.Tags[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// resolve returns the handler names for the action, or nil if no route matched
+func (c *RoutingConfig) resolve(action Action) []string {
+	if names, matched := resolveRoutes(c.Routes, action); matched {
+		return names
+	}
+	return c.Fallback
+}
+
+// resolveRoutes evaluates sibling routes and collects the handler chains of
+// the matching ones
+func resolveRoutes(routes []Route, action Action) ([]string, bool) {
+	var names []string
+	matched := false
+
+	for _, route := range routes {
+		if !route.Match.matches(action) {
+			continue
+		}
+		matched = true
+
+		// The deepest matching child route wins over the parent's handlers
+		if childNames, childMatched := resolveRoutes(route.Routes, action); childMatched {
+			names = append(names, childNames...)
+		} else {
+			names = append(names, route.Handlers...)
+		}
+
+		if !route.Continue {
+			break
+		}
+	}
+
+	return names, matched
+}
+
+// handlerNames returns every handler name referenced by the configuration
+func (c *RoutingConfig) handlerNames() []string {
+	names := append([]string{}, c.Fallback...)
+	var collect func(routes []Route)
+	collect = func(routes []Route) {
+		for _, route := range routes {
+			names = append(names, route.Handlers...)
+			collect(route.Routes)
+		}
+	}
+	collect(c.Routes)
+	return names
+}
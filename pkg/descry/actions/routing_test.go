@@ -0,0 +1,73 @@
+package actions
+
+import "testing"
+
+type recordingHandler struct {
+	name  string
+	calls *[]string
+}
+
+func (h *recordingHandler) Handle(action Action) error {
+	*h.calls = append(*h.calls, h.name)
+	return nil
+}
+
+func TestRoutingConfig(t *testing.T) {
+	var calls []string
+	registry := NewActionRegistry()
+	for _, name := range []string{"pager", "billing", "slack", "console"} {
+		registry.RegisterNamedHandler(name, &recordingHandler{name: name, calls: &calls})
+	}
+	registry.RegisterObserver(&recordingHandler{name: "history", calls: &calls})
+
+	config, err := ParseRoutingConfig([]byte(`{
+		"routes": [
+			{
+				"match": {"severity": ["critical"]},
+				"handlers": ["pager"],
+				"routes": [{"match": {"rules": ["billing_*"]}, "handlers": ["billing"]}],
+				"continue": true
+			},
+			{"match": {"types": ["alert"], "tags": {"team": "web"}}, "handlers": ["slack"]}
+		],
+		"fallback": ["console"]
+	}`))
+	if err != nil {
+		t.Fatalf("failed to parse routing config: %v", err)
+	}
+	if err := registry.SetRouting(config); err != nil {
+		t.Fatalf("failed to install routing config: %v", err)
+	}
+
+	tests := []struct {
+		action   Action
+		expected []string
+	}{
+		{Action{Type: AlertAction, Severity: "critical", RuleName: "heap"}, []string{"history", "pager"}},
+		{Action{Type: AlertAction, Severity: "critical", RuleName: "billing_errors"}, []string{"history", "billing"}},
+		{Action{Type: AlertAction, Severity: "critical", Tags: map[string]string{"team": "web"}}, []string{"history", "pager", "slack"}},
+		{Action{Type: LogAction, Severity: "low"}, []string{"history", "console"}},
+	}
+
+	for _, tt := range tests {
+		calls = nil
+		if err := registry.ExecuteAction(tt.action); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(calls) != len(tt.expected) {
+			t.Errorf("%+v: expected handlers %v, got %v", tt.action, tt.expected, calls)
+			continue
+		}
+		for i := range calls {
+			if calls[i] != tt.expected[i] {
+				t.Errorf("%+v: expected handlers %v, got %v", tt.action, tt.expected, calls)
+				break
+			}
+		}
+	}
+
+	badConfig := &RoutingConfig{Fallback: []string{"missing"}}
+	if err := registry.SetRouting(badConfig); err == nil {
+		t.Error("expected error for unknown handler name")
+	}
+}
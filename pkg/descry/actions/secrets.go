@@ -0,0 +1,210 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretPrefix marks a handler configuration value as a reference to a secret,
+// e.g. "secret://slack_token". References are resolved through a
+// SecretsProvider each time the value is used, so credentials never need to
+// appear in configuration files.
+const SecretPrefix = "secret://"
+
+// SecretsProvider looks up secret values by name for handler credentials
+type SecretsProvider interface {
+	// GetSecret returns the value of the named secret
+	GetSecret(name string) (string, error)
+}
+
+// IsSecretRef reports whether value is a secret:// reference
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretPrefix)
+}
+
+// ResolveSecret returns value unchanged unless it is a secret:// reference, in
+// which case the referenced secret is fetched from provider
+func ResolveSecret(provider SecretsProvider, value string) (string, error) {
+	if !IsSecretRef(value) {
+		return value, nil
+	}
+
+	name := strings.TrimPrefix(value, SecretPrefix)
+	if name == "" {
+		return "", fmt.Errorf("empty secret reference")
+	}
+	if provider == nil {
+		return "", fmt.Errorf("no secrets provider configured for secret: %s", name)
+	}
+
+	secret, err := provider.GetSecret(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve secret %s: %w", name, err)
+	}
+	return secret, nil
+}
+
+// EnvSecretsProvider reads secrets from environment variables. The secret
+// name is upper-cased and appended to Prefix, so with Prefix "DESCRY_"
+// secret://slack_token reads DESCRY_SLACK_TOKEN.
+type EnvSecretsProvider struct {
+	Prefix string
+}
+
+func (p *EnvSecretsProvider) GetSecret(name string) (string, error) {
+	key := p.Prefix + strings.ToUpper(name)
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", key)
+	}
+	return value, nil
+}
+
+// FileSecretsProvider reads each secret from a file named after it in Dir,
+// as with Docker and Kubernetes secret mounts. Surrounding whitespace is trimmed.
+type FileSecretsProvider struct {
+	Dir string
+}
+
+func (p *FileSecretsProvider) GetSecret(name string) (string, error) {
+	// Secret names must not escape the secrets directory
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("invalid secret name: %q", name)
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// maxVaultResponseSize bounds the size of responses read from Vault
+const maxVaultResponseSize = 1 << 20
+
+// DefaultVaultCacheTTL is how long a VaultSecretsProvider reuses the secret it
+// last read before asking Vault again
+const DefaultVaultCacheTTL = 5 * time.Minute
+
+// VaultSecretsProvider reads secrets from a HashiCorp Vault KV version 2
+// secret. Each secret name is a key within the secret at the configured path,
+// so secret://slack_token with path "descry/handlers" reads the slack_token
+// key of the descry/handlers secret. The secret is cached for the cache TTL,
+// so an alert storm does not become a stream of Vault requests.
+type VaultSecretsProvider struct {
+	address string
+	token   string
+	mount   string
+	path    string
+	client  *http.Client
+
+	mu      sync.Mutex
+	ttl     time.Duration
+	data    map[string]interface{}
+	fetched time.Time
+	now     func() time.Time
+}
+
+// NewVaultSecretsProvider creates a provider for the Vault server at address.
+// An empty token falls back to the VAULT_TOKEN environment variable and an
+// empty mount defaults to "secret".
+func NewVaultSecretsProvider(address, token, mount, path string, config TransportConfig) (*VaultSecretsProvider, error) {
+	if address == "" {
+		return nil, fmt.Errorf("vault address is required")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("vault token is required")
+	}
+	if mount == "" {
+		mount = "secret"
+	}
+
+	client, err := NewHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &VaultSecretsProvider{
+		address: strings.TrimRight(address, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+		path:    strings.Trim(path, "/"),
+		client:  client,
+		ttl:     DefaultVaultCacheTTL,
+		now:     time.Now,
+	}, nil
+}
+
+// SetCacheTTL sets how long the secret read from Vault is reused. Zero
+// disables caching so every lookup reads from Vault.
+func (p *VaultSecretsProvider) SetCacheTTL(ttl time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ttl = ttl
+	p.data = nil
+}
+
+func (p *VaultSecretsProvider) GetSecret(name string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.data == nil || p.now().Sub(p.fetched) >= p.ttl {
+		data, err := p.fetch()
+		if err != nil {
+			return "", err
+		}
+		p.data = data
+		p.fetched = p.now()
+	}
+
+	value, ok := p.data[name].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s not found in vault path %s", name, p.path)
+	}
+	return value, nil
+}
+
+// fetch reads the keys of the configured secret from Vault
+func (p *VaultSecretsProvider) fetch() (map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", p.address, p.mount, p.path)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create vault request: %w", err)
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, fmt.Errorf("vault returned status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxVaultResponseSize)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid vault response: %w", err)
+	}
+
+	if body.Data.Data == nil {
+		return map[string]interface{}{}, nil
+	}
+	return body.Data.Data, nil
+}
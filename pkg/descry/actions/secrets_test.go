@@ -0,0 +1,108 @@
+package actions
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecretsProviders(t *testing.T) {
+	t.Setenv("DESCRY_SLACK_TOKEN", "env-token")
+	env := &EnvSecretsProvider{Prefix: "DESCRY_"}
+	if value, err := ResolveSecret(env, "secret://slack_token"); err != nil || value != "env-token" {
+		t.Errorf("expected env secret, got %q (%v)", value, err)
+	}
+	if value, err := ResolveSecret(nil, "plain"); err != nil || value != "plain" {
+		t.Errorf("expected plain value unchanged, got %q (%v)", value, err)
+	}
+	if _, err := ResolveSecret(nil, "secret://slack_token"); err == nil {
+		t.Error("expected error resolving a reference without a provider")
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "pager_key"), []byte("file-key\n"), 0600)
+	files := &FileSecretsProvider{Dir: dir}
+	if value, err := files.GetSecret("pager_key"); err != nil || value != "file-key" {
+		t.Errorf("expected file secret, got %q (%v)", value, err)
+	}
+	if _, err := files.GetSecret("../pager_key"); err == nil {
+		t.Error("expected error for secret name escaping the directory")
+	}
+
+	var vaultRequests int
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		vaultRequests++
+		if r.Header.Get("X-Vault-Token") != "vault-token" || r.URL.Path != "/v1/secret/data/descry/handlers" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"data": {"data": {"slack_token": "vault-secret"}}}`))
+	}))
+	defer vault.Close()
+
+	provider, err := NewVaultSecretsProvider(vault.URL, "vault-token", "", "descry/handlers", TransportConfig{ProxyURL: "direct"})
+	if err != nil {
+		t.Fatalf("failed to create vault provider: %v", err)
+	}
+	if value, err := provider.GetSecret("slack_token"); err != nil || value != "vault-secret" {
+		t.Errorf("expected vault secret, got %q (%v)", value, err)
+	}
+	if _, err := provider.GetSecret("missing"); err == nil {
+		t.Error("expected error for missing vault key")
+	}
+
+	// Lookups within the cache TTL reuse the secret already read
+	now := time.Now()
+	provider.now = func() time.Time { return now }
+	provider.SetCacheTTL(time.Minute)
+	for i := 0; i < 3; i++ {
+		provider.GetSecret("slack_token")
+	}
+	if vaultRequests != 2 {
+		t.Errorf("expected one vault request within the TTL, got %d", vaultRequests-1)
+	}
+	now = now.Add(time.Minute)
+	if value, err := provider.GetSecret("slack_token"); err != nil || value != "vault-secret" || vaultRequests != 3 {
+		t.Errorf("expected the secret to be read again after the TTL, got %q (%v) after %d requests", value, err, vaultRequests)
+	}
+}
+
+func TestWebhookHandlerSecrets(t *testing.T) {
+	t.Setenv("DESCRY_HOOK_TOKEN", "Bearer s3cret")
+
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+	t.Setenv("DESCRY_HOOK_URL", server.URL)
+
+	headers := map[string]string{"Authorization": "secret://hook_token"}
+	handler, err := NewWebhookHandlerWithSecrets("secret://hook_url", headers, TransportConfig{ProxyURL: "direct"},
+		&EnvSecretsProvider{Prefix: "DESCRY_"})
+	if err != nil {
+		t.Fatalf("failed to create webhook handler: %v", err)
+	}
+	if err := handler.Handle(Action{Type: AlertAction, Message: "secret"}); err != nil {
+		t.Fatalf("webhook delivery failed: %v", err)
+	}
+	if authorization != "Bearer s3cret" {
+		t.Errorf("expected resolved authorization header, got %q", authorization)
+	}
+
+	// Delivery errors name the reference, not the URL with its embedded token
+	server.Close()
+	t.Setenv("DESCRY_HOOK_URL", server.URL+"/services/T0KEN")
+	if err := handler.Handle(Action{Type: AlertAction}); err == nil || strings.Contains(err.Error(), "T0KEN") ||
+		!strings.Contains(err.Error(), "secret://hook_url") {
+		t.Errorf("expected a delivery error naming only the reference, got %v", err)
+	}
+	t.Setenv("DESCRY_HOOK_URL", "http://hooks.example.com:T0KEN/services")
+	if err := handler.Handle(Action{Type: AlertAction}); err == nil || strings.Contains(err.Error(), "T0KEN") {
+		t.Errorf("expected a request error without the secret, got %v", err)
+	}
+}
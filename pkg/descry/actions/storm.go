@@ -0,0 +1,267 @@
+package actions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StormRuleName is the rule name carried by the alerts the registry raises
+// when it detects, digests and ends an alert storm
+const StormRuleName = "alert_storm"
+
+// StormConfig enables alert storm detection. When at least Threshold distinct
+// alerts (by rule and message) fire within Window, handlers receive a single
+// storm alert summarizing the contributors instead of the alert that crossed
+// the threshold. While the storm lasts, further alerts are held back from
+// handlers and delivered as one digest every DigestInterval. The storm ends
+// once fewer than Threshold distinct alerts fire within Window.
+//
+// Observers such as event history and the dashboard still receive every alert.
+type StormConfig struct {
+	// Window is the period over which distinct alerts are counted (default 1m)
+	Window time.Duration `json:"window"`
+	// Threshold is the number of distinct alerts that starts a storm (default 10)
+	Threshold int `json:"threshold"`
+	// DigestInterval is how often held-back alerts are delivered (default 1m)
+	DigestInterval time.Duration `json:"digest_interval"`
+}
+
+// StormStatus describes the current state of storm detection
+type StormStatus struct {
+	Active    bool      `json:"active"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+	// Pending is the number of alerts held back for the next digest
+	Pending int `json:"pending"`
+}
+
+// stormEntry is an alert observed within the detection window
+type stormEntry struct {
+	key  string
+	rule string
+	at   time.Time
+}
+
+// stormDetector tracks recent alerts and the digest held back during a storm
+type stormDetector struct {
+	mu        sync.Mutex
+	config    StormConfig
+	recent    []stormEntry
+	active    bool
+	startedAt time.Time
+	lastFlush time.Time
+	pending   []Action
+}
+
+func newStormDetector(config StormConfig) *stormDetector {
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.Threshold <= 0 {
+		config.Threshold = 10
+	}
+	if config.DigestInterval <= 0 {
+		config.DigestInterval = time.Minute
+	}
+	return &stormDetector{config: config}
+}
+
+// admit records an alert and returns the actions handlers should receive in
+// its place. started reports whether this alert started a storm.
+func (d *stormDetector) admit(action Action) (deliver []Action, started bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := action.Timestamp
+	d.recent = append(d.recent, stormEntry{
+		key:  action.RuleName + "\x00" + action.Message,
+		rule: action.RuleName,
+		at:   now,
+	})
+	d.prune(now)
+
+	if d.active {
+		d.pending = append(d.pending, action)
+		return nil, false
+	}
+
+	distinct, contributors := d.summarize()
+	if distinct < d.config.Threshold {
+		return []Action{action}, false
+	}
+
+	d.active = true
+	d.startedAt = now
+	d.lastFlush = now
+	return []Action{{
+		Type:      AlertAction,
+		Message:   fmt.Sprintf("Alert storm: %d distinct alerts in %s from %s", distinct, d.config.Window, contributors),
+		Timestamp: now,
+		RuleName:  StormRuleName,
+		Severity:  "critical",
+		Tags:      map[string]string{"storm": "start"},
+	}}, true
+}
+
+// tick returns the digest due at now, if any, and ends the storm once it has
+// subsided
+func (d *stormDetector) tick(now time.Time) []Action {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.active {
+		return nil
+	}
+	d.prune(now)
+
+	distinct, _ := d.summarize()
+	if distinct < d.config.Threshold {
+		duration := now.Sub(d.startedAt).Round(time.Second)
+		digest := d.digest(now, fmt.Sprintf("Alert storm subsided after %s", duration), "end")
+		d.active = false
+		d.pending = nil
+		return []Action{digest}
+	}
+
+	if len(d.pending) == 0 || now.Sub(d.lastFlush) < d.config.DigestInterval {
+		return nil
+	}
+	digest := d.digest(now, "Alert digest", "digest")
+	d.pending = nil
+	d.lastFlush = now
+	return []Action{digest}
+}
+
+// digest summarizes the pending alerts in a single action. Its severity is the
+// highest severity among them.
+func (d *stormDetector) digest(now time.Time, title, stage string) Action {
+	counts := make(map[string]int)
+	severity := "low"
+	for _, action := range d.pending {
+		counts[action.RuleName]++
+		if severityRank(action.Severity) > severityRank(severity) {
+			severity = action.Severity
+		}
+	}
+
+	message := fmt.Sprintf("%s: %d alerts held back", title, len(d.pending))
+	if len(d.pending) > 0 {
+		message += " from " + formatContributors(counts)
+	}
+	return Action{
+		Type:      AlertAction,
+		Message:   message,
+		Timestamp: now,
+		RuleName:  StormRuleName,
+		Severity:  severity,
+		Tags:      map[string]string{"storm": stage},
+	}
+}
+
+// status reports whether a storm is active
+func (d *stormDetector) status() StormStatus {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return StormStatus{Active: d.active, StartedAt: d.startedAt, Pending: len(d.pending)}
+}
+
+// prune drops alerts older than the detection window
+func (d *stormDetector) prune(now time.Time) {
+	cutoff := now.Add(-d.config.Window)
+	i := 0
+	for i < len(d.recent) && d.recent[i].at.Before(cutoff) {
+		i++
+	}
+	d.recent = d.recent[i:]
+}
+
+// summarize counts the distinct alerts in the window and formats the rules
+// that raised them
+func (d *stormDetector) summarize() (int, string) {
+	seen := make(map[string]bool)
+	counts := make(map[string]int)
+	for _, entry := range d.recent {
+		if seen[entry.key] {
+			continue
+		}
+		seen[entry.key] = true
+		counts[entry.rule]++
+	}
+	return len(seen), formatContributors(counts)
+}
+
+// formatContributors lists rules by descending alert count, e.g.
+// "db_check (5), queue_check (2)"
+func formatContributors(counts map[string]int) string {
+	rules := make([]string, 0, len(counts))
+	for rule := range counts {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if counts[rules[i]] != counts[rules[j]] {
+			return counts[rules[i]] > counts[rules[j]]
+		}
+		return rules[i] < rules[j]
+	})
+
+	parts := make([]string, len(rules))
+	for i, rule := range rules {
+		parts[i] = fmt.Sprintf("%s (%d)", rule, counts[rule])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// severityRank orders severities by their position in Severities
+func severityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// SetStormDetection enables alert storm detection with the given configuration.
+// Passing nil disables it; any alerts held back for a digest are discarded.
+func (r *ActionRegistry) SetStormDetection(config *StormConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if config == nil {
+		r.storm = nil
+		return
+	}
+	r.storm = newStormDetector(*config)
+}
+
+// GetStormStatus returns the state of storm detection, or nil if it is disabled
+func (r *ActionRegistry) GetStormStatus() *StormStatus {
+	r.mu.RLock()
+	storm := r.storm
+	r.mu.RUnlock()
+	if storm == nil {
+		return nil
+	}
+	status := storm.status()
+	return &status
+}
+
+// CheckStorm delivers the digest of alerts held back during a storm when it is
+// due, and ends the storm once it has subsided. It should be called
+// periodically while storm detection is enabled.
+func (r *ActionRegistry) CheckStorm(now time.Time) error {
+	r.mu.RLock()
+	storm := r.storm
+	r.mu.RUnlock()
+	if storm == nil {
+		return nil
+	}
+
+	for _, action := range storm.tick(now) {
+		if err := r.deliver(action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package actions
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type capturingHandler struct {
+	actions *[]Action
+}
+
+func (h *capturingHandler) Handle(action Action) error {
+	*h.actions = append(*h.actions, action)
+	return nil
+}
+
+func TestStormDetection(t *testing.T) {
+	var handled, observed []Action
+	registry := NewActionRegistry()
+	registry.RegisterHandler(AlertAction, &capturingHandler{actions: &handled})
+	registry.RegisterObserver(&capturingHandler{actions: &observed})
+	registry.SetStormDetection(&StormConfig{Window: time.Minute, Threshold: 3, DigestInterval: 30 * time.Second})
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	alert := func(rule, message string, offset time.Duration) {
+		t.Helper()
+		action := Action{Type: AlertAction, RuleName: rule, Message: message, Severity: "high", Timestamp: start.Add(offset)}
+		if err := registry.ExecuteAction(action); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Repeats of the same alert are not distinct
+	alert("db_check", "Database slow", 0)
+	alert("db_check", "Database slow", time.Second)
+	alert("queue_check", "Queue backing up", 2*time.Second)
+	if len(handled) != 3 || registry.GetStormStatus().Active {
+		t.Fatalf("expected alerts below the threshold to pass through, got %d", len(handled))
+	}
+
+	alert("db_check", "Database down", 3*time.Second)
+	if !registry.GetStormStatus().Active {
+		t.Fatal("expected storm to start at the threshold")
+	}
+	storm := handled[len(handled)-1]
+	if storm.RuleName != StormRuleName || storm.Tags["storm"] != "start" {
+		t.Fatalf("expected storm alert, got %+v", storm)
+	}
+	if !strings.Contains(storm.Message, "3 distinct alerts") || !strings.Contains(storm.Message, "db_check (2), queue_check (1)") {
+		t.Errorf("unexpected storm summary: %s", storm.Message)
+	}
+	if len(observed) != 5 || observed[4].RuleName != StormRuleName {
+		t.Errorf("expected observers to see every alert and the storm alert, got %d", len(observed))
+	}
+
+	for i := 0; i < 5; i++ {
+		alert("api_check", fmt.Sprintf("Endpoint %d failing", i), 10*time.Second)
+	}
+	if len(handled) != 4 {
+		t.Errorf("expected alerts to be held back during the storm, got %d handled", len(handled))
+	}
+
+	if err := registry.CheckStorm(start.Add(20 * time.Second)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(handled) != 4 {
+		t.Errorf("expected no digest before the digest interval")
+	}
+	if err := registry.CheckStorm(start.Add(40 * time.Second)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	digest := handled[len(handled)-1]
+	if digest.Tags["storm"] != "digest" || !strings.Contains(digest.Message, "5 alerts held back from api_check (5)") {
+		t.Errorf("unexpected digest: %+v", digest)
+	}
+
+	if err := registry.CheckStorm(start.Add(2 * time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if registry.GetStormStatus().Active {
+		t.Error("expected storm to end once alerts stop")
+	}
+	if end := handled[len(handled)-1]; end.Tags["storm"] != "end" {
+		t.Errorf("expected storm end notice, got %+v", end)
+	}
+
+	alert("db_check", "Database slow", 3*time.Minute)
+	if last := handled[len(handled)-1]; last.RuleName != "db_check" {
+		t.Errorf("expected alerts to pass through after the storm, got %+v", last)
+	}
+
+	registry.SetStormDetection(nil)
+	if registry.GetStormStatus() != nil {
+		t.Error("expected storm detection to be disabled")
+	}
+}
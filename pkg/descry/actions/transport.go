@@ -0,0 +1,198 @@
+package actions
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultOutboundTimeout bounds each request made by outbound notification handlers
+const DefaultOutboundTimeout = 10 * time.Second
+
+// TransportConfig configures the HTTP connections made by outbound notification
+// handlers such as WebhookHandler, including proxies and mutual TLS. The zero
+// value honors the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables
+// and trusts the system CAs.
+type TransportConfig struct {
+	// ProxyURL routes this handler's requests through the given proxy instead of
+	// the environment configuration. Use "direct" to bypass all proxies.
+	ProxyURL string
+	// NoProxy lists hosts that bypass ProxyURL. Entries match the host exactly or,
+	// when starting with ".", any subdomain. Ignored unless ProxyURL is set.
+	NoProxy []string
+	// CAFile is a PEM bundle of additional certificate authorities to trust, for
+	// proxies or endpoints using a private CA
+	CAFile string
+	// CertFile and KeyFile are a PEM client certificate and key presented to
+	// servers requiring mutual TLS
+	CertFile string
+	KeyFile  string
+	// PinnedCertSHA256 restricts connections to servers whose verified
+	// certificate chain contains a certificate with one of these hex-encoded
+	// SHA-256 fingerprints (for example the internal CA certificate)
+	PinnedCertSHA256 []string
+	// MinTLSVersion is the minimum TLS version: "1.2" (default) or "1.3"
+	MinTLSVersion string
+	// Timeout bounds each request. Defaults to DefaultOutboundTimeout.
+	Timeout time.Duration
+}
+
+// NewHTTPClient builds an HTTP client that applies the transport configuration
+func NewHTTPClient(config TransportConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	proxy, err := config.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	transport.Proxy = proxy
+
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = DefaultOutboundTimeout
+	}
+
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// tlsConfig builds the TLS client configuration for the transport
+func (c TransportConfig) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	switch c.MinTLSVersion {
+	case "", "1.2":
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported minimum TLS version: %q", c.MinTLSVersion)
+	}
+
+	if c.CAFile != "" {
+		pool, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, fmt.Errorf("client certificate requires both CertFile and KeyFile")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(c.PinnedCertSHA256) > 0 {
+		pins := make(map[string]bool, len(c.PinnedCertSHA256))
+		for _, pin := range c.PinnedCertSHA256 {
+			pin = strings.ToLower(strings.ReplaceAll(pin, ":", ""))
+			if decoded, err := hex.DecodeString(pin); err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("invalid certificate pin: %q", pin)
+			}
+			pins[pin] = true
+		}
+		tlsConfig.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyPinnedChain(state, pins)
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// verifyPinnedChain requires a verified chain to contain a pinned certificate
+func verifyPinnedChain(state tls.ConnectionState, pins map[string]bool) error {
+	for _, chain := range state.VerifiedChains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.Raw)
+			if pins[hex.EncodeToString(sum[:])] {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("server certificate chain does not match any pinned certificate")
+}
+
+// proxyFunc returns the proxy selection function for the configuration
+func (c TransportConfig) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	switch c.ProxyURL {
+	case "":
+		return http.ProxyFromEnvironment, nil
+	case "direct":
+		return nil, nil
+	}
+
+	proxyURL, err := url.Parse(c.ProxyURL)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL: %q", c.ProxyURL)
+	}
+
+	noProxy := c.NoProxy
+	return func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Hostname(), noProxy) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
+
+// bypassProxy reports whether host matches one of the NoProxy entries
+func bypassProxy(host string, noProxy []string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range noProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case entry == "":
+			continue
+		case entry == "*":
+			return true
+		case strings.HasPrefix(entry, "."):
+			if strings.HasSuffix(host, entry) || host == entry[1:] {
+				return true
+			}
+		case host == entry:
+			return true
+		default:
+			if _, network, err := net.ParseCIDR(entry); err == nil {
+				if ip := net.ParseIP(host); ip != nil && network.Contains(ip) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// loadCertPool returns the system certificate pool extended with the PEM file
+func loadCertPool(filename string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in CA file: %s", filename)
+	}
+	return pool, nil
+}
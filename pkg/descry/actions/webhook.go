@@ -0,0 +1,112 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WebhookHandler delivers actions as JSON POST requests to an HTTP endpoint.
+// It can be registered by name and referenced from routing configurations.
+// The URL and header values may be secret:// references, which are resolved
+// on every delivery so credentials are never held in the handler itself.
+type WebhookHandler struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+	secrets SecretsProvider
+}
+
+// WebhookPayload is the JSON body sent by WebhookHandler
+type WebhookPayload struct {
+	Type      ActionType        `json:"type"`
+	Message   string            `json:"message"`
+	Rule      string            `json:"rule"`
+	Severity  string            `json:"severity,omitempty"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+	// Details carry context attached to the action, such as goroutine leak
+	// suspects
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// NewWebhookHandler creates a handler posting to url using the transport
+// configuration. Headers are added to every request (e.g. authorization tokens).
+func NewWebhookHandler(url string, headers map[string]string, config TransportConfig) (*WebhookHandler, error) {
+	return NewWebhookHandlerWithSecrets(url, headers, config, nil)
+}
+
+// NewWebhookHandlerWithSecrets creates a webhook handler whose URL and header
+// values may reference secrets, e.g. {"Authorization": "secret://hook_token"}
+func NewWebhookHandlerWithSecrets(url string, headers map[string]string, config TransportConfig, secrets SecretsProvider) (*WebhookHandler, error) {
+	client, err := NewHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookHandler{url: url, headers: headers, client: client, secrets: secrets}, nil
+}
+
+func (h *WebhookHandler) Handle(action Action) error {
+	body, err := json.Marshal(WebhookPayload{
+		Type:      action.Type,
+		Message:   action.Message,
+		Rule:      action.RuleName,
+		Severity:  action.Severity,
+		Tags:      action.Tags,
+		Timestamp: action.Timestamp,
+		Details:   action.Details,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	target, err := ResolveSecret(h.secrets, h.url)
+	if err != nil {
+		return fmt.Errorf("webhook url: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", h.redactURL(err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range h.headers {
+		value, err := ResolveSecret(h.secrets, value)
+		if err != nil {
+			return fmt.Errorf("webhook header %s: %w", key, err)
+		}
+		req.Header.Set(key, value)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook delivery failed: %w", h.redactURL(err))
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// redactURL replaces the resolved URL in err with the configured one, so a
+// URL carrying a token (as Slack and Teams webhook URLs do) is reported by
+// its secret:// reference rather than leaked into logs. Parse errors quote the
+// offending part of the URL, so their detail is dropped too.
+func (h *WebhookHandler) redactURL(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	if urlErr.Op == "parse" {
+		return &url.Error{Op: urlErr.Op, URL: h.url, Err: errors.New("invalid URL")}
+	}
+	return &url.Error{Op: urlErr.Op, URL: h.url, Err: urlErr.Err}
+}
@@ -0,0 +1,139 @@
+package actions
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookHandlerProxy(t *testing.T) {
+	// The proxy receives absolute-form requests for the target endpoint
+	var proxied WebhookPayload
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "alerts.example.com" {
+			t.Errorf("expected request for alerts.example.com, got %q", r.URL.Host)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&proxied); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+	}))
+	defer proxy.Close()
+
+	handler, err := NewWebhookHandler("http://alerts.example.com/hook", nil, TransportConfig{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("failed to create webhook handler: %v", err)
+	}
+	if err := handler.Handle(Action{Type: AlertAction, Message: "disk full", Severity: "critical"}); err != nil {
+		t.Fatalf("webhook delivery failed: %v", err)
+	}
+	if proxied.Message != "disk full" || proxied.Severity != "critical" {
+		t.Errorf("unexpected payload: %+v", proxied)
+	}
+
+	noProxy := []string{".internal", "10.0.0.0/8", "localhost"}
+	for host, expected := range map[string]bool{
+		"hooks.internal":     true,
+		"internal":           true,
+		"10.1.2.3":           true,
+		"localhost":          true,
+		"alerts.example.com": false,
+	} {
+		if got := bypassProxy(host, noProxy); got != expected {
+			t.Errorf("bypassProxy(%q): expected %v, got %v", host, expected, got)
+		}
+	}
+
+	if _, err := NewHTTPClient(TransportConfig{CAFile: "missing.pem"}); err == nil {
+		t.Error("expected error for missing CA file")
+	}
+}
+
+// writeTestCertificate writes a self-signed certificate and key to dir
+func writeTestCertificate(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestWebhookHandlerMutualTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) == 0 {
+			t.Error("expected client certificate")
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "server.crt")
+	serverCert := server.Certificate()
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: serverCert.Raw}), 0600)
+	certFile, keyFile := writeTestCertificate(t, dir, "client")
+	pin := sha256.Sum256(serverCert.Raw)
+
+	config := TransportConfig{
+		ProxyURL:         "direct",
+		CAFile:           caFile,
+		CertFile:         certFile,
+		KeyFile:          keyFile,
+		PinnedCertSHA256: []string{hex.EncodeToString(pin[:])},
+		MinTLSVersion:    "1.3",
+	}
+	handler, err := NewWebhookHandler(server.URL, nil, config)
+	if err != nil {
+		t.Fatalf("failed to create webhook handler: %v", err)
+	}
+	if err := handler.Handle(Action{Type: AlertAction, Message: "mtls"}); err != nil {
+		t.Fatalf("mutual TLS delivery failed: %v", err)
+	}
+
+	// A mismatched pin must reject the connection
+	config.PinnedCertSHA256 = []string{strings.Repeat("00", sha256.Size)}
+	handler, err = NewWebhookHandler(server.URL, nil, config)
+	if err != nil {
+		t.Fatalf("failed to create webhook handler: %v", err)
+	}
+	if err := handler.Handle(Action{Type: AlertAction, Message: "mtls"}); err == nil {
+		t.Error("expected delivery to fail with mismatched certificate pin")
+	}
+}
@@ -0,0 +1,168 @@
+package descry
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// availabilityDays is how many days of per-rule availability are retained
+const availabilityDays = 30
+
+// AvailabilityDay summarizes a rule's condition health for one UTC day
+type AvailabilityDay struct {
+	Date         time.Time `json:"date"`
+	Evaluations  int       `json:"evaluations"`
+	Healthy      int       `json:"healthy"`
+	Availability float64   `json:"availability"` // percentage of healthy evaluations
+}
+
+// RuleAvailability is the share of evaluations in which a rule's condition
+// was healthy (not triggered), overall and per day for the last 30 days
+type RuleAvailability struct {
+	Rule         string            `json:"rule"`
+	Availability float64           `json:"availability"`
+	Days         []AvailabilityDay `json:"days"`
+}
+
+// availabilityTracker counts healthy and triggered evaluations per rule and day
+type availabilityTracker struct {
+	mutex sync.RWMutex
+	rules map[string]map[time.Time]*AvailabilityDay
+}
+
+func newAvailabilityTracker() *availabilityTracker {
+	return &availabilityTracker{rules: make(map[string]map[time.Time]*AvailabilityDay)}
+}
+
+// record counts one evaluation of a rule. Evaluations that fail are not
+// recorded, since they say nothing about the condition.
+func (t *availabilityTracker) record(rule string, healthy bool, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	date := now.UTC().Truncate(24 * time.Hour)
+	days, exists := t.rules[rule]
+	if !exists {
+		days = make(map[time.Time]*AvailabilityDay)
+		t.rules[rule] = days
+	}
+
+	day, exists := days[date]
+	if !exists {
+		day = &AvailabilityDay{Date: date}
+		days[date] = day
+
+		// Drop days that fell out of the retention window
+		cutoff := date.AddDate(0, 0, -availabilityDays+1)
+		for d := range days {
+			if d.Before(cutoff) {
+				delete(days, d)
+			}
+		}
+	}
+
+	day.Evaluations++
+	if healthy {
+		day.Healthy++
+	}
+	day.Availability = 100 * float64(day.Healthy) / float64(day.Evaluations)
+}
+
+// get returns the availability of a rule, oldest day first
+func (t *availabilityTracker) get(rule string) (RuleAvailability, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	days, exists := t.rules[rule]
+	if !exists {
+		return RuleAvailability{}, false
+	}
+
+	result := RuleAvailability{Rule: rule, Availability: 100, Days: make([]AvailabilityDay, 0, len(days))}
+	var evaluations, healthy int
+	for _, day := range days {
+		result.Days = append(result.Days, *day)
+		evaluations += day.Evaluations
+		healthy += day.Healthy
+	}
+	sort.Slice(result.Days, func(i, j int) bool {
+		return result.Days[i].Date.Before(result.Days[j].Date)
+	})
+	if evaluations > 0 {
+		result.Availability = 100 * float64(healthy) / float64(evaluations)
+	}
+	return result, true
+}
+
+// restore adds the evaluations counted in a saved availability history to
+// the rule's current counts
+func (t *availabilityTracker) restore(saved RuleAvailability, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	days, exists := t.rules[saved.Rule]
+	if !exists {
+		days = make(map[time.Time]*AvailabilityDay)
+		t.rules[saved.Rule] = days
+	}
+	cutoff := now.UTC().Truncate(24*time.Hour).AddDate(0, 0, -availabilityDays+1)
+	for _, savedDay := range saved.Days {
+		date := savedDay.Date.UTC().Truncate(24 * time.Hour)
+		if date.Before(cutoff) || savedDay.Evaluations <= 0 {
+			continue
+		}
+		day, exists := days[date]
+		if !exists {
+			day = &AvailabilityDay{Date: date}
+			days[date] = day
+		}
+		day.Evaluations += savedDay.Evaluations
+		day.Healthy += savedDay.Healthy
+		day.Availability = 100 * float64(day.Healthy) / float64(day.Evaluations)
+	}
+}
+
+// remove forgets one rule's availability history
+func (t *availabilityTracker) remove(rule string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.rules, rule)
+}
+
+// clear forgets every rule's availability history
+func (t *availabilityTracker) clear() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.rules = make(map[string]map[time.Time]*AvailabilityDay)
+}
+
+// GetUptime returns how long the engine has been running since it was last
+// started, or zero while it is stopped
+func (e *Engine) GetUptime() time.Duration {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	if !e.running {
+		return 0
+	}
+	return e.clock.Now().Sub(e.startTime)
+}
+
+// GetRuleAvailability returns the percentage of evaluations over the last 30
+// days in which the rule's condition was healthy, with a per-day breakdown
+func (e *Engine) GetRuleAvailability(name string) (RuleAvailability, bool) {
+	return e.availability.get(name)
+}
+
+// GetAvailability returns the availability of every rule, ordered by rule name
+func (e *Engine) GetAvailability() []RuleAvailability {
+	rules := e.GetRules()
+	result := make([]RuleAvailability, 0, len(rules))
+	for _, rule := range rules {
+		if availability, ok := e.availability.get(rule.Name); ok {
+			result = append(result, availability)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Rule < result[j].Rule })
+	return result
+}
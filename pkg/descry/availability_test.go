@@ -0,0 +1,60 @@
+package descry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAvailabilityTracker(t *testing.T) {
+	tracker := newAvailabilityTracker()
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	tracker.record("old", false, now.AddDate(0, 0, -40))
+	tracker.record("old", true, now)
+	for i := 0; i < 3; i++ {
+		tracker.record("old", true, now)
+	}
+	tracker.record("old", false, now)
+
+	availability, ok := tracker.get("old")
+	if !ok {
+		t.Fatal("expected availability for rule")
+	}
+	if len(availability.Days) != 1 {
+		t.Errorf("expected days older than 30 days to be dropped, got %+v", availability.Days)
+	}
+	if availability.Availability != 80 || availability.Days[0].Healthy != 4 {
+		t.Errorf("expected 80%% availability, got %+v", availability)
+	}
+}
+
+func TestEngineAvailability(t *testing.T) {
+	engine := NewEngineWithPort(getAvailablePort())
+
+	if err := engine.AddRule("always", `when heap.alloc > 0 { log("triggered") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	if err := engine.AddRule("never", `when heap.alloc < 0 { log("never") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+
+	engine.EvaluateRules()
+	engine.EvaluateRules()
+
+	always, ok := engine.GetRuleAvailability("always")
+	if !ok || always.Availability != 0 || always.Days[0].Evaluations != 2 {
+		t.Errorf("expected triggered rule to be 0%% available over 2 evaluations, got %+v", always)
+	}
+	never, ok := engine.GetRuleAvailability("never")
+	if !ok || never.Availability != 100 {
+		t.Errorf("expected healthy rule to be 100%% available, got %+v", never)
+	}
+
+	if engine.GetUptime() != 0 {
+		t.Error("expected zero uptime before the engine is started")
+	}
+	result := evalSource(t, engine, `uptime.seconds >= 0`)
+	if result != TRUE {
+		t.Errorf("expected uptime.seconds to be readable, got %s", result.Inspect())
+	}
+}
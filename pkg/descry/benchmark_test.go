@@ -1,6 +1,7 @@
 package descry
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"sync"
@@ -43,7 +44,7 @@ func BenchmarkRuleEvaluation(b *testing.B) {
 		b.Fatal(err)
 	}
 	
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	b.ResetTimer()
@@ -72,7 +73,7 @@ func BenchmarkMultipleRuleEvaluation(b *testing.B) {
 		}
 	}
 	
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	b.ResetTimer()
@@ -91,7 +92,7 @@ func BenchmarkConcurrentRuleEvaluation(b *testing.B) {
 		b.Fatal(err)
 	}
 	
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	b.ResetTimer()
@@ -130,7 +131,7 @@ func BenchmarkMemoryUsage(b *testing.B) {
 		}
 	}
 	
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	// Collect baseline memory
@@ -181,7 +182,7 @@ func BenchmarkHighThroughput(b *testing.B) {
 		}
 	}
 	
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	// Simulate concurrent metric updates
@@ -243,7 +244,7 @@ func BenchmarkRuleComplexity(b *testing.B) {
 				b.Fatal(err)
 			}
 			
-			engine.Start()
+			engine.Start(context.Background())
 			defer engine.Stop()
 			
 			// Pre-populate some metric history for aggregations
@@ -259,4 +260,58 @@ func BenchmarkRuleComplexity(b *testing.B) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+// BenchmarkEvaluate100Rules measures one evaluation cycle of 100 rules, the
+// default rule limit, so ns/op is the pipeline's cost per 100 rules
+func BenchmarkEvaluate100Rules(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, EvaluationWorkers: workers})
+			for i := 0; i < 100; i++ {
+				rule := fmt.Sprintf(`when heap.alloc > %dGB && goroutines.count > 0 { alert("rule %d") }`, 100+i, i)
+				if err := engine.AddRule(fmt.Sprintf("rule_%d", i), rule); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				engine.EvaluateRules()
+			}
+		})
+	}
+}
+
+// BenchmarkCustomMetricUpdates measures concurrent updates of 100 custom
+// metrics, one call per metric and in one batch; ns/op is per 100 updates
+func BenchmarkCustomMetricUpdates(b *testing.B) {
+	names := make([]string, 100)
+	batch := make(map[string]float64, len(names))
+	for i := range names {
+		names[i] = fmt.Sprintf("metric_%d", i)
+		batch[names[i]] = float64(i)
+	}
+
+	b.Run("single", func(b *testing.B) {
+		engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true})
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				for i, name := range names {
+					engine.UpdateCustomMetric(name, float64(i))
+				}
+			}
+		})
+	})
+	b.Run("batch", func(b *testing.B) {
+		engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true})
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				engine.UpdateCustomMetrics(batch)
+			}
+		})
+	})
+}
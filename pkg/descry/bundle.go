@@ -0,0 +1,407 @@
+package descry
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+// RuleBundleVersion is the version of the rule bundle format written by
+// ExportRuleBundle
+const RuleBundleVersion = 1
+
+// bundleManifest is the name of the manifest in tar bundles
+const bundleManifest = "bundle.json"
+
+// RuleBundle is a portable copy of an engine's rules, with their metadata,
+// enabled and dry-run state, rule group defaults and alert routes, for
+// migrating rules between environments or sharing rule packs. A bundle is
+// written as JSON with WriteJSON or as a gzipped tar of .dscr files with
+// WriteTar, and read in either format with ReadRuleBundle.
+//
+// Rules generated from route SLAs are not included; they are regenerated from
+// the SLA configuration.
+type RuleBundle struct {
+	Version    int          `json:"version"`
+	ExportedAt time.Time    `json:"exported_at"`
+	Rules      []BundleRule `json:"rules"`
+	Groups     []RuleGroup  `json:"groups,omitempty"`
+	// Routing is the alert routing configuration, if one is set. Importing
+	// it requires the handlers it names to be registered.
+	Routing *actions.RoutingConfig `json:"routing,omitempty"`
+}
+
+// BundleRule is one rule in a bundle
+type BundleRule struct {
+	Name string `json:"name"`
+	// Source defines the rule on its own, including any top-level constants
+	// and bindings it shared with the rules it was loaded with. Import
+	// statements in a rule's own source are resolved on the importing engine.
+	Source string `json:"source,omitempty"`
+	// File holds the source in tar bundles, relative to the bundle root
+	File string `json:"file,omitempty"`
+	// Description, Severity, Tags and Group describe the rule for readers of
+	// the bundle; the source is authoritative
+	Description string   `json:"description,omitempty"`
+	Severity    string   `json:"severity,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Group       string   `json:"group,omitempty"`
+	Disabled    bool     `json:"disabled,omitempty"`
+	DryRun      bool     `json:"dry_run,omitempty"`
+	// Labels are the rule's labels, including any set with
+	// AddRuleWithOptions. On import they replace labels of the same name
+	// declared in the source.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// RuleBundleImportOptions controls ImportRuleBundle
+type RuleBundleImportOptions struct {
+	// DryRun validates the bundle and reports the changes an import would
+	// make without making them
+	DryRun bool
+	// Replace removes the rules that are not in the bundle, except those
+	// generated from route SLAs. Otherwise they are kept.
+	Replace bool
+}
+
+// RuleBundleDiff lists the changes an import made, or would make
+type RuleBundleDiff struct {
+	DryRun    bool     `json:"dry_run"`
+	Added     []string `json:"added"`
+	Changed   []string `json:"changed"`
+	Unchanged []string `json:"unchanged"`
+	Removed   []string `json:"removed"`
+	// Groups names the groups whose defaults are set
+	Groups []string `json:"groups"`
+	// Routing reports whether the routing configuration is replaced
+	Routing bool `json:"routing"`
+}
+
+// ExportRuleBundle returns a bundle of the engine's rules, rule group
+// defaults and routing configuration
+func (e *Engine) ExportRuleBundle() *RuleBundle {
+	bundle := &RuleBundle{
+		Version:    RuleBundleVersion,
+		ExportedAt: e.clock.Now().UTC(),
+		Rules:      []BundleRule{},
+		Routing:    e.GetRoutingConfig(),
+	}
+
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	for _, rule := range e.rules {
+		if e.slaRules[rule.Name] {
+			continue
+		}
+		bundle.Rules = append(bundle.Rules, BundleRule{
+			Name:        rule.Name,
+			Source:      bundleSource(rule),
+			Description: rule.Description,
+			Severity:    rule.Severity,
+			Tags:        rule.Tags,
+			Group:       rule.Group,
+			Disabled:    rule.Disabled,
+			DryRun:      rule.DryRun,
+			Labels:      rule.Labels,
+		})
+	}
+	for _, group := range e.groups {
+		bundle.Groups = append(bundle.Groups, group)
+	}
+	sort.Slice(bundle.Groups, func(i, j int) bool { return bundle.Groups[i].Name < bundle.Groups[j].Name })
+	return bundle
+}
+
+// bundleSource returns source that defines the rule on its own, with the
+// shared definitions it was split from
+func bundleSource(rule *Rule) string {
+	if rule.definitions == "" {
+		return rule.Source
+	}
+	return rule.definitions + "\n\n" + rule.Source
+}
+
+// ImportRuleBundle adds the rules in a bundle and replaces those with the
+// same names, sets its rule group defaults and installs its routing
+// configuration. Every rule, group and route is validated first; if any is
+// invalid nothing changes. Imported rules take their enabled and dry-run
+// state from the bundle and keep their trigger history if they existed.
+func (e *Engine) ImportRuleBundle(bundle *RuleBundle, options RuleBundleImportOptions) (*RuleBundleDiff, error) {
+	if bundle == nil {
+		return nil, fmt.Errorf("rule bundle is required")
+	}
+
+	rules := make([]*Rule, 0, len(bundle.Rules))
+	names := make(map[string]bool, len(bundle.Rules))
+	for _, imported := range bundle.Rules {
+		if imported.Name == "" {
+			return nil, fmt.Errorf("rule bundle contains a rule without a name")
+		}
+		if names[imported.Name] {
+			return nil, fmt.Errorf("rule bundle contains rule %s more than once", imported.Name)
+		}
+		names[imported.Name] = true
+
+		compiled, err := e.compileRules(imported.Name, imported.Source, "")
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", imported.Name, err)
+		}
+		if len(compiled) != 1 || compiled[0].Name != imported.Name {
+			return nil, fmt.Errorf("source for rule %s must define exactly that rule", imported.Name)
+		}
+		if err := validateLabels(imported.Labels); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", imported.Name, err)
+		}
+		compiled[0].Labels = mergeLabels(compiled[0].Labels, imported.Labels)
+		rules = append(rules, compiled[0])
+	}
+
+	groups := make([]RuleGroup, len(bundle.Groups))
+	for i, group := range bundle.Groups {
+		normalized, err := normalizeRuleGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		groups[i] = normalized
+	}
+	if bundle.Routing != nil {
+		if err := e.actionRegistry.ValidateRouting(bundle.Routing); err != nil {
+			return nil, err
+		}
+	}
+
+	e.mutex.Lock()
+	diff, err := e.importRulesLocked(bundle, rules, groups, options)
+	e.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	diff.Routing = bundle.Routing != nil
+	if diff.Routing && !options.DryRun {
+		if err := e.SetRoutingConfig(bundle.Routing); err != nil {
+			return nil, fmt.Errorf("rules imported but routing was not: %w", err)
+		}
+	}
+	return diff, nil
+}
+
+// importRulesLocked compares compiled bundle rules with the engine's and, unless
+// this is a dry run, installs them and the bundle's groups. The caller must
+// hold e.mutex.
+func (e *Engine) importRulesLocked(bundle *RuleBundle, rules []*Rule, groups []RuleGroup, options RuleBundleImportOptions) (*RuleBundleDiff, error) {
+	diff := &RuleBundleDiff{
+		DryRun:    options.DryRun,
+		Added:     []string{},
+		Changed:   []string{},
+		Unchanged: []string{},
+		Removed:   []string{},
+		Groups:    []string{},
+	}
+
+	existing := make(map[string]*Rule, len(e.rules))
+	for _, rule := range e.rules {
+		existing[rule.Name] = rule
+	}
+	imported := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		imported[rule.Name] = true
+		old, ok := existing[rule.Name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, rule.Name)
+		case e.slaRules[rule.Name]:
+			return nil, fmt.Errorf("rule %s is generated from a route SLA and cannot be imported", rule.Name)
+		case bundleSource(old) != bundleSource(rule) || old.Disabled != bundle.Rules[i].Disabled || old.DryRun != bundle.Rules[i].DryRun ||
+			!equalLabels(old.Labels, rule.Labels):
+			diff.Changed = append(diff.Changed, rule.Name)
+		default:
+			diff.Unchanged = append(diff.Unchanged, rule.Name)
+		}
+	}
+
+	owned := func(rule *Rule) bool {
+		return imported[rule.Name] || (options.Replace && !e.slaRules[rule.Name])
+	}
+	kept := 0
+	for _, rule := range e.rules {
+		if !owned(rule) {
+			kept++
+		} else if !imported[rule.Name] {
+			diff.Removed = append(diff.Removed, rule.Name)
+		}
+	}
+	if kept+len(rules) > e.limits.MaxRules {
+		return nil, &LimitError{Kind: LimitRules, Limit: e.limits.MaxRules}
+	}
+	for _, group := range groups {
+		diff.Groups = append(diff.Groups, group.Name)
+	}
+	if options.DryRun {
+		return diff, nil
+	}
+
+	if _, err := e.replaceRulesLocked(owned, rules); err != nil {
+		return nil, err
+	}
+	// The bundle's state takes precedence over what replaceRulesLocked kept
+	for i, rule := range rules {
+		rule.Disabled = bundle.Rules[i].Disabled
+		rule.DryRun = bundle.Rules[i].DryRun
+	}
+	if len(groups) > 0 {
+		updated := make(map[string]RuleGroup, len(e.groups)+len(groups))
+		for name, group := range e.groups {
+			updated[name] = group
+		}
+		for _, group := range groups {
+			updated[group.Name] = group
+		}
+		e.groups = updated
+	}
+	return diff, nil
+}
+
+// WriteJSON writes the bundle as indented JSON
+func (b *RuleBundle) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(b)
+}
+
+// WriteTar writes the bundle as a gzipped tar holding a bundle.json manifest
+// and each rule's source in rules/NNN-name.dscr, so rule packs can be read
+// and edited as ordinary rule files
+func (b *RuleBundle) WriteTar(w io.Writer) error {
+	manifest := *b
+	manifest.Rules = make([]BundleRule, len(b.Rules))
+	for i, rule := range b.Rules {
+		rule.File = fmt.Sprintf("rules/%03d-%s.dscr", i+1, bundleFileName(rule.Name))
+		rule.Source = ""
+		manifest.Rules[i] = rule
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	write := func(name string, content []byte) error {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), ModTime: b.ExportedAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+	if err := write(bundleManifest, append(data, '\n')); err != nil {
+		return err
+	}
+	for i, rule := range b.Rules {
+		if err := write(manifest.Rules[i].File, []byte(rule.Source+"\n")); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// bundleFileName makes a rule name safe to use in a file name
+func bundleFileName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '.' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// ReadRuleBundle reads a bundle written by WriteJSON or WriteTar
+func ReadRuleBundle(r io.Reader) (*RuleBundle, error) {
+	reader := bufio.NewReader(r)
+	var bundle *RuleBundle
+	var err error
+	if magic, _ := reader.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		bundle, err = readTarBundle(reader)
+	} else {
+		bundle = &RuleBundle{}
+		if decodeErr := json.NewDecoder(reader).Decode(bundle); decodeErr != nil {
+			err = fmt.Errorf("invalid rule bundle: %w", decodeErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bundle.Version == 0:
+		return nil, fmt.Errorf("invalid rule bundle: missing version")
+	case bundle.Version > RuleBundleVersion:
+		return nil, fmt.Errorf("unsupported rule bundle version %d", bundle.Version)
+	}
+	return bundle, nil
+}
+
+// readTarBundle reads a gzipped tar bundle, filling in each rule's source
+// from its file
+func readTarBundle(r io.Reader) (*RuleBundle, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule bundle: %w", err)
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule bundle: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule bundle: %w", err)
+		}
+		files[path.Clean(header.Name)] = content
+	}
+
+	data, ok := files[bundleManifest]
+	if !ok {
+		return nil, fmt.Errorf("invalid rule bundle: missing %s", bundleManifest)
+	}
+	bundle := &RuleBundle{}
+	if err := json.Unmarshal(data, bundle); err != nil {
+		return nil, fmt.Errorf("invalid rule bundle: %w", err)
+	}
+	for i, rule := range bundle.Rules {
+		if rule.File == "" {
+			continue
+		}
+		content, ok := files[path.Clean(rule.File)]
+		if !ok {
+			return nil, fmt.Errorf("invalid rule bundle: missing %s for rule %s", rule.File, rule.Name)
+		}
+		bundle.Rules[i].Source = strings.TrimSuffix(string(content), "\n")
+	}
+	return bundle, nil
+}
@@ -0,0 +1,131 @@
+package descry
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+type nopHandler struct{}
+
+func (nopHandler) Handle(actions.Action) error { return nil }
+
+func TestRuleBundle(t *testing.T) {
+	newEngine := func() *Engine {
+		engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+		engine.RegisterActionHandler("pager", nopHandler{})
+		return engine
+	}
+
+	source := `const LIMIT = 100MB;
+let label = "heap";
+
+rule "memory" {
+  severity: high
+  group: "runtime"
+  when heap.alloc > LIMIT { alert("${label} high") }
+}
+rule "goroutines" {
+  group: "runtime"
+  when goroutines.count > 1000 && avg("heap.alloc", 60) < LIMIT { log("many goroutines") }
+}`
+	source2 := `when http.error_rate > 0.1 { alert("errors") }`
+
+	production := newEngine()
+	if _, err := production.AddRules("runtime", source); err != nil {
+		t.Fatal(err)
+	}
+	if err := production.AddRule("errors", source2); err != nil {
+		t.Fatal(err)
+	}
+	production.SetRuleEnabled("goroutines", false)
+	production.SetRuleGroup(RuleGroup{Name: "runtime", Severity: "critical", Cooldown: time.Minute})
+	routing := &actions.RoutingConfig{Routes: []actions.Route{{Match: actions.RouteMatch{Severity: []string{"high"}}, Handlers: []string{"pager"}}}}
+	if err := production.SetRoutingConfig(routing); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := production.ExportRuleBundle()
+	if len(bundle.Rules) != 3 || len(bundle.Groups) != 1 || bundle.Routing == nil {
+		t.Fatalf("unexpected bundle: %+v", bundle)
+	}
+	// Rules split out of a file carry the definitions they share
+	if memory := bundle.Rules[0]; !strings.Contains(memory.Source, "LIMIT") || !strings.Contains(memory.Source, "label") || memory.Severity != "high" {
+		t.Errorf("expected a self-contained source, got %q", memory.Source)
+	}
+
+	// Both formats round-trip
+	for _, write := range []func(io.Writer) error{bundle.WriteJSON, bundle.WriteTar} {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		read, err := ReadRuleBundle(&buf)
+		if err != nil {
+			t.Fatalf("failed to read bundle: %v", err)
+		}
+		if len(read.Rules) != 3 || read.Rules[0].Source != bundle.Rules[0].Source || !read.Rules[1].Disabled {
+			t.Errorf("bundle did not round-trip: %+v", read.Rules)
+		}
+	}
+
+	staging := newEngine()
+	if err := staging.AddRule("errors", `when http.error_rate > 0.5 { alert("errors") }`); err != nil {
+		t.Fatal(err)
+	}
+	if err := staging.AddRule("local", `when 1 > 2 { log("local") }`); err != nil {
+		t.Fatal(err)
+	}
+
+	diff, err := staging.ImportRuleBundle(bundle, RuleBundleImportOptions{DryRun: true, Replace: true})
+	if err != nil {
+		t.Fatalf("dry run failed: %v", err)
+	}
+	if strings.Join(diff.Added, ",") != "memory,goroutines" || strings.Join(diff.Changed, ",") != "errors" ||
+		strings.Join(diff.Removed, ",") != "local" || !diff.Routing {
+		t.Errorf("unexpected diff: %+v", diff)
+	}
+	if len(staging.GetRules()) != 2 || staging.GetRoutingConfig() != nil {
+		t.Fatal("expected a dry run to change nothing")
+	}
+
+	if _, err := staging.ImportRuleBundle(bundle, RuleBundleImportOptions{}); err != nil {
+		t.Fatalf("import failed: %v", err)
+	}
+	if len(staging.GetRules()) != 4 || staging.GetRoutingConfig() == nil || staging.ruleSeverity("goroutines") != "critical" {
+		t.Errorf("unexpected rules after import: %d rules, severity %q", len(staging.GetRules()), staging.ruleSeverity("goroutines"))
+	}
+	if rule, _ := staging.GetRule("goroutines"); rule.Enabled() {
+		t.Error("expected the bundle's disabled state to be imported")
+	}
+	if rule, _ := staging.GetRule("errors"); rule.Source != source2 {
+		t.Errorf("expected the existing rule to be replaced, got %q", rule.Source)
+	}
+
+	// Re-importing reports no changes
+	diff, _ = staging.ImportRuleBundle(bundle, RuleBundleImportOptions{DryRun: true})
+	if len(diff.Unchanged) != 3 || len(diff.Added)+len(diff.Changed)+len(diff.Removed) != 0 {
+		t.Errorf("expected an unchanged import, got %+v", diff)
+	}
+
+	// An invalid rule rejects the whole bundle
+	broken := *bundle
+	broken.Rules = append([]BundleRule{{Name: "new", Source: `when { }`}}, bundle.Rules...)
+	if _, err := newEngine().ImportRuleBundle(&broken, RuleBundleImportOptions{}); err == nil {
+		t.Error("expected an error for an invalid rule")
+	}
+	unrouted := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if _, err := unrouted.ImportRuleBundle(bundle, RuleBundleImportOptions{}); err == nil || len(unrouted.GetRules()) != 0 {
+		t.Error("expected routes to unknown handlers to reject the bundle")
+	}
+	for _, data := range []string{`{"rules": []}`, `{"version": 99}`, "not a bundle"} {
+		if _, err := ReadRuleBundle(strings.NewReader(data)); err == nil {
+			t.Errorf("expected error reading %s", data)
+		}
+	}
+}
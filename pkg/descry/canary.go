@@ -0,0 +1,140 @@
+package descry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Labeled series are values of a metric for one instance of a service, such
+// as http.error_rate for service=canary, reported by the application through
+// UpdateLabeledMetric. canary() compares two of them. They are stored under
+// keys like http.error_rate{service=canary}, with labels sorted by name.
+
+// UpdateLabeledMetric records the value of metric for the series selected by
+// labels, such as the error rate a canary deployment reports:
+//
+//	engine.UpdateLabeledMetric("http.error_rate", map[string]string{"service": "canary"}, 2.5)
+//
+// Rules compare series with canary(). metric is a metric path as used in
+// rules, and at least one label is required. Each series counts toward the
+// MaxCustomMetrics resource limit, separately from custom metrics.
+func (e *Engine) UpdateLabeledMetric(metric string, labels map[string]string, value float64) error {
+	key, err := seriesKey(metric, labels)
+	if err != nil {
+		return err
+	}
+	return e.labeledMetrics.set(key, value, e.clock.Now(), e.limits.MaxCustomMetrics)
+}
+
+// GetLabeledMetric returns the latest value of a labeled series, and false if
+// none was recorded
+func (e *Engine) GetLabeledMetric(metric string, labels map[string]string) (float64, bool) {
+	key, err := seriesKey(metric, labels)
+	if err != nil {
+		return 0, false
+	}
+	return e.labeledMetrics.get(key)
+}
+
+// seriesKey returns the key a labeled series is stored under
+func seriesKey(metric string, labels map[string]string) (string, error) {
+	if _, _, ok := splitMetricPath(metric); !ok {
+		return "", fmt.Errorf("invalid metric path %q: must be category.metric", metric)
+	}
+	if len(labels) == 0 {
+		return "", fmt.Errorf("labeled metric %s needs at least one label", metric)
+	}
+	if err := validateLabels(labels); err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(labels))
+	for name, value := range labels {
+		if value == "" || strings.ContainsAny(value, "{},=\"") {
+			return "", fmt.Errorf("invalid value %q for label %s", value, name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + labels[name]
+	}
+	return metric + "{" + strings.Join(pairs, ",") + "}", nil
+}
+
+// parseSeriesSelector parses a selector such as "service=canary" or
+// "service=checkout,track=canary" into labels
+func parseSeriesSelector(selector string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(selector, ",") {
+		name, value, ok := strings.Cut(pair, "=")
+		name, value = strings.TrimSpace(name), strings.Trim(strings.TrimSpace(value), `"`)
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("invalid series selector %q: expected label=value pairs", selector)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// seriesValue returns the latest value of metric for the series selected by
+// labels. For HTTP metrics, server=<name> selects the middleware created with
+// HTTPMiddlewareNamed(name) unless a labeled series was reported for it.
+func (e *Evaluator) seriesValue(metric string, labels map[string]string) (float64, error) {
+	key, err := seriesKey(metric, labels)
+	if err != nil {
+		return 0, err
+	}
+	if value, exists := e.engine.labeledMetrics.get(key); exists {
+		return value, nil
+	}
+	category, name, _ := splitMetricPath(metric)
+	if server, ok := labels["server"]; ok && len(labels) == 1 && category == "http" {
+		if named := e.engine.httpServer(server, false); named != nil {
+			value := namedHTTPMetricValue(server, named, name)
+			if isError(value) {
+				return 0, fmt.Errorf("%s", value.(*Error).Message)
+			}
+			return e.objectToFloat(value), nil
+		}
+	}
+	return 0, fmt.Errorf("no series %s", key)
+}
+
+// handleCanary evaluates canary(metric, canary, baseline): the difference
+// between the canary's and the baseline's latest values as a percentage of
+// the baseline's. A zero baseline has no scale, so a canary above it reads as
+// 100% higher and one equal to it as 0.
+func (e *Evaluator) handleCanary(metricObj, canaryObj, baselineObj Object) Object {
+	metric, ok := e.extractMetricPath(metricObj)
+	if !ok {
+		return newError("first argument to canary() must be a metric path string")
+	}
+	var values [2]float64
+	for i, selectorObj := range []Object{canaryObj, baselineObj} {
+		selector, ok := selectorObj.(*String)
+		if !ok {
+			return newError("%s argument to canary() must be a series selector such as \"service=canary\"", argumentOrdinals[i+1])
+		}
+		labels, err := parseSeriesSelector(selector.Value)
+		if err != nil {
+			return newError("%s", err.Error())
+		}
+		if values[i], err = e.seriesValue(metric, labels); err != nil {
+			return newError("canary(): %s", err.Error())
+		}
+	}
+
+	canary, baseline := values[0], values[1]
+	switch {
+	case baseline != 0:
+		return &Float{Value: (canary - baseline) / baseline * 100}
+	case canary > 0:
+		return &Float{Value: 100}
+	case canary < 0:
+		return &Float{Value: -100}
+	default:
+		return &Float{Value: 0}
+	}
+}
@@ -0,0 +1,78 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCanary(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	report := func(service string, errorRate, latency float64) {
+		t.Helper()
+		labels := map[string]string{"service": service}
+		if err := engine.UpdateLabeledMetric("http.error_rate", labels, errorRate); err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.UpdateLabeledMetric("http.p99_response_time", labels, latency); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report("canary", 3, 180)
+	report("baseline", 2, 200)
+	if err := engine.UpdateLabeledMetric("custom.orders", map[string]string{"service": "canary"}, 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.UpdateLabeledMetric("custom.orders", map[string]string{"service": "baseline"}, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Named HTTP middleware are series selected by server=<name>
+	canaryServer := engine.HTTPMiddlewareNamed("canary")(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	baselineServer := engine.HTTPMiddlewareNamed("baseline")(func(w http.ResponseWriter, r *http.Request) {})
+	for i := 0; i < 2; i++ {
+		canaryServer(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		baselineServer(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		{`canary("http.error_rate", "service=canary", "service=baseline")`, 50},
+		{`canary("http.p99_response_time", "service=canary", "service=baseline")`, -10},
+		{`canary("http.error_rate", "service=baseline", "service=baseline")`, 0},
+		{`canary("custom.orders", "service=canary", "service=baseline")`, 100},
+		{`canary("http.request_count", "server=canary", "server=baseline")`, 0},
+	}
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if isError(result) {
+			t.Errorf("%s: unexpected error: %s", tt.source, result.Inspect())
+			continue
+		}
+		if value := engine.evaluator.objectToFloat(result); value != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.source, tt.expected, value)
+		}
+	}
+	if result := evalSource(t, engine, `canary("http.error_rate", "server=canary", "server=baseline") > 50%`); result != TRUE {
+		t.Errorf("expected the failing canary server to differ, got %s", result.Inspect())
+	}
+	if result := evalSource(t, engine, `canary("http.error_rate", "service=missing", "service=baseline")`); !isError(result) {
+		t.Errorf("expected an error for a missing series, got %s", result.Inspect())
+	}
+
+	if snapshot := engine.SnapshotMetrics(); snapshot["http.error_rate{service=canary}"] != 3 {
+		t.Errorf("expected labeled series in the snapshot, got %v", snapshot)
+	}
+	if err := engine.UpdateLabeledMetric("http.error_rate", nil, 1); err == nil {
+		t.Error("expected a series without labels to be rejected")
+	}
+	if err := engine.AddRule("bad", `when canary("http.error_rate", "canary", "service=baseline") > 10 { log("x") }`); err == nil {
+		t.Error("expected an invalid selector to be rejected")
+	}
+}
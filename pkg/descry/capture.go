@@ -0,0 +1,216 @@
+package descry
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// CaptureVersion is the capture format written by CaptureWriter
+const CaptureVersion = 1
+
+// CaptureHeader is the first line of a capture
+type CaptureHeader struct {
+	Version int `json:"version"`
+	// Source describes where the metrics were recorded, e.g. a dashboard URL
+	Source string `json:"source,omitempty"`
+	// Interval is the sampling interval, marshalled as nanoseconds
+	Interval time.Duration `json:"interval"`
+}
+
+// CaptureFrame is one sample of every metric available to rules, keyed by
+// DSL name and in DSL units as returned by SnapshotMetrics
+type CaptureFrame struct {
+	Timestamp time.Time          `json:"timestamp"`
+	Metrics   map[string]float64 `json:"metrics"`
+	// RuleStates holds whether each rule's condition held at its latest
+	// evaluation in the recording engine, for checking replayed results
+	RuleStates map[string]bool `json:"rule_states,omitempty"`
+}
+
+// Capture is a recording of a production engine's metric stream, replayed
+// against rules elsewhere with ReplayCapture. descryctl record writes
+// captures by polling a dashboard's /api/capture endpoint.
+//
+// A capture file (conventionally *.dscrpack) is a gzip stream of JSON lines:
+// a CaptureHeader followed by one CaptureFrame per sample. Every frame is
+// flushed as it is written, so a recording that is cut short still replays
+// up to its last complete frame.
+type Capture struct {
+	CaptureHeader
+	// Frames are ordered by timestamp
+	Frames []CaptureFrame
+}
+
+// CaptureWriter writes a capture file frame by frame
+type CaptureWriter struct {
+	gzip    *gzip.Writer
+	encoder *json.Encoder
+}
+
+// NewCaptureWriter starts a capture on w by writing its header
+func NewCaptureWriter(w io.Writer, source string, interval time.Duration) (*CaptureWriter, error) {
+	zw := gzip.NewWriter(w)
+	cw := &CaptureWriter{gzip: zw, encoder: json.NewEncoder(zw)}
+	if err := cw.write(CaptureHeader{Version: CaptureVersion, Source: source, Interval: interval}); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// WriteFrame appends a frame to the capture
+func (w *CaptureWriter) WriteFrame(frame CaptureFrame) error {
+	return w.write(frame)
+}
+
+// write encodes one line and flushes it to the underlying writer
+func (w *CaptureWriter) write(line interface{}) error {
+	if err := w.encoder.Encode(line); err != nil {
+		return fmt.Errorf("failed to write capture: %w", err)
+	}
+	if err := w.gzip.Flush(); err != nil {
+		return fmt.Errorf("failed to write capture: %w", err)
+	}
+	return nil
+}
+
+// Close ends the capture. It does not close the underlying writer.
+func (w *CaptureWriter) Close() error {
+	return w.gzip.Close()
+}
+
+// ReadCapture decodes a capture. A capture whose recording was cut short is
+// read up to its last complete frame.
+func ReadCapture(r io.Reader) (*Capture, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid capture: %w", err)
+	}
+	defer zr.Close()
+
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(nil, 16<<20)
+	if !scanner.Scan() {
+		return nil, fmt.Errorf("invalid capture: missing header")
+	}
+	capture := &Capture{}
+	if err := json.Unmarshal(scanner.Bytes(), &capture.CaptureHeader); err != nil {
+		return nil, fmt.Errorf("invalid capture header: %w", err)
+	}
+	if capture.Version != CaptureVersion {
+		return nil, fmt.Errorf("unsupported capture version %d", capture.Version)
+	}
+
+	for scanner.Scan() {
+		var frame CaptureFrame
+		if err := json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			// A truncated final line is what an interrupted recording leaves
+			break
+		}
+		capture.Frames = append(capture.Frames, frame)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("failed to read capture: %w", err)
+	}
+
+	sort.SliceStable(capture.Frames, func(i, j int) bool {
+		return capture.Frames[i].Timestamp.Before(capture.Frames[j].Timestamp)
+	})
+	return capture, nil
+}
+
+// capturedMetrics supplies recorded metric values to an evaluator replaying
+// a capture
+type capturedMetrics struct {
+	frames []CaptureFrame
+}
+
+// value returns a metric's value in the latest frame at or before at
+func (m *capturedMetrics) value(path string, at time.Time) (float64, bool) {
+	n := sort.Search(len(m.frames), func(i int) bool { return m.frames[i].Timestamp.After(at) })
+	if n == 0 {
+		return 0, false
+	}
+	value, ok := m.frames[n-1].Metrics[path]
+	return value, ok
+}
+
+// ruleState returns whether a rule's condition held in the recording engine
+// as of the latest frame at or before at
+func (m *capturedMetrics) ruleState(rule string, at time.Time) (bool, bool) {
+	n := sort.Search(len(m.frames), func(i int) bool { return m.frames[i].Timestamp.After(at) })
+	if n == 0 {
+		return false, false
+	}
+	firing, ok := m.frames[n-1].RuleStates[rule]
+	return firing, ok
+}
+
+// history returns a metric's values in the frames within duration before at,
+// oldest first
+func (m *capturedMetrics) history(path string, at time.Time, duration time.Duration) ([]timedValue, bool) {
+	if _, ok := m.value(path, at); !ok {
+		return nil, false
+	}
+	since := at.Add(-duration)
+	first := sort.Search(len(m.frames), func(i int) bool { return !m.frames[i].Timestamp.Before(since) })
+
+	var values []timedValue
+	for _, frame := range m.frames[first:] {
+		if frame.Timestamp.After(at) {
+			break
+		}
+		if value, ok := frame.Metrics[path]; ok {
+			values = append(values, timedValue{value: value, timestamp: frame.Timestamp})
+		}
+	}
+	return values, true
+}
+
+// ReplayCapture evaluates the loaded rules against a capture file, as
+// recorded by descryctl record, to reproduce locally which rules fired in
+// production and when. Each frame is evaluated at its recorded time, so
+// avg(), trend() and during clauses see the recorded history; metrics missing
+// from the capture are read live. As with Simulate, rule bodies never run and
+// nothing is recorded.
+//
+// Captures recorded from a dashboard hold each rule's actual results, and a
+// replayed evaluation of a rule of the same name is checked against them:
+// SimulatedRule.Compared and Mismatches show whether the local rules
+// reproduce what happened in production.
+//
+// Example:
+//
+//	result, err := engine.ReplayCapture(ctx, "capture.dscrpack")
+//	for _, rule := range result.Rules {
+//		fmt.Printf("%s fired %d times\n", rule.Rule, rule.Triggers)
+//	}
+func (e *Engine) ReplayCapture(ctx context.Context, path string) (*SimulationResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	capture, err := ReadCapture(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(capture.Frames) == 0 {
+		return nil, fmt.Errorf("%s: capture has no frames", path)
+	}
+
+	start := capture.Frames[0].Timestamp
+	offsets := make([]time.Duration, len(capture.Frames))
+	for i, frame := range capture.Frames {
+		offsets[i] = frame.Timestamp.Sub(start)
+	}
+	return e.simulateRules(ctx, e.enabledRules(), &capturedMetrics{frames: capture.Frames}, start, offsets, nil)
+}
@@ -0,0 +1,90 @@
+package descry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCaptureReplay(t *testing.T) {
+	// heap.alloc climbs by 100 bytes a second, crossing 500 at 6s
+	start := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	writer, err := NewCaptureWriter(&buf, "http://prod:9090", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= 10; i++ {
+		frame := CaptureFrame{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Metrics:   map[string]float64{"heap.alloc": float64(i * 100), "custom.queue_depth": 7},
+		}
+		if err := writer.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	flushed := buf.Len()
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	capture, err := ReadCapture(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to read capture: %v", err)
+	}
+	if capture.Source != "http://prod:9090" || capture.Interval != time.Second || len(capture.Frames) != 11 {
+		t.Fatalf("unexpected capture: %+v", capture.CaptureHeader)
+	}
+
+	// A recording cut short keeps the frames written before it stopped
+	if truncated, err := ReadCapture(bytes.NewReader(buf.Bytes()[:flushed])); err != nil || len(truncated.Frames) != 11 {
+		t.Errorf("expected an interrupted capture to keep its frames, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "capture.dscrpack")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	sources := map[string]string{
+		"high_memory":  `when heap.alloc > 500 { alert("memory high") }`,
+		"high_average": `when avg("heap.alloc", 3) > 500 { alert("average high") }`,
+		"queue":        `when custom.queue_depth > 5 { alert("queue backed up") }`,
+	}
+	for _, name := range []string{"high_memory", "high_average", "queue"} {
+		if err := engine.AddRule(name, sources[name]); err != nil {
+			t.Fatalf("failed to add rule %s: %v", name, err)
+		}
+	}
+
+	result, err := engine.ReplayCapture(context.Background(), path)
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	if !result.Start.Equal(start) || len(result.Steps) != 11 {
+		t.Fatalf("unexpected replay: start %v, %d steps", result.Start, len(result.Steps))
+	}
+
+	memory, average, queue := result.Rules[0], result.Rules[1], result.Rules[2]
+	if memory.Triggers != 5 || *memory.FirstTrigger != 6*time.Second {
+		t.Errorf("unexpected high_memory result: %+v", memory)
+	}
+	// The 3s average over 4..7s is 550, the first above 500
+	if average.Triggers != 4 || average.FirstTrigger == nil || *average.FirstTrigger != 7*time.Second {
+		t.Errorf("unexpected high_average result: %+v", average)
+	}
+	if queue.Triggers != 11 {
+		t.Errorf("expected recorded custom metrics to replay, got %+v", queue)
+	}
+
+	if _, err := ReadCapture(strings.NewReader("not a capture")); err == nil {
+		t.Error("expected an error for an invalid capture")
+	}
+}
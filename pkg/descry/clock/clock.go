@@ -0,0 +1,158 @@
+// Package clock abstracts the passage of time for the Descry engine, its
+// metric collectors and the rule evaluator, so tests of time-based behaviour
+// such as avg(), trend(), cooldowns and rule intervals can advance time
+// deterministically instead of sleeping.
+//
+// Production code uses Real, the system clock. Tests pass a Fake through
+// descry.EngineConfig.Clock and move it forward with Advance:
+//
+//	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+//	engine := descry.NewEngineWithConfig(descry.EngineConfig{Clock: fake})
+//	engine.UpdateCustomMetric("queue.depth", 10)
+//	fake.Advance(30 * time.Second)
+//	engine.UpdateCustomMetric("queue.depth", 40)
+//	engine.EvaluateRules() // trend("custom.queue.depth", 60) is exactly 60/min
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time and creates tickers
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// NewTicker returns a ticker that sends the time every d; d must be
+	// positive
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks on a channel until stopped, like time.Ticker
+type Ticker interface {
+	// C returns the channel ticks are delivered on
+	C() <-chan time.Time
+	// Stop turns the ticker off. It does not close the channel.
+	Stop()
+}
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct{ ticker *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.ticker.C }
+func (t realTicker) Stop()               { t.ticker.Stop() }
+
+// Fake is a Clock that only moves when told to. Tickers created from it fire
+// as Advance and Set pass their tick times. Like time.Ticker, a ticker whose
+// receiver falls behind drops ticks rather than queueing them. It is safe for
+// concurrent use.
+type Fake struct {
+	mutex   sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// NewFake returns a fake clock set to now
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the fake clock's current time
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// NewTicker returns a ticker that fires every d of fake time
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	ticker := &fakeTicker{clock: f, interval: d, next: f.now.Add(d), c: make(chan time.Time, 1)}
+	f.tickers = append(f.tickers, ticker)
+	return ticker
+}
+
+// Advance moves the clock forward by d, firing each ticker due on the way
+// in time order
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to t, firing each ticker due by then in time order.
+// Setting an earlier time fires nothing.
+func (f *Fake) Set(t time.Time) {
+	for {
+		f.mutex.Lock()
+		// The earliest pending tick not after t
+		var due *fakeTicker
+		for _, ticker := range f.tickers {
+			if !ticker.next.After(t) && (due == nil || ticker.next.Before(due.next)) {
+				due = ticker
+			}
+		}
+		if due == nil {
+			f.now = t
+			f.mutex.Unlock()
+			return
+		}
+		at := due.next
+		f.now = at
+		due.next = at.Add(due.interval)
+		f.mutex.Unlock()
+
+		select {
+		case due.c <- at:
+		default:
+		}
+	}
+}
+
+// BlockUntil waits until at least n tickers are active, so a test can be sure
+// a goroutine has created its ticker before advancing the clock
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.mutex.Lock()
+		active := len(f.tickers)
+		f.mutex.Unlock()
+		if active >= n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// removeTicker stops delivering ticks to ticker
+func (f *Fake) removeTicker(ticker *fakeTicker) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for i, t := range f.tickers {
+		if t == ticker {
+			f.tickers = append(f.tickers[:i], f.tickers[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock    *Fake
+	interval time.Duration
+	next     time.Time
+	c        chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.c }
+func (t *fakeTicker) Stop()               { t.clock.removeTicker(t) }
@@ -0,0 +1,74 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	fast := fake.NewTicker(time.Second)
+	slow := fake.NewTicker(3 * time.Second)
+
+	fake.Advance(500 * time.Millisecond)
+	if !fake.Now().Equal(start.Add(500*time.Millisecond)) || len(fast.C()) != 0 {
+		t.Fatal("expected the clock to move without firing a ticker")
+	}
+
+	fake.Advance(time.Second)
+	select {
+	case at := <-fast.C():
+		if !at.Equal(start.Add(time.Second)) {
+			t.Errorf("expected a tick at 1s, got %v", at.Sub(start))
+		}
+	default:
+		t.Fatal("expected the ticker to fire")
+	}
+
+	// A receiver that falls behind misses ticks rather than queueing them
+	fake.Advance(5 * time.Second)
+	if len(fast.C()) != 1 {
+		t.Errorf("expected one buffered tick, got %d", len(fast.C()))
+	}
+	if at := <-fast.C(); !at.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("expected the first missed tick to be kept, got %v", at.Sub(start))
+	}
+	if at := <-slow.C(); !at.Equal(start.Add(3 * time.Second)) {
+		t.Errorf("expected a slow tick at 3s, got %v", at.Sub(start))
+	}
+
+	fast.Stop()
+	slow.Stop()
+	fake.Advance(time.Minute)
+	if len(fast.C()) != 0 || len(slow.C()) != 0 {
+		t.Error("expected stopped tickers not to fire")
+	}
+}
+
+func TestFakeDrivesLoop(t *testing.T) {
+	fake := NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	ticks := make(chan time.Time)
+	stop := make(chan struct{})
+	go func() {
+		ticker := fake.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case at := <-ticker.C():
+				ticks <- at
+			case <-stop:
+				return
+			}
+		}
+	}()
+	defer close(stop)
+
+	fake.BlockUntil(1)
+	for i := 1; i <= 3; i++ {
+		fake.Advance(time.Second)
+		if at := <-ticks; !at.Equal(fake.Now()) {
+			t.Errorf("tick %d: expected %v, got %v", i, fake.Now(), at)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package descry
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+// DefaultStateFlushInterval is the interval between state flushes unless
+// StateFlushConfig.Interval is set
+const DefaultStateFlushInterval = 30 * time.Second
+
+// crashFlushTimeout bounds the state flush made while the process crashes, in
+// case the panicking goroutine holds a lock the flush needs
+const crashFlushTimeout = 5 * time.Second
+
+// PanicInfo describes a panic the engine observed
+type PanicInfo struct {
+	// Value is the value passed to panic
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine
+	Stack []byte
+	// Source is where the panic happened: "rule <name>" or
+	// "provider <name>" for panics the engine recovers from, "engine" for
+	// its background goroutines and "application" for FlushOnPanic
+	Source string
+	// Recovered is true if the engine carried on after the panic, and
+	// false if the panic continues and will crash the process
+	Recovered bool
+	Time      time.Time
+}
+
+// PanicHook receives the panics the engine observes
+type PanicHook func(PanicInfo)
+
+// StateFlushConfig configures periodic flushes of the engine's state to a
+// local file, so a crash loses at most one interval of monitoring data. The
+// file holds the document written by Snapshot, encrypted if
+// SetStorageEncryption is configured, and is read back with Restore.
+type StateFlushConfig struct {
+	// Path of the state file. It is replaced atomically on each flush.
+	Path string
+	// Interval between flushes. Defaults to DefaultStateFlushInterval.
+	Interval time.Duration
+}
+
+// SetPanicHook installs a function called with every panic the engine
+// observes, or removes it when hook is nil: panics in rule evaluation and
+// metric providers, which the engine recovers from, and panics that crash
+// the process from the engine's goroutines or from code guarded by
+// FlushOnPanic. When the process is crashing the hook runs after the state
+// is flushed, so it can report the crash, but it cannot stop it.
+func (e *Engine) SetPanicHook(hook PanicHook) {
+	if hook == nil {
+		e.panicHook.Store(nil)
+		return
+	}
+	e.panicHook.Store(&hook)
+}
+
+// SetStateFlush enables periodic state flushes, or disables them when config
+// is nil. State is flushed while the engine is running, once more when it
+// stops, and when the process crashes with a panic the engine sees.
+func (e *Engine) SetStateFlush(config *StateFlushConfig) error {
+	var cfg *StateFlushConfig
+	if config != nil {
+		if config.Path == "" {
+			return fmt.Errorf("state flush path is required")
+		}
+		copied := *config
+		if copied.Interval <= 0 {
+			copied.Interval = DefaultStateFlushInterval
+		}
+		cfg = &copied
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.stateFlushStop != nil {
+		close(e.stateFlushStop)
+		e.stateFlushStop = nil
+	}
+	e.stateFlush = cfg
+	if e.running && cfg != nil {
+		e.startStateFlushLocked()
+	}
+	return nil
+}
+
+// startStateFlushLocked starts the flush schedule. Callers hold e.mutex.
+func (e *Engine) startStateFlushLocked() {
+	stop := make(chan struct{})
+	e.stateFlushStop = stop
+	config := *e.stateFlush
+	e.goBackground(func() { e.stateFlushLoop(config, stop) })
+}
+
+func (e *Engine) stateFlushLoop(config StateFlushConfig, stop chan struct{}) {
+	ticker := e.clock.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if err := e.writeStateFile(config.Path); err != nil {
+				e.log().Error("State flush failed", slog.String("component", "state"), slog.Any("error", err))
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// FlushState writes the state file configured with SetStateFlush now
+func (e *Engine) FlushState() error {
+	e.mutex.RLock()
+	config := e.stateFlush
+	e.mutex.RUnlock()
+
+	if config == nil {
+		return fmt.Errorf("state flush is not configured")
+	}
+	return e.writeStateFile(config.Path)
+}
+
+// writeStateFile replaces the state file through a synced temporary file, so
+// a crash mid-write leaves the previous state in place
+func (e *Engine) writeStateFile(path string) error {
+	e.flushMutex.Lock()
+	defer e.flushMutex.Unlock()
+
+	data, err := e.Snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to sync state: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace state file: %w", err)
+	}
+	// Persist the rename itself; not every platform can sync a directory
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// FlushOnPanic flushes the engine's state and calls the panic hook if the
+// surrounding function panics, then lets the panic continue. Defer it at the
+// top of main and of long-running goroutines, so the monitoring data leading
+// up to a crash survives it:
+//
+//	func main() {
+//		engine := descry.NewEngine()
+//		defer engine.FlushOnPanic()
+//		...
+//	}
+func (e *Engine) FlushOnPanic() {
+	if r := recover(); r != nil {
+		e.crash("application", r)
+		panic(r)
+	}
+}
+
+// crashGuard is FlushOnPanic for the engine's own goroutines
+func (e *Engine) crashGuard() {
+	if r := recover(); r != nil {
+		e.crash("engine", r)
+		panic(r)
+	}
+}
+
+// crash records a panic that will end the process: the state is flushed,
+// bounded by crashFlushTimeout, and the panic hook called
+func (e *Engine) crash(source string, value interface{}) {
+	info := PanicInfo{Value: value, Stack: debug.Stack(), Source: source, Time: e.clock.Now()}
+	e.log().Error("Panic", slog.String("source", source), slog.Any("panic", value))
+
+	flushed := make(chan error, 1)
+	go func() {
+		e.mutex.RLock()
+		config := e.stateFlush
+		e.mutex.RUnlock()
+		if config == nil {
+			flushed <- nil
+			return
+		}
+		flushed <- e.writeStateFile(config.Path)
+	}()
+	select {
+	case err := <-flushed:
+		if err != nil {
+			e.log().Error("State flush failed", slog.String("component", "state"), slog.Any("error", err))
+		}
+	case <-time.After(crashFlushTimeout):
+		e.log().Error("State flush timed out", slog.String("component", "state"))
+	}
+	e.reportPanic(info)
+}
+
+// recovered reports a panic the engine recovered from to the panic hook
+func (e *Engine) recovered(source string, value interface{}) {
+	e.reportPanic(PanicInfo{Value: value, Stack: debug.Stack(), Source: source, Recovered: true, Time: e.clock.Now()})
+}
+
+// reportPanic calls the panic hook, if any, shielding the caller from a
+// panic in the hook itself
+func (e *Engine) reportPanic(info PanicInfo) {
+	hook := e.panicHook.Load()
+	if hook == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e.log().Error("Panic in panic hook", slog.Any("panic", r))
+		}
+	}()
+	(*hook)(info)
+}
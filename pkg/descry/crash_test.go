@@ -0,0 +1,99 @@
+package descry
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPanicHookAndStateFlush(t *testing.T) {
+	newEngine := func() *Engine {
+		return NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	}
+	engine := newEngine()
+	var mutex sync.Mutex
+	var panics []PanicInfo
+	engine.SetPanicHook(func(info PanicInfo) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		panics = append(panics, info)
+	})
+	path := filepath.Join(t.TempDir(), "descry-state.json")
+
+	if err := engine.FlushState(); err == nil {
+		t.Error("expected FlushState to fail without a configured path")
+	}
+	if err := engine.SetStateFlush(&StateFlushConfig{}); err == nil {
+		t.Error("expected a state flush without a path to be rejected")
+	}
+	if err := engine.SetStateFlush(&StateFlushConfig{Path: path}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Panics the engine recovers from reach the hook
+	if err := engine.RegisterMetricProvider(&poolProvider{name: "db", inUse: -1}); err != nil {
+		t.Fatal(err)
+	}
+	engine.EvaluateRules()
+	if len(panics) == 0 {
+		t.Fatal("expected the provider panic to be reported")
+	}
+	if info := panics[0]; info.Source != "provider db" || !info.Recovered || len(info.Stack) == 0 {
+		t.Errorf("expected a recovered provider panic with its stack, got %s recovered %t", info.Source, info.Recovered)
+	}
+
+	// Stopping the engine flushes the state
+	engine.UpdateCustomMetric("orders", 7)
+	engine.Start(context.Background())
+	engine.Stop()
+	restored := newEngine()
+	if data, err := os.ReadFile(path); err != nil {
+		t.Fatal(err)
+	} else if err := restored.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := restored.GetCustomMetric("orders"); value != 7 {
+		t.Errorf("expected the flushed state to hold the custom metric, got %v", value)
+	}
+
+	// A crash guarded by FlushOnPanic flushes the latest state before the
+	// panic continues
+	engine.UpdateCustomMetric("orders", 8)
+	func() {
+		defer func() {
+			if r := recover(); r != "out of cheese" {
+				t.Errorf("expected the panic to continue, got %v", r)
+			}
+		}()
+		defer engine.FlushOnPanic()
+		panic("out of cheese")
+	}()
+	crashed := panics[len(panics)-1]
+	if crashed.Source != "application" || crashed.Recovered || crashed.Value != "out of cheese" {
+		t.Errorf("expected the crash to be reported, got %v from %s recovered %t", crashed.Value, crashed.Source, crashed.Recovered)
+	}
+	restored = newEngine()
+	data, _ := os.ReadFile(path)
+	if err := restored.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := restored.GetCustomMetric("orders"); value != 8 {
+		t.Errorf("expected the state at the crash, got %v", value)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".tmp") {
+			t.Errorf("expected no temporary files left behind, found %s", entry.Name())
+		}
+	}
+
+	// A panicking hook does not break the engine
+	engine.SetPanicHook(func(PanicInfo) { panic("hook") })
+	engine.EvaluateRules()
+}
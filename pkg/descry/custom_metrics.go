@@ -0,0 +1,333 @@
+package descry
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// customMetricShards is the number of independently locked partitions custom
+// metrics are spread over, so updates to different metrics rarely contend
+const customMetricShards = 32
+
+// customMetricStore holds custom metric values and their histories, sharded
+// by metric name
+type customMetricStore struct {
+	shards     [customMetricShards]customMetricShard
+	count      atomic.Int64 // distinct metrics across all shards
+	maxHistory atomic.Int64 // samples kept per metric
+
+	ttlMutex sync.RWMutex
+	ttls     map[string]time.Duration // how long a metric stays fresh after an update
+}
+
+type customMetricShard struct {
+	mutex  sync.RWMutex
+	series map[string]*customSeries
+}
+
+// customSeries is a metric's latest value and a ring buffer of its samples
+type customSeries struct {
+	value   float64
+	updated time.Time // when value was last recorded
+	samples []customMetricSample
+	next    int // index the next sample overwrites once samples is full
+}
+
+func newCustomMetricStore(maxHistory int) *customMetricStore {
+	store := &customMetricStore{ttls: make(map[string]time.Duration)}
+	store.maxHistory.Store(int64(maxHistory))
+	for i := range store.shards {
+		store.shards[i].series = make(map[string]*customSeries)
+	}
+	return store
+}
+
+// setMaxHistory changes the samples kept per metric, dropping the oldest
+// samples of longer histories
+func (s *customMetricStore) setMaxHistory(maxHistory int) {
+	s.maxHistory.Store(int64(maxHistory))
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mutex.Lock()
+		for _, series := range shard.series {
+			// Unroll the ring so it can grow by appending again
+			samples := series.ordered()
+			if len(samples) > maxHistory {
+				samples = samples[len(samples)-maxHistory:]
+			}
+			series.samples, series.next = samples, 0
+		}
+		shard.mutex.Unlock()
+	}
+}
+
+// shardIndex hashes a metric name to its shard with FNV-1a
+func shardIndex(name string) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(name); i++ {
+		hash ^= uint32(name[i])
+		hash *= 16777619
+	}
+	return int(hash % customMetricShards)
+}
+
+// reserve claims room for n new metrics under limit
+func (s *customMetricStore) reserve(n, limit int) error {
+	for {
+		count := s.count.Load()
+		if count+int64(n) > int64(limit) {
+			return &LimitError{Kind: LimitCustomMetrics, Limit: limit}
+		}
+		if s.count.CompareAndSwap(count, count+int64(n)) {
+			return nil
+		}
+	}
+}
+
+// set records one value at now. A new metric is rejected once limit
+// metrics exist.
+func (s *customMetricStore) set(name string, value float64, now time.Time, limit int) error {
+	shard := &s.shards[shardIndex(name)]
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	series, exists := shard.series[name]
+	if !exists {
+		if err := s.reserve(1, limit); err != nil {
+			return err
+		}
+		series = &customSeries{}
+		shard.series[name] = series
+	}
+	series.record(value, now, int(s.maxHistory.Load()))
+	return nil
+}
+
+// setAll records every value at now, taking each shard involved once. If
+// the new metrics among them would exceed limit, nothing is recorded.
+func (s *customMetricStore) setAll(values map[string]float64, now time.Time, limit int) error {
+	// Group the names by shard with a counting sort
+	var ends [customMetricShards]int
+	for name := range values {
+		ends[shardIndex(name)]++
+	}
+	for i := 1; i < customMetricShards; i++ {
+		ends[i] += ends[i-1]
+	}
+	names := make([]string, len(values))
+	fill := ends
+	for name := range values {
+		i := shardIndex(name)
+		fill[i]--
+		names[fill[i]] = name
+	}
+
+	// Metrics are never removed, so room for the new ones can be reserved
+	// before anything is written
+	added := 0
+	start := 0
+	for i, end := range ends {
+		if start == end {
+			continue
+		}
+		shard := &s.shards[i]
+		shard.mutex.RLock()
+		for _, name := range names[start:end] {
+			if _, exists := shard.series[name]; !exists {
+				added++
+			}
+		}
+		shard.mutex.RUnlock()
+		start = end
+	}
+	if added > 0 {
+		if err := s.reserve(added, limit); err != nil {
+			return err
+		}
+	}
+
+	created := 0
+	maxHistory := int(s.maxHistory.Load())
+	start = 0
+	for i, end := range ends {
+		if start == end {
+			continue
+		}
+		shard := &s.shards[i]
+		shard.mutex.Lock()
+		for _, name := range names[start:end] {
+			series, exists := shard.series[name]
+			if !exists {
+				series = &customSeries{}
+				shard.series[name] = series
+				created++
+			}
+			series.record(values[name], now, maxHistory)
+		}
+		shard.mutex.Unlock()
+		start = end
+	}
+	if created < added {
+		// Concurrent updates created some of the new metrics first
+		s.count.Add(int64(created - added))
+	}
+	return nil
+}
+
+// record sets the series' value and adds it to the ring buffer
+func (c *customSeries) record(value float64, now time.Time, maxHistory int) {
+	c.value = value
+	c.updated = now
+	sample := customMetricSample{Value: value, Timestamp: now}
+	if len(c.samples) < maxHistory {
+		c.samples = append(c.samples, sample)
+		return
+	}
+	if maxHistory <= 0 {
+		return
+	}
+	c.samples[c.next] = sample
+	c.next = (c.next + 1) % len(c.samples)
+}
+
+// ordered returns a copy of the series' samples, oldest first
+func (c *customSeries) ordered() []customMetricSample {
+	samples := make([]customMetricSample, 0, len(c.samples))
+	samples = append(samples, c.samples[c.next:]...)
+	return append(samples, c.samples[:c.next]...)
+}
+
+// get returns a metric's latest value
+func (s *customMetricStore) get(name string) (float64, bool) {
+	shard := &s.shards[shardIndex(name)]
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	if series, exists := shard.series[name]; exists {
+		return series.value, true
+	}
+	return 0, false
+}
+
+// lastUpdate returns when a metric was last recorded
+func (s *customMetricStore) lastUpdate(name string) (time.Time, bool) {
+	shard := &s.shards[shardIndex(name)]
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	if series, exists := shard.series[name]; exists {
+		return series.updated, true
+	}
+	return time.Time{}, false
+}
+
+// setTTL sets how long a metric stays fresh after an update. A ttl of zero
+// or less removes it.
+func (s *customMetricStore) setTTL(name string, ttl time.Duration) {
+	s.ttlMutex.Lock()
+	defer s.ttlMutex.Unlock()
+	if ttl <= 0 {
+		delete(s.ttls, name)
+		return
+	}
+	s.ttls[name] = ttl
+}
+
+// ttl returns a metric's TTL, and false if it has none
+func (s *customMetricStore) ttl(name string) (time.Duration, bool) {
+	s.ttlMutex.RLock()
+	defer s.ttlMutex.RUnlock()
+	ttl, ok := s.ttls[name]
+	return ttl, ok
+}
+
+// history returns a metric's samples after cutoff, oldest first
+func (s *customMetricStore) history(name string, cutoff time.Time) []customMetricSample {
+	shard := &s.shards[shardIndex(name)]
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+	series, exists := shard.series[name]
+	if !exists {
+		return nil
+	}
+	var result []customMetricSample
+	for _, sample := range series.ordered() {
+		if sample.Timestamp.After(cutoff) {
+			result = append(result, sample)
+		}
+	}
+	return result
+}
+
+// values returns every metric's latest value
+func (s *customMetricStore) values() map[string]float64 {
+	values := make(map[string]float64)
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mutex.RLock()
+		for name, series := range shard.series {
+			values[name] = series.value
+		}
+		shard.mutex.RUnlock()
+	}
+	return values
+}
+
+// histories returns every metric's samples, oldest first
+func (s *customMetricStore) histories() map[string][]customMetricSample {
+	histories := make(map[string][]customMetricSample)
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.mutex.RLock()
+		for name, series := range shard.series {
+			histories[name] = series.ordered()
+		}
+		shard.mutex.RUnlock()
+	}
+	return histories
+}
+
+// restore adds saved metrics that do not exist yet, up to limit, and puts
+// saved samples older than any recorded since before each metric's history.
+// It reports whether metrics were dropped for the limit.
+func (s *customMetricStore) restore(values map[string]float64, history map[string][]MetricSample, limit int) bool {
+	truncated := false
+	for name, value := range values {
+		shard := &s.shards[shardIndex(name)]
+		shard.mutex.Lock()
+		if _, exists := shard.series[name]; !exists {
+			if s.reserve(1, limit) != nil {
+				shard.mutex.Unlock()
+				truncated = true
+				break
+			}
+			shard.series[name] = &customSeries{value: value}
+		}
+		shard.mutex.Unlock()
+	}
+
+	for name, samples := range history {
+		shard := &s.shards[shardIndex(name)]
+		shard.mutex.Lock()
+		if series, exists := shard.series[name]; exists {
+			current := series.ordered()
+			merged := make([]customMetricSample, 0, len(samples)+len(current))
+			for _, sample := range samples {
+				// Keep only samples older than those recorded since startup
+				if len(current) == 0 || sample.Timestamp.Before(current[0].Timestamp) {
+					merged = append(merged, customMetricSample{Value: sample.Value, Timestamp: sample.Timestamp})
+				}
+			}
+			merged = append(merged, current...)
+			if maxHistory := int(s.maxHistory.Load()); len(merged) > maxHistory {
+				merged = merged[len(merged)-maxHistory:]
+			}
+			series.samples, series.next = merged, 0
+			if series.updated.IsZero() && len(merged) > 0 {
+				// A restored metric was last updated by its newest saved sample
+				series.updated = merged[len(merged)-1].Timestamp
+			}
+		}
+		shard.mutex.Unlock()
+	}
+	return truncated
+}
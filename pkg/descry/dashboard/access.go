@@ -0,0 +1,190 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// RoleHeader is the request header read for the caller's role when a policy
+// sets TrustRoleHeader. Only an authenticating reverse proxy in front of the
+// dashboard, which replaces any value sent by the client, should set it.
+const RoleHeader = "X-Descry-Role"
+
+// MetricAccessPolicy restricts which metrics each role or team can see on the
+// dashboard. It is enforced for the metrics API, historical metrics, captures, queries,
+// playback, correlation analysis and live WebSocket updates.
+//
+// Example:
+//
+//	server.SetMetricAccessPolicy(&dashboard.MetricAccessPolicy{
+//		Roles: map[string][]string{
+//			"sre":        {"*"},
+//			"contractor": {"heap.*", "gc.*", "goroutines.*", "http.*"},
+//		},
+//		DefaultRole: "contractor",
+//	})
+type MetricAccessPolicy struct {
+	// Roles maps a role name to the metric patterns it may view. A pattern is
+	// either an exact metric name, a prefix ending in "*" (e.g. "custom.billing.*"),
+	// or "*" for all metrics. Roles not listed see no metrics.
+	Roles map[string][]string
+	// DefaultRole is used when the request does not identify a role, and for
+	// every request when neither RoleResolver nor TrustRoleHeader is set
+	DefaultRole string
+	// RoleResolver extracts the role from a request, for example from a
+	// verified session or client certificate
+	RoleResolver func(r *http.Request) string
+	// TrustRoleHeader reads the role from RoleHeader when there is no
+	// RoleResolver. Any client can send the header, so enable it only behind
+	// a proxy that sets it.
+	TrustRoleHeader bool
+}
+
+// SetMetricAccessPolicy installs a per-role metric visibility policy.
+// Passing nil removes the policy so that all metrics are visible.
+func (s *Server) SetMetricAccessPolicy(policy *MetricAccessPolicy) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.accessPolicy = policy
+}
+
+// resolveRole determines the role of the caller making the request. Roles
+// claimed by the client are ignored unless the policy trusts RoleHeader.
+func (s *Server) resolveRole(r *http.Request) string {
+	s.mutex.RLock()
+	policy := s.accessPolicy
+	s.mutex.RUnlock()
+
+	if policy == nil {
+		return ""
+	}
+
+	var role string
+	if policy.RoleResolver != nil {
+		role = policy.RoleResolver(r)
+	} else if policy.TrustRoleHeader {
+		role = r.Header.Get(RoleHeader)
+	}
+	if role == "" {
+		role = policy.DefaultRole
+	}
+	return role
+}
+
+// canViewMetric reports whether the role may see the named metric
+func (s *Server) canViewMetric(role, metric string) bool {
+	s.mutex.RLock()
+	policy := s.accessPolicy
+	s.mutex.RUnlock()
+
+	if policy == nil {
+		return true
+	}
+
+	for _, pattern := range policy.Roles[role] {
+		if matchMetricPattern(pattern, metric) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMetricPattern matches a metric name against an exact name or a
+// trailing-wildcard pattern
+func matchMetricPattern(pattern, metric string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(metric, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == metric
+}
+
+// filterMetrics returns a copy of the metrics map containing only the entries
+// visible to the role. Without a policy the original map is returned.
+func (s *Server) filterMetrics(role string, metrics map[string]interface{}) map[string]interface{} {
+	s.mutex.RLock()
+	policy := s.accessPolicy
+	s.mutex.RUnlock()
+
+	if policy == nil || metrics == nil {
+		return metrics
+	}
+
+	filtered := make(map[string]interface{}, len(metrics))
+	for name, value := range metrics {
+		if s.canViewMetric(role, name) {
+			filtered[name] = value
+		}
+	}
+	return filtered
+}
+
+// filterMetricUpdate returns the update with its metrics filtered for the role
+func (s *Server) filterMetricUpdate(role string, update MetricUpdate) MetricUpdate {
+	filtered := MetricUpdate{
+		Timestamp:  update.Timestamp,
+		Metrics:    s.filterMetrics(role, update.Metrics),
+		Resolution: update.Resolution,
+	}
+	for _, name := range update.Stale {
+		if _, visible := filtered.Metrics[name]; visible {
+			filtered.Stale = append(filtered.Stale, name)
+		}
+	}
+	return filtered
+}
+
+// broadcastMetricUpdate sends a metric update to all WebSocket clients, filtering
+// the metrics separately for each role so clients only receive what they may see
+func (s *Server) broadcastMetricUpdate(messageType string, update MetricUpdate, playback bool) {
+	s.clientsMutex.RLock()
+	if len(s.clients) == 0 {
+		s.clientsMutex.RUnlock()
+		return
+	}
+
+	// Group clients by role so each filtered payload is marshaled once
+	clientsByRole := make(map[string][]*websocket.Conn)
+	for client, role := range s.clients {
+		clientsByRole[role] = append(clientsByRole[role], client)
+	}
+	s.clientsMutex.RUnlock()
+
+	var failedClients []*websocket.Conn
+	for role, clients := range clientsByRole {
+		message := map[string]interface{}{
+			"type": messageType,
+			"data": s.filterMetricUpdate(role, update),
+		}
+		if playback {
+			message["playback"] = true
+		}
+
+		data, err := json.Marshal(message)
+		if err != nil {
+			if s.debugEnabled {
+				log.Printf("Error marshaling message: %v", err)
+			}
+			continue
+		}
+
+		for _, client := range clients {
+			if err := client.WriteMessage(websocket.TextMessage, data); err != nil {
+				client.Close()
+				failedClients = append(failedClients, client)
+			}
+		}
+	}
+
+	// Remove failed clients from the map
+	if len(failedClients) > 0 {
+		s.clientsMutex.Lock()
+		for _, client := range failedClients {
+			delete(s.clients, client)
+		}
+		s.clientsMutex.Unlock()
+	}
+}
@@ -0,0 +1,112 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricAccessPolicy(t *testing.T) {
+	server := NewServer(0)
+	server.recentMetrics = MetricUpdate{
+		Timestamp: time.Now(),
+		Metrics: map[string]interface{}{
+			"heap.alloc":             1024.0,
+			"custom.billing.revenue": 99.0,
+		},
+	}
+	server.SetMetricAccessPolicy(&MetricAccessPolicy{
+		Roles: map[string][]string{
+			"sre":        {"*"},
+			"contractor": {"heap.*", "gc.*"},
+		},
+		DefaultRole:     "contractor",
+		TrustRoleHeader: true,
+	})
+
+	fetch := func(role string) map[string]interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/api/metrics", nil)
+		if role != "" {
+			req.Header.Set(RoleHeader, role)
+		}
+		rec := httptest.NewRecorder()
+		server.handleMetrics(rec, req)
+
+		var response struct {
+			Data MetricUpdate `json:"data"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		return response.Data.Metrics
+	}
+
+	if metrics := fetch("sre"); len(metrics) != 2 {
+		t.Errorf("expected sre to see all metrics, got %v", metrics)
+	}
+
+	metrics := fetch("")
+	if _, ok := metrics["custom.billing.revenue"]; ok {
+		t.Error("expected business metric to be hidden from default role")
+	}
+	if _, ok := metrics["heap.alloc"]; !ok {
+		t.Error("expected heap.alloc to be visible to default role")
+	}
+
+	if metrics := fetch("unknown"); len(metrics) != 0 {
+		t.Errorf("expected unknown role to see no metrics, got %v", metrics)
+	}
+
+	// Without a trusted proxy a claimed role is ignored
+	server.SetMetricAccessPolicy(&MetricAccessPolicy{
+		Roles:       map[string][]string{"sre": {"*"}, "contractor": {"heap.*"}},
+		DefaultRole: "contractor",
+	})
+	if metrics := fetch("sre"); len(metrics) != 1 || metrics["heap.alloc"] == nil {
+		t.Errorf("expected a spoofed role header to get the default role, got %v", metrics)
+	}
+}
+
+func TestCorrelationListsCustomMetrics(t *testing.T) {
+	server := NewServer(0)
+	server.recentMetrics = MetricUpdate{
+		Timestamp: time.Now(),
+		Metrics:   map[string]interface{}{"heap.alloc": 1.0, "custom.queue_depth": 3.0, "custom.orders": 7.0},
+	}
+	server.SetMetricAccessPolicy(&MetricAccessPolicy{DefaultRole: "viewer", Roles: map[string][]string{"viewer": {"heap.*", "custom.queue_*"}}})
+
+	rec := httptest.NewRecorder()
+	server.handleMetricCorrelation(rec, httptest.NewRequest(http.MethodGet, "/api/correlation", nil))
+	var response struct {
+		Metrics []string `json:"metrics"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Metrics) != 2 || response.Metrics[0] != "heap.alloc" || response.Metrics[1] != "custom.queue_depth" {
+		t.Errorf("expected heap.alloc and the visible custom metric, got %v", response.Metrics)
+	}
+}
+
+func TestHTTPBreakdownAccess(t *testing.T) {
+	server := NewServer(0)
+	server.SetHTTPBreakdownProvider(func() interface{} {
+		return map[string]interface{}{"routes": []interface{}{map[string]interface{}{"route": "/api/orders/:id"}}}
+	})
+	get := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.handleHTTPBreakdown(rec, httptest.NewRequest(http.MethodGet, "/api/http/breakdown", nil))
+		return rec
+	}
+
+	if rec := get(); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/api/orders/:id") {
+		t.Errorf("expected the breakdown, got %d: %s", rec.Code, rec.Body.String())
+	}
+	server.SetMetricAccessPolicy(&MetricAccessPolicy{DefaultRole: "viewer", Roles: map[string][]string{"viewer": {"heap.*"}}})
+	if rec := get(); rec.Code != http.StatusForbidden {
+		t.Errorf("expected roles without HTTP metrics to be denied, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,68 @@
+package dashboard
+
+import "time"
+
+// AlertCounts summarizes the alert manager's current state for rules
+type AlertCounts struct {
+	// Active alerts have not been acknowledged, resolved or suppressed
+	Active int `json:"active"`
+	// Acknowledged alerts are still ongoing but someone is handling them
+	Acknowledged int `json:"acknowledged"`
+	// Critical and High count ongoing (active or acknowledged) alerts by severity
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+}
+
+// GetAlertCounts returns the number of ongoing alerts by status and severity
+func (s *Server) GetAlertCounts() AlertCounts {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var counts AlertCounts
+	for _, alert := range s.alerts {
+		switch alert.Status {
+		case AlertStatusActive:
+			counts.Active++
+		case AlertStatusAcknowledged:
+			counts.Acknowledged++
+		default:
+			continue
+		}
+		switch alert.Severity {
+		case AlertSeverityCritical:
+			counts.Critical++
+		case AlertSeverityHigh:
+			counts.High++
+		}
+	}
+	return counts
+}
+
+// SuppressActiveAlerts suppresses every active alert not raised by
+// exceptRule and returns how many were suppressed. It lets a meta-rule
+// replace an alert storm with a single alert of its own.
+func (s *Server) SuppressActiveAlerts(exceptRule, reason string) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	suppressed := 0
+	for i := range s.alerts {
+		if s.alerts[i].Status != AlertStatusActive || s.alerts[i].Rule == exceptRule {
+			continue
+		}
+		s.alerts[i].Status = AlertStatusSuppressed
+		s.alerts[i].UpdatedAt = now
+		s.alerts[i].Notes = append(s.alerts[i].Notes, AlertNote{
+			ID:        generateAlertID(),
+			Message:   reason,
+			Author:    exceptRule,
+			CreatedAt: now,
+		})
+		suppressed++
+	}
+	if suppressed > 0 {
+		s.updateAlertsByStatus()
+	}
+	return suppressed
+}
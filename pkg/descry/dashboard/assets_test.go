@@ -0,0 +1,76 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestVendorScriptTags(t *testing.T) {
+	server := NewServer(0)
+	tags := server.vendorScriptTags("nonce")
+	sources := regexp.MustCompile(`src="([^"]+)"`).FindAllStringSubmatch(tags, -1)
+	if len(sources) != len(vendorScripts) {
+		t.Fatalf("expected a script tag per vendored asset, got %s", tags)
+	}
+
+	// Scripts only ever load from the dashboard itself, never a public CDN
+	policy := server.contentSecurityPolicy("localhost", "nonce")
+	if strings.Contains(policy, "https:") || strings.Contains(tags, "https:") {
+		t.Errorf("expected same-origin scripts, got %s with policy %q", tags, policy)
+	}
+	mirrored := NewServer(0)
+	mirrored.SetAssetBaseURL("https://assets.internal/descry/")
+	if tags := mirrored.vendorScriptTags("nonce"); !strings.Contains(tags, `src="https://assets.internal/descry/chart.umd.js"`) {
+		t.Errorf("expected scripts from the mirror, got %s", tags)
+	}
+
+	handler := staticHandler()
+	for i, source := range sources {
+		if want := DefaultAssetBaseURL + "/" + vendorScripts[i]; source[1] != want {
+			t.Errorf("expected %s, got %s", want, source[1])
+		}
+		if assetIntegrity(vendorScripts[i]) == "" {
+			t.Skipf("%s is not embedded; run 'make vendor-assets'", vendorScripts[i])
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, source[1], nil))
+		if recorder.Code != http.StatusOK {
+			t.Errorf("expected %s to be served, got status %d", source[1], recorder.Code)
+		}
+	}
+	if strings.Count(tags, `integrity="sha384-`) != len(vendorScripts) {
+		t.Errorf("expected an integrity hash on every script, got %s", tags)
+	}
+}
+
+func TestContentSecurityPolicy(t *testing.T) {
+	server := NewServer(0)
+	handler := server.securityHeaders(http.HandlerFunc(server.handleIndex))
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "http://dash.internal:9090/", nil))
+
+	// Scripts need the request's nonce; inline handlers are not allowed
+	policy := recorder.Header().Get("Content-Security-Policy")
+	nonce := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(policy)
+	if nonce == nil || strings.Contains(policy, "script-src 'self' 'unsafe-inline'") {
+		t.Fatalf("expected a nonce-based script policy, got %q", policy)
+	}
+	body := recorder.Body.String()
+	if !strings.Contains(body, `<script nonce="`+nonce[1]+`">`) {
+		t.Error("expected the dashboard script to carry the policy's nonce")
+	}
+	if handlers := regexp.MustCompile(`<[^>]*\son[a-z]+=`).FindAllString(body, -1); len(handlers) > 0 {
+		t.Errorf("expected no inline event handlers, got %q", handlers)
+	}
+
+	// WebSockets may only connect back to the host the dashboard was served from
+	if !strings.Contains(policy, "connect-src 'self' ws://dash.internal:9090 wss://dash.internal:9090;") {
+		t.Errorf("expected same-origin WebSocket sources, got %q", policy)
+	}
+	if policy := server.contentSecurityPolicy("evil; script-src *", "nonce"); !strings.Contains(policy, "connect-src 'self';") {
+		t.Errorf("expected an unsafe host to be ignored, got %q", policy)
+	}
+}
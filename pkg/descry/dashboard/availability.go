@@ -0,0 +1,67 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// SetAvailabilityProvider connects the /api/availability endpoint to the
+// engine's per-rule availability tracking, which backs the 30-day
+// availability widget
+func (s *Server) SetAvailabilityProvider(getAvailability func() interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.getAvailability = getAvailability
+}
+
+func (s *Server) handleAvailability(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	getAvailability := s.getAvailability
+	s.mutex.RUnlock()
+
+	var availability interface{} = []interface{}{}
+	if getAvailability != nil {
+		availability = getAvailability()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   availability,
+	})
+}
+
+// SetRuleStatsProvider connects the /api/rules/stats endpoint to the engine's
+// per-rule evaluation statistics
+func (s *Server) SetRuleStatsProvider(getRuleStats func() interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.getRuleStats = getRuleStats
+}
+
+func (s *Server) handleRuleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	getRuleStats := s.getRuleStats
+	s.mutex.RUnlock()
+
+	var stats interface{} = []interface{}{}
+	if getRuleStats != nil {
+		stats = getRuleStats()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   stats,
+	})
+}
@@ -0,0 +1,45 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// breakdownMetric is the metric a role must be allowed to view to see the
+// HTTP breakdown, which splits response times by endpoint
+const breakdownMetric = "http.response_time"
+
+// SetHTTPBreakdownProvider connects the /api/http/breakdown endpoint to the
+// engine's HTTP statistics by route label, method and status class, which
+// back the Endpoints card
+func (s *Server) SetHTTPBreakdownProvider(getBreakdown func() interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.getHTTPBreakdown = getBreakdown
+}
+
+func (s *Server) handleHTTPBreakdown(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.canViewMetric(s.resolveRole(r), breakdownMetric) {
+		http.Error(w, "Access to requested metric denied", http.StatusForbidden)
+		return
+	}
+
+	s.mutex.RLock()
+	getBreakdown := s.getHTTPBreakdown
+	s.mutex.RUnlock()
+
+	var breakdown interface{} = map[string]interface{}{}
+	if getBreakdown != nil {
+		breakdown = getBreakdown()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   breakdown,
+	})
+}
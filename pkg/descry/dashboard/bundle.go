@@ -0,0 +1,95 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// maxRuleBundleSize bounds the body of a /api/rules/import request
+const maxRuleBundleSize = 10 << 20
+
+// SetRuleBundleManager connects rule bundle export and import to the engine.
+// exportBundle writes every rule as a "json" or "tar" bundle; importBundle
+// reads a bundle in either format and applies it, or with dryRun only reports
+// the changes it would make. replace removes rules missing from the bundle.
+func (s *Server) SetRuleBundleManager(exportBundle func(w io.Writer, format string) error,
+	importBundle func(r io.Reader, dryRun, replace bool) (interface{}, error)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.exportBundle = exportBundle
+	s.importBundle = importBundle
+}
+
+// handleRuleExport downloads every rule as a bundle, for
+// GET /api/rules/export?format=json or ?format=tar
+func (s *Server) handleRuleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	exportBundle := s.exportBundle
+	s.mutex.RUnlock()
+	if exportBundle == nil {
+		http.Error(w, "Rule management not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	var filename, contentType string
+	switch format {
+	case "", "json":
+		format, filename, contentType = "json", "descry-rules.json", "application/json"
+	case "tar":
+		filename, contentType = "descry-rules.tar.gz", "application/gzip"
+	default:
+		writeRuleError(w, http.StatusBadRequest, fmt.Errorf("format must be json or tar"))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := exportBundle(&buf, format); err != nil {
+		writeRuleError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(buf.Bytes())
+}
+
+// handleRuleImport applies the bundle in the request body, for
+// POST /api/rules/import. ?dry_run=true only reports the changes and
+// ?replace=true removes rules missing from the bundle.
+func (s *Server) handleRuleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	importBundle := s.importBundle
+	s.mutex.RUnlock()
+	if importBundle == nil {
+		http.Error(w, "Rule management not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+	diff, err := importBundle(http.MaxBytesReader(w, r.Body, maxRuleBundleSize),
+		query.Get("dry_run") == "true", query.Get("replace") == "true")
+	if err != nil {
+		writeRuleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   diff,
+	})
+}
@@ -0,0 +1,56 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// SetCaptureProvider connects the /api/capture endpoint, polled by
+// descryctl record, to the engine. provider returns every metric available to
+// rules, keyed by DSL name and in DSL units.
+func (s *Server) SetCaptureProvider(provider func() map[string]float64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.captureProvider = provider
+}
+
+// handleCapture returns the current value of every metric the caller may
+// view, with each rule's latest result, for recording a capture to replay
+// elsewhere
+func (s *Server) handleCapture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	provider := s.captureProvider
+	currentRuleStates := s.currentRuleStates
+	s.mutex.RUnlock()
+	if provider == nil {
+		http.Error(w, "Capture not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	role := s.resolveRole(r)
+	metrics := make(map[string]float64)
+	for name, value := range provider() {
+		if s.canViewMetric(role, name) {
+			metrics[name] = value
+		}
+	}
+	frame := map[string]interface{}{
+		"timestamp": time.Now().UTC(),
+		"metrics":   metrics,
+	}
+	if currentRuleStates != nil {
+		frame["rule_states"] = currentRuleStates()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   frame,
+	})
+}
@@ -0,0 +1,297 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Probable-cause analysis parameters
+const (
+	// causeWindow is how close to an alert other alerts must fire to be
+	// analyzed with it, and how long before the first of them a metric may
+	// start deviating
+	causeWindow = 5 * time.Minute
+	// causeBaseline is the history before that which deviations are
+	// measured against
+	causeBaseline = 30 * time.Minute
+	// causeDeviation is the number of standard deviations from the baseline
+	// at which a metric counts as deviating
+	causeDeviation = 3.0
+	// causeCorrelation is the correlation coefficient, in absolute value, at
+	// which an alert's metrics are taken to depend on the probable cause
+	causeCorrelation = 0.5
+	// causeMinBaseline is the fewest baseline samples a metric needs
+	causeMinBaseline = 5
+)
+
+// CauseAnalysis ranks the metrics that may have caused an alert and the
+// alerts that fired around it
+type CauseAnalysis struct {
+	AlertID string `json:"alert_id"`
+	// Related are the alerts that fired within five minutes of the alert,
+	// including the alert itself, oldest first
+	Related []CauseAlert `json:"related"`
+	// Candidates are the metrics read by the related alerts' rules that
+	// deviated from their baseline, the earliest and then the strongest first
+	Candidates []CauseCandidate `json:"candidates"`
+	// ProbableCause links the alert to the alert whose metric deviated first,
+	// when that is another alert the alert's own metrics correlate with
+	ProbableCause *CauseLink `json:"probable_cause,omitempty"`
+}
+
+// CauseAlert identifies an alert in a cause analysis
+type CauseAlert struct {
+	ID        string    `json:"id"`
+	Rule      string    `json:"rule"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CauseCandidate is a metric that deviated around the alerts
+type CauseCandidate struct {
+	Metric string `json:"metric"`
+	// DeviatedAt is the first sample at least three standard deviations
+	// from the metric's baseline
+	DeviatedAt time.Time `json:"deviated_at"`
+	// Deviation is the largest distance from the baseline, in standard
+	// deviations
+	Deviation float64 `json:"deviation"`
+	// Alerts are the IDs of the related alerts whose rules read the metric
+	Alerts []string `json:"alerts"`
+}
+
+// CauseLink points from a dependent alert to its probable cause
+type CauseLink struct {
+	AlertID string `json:"alert_id"`
+	Rule    string `json:"rule"`
+	Metric  string `json:"metric"`
+	// Correlation is the strongest correlation between the cause metric and
+	// the dependent alert's metrics over the analyzed window
+	Correlation float64 `json:"correlation"`
+}
+
+// SetRuleMetricsProvider lets probable-cause analysis find the metrics an
+// alert's rule reads. provider returns a rule's metric paths, such as
+// "heap.alloc", or nil for an unknown rule.
+func (s *Server) SetRuleMetricsProvider(provider func(rule string) []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ruleMetrics = provider
+}
+
+// handleAlertCause serves GET /api/alerts/{id}/cause, the probable-cause
+// analysis of an alert
+func (s *Server) handleAlertCause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	analysis, ok := s.analyzeCause(r.PathValue("id"), s.resolveRole(r))
+	if !ok {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   analysis,
+	})
+}
+
+// analyzeCause ranks the metrics read by the rules of the alerts that fired
+// around an alert by when, and how far, they deviated from their baseline.
+// Metrics the role may not view are left out.
+func (s *Server) analyzeCause(id, role string) (*CauseAnalysis, bool) {
+	s.mutex.RLock()
+	var alert *Alert
+	for i := range s.alerts {
+		if s.alerts[i].ID == id {
+			alert = &s.alerts[i]
+			break
+		}
+	}
+	if alert == nil {
+		s.mutex.RUnlock()
+		return nil, false
+	}
+
+	analysis := &CauseAnalysis{AlertID: id, Related: []CauseAlert{}, Candidates: []CauseCandidate{}}
+	from, to := alert.CreatedAt, alert.CreatedAt
+	for _, other := range s.alerts {
+		if other.CreatedAt.Sub(alert.CreatedAt).Abs() > causeWindow {
+			continue
+		}
+		analysis.Related = append(analysis.Related, CauseAlert{
+			ID: other.ID, Rule: other.Rule, Message: other.Message, CreatedAt: other.CreatedAt,
+		})
+		if other.CreatedAt.Before(from) {
+			from = other.CreatedAt
+		}
+		if other.CreatedAt.After(to) {
+			to = other.CreatedAt
+		}
+	}
+	onset := from.Add(-causeWindow)
+	var history []MetricUpdate
+	for _, update := range s.metricHistory() {
+		if !update.Timestamp.Before(onset.Add(-causeBaseline)) && !update.Timestamp.After(to) {
+			history = append(history, update)
+		}
+	}
+	ruleMetrics := s.ruleMetrics
+	s.mutex.RUnlock()
+
+	sort.SliceStable(analysis.Related, func(i, j int) bool {
+		return analysis.Related[i].CreatedAt.Before(analysis.Related[j].CreatedAt)
+	})
+
+	// The metrics each related alert's rule reads
+	alertMetrics := make(map[string][]string, len(analysis.Related))
+	var metricNames []string
+	seen := make(map[string]bool)
+	for _, related := range analysis.Related {
+		if ruleMetrics == nil {
+			break
+		}
+		for _, name := range ruleMetrics(related.Rule) {
+			if !s.canViewMetric(role, name) {
+				continue
+			}
+			alertMetrics[related.ID] = append(alertMetrics[related.ID], name)
+			if !seen[name] {
+				seen[name] = true
+				metricNames = append(metricNames, name)
+			}
+		}
+	}
+
+	for _, name := range metricNames {
+		candidate, ok := metricDeviation(name, history, onset)
+		if !ok {
+			continue
+		}
+		for _, related := range analysis.Related {
+			if containsString(alertMetrics[related.ID], name) {
+				candidate.Alerts = append(candidate.Alerts, related.ID)
+			}
+		}
+		analysis.Candidates = append(analysis.Candidates, candidate)
+	}
+	sort.SliceStable(analysis.Candidates, func(i, j int) bool {
+		a, b := analysis.Candidates[i], analysis.Candidates[j]
+		if !a.DeviatedAt.Equal(b.DeviatedAt) {
+			return a.DeviatedAt.Before(b.DeviatedAt)
+		}
+		return a.Deviation > b.Deviation
+	})
+
+	if len(analysis.Candidates) == 0 {
+		return analysis, true
+	}
+	cause := analysis.Candidates[0]
+	if containsString(cause.Alerts, id) {
+		// The alert reads the metric that moved first, so it is the cause
+		return analysis, true
+	}
+	strongest := 0.0
+	for _, name := range alertMetrics[id] {
+		if r := metricCorrelation(cause.Metric, name, history); math.Abs(r) > math.Abs(strongest) {
+			strongest = r
+		}
+	}
+	if math.Abs(strongest) < causeCorrelation {
+		return analysis, true
+	}
+	// Related alerts are oldest first, so this is the first to read the cause
+	for _, related := range analysis.Related {
+		if containsString(cause.Alerts, related.ID) {
+			analysis.ProbableCause = &CauseLink{
+				AlertID: related.ID, Rule: related.Rule, Metric: cause.Metric, Correlation: strongest,
+			}
+			break
+		}
+	}
+	return analysis, true
+}
+
+// metricDeviation measures a metric's samples from onset against its
+// samples before onset. It reports false if the metric has too little
+// baseline or never deviates.
+func metricDeviation(name string, history []MetricUpdate, onset time.Time) (CauseCandidate, bool) {
+	var baseline []float64
+	candidate := CauseCandidate{Metric: name}
+	for _, update := range history {
+		if update.Timestamp.Before(onset) {
+			if value, ok := getMetricValue(update.Metrics, name); ok {
+				baseline = append(baseline, value)
+			}
+		}
+	}
+	if len(baseline) < causeMinBaseline {
+		return candidate, false
+	}
+
+	var sum float64
+	for _, value := range baseline {
+		sum += value
+	}
+	mean := sum / float64(len(baseline))
+	var variance float64
+	for _, value := range baseline {
+		variance += (value - mean) * (value - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(baseline)))
+	if stddev == 0 {
+		// Any change from a flat baseline is a deviation; scale it by the
+		// baseline's magnitude so deviations stay comparable
+		stddev = math.Max(math.Abs(mean)*0.01, 1e-9)
+	}
+
+	for _, update := range history {
+		if update.Timestamp.Before(onset) {
+			continue
+		}
+		value, ok := getMetricValue(update.Metrics, name)
+		if !ok {
+			continue
+		}
+		deviation := math.Abs(value-mean) / stddev
+		if deviation >= causeDeviation && candidate.DeviatedAt.IsZero() {
+			candidate.DeviatedAt = update.Timestamp
+		}
+		candidate.Deviation = math.Max(candidate.Deviation, deviation)
+	}
+	return candidate, !candidate.DeviatedAt.IsZero()
+}
+
+// metricCorrelation correlates two metrics over the analyzed history, paired
+// by update
+func metricCorrelation(x, y string, history []MetricUpdate) float64 {
+	if x == y {
+		return 1
+	}
+	var points []ScatterPoint
+	for _, update := range history {
+		xVal, xOk := getMetricValue(update.Metrics, x)
+		yVal, yOk := getMetricValue(update.Metrics, y)
+		if xOk && yOk {
+			points = append(points, ScatterPoint{X: xVal, Y: yVal, Timestamp: update.Timestamp})
+		}
+	}
+	return calculatePearsonCorrelation(points)
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAlertCause(t *testing.T) {
+	server := NewServer(0)
+	start := time.Now().UTC().Add(-time.Hour)
+
+	// The heap starts growing at 30m and response times follow at 32m
+	for i := 0; i <= 80; i++ {
+		at := time.Duration(i) * 30 * time.Second
+		heap, latency := float64(100+i%2), float64(20+i%2)
+		if at >= 30*time.Minute {
+			heap += float64(i-59) * 50
+		}
+		if at >= 32*time.Minute {
+			latency += float64(i-63) * 10
+		}
+		server.historicalMetrics = append(server.historicalMetrics, MetricUpdate{
+			Timestamp: start.Add(at),
+			Metrics:   map[string]interface{}{"heap.alloc": heap, "http.response_time": latency},
+		})
+	}
+	server.alerts = []Alert{
+		{ID: "memory", Rule: "memory", Message: "Heap growing", CreatedAt: start.Add(34 * time.Minute)},
+		{ID: "latency", Rule: "latency", Message: "Slow responses", CreatedAt: start.Add(35 * time.Minute)},
+		{ID: "unrelated", Rule: "latency", Message: "Earlier", CreatedAt: start.Add(10 * time.Minute)},
+	}
+	server.SetRuleMetricsProvider(func(rule string) []string {
+		return map[string][]string{"memory": {"heap.alloc"}, "latency": {"http.response_time"}}[rule]
+	})
+
+	get := func(id string) (*httptest.ResponseRecorder, CauseAnalysis) {
+		request := httptest.NewRequest(http.MethodGet, "/api/alerts/"+id+"/cause", nil)
+		request.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		server.handleAlertCause(rec, request)
+		var response struct {
+			Data CauseAnalysis `json:"data"`
+		}
+		json.NewDecoder(rec.Body).Decode(&response)
+		return rec, response.Data
+	}
+
+	_, analysis := get("latency")
+	if len(analysis.Related) != 2 || len(analysis.Candidates) != 2 || analysis.Candidates[0].Metric != "heap.alloc" {
+		t.Fatalf("expected the heap to rank first among the two alerts, got %+v", analysis)
+	}
+	if !analysis.Candidates[0].DeviatedAt.Equal(start.Add(30*time.Minute)) ||
+		!analysis.Candidates[0].DeviatedAt.Before(analysis.Candidates[1].DeviatedAt) {
+		t.Errorf("unexpected deviation times: %+v", analysis.Candidates)
+	}
+	if cause := analysis.ProbableCause; cause == nil || cause.AlertID != "memory" || cause.Correlation < causeCorrelation {
+		t.Errorf("expected the latency alert to link to the memory alert, got %+v", cause)
+	}
+
+	// The alert reading the first metric to move is the cause itself
+	if _, analysis := get("memory"); analysis.ProbableCause != nil {
+		t.Errorf("expected no probable cause for the root alert, got %+v", analysis.ProbableCause)
+	}
+
+	// Metrics hidden from the role are not ranked
+	server.SetMetricAccessPolicy(&MetricAccessPolicy{
+		Roles:       map[string][]string{"frontend": {"http.*"}},
+		DefaultRole: "frontend",
+	})
+	if _, analysis := get("latency"); len(analysis.Candidates) != 1 || analysis.ProbableCause != nil {
+		t.Errorf("expected only visible metrics to be analyzed, got %+v", analysis)
+	}
+
+	if rec, _ := get("missing"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown alert, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,291 @@
+package dashboard
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/units"
+)
+
+// defaultChartExportWindow is the time range charted when a chart export does
+// not give one
+const defaultChartExportWindow = time.Hour
+
+// Exported chart dimensions in pixels. Each metric gets its own panel.
+const (
+	chartExportWidth       = 800
+	chartExportPanelHeight = 160
+	chartExportPanelGap    = 10
+	chartExportLabelHeight = 18 // room above each SVG panel for its title
+)
+
+// chartExportColors are the line colors of consecutive metrics, matching the
+// dashboard's live charts
+var chartExportColors = []color.RGBA{
+	{0x34, 0x98, 0xdb, 0xff},
+	{0x2e, 0xcc, 0x71, 0xff},
+	{0xe7, 0x4c, 0x3c, 0xff},
+	{0x9b, 0x59, 0xb6, 0xff},
+	{0xe6, 0x7e, 0x22, 0xff},
+	{0x34, 0x49, 0x5e, 0xff},
+}
+
+// chartSeries is one metric's samples across an exported chart's range
+type chartSeries struct {
+	Metric string
+	Points []chartPoint
+	Min    float64
+	Max    float64
+}
+
+type chartPoint struct {
+	Time  time.Time
+	Value float64
+}
+
+// handleChartExport serves /api/charts/export, a server-rendered chart of
+// metric history for reports generated without a browser. Use ?metrics=a,b
+// to choose the metrics, ?from= and ?to= (RFC3339) for the time range, which
+// defaults to the last hour, and ?format=svg or png. Each metric is drawn in
+// its own panel scaled to its range; PNG charts carry no text labels.
+func (s *Server) handleChartExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "svg"
+	}
+	if format != "svg" && format != "png" {
+		http.Error(w, "Format must be svg or png", http.StatusBadRequest)
+		return
+	}
+
+	var metricNames []string
+	for _, name := range strings.Split(query.Get("metrics"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			metricNames = append(metricNames, name)
+		}
+	}
+	if len(metricNames) == 0 {
+		http.Error(w, "At least one metric is required", http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	if value := query.Get("to"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid 'to' time format", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+	from := to.Add(-defaultChartExportWindow)
+	if value := query.Get("from"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, "Invalid 'from' time format", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		http.Error(w, "'from' must be before 'to'", http.StatusBadRequest)
+		return
+	}
+
+	series := s.chartSeries(metricNames, s.resolveRole(r), from, to)
+	if len(series) == 0 {
+		http.Error(w, "No data for the requested metrics", http.StatusNotFound)
+		return
+	}
+
+	filename := "chart-" + from.Format("20060102T150405Z") + "." + format
+	if format == "png" {
+		body, err := renderChartPNG(series, from, to)
+		if err != nil {
+			http.Error(w, "Failed to render chart", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.Write(body)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write([]byte(renderChartSVG(series, from, to, s.getValueFormat())))
+}
+
+// chartSeries collects the history of each metric between from and to.
+// Metrics the role may not view or with no samples are left out.
+func (s *Server) chartSeries(metricNames []string, role string, from, to time.Time) []chartSeries {
+	s.mutex.RLock()
+	var history []MetricUpdate
+	for _, update := range s.metricHistory() {
+		if !update.Timestamp.Before(from) && !update.Timestamp.After(to) {
+			history = append(history, update)
+		}
+	}
+	s.mutex.RUnlock()
+
+	var result []chartSeries
+	for _, name := range metricNames {
+		if !s.canViewMetric(role, name) {
+			continue
+		}
+		series := chartSeries{Metric: name}
+		for _, update := range history {
+			value, ok := getMetricValue(update.Metrics, name)
+			if !ok {
+				continue
+			}
+			if len(series.Points) == 0 || value < series.Min {
+				series.Min = value
+			}
+			if len(series.Points) == 0 || value > series.Max {
+				series.Max = value
+			}
+			series.Points = append(series.Points, chartPoint{update.Timestamp, value})
+		}
+		if len(series.Points) > 0 {
+			result = append(result, series)
+		}
+	}
+	return result
+}
+
+// chartPanelX maps a time to a horizontal position across the chart
+func chartPanelX(t, from, to time.Time) float64 {
+	return float64(chartExportWidth-1) * t.Sub(from).Seconds() / to.Sub(from).Seconds()
+}
+
+// chartPanelY maps a value to a vertical position within a panel spanning
+// top to bottom, centering flat series
+func chartPanelY(v float64, series chartSeries, top, bottom float64) float64 {
+	if series.Max == series.Min {
+		return (top + bottom) / 2
+	}
+	return bottom - (v-series.Min)/(series.Max-series.Min)*(bottom-top)
+}
+
+// renderChartSVG draws each series as a labelled line chart panel, with
+// values shown in the given format
+func renderChartSVG(series []chartSeries, from, to time.Time, format units.Format) string {
+	panel := chartExportLabelHeight + chartExportPanelHeight
+	height := len(series)*(panel+chartExportPanelGap) + chartExportLabelHeight
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" font-family="Arial, sans-serif" font-size="12">`,
+		chartExportWidth, height, chartExportWidth, height)
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="#ffffff"/>`, chartExportWidth, height)
+	for i, s := range series {
+		top := i * (panel + chartExportPanelGap)
+		chartTop := float64(top + chartExportLabelHeight)
+		chartBottom := chartTop + chartExportPanelHeight - 1
+		c := chartExportColors[i%len(chartExportColors)]
+		stroke := fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+
+		fmt.Fprintf(&svg, `<text x="0" y="%d" fill="#2c3e50">%s (min %s, max %s)</text>`,
+			top+chartExportLabelHeight-5, html.EscapeString(s.Metric),
+			html.EscapeString(formatMetricValue(format, s.Metric, s.Min)), html.EscapeString(formatMetricValue(format, s.Metric, s.Max)))
+		fmt.Fprintf(&svg, `<rect x="0.5" y="%.1f" width="%d" height="%d" fill="none" stroke="#dddddd"/>`,
+			chartTop+0.5, chartExportWidth-1, chartExportPanelHeight-1)
+		fmt.Fprintf(&svg, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="`, stroke)
+		for j, p := range s.Points {
+			if j > 0 {
+				svg.WriteString(" ")
+			}
+			fmt.Fprintf(&svg, "%.1f,%.1f", chartPanelX(p.Time, from, to), chartPanelY(p.Value, s, chartTop+2, chartBottom-2))
+		}
+		svg.WriteString(`"/>`)
+	}
+	fmt.Fprintf(&svg, `<text x="0" y="%d" fill="#7f8c8d">%s</text>`, height-5, from.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&svg, `<text x="%d" y="%d" fill="#7f8c8d" text-anchor="end">%s</text>`, chartExportWidth, height-5, to.UTC().Format(time.RFC3339))
+	svg.WriteString(`</svg>`)
+	return svg.String()
+}
+
+// renderChartPNG draws each series as a line chart panel. The standard
+// library has no font rendering, so panels are unlabelled.
+func renderChartPNG(series []chartSeries, from, to time.Time) ([]byte, error) {
+	height := len(series)*(chartExportPanelHeight+chartExportPanelGap) - chartExportPanelGap
+	img := image.NewRGBA(image.Rect(0, 0, chartExportWidth, height))
+	border := color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+
+	for i, s := range series {
+		top := i * (chartExportPanelHeight + chartExportPanelGap)
+		bottom := top + chartExportPanelHeight - 1
+		drawChartLine(img, 0, top, chartExportWidth-1, top, border)
+		drawChartLine(img, 0, bottom, chartExportWidth-1, bottom, border)
+		drawChartLine(img, 0, top, 0, bottom, border)
+		drawChartLine(img, chartExportWidth-1, top, chartExportWidth-1, bottom, border)
+
+		line := chartExportColors[i%len(chartExportColors)]
+		var prevX, prevY int
+		for j, p := range s.Points {
+			x := int(chartPanelX(p.Time, from, to))
+			y := int(chartPanelY(p.Value, s, float64(top+2), float64(bottom-2)))
+			if j > 0 {
+				drawChartLine(img, prevX, prevY, x, y, line)
+			} else {
+				img.Set(x, y, line)
+			}
+			prevX, prevY = x, y
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawChartLine draws a line between two points using Bresenham's algorithm
+func drawChartLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := x1-x0, y0-y1
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy > 0 {
+		dy = -dy
+	}
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
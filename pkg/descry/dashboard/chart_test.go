@@ -0,0 +1,81 @@
+package dashboard
+
+import (
+	"bytes"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/units"
+)
+
+func TestChartExport(t *testing.T) {
+	server := NewServer(0)
+	start := time.Now().UTC().Add(-30 * time.Minute)
+	for i := 0; i < 5; i++ {
+		server.historicalMetrics = append(server.historicalMetrics, MetricUpdate{
+			Timestamp: start.Add(time.Duration(i) * 5 * time.Minute),
+			Metrics:   map[string]interface{}{"heap.alloc": uint64(1000 * (i + 1)), "secret.value": 1.0},
+		})
+	}
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.handleChartExport(rec, httptest.NewRequest(http.MethodGet, "/api/charts/export?"+query, nil))
+		return rec
+	}
+
+	rec := get("metrics=heap.alloc,secret.value")
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/svg+xml" {
+		t.Fatalf("expected an SVG chart, got %d %s: %s", rec.Code, rec.Header().Get("Content-Type"), body)
+	}
+	if !strings.HasPrefix(body, "<svg") || !strings.Contains(body, "heap.alloc (min 1,000 B, max 4.88 KiB)") || !strings.Contains(body, "secret.value") {
+		t.Errorf("expected both metrics charted with their ranges, got: %s", body)
+	}
+	if !strings.Contains(rec.Header().Get("Content-Disposition"), ".svg") {
+		t.Errorf("unexpected Content-Disposition: %s", rec.Header().Get("Content-Disposition"))
+	}
+
+	// Labels follow the configured value format
+	server.SetValueFormat(units.Format{System: units.SI, Precision: 1, Locale: "de"})
+	if body := get("metrics=heap.alloc").Body.String(); !strings.Contains(body, "heap.alloc (min 1,0 kB, max 5,0 kB)") {
+		t.Errorf("expected SI units and German separators, got: %s", body)
+	}
+	server.SetValueFormat(units.Format{})
+
+	rec = get("metrics=heap.alloc&format=png")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("expected a PNG chart, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(bytes.NewReader(rec.Body.Bytes()))
+	if err != nil {
+		t.Fatalf("expected a valid PNG: %v", err)
+	}
+	if img.Bounds().Dx() != chartExportWidth || img.Bounds().Dy() != chartExportPanelHeight {
+		t.Errorf("unexpected PNG size %v", img.Bounds())
+	}
+
+	// Samples outside the range are left out
+	from := start.Add(-2 * time.Hour).Format(time.RFC3339)
+	to := start.Add(-time.Hour).Format(time.RFC3339)
+	if rec := get("metrics=heap.alloc&from=" + from + "&to=" + to); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a range without data, got %d", rec.Code)
+	}
+
+	for _, query := range []string{"", "metrics=heap.alloc&format=gif", "metrics=heap.alloc&from=yesterday", "metrics=heap.alloc&from=" + to + "&to=" + from} {
+		if rec := get(query); rec.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %q, got %d", query, rec.Code)
+		}
+	}
+
+	server.SetMetricAccessPolicy(&MetricAccessPolicy{DefaultRole: "viewer", Roles: map[string][]string{"viewer": {"heap.*"}}})
+	if body := get("metrics=heap.alloc,secret.value").Body.String(); strings.Contains(body, "secret.value") {
+		t.Error("expected metrics hidden from the role to be left out of the chart")
+	}
+	if rec := get("metrics=secret.value"); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 when every metric is hidden, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,95 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/units"
+)
+
+// valueFormatMarker is replaced in the index page with the value format's
+// settings, HTML-escaped for use in an attribute
+const valueFormatMarker = "<!--DESCRY_VALUE_FORMAT-->"
+
+// SetValueFormat sets how values are shown in the dashboard, its chart
+// exports and postmortem reports. The zero Format, the default, uses binary
+// units, two decimal places and English separators.
+func (s *Server) SetValueFormat(format units.Format) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.valueFormat = format
+}
+
+// getValueFormat returns the configured value format
+func (s *Server) getValueFormat() units.Format {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.valueFormat
+}
+
+// formatMetricValue formats a value from the dashboard's metric history by
+// what the metric measures. Durations in the history are in nanoseconds.
+func formatMetricValue(format units.Format, name string, value float64) string {
+	name = defaultHTTPMetricName(name)
+	switch {
+	case strings.HasPrefix(name, "heap.") && name != "heap.objects":
+		return format.Bytes(value)
+	case name == "http.avg_request_size" || name == "http.avg_response_size":
+		return format.Bytes(value)
+	case name == "http.bytes_per_second":
+		return format.Bytes(value) + "/s"
+	case name == "gc.heap_goal":
+		return format.Bytes(value)
+	case name == "gc.pause_p50" || name == "gc.pause_p99" || strings.HasPrefix(name, "sched.latency_"):
+		return format.Duration(time.Duration(value))
+	case name == "gc.pause" || name == "http.response_time" || name == "http.max_response_time" || isResponseTimePercentile(name):
+		return format.Duration(time.Duration(value))
+	case name == "gc.cpu_fraction":
+		return format.Percent(value * 100)
+	case name == "http.error_rate" || strings.HasPrefix(name, "availability{"):
+		return format.Percent(value)
+	default:
+		return format.Number(value)
+	}
+}
+
+// valueFormatAttribute returns the value format's resolved settings as JSON
+// for the index page, which formats values in the browser the same way
+func valueFormatAttribute(format units.Format) string {
+	decimal, group := format.Separators()
+	system := format.System
+	if system == "" {
+		system = units.Binary
+	}
+	settings, _ := json.Marshal(map[string]interface{}{
+		"system":   system,
+		"decimals": format.Decimals(),
+		"decimal":  decimal,
+		"group":    group,
+	})
+	return html.EscapeString(string(settings))
+}
+
+// isResponseTimePercentile reports whether name is one of the HTTP response
+// time percentiles, such as http.p95_response_time
+func isResponseTimePercentile(name string) bool {
+	switch name {
+	case "http.p50_response_time", "http.p90_response_time", "http.p95_response_time", "http.p99_response_time":
+		return true
+	}
+	return false
+}
+
+// defaultHTTPMetricName returns the metric a named HTTP middleware's metric
+// corresponds to, e.g. http.response_time for http.admin.response_time, so
+// both are formatted alike
+func defaultHTTPMetricName(name string) string {
+	if rest, ok := strings.CutPrefix(name, "http."); ok {
+		if server, metric, ok := strings.Cut(rest, "."); ok && server != "segment" {
+			return "http." + metric
+		}
+	}
+	return name
+}
@@ -0,0 +1,340 @@
+package dashboard
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/units"
+)
+
+// incidentMargin is the context included before and after an alert in a
+// postmortem export
+const incidentMargin = 15 * time.Minute
+
+// incidentChart dimensions in pixels
+const (
+	incidentChartWidth  = 600
+	incidentChartHeight = 120
+)
+
+// defaultIncidentMetrics are charted in postmortem exports unless the request
+// lists metrics explicitly
+var defaultIncidentMetrics = []string{
+	"heap.alloc",
+	"heap.inuse",
+	"goroutines.count",
+	"gc.cpu_fraction",
+	"http.request_rate",
+	"http.error_rate",
+	"http.response_time",
+}
+
+// incidentReport is the content of a postmortem export for one alert
+type incidentReport struct {
+	Alert       Alert
+	From        time.Time
+	To          time.Time
+	End         time.Time // when the alert was resolved, or the export time
+	Timeline    []incidentEntry
+	Charts      []incidentChart
+	GeneratedAt time.Time
+}
+
+// incidentEntry is one line of the incident timeline
+type incidentEntry struct {
+	Time    time.Time
+	Kind    string
+	Message string
+}
+
+// incidentChart is a rendered chart of one metric across the incident window
+type incidentChart struct {
+	Metric string
+	Min    float64
+	Max    float64
+	Range  string // Min and Max in the dashboard's value format
+	SVG    string
+}
+
+// handleIncidentExport serves /api/incidents/{id}/export, a self-contained
+// postmortem report for the alert with that ID. The report covers the alert
+// with 15 minutes of context either side and includes charts of key metrics,
+// the alert and event timeline, and any notes. Use ?format=markdown for a
+// Markdown report and ?metrics=a,b to choose the charted metrics.
+func (s *Server) handleIncidentExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "markdown" {
+		http.Error(w, "Format must be html or markdown", http.StatusBadRequest)
+		return
+	}
+
+	metricNames := defaultIncidentMetrics
+	if list := query.Get("metrics"); list != "" {
+		metricNames = strings.Split(list, ",")
+	}
+
+	report, ok := s.incidentReport(r.PathValue("id"), metricNames, s.resolveRole(r), time.Now().UTC())
+	if !ok {
+		http.Error(w, "Alert not found", http.StatusNotFound)
+		return
+	}
+
+	var buf bytes.Buffer
+	filename := "incident-" + report.Alert.ID
+	if format == "markdown" {
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		filename += ".md"
+		writeIncidentMarkdown(&buf, report)
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		filename += ".html"
+		if err := incidentTemplate.Execute(&buf, report); err != nil {
+			http.Error(w, "Failed to render incident report", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(buf.Bytes())
+}
+
+// incidentReport collects the alert, metric history and events for an export.
+// Metrics the role may not view are left out.
+func (s *Server) incidentReport(id string, metricNames []string, role string, now time.Time) (*incidentReport, bool) {
+	s.mutex.RLock()
+	var alert *Alert
+	for i := range s.alerts {
+		if s.alerts[i].ID == id {
+			copied := s.alerts[i]
+			copied.Notes = append([]AlertNote(nil), s.alerts[i].Notes...)
+			alert = &copied
+			break
+		}
+	}
+	if alert == nil {
+		s.mutex.RUnlock()
+		return nil, false
+	}
+
+	end := now
+	if alert.ResolvedAt != nil {
+		end = *alert.ResolvedAt
+	}
+	report := &incidentReport{
+		Alert:       *alert,
+		From:        alert.CreatedAt.Add(-incidentMargin),
+		To:          end.Add(incidentMargin),
+		End:         end,
+		GeneratedAt: now,
+	}
+	if report.To.After(now) {
+		report.To = now
+	}
+
+	var history []MetricUpdate
+	for _, update := range s.metricHistory() {
+		if !update.Timestamp.Before(report.From) && !update.Timestamp.After(report.To) {
+			history = append(history, update)
+		}
+	}
+	for _, event := range s.historicalEvents {
+		if !event.Timestamp.Before(report.From) && !event.Timestamp.After(report.To) {
+			report.Timeline = append(report.Timeline, incidentEntry{
+				Time:    event.Timestamp,
+				Kind:    event.Type,
+				Message: event.Message,
+			})
+		}
+	}
+	s.mutex.RUnlock()
+
+	report.Timeline = append(report.Timeline, incidentEntry{
+		Time: alert.CreatedAt, Kind: "alert", Message: fmt.Sprintf("[%s] %s", alert.Severity, alert.Message),
+	})
+	for _, note := range alert.Notes {
+		author := note.Author
+		if author == "" {
+			author = "unknown"
+		}
+		report.Timeline = append(report.Timeline, incidentEntry{
+			Time: note.CreatedAt, Kind: "note", Message: author + ": " + note.Message,
+		})
+	}
+	if alert.ResolvedAt != nil {
+		report.Timeline = append(report.Timeline, incidentEntry{Time: *alert.ResolvedAt, Kind: "resolved", Message: "Alert resolved"})
+	}
+	sort.SliceStable(report.Timeline, func(i, j int) bool {
+		return report.Timeline[i].Time.Before(report.Timeline[j].Time)
+	})
+
+	for _, name := range metricNames {
+		name = strings.TrimSpace(name)
+		if name == "" || !s.canViewMetric(role, name) {
+			continue
+		}
+		if chart, ok := buildIncidentChart(name, history, report, s.getValueFormat()); ok {
+			report.Charts = append(report.Charts, chart)
+		}
+	}
+
+	return report, true
+}
+
+// buildIncidentChart renders a metric's history as an SVG line chart with the
+// alert's active period shaded. Metrics with no samples are skipped.
+func buildIncidentChart(name string, history []MetricUpdate, report *incidentReport, format units.Format) (incidentChart, bool) {
+	type point struct {
+		t time.Time
+		v float64
+	}
+	var points []point
+	for _, update := range history {
+		if value, ok := getMetricValue(update.Metrics, name); ok {
+			points = append(points, point{update.Timestamp, value})
+		}
+	}
+	if len(points) == 0 {
+		return incidentChart{}, false
+	}
+
+	chart := incidentChart{Metric: name, Min: points[0].v, Max: points[0].v}
+	for _, p := range points {
+		if p.v < chart.Min {
+			chart.Min = p.v
+		}
+		if p.v > chart.Max {
+			chart.Max = p.v
+		}
+	}
+	chart.Range = "min " + formatMetricValue(format, name, chart.Min) + ", max " + formatMetricValue(format, name, chart.Max)
+
+	span := report.To.Sub(report.From).Seconds()
+	x := func(t time.Time) float64 {
+		if span <= 0 {
+			return 0
+		}
+		return incidentChartWidth * t.Sub(report.From).Seconds() / span
+	}
+	y := func(v float64) float64 {
+		if chart.Max == chart.Min {
+			return incidentChartHeight / 2
+		}
+		return incidentChartHeight * (1 - (v-chart.Min)/(chart.Max-chart.Min))
+	}
+
+	var svg strings.Builder
+	fmt.Fprintf(&svg, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" role="img" aria-label="%s">`,
+		incidentChartWidth, incidentChartHeight, incidentChartWidth, incidentChartHeight, html.EscapeString(name))
+	fmt.Fprintf(&svg, `<rect width="%d" height="%d" fill="#ffffff" stroke="#dddddd"/>`, incidentChartWidth, incidentChartHeight)
+	start, end := x(report.Alert.CreatedAt), x(report.End)
+	if end > start {
+		fmt.Fprintf(&svg, `<rect x="%.1f" y="0" width="%.1f" height="%d" fill="#e74c3c" fill-opacity="0.15"/>`, start, end-start, incidentChartHeight)
+	}
+	svg.WriteString(`<polyline fill="none" stroke="#3498db" stroke-width="1.5" points="`)
+	for i, p := range points {
+		if i > 0 {
+			svg.WriteString(" ")
+		}
+		fmt.Fprintf(&svg, "%.1f,%.1f", x(p.t), y(p.v))
+	}
+	svg.WriteString(`"/></svg>`)
+	chart.SVG = svg.String()
+
+	return chart, true
+}
+
+// writeIncidentMarkdown renders a report as Markdown. Charts are embedded as
+// data URIs so the file has no external dependencies.
+func writeIncidentMarkdown(buf *bytes.Buffer, report *incidentReport) {
+	alert := report.Alert
+	fmt.Fprintf(buf, "# Incident: %s\n\n", alert.Message)
+	fmt.Fprintf(buf, "- **Rule:** %s\n", alert.Rule)
+	fmt.Fprintf(buf, "- **Severity:** %s\n", alert.Severity)
+	fmt.Fprintf(buf, "- **Status:** %s\n", alert.Status)
+	fmt.Fprintf(buf, "- **Started:** %s\n", alert.CreatedAt.Format(time.RFC3339))
+	if alert.ResolvedAt != nil {
+		fmt.Fprintf(buf, "- **Resolved:** %s\n", alert.ResolvedAt.Format(time.RFC3339))
+		fmt.Fprintf(buf, "- **Duration:** %s\n", alert.ResolvedAt.Sub(alert.CreatedAt).Round(time.Second))
+	}
+	if alert.AcknowledgedBy != nil {
+		fmt.Fprintf(buf, "- **Acknowledged by:** %s\n", *alert.AcknowledgedBy)
+	}
+	fmt.Fprintf(buf, "- **Window:** %s to %s\n\n", report.From.Format(time.RFC3339), report.To.Format(time.RFC3339))
+
+	buf.WriteString("## Metrics\n\n")
+	if len(report.Charts) == 0 {
+		buf.WriteString("No metric history was recorded for this window.\n\n")
+	}
+	for _, chart := range report.Charts {
+		fmt.Fprintf(buf, "### %s\n\n%s\n\n", chart.Metric, chart.Range)
+		fmt.Fprintf(buf, "![%s](data:image/svg+xml;base64,%s)\n\n", chart.Metric, base64.StdEncoding.EncodeToString([]byte(chart.SVG)))
+	}
+
+	buf.WriteString("## Timeline\n\n")
+	for _, entry := range report.Timeline {
+		fmt.Fprintf(buf, "- `%s` **%s** %s\n", entry.Time.Format("2006-01-02 15:04:05"), entry.Kind, entry.Message)
+	}
+
+	fmt.Fprintf(buf, "\n_Generated %s_\n", report.GeneratedAt.Format(time.RFC3339))
+}
+
+// incidentTemplate renders a report as a standalone HTML page with inline SVG
+// charts and no scripts or external resources
+var incidentTemplate = template.Must(template.New("incident").Funcs(template.FuncMap{
+	"svg":      func(markup string) template.HTML { return template.HTML(markup) },
+	"duration": func(from, to time.Time) string { return to.Sub(from).Round(time.Second).String() },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Incident: {{.Alert.Message}}</title>
+    <style>
+        body { font-family: Arial, sans-serif; margin: 0 auto; padding: 20px; max-width: 800px; color: #2c3e50; }
+        .label { color: #7f8c8d; }
+        .chart { margin-bottom: 20px; }
+        .timeline td { padding: 4px 10px 4px 0; vertical-align: top; }
+        .kind { font-weight: bold; }
+    </style>
+</head>
+<body>
+    <h1>Incident: {{.Alert.Message}}</h1>
+    <p><span class="label">Rule:</span> {{.Alert.Rule}}<br>
+    <span class="label">Severity:</span> {{.Alert.Severity}}<br>
+    <span class="label">Status:</span> {{.Alert.Status}}<br>
+    <span class="label">Started:</span> {{.Alert.CreatedAt.Format "2006-01-02 15:04:05 MST"}}<br>
+    {{with .Alert.ResolvedAt}}<span class="label">Resolved:</span> {{.Format "2006-01-02 15:04:05 MST"}} ({{duration $.Alert.CreatedAt .}})<br>{{end}}
+    {{with .Alert.AcknowledgedBy}}<span class="label">Acknowledged by:</span> {{.}}<br>{{end}}
+    <span class="label">Window:</span> {{.From.Format "15:04:05"}} to {{.To.Format "15:04:05"}}</p>
+
+    <h2>Metrics</h2>
+    {{range .Charts}}<div class="chart">
+        <h3>{{.Metric}}</h3>
+        <div class="label">{{.Range}}</div>
+        {{svg .SVG}}
+    </div>
+    {{else}}<p>No metric history was recorded for this window.</p>{{end}}
+
+    <h2>Timeline</h2>
+    <table class="timeline">
+        {{range .Timeline}}<tr><td>{{.Time.Format "2006-01-02 15:04:05"}}</td><td class="kind">{{.Kind}}</td><td>{{.Message}}</td></tr>
+        {{end}}
+    </table>
+
+    <p class="label">Generated {{.GeneratedAt.Format "2006-01-02 15:04:05 MST"}}</p>
+</body>
+</html>`))
@@ -0,0 +1,75 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncidentExport(t *testing.T) {
+	server := NewServer(0)
+	now := time.Now()
+	start := now.Add(-time.Hour)
+	resolvedAt := start.Add(10 * time.Minute)
+	server.alerts = []Alert{{
+		ID: "a1", Rule: "heap_growth", Message: "Heap <growing>", Severity: AlertSeverityCritical,
+		Status: AlertStatusResolved, CreatedAt: start, ResolvedAt: &resolvedAt,
+		Notes: []AlertNote{{Message: "Rolled back deploy", Author: "oncall", CreatedAt: start.Add(5 * time.Minute)}},
+	}}
+	for i := 0; i < 5; i++ {
+		server.historicalMetrics = append(server.historicalMetrics, MetricUpdate{
+			Timestamp: start.Add(time.Duration(i) * 5 * time.Minute),
+			Metrics:   map[string]interface{}{"heap.alloc": uint64(1000 * (i + 1)), "secret.value": 1.0},
+		})
+	}
+	server.historicalEvents = []EventUpdate{
+		{Timestamp: start.Add(time.Minute), Type: "rule_trigger", Message: "heap_growth triggered"},
+		{Timestamp: start.Add(-2 * time.Hour), Type: "rule_trigger", Message: "old event"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/incidents/{id}/export", server.handleIncidentExport)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/incidents/a1/export", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, body)
+	}
+	for _, want := range []string{"Heap &lt;growing&gt;", "<svg", "heap.alloc", "Rolled back deploy", "heap_growth triggered"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected HTML export to contain %q", want)
+		}
+	}
+	if strings.Contains(body, "old event") || strings.Contains(body, "<script") {
+		t.Error("expected HTML export to omit events outside the window and scripts")
+	}
+	if !strings.Contains(rec.Header().Get("Content-Disposition"), "incident-a1.html") {
+		t.Errorf("unexpected Content-Disposition: %s", rec.Header().Get("Content-Disposition"))
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/incidents/a1/export?format=markdown&metrics=heap.alloc,secret.value", nil))
+	body = rec.Body.String()
+	if !strings.Contains(body, "# Incident: Heap <growing>") || !strings.Contains(body, "data:image/svg+xml;base64,") {
+		t.Errorf("expected Markdown export with embedded chart, got: %s", body)
+	}
+	if !strings.Contains(body, "### secret.value") {
+		t.Error("expected requested metric to be charted without an access policy")
+	}
+
+	server.SetMetricAccessPolicy(&MetricAccessPolicy{DefaultRole: "viewer", Roles: map[string][]string{"viewer": {"heap.*"}}})
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/incidents/a1/export?format=markdown&metrics=heap.alloc,secret.value", nil))
+	if strings.Contains(rec.Body.String(), "secret.value") {
+		t.Error("expected metrics hidden from the role to be left out of the export")
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/incidents/missing/export", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown alert, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,35 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAlertLabels(t *testing.T) {
+	server := NewServer(0)
+	server.SendEventUpdate("alert", "orders backing up", "backlog",
+		map[string]interface{}{"severity": "high", "labels": map[string]string{"team": "payments"}})
+	server.SendEventUpdate("alert", "slow search", "search", nil)
+
+	list := func(query string) (int, []Alert) {
+		rec := httptest.NewRecorder()
+		server.handleAlerts(rec, httptest.NewRequest(http.MethodGet, "/api/alerts"+query, nil))
+		var response struct {
+			Data []Alert `json:"data"`
+		}
+		json.NewDecoder(rec.Body).Decode(&response)
+		return rec.Code, response.Data
+	}
+
+	if _, alerts := list("?label=team=payments"); len(alerts) != 1 || alerts[0].Labels["team"] != "payments" {
+		t.Errorf("expected only the payments alert, got %+v", alerts)
+	}
+	if _, alerts := list(""); len(alerts) != 2 {
+		t.Errorf("expected every alert without a filter, got %d", len(alerts))
+	}
+	if code, _ := list("?label=team"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a malformed label filter, got %d", code)
+	}
+}
@@ -0,0 +1,68 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SetProfileProvider connects the /api/profiles endpoints to the pprof
+// profiles captured by rules, which back the Profiles card. getProfile
+// returns a profile's data and a filename to save it under.
+func (s *Server) SetProfileProvider(getProfiles func() interface{}, getProfile func(id string) ([]byte, string, bool)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.getProfiles = getProfiles
+	s.getProfile = getProfile
+}
+
+// handleProfiles lists the captured profiles, newest first, an empty list
+// when there are none
+func (s *Server) handleProfiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	getProfiles := s.getProfiles
+	s.mutex.RUnlock()
+
+	var profiles interface{} = []interface{}{}
+	if getProfiles != nil {
+		profiles = getProfiles()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   profiles,
+	})
+}
+
+// handleProfileDownload serves /api/profiles/{id}, a captured profile in the
+// gzipped protobuf format read by go tool pprof
+func (s *Server) handleProfileDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	getProfile := s.getProfile
+	s.mutex.RUnlock()
+
+	if getProfile == nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+	data, filename, ok := getProfile(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(data)
+}
@@ -0,0 +1,933 @@
+package dashboard
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// promLookback is how far back an instant selector looks for a sample
+	promLookback = 5 * time.Minute
+	// maxQuerySteps bounds the evaluation steps of one range query
+	maxQuerySteps = 11000
+)
+
+// PromQL is a QueryLanguage for a subset of PromQL, for users who think in
+// Prometheus queries. It is not enabled by default:
+//
+//	engine.GetDashboard().SetQueryLanguage(dashboard.PromQL{})
+//
+// Metrics are selected by their Prometheus-style names, with dots replaced by
+// underscores (heap_alloc, custom_orders_total), or by their Descry names
+// (heap.alloc). Labels come from metrics stored with them, such as
+// availability{rule="memory_leak"}. The subset covers:
+//
+//   - instant and range selectors with =, !=, =~ and !~ label matchers
+//   - rate, irate, increase, delta and the avg, min, max, sum, count and last
+//     _over_time functions on range selectors, extrapolating as Prometheus
+//     does; abs, ceil, floor and sqrt
+//   - sum, avg, min, max and count aggregations, with by or without
+//   - the arithmetic operators + - * / % and the comparison operators
+//     == != > < >= <=, between vectors with the same labels or with scalars
+//
+// Values are those stored in the dashboard history, so durations such as
+// http_response_time are in nanoseconds.
+type PromQL struct{}
+
+// Name returns "PromQL"
+func (PromQL) Name() string {
+	return "PromQL"
+}
+
+// Query evaluates query at each step from start to end
+func (PromQL) Query(query string, history []MetricUpdate, start, end time.Time, step time.Duration) ([]QuerySeries, error) {
+	expr, err := parsePromQL(query)
+	if err != nil {
+		return nil, err
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("query step must be positive")
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("query end is before its start")
+	}
+	if end.Sub(start)/step >= maxQuerySteps {
+		return nil, fmt.Errorf("query of %v in steps of %v exceeds %d steps", end.Sub(start), step, maxQuerySteps)
+	}
+
+	store := newPromStore(history)
+	series := make(map[string]*QuerySeries)
+	var keys []string
+	for t := start; !t.After(end); t = t.Add(step) {
+		result, err := store.eval(expr, t)
+		if err != nil {
+			return nil, err
+		}
+		if result.scalar {
+			result.samples = []promSample{{value: result.value}}
+		}
+		for _, sample := range result.samples {
+			if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+				continue
+			}
+			key := promSeriesKey(sample.name, sample.labels)
+			if series[key] == nil {
+				series[key] = &QuerySeries{Metric: sample.name, Labels: sample.labels}
+				keys = append(keys, key)
+			}
+			series[key].Points = append(series[key].Points, QueryPoint{Timestamp: t, Value: sample.value})
+		}
+	}
+
+	sort.Strings(keys)
+	result := make([]QuerySeries, len(keys))
+	for i, key := range keys {
+		result[i] = *series[key]
+	}
+	return result, nil
+}
+
+// AST
+
+type promNode interface{}
+
+type promNumber struct {
+	value float64
+}
+
+type promSelector struct {
+	name     string
+	matchers []promMatcher
+	window   time.Duration // set for range selectors
+}
+
+type promMatcher struct {
+	label string
+	op    string
+	value string
+	re    *regexp.Regexp // for =~ and !~
+}
+
+func (m promMatcher) matches(value string) bool {
+	switch m.op {
+	case "=":
+		return value == m.value
+	case "!=":
+		return value != m.value
+	case "=~":
+		return m.re.MatchString(value)
+	default:
+		return !m.re.MatchString(value)
+	}
+}
+
+type promCall struct {
+	fn  string
+	arg promNode
+}
+
+type promAggregate struct {
+	op       string
+	grouping []string
+	without  bool
+	expr     promNode
+}
+
+type promBinary struct {
+	op       string
+	lhs, rhs promNode
+}
+
+// Lexer
+
+type promToken struct {
+	kind string // "ident", "number", "duration", "string", "op" or "eof"
+	text string
+	pos  int
+}
+
+var promOperators = []string{"==", "!=", "=~", "!~", ">=", "<=", ">", "<", "=", "+", "-", "*", "/", "%", "(", ")", "{", "}", "[", "]", ","}
+
+func lexPromQL(query string) ([]promToken, error) {
+	var tokens []promToken
+	for i := 0; i < len(query); {
+		c := rune(query[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '_' || c == ':' || unicode.IsLetter(c):
+			start := i
+			for i < len(query) && (query[i] == '_' || query[i] == ':' || query[i] == '.' ||
+				unicode.IsLetter(rune(query[i])) || unicode.IsDigit(rune(query[i]))) {
+				i++
+			}
+			tokens = append(tokens, promToken{kind: "ident", text: query[start:i], pos: start})
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(query) && unicode.IsDigit(rune(query[i+1]))):
+			start := i
+			for i < len(query) && (unicode.IsDigit(rune(query[i])) || query[i] == '.') {
+				i++
+			}
+			if i < len(query) && (query[i] == 'e' || query[i] == 'E') && i+1 < len(query) &&
+				(unicode.IsDigit(rune(query[i+1])) || query[i+1] == '-' || query[i+1] == '+') {
+				i += 2
+				for i < len(query) && unicode.IsDigit(rune(query[i])) {
+					i++
+				}
+			}
+			kind := "number"
+			// Durations such as 5m or 1h30m
+			for i < len(query) && unicode.IsLetter(rune(query[i])) {
+				kind = "duration"
+				for i < len(query) && (unicode.IsLetter(rune(query[i])) || unicode.IsDigit(rune(query[i]))) {
+					i++
+				}
+			}
+			tokens = append(tokens, promToken{kind: kind, text: query[start:i], pos: start})
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			for i < len(query) && rune(query[i]) != c {
+				if query[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i >= len(query) {
+				return nil, fmt.Errorf("unterminated string at position %d", start)
+			}
+			i++
+			text := query[start:i]
+			if c == '\'' {
+				text = `"` + strings.ReplaceAll(text[1:len(text)-1], `"`, `\"`) + `"`
+			}
+			value, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d", start)
+			}
+			tokens = append(tokens, promToken{kind: "string", text: value, pos: start})
+		default:
+			matched := false
+			for _, op := range promOperators {
+				if strings.HasPrefix(query[i:], op) {
+					tokens = append(tokens, promToken{kind: "op", text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character %q at position %d", c, i)
+			}
+		}
+	}
+	return append(tokens, promToken{kind: "eof", pos: len(query)}), nil
+}
+
+// Parser
+
+var (
+	promAggregations   = map[string]bool{"sum": true, "avg": true, "min": true, "max": true, "count": true}
+	promRangeFunctions = map[string]bool{
+		"rate": true, "irate": true, "increase": true, "delta": true,
+		"avg_over_time": true, "min_over_time": true, "max_over_time": true,
+		"sum_over_time": true, "count_over_time": true, "last_over_time": true,
+	}
+	promMathFunctions = map[string]func(float64) float64{
+		"abs": math.Abs, "ceil": math.Ceil, "floor": math.Floor, "sqrt": math.Sqrt,
+	}
+	promPrecedence = map[string]int{
+		"==": 1, "!=": 1, ">": 1, "<": 1, ">=": 1, "<=": 1,
+		"+": 2, "-": 2,
+		"*": 3, "/": 3, "%": 3,
+	}
+)
+
+type promParser struct {
+	tokens []promToken
+	pos    int
+}
+
+func parsePromQL(query string) (promNode, error) {
+	tokens, err := lexPromQL(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &promParser{tokens: tokens}
+	expr, err := p.parseExpr(1)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != "eof" {
+		return nil, p.errorf(tok, "unexpected %q", tok.text)
+	}
+	return expr, nil
+}
+
+func (p *promParser) peek() promToken {
+	return p.tokens[p.pos]
+}
+
+func (p *promParser) next() promToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != "eof" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *promParser) errorf(tok promToken, format string, args ...interface{}) error {
+	return fmt.Errorf("parse error at position %d: %s", tok.pos, fmt.Sprintf(format, args...))
+}
+
+// expect consumes the operator op
+func (p *promParser) expect(op string) error {
+	if tok := p.next(); tok.kind != "op" || tok.text != op {
+		if tok.kind == "eof" {
+			return p.errorf(tok, "expected %q, got end of query", op)
+		}
+		return p.errorf(tok, "expected %q, got %q", op, tok.text)
+	}
+	return nil
+}
+
+// parseExpr parses binary expressions whose operators bind at least as
+// tightly as minPrecedence; all operators are left-associative
+func (p *promParser) parseExpr(minPrecedence int) (promNode, error) {
+	lhs, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		precedence := promPrecedence[tok.text]
+		if tok.kind != "op" || precedence == 0 || precedence < minPrecedence {
+			return lhs, nil
+		}
+		p.next()
+		rhs, err := p.parseExpr(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		lhs = &promBinary{op: tok.text, lhs: lhs, rhs: rhs}
+	}
+}
+
+func (p *promParser) parseUnary() (promNode, error) {
+	if tok := p.peek(); tok.kind == "op" && (tok.text == "-" || tok.text == "+") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil || tok.text == "+" {
+			return operand, err
+		}
+		return &promBinary{op: "*", lhs: &promNumber{value: -1}, rhs: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *promParser) parsePrimary() (promNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case "number":
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf(tok, "invalid number %q", tok.text)
+		}
+		return &promNumber{value: value}, nil
+	case "op":
+		if tok.text == "(" {
+			expr, err := p.parseExpr(1)
+			if err != nil {
+				return nil, err
+			}
+			return expr, p.expect(")")
+		}
+	case "ident":
+		next := p.peek()
+		if promAggregations[tok.text] && (next.text == "(" || next.text == "by" || next.text == "without") {
+			return p.parseAggregate(tok.text)
+		}
+		if next.kind == "op" && next.text == "(" {
+			return p.parseCall(tok)
+		}
+		return p.parseSelector(tok.text)
+	case "eof":
+		return nil, p.errorf(tok, "unexpected end of query")
+	}
+	return nil, p.errorf(tok, "unexpected %q", tok.text)
+}
+
+// parseAggregate parses sum(x), sum by (a) (x) or sum(x) without (a)
+func (p *promParser) parseAggregate(op string) (promNode, error) {
+	agg := &promAggregate{op: op}
+	if err := p.parseGrouping(agg); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseExpr(1)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	agg.expr = expr
+	if agg.grouping == nil && !agg.without {
+		if err := p.parseGrouping(agg); err != nil {
+			return nil, err
+		}
+	}
+	return agg, nil
+}
+
+// parseGrouping parses an optional by or without clause
+func (p *promParser) parseGrouping(agg *promAggregate) error {
+	tok := p.peek()
+	if tok.kind != "ident" || (tok.text != "by" && tok.text != "without") {
+		return nil
+	}
+	p.next()
+	agg.without = tok.text == "without"
+	agg.grouping = []string{}
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for p.peek().text != ")" {
+		label := p.next()
+		if label.kind != "ident" {
+			return p.errorf(label, "expected a label name, got %q", label.text)
+		}
+		agg.grouping = append(agg.grouping, label.text)
+		if p.peek().text == "," {
+			p.next()
+		}
+	}
+	return p.expect(")")
+}
+
+func (p *promParser) parseCall(fn promToken) (promNode, error) {
+	if !promRangeFunctions[fn.text] && promMathFunctions[fn.text] == nil {
+		return nil, p.errorf(fn, "unsupported function %s", fn.text)
+	}
+	p.next() // (
+	arg, err := p.parseExpr(1)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if selector, ok := arg.(*promSelector); promRangeFunctions[fn.text] && (!ok || selector.window == 0) {
+		return nil, p.errorf(fn, "%s expects a range selector such as metric[5m]", fn.text)
+	}
+	return &promCall{fn: fn.text, arg: arg}, nil
+}
+
+// parseSelector parses the label matchers and range of a selector
+func (p *promParser) parseSelector(name string) (promNode, error) {
+	selector := &promSelector{name: name}
+	if p.peek().text == "{" {
+		p.next()
+		for p.peek().text != "}" {
+			label := p.next()
+			if label.kind != "ident" {
+				return nil, p.errorf(label, "expected a label name, got %q", label.text)
+			}
+			op := p.next()
+			if op.kind != "op" || (op.text != "=" && op.text != "!=" && op.text != "=~" && op.text != "!~") {
+				return nil, p.errorf(op, "expected a label matcher (=, !=, =~ or !~), got %q", op.text)
+			}
+			value := p.next()
+			if value.kind != "string" {
+				return nil, p.errorf(value, "expected a quoted label value, got %q", value.text)
+			}
+			matcher := promMatcher{label: label.text, op: op.text, value: value.text}
+			if op.text == "=~" || op.text == "!~" {
+				re, err := regexp.Compile("^(?:" + value.text + ")$")
+				if err != nil {
+					return nil, p.errorf(value, "invalid regular expression: %v", err)
+				}
+				matcher.re = re
+			}
+			selector.matchers = append(selector.matchers, matcher)
+			if p.peek().text == "," {
+				p.next()
+			}
+		}
+		p.next()
+	}
+	if p.peek().text == "[" {
+		p.next()
+		window := p.next()
+		if window.kind != "duration" {
+			return nil, p.errorf(window, "expected a duration such as 5m, got %q", window.text)
+		}
+		duration, err := parsePromDuration(window.text)
+		if err != nil {
+			return nil, p.errorf(window, "%v", err)
+		}
+		selector.window = duration
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+	return selector, nil
+}
+
+// parsePromDuration parses Prometheus durations such as 30s, 5m and 1h30m
+func parsePromDuration(text string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"ms": time.Millisecond, "s": time.Second, "m": time.Minute, "h": time.Hour,
+		"d": 24 * time.Hour, "w": 7 * 24 * time.Hour, "y": 365 * 24 * time.Hour,
+	}
+	var total time.Duration
+	for rest := text; rest != ""; {
+		digits := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsDigit(r) })
+		if digits <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", text)
+		}
+		unitEnd := strings.IndexFunc(rest[digits:], unicode.IsDigit)
+		if unitEnd < 0 {
+			unitEnd = len(rest) - digits
+		}
+		value, _ := strconv.Atoi(rest[:digits])
+		unit, ok := units[rest[digits:digits+unitEnd]]
+		if !ok {
+			return 0, fmt.Errorf("invalid duration %q", text)
+		}
+		total += time.Duration(value) * unit
+		rest = rest[digits+unitEnd:]
+	}
+	if total <= 0 {
+		return 0, fmt.Errorf("duration %q must be positive", text)
+	}
+	return total, nil
+}
+
+// Evaluation
+
+type promSample struct {
+	name   string // empty once an operation has changed the value's meaning
+	labels map[string]string
+	value  float64
+}
+
+type promResult struct {
+	scalar  bool
+	value   float64
+	samples []promSample
+}
+
+type promSeries struct {
+	name   string
+	labels map[string]string
+	points []QueryPoint
+}
+
+// promStore indexes the dashboard history by series
+type promStore struct {
+	series []*promSeries
+}
+
+func newPromStore(history []MetricUpdate) *promStore {
+	store := &promStore{}
+	byKey := make(map[string]*promSeries)
+	for _, update := range history {
+		for key := range update.Metrics {
+			value, ok := getMetricValue(update.Metrics, key)
+			if !ok {
+				continue
+			}
+			series := byKey[key]
+			if series == nil {
+				name, labels := splitMetricLabels(key)
+				series = &promSeries{name: name, labels: labels}
+				byKey[key] = series
+				store.series = append(store.series, series)
+			}
+			series.points = append(series.points, QueryPoint{Timestamp: update.Timestamp, Value: value})
+		}
+	}
+	for _, series := range store.series {
+		sort.SliceStable(series.points, func(i, j int) bool { return series.points[i].Timestamp.Before(series.points[j].Timestamp) })
+	}
+	return store
+}
+
+// splitMetricLabels splits a stored metric key such as
+// availability{rule=memory_leak} into its name and labels
+func splitMetricLabels(key string) (string, map[string]string) {
+	open := strings.Index(key, "{")
+	if open < 0 || !strings.HasSuffix(key, "}") {
+		return key, map[string]string{}
+	}
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(key[open+1:len(key)-1], ",") {
+		if name, value, ok := strings.Cut(pair, "="); ok {
+			labels[strings.TrimSpace(name)] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return key[:open], labels
+}
+
+// promMetricName returns the Prometheus form of a Descry metric name
+func promMetricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+func (s *promStore) matching(selector *promSelector) []*promSeries {
+	var matched []*promSeries
+	for _, series := range s.series {
+		if series.name != selector.name && promMetricName(series.name) != selector.name {
+			continue
+		}
+		ok := true
+		for _, matcher := range selector.matchers {
+			if !matcher.matches(series.labels[matcher.label]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			matched = append(matched, series)
+		}
+	}
+	return matched
+}
+
+// window returns a series' points in (t-window, t]
+func (series *promSeries) window(t time.Time, window time.Duration) []QueryPoint {
+	from := sort.Search(len(series.points), func(i int) bool { return series.points[i].Timestamp.After(t.Add(-window)) })
+	to := sort.Search(len(series.points), func(i int) bool { return series.points[i].Timestamp.After(t) })
+	return series.points[from:to]
+}
+
+func (s *promStore) eval(node promNode, t time.Time) (promResult, error) {
+	switch n := node.(type) {
+	case *promNumber:
+		return promResult{scalar: true, value: n.value}, nil
+
+	case *promSelector:
+		if n.window > 0 {
+			return promResult{}, fmt.Errorf("range selector %s[%v] must be used in a function such as rate()", n.name, n.window)
+		}
+		var result promResult
+		for _, series := range s.matching(n) {
+			if points := series.window(t, promLookback); len(points) > 0 {
+				result.samples = append(result.samples, promSample{name: series.name, labels: series.labels, value: points[len(points)-1].Value})
+			}
+		}
+		return result, nil
+
+	case *promCall:
+		if fn := promMathFunctions[n.fn]; fn != nil {
+			arg, err := s.eval(n.arg, t)
+			if err != nil {
+				return promResult{}, err
+			}
+			if arg.scalar {
+				return promResult{scalar: true, value: fn(arg.value)}, nil
+			}
+			var result promResult
+			for _, sample := range arg.samples {
+				result.samples = append(result.samples, promSample{labels: sample.labels, value: fn(sample.value)})
+			}
+			return result, nil
+		}
+		selector := n.arg.(*promSelector)
+		var result promResult
+		for _, series := range s.matching(selector) {
+			if value, ok := promRangeFunction(n.fn, series.window(t, selector.window), t, selector.window); ok {
+				result.samples = append(result.samples, promSample{labels: series.labels, value: value})
+			}
+		}
+		return result, nil
+
+	case *promAggregate:
+		arg, err := s.eval(n.expr, t)
+		if err != nil {
+			return promResult{}, err
+		}
+		if arg.scalar {
+			return promResult{}, fmt.Errorf("%s expects a vector, got a scalar", n.op)
+		}
+		return promAggregateSamples(n, arg.samples), nil
+
+	case *promBinary:
+		lhs, err := s.eval(n.lhs, t)
+		if err != nil {
+			return promResult{}, err
+		}
+		rhs, err := s.eval(n.rhs, t)
+		if err != nil {
+			return promResult{}, err
+		}
+		return promBinaryOp(n.op, lhs, rhs)
+	}
+	return promResult{}, fmt.Errorf("unsupported expression")
+}
+
+// promRangeFunction applies a range function to the points of one series
+// in the window ending at t
+func promRangeFunction(fn string, points []QueryPoint, t time.Time, window time.Duration) (float64, bool) {
+	if len(points) == 0 {
+		return 0, false
+	}
+	values := make([]float64, len(points))
+	for i, point := range points {
+		values[i] = point.Value
+	}
+	last := values[len(values)-1]
+
+	switch fn {
+	case "rate", "increase", "delta":
+		if len(values) < 2 {
+			return 0, false
+		}
+		result := last - values[0]
+		if fn != "delta" {
+			// Counters that drop have been reset and count again from zero
+			result = 0
+			for i := 1; i < len(values); i++ {
+				if delta := values[i] - values[i-1]; delta >= 0 {
+					result += delta
+				} else {
+					result += values[i]
+				}
+			}
+		}
+		result = promExtrapolate(result, points, t, window, fn != "delta")
+		if fn == "rate" {
+			return result / window.Seconds(), true
+		}
+		return result, true
+	case "irate":
+		if len(values) < 2 {
+			return 0, false
+		}
+		previous := values[len(values)-2]
+		elapsed := points[len(points)-1].Timestamp.Sub(points[len(points)-2].Timestamp).Seconds()
+		if elapsed <= 0 {
+			return 0, false
+		}
+		if last < previous {
+			return last / elapsed, true
+		}
+		return (last - previous) / elapsed, true
+	case "last_over_time":
+		return last, true
+	case "count_over_time":
+		return float64(len(values)), true
+	}
+
+	sum, min, max := 0.0, values[0], values[0]
+	for _, value := range values {
+		sum += value
+		min = math.Min(min, value)
+		max = math.Max(max, value)
+	}
+	switch fn {
+	case "avg_over_time":
+		return sum / float64(len(values)), true
+	case "min_over_time":
+		return min, true
+	case "max_over_time":
+		return max, true
+	default: // sum_over_time
+		return sum, true
+	}
+}
+
+// promExtrapolate scales a change between the first and last samples to the
+// whole window, as Prometheus does: up to the window's edges when the samples
+// reach near them, else by half a sample interval, and for counters never to
+// before they would have been zero
+func promExtrapolate(change float64, points []QueryPoint, t time.Time, window time.Duration, counter bool) float64 {
+	first, last := points[0], points[len(points)-1]
+	sampled := last.Timestamp.Sub(first.Timestamp).Seconds()
+	if sampled <= 0 {
+		return change
+	}
+	toStart := first.Timestamp.Sub(t.Add(-window)).Seconds()
+	toEnd := t.Sub(last.Timestamp).Seconds()
+	if counter && change > 0 && first.Value >= 0 {
+		toStart = math.Min(toStart, sampled*first.Value/change)
+	}
+
+	interval := sampled / float64(len(points)-1)
+	extrapolated := sampled
+	for _, gap := range []float64{toStart, toEnd} {
+		if gap < interval*1.1 {
+			extrapolated += gap
+		} else {
+			extrapolated += interval / 2
+		}
+	}
+	return change * extrapolated / sampled
+}
+
+// promAggregateSamples combines samples that share the grouping labels
+func promAggregateSamples(agg *promAggregate, samples []promSample) promResult {
+	type group struct {
+		labels map[string]string
+		values []float64
+	}
+	groups := make(map[string]*group)
+	var keys []string
+	for _, sample := range samples {
+		labels := make(map[string]string)
+		for name, value := range sample.labels {
+			listed := false
+			for _, label := range agg.grouping {
+				listed = listed || label == name
+			}
+			if listed != agg.without {
+				labels[name] = value
+			}
+		}
+		key := promSeriesKey("", labels)
+		if groups[key] == nil {
+			groups[key] = &group{labels: labels}
+			keys = append(keys, key)
+		}
+		groups[key].values = append(groups[key].values, sample.value)
+	}
+
+	var result promResult
+	for _, key := range keys {
+		g := groups[key]
+		value := g.values[0]
+		switch agg.op {
+		case "sum", "avg":
+			value = 0
+			for _, v := range g.values {
+				value += v
+			}
+			if agg.op == "avg" {
+				value /= float64(len(g.values))
+			}
+		case "min":
+			for _, v := range g.values {
+				value = math.Min(value, v)
+			}
+		case "max":
+			for _, v := range g.values {
+				value = math.Max(value, v)
+			}
+		case "count":
+			value = float64(len(g.values))
+		}
+		result.samples = append(result.samples, promSample{labels: g.labels, value: value})
+	}
+	return result
+}
+
+// promBinaryOp applies an operator between scalars and vectors. Arithmetic
+// drops metric names; comparisons filter the vector operand, keeping its
+// values.
+func promBinaryOp(op string, lhs, rhs promResult) (promResult, error) {
+	comparison := promPrecedence[op] == 1
+	if lhs.scalar && rhs.scalar {
+		if comparison {
+			return promResult{}, fmt.Errorf("comparisons between two scalars are not supported")
+		}
+		return promResult{scalar: true, value: promArithmetic(op, lhs.value, rhs.value)}, nil
+	}
+
+	var result promResult
+	apply := func(sample promSample, left, right float64) {
+		if comparison {
+			if promCompare(op, left, right) {
+				result.samples = append(result.samples, sample)
+			}
+			return
+		}
+		result.samples = append(result.samples, promSample{labels: sample.labels, value: promArithmetic(op, left, right)})
+	}
+
+	switch {
+	case rhs.scalar:
+		for _, sample := range lhs.samples {
+			apply(sample, sample.value, rhs.value)
+		}
+	case lhs.scalar:
+		for _, sample := range rhs.samples {
+			apply(sample, lhs.value, sample.value)
+		}
+	default:
+		// Match samples one-to-one on their labels
+		right := make(map[string]promSample, len(rhs.samples))
+		for _, sample := range rhs.samples {
+			right[promSeriesKey("", sample.labels)] = sample
+		}
+		for _, sample := range lhs.samples {
+			if match, ok := right[promSeriesKey("", sample.labels)]; ok {
+				apply(sample, sample.value, match.value)
+			}
+		}
+	}
+	return result, nil
+}
+
+func promArithmetic(op string, a, b float64) float64 {
+	switch op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		return a / b
+	default:
+		return math.Mod(a, b)
+	}
+}
+
+func promCompare(op string, a, b float64) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case ">":
+		return a > b
+	case "<":
+		return a < b
+	case ">=":
+		return a >= b
+	default:
+		return a <= b
+	}
+}
+
+// promSeriesKey identifies a series by its name and sorted labels
+func promSeriesKey(name string, labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for label := range labels {
+		names = append(names, label)
+	}
+	sort.Strings(names)
+	var key strings.Builder
+	key.WriteString(name + "{")
+	for i, label := range names {
+		if i > 0 {
+			key.WriteString(",")
+		}
+		key.WriteString(label + "=" + strconv.Quote(labels[label]))
+	}
+	key.WriteString("}")
+	return key.String()
+}
@@ -0,0 +1,183 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPromQL(t *testing.T) {
+	// Ten minutes of samples every 10s: the request counter grows by 50 a
+	// sample, heap.alloc by 1000, and two rules report their availability
+	start := time.Date(2026, 4, 1, 12, 0, 0, 0, time.UTC)
+	var history []MetricUpdate
+	for i := 0; i <= 60; i++ {
+		history = append(history, MetricUpdate{
+			Timestamp: start.Add(time.Duration(i) * 10 * time.Second),
+			Metrics: map[string]interface{}{
+				"http.request_count":         int64(i * 50),
+				"heap.alloc":                 uint64(i * 1000),
+				"http.response_time":         20 * time.Millisecond,
+				"availability{rule=memory}":  0.5,
+				"availability{rule=latency}": 1.0,
+				"custom.billing.revenue":     99.0,
+			},
+		})
+	}
+	end := start.Add(10 * time.Minute)
+
+	query := func(q string) []QuerySeries {
+		t.Helper()
+		series, err := PromQL{}.Query(q, history, end, end, time.Minute)
+		if err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+		return series
+	}
+	value := func(q string) float64 {
+		t.Helper()
+		series := query(q)
+		if len(series) != 1 || len(series[0].Points) != 1 {
+			t.Fatalf("%s: expected one value, got %+v", q, series)
+		}
+		return series[0].Points[0].Value
+	}
+
+	cases := map[string]float64{
+		"heap_alloc":                          60000,
+		"heap.alloc":                          60000,
+		"rate(http_request_count[5m])":        5,
+		"increase(http_request_count[1m])":    300,
+		"irate(http_request_count[1m])":       5,
+		"delta(heap_alloc[1m])":               6000,
+		"avg_over_time(heap_alloc[30s])":      59000,
+		"count_over_time(heap_alloc[1m])":     6,
+		"http_response_time / 1e6":            20,
+		"sum(availability)":                   1.5,
+		"min(availability)":                   0.5,
+		"count(availability > 0.9)":           1,
+		"availability{rule=\"memory\"} * 100": 50,
+		"-(heap_alloc - 1000) / 2 + 10 % 3":   -29499,
+		"abs(-3)":                             3,
+	}
+	for q, want := range cases {
+		if got := value(q); math.Abs(got-want) > 1e-9 {
+			t.Errorf("%s = %v, want %v", q, got, want)
+		}
+	}
+
+	// Regex matchers and grouping keep labels; arithmetic drops the name
+	series := query(`sum by (rule) (availability{rule=~"mem.*|lat.*"})`)
+	if len(series) != 2 || series[0].Labels["rule"] != "latency" || series[0].Metric != "" {
+		t.Errorf("unexpected grouped series: %+v", series)
+	}
+	if series := query(`availability{rule!="memory"}`); len(series) != 1 || series[0].Metric != "availability" {
+		t.Errorf("unexpected filtered series: %+v", series)
+	}
+
+	// A counter reset restarts the increase from zero, and the 25 counted is
+	// extrapolated by half a sample interval to the window's start
+	reset := []MetricUpdate{
+		{Timestamp: start, Metrics: map[string]interface{}{"gc.num": 100.0}},
+		{Timestamp: start.Add(10 * time.Second), Metrics: map[string]interface{}{"gc.num": 120.0}},
+		{Timestamp: start.Add(20 * time.Second), Metrics: map[string]interface{}{"gc.num": 5.0}},
+	}
+	if series, err := (PromQL{}).Query("increase(gc_num[1m])", reset, start.Add(20*time.Second), start.Add(20*time.Second), time.Second); err != nil ||
+		len(series) != 1 || series[0].Points[0].Value != 31.25 {
+		t.Errorf("unexpected increase over a reset: %+v, %v", series, err)
+	}
+
+	// Range queries return a point per step
+	if series, _ := (PromQL{}).Query("heap_alloc", history, start, end, time.Minute); len(series) != 1 || len(series[0].Points) != 11 {
+		t.Errorf("expected 11 steps, got %+v", series)
+	}
+
+	for _, q := range []string{
+		"heap_alloc[5m]",
+		"rate(heap_alloc)",
+		"unknown_fn(heap_alloc)",
+		"sum(heap_alloc",
+		`availability{rule=memory}`,
+		"heap_alloc[5x]",
+		"1 > 0",
+	} {
+		if _, err := (PromQL{}).Query(q, history, end, end, time.Minute); err == nil {
+			t.Errorf("expected error for %s", q)
+		}
+	}
+}
+
+func TestQueryEndpoint(t *testing.T) {
+	server := NewServer(0)
+	now := time.Now().UTC()
+	for i := 0; i < 10; i++ {
+		server.historicalMetrics = append(server.historicalMetrics, MetricUpdate{
+			Timestamp: now.Add(time.Duration(i-10) * time.Second),
+			Metrics: map[string]interface{}{
+				"heap.alloc":             float64(i),
+				"goroutines.count":       2 * i,
+				"custom.billing.revenue": 99.0,
+			},
+		})
+	}
+	server.SetMetricAccessPolicy(&MetricAccessPolicy{
+		Roles:       map[string][]string{"contractor": {"heap.*", "goroutines.*"}},
+		DefaultRole: "contractor",
+	})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		params := url.Values{"query": {query}, "start": {now.Add(-time.Minute).Format(time.RFC3339)}, "step": {"5s"}}
+		rec := httptest.NewRecorder()
+		server.handleQuery(rec, httptest.NewRequest(http.MethodGet, "/api/query?"+params.Encode(), nil))
+		return rec
+	}
+
+	if rec := get("heap_alloc"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected queries to be disabled by default, got %d", rec.Code)
+	}
+	server.SetQueryLanguage(PromQL{})
+
+	var response struct {
+		Data struct {
+			Language string        `json:"language"`
+			Series   []QuerySeries `json:"series"`
+		} `json:"data"`
+	}
+	rec := get("heap_alloc")
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("unexpected response %d: %v", rec.Code, err)
+	}
+	if response.Data.Language != "PromQL" || len(response.Data.Series) != 1 || response.Data.Series[0].Metric != "heap.alloc" {
+		t.Errorf("unexpected query result: %+v", response.Data)
+	}
+
+	// Queries only see the metrics the caller's role may view
+	rec = get("custom_billing_revenue")
+	response.Data.Series = nil
+	if json.NewDecoder(rec.Body).Decode(&response); len(response.Data.Series) != 0 {
+		t.Errorf("expected restricted metrics to be hidden, got %+v", response.Data.Series)
+	}
+
+	if rec := get("sum(heap_alloc"); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a parse error to be rejected, got %d", rec.Code)
+	}
+
+	// Correlations accept queries in place of metrics
+	body := `{"query_x": "heap_alloc", "query_y": "goroutines_count * 2", "time_range": 1, "window_size": 60}`
+	rec = httptest.NewRecorder()
+	server.handleMetricCorrelation(rec, httptest.NewRequest(http.MethodPost, "/api/correlation", strings.NewReader(body)))
+	var correlation struct {
+		Data CorrelationResult `json:"data"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&correlation); err != nil {
+		t.Fatalf("failed to decode correlation: %v", err)
+	}
+	if correlation.Data.DataPoints == 0 || math.Abs(correlation.Data.Coefficient-1) > 1e-9 {
+		t.Errorf("expected a perfect correlation between the queries, got %+v", correlation.Data)
+	}
+}
@@ -0,0 +1,197 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// QueryLanguage evaluates queries written in an external time-series query
+// language over the dashboard's metric history, for the query and correlation
+// views. It does not change the rule DSL.
+type QueryLanguage interface {
+	// Name identifies the language in the dashboard, e.g. "PromQL"
+	Name() string
+	// Query evaluates query at each step from start to end. history is
+	// ordered oldest first and holds only the metrics the caller may view.
+	Query(query string, history []MetricUpdate, start, end time.Time, step time.Duration) ([]QuerySeries, error)
+}
+
+// QuerySeries is one series of a query result
+type QuerySeries struct {
+	// Metric names the metric the series was selected from; operations that
+	// change a value's meaning, such as rate() or sum(), clear it
+	Metric string            `json:"metric,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Points []QueryPoint      `json:"points"`
+}
+
+// QueryPoint is a series value at one evaluation step
+type QueryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// defaultQuerySteps is how many steps a query without a step is divided into
+const defaultQuerySteps = 250
+
+// SetQueryLanguage enables queries in a QueryLanguage, such as PromQL{}, in
+// the dashboard's query and correlation views. nil disables them, the
+// default.
+func (s *Server) SetQueryLanguage(language QueryLanguage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.queryLanguage = language
+}
+
+// queryLanguageName returns the name of the configured query language, or ""
+func (s *Server) queryLanguageName() string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.queryLanguage == nil {
+		return ""
+	}
+	return s.queryLanguage.Name()
+}
+
+// runQuery evaluates a query over the history the role may view
+func (s *Server) runQuery(role, query string, start, end time.Time, step time.Duration) ([]QuerySeries, error) {
+	s.mutex.RLock()
+	language := s.queryLanguage
+	stored := s.metricHistory()
+	history := make([]MetricUpdate, 0, len(stored))
+	for _, update := range stored {
+		// Range selectors may reach back before start
+		if !update.Timestamp.After(end) {
+			history = append(history, update)
+		}
+	}
+	s.mutex.RUnlock()
+
+	for i, update := range history {
+		history[i] = s.filterMetricUpdate(role, update)
+	}
+	return language.Query(query, history, start, end, step)
+}
+
+// handleQuery evaluates a query over a time range:
+//
+//	GET /api/query?query=rate(http_request_count[5m])&start=...&end=...&step=15s
+//
+// start and end are RFC 3339 times, defaulting to the last hour; step is a
+// duration or a number of seconds.
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	language := s.queryLanguageName()
+	if language == "" {
+		http.Error(w, "Query language not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	params := r.URL.Query()
+	query := params.Get("query")
+	if query == "" {
+		writeRuleError(w, http.StatusBadRequest, fmt.Errorf("query parameter is required"))
+		return
+	}
+
+	end := time.Now().UTC()
+	if value := params.Get("end"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeRuleError(w, http.StatusBadRequest, fmt.Errorf("end must be an RFC 3339 time"))
+			return
+		}
+		end = parsed
+	}
+	start := end.Add(-time.Hour)
+	if value := params.Get("start"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			writeRuleError(w, http.StatusBadRequest, fmt.Errorf("start must be an RFC 3339 time"))
+			return
+		}
+		start = parsed
+	}
+
+	step := end.Sub(start) / defaultQuerySteps
+	if value := params.Get("step"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			seconds, numErr := strconv.ParseFloat(value, 64)
+			if numErr != nil {
+				writeRuleError(w, http.StatusBadRequest, fmt.Errorf("step must be a duration or a number of seconds"))
+				return
+			}
+			parsed = time.Duration(seconds * float64(time.Second))
+		}
+		step = parsed
+	}
+	if step < time.Second {
+		step = time.Second
+	}
+
+	series, err := s.runQuery(s.resolveRole(r), query, start, end, step)
+	if err != nil {
+		writeRuleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data": map[string]interface{}{
+			"language": language,
+			"step":     step.Seconds(),
+			"series":   series,
+		},
+	})
+}
+
+// queryCorrelationPoints evaluates the correlation's X and Y queries, falling
+// back to the metric names, which are valid selectors, and pairs their values
+// at each step
+func (s *Server) queryCorrelationPoints(role string, req CorrelationRequest) ([]ScatterPoint, error) {
+	end := time.Now().UTC()
+	start := end.Add(-time.Duration(req.TimeRange) * time.Minute)
+	step := end.Sub(start) / time.Duration(req.WindowSize)
+	if step < time.Second {
+		step = time.Second
+	}
+
+	var values [2]map[int64]float64
+	for i, query := range []string{req.QueryX, req.QueryY} {
+		if query == "" {
+			query = []string{req.MetricX, req.MetricY}[i]
+		}
+		series, err := s.runQuery(role, query, start, end, step)
+		if err != nil {
+			return nil, err
+		}
+		if len(series) > 1 {
+			return nil, fmt.Errorf("query %s returns %d series; aggregate it to one, e.g. with sum()", query, len(series))
+		}
+		values[i] = make(map[int64]float64)
+		for _, result := range series {
+			for _, point := range result.Points {
+				values[i][point.Timestamp.UnixNano()] = point.Value
+			}
+		}
+	}
+
+	var points []ScatterPoint
+	for t := start; !t.After(end); t = t.Add(step) {
+		x, xOk := values[0][t.UnixNano()]
+		y, yOk := values[1][t.UnixNano()]
+		if xOk && yOk {
+			points = append(points, ScatterPoint{X: x, Y: y, Timestamp: t})
+		}
+	}
+	return points, nil
+}
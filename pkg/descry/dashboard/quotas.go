@@ -0,0 +1,38 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// SetActionQuotaProvider connects the /api/actions/quotas endpoint to the
+// engine's action execution quotas, which back the Action Quotas card
+func (s *Server) SetActionQuotaProvider(getQuotas func() interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.getActionQuotas = getQuotas
+}
+
+// handleActionQuotas returns the use of every configured quota, an empty
+// list when none are set
+func (s *Server) handleActionQuotas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	getQuotas := s.getActionQuotas
+	s.mutex.RUnlock()
+
+	var quotas interface{} = []interface{}{}
+	if getQuotas != nil {
+		quotas = getQuotas()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   quotas,
+	})
+}
@@ -0,0 +1,189 @@
+package dashboard
+
+import (
+	"time"
+)
+
+// HistoryRetention controls how long the dashboard keeps metric history at
+// each resolution. Updates are kept as sent for Raw, then averaged into 10
+// second rollups kept for TenSecond, then into 1 minute rollups kept for
+// Minute, so time travel, correlation and queries cover hours of history in
+// bounded memory. Zero fields select the defaults of DefaultHistoryRetention.
+type HistoryRetention struct {
+	Raw       time.Duration // updates kept at full resolution
+	TenSecond time.Duration // 10 second rollups kept after that
+	Minute    time.Duration // 1 minute rollups kept after that
+}
+
+// DefaultHistoryRetention returns the retention used unless
+// SetHistoryRetention is called: 15 minutes of updates, 3 hours of 10
+// second rollups and 24 hours of 1 minute rollups
+func DefaultHistoryRetention() HistoryRetention {
+	return HistoryRetention{
+		Raw:       15 * time.Minute,
+		TenSecond: 3 * time.Hour,
+		Minute:    24 * time.Hour,
+	}
+}
+
+// withDefaults fills zero fields from DefaultHistoryRetention
+func (r HistoryRetention) withDefaults() HistoryRetention {
+	defaults := DefaultHistoryRetention()
+	if r.Raw <= 0 {
+		r.Raw = defaults.Raw
+	}
+	if r.TenSecond <= 0 {
+		r.TenSecond = defaults.TenSecond
+	}
+	if r.Minute <= 0 {
+		r.Minute = defaults.Minute
+	}
+	return r
+}
+
+// SetHistoryRetention sets how long metric history is kept at each
+// resolution. History already rolled up keeps its resolution.
+func (s *Server) SetHistoryRetention(retention HistoryRetention) {
+	retention = retention.withDefaults()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.historyRetention = retention
+	s.tenSecondRollup.retention = retention.TenSecond
+	s.minuteRollup.retention = retention.Minute
+}
+
+// metricRollup averages the metric updates of consecutive periods of one
+// resolution. Updates are added oldest first.
+type metricRollup struct {
+	resolution time.Duration
+	name       string // resolution as shown to clients, such as 10s
+	retention  time.Duration
+	updates    []MetricUpdate // completed periods, oldest first
+
+	// The period being filled
+	start  time.Time
+	sums   map[string]float64
+	counts map[string]int
+	last   MetricUpdate // newest update of the period, for non-numeric values
+}
+
+func newMetricRollup(resolution time.Duration, name string, retention time.Duration) *metricRollup {
+	return &metricRollup{resolution: resolution, name: name, retention: retention}
+}
+
+// add folds an update into its period, completing the open period first
+// when the update starts a later one. It returns the completed updates that
+// aged out of the retention, oldest first.
+func (r *metricRollup) add(update MetricUpdate) []MetricUpdate {
+	start := update.Timestamp.Truncate(r.resolution)
+	if r.sums != nil && !start.Equal(r.start) {
+		r.updates = append(r.updates, r.current())
+		r.sums = nil
+	}
+	if r.sums == nil {
+		r.start = start
+		r.sums = make(map[string]float64)
+		r.counts = make(map[string]int)
+	}
+	for name, value := range update.Metrics {
+		if number, ok := toFloat64(value); ok {
+			r.sums[name] += number
+			r.counts[name]++
+		}
+	}
+	r.last = update
+
+	// Completed periods older than the retention move on
+	cutoff := update.Timestamp.Add(-r.retention)
+	expired := 0
+	for expired < len(r.updates) && r.updates[expired].Timestamp.Before(cutoff) {
+		expired++
+	}
+	if expired == 0 {
+		return nil
+	}
+	aged := make([]MetricUpdate, expired)
+	copy(aged, r.updates[:expired])
+	r.updates = append(r.updates[:0], r.updates[expired:]...)
+	return aged
+}
+
+// current returns the open period as one update at the period's start,
+// averaging numeric metrics and keeping the newest value of the others
+func (r *metricRollup) current() MetricUpdate {
+	metrics := make(map[string]interface{}, len(r.last.Metrics))
+	for name, value := range r.last.Metrics {
+		metrics[name] = value
+	}
+	for name, sum := range r.sums {
+		metrics[name] = sum / float64(r.counts[name])
+	}
+	return MetricUpdate{
+		Timestamp:  r.start,
+		Metrics:    metrics,
+		Stale:      r.last.Stale,
+		Resolution: r.name,
+	}
+}
+
+// history returns the rollup's updates oldest first, including the open period
+func (r *metricRollup) history() []MetricUpdate {
+	history := make([]MetricUpdate, 0, len(r.updates)+1)
+	history = append(history, r.updates...)
+	if r.sums != nil {
+		history = append(history, r.current())
+	}
+	return history
+}
+
+// toFloat64 converts a numeric metric value
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// recordMetricHistory adds an update to the raw history, rolling updates
+// that outlive the raw retention or the history size into 10 second
+// periods, and those into 1 minute periods. Callers hold s.mutex.
+func (s *Server) recordMetricHistory(update MetricUpdate) {
+	s.historicalMetrics = append(s.historicalMetrics, update)
+
+	cutoff := update.Timestamp.Add(-s.historyRetention.Raw)
+	expired := 0
+	for expired < len(s.historicalMetrics) &&
+		(len(s.historicalMetrics)-expired > s.maxHistorySize || s.historicalMetrics[expired].Timestamp.Before(cutoff)) {
+		expired++
+	}
+	if expired == 0 {
+		return
+	}
+	for _, aged := range s.historicalMetrics[:expired] {
+		for _, rolled := range s.tenSecondRollup.add(aged) {
+			// Minute rollups past their retention are dropped
+			s.minuteRollup.add(rolled)
+		}
+	}
+	// Properly release memory by copying and truncating
+	remaining := copy(s.historicalMetrics, s.historicalMetrics[expired:])
+	s.historicalMetrics = s.historicalMetrics[:remaining]
+}
+
+// metricHistory returns every stored update oldest first: 1 minute
+// rollups, then 10 second rollups, then raw updates. Callers hold s.mutex.
+func (s *Server) metricHistory() []MetricUpdate {
+	// Each tier holds only updates older than those of the next
+	history := s.minuteRollup.history()
+	history = append(history, s.tenSecondRollup.history()...)
+	return append(history, s.historicalMetrics...)
+}
@@ -0,0 +1,61 @@
+package dashboard
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetricHistoryRollup(t *testing.T) {
+	server := NewServer(0)
+	server.SetHistoryRetention(HistoryRetention{Raw: time.Minute, TenSecond: 2 * time.Minute, Minute: 5 * time.Minute})
+
+	// One update a second for 20 minutes, the value counting the seconds
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 20*60; i++ {
+		server.recordMetricHistory(MetricUpdate{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Metrics:   map[string]interface{}{"custom.seconds": float64(i), "build": "abc"},
+		})
+	}
+
+	history := server.metricHistory()
+	for i := 1; i < len(history); i++ {
+		if !history[i].Timestamp.After(history[i-1].Timestamp) {
+			t.Fatalf("expected history ordered by time, got %s after %s", history[i].Timestamp, history[i-1].Timestamp)
+		}
+	}
+	counts := make(map[string]int)
+	for _, update := range history {
+		counts[update.Resolution]++
+	}
+	if counts[""] > 61 || counts["10s"] < 12 || counts["10s"] > 14 || counts["1m"] < 5 || counts["1m"] > 7 {
+		t.Errorf("expected a minute of updates, two minutes of 10s and five of 1m rollups, got %v", counts)
+	}
+	if oldest := history[0].Timestamp; oldest.Before(start.Add(10 * time.Minute)) {
+		t.Errorf("expected rollups past their retention to be dropped, oldest is %s", oldest)
+	}
+
+	// Rollups average numeric values over their period and keep the others
+	for _, update := range history {
+		if update.Resolution != "10s" {
+			continue
+		}
+		offset := update.Timestamp.Sub(start).Seconds()
+		if value := update.Metrics["custom.seconds"]; value != offset+4.5 {
+			t.Errorf("expected the 10s rollup at %s to average to %v, got %v", update.Timestamp, offset+4.5, value)
+		}
+		if update.Metrics["build"] != "abc" {
+			t.Errorf("expected non-numeric values kept in rollups, got %v", update.Metrics["build"])
+		}
+		break
+	}
+	for _, update := range history {
+		if update.Resolution == "1m" {
+			offset := update.Timestamp.Sub(start).Seconds()
+			if value := update.Metrics["custom.seconds"]; value != offset+29.5 {
+				t.Errorf("expected the 1m rollup at %s to average to %v, got %v", update.Timestamp, offset+29.5, value)
+			}
+			break
+		}
+	}
+}
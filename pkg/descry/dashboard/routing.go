@@ -0,0 +1,73 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// maxRoutingConfigSize bounds the size of routing configurations accepted by /api/routing
+const maxRoutingConfigSize = 1 << 20
+
+// SetRoutingProvider connects the /api/routing endpoint to the engine's alert
+// routing. getRouting returns the active configuration; setRouting parses and
+// installs a JSON configuration.
+func (s *Server) SetRoutingProvider(getRouting func() interface{}, setRouting func(data []byte) error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.getRouting = getRouting
+	s.setRouting = setRouting
+}
+
+// handleRouting returns the active routing configuration on GET and replaces it
+// on PUT or POST
+func (s *Server) handleRouting(w http.ResponseWriter, r *http.Request) {
+	s.mutex.RLock()
+	getRouting, setRouting := s.getRouting, s.setRouting
+	s.mutex.RUnlock()
+
+	switch r.Method {
+	case http.MethodGet:
+		var routing interface{}
+		if getRouting != nil {
+			routing = getRouting()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "ok",
+			"data":   routing,
+		})
+
+	case http.MethodPut, http.MethodPost:
+		if setRouting == nil {
+			http.Error(w, "Routing configuration not available", http.StatusServiceUnavailable)
+			return
+		}
+
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxRoutingConfigSize))
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := setRouting(data); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"status": "error",
+				"error":  err.Error(),
+			})
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":  "ok",
+			"message": "Routing configuration updated",
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
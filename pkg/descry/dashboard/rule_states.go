@@ -0,0 +1,53 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// SetRuleStateProvider connects the /api/rules/states endpoint, which backs
+// the firing-state bands under the charts, to the engine's history of rule
+// evaluation results. history returns the state intervals ending at or after
+// since; current returns each rule's latest result, which /api/capture adds
+// to every frame.
+func (s *Server) SetRuleStateProvider(history func(since time.Time) interface{}, current func() map[string]bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.getRuleStates = history
+	s.currentRuleStates = current
+}
+
+// handleRuleStates returns when each rule's condition held since the time
+// in the from parameter, or over the last hour
+func (s *Server) handleRuleStates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	since := time.Now().Add(-time.Hour)
+	if from := r.URL.Query().Get("from"); from != "" {
+		parsed, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			http.Error(w, "Invalid 'from' time format", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	s.mutex.RLock()
+	getRuleStates := s.getRuleStates
+	s.mutex.RUnlock()
+
+	var states interface{} = []interface{}{}
+	if getRuleStates != nil {
+		states = getRuleStates(since)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   states,
+	})
+}
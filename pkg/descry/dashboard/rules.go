@@ -0,0 +1,204 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SetRuleManager connects the rule editor to the engine. saveRule adds a rule
+// or replaces an existing one with the same name, removeRule deletes a rule
+// and setEnabled enables or disables one.
+func (s *Server) SetRuleManager(saveRule func(name, source string) error, removeRule func(name string) error,
+	setEnabled func(name string, enabled bool) error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.saveRule = saveRule
+	s.removeRule = removeRule
+	s.setRuleEnabled = setEnabled
+}
+
+// handleRuleSave adds or replaces the rule submitted by the rule editor
+func (s *Server) handleRuleSave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	saveRule := s.saveRule
+	s.mutex.RUnlock()
+	if saveRule == nil {
+		http.Error(w, "Rule management not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var req RuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || req.Code == "" {
+		writeRuleError(w, http.StatusBadRequest, fmt.Errorf("rule name and code are required"))
+		return
+	}
+
+	if err := saveRule(req.Name, req.Code); err != nil {
+		writeRuleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"message": fmt.Sprintf("Rule '%s' saved successfully", req.Name),
+	})
+}
+
+// handleRuleDelete removes the rule named in the path
+func (s *Server) handleRuleDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	removeRule := s.removeRule
+	s.mutex.RUnlock()
+	if removeRule == nil {
+		http.Error(w, "Rule management not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := removeRule(name); err != nil {
+		writeRuleError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"message": fmt.Sprintf("Rule '%s' removed", name),
+	})
+}
+
+// handleRuleToggle enables or disables the rule named in the path, for
+// POST /api/rules/{name}/enable and /api/rules/{name}/disable
+func (s *Server) handleRuleToggle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var enabled bool
+	switch r.PathValue("action") {
+	case "enable":
+		enabled = true
+	case "disable":
+		enabled = false
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mutex.RLock()
+	setEnabled := s.setRuleEnabled
+	s.mutex.RUnlock()
+	if setEnabled == nil {
+		http.Error(w, "Rule management not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := setEnabled(name, enabled); err != nil {
+		writeRuleError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"message": fmt.Sprintf("Rule '%s' %sd", name, r.PathValue("action")),
+	})
+}
+
+// SetRuleGroupManager connects the rule editor's group controls to the
+// engine. getGroups lists the rule groups and setEnabled enables or disables
+// every rule in one.
+func (s *Server) SetRuleGroupManager(getGroups func() interface{}, setEnabled func(name string, enabled bool) error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.getRuleGroups = getGroups
+	s.setGroupEnabled = setEnabled
+}
+
+// handleRuleGroups lists the rule groups for GET /api/rules/groups
+func (s *Server) handleRuleGroups(w http.ResponseWriter, r *http.Request) {
+	s.mutex.RLock()
+	getGroups := s.getRuleGroups
+	s.mutex.RUnlock()
+
+	var groups interface{} = []interface{}{}
+	if getGroups != nil {
+		groups = getGroups()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   groups,
+	})
+}
+
+// handleRuleGroupToggle enables or disables every rule in the group named in
+// the path, for POST /api/rules/groups/{name}/enable and
+// /api/rules/groups/{name}/disable
+func (s *Server) handleRuleGroupToggle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var enabled bool
+	switch r.PathValue("action") {
+	case "enable":
+		enabled = true
+	case "disable":
+		enabled = false
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mutex.RLock()
+	setEnabled := s.setGroupEnabled
+	s.mutex.RUnlock()
+	if setEnabled == nil {
+		http.Error(w, "Rule management not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := setEnabled(name, enabled); err != nil {
+		writeRuleError(w, http.StatusNotFound, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "ok",
+		"message": fmt.Sprintf("Rules in group '%s' %sd", name, r.PathValue("action")),
+	})
+}
+
+// writeRuleError reports a rule management failure in the format the rule
+// editor expects
+func writeRuleError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "error",
+		"message": err.Error(),
+	})
+}
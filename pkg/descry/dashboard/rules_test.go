@@ -0,0 +1,81 @@
+package dashboard
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRuleManagement(t *testing.T) {
+	server := NewServer(0)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/rules/save", strings.NewReader(`{"name":"a","code":"when heap.alloc > 0 { log(\"x\") }"}`))
+	rec := httptest.NewRecorder()
+	server.handleRuleSave(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a rule manager, got %d", rec.Code)
+	}
+
+	rules := make(map[string]string)
+	disabled := make(map[string]bool)
+	server.SetRuleManager(
+		func(name, source string) error {
+			if strings.Contains(source, "{{") {
+				return fmt.Errorf("parse error")
+			}
+			rules[name] = source
+			return nil
+		},
+		func(name string) error {
+			if _, ok := rules[name]; !ok {
+				return fmt.Errorf("rule not found: %s", name)
+			}
+			delete(rules, name)
+			return nil
+		},
+		func(name string, enabled bool) error {
+			if _, ok := rules[name]; !ok {
+				return fmt.Errorf("rule not found: %s", name)
+			}
+			disabled[name] = !enabled
+			return nil
+		},
+	)
+
+	rec = httptest.NewRecorder()
+	server.handleRuleSave(rec, httptest.NewRequest(http.MethodPost, "/api/rules/save", strings.NewReader(`{"name":"a","code":"when heap.alloc > 0 { log(\"x\") }"}`)))
+	if rec.Code != http.StatusOK || rules["a"] == "" {
+		t.Fatalf("expected rule to be saved, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleRuleSave(rec, httptest.NewRequest(http.MethodPost, "/api/rules/save", strings.NewReader(`{"name":"b","code":"{{"}`)))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "parse error") {
+		t.Errorf("expected save error to be reported, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/rules/a/disable", nil)
+	req.SetPathValue("name", "a")
+	req.SetPathValue("action", "disable")
+	rec = httptest.NewRecorder()
+	server.handleRuleToggle(rec, req)
+	if rec.Code != http.StatusOK || !disabled["a"] {
+		t.Errorf("expected rule to be disabled, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/rules/a", nil)
+	req.SetPathValue("name", "a")
+	rec = httptest.NewRecorder()
+	server.handleRuleDelete(rec, req)
+	if rec.Code != http.StatusOK || len(rules) != 0 {
+		t.Errorf("expected rule to be removed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	server.handleRuleDelete(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown rule, got %d", rec.Code)
+	}
+}
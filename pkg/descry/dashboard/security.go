@@ -0,0 +1,114 @@
+package dashboard
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// NoncePlaceholder may be used in a custom Content-Security-Policy. Each response
+// replaces it with a fresh random nonce that is also added to the dashboard's
+// <script> tags, e.g. "script-src 'self' 'nonce-{nonce}'".
+const NoncePlaceholder = "{nonce}"
+
+// defaultScriptSources allows only the dashboard's own scripts: same-origin
+// assets and the inline script carrying the request's nonce. The dashboard
+// binds its controls with addEventListener, so no inline handlers are needed.
+const defaultScriptSources = "'self' 'nonce-" + NoncePlaceholder + "'"
+
+type nonceContextKey struct{}
+
+// SetContentSecurityPolicy overrides the Content-Security-Policy header sent with
+// every dashboard response. The policy may contain NoncePlaceholder to enable
+// per-request script nonces. Passing an empty string restores the default policy.
+func (s *Server) SetContentSecurityPolicy(policy string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.cspPolicy = policy
+}
+
+// contentSecurityPolicy returns the policy for a response to a request for
+// host, with any nonce placeholder substituted.
+func (s *Server) contentSecurityPolicy(host, nonce string) string {
+	s.mutex.RLock()
+	policy := s.cspPolicy
+	assetBaseURL := s.assetBaseURL
+	s.mutex.RUnlock()
+
+	if policy == "" {
+		scriptSources := defaultScriptSources
+		// Allow an internal asset mirror configured with SetAssetBaseURL
+		if origin := assetOrigin(assetBaseURL); origin != "" {
+			scriptSources += " " + origin
+		}
+
+		policy = strings.Join([]string{
+			"default-src 'self'",
+			"script-src " + scriptSources,
+			"style-src 'self' 'unsafe-inline'",
+			"img-src 'self' data:",
+			"connect-src " + connectSources(host),
+			"object-src 'none'",
+			"base-uri 'self'",
+			"form-action 'self'",
+			"frame-ancestors 'none'",
+		}, "; ")
+	}
+
+	return strings.ReplaceAll(policy, NoncePlaceholder, nonce)
+}
+
+// connectSources allows same-origin requests and the live-update WebSocket on
+// the host the dashboard was requested from. A host that could smuggle extra
+// policy tokens falls back to 'self' alone.
+func connectSources(host string) string {
+	if host == "" || strings.ContainsAny(host, " \t;,'\"") {
+		return "'self'"
+	}
+	return "'self' ws://" + host + " wss://" + host
+}
+
+// assetOrigin returns the scheme and host of an absolute asset URL, or an
+// empty string for same-origin paths.
+func assetOrigin(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// securityHeaders wraps the dashboard handler and sets hardening headers on
+// every response, including API and WebSocket handshake responses.
+func (s *Server) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := generateNonce()
+
+		header := w.Header()
+		header.Set("Content-Security-Policy", s.contentSecurityPolicy(r.Host, nonce))
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", "no-referrer")
+
+		ctx := context.WithValue(r.Context(), nonceContextKey{}, nonce)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestNonce returns the CSP nonce generated for the request
+func requestNonce(r *http.Request) string {
+	nonce, _ := r.Context().Value(nonceContextKey{}).(string)
+	return nonce
+}
+
+// generateNonce returns a random base64 value suitable for a CSP nonce
+func generateNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
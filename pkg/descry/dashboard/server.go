@@ -12,10 +12,13 @@
 // Features include:
 //   - WebSocket-based real-time updates for minimal latency
 //   - Interactive charts using Chart.js with zoom and pan capabilities
+//   - Vendored, integrity-checked JavaScript assets (no CDN dependency)
 //   - Time-travel debugging with 0.5x to 10x playback speeds
 //   - Collaborative alert management with notes and assignments
 //   - Pearson correlation analysis with anomaly detection
 //   - Security hardening with input validation and XSS prevention
+//   - Content-Security-Policy and related security headers on every response
+//   - A read-only public status page at /status that can be exposed on its own
 //
 // The dashboard is accessible at http://localhost:9090 (configurable port)
 // and provides a production-ready monitoring interface for embedded applications.
@@ -33,14 +36,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"math"
+	"net"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+	"github.com/chosenoffset/descry/pkg/descry/parser"
+	"github.com/chosenoffset/descry/pkg/descry/units"
 	"github.com/gorilla/websocket"
 )
 
@@ -48,9 +57,10 @@ import (
 // for real-time updates, historical data storage, and alert management
 type Server struct {
 	port           int
+	host           string
 	server         *http.Server
 	upgrader       websocket.Upgrader
-	clients        map[*websocket.Conn]bool
+	clients        map[*websocket.Conn]string // connection -> access role
 	clientsMutex   sync.RWMutex
 	maxClients     int
 	metrics        chan MetricUpdate
@@ -58,6 +68,7 @@ type Server struct {
 	stop           chan struct{}
 	stopped        bool
 	stopMutex      sync.Mutex
+	broadcasting   sync.WaitGroup // the broadcast goroutine, waited for by Stop
 	recentMetrics  MetricUpdate
 	eventBuffer    []EventUpdate
 	eventIndex     int
@@ -68,11 +79,55 @@ type Server struct {
 	historicalMetrics []MetricUpdate
 	historicalEvents  []EventUpdate
 	maxHistorySize    int
+	// Older metric history, averaged over longer periods
+	historyRetention  HistoryRetention
+	tenSecondRollup   *metricRollup
+	minuteRollup      *metricRollup
 	// Alert management
 	alerts            []Alert
 	alertsByStatus    map[AlertStatus][]Alert
 	// Debug logging control
 	debugEnabled      bool
+	// Base URL for vendored JavaScript assets
+	assetBaseURL      string
+	static            http.Handler
+	// Custom Content-Security-Policy (empty uses the default policy)
+	cspPolicy         string
+	// Per-role metric visibility (nil allows all metrics)
+	accessPolicy      *MetricAccessPolicy
+	// Alert routing configuration accessors
+	getRouting        func() interface{}
+	setRouting        func(data []byte) error
+	getActionQuotas   func() interface{}
+	getProfiles       func() interface{}
+	getProfile        func(id string) (data []byte, filename string, ok bool)
+	saveRule          func(name, source string) error
+	removeRule        func(name string) error
+	setRuleEnabled    func(name string, enabled bool) error
+	getRuleGroups     func() interface{}
+	setGroupEnabled   func(name string, enabled bool) error
+	exportBundle      func(w io.Writer, format string) error
+	importBundle      func(r io.Reader, dryRun, replace bool) (interface{}, error)
+	// Serve only the public status page
+	publicStatusOnly  bool
+	// Per-rule availability accessor
+	getAvailability   func() interface{}
+	// Per-rule evaluation statistics accessor
+	getRuleStats      func() interface{}
+	// Rule evaluation result history and latest results
+	getRuleStates     func(since time.Time) interface{}
+	currentRuleStates func() map[string]bool
+	// HTTP statistics by route label, method and status class
+	getHTTPBreakdown  func() interface{}
+	simulate          func(ctx context.Context, request json.RawMessage) (interface{}, error)
+	// DSL metric values for descryctl record
+	captureProvider   func() map[string]float64
+	// Optional query language for the query and correlation views
+	queryLanguage     QueryLanguage
+	// Metrics each rule reads, for probable-cause analysis
+	ruleMetrics       func(rule string) []string
+	// How values are shown in the dashboard and exports
+	valueFormat       units.Format
 }
 
 // MetricUpdate represents a timestamped collection of metrics
@@ -80,6 +135,11 @@ type Server struct {
 type MetricUpdate struct {
 	Timestamp time.Time              `json:"timestamp"`
 	Metrics   map[string]interface{} `json:"metrics"`
+	// Stale names the metrics past their TTL, which the dashboard greys out
+	Stale []string `json:"stale,omitempty"`
+	// Resolution is the period a rollup of older history averages, such as
+	// 10s or 1m; empty for updates as sent
+	Resolution string `json:"resolution,omitempty"`
 }
 
 // EventUpdate represents a rule trigger or system event
@@ -123,6 +183,8 @@ type Alert struct {
 	AcknowledgedBy *string     `json:"acknowledged_by,omitempty"`
 	Notes        []AlertNote   `json:"notes"`
 	Metadata     map[string]interface{} `json:"metadata"`
+	// Labels are the labels of the rule that raised the alert
+	Labels       map[string]string `json:"labels,omitempty"`
 }
 
 type AlertNote struct {
@@ -149,7 +211,7 @@ func NewServer(port int) *Server {
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
 		},
-		clients:           make(map[*websocket.Conn]bool),
+		clients:           make(map[*websocket.Conn]string),
 		maxClients:        100, // Limit concurrent WebSocket connections
 		metrics:           make(chan MetricUpdate, 100),
 		events:            make(chan EventUpdate, 100),
@@ -158,9 +220,14 @@ func NewServer(port int) *Server {
 		historicalMetrics: make([]MetricUpdate, 0, 1000),
 		historicalEvents:  make([]EventUpdate, 0, 1000),
 		maxHistorySize:    1000, // Store up to 1000 historical entries
+		historyRetention:  DefaultHistoryRetention(),
+		tenSecondRollup:   newMetricRollup(10*time.Second, "10s", DefaultHistoryRetention().TenSecond),
+		minuteRollup:      newMetricRollup(time.Minute, "1m", DefaultHistoryRetention().Minute),
 		alerts:            make([]Alert, 0),
 		alertsByStatus:    make(map[AlertStatus][]Alert),
 		debugEnabled:      false, // Debug logging disabled by default
+		assetBaseURL:      DefaultAssetBaseURL,
+		static:            staticHandler(),
 	}
 }
 
@@ -180,29 +247,70 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/api/playback", s.handlePlayback)
 	mux.HandleFunc("/api/rules/validate", s.handleRuleValidation)
 	mux.HandleFunc("/api/rules/save", s.handleRuleSave)
+	mux.HandleFunc("/api/rules/{name}", s.handleRuleDelete)
+	mux.HandleFunc("/api/rules/{name}/{action}", s.handleRuleToggle)
 	mux.HandleFunc("/api/rules/test", s.handleRuleTest)
+	mux.HandleFunc("/api/rules/stats", s.handleRuleStats)
+	mux.HandleFunc("/api/rules/states", s.handleRuleStates)
+	mux.HandleFunc("/api/rules/groups", s.handleRuleGroups)
+	mux.HandleFunc("/api/rules/groups/{name}/{action}", s.handleRuleGroupToggle)
+	mux.HandleFunc("/api/rules/export", s.handleRuleExport)
+	mux.HandleFunc("/api/rules/import", s.handleRuleImport)
+	mux.HandleFunc("/api/simulate", s.handleSimulate)
+	mux.HandleFunc("/api/capture", s.handleCapture)
+	mux.HandleFunc("/api/query", s.handleQuery)
 	mux.HandleFunc("/api/alerts", s.handleAlerts)
 	mux.HandleFunc("/api/alerts/acknowledge", s.handleAcknowledgeAlert)
 	mux.HandleFunc("/api/alerts/resolve", s.handleResolveAlert)
 	mux.HandleFunc("/api/alerts/suppress", s.handleSuppressAlert)
 	mux.HandleFunc("/api/alerts/note", s.handleAddAlertNote)
+	mux.HandleFunc("/api/alerts/{id}/cause", s.handleAlertCause)
 	mux.HandleFunc("/api/correlation", s.handleMetricCorrelation)
+	mux.HandleFunc("/api/routing", s.handleRouting)
+	mux.HandleFunc("/api/actions/quotas", s.handleActionQuotas)
+	mux.HandleFunc("/api/profiles", s.handleProfiles)
+	mux.HandleFunc("/api/profiles/{id}", s.handleProfileDownload)
+	mux.HandleFunc("/api/availability", s.handleAvailability)
+	mux.HandleFunc("/api/http/breakdown", s.handleHTTPBreakdown)
+	mux.HandleFunc("/api/incidents/{id}/export", s.handleIncidentExport)
+	mux.HandleFunc("/api/charts/export", s.handleChartExport)
+	
+	// Read-only public status page
+	mux.HandleFunc("/status", s.handleStatusPage)
+	mux.HandleFunc("/api/status", s.handleStatusAPI)
 	
 	// WebSocket endpoint
 	mux.HandleFunc("/ws", s.handleWebSocket)
 	
-	s.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
-		Handler: mux,
+	server := &http.Server{
+		Addr:    net.JoinHostPort(s.host, strconv.Itoa(s.port)),
+		Handler: s.securityHeaders(s.publicStatusFilter(mux)),
 	}
 	
+	// A server stopped before it started must not start listening, or
+	// nothing would ever shut it down
+	s.stopMutex.Lock()
+	if s.stopped {
+		s.stopMutex.Unlock()
+		return http.ErrServerClosed
+	}
+	s.server = server
+	
 	// Start broadcast goroutine
-	go s.broadcast()
+	stop := s.stop
+	s.broadcasting.Add(1)
+	go func() {
+		defer s.broadcasting.Done()
+		s.broadcast(stop)
+	}()
+	s.stopMutex.Unlock()
 	
-	log.Printf("Starting Descry dashboard on :%d", s.port)
-	return s.server.ListenAndServe()
+	log.Printf("Starting Descry dashboard on %s", server.Addr)
+	return server.ListenAndServe()
 }
 
+// Stop closes WebSocket connections, shuts down the HTTP server and returns
+// once the broadcast goroutine has exited
 func (s *Server) Stop() error {
 	s.stopMutex.Lock()
 	defer s.stopMutex.Unlock()
@@ -213,6 +321,7 @@ func (s *Server) Stop() error {
 	
 	s.stopped = true
 	close(s.stop)
+	defer s.broadcasting.Wait()
 	
 	if s.server != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -222,20 +331,55 @@ func (s *Server) Stop() error {
 	return nil
 }
 
-func (s *Server) SendMetricUpdate(metrics map[string]interface{}) {
+// Reopen readies a stopped server to be started again, for example when the
+// engine is restarted. It has no effect on a server that has not been stopped.
+// Connections from before the stop are not carried over; dashboards reconnect.
+func (s *Server) Reopen() {
+	s.stopMutex.Lock()
+	defer s.stopMutex.Unlock()
+	if !s.stopped {
+		return
+	}
+	s.stopped = false
+	s.stop = make(chan struct{})
+	s.server = nil
+}
+
+// stopChannel returns the channel closed when the server stops
+func (s *Server) stopChannel() chan struct{} {
+	s.stopMutex.Lock()
+	defer s.stopMutex.Unlock()
+	return s.stop
+}
+
+// SendMetricUpdate queues a metrics snapshot for broadcast to connected clients.
+// The metrics named in stale have gone without an update for longer than their
+// TTL. It returns an error if the server has been stopped or the update queue
+// is full.
+func (s *Server) SendMetricUpdate(metrics map[string]interface{}, stale ...string) error {
+	s.stopMutex.Lock()
+	stopped := s.stopped
+	s.stopMutex.Unlock()
+	if stopped {
+		return fmt.Errorf("dashboard server is stopped")
+	}
+	
 	select {
 	case s.metrics <- MetricUpdate{
-		Timestamp: time.Now(),
+		Timestamp: time.Now().UTC(),
 		Metrics:   metrics,
+		Stale:     stale,
 	}:
+		return nil
 	default:
 		// Drop if channel is full
+		return fmt.Errorf("metric update queue full, dropping update")
 	}
 }
 
 func (s *Server) SendEventUpdate(eventType, message, rule string, data interface{}) {
 	event := EventUpdate{
-		Timestamp: time.Now(),
+		Timestamp: time.Now().UTC(),
 		Type:      eventType,
 		Message:   message,
 		Rule:      rule,
@@ -255,15 +399,10 @@ func (s *Server) SendEventUpdate(eventType, message, rule string, data interface
 }
 
 func (s *Server) createAlert(rule, message string, data interface{}) {
-	// Determine severity based on message content
-	severity := AlertSeverityMedium
-	msgLower := strings.ToLower(message)
-	if strings.Contains(msgLower, "critical") || strings.Contains(msgLower, "leak") {
-		severity = AlertSeverityCritical
-	} else if strings.Contains(msgLower, "high") || strings.Contains(msgLower, "warning") {
-		severity = AlertSeverityHigh
-	} else if strings.Contains(msgLower, "info") {
-		severity = AlertSeverityLow
+	// Prefer the severity supplied with the event; fall back to the message content
+	severity, ok := eventSeverity(data)
+	if !ok {
+		severity = AlertSeverity(actions.ClassifySeverity(message))
 	}
 	
 	alert := Alert{
@@ -272,10 +411,11 @@ func (s *Server) createAlert(rule, message string, data interface{}) {
 		Message:   message,
 		Severity:  severity,
 		Status:    AlertStatusActive,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
 		Notes:     []AlertNote{},
 		Metadata:  make(map[string]interface{}),
+		Labels:    eventLabels(data),
 	}
 	
 	if data != nil {
@@ -289,6 +429,33 @@ func (s *Server) createAlert(rule, message string, data interface{}) {
 	s.updateAlertsByStatus() // Safe within mutex lock
 }
 
+// eventSeverity extracts an explicit severity from event data
+func eventSeverity(data interface{}) (AlertSeverity, bool) {
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	severity, ok := fields["severity"].(string)
+	if !ok {
+		return "", false
+	}
+	switch AlertSeverity(severity) {
+	case AlertSeverityLow, AlertSeverityMedium, AlertSeverityHigh, AlertSeverityCritical:
+		return AlertSeverity(severity), true
+	}
+	return "", false
+}
+
+// eventLabels extracts rule labels from event data
+func eventLabels(data interface{}) map[string]string {
+	fields, ok := data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	labels, _ := fields["labels"].(map[string]string)
+	return labels
+}
+
 func generateAlertID() string {
 	// Simple ID generation - in production, use UUIDs
 	return fmt.Sprintf("alert_%d", time.Now().UnixNano())
@@ -299,8 +466,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 <html>
 <head>
     <title>Descry Dashboard</title>
-    <script src="https://cdn.jsdelivr.net/npm/chart.js"></script>
-    <script src="https://cdn.jsdelivr.net/npm/chartjs-adapter-date-fns/dist/chartjs-adapter-date-fns.bundle.min.js"></script>
+    <!--DESCRY_VENDOR_SCRIPTS-->
     <style>
         body { font-family: Arial, sans-serif; margin: 0; padding: 20px; background: #f5f5f5; }
         .header { background: #2c3e50; color: white; padding: 20px; border-radius: 5px; margin-bottom: 20px; }
@@ -308,7 +474,10 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         .card { background: white; padding: 20px; border-radius: 5px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); }
         .metric-value { font-size: 2em; font-weight: bold; color: #3498db; }
         .metric-label { color: #7f8c8d; margin-bottom: 10px; }
+        .metric-value.stale { color: #bdc3c7; }
         .chart-container { position: relative; height: 300px; }
+        .chart-export { text-align: right; margin-top: 5px; }
+        .chart-export button { font-size: 0.8em; padding: 2px 8px; margin-left: 4px; cursor: pointer; }
         .events-list { max-height: 400px; overflow-y: auto; }
         .event { padding: 10px; margin: 5px 0; border-left: 4px solid #3498db; background: #ecf0f1; }
         .event.alert { border-left-color: #e74c3c; }
@@ -323,21 +492,59 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         .tab.active { background: #3498db; color: white; }
         .tab-content { display: none; }
         .tab-content.active { display: block; }
+        .availability-row { margin: 8px 0; }
+        .availability-bars { display: flex; gap: 2px; height: 24px; align-items: flex-end; }
+        .availability-bar { flex: 1; background: #27ae60; min-height: 2px; }
+        .availability-bar.degraded { background: #f39c12; }
+        .availability-bar.down { background: #e74c3c; }
+        .availability-bar.empty { background: #ecf0f1; }
+        .breakdown-table { width: 100%; border-collapse: collapse; font-size: 13px; }
+        .breakdown-table th, .breakdown-table td { text-align: right; padding: 4px 6px; border-bottom: 1px solid #ecf0f1; }
+        .breakdown-table th:first-child, .breakdown-table td:first-child { text-align: left; word-break: break-all; }
+        .critical-banner { display: none; position: sticky; top: 0; z-index: 900; margin: -20px -20px 20px -20px; background: #c0392b; color: white; box-shadow: 0 2px 6px rgba(0,0,0,0.3); }
+        .critical-banner.visible { display: block; animation: critical-pulse 2s ease-in-out infinite; }
+        .critical-banner-item { display: flex; align-items: center; gap: 12px; padding: 12px 20px; border-bottom: 1px solid rgba(255,255,255,0.2); font-size: 1.2em; }
+        .critical-banner-item .message { flex: 1; cursor: pointer; }
+        .critical-banner-item button { background: transparent; color: white; border: 1px solid white; border-radius: 3px; padding: 4px 10px; cursor: pointer; }
+        .header-controls { float: right; font-size: 0.9em; margin-left: 15px; }
+        @keyframes critical-pulse { 0%, 100% { background: #c0392b; } 50% { background: #e74c3c; } }
+        .connection-status { display: none; position: fixed; bottom: 10px; right: 10px; z-index: 950; background: #f39c12; color: white; padding: 6px 12px; border-radius: 3px; }
+        .connection-status.visible { display: block; }
+        body.kiosk { background: #1c2833; height: 100vh; box-sizing: border-box; overflow: hidden; }
+        body.kiosk .kiosk-hidden { display: none; }
+        body.kiosk .header { padding: 10px 20px; margin-bottom: 10px; }
+        body.kiosk .header p, body.kiosk .header-controls, body.kiosk .tab-container, body.kiosk button, body.kiosk input, body.kiosk select { display: none; }
+        body.kiosk .tab-content.active { height: calc(100vh - 110px); overflow: hidden; }
+        body.kiosk .critical-banner-item .message { cursor: default; }
+        body.kiosk .chart-container, body.kiosk .events-list { height: calc((100vh - 260px) / 2); }
+        body.kiosk .kiosk-panel { height: 100%; box-sizing: border-box; font-size: 1.5em; }
+        .kiosk-health { display: grid; grid-template-columns: 1fr 1fr 1fr; gap: 20px; text-align: center; }
+        .kiosk-health .metric-value { font-size: 3em; }
+        .kiosk-alert { padding: 12px; margin: 8px 0; border-left: 8px solid #95a5a6; background: #ecf0f1; }
     </style>
 </head>
-<body>
+<body data-value-format="<!--DESCRY_VALUE_FORMAT-->">
+    <div class="critical-banner" id="critical-banner"></div>
+    <div class="connection-status" id="connection-status">Reconnecting...</div>
+    
     <div class="header">
+        <label class="header-controls" title="Play a chime when a new critical alert becomes active">
+            <input type="checkbox" id="alert-sound-toggle"> Alert sound
+        </label>
+        <label class="header-controls" title="Time zone used to show and enter timestamps">
+            Time zone: <select id="timezone-select"></select>
+        </label>
         <h1>Descry Dashboard</h1>
         <p>Real-time application monitoring and rule engine</p>
     </div>
     
     <div class="tab-container">
         <div class="tabs">
-            <div class="tab active" onclick="showTab('live')">Live Monitoring</div>
-            <div class="tab" onclick="showTab('playback')">Time Travel</div>
-            <div class="tab" onclick="showTab('rules')">Rule Editor</div>
-            <div class="tab" onclick="showTab('alerts')">Alert Manager</div>
-            <div class="tab" onclick="showTab('correlation')">Metric Correlation</div>
+            <div class="tab active" data-tab="live">Live Monitoring</div>
+            <div class="tab" data-tab="playback">Time Travel</div>
+            <div class="tab" data-tab="rules">Rule Editor</div>
+            <div class="tab" data-tab="alerts">Alert Manager</div>
+            <div class="tab" data-tab="correlation">Metric Correlation</div>
         </div>
     </div>
     
@@ -345,7 +552,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         <div class="grid">
         <div class="card">
             <div class="metric-label">Memory Usage</div>
-            <div class="metric-value" id="memory-value">-- MB</div>
+            <div class="metric-value" id="memory-value">--</div>
             <div class="chart-container">
                 <canvas id="memory-chart"></canvas>
             </div>
@@ -361,12 +568,20 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         
         <div class="card">
             <div class="metric-label">GC Pause Time</div>
-            <div class="metric-value" id="gc-value">-- μs</div>
+            <div class="metric-value" id="gc-value">--</div>
             <div class="chart-container">
                 <canvas id="gc-chart"></canvas>
             </div>
         </div>
         
+        <div class="card">
+            <div class="metric-label">Response Time Percentiles (last minute)</div>
+            <div class="metric-value" id="latency-value">--</div>
+            <div class="chart-container">
+                <canvas id="latency-chart"></canvas>
+            </div>
+        </div>
+        
         <div class="card">
             <h3>Recent Events</h3>
             <div class="events-list" id="events-list">
@@ -376,6 +591,71 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 </div>
             </div>
         </div>
+        
+        <div class="card kiosk-hidden">
+            <div class="metric-label">Custom Metrics
+                <select id="custom-metric-select" style="margin-left: 10px;"><option value="">No custom metrics yet</option></select>
+            </div>
+            <div class="metric-value" id="custom-metric-value">--</div>
+            <div class="chart-container">
+                <canvas id="custom-metric-chart"></canvas>
+            </div>
+        </div>
+        
+        <div class="card kiosk-hidden">
+            <div class="metric-label">Endpoints
+                <select id="breakdown-select" style="margin-left: 10px;">
+                    <option value="routes">By route</option>
+                    <option value="methods">By method</option>
+                </select>
+            </div>
+            <div class="timestamp" id="breakdown-status-classes">--</div>
+            <table class="breakdown-table">
+                <thead><tr><th>Endpoint</th><th>Requests</th><th>Errors</th><th>Avg</th><th>p95</th><th>p99</th></tr></thead>
+                <tbody id="breakdown-rows"><tr><td colspan="6">No requests yet</td></tr></tbody>
+            </table>
+        </div>
+        
+        <div class="card kiosk-hidden">
+            <h3>Rule Availability (30 days)</h3>
+            <div class="metric-label">Uptime: <span id="uptime-value">--</span></div>
+            <div id="availability-list">
+                <div class="timestamp">No rule evaluations yet</div>
+            </div>
+        </div>
+        </div>
+    </div>
+    
+    <div id="kiosk-health-tab" class="tab-content">
+        <div class="card kiosk-panel">
+            <h2>System Health</h2>
+            <div class="kiosk-health">
+                <div>
+                    <div class="metric-label">Status</div>
+                    <div class="metric-value" id="kiosk-status">--</div>
+                </div>
+                <div>
+                    <div class="metric-label">Health Score</div>
+                    <div class="metric-value" id="kiosk-health-score">--</div>
+                </div>
+                <div>
+                    <div class="metric-label">Uptime (24h)</div>
+                    <div class="metric-value" id="kiosk-uptime">--</div>
+                </div>
+            </div>
+            <h3>Rule Availability (30 days)</h3>
+            <div id="kiosk-availability-list">
+                <div class="timestamp">No rule evaluations yet</div>
+            </div>
+        </div>
+    </div>
+    
+    <div id="kiosk-alerts-tab" class="tab-content">
+        <div class="card kiosk-panel">
+            <h2>Top Active Alerts</h2>
+            <div id="kiosk-alerts-list">
+                <div class="timestamp">No active alerts</div>
+            </div>
         </div>
     </div>
     
@@ -389,6 +669,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             
             <label>To: </label>
             <input type="datetime-local" id="playback-to" />
+            <span class="timezone-label"></span>
             
             <label>Speed: </label>
             <select id="playback-speed">
@@ -399,10 +680,10 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 <option value="10">10x</option>
             </select>
             
-            <button onclick="startPlayback()">Start Playback</button>
-            <button onclick="stopPlayback()">Stop</button>
-            <button onclick="loadLastHour()">Last Hour</button>
-            <button onclick="loadLast10Minutes()">Last 10 Min</button>
+            <button id="playback-start">Start Playback</button>
+            <button id="playback-stop">Stop</button>
+            <button id="playback-last-hour">Last Hour</button>
+            <button id="playback-last-10m">Last 10 Min</button>
             
             <div class="playback-status" id="playback-status">Ready</div>
         </div>
@@ -410,7 +691,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         <div class="grid">
             <div class="card">
                 <div class="metric-label">Memory Usage (Playback)</div>
-                <div class="metric-value" id="playback-memory-value">-- MB</div>
+                <div class="metric-value" id="playback-memory-value">--</div>
                 <div class="chart-container">
                     <canvas id="playback-memory-chart"></canvas>
                 </div>
@@ -426,7 +707,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             
             <div class="card">
                 <div class="metric-label">GC Pause Time (Playback)</div>
-                <div class="metric-value" id="playback-gc-value">-- μs</div>
+                <div class="metric-value" id="playback-gc-value">--</div>
                 <div class="chart-container">
                     <canvas id="playback-gc-chart"></canvas>
                 </div>
@@ -459,9 +740,9 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 }" style="width: 100%; height: 200px; margin: 5px 0; padding: 8px; font-family: monospace;"></textarea>
                 
                 <div style="margin: 10px 0;">
-                    <button onclick="validateRule()" style="background: #3498db; color: white; border: none; padding: 8px 16px; border-radius: 3px; margin-right: 10px;">Validate</button>
-                    <button onclick="saveRule()" style="background: #2ecc71; color: white; border: none; padding: 8px 16px; border-radius: 3px; margin-right: 10px;">Save</button>
-                    <button onclick="testRule()" style="background: #f39c12; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Test</button>
+                    <button id="rule-validate" style="background: #3498db; color: white; border: none; padding: 8px 16px; border-radius: 3px; margin-right: 10px;">Validate</button>
+                    <button id="rule-save" style="background: #2ecc71; color: white; border: none; padding: 8px 16px; border-radius: 3px; margin-right: 10px;">Save</button>
+                    <button id="rule-test" style="background: #f39c12; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Test</button>
                 </div>
                 
                 <div id="rule-status" style="padding: 10px; margin: 10px 0; border-radius: 3px; background: #ecf0f1;"></div>
@@ -480,6 +761,8 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                         <li><code>heap.alloc</code> - Heap allocated memory</li>
                         <li><code>goroutines.count</code> - Active goroutines</li>
                         <li><code>gc.pause</code> - GC pause time</li>
+                        <li><code>gc.pause_p99</code> - 99th percentile GC pause</li>
+                        <li><code>sched.latency_p99</code> - 99th percentile scheduler latency</li>
                         <li><code>http.response_time</code> - HTTP response time</li>
                         <li><code>http.request_rate</code> - HTTP requests per second</li>
                     </ul>
@@ -489,12 +772,21 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                         <li><code>avg(metric, duration)</code> - Average value</li>
                         <li><code>max(metric, duration)</code> - Maximum value</li>
                         <li><code>trend(metric, duration)</code> - Trend direction</li>
+                        <li><code>anomaly(metric, duration)</code> - Deviation from baseline</li>
+                        <li><code>changepoint(metric, duration)</code> - Shift in baseline level</li>
+                        <li><code>deviates(metric, percent, window, baseline)</code> - Departure from a learned baseline</li>
+                        <li><code>route(path, statistic)</code> - Per-route p99, error rate, ...</li>
+                        <li><code>canary(metric, canary, baseline)</code> - Canary vs baseline difference (%)</li>
+                        <li><code>event(type)</code> - Whether an event occurred recently</li>
+                        <li><code>goroutine_leak(window)</code> - Goroutine creation sites growing steadily</li>
+                        <li><code>format(value, kind)</code> - Number as text, e.g. <code>"Heap " + format(heap.alloc, "bytes")</code></li>
                     </ul>
                     
                     <h5>Actions:</h5>
                     <ul>
                         <li><code>alert("message")</code> - Send alert</li>
                         <li><code>log("message")</code> - Log message</li>
+                        <li><code>capture_profile("heap")</code> - Capture a pprof profile for download</li>
                     </ul>
                     
                     <h5>Example:</h5>
@@ -504,6 +796,47 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 </div>
             </div>
         </div>
+        
+        <div class="card" style="margin-top: 20px;">
+            <h3>Load Simulation</h3>
+            <p>Replay synthetic metric profiles through the rules to see which would fire and when. Rule actions do not run; metrics without a profile keep their current values.</p>
+            
+            <div id="simulation-profiles"></div>
+            <datalist id="simulation-metrics"></datalist>
+            <button id="simulation-add-profile" style="background: #95a5a6; color: white; border: none; padding: 6px 12px; border-radius: 3px;">Add Profile</button>
+            
+            <div style="margin: 10px 0;">
+                <label>Duration (s): <input type="number" id="simulation-duration" value="600" min="1" style="width: 80px;" /></label>
+                <label>Step (s): <input type="number" id="simulation-step" value="10" min="0.1" step="any" style="width: 80px;" /></label>
+                <label><input type="checkbox" id="simulation-use-editor" /> Simulate the rule in the editor instead of the loaded rules</label>
+                <button id="simulation-run" style="background: #8e44ad; color: white; border: none; padding: 8px 16px; border-radius: 3px; margin-left: 10px;">Run Simulation</button>
+            </div>
+            
+            <div id="simulation-status" class="timestamp"></div>
+            <div class="chart-container">
+                <canvas id="simulation-chart"></canvas>
+            </div>
+            <div id="simulation-results"></div>
+        </div>
+        
+        <div class="card" style="margin-top: 20px;">
+            <h3>Rule Bundles</h3>
+            <p>Export every rule with its metadata, group defaults and alert routes to move them to another environment or share them as a rule pack, then preview the changes before importing.</p>
+            
+            <div style="margin: 10px 0;">
+                <a href="/api/rules/export?format=json" download style="background: #3498db; color: white; padding: 8px 16px; border-radius: 3px; text-decoration: none; margin-right: 10px;">Export JSON</a>
+                <a href="/api/rules/export?format=tar" download style="background: #3498db; color: white; padding: 8px 16px; border-radius: 3px; text-decoration: none;">Export tar.gz</a>
+            </div>
+            
+            <div style="margin: 15px 0;">
+                <input type="file" id="bundle-file" accept=".json,.gz,.tgz" />
+                <label><input type="checkbox" id="bundle-replace" /> Remove rules that are not in the bundle</label>
+                <button id="bundle-preview" style="background: #95a5a6; color: white; border: none; padding: 8px 16px; border-radius: 3px; margin-left: 10px;">Preview</button>
+                <button id="bundle-import" style="background: #2ecc71; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Import</button>
+            </div>
+            
+            <div id="bundle-status"></div>
+        </div>
     </div>
     
     <div id="alerts-tab" class="tab-content">
@@ -512,7 +845,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             <p>Monitor and manage system alerts with acknowledgement and resolution tracking</p>
             
             <div style="display: flex; gap: 10px; margin-bottom: 20px;">
-                <select id="alert-status-filter" onchange="loadAlerts()">
+                <select id="alert-status-filter">
                     <option value="">All Statuses</option>
                     <option value="active">Active</option>
                     <option value="acknowledged">Acknowledged</option>
@@ -520,7 +853,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                     <option value="suppressed">Suppressed</option>
                 </select>
                 
-                <select id="alert-severity-filter" onchange="loadAlerts()">
+                <select id="alert-severity-filter">
                     <option value="">All Severities</option>
                     <option value="critical">Critical</option>
                     <option value="high">High</option>
@@ -528,7 +861,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                     <option value="low">Low</option>
                 </select>
                 
-                <button onclick="loadAlerts()" style="background: #3498db; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Refresh</button>
+                <button id="alerts-refresh" style="background: #3498db; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Refresh</button>
                 
                 <div style="margin-left: auto;">
                     <span id="alert-summary">Loading alerts...</span>
@@ -536,6 +869,22 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             </div>
         </div>
         
+        <div class="card" style="margin-bottom: 20px;">
+            <h3>Action Quotas</h3>
+            <table class="breakdown-table">
+                <thead><tr><th>Quota</th><th>Used</th><th>Limit</th><th>Window</th><th>Dropped</th></tr></thead>
+                <tbody id="quota-rows"><tr><td colspan="5">No quotas configured</td></tr></tbody>
+            </table>
+        </div>
+        
+        <div class="card" style="margin-bottom: 20px;">
+            <h3>Profiles</h3>
+            <table class="breakdown-table">
+                <thead><tr><th>Captured</th><th>Rule</th><th>Type</th><th>Size</th><th></th></tr></thead>
+                <tbody id="profile-rows"><tr><td colspan="5">No profiles captured</td></tr></tbody>
+            </table>
+        </div>
+        
         <div id="alerts-list" style="min-height: 400px;">
             <div style="text-align: center; padding: 50px; color: #7f8c8d;">
                 Loading alerts...
@@ -553,11 +902,12 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                     <textarea id="modal-note" placeholder="Add a note..." style="width: 100%; height: 80px; margin: 5px 0; padding: 8px;"></textarea>
                     
                     <div style="display: flex; gap: 10px; margin-top: 10px;">
-                        <button onclick="acknowledgeAlert()" style="background: #f39c12; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Acknowledge</button>
-                        <button onclick="resolveAlert()" style="background: #2ecc71; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Resolve</button>
-                        <button onclick="suppressAlert()" style="background: #95a5a6; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Suppress</button>
-                        <button onclick="addAlertNote()" style="background: #3498db; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Add Note</button>
-                        <button onclick="closeAlertModal()" style="background: #e74c3c; color: white; border: none; padding: 8px 16px; border-radius: 3px; margin-left: auto;">Close</button>
+                        <button id="modal-acknowledge" style="background: #f39c12; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Acknowledge</button>
+                        <button id="modal-resolve" style="background: #2ecc71; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Resolve</button>
+                        <button id="modal-suppress" style="background: #95a5a6; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Suppress</button>
+                        <button id="modal-add-note" style="background: #3498db; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Add Note</button>
+                        <button id="modal-export" style="background: #34495e; color: white; border: none; padding: 8px 16px; border-radius: 3px;">Export</button>
+                        <button id="modal-close" style="background: #e74c3c; color: white; border: none; padding: 8px 16px; border-radius: 3px; margin-left: auto;">Close</button>
                     </div>
                 </div>
             </div>
@@ -592,6 +942,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                         <option value="60" selected>Last 1 hour</option>
                         <option value="180">Last 3 hours</option>
                         <option value="360">Last 6 hours</option>
+                        <option value="1440">Last 24 hours</option>
                     </select>
                 </div>
                 
@@ -606,11 +957,40 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 </div>
                 
                 <div>
-                    <button onclick="analyzeCorrelation()" style="background: #3498db; color: white; border: none; padding: 10px 20px; border-radius: 3px; white-space: nowrap;">Analyze</button>
+                    <button id="correlation-analyze" style="background: #3498db; color: white; border: none; padding: 10px 20px; border-radius: 3px; white-space: nowrap;">Analyze</button>
+                </div>
+            </div>
+            
+            <div id="correlation-queries" style="display: none; grid-template-columns: 1fr 1fr; gap: 10px;">
+                <div>
+                    <label>X-Axis <span class="query-language-name"></span> query (replaces the metric):</label>
+                    <input type="text" id="query-x" placeholder="e.g. sum(rate(http_request_count[5m]))" style="width: 100%; padding: 8px; box-sizing: border-box;">
+                </div>
+                <div>
+                    <label>Y-Axis <span class="query-language-name"></span> query (replaces the metric):</label>
+                    <input type="text" id="query-y" placeholder="e.g. avg_over_time(heap_alloc[5m])" style="width: 100%; padding: 8px; box-sizing: border-box;">
                 </div>
             </div>
         </div>
         
+        <div id="query-card" class="card" style="display: none; margin-bottom: 20px;">
+            <h3><span class="query-language-name"></span> Query</h3>
+            <div style="display: grid; grid-template-columns: 1fr auto auto; gap: 10px; align-items: end; margin-bottom: 10px;">
+                <input type="text" id="query-input" placeholder="e.g. rate(gc_num[5m])" style="padding: 8px;">
+                <select id="query-range" style="padding: 8px;">
+                    <option value="15">Last 15 minutes</option>
+                    <option value="60" selected>Last 1 hour</option>
+                    <option value="360">Last 6 hours</option>
+                    <option value="1440">Last 24 hours</option>
+                </select>
+                <button id="query-run" style="background: #3498db; color: white; border: none; padding: 10px 20px; border-radius: 3px;">Run</button>
+            </div>
+            <div id="query-status" style="color: #7f8c8d; margin-bottom: 10px;"></div>
+            <div style="position: relative; height: 300px;">
+                <canvas id="query-chart"></canvas>
+            </div>
+        </div>
+        
         <div style="display: grid; grid-template-columns: 2fr 1fr; gap: 20px;">
             <div class="card">
                 <h3>Correlation Scatter Plot</h3>
@@ -639,19 +1019,61 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 
                 <h4 style="margin-top: 30px;">Quick Analysis</h4>
                 <div style="display: grid; grid-template-columns: 1fr 1fr; gap: 10px;">
-                    <button onclick="quickAnalysis('heap.alloc', 'goroutines.count')" style="background: #2ecc71; color: white; border: none; padding: 8px; border-radius: 3px; font-size: 0.9em;">Memory vs Goroutines</button>
-                    <button onclick="quickAnalysis('heap.alloc', 'gc.pause')" style="background: #e67e22; color: white; border: none; padding: 8px; border-radius: 3px; font-size: 0.9em;">Memory vs GC Pause</button>
-                    <button onclick="quickAnalysis('goroutines.count', 'gc.pause')" style="background: #9b59b6; color: white; border: none; padding: 8px; border-radius: 3px; font-size: 0.9em;">Goroutines vs GC</button>
-                    <button onclick="quickAnalysis('http.response_time', 'http.request_rate')" style="background: #34495e; color: white; border: none; padding: 8px; border-radius: 3px; font-size: 0.9em;">Response vs Request Rate</button>
+                    <button class="quick-analysis" data-metrics="heap.alloc goroutines.count" style="background: #2ecc71; color: white; border: none; padding: 8px; border-radius: 3px; font-size: 0.9em;">Memory vs Goroutines</button>
+                    <button class="quick-analysis" data-metrics="heap.alloc gc.pause" style="background: #e67e22; color: white; border: none; padding: 8px; border-radius: 3px; font-size: 0.9em;">Memory vs GC Pause</button>
+                    <button class="quick-analysis" data-metrics="goroutines.count gc.pause" style="background: #9b59b6; color: white; border: none; padding: 8px; border-radius: 3px; font-size: 0.9em;">Goroutines vs GC</button>
+                    <button class="quick-analysis" data-metrics="http.response_time http.request_rate" style="background: #34495e; color: white; border: none; padding: 8px; border-radius: 3px; font-size: 0.9em;">Response vs Request Rate</button>
                 </div>
             </div>
         </div>
     </div>
 
-    <script>
-        // WebSocket connection - use dynamic host detection
+    <script nonce="<!--DESCRY_NONCE-->">
+        // WebSocket connection - use dynamic host detection. The connection is
+        // reopened with backoff when it drops, so unattended displays recover
+        // from restarts of the monitored application.
         const protocol = location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const ws = new WebSocket(protocol + '//' + location.host + '/ws');
+        let ws = null;
+        let reconnectDelay = 1000;
+        
+        // Value formatting follows the engine's ValueFormat so the dashboard
+        // shows byte sizes, durations and numbers the same way as alert
+        // messages and exports. Durations from the server are in nanoseconds.
+        const valueFormat = JSON.parse(document.body.dataset.valueFormat || '{}');
+        
+        function formatFixed(value, decimals) {
+            if (!isFinite(value)) return String(value);
+            const [whole, fraction] = Math.abs(value).toFixed(decimals).split('.');
+            const grouped = whole.replace(/\B(?=(\d{3})+(?!\d))/g, valueFormat.group ?? ',');
+            return (value < 0 && Number(value.toFixed(decimals)) !== 0 ? '-' : '') + grouped +
+                (fraction ? (valueFormat.decimal ?? '.') + fraction : '');
+        }
+        
+        function formatNumber(value) {
+            return formatFixed(value, Number.isInteger(value) ? 0 : (valueFormat.decimals ?? 2));
+        }
+        
+        function formatScaled(value, steps, smallest) {
+            for (const [size, name] of steps) {
+                if (Math.abs(value) >= size) return formatFixed(value / size, valueFormat.decimals ?? 2) + ' ' + name;
+            }
+            return formatNumber(value) + ' ' + smallest;
+        }
+        
+        function formatBytes(bytes) {
+            const si = valueFormat.system === 'si';
+            const base = si ? 1000 : 1024;
+            const names = si ? ['kB', 'MB', 'GB', 'TB', 'PB'] : ['KiB', 'MiB', 'GiB', 'TiB', 'PiB'];
+            return formatScaled(bytes, names.map((name, i) => [Math.pow(base, i + 1), name]).reverse(), 'B');
+        }
+        
+        function formatDuration(ns) {
+            return formatScaled(ns, [[3.6e12, 'h'], [6e10, 'min'], [1e9, 's'], [1e6, 'ms'], [1e3, 'μs']], 'ns');
+        }
+        
+        function formatPercent(value) {
+            return formatFixed(value, valueFormat.decimals ?? 2) + '%';
+        }
         
         // Chart configurations
         const chartConfig = {
@@ -662,17 +1084,84 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 scales: {
                     x: {
                         type: 'time',
-                        time: { unit: 'second' }
+                        time: { unit: 'second' },
+                        ticks: { callback: value => formatTime(value) }
                     },
                     y: { beginAtZero: true }
                 },
-                plugins: { legend: { display: false } }
+                plugins: {
+                    legend: { display: false },
+                    tooltip: { callbacks: { title: items => formatTimestamp(items[0].parsed.x) } }
+                }
             }
         };
         
+        // unitChartConfig returns chartConfig with the y axis and tooltips
+        // showing values through a formatter such as formatBytes
+        function unitChartConfig(format) {
+            const options = chartConfig.options;
+            return {
+                ...chartConfig,
+                options: {
+                    ...options,
+                    scales: { ...options.scales, y: { beginAtZero: true, ticks: { callback: value => format(value) } } },
+                    plugins: {
+                        ...options.plugins,
+                        tooltip: { callbacks: { ...options.plugins.tooltip.callbacks, label: item => format(item.parsed.y) } }
+                    }
+                }
+            };
+        }
+        
+        // Firing-state bands: time charts are shaded behind their lines
+        // while any rule's condition held, from /api/rules/states
+        let firingIntervals = [];
+        
+        Chart.register({
+            id: 'firingBands',
+            beforeDatasetsDraw(chart) {
+                const x = chart.scales.x;
+                if (!x || x.type !== 'time' || firingIntervals.length === 0) {
+                    return;
+                }
+                const area = chart.chartArea;
+                const ctx = chart.ctx;
+                ctx.save();
+                ctx.fillStyle = 'rgba(231, 76, 60, 0.12)';
+                firingIntervals.forEach(interval => {
+                    // A single evaluation still gets a visible band
+                    const left = Math.max(x.getPixelForValue(interval.start), area.left);
+                    const right = Math.min(Math.max(x.getPixelForValue(interval.end), left + 2), area.right);
+                    if (right > left) {
+                        ctx.fillRect(left, area.top, right - left, area.bottom - area.top);
+                    }
+                });
+                ctx.restore();
+            }
+        });
+        
+        /**
+         * Loads when each rule's condition held over the last hour for the
+         * firing-state bands
+         */
+        function loadRuleStates() {
+            fetch('/api/rules/states')
+                .then(response => response.json())
+                .then(result => {
+                    firingIntervals = [];
+                    (result.data || []).forEach(rule => {
+                        rule.intervals.filter(interval => interval.firing).forEach(interval => {
+                            firingIntervals.push({ rule: rule.rule, start: Date.parse(interval.start), end: Date.parse(interval.end) });
+                        });
+                    });
+                    Object.values(Chart.instances).forEach(chart => chart.update('none'));
+                })
+                .catch(error => console.error('Error loading rule states:', error));
+        }
+        
         // Initialize charts
         const memoryChart = new Chart(document.getElementById('memory-chart'), {
-            ...chartConfig,
+            ...unitChartConfig(formatBytes),
             data: { datasets: [{ data: [], borderColor: '#3498db', fill: false }] }
         });
         
@@ -682,13 +1171,33 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         });
         
         const gcChart = new Chart(document.getElementById('gc-chart'), {
-            ...chartConfig,
+            ...unitChartConfig(formatDuration),
             data: { datasets: [{ data: [], borderColor: '#e74c3c', fill: false }] }
         });
         
+        const latencyConfig = unitChartConfig(formatDuration);
+        const latencyChart = new Chart(document.getElementById('latency-chart'), {
+            ...latencyConfig,
+            data: { datasets: [
+                { label: 'p50', data: [], borderColor: '#2ecc71', fill: false },
+                { label: 'p95', data: [], borderColor: '#f39c12', fill: false },
+                { label: 'p99', data: [], borderColor: '#e74c3c', fill: false }
+            ] },
+            options: {
+                ...latencyConfig.options,
+                plugins: { ...latencyConfig.options.plugins, legend: { display: true } }
+            }
+        });
+        
+        const customMetricChart = new Chart(document.getElementById('custom-metric-chart'), {
+            ...chartConfig,
+            data: { datasets: [{ data: [], borderColor: '#9b59b6', fill: false }] }
+        });
+        document.getElementById('custom-metric-select').addEventListener('change', event => selectCustomMetric(event.target.value));
+        
         // Playback charts
         const playbackMemoryChart = new Chart(document.getElementById('playback-memory-chart'), {
-            ...chartConfig,
+            ...unitChartConfig(formatBytes),
             data: { datasets: [{ data: [], borderColor: '#3498db', fill: false }] }
         });
         
@@ -698,7 +1207,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         });
         
         const playbackGcChart = new Chart(document.getElementById('playback-gc-chart'), {
-            ...chartConfig,
+            ...unitChartConfig(formatDuration),
             data: { datasets: [{ data: [], borderColor: '#e74c3c', fill: false }] }
         });
         
@@ -747,13 +1256,16 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         });
         
         // WebSocket message handling
-        ws.onmessage = function(event) {
+        function handleWebSocketMessage(event) {
             const data = JSON.parse(event.data);
             
             if (data.type === 'metrics') {
                 updateMetrics(data.data);
             } else if (data.type === 'event') {
                 addEvent(data.data);
+                if (data.data.type === 'alert') {
+                    scheduleCriticalBannerRefresh();
+                }
             } else if (data.type === 'playback_metric') {
                 updatePlaybackMetrics(data.data);
             } else if (data.type === 'playback_event') {
@@ -761,7 +1273,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             } else if (data.type === 'playback_complete') {
                 document.getElementById('playback-status').textContent = 'Playback Complete';
             }
-        };
+        }
         
         /**
          * Updates the live monitoring dashboard with new metrics data
@@ -790,42 +1302,115 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             
             // Update memory
             if (metrics['heap.alloc'] !== undefined) {
-                const memMB = Math.round(metrics['heap.alloc'] / 1024 / 1024);
-                document.getElementById('memory-value').textContent = memMB + ' MB';
-                addDataPoint(memoryChart, timestamp, memMB);
+                document.getElementById('memory-value').textContent = formatBytes(metrics['heap.alloc']);
+                addDataPoint(memoryChart, timestamp, metrics['heap.alloc']);
+            }
+            
+            // Update engine uptime
+            if (metrics['uptime.seconds'] !== undefined) {
+                const seconds = Math.floor(metrics['uptime.seconds']);
+                const days = Math.floor(seconds / 86400);
+                const hours = Math.floor((seconds % 86400) / 3600);
+                const minutes = Math.floor((seconds % 3600) / 60);
+                document.getElementById('uptime-value').textContent = days + 'd ' + hours + 'h ' + minutes + 'm';
             }
             
             // Update goroutines
             if (metrics['goroutines.count'] !== undefined) {
-                document.getElementById('goroutines-value').textContent = metrics['goroutines.count'];
+                document.getElementById('goroutines-value').textContent = formatNumber(metrics['goroutines.count']);
                 addDataPoint(goroutinesChart, timestamp, metrics['goroutines.count']);
             }
             
             // Update GC pause
             if (metrics['gc.pause'] !== undefined) {
-                const pauseUs = Math.round(metrics['gc.pause'] / 1000);
-                document.getElementById('gc-value').textContent = pauseUs + ' μs';
-                addDataPoint(gcChart, timestamp, pauseUs);
+                document.getElementById('gc-value').textContent = formatDuration(metrics['gc.pause']);
+                addDataPoint(gcChart, timestamp, metrics['gc.pause']);
+            }
+            
+            // Update response time percentiles
+            if (metrics['http.p95_response_time'] !== undefined) {
+                document.getElementById('latency-value').textContent = 'p95 ' + formatDuration(metrics['http.p95_response_time']);
+                addDataPoint(latencyChart, timestamp, metrics['http.p50_response_time'], 0);
+                addDataPoint(latencyChart, timestamp, metrics['http.p95_response_time'], 1);
+                addDataPoint(latencyChart, timestamp, metrics['http.p99_response_time'], 2);
+            }
+            
+            updateCustomMetricChart(metrics, timestamp, metricsData.stale || []);
+        }
+        
+        // Custom metrics: the chart follows the selected custom.* metric,
+        // starting from the dashboard's history of the last 10 minutes.
+        // Metrics past their TTL are greyed out and marked stale.
+        function updateCustomMetricChart(metrics, timestamp, stale) {
+            const select = document.getElementById('custom-metric-select');
+            const names = Object.keys(metrics).filter(name => name.startsWith('custom.')).sort();
+            const known = Array.from(select.options).map(option => option.value).filter(Boolean);
+            const added = names.filter(name => !known.includes(name));
+            if (added.length > 0 && known.length === 0) {
+                select.options[0].textContent = 'Select metric...';
+            }
+            added.forEach(name => select.add(new Option(name, name)));
+            Array.from(select.options).filter(option => option.value).forEach(option => {
+                option.textContent = stale.includes(option.value) ? option.value + ' (stale)' : option.value;
+            });
+            const selected = select.value;
+            const value = document.getElementById('custom-metric-value');
+            value.classList.toggle('stale', stale.includes(selected));
+            if (selected && metrics[selected] !== undefined) {
+                value.textContent = formatNumber(metrics[selected]);
+                addDataPoint(customMetricChart, timestamp, metrics[selected]);
             }
         }
         
+        function selectCustomMetric(name) {
+            customMetricChart.data.datasets[0].data = [];
+            customMetricChart.update('none');
+            document.getElementById('custom-metric-value').textContent = '--';
+            if (!name) return;
+            const from = new Date(Date.now() - 10 * 60 * 1000).toISOString();
+            fetch('/api/history/metrics?from=' + encodeURIComponent(from))
+                .then(response => response.json())
+                .then(data => {
+                    if (document.getElementById('custom-metric-select').value !== name) return;
+                    const points = (data.data || [])
+                        .filter(update => update.metrics && update.metrics[name] !== undefined)
+                        .map(update => ({ x: new Date(update.timestamp), y: update.metrics[name] }));
+                    customMetricChart.data.datasets[0].data = points.slice(-50);
+                    customMetricChart.update('none');
+                    if (points.length > 0) {
+                        document.getElementById('custom-metric-value').textContent = formatNumber(points[points.length - 1].y);
+                    }
+                })
+                .catch(error => console.error('Error loading custom metric history:', error));
+        }
+        
         /**
          * Adds a new data point to a Chart.js chart and maintains a sliding window
          * @param {Chart} chart - Chart.js chart instance
          * @param {Date} timestamp - Timestamp for the x-axis
          * @param {number} value - Value for the y-axis
          */
-        function addDataPoint(chart, timestamp, value) {
-            chart.data.datasets[0].data.push({ x: timestamp, y: value });
+        function addDataPoint(chart, timestamp, value, dataset = 0) {
+            const data = chart.data.datasets[dataset].data;
+            data.push({ x: timestamp, y: value });
             
             // Keep only last 50 points
-            if (chart.data.datasets[0].data.length > 50) {
-                chart.data.datasets[0].data.shift();
+            if (data.length > 50) {
+                data.shift();
             }
             
             chart.update('none');
         }
-        
+
+        // eventClass picks the timeline style for an event type: alerts in red,
+        // rules stopped at a resource limit in amber, everything else in blue
+        function eventClass(type) {
+            if (type === 'alert') {
+                return 'alert';
+            }
+            return type === 'limit' ? 'warning' : 'info';
+        }
+
         /**
          * Adds a new event to the live events timeline
          * 
@@ -851,11 +1436,11 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         function addEvent(event) {
             const eventsList = document.getElementById('events-list');
             const eventDiv = document.createElement('div');
-            eventDiv.className = 'event ' + (event.type === 'alert' ? 'alert' : 'info');
+            eventDiv.className = 'event ' + eventClass(event.type);
             
             eventDiv.innerHTML = 
                 '<div><strong>[' + event.rule + ']</strong> ' + event.message + '</div>' +
-                '<div class="timestamp">' + new Date(event.timestamp).toLocaleString() + '</div>';
+                '<div class="timestamp">' + timestampHTML(event.timestamp) + '</div>';
             
             eventsList.insertBefore(eventDiv, eventsList.firstChild);
             
@@ -865,13 +1450,25 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             }
         }
         
-        ws.onopen = function() {
-            console.log('Connected to Descry dashboard');
-        };
+        function connectWebSocket() {
+            ws = new WebSocket(protocol + '//' + location.host + '/ws');
+            ws.onmessage = handleWebSocketMessage;
+            
+            ws.onopen = function() {
+                console.log('Connected to Descry dashboard');
+                reconnectDelay = 1000;
+                document.getElementById('connection-status').classList.remove('visible');
+            };
+            
+            ws.onclose = function() {
+                console.log('Disconnected from Descry dashboard, reconnecting in ' + reconnectDelay + 'ms');
+                document.getElementById('connection-status').classList.add('visible');
+                setTimeout(connectWebSocket, reconnectDelay);
+                reconnectDelay = Math.min(reconnectDelay * 2, 30000);
+            };
+        }
         
-        ws.onclose = function() {
-            console.log('Disconnected from Descry dashboard');
-        };
+        connectWebSocket();
         
         /**
          * Switches between dashboard tabs (Live, Time Travel, Rule Editor, etc.)
@@ -891,8 +1488,48 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             // Show selected tab content
             document.getElementById(tabName + '-tab').classList.add('active');
             
-            // Add active class to clicked tab
-            event.target.classList.add('active');
+            // Add active class to the selected tab
+            document.querySelector('.tab[data-tab="' + tabName + '"]').classList.add('active');
+        }
+        
+        // Controls are bound here rather than with inline handlers, which the
+        // Content-Security-Policy does not allow
+        function bindControls() {
+            const onClick = (id, handler) => document.getElementById(id).addEventListener('click', handler);
+            const onChange = (id, handler) => document.getElementById(id).addEventListener('change', handler);
+            
+            document.querySelectorAll('.tab').forEach(tab => {
+                tab.addEventListener('click', () => showTab(tab.dataset.tab));
+            });
+            onChange('alert-sound-toggle', event => setAlertSound(event.target.checked));
+            onChange('timezone-select', event => setTimeZone(event.target.value));
+            onChange('breakdown-select', loadHTTPBreakdown);
+            onClick('playback-start', startPlayback);
+            onClick('playback-stop', stopPlayback);
+            onClick('playback-last-hour', loadLastHour);
+            onClick('playback-last-10m', loadLast10Minutes);
+            onClick('rule-validate', validateRule);
+            onClick('rule-save', saveRule);
+            onClick('rule-test', testRule);
+            onClick('simulation-add-profile', addSimulationProfile);
+            onClick('simulation-run', runSimulation);
+            onClick('bundle-preview', () => importBundle(true));
+            onClick('bundle-import', () => importBundle(false));
+            onChange('alert-status-filter', loadAlerts);
+            onChange('alert-severity-filter', loadAlerts);
+            onClick('alerts-refresh', loadAlerts);
+            onClick('modal-acknowledge', acknowledgeAlert);
+            onClick('modal-resolve', resolveAlert);
+            onClick('modal-suppress', suppressAlert);
+            onClick('modal-add-note', addAlertNote);
+            onClick('modal-export', exportIncident);
+            onClick('modal-close', closeAlertModal);
+            onClick('correlation-analyze', analyzeCorrelation);
+            onClick('query-run', runQuery);
+            document.querySelectorAll('.quick-analysis').forEach(button => {
+                const [metricX, metricY] = button.dataset.metrics.split(' ');
+                button.addEventListener('click', () => quickAnalysis(metricX, metricY));
+            });
         }
         
         /**
@@ -905,33 +1542,31 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             
             // Update memory
             if (metrics.metrics && metrics.metrics['heap.alloc'] !== undefined) {
-                const memMB = Math.round(metrics.metrics['heap.alloc'] / 1024 / 1024);
-                document.getElementById('playback-memory-value').textContent = memMB + ' MB';
-                addDataPoint(playbackMemoryChart, timestamp, memMB);
+                document.getElementById('playback-memory-value').textContent = formatBytes(metrics.metrics['heap.alloc']);
+                addDataPoint(playbackMemoryChart, timestamp, metrics.metrics['heap.alloc']);
             }
             
             // Update goroutines
             if (metrics.metrics && metrics.metrics['goroutines.count'] !== undefined) {
-                document.getElementById('playback-goroutines-value').textContent = metrics.metrics['goroutines.count'];
+                document.getElementById('playback-goroutines-value').textContent = formatNumber(metrics.metrics['goroutines.count']);
                 addDataPoint(playbackGoroutinesChart, timestamp, metrics.metrics['goroutines.count']);
             }
             
             // Update GC pause
             if (metrics.metrics && metrics.metrics['gc.pause'] !== undefined) {
-                const pauseUs = Math.round(metrics.metrics['gc.pause'] / 1000);
-                document.getElementById('playback-gc-value').textContent = pauseUs + ' μs';
-                addDataPoint(playbackGcChart, timestamp, pauseUs);
+                document.getElementById('playback-gc-value').textContent = formatDuration(metrics.metrics['gc.pause']);
+                addDataPoint(playbackGcChart, timestamp, metrics.metrics['gc.pause']);
             }
         }
         
         function addPlaybackEvent(event) {
             const eventsList = document.getElementById('playback-events-list');
             const eventDiv = document.createElement('div');
-            eventDiv.className = 'event ' + (event.type === 'alert' ? 'alert' : 'info');
+            eventDiv.className = 'event ' + eventClass(event.type);
             
             eventDiv.innerHTML = 
                 '<div><strong>[' + event.rule + ']</strong> ' + event.message + '</div>' +
-                '<div class="timestamp">' + new Date(event.timestamp).toLocaleString() + '</div>';
+                '<div class="timestamp">' + timestampHTML(event.timestamp) + '</div>';
             
             eventsList.insertBefore(eventDiv, eventsList.firstChild);
             
@@ -954,8 +1589,8 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 return;
             }
             
-            const fromTime = new Date(fromInput.value).toISOString();
-            const toTime = new Date(toInput.value).toISOString();
+            const fromTime = parseDateInput(fromInput.value).toISOString();
+            const toTime = parseDateInput(toInput.value).toISOString();
             const speed = parseFloat(speedSelect.value);
             
             // Clear existing playback data
@@ -1001,46 +1636,804 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             document.getElementById('playback-to').value = formatDateForInput(now);
         }
         
-        function loadLast10Minutes() {
-            const now = new Date();
-            const tenMinutesAgo = new Date(now.getTime() - 10 * 60 * 1000);
-            
-            document.getElementById('playback-from').value = formatDateForInput(tenMinutesAgo);
-            document.getElementById('playback-to').value = formatDateForInput(now);
+        function loadLast10Minutes() {
+            const now = new Date();
+            const tenMinutesAgo = new Date(now.getTime() - 10 * 60 * 1000);
+            
+            document.getElementById('playback-from').value = formatDateForInput(tenMinutesAgo);
+            document.getElementById('playback-to').value = formatDateForInput(now);
+        }
+        
+        /**
+         * Formats a date as a datetime-local input value in the display time zone
+         */
+        function formatDateForInput(date) {
+            const parts = zoneParts(date);
+            return parts.year + '-' + parts.month + '-' + parts.day + 'T' + parts.hour + ':' + parts.minute;
+        }
+        
+        /**
+         * Interprets a datetime-local input value as wall clock time in the
+         * display time zone, returning null for an empty or invalid value
+         */
+        function parseDateInput(value) {
+            const match = /^(\d{4})-(\d{2})-(\d{2})T(\d{2}):(\d{2})/.exec(value);
+            if (!match) return null;
+            const wall = Date.UTC(+match[1], match[2] - 1, +match[3], +match[4], +match[5]);
+            // Correct the first guess once in case it fell across a DST change
+            const guess = wall - zoneOffset(new Date(wall));
+            return new Date(wall - zoneOffset(new Date(guess)));
+        }
+        
+        function clearPlaybackCharts() {
+            playbackMemoryChart.data.datasets[0].data = [];
+            playbackGoroutinesChart.data.datasets[0].data = [];
+            playbackGcChart.data.datasets[0].data = [];
+            
+            playbackMemoryChart.update();
+            playbackGoroutinesChart.update();
+            playbackGcChart.update();
+            
+            // Clear events list
+            const eventsList = document.getElementById('playback-events-list');
+            eventsList.innerHTML = '<div class="event"><div>Select a time range to replay events...</div><div class="timestamp">--</div></div>';
+        }
+        
+        // Initialize default time range to last 10 minutes
+        window.onload = function() {
+            bindControls();
+            initTimeZone();
+            addSimulationProfile();
+            loadLast10Minutes();
+            loadActiveRules();
+            loadAlerts();
+            loadAvailableMetrics();
+            loadAvailability();
+            setInterval(loadAvailability, 60000);
+            loadHTTPBreakdown();
+            setInterval(loadHTTPBreakdown, 10000);
+            loadRuleStates();
+            setInterval(loadRuleStates, 10000);
+            initCriticalBanner();
+            initKiosk();
+            addChartExportButtons();
+        };
+
+        // Chart export: every chart can be downloaded as PNG or SVG for tickets
+        // and postmortems. PNG is the canvas on a white background; SVG is
+        // redrawn from the chart's laid-out axes and points so it stays sharp.
+        // /api/charts/export renders the same charts server-side for scripts.
+        function addChartExportButtons() {
+            document.querySelectorAll('.chart-container').forEach(container => {
+                const canvas = container.querySelector('canvas');
+                if (!canvas) return;
+                const bar = document.createElement('div');
+                bar.className = 'chart-export kiosk-hidden';
+                ['png', 'svg'].forEach(format => {
+                    const button = document.createElement('button');
+                    button.textContent = format.toUpperCase();
+                    button.title = 'Download this chart as ' + format.toUpperCase();
+                    button.addEventListener('click', () => exportChart(canvas, format));
+                    bar.appendChild(button);
+                });
+                container.insertAdjacentElement('afterend', bar);
+            });
+        }
+        
+        function exportChart(canvas, format) {
+            const chart = Chart.getChart(canvas);
+            if (!chart) {
+                alert('This chart has no data to export yet');
+                return;
+            }
+            const name = canvas.id + '-' + new Date().toISOString().replace(/[:.]/g, '-') + '.' + format;
+            if (format === 'svg') {
+                downloadBlob(new Blob([chartToSVG(chart)], { type: 'image/svg+xml' }), name);
+                return;
+            }
+            const flat = document.createElement('canvas');
+            flat.width = canvas.width;
+            flat.height = canvas.height;
+            const ctx = flat.getContext('2d');
+            ctx.fillStyle = '#ffffff';
+            ctx.fillRect(0, 0, flat.width, flat.height);
+            ctx.drawImage(canvas, 0, 0);
+            flat.toBlob(blob => downloadBlob(blob, name), 'image/png');
+        }
+        
+        function downloadBlob(blob, name) {
+            const url = URL.createObjectURL(blob);
+            const link = document.createElement('a');
+            link.href = url;
+            link.download = name;
+            document.body.appendChild(link);
+            link.click();
+            link.remove();
+            setTimeout(() => URL.revokeObjectURL(url), 1000);
+        }
+        
+        function escapeXML(text) {
+            return String(text).replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&apos;' }[c]));
+        }
+        
+        function chartToSVG(chart) {
+            const width = chart.width, height = chart.height, area = chart.chartArea;
+            const parts = ['<svg xmlns="http://www.w3.org/2000/svg" width="' + width + '" height="' + height +
+                '" viewBox="0 0 ' + width + ' ' + height + '" font-family="Arial, sans-serif" font-size="11">',
+                '<rect width="' + width + '" height="' + height + '" fill="#ffffff"/>'];
+            const x = chart.scales.x, y = chart.scales.y;
+            if (x) {
+                x.ticks.forEach((tick, i) => {
+                    const px = x.getPixelForTick(i).toFixed(1);
+                    parts.push('<line x1="' + px + '" y1="' + area.top + '" x2="' + px + '" y2="' + area.bottom + '" stroke="#eeeeee"/>');
+                    const label = Array.isArray(tick.label) ? tick.label.join(' ') : tick.label;
+                    parts.push('<text x="' + px + '" y="' + (area.bottom + 14) + '" text-anchor="middle" fill="#666666">' + escapeXML(label) + '</text>');
+                });
+            }
+            if (y) {
+                y.ticks.forEach((tick, i) => {
+                    const py = y.getPixelForTick(i).toFixed(1);
+                    parts.push('<line x1="' + area.left + '" y1="' + py + '" x2="' + area.right + '" y2="' + py + '" stroke="#eeeeee"/>');
+                    parts.push('<text x="' + (area.left - 4) + '" y="' + py + '" text-anchor="end" dominant-baseline="middle" fill="#666666">' + escapeXML(tick.label) + '</text>');
+                });
+            }
+            parts.push('<rect x="' + area.left + '" y="' + area.top + '" width="' + (area.right - area.left) +
+                '" height="' + (area.bottom - area.top) + '" fill="none" stroke="#cccccc"/>');
+            chart.data.datasets.forEach((dataset, i) => {
+                if (!chart.isDatasetVisible(i)) return;
+                const color = escapeXML(dataset.borderColor || '#3498db');
+                const points = chart.getDatasetMeta(i).data.filter(point => !point.skip);
+                if (chart.config.type === 'scatter') {
+                    const radius = dataset.pointRadius || 3;
+                    points.forEach(point => parts.push('<circle cx="' + point.x.toFixed(1) + '" cy="' + point.y.toFixed(1) +
+                        '" r="' + radius + '" fill="' + color + '"/>'));
+                } else if (points.length > 0) {
+                    parts.push('<polyline fill="none" stroke="' + color + '" stroke-width="1.5" points="' +
+                        points.map(point => point.x.toFixed(1) + ',' + point.y.toFixed(1)).join(' ') + '"/>');
+                }
+                if (dataset.label) {
+                    parts.push('<text x="' + (area.left + 6) + '" y="' + (area.top + 14 * (i + 1)) + '" fill="' + color + '">' + escapeXML(dataset.label) + '</text>');
+                }
+            });
+            parts.push('</svg>');
+            return parts.join('');
+        }
+        
+        // Load simulation: synthetic metric profiles are replayed through the
+        // rules by /api/simulate. Durations are entered in seconds and sent as
+        // nanoseconds.
+        const simulationColors = ['#3498db', '#2ecc71', '#e67e22', '#9b59b6', '#34495e'];
+        let simulationChart = null;
+        
+        function addSimulationProfile() {
+            const row = document.createElement('div');
+            row.className = 'simulation-profile';
+            row.style.margin = '5px 0';
+            row.innerHTML =
+                '<input type="text" class="profile-metric" list="simulation-metrics" value="heap.alloc" placeholder="metric" style="width: 160px;" /> ' +
+                '<select class="profile-shape"><option value="ramp">Ramp</option><option value="spike">Spike</option><option value="sine">Sinusoid</option></select> ' +
+                '<label>Base <input type="number" class="profile-base" value="0" step="any" style="width: 110px;" /></label> ' +
+                '<label>Peak <input type="number" class="profile-peak" value="500000000" step="any" style="width: 110px;" /></label> ' +
+                '<label>Spike at (s) <input type="number" class="profile-start" value="300" min="0" style="width: 70px;" /></label> ' +
+                '<label>for (s) <input type="number" class="profile-length" value="60" min="0" style="width: 70px;" /></label> ' +
+                '<label>Period (s) <input type="number" class="profile-period" value="300" min="0" style="width: 70px;" /></label> ' +
+                '<button style="background: #e74c3c; color: white; border: none; padding: 4px 8px; border-radius: 3px;">Remove</button>';
+            row.querySelector('button').addEventListener('click', () => row.remove());
+            document.getElementById('simulation-profiles').appendChild(row);
+        }
+        
+        function importBundle(dryRun) {
+            const file = document.getElementById('bundle-file').files[0];
+            const status = document.getElementById('bundle-status');
+            if (!file) {
+                status.textContent = 'Choose a bundle file first';
+                return;
+            }
+            const replace = document.getElementById('bundle-replace').checked;
+            status.textContent = dryRun ? 'Checking bundle...' : 'Importing bundle...';
+            
+            fetch('/api/rules/import?dry_run=' + dryRun + '&replace=' + replace, { method: 'POST', body: file })
+            .then(response => response.json())
+            .then(data => {
+                if (data.status !== 'ok') {
+                    status.textContent = 'Error: ' + data.message;
+                    return;
+                }
+                renderBundleDiff(data.data);
+                if (!dryRun) loadActiveRules();
+            })
+            .catch(error => {
+                status.textContent = 'Error: ' + error;
+            });
+        }
+        
+        function renderBundleDiff(diff) {
+            const status = document.getElementById('bundle-status');
+            status.innerHTML = '';
+            const heading = document.createElement('p');
+            heading.textContent = diff.dry_run ? 'Importing this bundle would make these changes:' : 'Bundle imported:';
+            status.appendChild(heading);
+            
+            const sections = [
+                ['Added', diff.added, '#2ecc71'],
+                ['Changed', diff.changed, '#f39c12'],
+                ['Removed', diff.removed, '#e74c3c'],
+                ['Unchanged', diff.unchanged, '#7f8c8d'],
+                ['Group defaults', diff.groups, '#3498db']
+            ];
+            sections.forEach(([label, names, color]) => {
+                if (!names || names.length === 0) return;
+                const line = document.createElement('div');
+                line.style.color = color;
+                line.textContent = label + ' (' + names.length + '): ' + names.join(', ');
+                status.appendChild(line);
+            });
+            if (diff.routing) {
+                const line = document.createElement('div');
+                line.textContent = 'Alert routing configuration replaced';
+                status.appendChild(line);
+            }
+        }
+        
+        function runSimulation() {
+            const seconds = value => Math.round(parseFloat(value) * 1e9) || 0;
+            const request = {
+                duration: seconds(document.getElementById('simulation-duration').value),
+                step: seconds(document.getElementById('simulation-step').value),
+                profiles: Array.from(document.querySelectorAll('.simulation-profile')).map(row => ({
+                    metric: row.querySelector('.profile-metric').value.trim(),
+                    shape: row.querySelector('.profile-shape').value,
+                    base: parseFloat(row.querySelector('.profile-base').value) || 0,
+                    peak: parseFloat(row.querySelector('.profile-peak').value) || 0,
+                    start: seconds(row.querySelector('.profile-start').value),
+                    length: seconds(row.querySelector('.profile-length').value),
+                    period: seconds(row.querySelector('.profile-period').value)
+                }))
+            };
+            if (document.getElementById('simulation-use-editor').checked) {
+                request.source = document.getElementById('rule-editor').value;
+            }
+            
+            const status = document.getElementById('simulation-status');
+            status.textContent = 'Simulating...';
+            fetch('/api/simulate', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(request)
+            })
+            .then(response => response.json())
+            .then(data => {
+                if (data.status !== 'ok') {
+                    status.textContent = 'Error: ' + data.message;
+                    return;
+                }
+                status.textContent = '';
+                renderSimulation(data.data);
+            })
+            .catch(error => { status.textContent = 'Error: ' + error; });
+        }
+        
+        /**
+         * Charts the simulated metrics and shows, for every rule, a timeline
+         * of the steps at which it would have fired
+         */
+        function renderSimulation(result) {
+            const steps = result.steps || [];
+            const metricNames = steps.length > 0 ? Object.keys(steps[0].metrics) : [];
+            const datasets = metricNames.map((name, i) => ({
+                label: name,
+                data: steps.map(step => ({ x: step.offset / 1e9, y: step.metrics[name] })),
+                borderColor: simulationColors[i % simulationColors.length],
+                fill: false,
+                pointRadius: 0
+            }));
+            
+            if (simulationChart) simulationChart.destroy();
+            simulationChart = new Chart(document.getElementById('simulation-chart'), {
+                type: 'line',
+                data: { datasets: datasets },
+                options: {
+                    responsive: true,
+                    maintainAspectRatio: false,
+                    scales: { x: { type: 'linear', title: { display: true, text: 'Seconds into simulation' } } }
+                }
+            });
+            
+            // Bucket long simulations so every rule fits on one row
+            const buckets = Math.min(steps.length, 120);
+            const list = document.getElementById('simulation-results');
+            list.innerHTML = '';
+            (result.rules || []).forEach(rule => {
+                const row = document.createElement('div');
+                row.className = 'availability-row';
+                const label = document.createElement('div');
+                label.className = 'metric-label';
+                if (rule.error) {
+                    label.textContent = rule.rule + ' - error: ' + rule.error;
+                } else if (rule.triggers > 0) {
+                    label.textContent = rule.rule + ' - fires ' + rule.triggers + ' times, first at ' + (rule.first_trigger / 1e9) + 's';
+                } else {
+                    label.textContent = rule.rule + ' - never fires';
+                }
+                row.appendChild(label);
+                
+                const bars = document.createElement('div');
+                bars.className = 'availability-bars';
+                for (let b = 0; b < buckets; b++) {
+                    const from = Math.floor(b * steps.length / buckets);
+                    const to = Math.floor((b + 1) * steps.length / buckets);
+                    const fired = steps.slice(from, to).some(step => (step.triggered || []).indexOf(rule.rule) !== -1);
+                    const bar = document.createElement('div');
+                    bar.className = 'availability-bar' + (fired ? ' down' : '');
+                    bar.title = (steps[from].offset / 1e9) + 's' + (fired ? ': fires' : '');
+                    bars.appendChild(bar);
+                }
+                row.appendChild(bars);
+                list.appendChild(row);
+            });
+        }
+        
+        // Time zone for every timestamp shown or entered: the browser's own
+        // zone (empty), UTC or any IANA zone. It is chosen in the header and
+        // kept in localStorage, and ?tz= overrides it. The APIs always
+        // exchange UTC RFC 3339 timestamps.
+        const timeZoneKey = 'descry.timeZone';
+        let displayTimeZone = '';
+        
+        function initTimeZone() {
+            const select = document.getElementById('timezone-select');
+            select.add(new Option('Local (' + Intl.DateTimeFormat().resolvedOptions().timeZone + ')', ''));
+            select.add(new Option('UTC', 'UTC'));
+            if (Intl.supportedValuesOf) {
+                Intl.supportedValuesOf('timeZone').filter(zone => zone !== 'UTC').forEach(zone => select.add(new Option(zone, zone)));
+            }
+            
+            const requested = new URLSearchParams(location.search).get('tz');
+            const zone = requested !== null ? requested : (localStorage.getItem(timeZoneKey) || '');
+            applyTimeZone(isValidTimeZone(zone) ? zone : '');
+        }
+        
+        function isValidTimeZone(zone) {
+            try {
+                new Intl.DateTimeFormat(undefined, { timeZone: zone || undefined });
+                return true;
+            } catch (e) {
+                return false;
+            }
+        }
+        
+        function setTimeZone(zone) {
+            localStorage.setItem(timeZoneKey, zone);
+            applyTimeZone(zone);
+        }
+        
+        /**
+         * Switches the display time zone and re-renders the timestamps already
+         * shown. The playback range keeps pointing at the same instants.
+         */
+        function applyTimeZone(zone) {
+            const inputs = [document.getElementById('playback-from'), document.getElementById('playback-to')];
+            const range = inputs.map(input => parseDateInput(input.value));
+            
+            displayTimeZone = zone;
+            document.getElementById('timezone-select').value = zone;
+            inputs.forEach((input, i) => {
+                if (range[i]) input.value = formatDateForInput(range[i]);
+            });
+            
+            const label = zone || Intl.DateTimeFormat().resolvedOptions().timeZone;
+            document.querySelectorAll('.timezone-label').forEach(element => { element.textContent = '(' + label + ')'; });
+            document.querySelectorAll('[data-timestamp]').forEach(element => {
+                element.textContent = formatTimestamp(element.dataset.timestamp);
+            });
+            Object.values(Chart.instances).forEach(chart => chart.update('none'));
+        }
+        
+        function formatTimestamp(value) {
+            return new Date(value).toLocaleString(undefined, { timeZone: displayTimeZone || undefined, timeZoneName: 'short' });
+        }
+        
+        function formatTime(value) {
+            return new Date(value).toLocaleTimeString(undefined, { timeZone: displayTimeZone || undefined });
+        }
+        
+        /**
+         * Returns markup for a timestamp that is re-rendered when the time zone changes
+         */
+        function timestampHTML(value) {
+            const date = new Date(value);
+            return '<span data-timestamp="' + date.toISOString() + '">' + formatTimestamp(date) + '</span>';
+        }
+        
+        /**
+         * Returns the zero-padded wall clock fields of date in the display time zone
+         */
+        function zoneParts(date) {
+            const parts = {};
+            new Intl.DateTimeFormat('en-US', {
+                timeZone: displayTimeZone || undefined, hourCycle: 'h23',
+                year: 'numeric', month: '2-digit', day: '2-digit', hour: '2-digit', minute: '2-digit', second: '2-digit'
+            }).formatToParts(date).forEach(part => { parts[part.type] = part.value; });
+            return parts;
+        }
+        
+        /**
+         * Returns how far the display time zone is ahead of UTC at date, in milliseconds
+         */
+        function zoneOffset(date) {
+            const parts = zoneParts(date);
+            const wall = Date.UTC(+parts.year, parts.month - 1, +parts.day, +parts.hour, +parts.minute, +parts.second);
+            return wall - Math.floor(date.getTime() / 1000) * 1000;
+        }
+        
+        // Kiosk mode (?kiosk=1) is a read-only wallboard for NOC displays. It
+        // hides every control and rotates full-screen panels every rotate
+        // seconds (default 15, 0 to stay on the first panel).
+        const kioskPanels = ['kiosk-health', 'live', 'kiosk-alerts'];
+        const severityRank = { 'critical': 0, 'high': 1, 'medium': 2, 'low': 3 };
+        let kioskPanelIndex = 0;
+        
+        function isKiosk() {
+            return document.body.classList.contains('kiosk');
+        }
+        
+        function initKiosk() {
+            const params = new URLSearchParams(location.search);
+            if (params.get('kiosk') !== '1') return;
+            document.body.classList.add('kiosk');
+            
+            const rotate = parseInt(params.get('rotate'), 10);
+            const seconds = isNaN(rotate) || rotate < 0 ? 15 : rotate;
+            showKioskPanel(0);
+            if (seconds > 0) {
+                setInterval(function() {
+                    showKioskPanel((kioskPanelIndex + 1) % kioskPanels.length);
+                }, seconds * 1000);
+            }
+            
+            refreshKioskPanels();
+            setInterval(refreshKioskPanels, 10000);
+        }
+        
+        function showKioskPanel(index) {
+            kioskPanelIndex = index;
+            document.querySelectorAll('.tab-content').forEach(content => {
+                content.classList.toggle('active', content.id === kioskPanels[index] + '-tab');
+            });
+        }
+        
+        /**
+         * Refreshes the health and top alerts panels from the status and alerts APIs
+         */
+        function refreshKioskPanels() {
+            fetch('/api/status')
+            .then(response => response.json())
+            .then(data => {
+                if (data.status !== 'ok') return;
+                const summary = data.data;
+                const colors = { 'operational': '#27ae60', 'degraded': '#f39c12', 'outage': '#e74c3c' };
+                const status = document.getElementById('kiosk-status');
+                status.textContent = summary.status.toUpperCase();
+                status.style.color = colors[summary.status] || '#95a5a6';
+                document.getElementById('kiosk-health-score').textContent = summary.health_score;
+                document.getElementById('kiosk-uptime').textContent = formatPercent(summary.uptime_percent);
+            })
+            .catch(error => console.log('Failed to load status:', error));
+            
+            fetch('/api/alerts?status=active')
+            .then(response => response.json())
+            .then(data => {
+                if (data.status !== 'ok') return;
+                const alerts = (data.data || []).slice().sort((a, b) =>
+                    severityRank[a.severity] - severityRank[b.severity] || new Date(b.created_at) - new Date(a.created_at));
+                
+                const list = document.getElementById('kiosk-alerts-list');
+                list.innerHTML = '';
+                if (alerts.length === 0) {
+                    list.innerHTML = '<div class="timestamp">No active alerts</div>';
+                    return;
+                }
+                alerts.slice(0, 8).forEach(alert => {
+                    const item = document.createElement('div');
+                    item.className = 'kiosk-alert';
+                    item.style.borderLeftColor = getSeverityColor(alert.severity);
+                    item.textContent = '[' + alert.severity.toUpperCase() + '] ' + alert.rule + ': ' + alert.message + ' (' + getTimeAgo(new Date(alert.created_at)) + ')';
+                    list.appendChild(item);
+                });
+            })
+            .catch(error => console.log('Failed to load alerts:', error));
+        }
+        
+        // Critical alert banner and chime. Dismissals are kept per alert in
+        // localStorage, so a wall display does not re-show an alert someone
+        // has already seen after a reload.
+        const dismissedAlertsKey = 'descry.dismissedAlerts';
+        const alertSoundKey = 'descry.alertSound';
+        let announcedAlerts = null; // ids already chimed for; null until the first load
+        let criticalRefreshTimer = null;
+        let audioContext = null;
+        
+        function initCriticalBanner() {
+            document.getElementById('alert-sound-toggle').checked = localStorage.getItem(alertSoundKey) === 'on';
+            refreshCriticalBanner();
+            setInterval(refreshCriticalBanner, 10000);
+        }
+        
+        function getDismissedAlerts() {
+            try {
+                return JSON.parse(localStorage.getItem(dismissedAlertsKey)) || [];
+            } catch (e) {
+                return [];
+            }
+        }
+        
+        function dismissCriticalAlert(alertId) {
+            const dismissed = getDismissedAlerts();
+            if (dismissed.indexOf(alertId) === -1) {
+                dismissed.push(alertId);
+            }
+            localStorage.setItem(dismissedAlertsKey, JSON.stringify(dismissed));
+            refreshCriticalBanner();
+        }
+        
+        function scheduleCriticalBannerRefresh() {
+            // Alerts arrive in bursts during incidents; refresh once per burst
+            if (criticalRefreshTimer) return;
+            criticalRefreshTimer = setTimeout(function() {
+                criticalRefreshTimer = null;
+                refreshCriticalBanner();
+            }, 500);
+        }
+        
+        /**
+         * Shows a banner entry for every active critical alert that has not been
+         * dismissed, and chimes when one appears that was not shown before
+         */
+        function refreshCriticalBanner() {
+            fetch('/api/alerts?status=active&severity=critical')
+            .then(response => response.json())
+            .then(data => {
+                if (data.status !== 'ok') return;
+                const alerts = data.data || [];
+                const activeIds = alerts.map(a => a.id);
+                
+                // Forget dismissals of alerts that are no longer active
+                const dismissed = getDismissedAlerts().filter(id => activeIds.indexOf(id) !== -1);
+                localStorage.setItem(dismissedAlertsKey, JSON.stringify(dismissed));
+                
+                const visible = alerts.filter(a => dismissed.indexOf(a.id) === -1);
+                renderCriticalBanner(visible);
+                
+                const isNew = visible.some(a => announcedAlerts !== null && !announcedAlerts[a.id]);
+                announcedAlerts = {};
+                activeIds.forEach(id => { announcedAlerts[id] = true; });
+                if (isNew) {
+                    playAlertChime();
+                }
+            })
+            .catch(error => console.log('Failed to load critical alerts:', error));
+        }
+        
+        function renderCriticalBanner(alerts) {
+            const banner = document.getElementById('critical-banner');
+            banner.innerHTML = '';
+            alerts.forEach(alert => {
+                const item = document.createElement('div');
+                item.className = 'critical-banner-item';
+                
+                const message = document.createElement('span');
+                message.className = 'message';
+                message.textContent = 'CRITICAL [' + alert.rule + '] ' + alert.message + ' (' + getTimeAgo(new Date(alert.created_at)) + ')';
+                message.onclick = function() {
+                    if (isKiosk()) return;
+                    showTab('alerts');
+                    showAlertModal(alert.id);
+                };
+                
+                const dismiss = document.createElement('button');
+                dismiss.textContent = 'Dismiss';
+                dismiss.onclick = function() { dismissCriticalAlert(alert.id); };
+                
+                item.appendChild(message);
+                item.appendChild(dismiss);
+                banner.appendChild(item);
+            });
+            banner.classList.toggle('visible', alerts.length > 0);
+        }
+        
+        function setAlertSound(enabled) {
+            localStorage.setItem(alertSoundKey, enabled ? 'on' : 'off');
+            if (enabled) {
+                // Browsers only allow audio after a user gesture, such as this click
+                playAlertChime();
+            }
+        }
+        
+        /**
+         * Plays a short two-tone chime with the Web Audio API when the alert
+         * sound is enabled
+         */
+        function playAlertChime() {
+            if (localStorage.getItem(alertSoundKey) !== 'on') return;
+            const AudioContextClass = window.AudioContext || window.webkitAudioContext;
+            if (!AudioContextClass) return;
+            if (!audioContext) {
+                audioContext = new AudioContextClass();
+            }
+            if (audioContext.state === 'suspended') {
+                audioContext.resume();
+            }
+            [880, 660].forEach((frequency, i) => {
+                const start = audioContext.currentTime + i * 0.25;
+                const oscillator = audioContext.createOscillator();
+                const gain = audioContext.createGain();
+                oscillator.frequency.value = frequency;
+                gain.gain.setValueAtTime(0.3, start);
+                gain.gain.exponentialRampToValueAtTime(0.001, start + 0.4);
+                oscillator.connect(gain);
+                gain.connect(audioContext.destination);
+                oscillator.start(start);
+                oscillator.stop(start + 0.4);
+            });
+        }
+        
+        /**
+         * Loads HTTP statistics by route or method for the Endpoints card,
+         * busiest first, with response counts per status class
+         */
+        function loadHTTPBreakdown() {
+            fetch('/api/http/breakdown')
+            .then(response => response.json())
+            .then(data => {
+                if (data.status !== 'ok' || !data.data) {
+                    return;
+                }
+                const by = document.getElementById('breakdown-select').value;
+                const rows = document.getElementById('breakdown-rows');
+                rows.innerHTML = '';
+                (data.data[by] || []).forEach(stats => {
+                    const row = document.createElement('tr');
+                    [stats.route, formatNumber(stats.request_count), formatPercent(stats.error_rate),
+                     formatDuration(stats.avg_response_time), formatDuration(stats.p95), formatDuration(stats.p99)].forEach(text => {
+                        const cell = document.createElement('td');
+                        cell.textContent = text;
+                        row.appendChild(cell);
+                    });
+                    rows.appendChild(row);
+                });
+                if (!rows.children.length) {
+                    rows.innerHTML = '<tr><td colspan="6">No requests yet</td></tr>';
+                }
+                const classes = data.data.status_classes || {};
+                document.getElementById('breakdown-status-classes').textContent = ['1xx', '2xx', '3xx', '4xx', '5xx']
+                    .map(name => name + ': ' + formatNumber(classes[name] || 0)).join('  ');
+            })
+            .catch(() => {});
+        }
+        
+        // Action quotas: use of each quota in its window, highlighting quotas
+        // that are dropping executions
+        function loadActionQuotas() {
+            fetch('/api/actions/quotas')
+            .then(response => response.json())
+            .then(data => {
+                if (data.status !== 'ok') {
+                    return;
+                }
+                const rows = document.getElementById('quota-rows');
+                rows.innerHTML = '';
+                (data.data || []).forEach(quota => {
+                    const row = document.createElement('tr');
+                    if (quota.exceeded) {
+                        row.style.color = '#e74c3c';
+                    }
+                    [quota.name, formatNumber(quota.used), formatNumber(quota.limit),
+                     formatDuration(quota.window), formatNumber(quota.dropped)].forEach(text => {
+                        const cell = document.createElement('td');
+                        cell.textContent = text;
+                        row.appendChild(cell);
+                    });
+                    rows.appendChild(row);
+                });
+                if (!rows.children.length) {
+                    rows.innerHTML = '<tr><td colspan="5">No quotas configured</td></tr>';
+                }
+            })
+            .catch(() => {});
         }
         
-        function formatDateForInput(date) {
-            const year = date.getFullYear();
-            const month = String(date.getMonth() + 1).padStart(2, '0');
-            const day = String(date.getDate()).padStart(2, '0');
-            const hours = String(date.getHours()).padStart(2, '0');
-            const minutes = String(date.getMinutes()).padStart(2, '0');
-            
-            return year + '-' + month + '-' + day + 'T' + hours + ':' + minutes;
+        // Profiles captured by capture_profile(), newest first, each with a
+        // link to download it for go tool pprof
+        function loadProfiles() {
+            fetch('/api/profiles')
+            .then(response => response.json())
+            .then(data => {
+                if (data.status !== 'ok') {
+                    return;
+                }
+                const rows = document.getElementById('profile-rows');
+                rows.innerHTML = '';
+                (data.data || []).forEach(profile => {
+                    const row = document.createElement('tr');
+                    [new Date(profile.timestamp).toLocaleString(), profile.rule, profile.type,
+                     formatBytes(profile.size)].forEach(text => {
+                        const cell = document.createElement('td');
+                        cell.textContent = text;
+                        row.appendChild(cell);
+                    });
+                    const link = document.createElement('a');
+                    link.href = '/api/profiles/' + encodeURIComponent(profile.id);
+                    link.textContent = 'Download';
+                    const cell = document.createElement('td');
+                    cell.appendChild(link);
+                    row.appendChild(cell);
+                    rows.appendChild(row);
+                });
+                if (!rows.children.length) {
+                    rows.innerHTML = '<tr><td colspan="5">No profiles captured</td></tr>';
+                }
+            })
+            .catch(() => {});
         }
         
-        function clearPlaybackCharts() {
-            playbackMemoryChart.data.datasets[0].data = [];
-            playbackGoroutinesChart.data.datasets[0].data = [];
-            playbackGcChart.data.datasets[0].data = [];
-            
-            playbackMemoryChart.update();
-            playbackGoroutinesChart.update();
-            playbackGcChart.update();
-            
-            // Clear events list
-            const eventsList = document.getElementById('playback-events-list');
-            eventsList.innerHTML = '<div class="event"><div>Select a time range to replay events...</div><div class="timestamp">--</div></div>';
+        /**
+         * Loads per-rule availability and renders one bar per day for the last 30 days
+         */
+        function loadAvailability() {
+            fetch('/api/availability')
+            .then(response => response.json())
+            .then(data => {
+                if (data.status !== 'ok' || !data.data || data.data.length === 0) {
+                    return;
+                }
+                
+                const list = document.getElementById('availability-list');
+                list.innerHTML = '';
+                const today = new Date();
+                today.setUTCHours(0, 0, 0, 0);
+                
+                data.data.forEach(rule => {
+                    const byDate = {};
+                    (rule.days || []).forEach(day => {
+                        byDate[new Date(day.date).getTime()] = day;
+                    });
+                    
+                    const row = document.createElement('div');
+                    row.className = 'availability-row';
+                    const label = document.createElement('div');
+                    label.className = 'metric-label';
+                    label.textContent = rule.rule + ' - ' + formatPercent(rule.availability);
+                    row.appendChild(label);
+                    
+                    const bars = document.createElement('div');
+                    bars.className = 'availability-bars';
+                    for (let i = 29; i >= 0; i--) {
+                        const date = new Date(today.getTime() - i * 86400000);
+                        const day = byDate[date.getTime()];
+                        const bar = document.createElement('div');
+                        bar.className = 'availability-bar';
+                        if (!day) {
+                            bar.classList.add('empty');
+                            bar.title = date.toISOString().slice(0, 10) + ' UTC: no data';
+                        } else {
+                            if (day.availability < 95) {
+                                bar.classList.add('down');
+                            } else if (day.availability < 99.9) {
+                                bar.classList.add('degraded');
+                            }
+                            bar.style.height = Math.max(day.availability, 8) + '%';
+                            bar.title = date.toISOString().slice(0, 10) + ' UTC: ' + formatPercent(day.availability);
+                        }
+                        bars.appendChild(bar);
+                    }
+                    row.appendChild(bars);
+                    list.appendChild(row);
+                });
+                document.getElementById('kiosk-availability-list').innerHTML = list.innerHTML;
+            })
+            .catch(() => {});
         }
         
-        // Initialize default time range to last 10 minutes
-        window.onload = function() {
-            loadLast10Minutes();
-            loadActiveRules();
-            loadAlerts();
-            loadAvailableMetrics();
-        };
-        
         /**
          * Validates rule syntax and displays validation results
          */
@@ -1070,7 +2463,12 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 if (data.valid) {
                     showRuleStatus('success', data.message);
                 } else {
-                    showRuleStatus('error', 'Validation failed: ' + data.errors.join(', '));
+                    if (data.parse_errors) {
+                        const details = data.parse_errors.map(e => e.line + ':' + e.column + ' ' + e.message + '\n' + e.snippet);
+                        showRuleStatus('error', 'Validation failed:\n' + details.join('\n'));
+                    } else {
+                        showRuleStatus('error', 'Validation failed: ' + data.errors.join(', '));
+                    }
                 }
             })
             .catch(error => {
@@ -1154,6 +2552,8 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         function showRuleStatus(type, message) {
             const statusDiv = document.getElementById('rule-status');
             statusDiv.textContent = message;
+            statusDiv.style.whiteSpace = 'pre-wrap';
+            statusDiv.style.fontFamily = type === 'error' ? 'monospace' : '';
             
             // Set background color based on type
             const colors = {
@@ -1169,23 +2569,29 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         }
         
         function loadActiveRules() {
-            fetch('/api/rules')
-            .then(response => response.json())
-            .then(data => {
+            Promise.all([
+                fetch('/api/rules').then(response => response.json()),
+                fetch('/api/rules/stats').then(response => response.json()).catch(() => ({})),
+                fetch('/api/rules/groups').then(response => response.json()).catch(() => ({}))
+            ])
+            .then(([data, statsData, groupsData]) => {
                 const rulesList = document.getElementById('active-rules-list');
+                const statsByRule = {};
+                (statsData.data || []).forEach(stats => { statsByRule[stats.rule] = stats; });
                 
                 if (data.status === 'ok' && data.data && data.data.length > 0) {
                     rulesList.innerHTML = '';
-                    data.data.forEach(rule => {
-                        const ruleDiv = document.createElement('div');
-                        ruleDiv.style.cssText = 'padding: 10px; margin: 5px 0; background: #f8f9fa; border-radius: 3px; border-left: 4px solid #3498db;';
-                        
-                        ruleDiv.innerHTML = 
-                            '<strong>' + (rule.name || 'Unnamed Rule') + '</strong><br>' +
-                            '<code style="font-size: 0.85em;">' + (rule.condition || rule.code || 'No condition') + '</code><br>' +
-                            '<small style="color: #666;">Status: ' + (rule.enabled ? 'Active' : 'Inactive') + '</small>';
-                        
-                        rulesList.appendChild(ruleDiv);
+                    // Ungrouped rules first, then each group under its own header
+                    data.data.filter(rule => !rule.group).forEach(rule => {
+                        rulesList.appendChild(renderActiveRule(rule, statsByRule[rule.name]));
+                    });
+                    (groupsData.data || []).forEach(group => {
+                        rulesList.appendChild(renderRuleGroupHeader(group));
+                        data.data.filter(rule => rule.group === group.name).forEach(rule => {
+                            const ruleDiv = renderActiveRule(rule, statsByRule[rule.name]);
+                            ruleDiv.style.marginLeft = '15px';
+                            rulesList.appendChild(ruleDiv);
+                        });
                     });
                 } else {
                     rulesList.innerHTML = '<div style="padding: 10px; color: #7f8c8d;">No active rules found</div>';
@@ -1197,6 +2603,159 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             });
         }
         
+        /**
+         * Shows a rule group's defaults with controls for all of its rules
+         * @param {Object} group - RuleGroupInfo from /api/rules/groups
+         */
+        function renderRuleGroupHeader(group) {
+            const groupDiv = document.createElement('div');
+            groupDiv.style.cssText = 'padding: 8px 10px; margin: 15px 0 5px; background: #ecf0f1; border-radius: 3px;';
+            
+            const nameEl = document.createElement('strong');
+            nameEl.textContent = 'Group: ' + group.name;
+            const details = [group.enabled + ' of ' + group.rules.length + ' rules enabled'];
+            if (group.severity) details.push('severity ' + group.severity);
+            if (group.cooldown) details.push('cooldown ' + (group.cooldown / 1e9) + 's');
+            const detailsEl = document.createElement('div');
+            detailsEl.className = 'timestamp';
+            detailsEl.textContent = (group.description ? group.description + ' | ' : '') + details.join(', ');
+            
+            groupDiv.appendChild(nameEl);
+            groupDiv.appendChild(detailsEl);
+            if (group.rules.length > 0) {
+                const enableButton = document.createElement('button');
+                enableButton.textContent = 'Enable all';
+                enableButton.onclick = () => setRuleGroupEnabled(group.name, true);
+                const disableButton = document.createElement('button');
+                disableButton.textContent = 'Disable all';
+                disableButton.style.marginLeft = '5px';
+                disableButton.onclick = () => setRuleGroupEnabled(group.name, false);
+                groupDiv.appendChild(enableButton);
+                groupDiv.appendChild(disableButton);
+            }
+            return groupDiv;
+        }
+        
+        /**
+         * Shows one rule with its statistics and edit, toggle and delete controls
+         * @param {Object} rule - rule from /api/rules
+         * @param {Object} [stats] - RuleStats from /api/rules/stats
+         */
+        function renderActiveRule(rule, stats) {
+            const ruleDiv = document.createElement('div');
+            ruleDiv.style.cssText = 'padding: 10px; margin: 5px 0; background: #f8f9fa; border-radius: 3px; border-left: 4px solid #3498db;';
+            
+            const nameEl = document.createElement('strong');
+            nameEl.textContent = (rule.name || 'Unnamed Rule') + (rule.enabled ? '' : ' (disabled)') + (rule.dry_run ? ' (dry run)' : '');
+            const codeEl = document.createElement('pre');
+            codeEl.style.cssText = 'font-size: 0.85em; white-space: pre-wrap; margin: 5px 0;';
+            codeEl.textContent = rule.source || 'No source';
+            const statsEl = document.createElement('div');
+            statsEl.className = 'timestamp';
+            statsEl.textContent = formatRuleStats(stats);
+            
+            const editButton = document.createElement('button');
+            editButton.textContent = 'Edit';
+            editButton.onclick = () => loadRuleIntoEditor(rule.name, rule.source);
+            const toggleButton = document.createElement('button');
+            toggleButton.textContent = rule.enabled ? 'Disable' : 'Enable';
+            toggleButton.style.marginLeft = '5px';
+            toggleButton.onclick = () => setRuleEnabled(rule.name, !rule.enabled);
+            const deleteButton = document.createElement('button');
+            deleteButton.textContent = 'Delete';
+            deleteButton.style.marginLeft = '5px';
+            deleteButton.onclick = () => deleteRule(rule.name);
+            
+            ruleDiv.appendChild(nameEl);
+            ruleDiv.appendChild(codeEl);
+            ruleDiv.appendChild(statsEl);
+            ruleDiv.appendChild(editButton);
+            ruleDiv.appendChild(toggleButton);
+            ruleDiv.appendChild(deleteButton);
+            return ruleDiv;
+        }
+        
+        /**
+         * Summarizes a rule's evaluation statistics in one line
+         * @param {Object} [stats] - RuleStats from /api/rules/stats
+         */
+        function formatRuleStats(stats) {
+            if (!stats || !stats.evaluations) {
+                return 'Not evaluated yet';
+            }
+            let text = formatNumber(stats.evaluations) + ' evaluations, ' + formatNumber(stats.triggers) + ' triggers (' +
+                formatPercent(stats.trigger_rate) + '), ' + stats.errors + ' errors, ' + stats.timeouts + ' timeouts' +
+                ' | avg ' + formatDuration(stats.average_duration) + ', last ' + formatDuration(stats.last_duration) +
+                ', max ' + formatDuration(stats.max_duration);
+            if (stats.last_error) {
+                text += ' | last error: ' + stats.last_error;
+            }
+            return text;
+        }
+        
+        /**
+         * Removes a rule from the monitoring engine
+         */
+        function deleteRule(ruleName) {
+            if (!confirm('Delete rule ' + ruleName + '?')) {
+                return;
+            }
+            
+            fetch('/api/rules/' + encodeURIComponent(ruleName), { method: 'DELETE' })
+            .then(response => response.json())
+            .then(data => {
+                if (data.status === 'ok') {
+                    showRuleStatus('success', data.message);
+                    loadActiveRules();
+                } else {
+                    showRuleStatus('error', 'Error deleting rule: ' + data.message);
+                }
+            })
+            .catch(error => {
+                showRuleStatus('error', 'Error deleting rule: ' + error);
+            });
+        }
+        
+        /**
+         * Enables or disables a rule without removing it
+         */
+        function setRuleEnabled(ruleName, enabled) {
+            const action = enabled ? 'enable' : 'disable';
+            fetch('/api/rules/' + encodeURIComponent(ruleName) + '/' + action, { method: 'POST' })
+            .then(response => response.json())
+            .then(data => {
+                if (data.status === 'ok') {
+                    showRuleStatus('success', data.message);
+                    loadActiveRules();
+                } else {
+                    showRuleStatus('error', 'Error updating rule: ' + data.message);
+                }
+            })
+            .catch(error => {
+                showRuleStatus('error', 'Error updating rule: ' + error);
+            });
+        }
+        
+        /**
+         * Enables or disables every rule in a group
+         */
+        function setRuleGroupEnabled(groupName, enabled) {
+            const action = enabled ? 'enable' : 'disable';
+            fetch('/api/rules/groups/' + encodeURIComponent(groupName) + '/' + action, { method: 'POST' })
+            .then(response => response.json())
+            .then(data => {
+                if (data.status === 'ok') {
+                    showRuleStatus('success', data.message);
+                    loadActiveRules();
+                } else {
+                    showRuleStatus('error', 'Error updating group: ' + data.message);
+                }
+            })
+            .catch(error => {
+                showRuleStatus('error', 'Error updating group: ' + error);
+            });
+        }
+        
         function loadRuleIntoEditor(ruleName, ruleCode) {
             document.getElementById('rule-name').value = ruleName;
             document.getElementById('rule-editor').value = ruleCode;
@@ -1207,6 +2766,8 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         
         // Alert management functions
         function loadAlerts() {
+            loadActionQuotas();
+            loadProfiles();
             const statusFilter = document.getElementById('alert-status-filter').value;
             const severityFilter = document.getElementById('alert-severity-filter').value;
             
@@ -1245,7 +2806,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 const statusColor = getStatusColor(alert.status);
                 const timeAgo = getTimeAgo(new Date(alert.created_at));
                 
-                html += '<div class="card" style="margin-bottom: 15px; border-left: 4px solid ' + severityColor + '; cursor: pointer;" onclick="showAlertModal(\'' + alert.id + '\')">';
+                html += '<div class="card" style="margin-bottom: 15px; border-left: 4px solid ' + severityColor + '; cursor: pointer;" data-alert-id="' + alert.id + '">';
                 html += '<div style="display: flex; justify-content: between; align-items: start;">';
                 html += '<div style="flex: 1;">';
                 html += '<h4 style="margin: 0 0 10px 0; color: ' + severityColor + ';">[' + alert.severity.toUpperCase() + '] ' + alert.rule + '</h4>';
@@ -1266,6 +2827,9 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             });
             
             alertsList.innerHTML = html;
+            alertsList.querySelectorAll('[data-alert-id]').forEach(card => {
+                card.addEventListener('click', () => showAlertModal(card.dataset.alertId));
+            });
         }
         
         function updateAlertSummary(alerts) {
@@ -1354,15 +2918,15 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             let content = '<div style="margin-bottom: 20px;">';
             content += '<p><strong>Message:</strong> ' + alert.message + '</p>';
             content += '<p><strong>Status:</strong> <span style="color: ' + getStatusColor(alert.status) + ';">' + alert.status.toUpperCase() + '</span></p>';
-            content += '<p><strong>Created:</strong> ' + new Date(alert.created_at).toLocaleString() + '</p>';
-            content += '<p><strong>Updated:</strong> ' + new Date(alert.updated_at).toLocaleString() + '</p>';
+            content += '<p><strong>Created:</strong> ' + timestampHTML(alert.created_at) + '</p>';
+            content += '<p><strong>Updated:</strong> ' + timestampHTML(alert.updated_at) + '</p>';
             
             if (alert.acknowledged_by) {
                 content += '<p><strong>Acknowledged by:</strong> ' + alert.acknowledged_by + '</p>';
             }
             
             if (alert.resolved_at) {
-                content += '<p><strong>Resolved:</strong> ' + new Date(alert.resolved_at).toLocaleString() + '</p>';
+                content += '<p><strong>Resolved:</strong> ' + timestampHTML(alert.resolved_at) + '</p>';
             }
             
             content += '</div>';
@@ -1372,12 +2936,92 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 alert.notes.forEach(note => {
                     content += '<div style="background: #f8f9fa; padding: 10px; margin: 5px 0; border-radius: 3px;">';
                     content += '<div>' + note.message + '</div>';
-                    content += '<div style="font-size: 0.8em; color: #666; margin-top: 5px;">by ' + (note.author || 'Unknown') + ' at ' + new Date(note.created_at).toLocaleString() + '</div>';
+                    content += '<div style="font-size: 0.8em; color: #666; margin-top: 5px;">by ' + (note.author || 'Unknown') + ' at ' + timestampHTML(note.created_at) + '</div>';
                     content += '</div>';
                 });
             }
             
+            content += '<div id="modal-alert-cause"></div>';
             document.getElementById('modal-alert-content').innerHTML = content;
+            
+            // Rule labels, such as team=payments, as text
+            const labels = Object.entries(alert.labels || {}).map(([name, value]) => name + '=' + value);
+            if (labels.length > 0) {
+                const row = document.createElement('p');
+                const title = document.createElement('strong');
+                title.textContent = 'Labels: ';
+                row.appendChild(title);
+                row.appendChild(document.createTextNode(labels.sort().join(', ')));
+                const details = document.getElementById('modal-alert-content').firstChild;
+                details.appendChild(row);
+            }
+            
+            // Goroutine creation sites behind a goroutine leak alert, with one stack each
+            const suspects = ((alert.metadata || {}).trigger_data || {}).goroutine_leak_suspects || [];
+            if (suspects.length > 0) {
+                const section = document.createElement('div');
+                const heading = document.createElement('h4');
+                heading.textContent = 'Goroutine Leak Suspects:';
+                section.appendChild(heading);
+                suspects.forEach(suspect => {
+                    const site = document.createElement('p');
+                    site.textContent = suspect.site + ' (' + suspect.count + ' goroutines, +' + suspect.growth + ')';
+                    const stack = document.createElement('pre');
+                    stack.style.cssText = 'background: #f8f9fa; padding: 10px; overflow-x: auto; font-size: 0.8em;';
+                    stack.textContent = suspect.stack;
+                    section.appendChild(site);
+                    section.appendChild(stack);
+                });
+                document.getElementById('modal-alert-content').insertBefore(section, document.getElementById('modal-alert-cause'));
+            }
+            loadAlertCause(alert.id);
+        }
+        
+        /**
+         * Shows the probable cause of an alert and the metrics that deviated around it
+         */
+        function loadAlertCause(alertId) {
+            fetch('/api/alerts/' + encodeURIComponent(alertId) + '/cause')
+            .then(response => response.json())
+            .then(data => {
+                const container = document.getElementById('modal-alert-cause');
+                if (!container || data.status !== 'ok' || !selectedAlert || selectedAlert.id !== alertId) return;
+                const analysis = data.data;
+                container.innerHTML = '';
+                
+                if (analysis.probable_cause) {
+                    const cause = analysis.probable_cause;
+                    const line = document.createElement('p');
+                    const label = document.createElement('strong');
+                    label.textContent = 'Probable cause: ';
+                    const link = document.createElement('a');
+                    link.href = '#';
+                    link.textContent = cause.rule;
+                    link.onclick = function(event) {
+                        event.preventDefault();
+                        showAlertModal(cause.alert_id);
+                    };
+                    line.appendChild(label);
+                    line.appendChild(link);
+                    line.appendChild(document.createTextNode(' (' + cause.metric + ' deviated first, correlation ' + cause.correlation.toFixed(2) + ')'));
+                    container.appendChild(line);
+                }
+                
+                if (analysis.candidates.length > 0 && analysis.related.length > 1) {
+                    const heading = document.createElement('h4');
+                    heading.textContent = 'Deviating metrics around ' + analysis.related.length + ' related alerts:';
+                    container.appendChild(heading);
+                    const list = document.createElement('ol');
+                    analysis.candidates.slice(0, 5).forEach(candidate => {
+                        const item = document.createElement('li');
+                        item.textContent = candidate.metric + ': ' + candidate.deviation.toFixed(1) + ' standard deviations, from ';
+                        item.insertAdjacentHTML('beforeend', timestampHTML(candidate.deviated_at));
+                        list.appendChild(item);
+                    });
+                    container.appendChild(list);
+                }
+            })
+            .catch(() => {});
         }
         
         function closeAlertModal() {
@@ -1406,6 +3050,11 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             performAlertAction('add note', '/api/alerts/note');
         }
         
+        function exportIncident() {
+            if (!selectedAlert) return;
+            window.location.href = '/api/incidents/' + encodeURIComponent(selectedAlert.id) + '/export';
+        }
+        
         function performAlertAction(actionName, endpoint) {
             if (!selectedAlert) return;
             
@@ -1446,6 +3095,9 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 if (data.status === 'ok' && data.metrics) {
                     populateMetricSelectors(data.metrics);
                 }
+                if (data.query_language) {
+                    enableQueryLanguage(data.query_language);
+                }
             })
             .catch(error => {
                 console.error('Error loading metrics:', error);
@@ -1472,6 +3124,72 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 optionY.value = metric;
                 optionY.textContent = displayName;
                 metricYSelect.appendChild(optionY);
+                
+                document.getElementById('simulation-metrics').appendChild(new Option(displayName, metric));
+            });
+        }
+        
+        // Queries in an optional language such as PromQL, when the server has one
+        let queryChart = null;
+        
+        function enableQueryLanguage(name) {
+            document.querySelectorAll('.query-language-name').forEach(el => { el.textContent = name; });
+            document.getElementById('correlation-queries').style.display = 'grid';
+            document.getElementById('query-card').style.display = 'block';
+            document.getElementById('query-input').addEventListener('keydown', event => {
+                if (event.key === 'Enter') runQuery();
+            });
+        }
+        
+        function querySeriesName(series) {
+            const labels = Object.entries(series.labels || {}).map(([name, value]) => name + '="' + value + '"');
+            const name = series.metric || '';
+            return labels.length > 0 ? name + '{' + labels.join(', ') + '}' : (name || 'value');
+        }
+        
+        function runQuery() {
+            const query = document.getElementById('query-input').value.trim();
+            const status = document.getElementById('query-status');
+            if (!query) {
+                status.textContent = 'Enter a query';
+                return;
+            }
+            const end = new Date();
+            const start = new Date(end.getTime() - parseInt(document.getElementById('query-range').value) * 60000);
+            const params = new URLSearchParams({ query: query, start: start.toISOString().split('.')[0] + 'Z', end: end.toISOString().split('.')[0] + 'Z' });
+            status.textContent = 'Running query...';
+            
+            fetch('/api/query?' + params.toString())
+            .then(response => response.json())
+            .then(data => {
+                if (data.status !== 'ok') {
+                    status.textContent = 'Error: ' + (data.message || 'query failed');
+                    return;
+                }
+                const series = data.data.series || [];
+                status.textContent = series.length + ' series, step ' + data.data.step + 's';
+                
+                if (queryChart) queryChart.destroy();
+                queryChart = new Chart(document.getElementById('query-chart'), {
+                    ...chartConfig,
+                    data: {
+                        datasets: series.map((s, i) => ({
+                            label: querySeriesName(s),
+                            data: s.points.map(point => ({ x: new Date(point.timestamp), y: point.value })),
+                            borderColor: simulationColors[i % simulationColors.length],
+                            fill: false,
+                            pointRadius: 0
+                        }))
+                    },
+                    options: {
+                        ...chartConfig.options,
+                        scales: { ...chartConfig.options.scales, x: { ...chartConfig.options.scales.x, time: { unit: 'minute' } }, y: {} },
+                        plugins: { ...chartConfig.options.plugins, legend: { display: true } }
+                    }
+                });
+            })
+            .catch(error => {
+                status.textContent = 'Error: ' + error;
             });
         }
         
@@ -1480,6 +3198,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 'heap.alloc': 'Heap Memory Allocation',
                 'goroutines.count': 'Active Goroutines',
                 'gc.pause': 'GC Pause Time',
+                'sched.latency_p99': 'Scheduler Latency (p99)',
                 'http.response_time': 'HTTP Response Time',
                 'http.request_rate': 'HTTP Request Rate'
             };
@@ -1491,13 +3210,15 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             const metricY = document.getElementById('metric-y').value;
             const timeRange = parseInt(document.getElementById('time-range').value);
             const windowSize = parseInt(document.getElementById('window-size').value);
+            const queryX = document.getElementById('query-x').value.trim();
+            const queryY = document.getElementById('query-y').value.trim();
             
-            if (!metricX || !metricY) {
+            if ((!metricX && !queryX) || (!metricY && !queryY)) {
                 alert('Please select both X and Y metrics');
                 return;
             }
             
-            if (metricX === metricY) {
+            if (!queryX && !queryY && metricX === metricY) {
                 alert('Please select different metrics for X and Y axes');
                 return;
             }
@@ -1513,7 +3234,9 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                     metric_x: metricX,
                     metric_y: metricY,
                     time_range: timeRange,
-                    window_size: windowSize
+                    window_size: windowSize,
+                    query_x: queryX,
+                    query_y: queryY
                 })
             })
             .then(response => response.json())
@@ -1521,7 +3244,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 if (data.status === 'ok') {
                     displayCorrelationResults(data.data);
                 } else {
-                    document.getElementById('correlation-results').textContent = 'Error analyzing correlation';
+                    document.getElementById('correlation-results').textContent = 'Error analyzing correlation' + (data.message ? ': ' + data.message : '');
                 }
             })
             .catch(error => {
@@ -1567,7 +3290,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                 result.anomalies.forEach(anomaly => {
                     anomaliesHTML += '<div style="padding: 8px; margin: 5px 0; background: #fff5f5; border-left: 4px solid #e74c3c; border-radius: 3px;">';
                     anomaliesHTML += '<div style="font-weight: bold; color: #e74c3c;">' + anomaly.anomaly_type.replace(/_/g, ' ').toUpperCase() + '</div>';
-                    anomaliesHTML += '<div style="font-size: 0.9em; color: #666;">' + new Date(anomaly.timestamp).toLocaleString() + '</div>';
+                    anomaliesHTML += '<div style="font-size: 0.9em; color: #666;">' + timestampHTML(anomaly.timestamp) + '</div>';
                     anomaliesHTML += '<div style="font-size: 0.8em; color: #666;">Severity: ' + (anomaly.severity * 100).toFixed(1) + '%</div>';
                     anomaliesHTML += '</div>';
                 });
@@ -1627,13 +3350,19 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 </body>
 </html>`
 	
+	nonce := requestNonce(r)
+	html = strings.Replace(html, vendorScriptsMarker, s.vendorScriptTags(nonce), 1)
+	html = strings.Replace(html, nonceMarker, nonce, 1)
+	html = strings.Replace(html, valueFormatMarker, valueFormatAttribute(s.getValueFormat()), 1)
+	
 	w.Header().Set("Content-Type", "text/html")
 	w.Write([]byte(html))
 }
 
 func (s *Server) handleStatic(w http.ResponseWriter, r *http.Request) {
-	// Basic static file serving - in production, use proper static file server
-	http.NotFound(w, r)
+	// Vendored assets are pinned versions, so they can be cached aggressively
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	s.static.ServeHTTP(w, r)
 }
 
 func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
@@ -1645,7 +3374,7 @@ func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
 	
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status": "ok",
-		"data":   metrics,
+		"data":   s.filterMetricUpdate(s.resolveRole(r), metrics),
 	})
 }
 
@@ -1702,6 +3431,12 @@ func (s *Server) GetPort() int {
 	return s.port
 }
 
+// SetHost sets the interface the dashboard binds to, such as "127.0.0.1".
+// By default it listens on all interfaces. It must be called before Start.
+func (s *Server) SetHost(host string) {
+	s.host = host
+}
+
 // SetDebugEnabled controls whether debug logging is enabled for WebSocket connections
 // and metrics broadcasting. Disabled by default to prevent log spam in production.
 func (s *Server) SetDebugEnabled(enabled bool) {
@@ -1735,11 +3470,11 @@ func (s *Server) handleHistoricalMetrics(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	
-	s.mutex.RLock()
-	defer s.mutex.RUnlock()
+	role := s.resolveRole(r)
 	
+	s.mutex.RLock()
 	var filteredMetrics []MetricUpdate
-	for _, metric := range s.historicalMetrics {
+	for _, metric := range s.metricHistory() {
 		// Apply time range filter if specified
 		if !fromTime.IsZero() && metric.Timestamp.Before(fromTime) {
 			continue
@@ -1749,6 +3484,12 @@ func (s *Server) handleHistoricalMetrics(w http.ResponseWriter, r *http.Request)
 		}
 		filteredMetrics = append(filteredMetrics, metric)
 	}
+	s.mutex.RUnlock()
+	
+	// Apply per-role metric visibility outside the lock
+	for i := range filteredMetrics {
+		filteredMetrics[i] = s.filterMetricUpdate(role, filteredMetrics[i])
+	}
 	
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status": "ok",
@@ -1853,13 +3594,14 @@ func (s *Server) handlePlayback(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) startPlayback(from, to time.Time, speed float64, interval time.Duration) {
+	stop := s.stopChannel()
 	s.mutex.RLock()
 	
 	// Get historical data within the time range
 	var playbackMetrics []MetricUpdate
 	var playbackEvents []EventUpdate
 	
-	for _, metric := range s.historicalMetrics {
+	for _, metric := range s.metricHistory() {
 		if metric.Timestamp.After(from) && metric.Timestamp.Before(to) {
 			playbackMetrics = append(playbackMetrics, metric)
 		}
@@ -1910,15 +3652,11 @@ func (s *Server) startPlayback(from, to time.Time, speed float64, interval time.
 	
 	for _, item := range items {
 		select {
-		case <-s.stop:
+		case <-stop:
 			return
 		default:
 			if item.itemType == "metric" {
-				s.broadcastMessage(map[string]interface{}{
-					"type":     "playback_metric",
-					"data":     item.data,
-					"playback": true,
-				})
+				s.broadcastMetricUpdate("playback_metric", item.data.(MetricUpdate), true)
 			} else {
 				s.broadcastMessage(map[string]interface{}{
 					"type":     "playback_event",
@@ -1969,10 +3707,9 @@ func (s *Server) handleRuleValidation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
-	// Simple validation - check for basic DSL structure
-	// In a real implementation, this would use the actual parser
 	valid := true
 	errors := []string{}
+	var parseErrors []*parser.ParseError
 	
 	if req.Code == "" {
 		valid = false
@@ -1986,10 +3723,16 @@ func (s *Server) handleRuleValidation(w http.ResponseWriter, r *http.Request) {
 		errors = append(errors, "Rule must contain 'when' condition and action block")
 	}
 	
-	// Check for balanced braces
-	if valid && !hasBalancedBraces(req.Code) {
-		valid = false
-		errors = append(errors, "Unbalanced braces in rule code")
+	// Parse the rule to report syntax errors with their positions
+	if valid {
+		p := parser.New(parser.NewLexer(req.Code))
+		p.ParseProgram()
+		if parseErrors = p.Errors(); len(parseErrors) > 0 {
+			valid = false
+			for _, err := range parseErrors {
+				errors = append(errors, err.Error())
+			}
+		}
 	}
 	
 	response := map[string]interface{}{
@@ -1998,6 +3741,9 @@ func (s *Server) handleRuleValidation(w http.ResponseWriter, r *http.Request) {
 	
 	if !valid {
 		response["errors"] = errors
+		if len(parseErrors) > 0 {
+			response["parse_errors"] = parseErrors
+		}
 	} else {
 		response["message"] = "Rule syntax is valid"
 	}
@@ -2006,28 +3752,6 @@ func (s *Server) handleRuleValidation(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func (s *Server) handleRuleSave(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	
-	var req RuleRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
-		return
-	}
-	
-	// In a real implementation, this would save the rule to the engine
-	// For now, we'll just return success
-	
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"status":  "ok",
-		"message": fmt.Sprintf("Rule '%s' saved successfully", req.Name),
-	})
-}
-
 func (s *Server) handleRuleTest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -2065,27 +3789,10 @@ func (s *Server) handleRuleTest(w http.ResponseWriter, r *http.Request) {
 		"status":      "ok",
 		"wouldTrigger": wouldTrigger,
 		"result":      testResult,
-		"metrics":     currentMetrics,
+		"metrics":     s.filterMetrics(s.resolveRole(r), currentMetrics),
 	})
 }
 
-// Helper functions for rule validation
-
-func hasBalancedBraces(code string) bool {
-	count := 0
-	for _, char := range code {
-		if char == '{' {
-			count++
-		} else if char == '}' {
-			count--
-			if count < 0 {
-				return false
-			}
-		}
-	}
-	return count == 0
-}
-
 func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	
@@ -2094,6 +3801,17 @@ func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 	statusFilter := query.Get("status")
 	severityFilter := query.Get("severity")
 	
+	// Each label=name=value parameter requires that label
+	labelFilter := make(map[string]string)
+	for _, param := range query["label"] {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok || name == "" {
+			http.Error(w, "label filter must be name=value", http.StatusBadRequest)
+			return
+		}
+		labelFilter[name] = value
+	}
+	
 	s.mutex.RLock()
 	filteredAlerts := make([]Alert, 0, len(s.alerts))
 	
@@ -2108,6 +3826,10 @@ func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 		
+		if !alertHasLabels(alert, labelFilter) {
+			continue
+		}
+		
 		filteredAlerts = append(filteredAlerts, alert)
 	}
 	s.mutex.RUnlock()
@@ -2121,6 +3843,16 @@ func (s *Server) handleAlerts(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// alertHasLabels reports whether an alert carries every label in want
+func alertHasLabels(alert Alert, want map[string]string) bool {
+	for name, value := range want {
+		if got, ok := alert.Labels[name]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
 type AlertActionRequest struct {
 	AlertID string `json:"alert_id"`
 	User    string `json:"user,omitempty"`
@@ -2159,7 +3891,7 @@ func (s *Server) handleAcknowledgeAlert(w http.ResponseWriter, r *http.Request)
 	for i := range s.alerts {
 		if s.alerts[i].ID == req.AlertID {
 			s.alerts[i].Status = AlertStatusAcknowledged
-			s.alerts[i].UpdatedAt = time.Now()
+			s.alerts[i].UpdatedAt = time.Now().UTC()
 			if req.User != "" {
 				s.alerts[i].AcknowledgedBy = &req.User
 			}
@@ -2170,7 +3902,7 @@ func (s *Server) handleAcknowledgeAlert(w http.ResponseWriter, r *http.Request)
 					ID:        generateAlertID(),
 					Message:   req.Note,
 					Author:    req.User,
-					CreatedAt: time.Now(),
+					CreatedAt: time.Now().UTC(),
 				}
 				s.alerts[i].Notes = append(s.alerts[i].Notes, note)
 			}
@@ -2221,8 +3953,8 @@ func (s *Server) handleResolveAlert(w http.ResponseWriter, r *http.Request) {
 	for i := range s.alerts {
 		if s.alerts[i].ID == req.AlertID {
 			s.alerts[i].Status = AlertStatusResolved
-			s.alerts[i].UpdatedAt = time.Now()
-			now := time.Now()
+			s.alerts[i].UpdatedAt = time.Now().UTC()
+			now := time.Now().UTC()
 			s.alerts[i].ResolvedAt = &now
 			
 			// Add note if provided
@@ -2231,7 +3963,7 @@ func (s *Server) handleResolveAlert(w http.ResponseWriter, r *http.Request) {
 					ID:        generateAlertID(),
 					Message:   req.Note,
 					Author:    req.User,
-					CreatedAt: time.Now(),
+					CreatedAt: time.Now().UTC(),
 				}
 				s.alerts[i].Notes = append(s.alerts[i].Notes, note)
 			}
@@ -2282,7 +4014,7 @@ func (s *Server) handleSuppressAlert(w http.ResponseWriter, r *http.Request) {
 	for i := range s.alerts {
 		if s.alerts[i].ID == req.AlertID {
 			s.alerts[i].Status = AlertStatusSuppressed
-			s.alerts[i].UpdatedAt = time.Now()
+			s.alerts[i].UpdatedAt = time.Now().UTC()
 			
 			// Add note if provided
 			if req.Note != "" {
@@ -2290,7 +4022,7 @@ func (s *Server) handleSuppressAlert(w http.ResponseWriter, r *http.Request) {
 					ID:        generateAlertID(),
 					Message:   req.Note,
 					Author:    req.User,
-					CreatedAt: time.Now(),
+					CreatedAt: time.Now().UTC(),
 				}
 				s.alerts[i].Notes = append(s.alerts[i].Notes, note)
 			}
@@ -2335,10 +4067,10 @@ func (s *Server) handleAddAlertNote(w http.ResponseWriter, r *http.Request) {
 				ID:        generateAlertID(),
 				Message:   req.Note,
 				Author:    req.User,
-				CreatedAt: time.Now(),
+				CreatedAt: time.Now().UTC(),
 			}
 			s.alerts[i].Notes = append(s.alerts[i].Notes, note)
-			s.alerts[i].UpdatedAt = time.Now()
+			s.alerts[i].UpdatedAt = time.Now().UTC()
 			
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(map[string]interface{}{
@@ -2371,6 +4103,10 @@ type CorrelationRequest struct {
 	MetricY    string `json:"metric_y"`
 	TimeRange  int    `json:"time_range"` // minutes
 	WindowSize int    `json:"window_size"` // data points
+	// QueryX and QueryY replace the metrics with queries in the configured
+	// query language, evaluated at WindowSize steps over the time range
+	QueryX     string `json:"query_x,omitempty"`
+	QueryY     string `json:"query_y,omitempty"`
 }
 
 type CorrelationResult struct {
@@ -2398,22 +4134,51 @@ type AnomalyPoint struct {
 	Severity    float64   `json:"severity"`
 }
 
+// customMetricNames returns the custom.* metrics in the latest metric update,
+// sorted
+func (s *Server) customMetricNames() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var names []string
+	for name := range s.recentMetrics.Metrics {
+		if strings.HasPrefix(name, "custom.") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 func (s *Server) handleMetricCorrelation(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	
+	role := s.resolveRole(r)
+	
 	if r.Method == http.MethodGet {
 		// Return available metrics for correlation
-		availableMetrics := []string{
+		availableMetrics := []string{}
+		for _, metric := range []string{
 			"heap.alloc",
 			"goroutines.count", 
 			"gc.pause",
+			"sched.latency_p99",
 			"http.response_time",
 			"http.request_rate",
+		} {
+			if s.canViewMetric(role, metric) {
+				availableMetrics = append(availableMetrics, metric)
+			}
+		}
+		for _, metric := range s.customMetricNames() {
+			if s.canViewMetric(role, metric) {
+				availableMetrics = append(availableMetrics, metric)
+			}
 		}
 		
 		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":  "ok",
-			"metrics": availableMetrics,
+			"status":         "ok",
+			"metrics":        availableMetrics,
+			"query_language": s.queryLanguageName(),
 		})
 		return
 	}
@@ -2429,6 +4194,17 @@ func (s *Server) handleMetricCorrelation(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	
+	querying := req.QueryX != "" || req.QueryY != ""
+	if querying && s.queryLanguageName() == "" {
+		http.Error(w, "Query language not configured", http.StatusServiceUnavailable)
+		return
+	}
+	// Queries see only the metrics the role may view
+	if !querying && (!s.canViewMetric(role, req.MetricX) || !s.canViewMetric(role, req.MetricY)) {
+		http.Error(w, "Access to requested metric denied", http.StatusForbidden)
+		return
+	}
+	
 	// Default values
 	if req.TimeRange <= 0 {
 		req.TimeRange = 60 // 1 hour
@@ -2437,7 +4213,23 @@ func (s *Server) handleMetricCorrelation(w http.ResponseWriter, r *http.Request)
 		req.WindowSize = 100
 	}
 	
-	result := s.calculateCorrelation(req)
+	var result CorrelationResult
+	if querying {
+		dataPoints, err := s.queryCorrelationPoints(role, req)
+		if err != nil {
+			writeRuleError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.QueryX != "" {
+			req.MetricX = req.QueryX
+		}
+		if req.QueryY != "" {
+			req.MetricY = req.QueryY
+		}
+		result = analyzeCorrelation(req, dataPoints)
+	} else {
+		result = s.calculateCorrelation(req)
+	}
 	
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status": "ok",
@@ -2453,7 +4245,7 @@ func (s *Server) calculateCorrelation(req CorrelationRequest) CorrelationResult
 	cutoffTime := time.Now().Add(-time.Duration(req.TimeRange) * time.Minute)
 	
 	var dataPoints []ScatterPoint
-	for _, metric := range s.historicalMetrics {
+	for _, metric := range s.metricHistory() {
 		if metric.Timestamp.Before(cutoffTime) {
 			continue
 		}
@@ -2475,6 +4267,11 @@ func (s *Server) calculateCorrelation(req CorrelationRequest) CorrelationResult
 		dataPoints = dataPoints[len(dataPoints)-req.WindowSize:]
 	}
 	
+	return analyzeCorrelation(req, dataPoints)
+}
+
+// analyzeCorrelation computes the correlation and anomalies of paired values
+func analyzeCorrelation(req CorrelationRequest, dataPoints []ScatterPoint) CorrelationResult {
 	// Calculate correlation coefficient
 	correlation := calculatePearsonCorrelation(dataPoints)
 	strength := getCorrelationStrength(correlation)
@@ -2503,6 +4300,12 @@ func getMetricValue(metrics map[string]interface{}, metricName string) (float64,
 			return float64(v), true
 		case int64:
 			return float64(v), true
+		case uint32:
+			return float64(v), true
+		case uint64:
+			return float64(v), true
+		case time.Duration:
+			return float64(v), true
 		}
 	}
 	return 0, false
@@ -2603,6 +4406,8 @@ func detectAnomalies(points []ScatterPoint, expectedCorrelation float64) []Anoma
 }
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	stop := s.stopChannel()
+	
 	// Debug logging for WebSocket connections
 	if s.debugEnabled {
 		log.Printf("WebSocket connection attempt from: %s", r.RemoteAddr)
@@ -2636,7 +4441,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	defer conn.Close()
 	
 	s.clientsMutex.Lock()
-	s.clients[conn] = true
+	s.clients[conn] = s.resolveRole(r)
 	s.clientsMutex.Unlock()
 	
 	defer func() {
@@ -2683,7 +4488,7 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		case <-readDone:
 			// Client disconnected
 			return
-		case <-s.stop:
+		case <-stop:
 			// Server shutdown
 			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
@@ -2692,19 +4497,14 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) broadcast() {
+func (s *Server) broadcast(stop chan struct{}) {
 	for {
 		select {
 		case metric := <-s.metrics:
 			// Store recent metrics and historical data
 			s.mutex.Lock()
 			s.recentMetrics = metric
-			s.historicalMetrics = append(s.historicalMetrics, metric)
-			if len(s.historicalMetrics) > s.maxHistorySize {
-				// Properly release memory by copying and truncating
-				copy(s.historicalMetrics, s.historicalMetrics[1:])
-				s.historicalMetrics = s.historicalMetrics[:s.maxHistorySize]
-			}
+			s.recordMetricHistory(metric)
 			s.mutex.Unlock()
 			
 			// Debug logging for metrics broadcast
@@ -2712,10 +4512,7 @@ func (s *Server) broadcast() {
 				log.Printf("Broadcasting metrics update with %d data points", len(metric.Metrics))
 			}
 			
-			s.broadcastMessage(map[string]interface{}{
-				"type": "metrics",
-				"data": metric,
-			})
+			s.broadcastMetricUpdate("metrics", metric, false)
 		case event := <-s.events:
 			// Store in circular buffer and historical data
 			s.mutex.Lock()
@@ -2736,7 +4533,7 @@ func (s *Server) broadcast() {
 				"type": "event",
 				"data": event,
 			})
-		case <-s.stop:
+		case <-stop:
 			return
 		}
 	}
@@ -0,0 +1,54 @@
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// maxSimulationRequestSize bounds the body of a /api/simulate request
+const maxSimulationRequestSize = 1 << 20
+
+// SetSimulator connects the /api/simulate endpoint, behind the rule editor's
+// load simulation, to the engine. simulate receives the JSON request body and
+// returns the result, or an error describing why the request is invalid.
+func (s *Server) SetSimulator(simulate func(ctx context.Context, request json.RawMessage) (interface{}, error)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.simulate = simulate
+}
+
+// handleSimulate runs a simulation of the rules against synthetic metrics
+func (s *Server) handleSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.mutex.RLock()
+	simulate := s.simulate
+	s.mutex.RUnlock()
+	if simulate == nil {
+		http.Error(w, "Simulation not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSimulationRequestSize))
+	if err != nil || !json.Valid(body) {
+		http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		return
+	}
+
+	result, err := simulate(r.Context(), body)
+	if err != nil {
+		writeRuleError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   result,
+	})
+}
@@ -0,0 +1,317 @@
+package dashboard
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// Public status values reported by the status page
+const (
+	StatusOperational = "operational"
+	StatusDegraded    = "degraded"
+	StatusOutage      = "outage"
+)
+
+// statusWindow and statusBuckets define the uptime sparkline: 24 hourly buckets
+const (
+	statusWindow  = 24 * time.Hour
+	statusBuckets = 24
+)
+
+// defaultStatusTitle is shown for a critical alert whose rule has no description
+const defaultStatusTitle = "Service disruption"
+
+// severityPenalty is subtracted from the health score for each ongoing alert
+var severityPenalty = map[AlertSeverity]int{
+	AlertSeverityLow:      1,
+	AlertSeverityMedium:   5,
+	AlertSeverityHigh:     10,
+	AlertSeverityCritical: 25,
+}
+
+// StatusSummary is the public view served by /status and /api/status. It is
+// derived from alerts only and never includes rule names, rule sources or
+// metric values, so it is safe to share with stakeholders.
+type StatusSummary struct {
+	Status         string         `json:"status"`
+	HealthScore    int            `json:"health_score"`
+	CriticalAlerts []StatusAlert  `json:"critical_alerts"`
+	UptimePercent  float64        `json:"uptime_percent"`
+	Uptime         []StatusSample `json:"uptime"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// StatusAlert is the title and start time of an ongoing critical alert. The
+// title is the description of the rule that raised it, or a generic title for
+// rules without one; alert messages are never shown, since they can carry
+// metric values and internal details.
+type StatusAlert struct {
+	Title string    `json:"title"`
+	Since time.Time `json:"since"`
+}
+
+// StatusSample is the worst status observed during one sparkline bucket
+type StatusSample struct {
+	Start  time.Time `json:"start"`
+	Status string    `json:"status"`
+}
+
+// SetPublicStatusMode restricts the dashboard to the read-only status page.
+// While enabled, every route other than /status and /api/status responds
+// with 404, so the server can be exposed without revealing rules, metrics or
+// controls.
+func (s *Server) SetPublicStatusMode(enabled bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.publicStatusOnly = enabled
+}
+
+// publicStatusFilter hides everything except the status page when public
+// status mode is enabled
+func (s *Server) publicStatusFilter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.RLock()
+		statusOnly := s.publicStatusOnly
+		s.mutex.RUnlock()
+
+		if statusOnly {
+			switch r.URL.Path {
+			case "/status", "/api/status":
+			default:
+				http.NotFound(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusSummary computes the public status from the alert history
+func (s *Server) statusSummary(now time.Time) StatusSummary {
+	s.mutex.RLock()
+	alerts := make([]Alert, len(s.alerts))
+	copy(alerts, s.alerts)
+	s.mutex.RUnlock()
+
+	summary := StatusSummary{
+		Status:         StatusOperational,
+		HealthScore:    100,
+		CriticalAlerts: []StatusAlert{},
+		UpdatedAt:      now,
+	}
+
+	descriptions := s.ruleDescriptions()
+	for _, alert := range alerts {
+		if !isOngoingAlert(alert) {
+			continue
+		}
+		summary.HealthScore -= severityPenalty[alert.Severity]
+		if status := severityStatus(alert.Severity); statusRank(status) > statusRank(summary.Status) {
+			summary.Status = status
+		}
+		if alert.Severity == AlertSeverityCritical {
+			title := descriptions[alert.Rule]
+			if title == "" {
+				title = defaultStatusTitle
+			}
+			summary.CriticalAlerts = append(summary.CriticalAlerts, StatusAlert{Title: title, Since: alert.CreatedAt})
+		}
+	}
+	if summary.HealthScore < 0 {
+		summary.HealthScore = 0
+	}
+
+	bucketSize := statusWindow / statusBuckets
+	windowStart := now.Add(-statusWindow)
+	for i := 0; i < statusBuckets; i++ {
+		start := windowStart.Add(time.Duration(i) * bucketSize)
+		end := start.Add(bucketSize)
+		sample := StatusSample{Start: start, Status: StatusOperational}
+
+		for _, alert := range alerts {
+			from, to, ok := alertInterval(alert, now)
+			if !ok || !from.Before(end) || !to.After(start) {
+				continue
+			}
+			if status := severityStatus(alert.Severity); statusRank(status) > statusRank(sample.Status) {
+				sample.Status = status
+			}
+		}
+		summary.Uptime = append(summary.Uptime, sample)
+	}
+
+	// Uptime is the share of the window not covered by a critical alert
+	var intervals [][2]time.Time
+	for _, alert := range alerts {
+		if alert.Severity != AlertSeverityCritical {
+			continue
+		}
+		if from, to, ok := alertInterval(alert, now); ok {
+			if from.Before(windowStart) {
+				from = windowStart
+			}
+			if to.After(from) {
+				intervals = append(intervals, [2]time.Time{from, to})
+			}
+		}
+	}
+	outage := mergedDuration(intervals)
+	summary.UptimePercent = 100 * (1 - outage.Seconds()/statusWindow.Seconds())
+
+	return summary
+}
+
+// ruleDescriptions returns the description of each rule that declares one
+func (s *Server) ruleDescriptions() map[string]string {
+	descriptions := make(map[string]string)
+	if s.getRules == nil {
+		return descriptions
+	}
+	rules, _ := s.getRules().([]map[string]interface{})
+	for _, rule := range rules {
+		name, _ := rule["name"].(string)
+		if description, _ := rule["description"].(string); name != "" && description != "" {
+			descriptions[name] = description
+		}
+	}
+	return descriptions
+}
+
+// isOngoingAlert reports whether an alert still affects the current status
+func isOngoingAlert(alert Alert) bool {
+	return alert.Status == AlertStatusActive || alert.Status == AlertStatusAcknowledged
+}
+
+// alertInterval returns the period an alert affected the status. Suppressed
+// alerts are ignored entirely.
+func alertInterval(alert Alert, now time.Time) (time.Time, time.Time, bool) {
+	switch alert.Status {
+	case AlertStatusSuppressed:
+		return time.Time{}, time.Time{}, false
+	case AlertStatusResolved:
+		if alert.ResolvedAt == nil {
+			return alert.CreatedAt, alert.UpdatedAt, true
+		}
+		return alert.CreatedAt, *alert.ResolvedAt, true
+	default:
+		return alert.CreatedAt, now, true
+	}
+}
+
+// mergedDuration returns the total time covered by possibly overlapping intervals
+func mergedDuration(intervals [][2]time.Time) time.Duration {
+	var total time.Duration
+	var covered time.Time
+	for len(intervals) > 0 {
+		// Take the earliest remaining interval
+		earliest := 0
+		for i := range intervals {
+			if intervals[i][0].Before(intervals[earliest][0]) {
+				earliest = i
+			}
+		}
+		from, to := intervals[earliest][0], intervals[earliest][1]
+		intervals = append(intervals[:earliest], intervals[earliest+1:]...)
+
+		if from.Before(covered) {
+			from = covered
+		}
+		if to.After(from) {
+			total += to.Sub(from)
+			covered = to
+		}
+	}
+	return total
+}
+
+// severityStatus maps an alert severity to the public status it implies
+func severityStatus(severity AlertSeverity) string {
+	switch severity {
+	case AlertSeverityCritical:
+		return StatusOutage
+	case AlertSeverityHigh:
+		return StatusDegraded
+	default:
+		return StatusOperational
+	}
+}
+
+// statusRank orders statuses from best to worst
+func statusRank(status string) int {
+	switch status {
+	case StatusOutage:
+		return 2
+	case StatusDegraded:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (s *Server) handleStatusAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": "ok",
+		"data":   s.statusSummary(time.Now().UTC()),
+	})
+}
+
+// statusPageTemplate renders the status page without any scripts so it works
+// under the strictest Content-Security-Policy
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"barX": func(i int) int { return i * 12 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <title>Service Status</title>
+    <meta http-equiv="refresh" content="60">
+    <style>
+        body { font-family: Arial, sans-serif; margin: 0; padding: 20px; background: #f5f5f5; }
+        .card { background: white; padding: 20px; border-radius: 5px; box-shadow: 0 2px 4px rgba(0,0,0,0.1); max-width: 640px; margin: 0 auto 20px; }
+        .status { font-size: 1.5em; font-weight: bold; text-transform: capitalize; }
+        .operational { color: #27ae60; fill: #27ae60; }
+        .degraded { color: #f39c12; fill: #f39c12; }
+        .outage { color: #e74c3c; fill: #e74c3c; }
+        .label { color: #7f8c8d; }
+        .timestamp { font-size: 0.8em; color: #7f8c8d; }
+    </style>
+</head>
+<body>
+    <div class="card">
+        <div class="status {{.Status}}">{{.Status}}</div>
+        <p class="label">Health score: {{.HealthScore}}/100</p>
+    </div>
+    <div class="card">
+        <div class="label">Active critical alerts</div>
+        {{range .CriticalAlerts}}<p>{{.Title}} <span class="timestamp">since {{.Since.Format "2006-01-02 15:04 MST"}}</span></p>
+        {{else}}<p>None</p>{{end}}
+    </div>
+    <div class="card">
+        <div class="label">Uptime (last 24 hours): {{printf "%.2f" .UptimePercent}}%</div>
+        <svg width="288" height="30" role="img" aria-label="Hourly status">
+            {{range $i, $sample := .Uptime}}<rect class="{{$sample.Status}}" x="{{barX $i}}" y="0" width="10" height="30"><title>{{$sample.Start.Format "15:04"}} {{$sample.Status}}</title></rect>
+            {{end}}
+        </svg>
+        <p class="timestamp">Updated {{.UpdatedAt.Format "2006-01-02 15:04:05 MST"}}</p>
+    </div>
+</body>
+</html>`))
+
+func (s *Server) handleStatusPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := statusPageTemplate.Execute(w, s.statusSummary(time.Now().UTC())); err != nil {
+		http.Error(w, "Failed to render status page", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,86 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusSummary(t *testing.T) {
+	server := NewServer(0)
+	server.SetRulesProvider(func() interface{} {
+		return []map[string]interface{}{{"name": "db_pool", "description": "Database unreachable"}}
+	})
+	now := time.Now()
+	resolvedAt := now.Add(-3 * time.Hour)
+	server.alerts = []Alert{
+		{Rule: "db_pool", Message: "Pool exhausted: 512 connections to 10.0.0.5", Severity: AlertSeverityCritical,
+			Status: AlertStatusActive, CreatedAt: now.Add(-30 * time.Minute)},
+		{Rule: "latency", Message: "Slow responses", Severity: AlertSeverityHigh,
+			Status: AlertStatusResolved, CreatedAt: now.Add(-5 * time.Hour), ResolvedAt: &resolvedAt},
+		{Rule: "noise", Message: "Ignored", Severity: AlertSeverityCritical,
+			Status: AlertStatusSuppressed, CreatedAt: now.Add(-10 * time.Hour)},
+	}
+
+	summary := server.statusSummary(now)
+	if summary.Status != StatusOutage || summary.HealthScore != 75 {
+		t.Errorf("expected outage with score 75, got %s/%d", summary.Status, summary.HealthScore)
+	}
+	if len(summary.CriticalAlerts) != 1 || summary.CriticalAlerts[0].Title != "Database unreachable" {
+		t.Errorf("unexpected critical alerts: %+v", summary.CriticalAlerts)
+	}
+	if len(summary.Uptime) != statusBuckets || summary.Uptime[statusBuckets-1].Status != StatusOutage {
+		t.Errorf("expected latest bucket to show the outage, got %+v", summary.Uptime)
+	}
+	if summary.Uptime[statusBuckets-5].Status != StatusDegraded {
+		t.Errorf("expected resolved high alert to mark its bucket degraded, got %+v", summary.Uptime)
+	}
+	if summary.UptimePercent < 97.9 || summary.UptimePercent > 98 {
+		t.Errorf("expected about 97.9%% uptime, got %f", summary.UptimePercent)
+	}
+}
+
+func TestPublicStatusMode(t *testing.T) {
+	server := NewServer(0)
+	server.SetRulesProvider(func() interface{} {
+		return []map[string]interface{}{{"name": "secret_rule", "description": "Checkout down"}}
+	})
+	server.alerts = []Alert{
+		{Rule: "secret_rule", Message: "Checkout failing for 42 orders", Severity: AlertSeverityCritical,
+			Status: AlertStatusActive, CreatedAt: time.Now()},
+		{Rule: "undescribed", Message: "heap.alloc at 1.9GB", Severity: AlertSeverityCritical,
+			Status: AlertStatusActive, CreatedAt: time.Now()},
+	}
+	server.SetPublicStatusMode(true)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", server.handleStatusPage)
+	mux.HandleFunc("/api/rules", server.handleRules)
+	handler := server.publicStatusFilter(mux)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, "Checkout down") {
+		t.Errorf("expected status page listing the critical alert, got %d: %s", rec.Code, body)
+	}
+	if !strings.Contains(body, "UTC</p>") {
+		t.Error("expected status page times in UTC")
+	}
+	if strings.Contains(body, "secret_rule") || strings.Contains(body, "<script") {
+		t.Error("expected status page to omit rule names and scripts")
+	}
+	// Alert messages can carry metric values, so rules without a description
+	// get a generic title
+	if strings.Contains(body, "42 orders") || strings.Contains(body, "1.9GB") || !strings.Contains(body, defaultStatusTitle) {
+		t.Errorf("expected titles without alert messages, got %s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/rules", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected rules API to be hidden in public status mode, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,274 @@
+package descry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+// DebugHandler returns a handler serving a plain-text dump of the engine's
+// state, in the spirit of net/http/pprof: rules with their evaluation
+// statistics, resource limits, the state of the metric collectors, registered
+// action handlers and recent rule errors. It is meant for a quick
+//
+//	curl localhost:6060/debug/descry
+//
+// over SSH when the dashboard isn't reachable. The dump names rules, files
+// and handler types but not rule source or handler credentials. Mount it on
+// an internal listener, since it is served without authentication:
+//
+//	mux.Handle("/debug/descry", engine.DebugHandler())
+func (e *Engine) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		e.WriteDebug(w)
+	})
+}
+
+// WriteDebug writes the state dump served by DebugHandler to w, e.g. to
+// print it on a signal
+func (e *Engine) WriteDebug(w io.Writer) error {
+	var buf bytes.Buffer
+	e.writeDebugEngine(&buf)
+	e.writeDebugRules(&buf)
+	e.writeDebugLimits(&buf)
+	e.writeDebugCollectors(&buf)
+	e.writeDebugHandlers(&buf)
+	e.writeDebugErrors(&buf)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func (e *Engine) writeDebugEngine(buf *bytes.Buffer) {
+	now := e.clock.Now()
+	fmt.Fprintf(buf, "descry engine at %s\n\n", now.Format(time.RFC3339))
+	tw := debugTable(buf)
+	fmt.Fprintf(tw, "running\t%t\n", e.IsRunning())
+	if e.IsRunning() {
+		fmt.Fprintf(tw, "uptime\t%s\n", e.GetUptime().Round(time.Second))
+	}
+	fmt.Fprintf(tw, "dry run\t%t\n", e.IsDryRun())
+	fmt.Fprintf(tw, "evaluation\tevery %s, %d worker(s)\n", e.config.EvaluationInterval, e.config.EvaluationWorkers)
+	tw.Flush()
+}
+
+func (e *Engine) writeDebugRules(buf *bytes.Buffer) {
+	rules := e.GetRules()
+	stats := e.GetRuleStats()
+	fmt.Fprintf(buf, "\nrules (%d)\n", len(rules))
+	if len(rules) == 0 {
+		return
+	}
+	tw := debugTable(buf)
+	fmt.Fprintln(tw, "NAME\tSTATE\tGROUP\tEVALS\tTRIGGERS\tERRORS\tTIMEOUTS\tAVG\tMAX\tLAST TRIGGERED\tLAST ERROR")
+	for i, rule := range rules {
+		state := "enabled"
+		if rule.Disabled {
+			state = "disabled"
+		} else if rule.DryRun {
+			state = "dry run"
+		}
+		s := stats[i]
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			rule.Name, state, debugOr(rule.Group, "-"), s.Evaluations, s.Triggers, s.Errors, s.Timeouts,
+			s.AverageDuration.Round(time.Microsecond), s.MaxDuration.Round(time.Microsecond),
+			debugTime(s.LastTriggered), debugOr(debugLine(s.LastError), "-"))
+	}
+	tw.Flush()
+}
+
+func (e *Engine) writeDebugLimits(buf *bytes.Buffer) {
+	limits := e.GetResourceLimits()
+	fmt.Fprintf(buf, "\nresource limits\n")
+	tw := debugTable(buf)
+	fmt.Fprintf(tw, "max rules\t%d\t(%d loaded)\n", limits.MaxRules, len(e.GetRules()))
+	fmt.Fprintf(tw, "max rule complexity\t%d\tAST nodes\n", limits.MaxRuleComplexity)
+	fmt.Fprintf(tw, "max memory usage\t%d\tbytes\n", limits.MaxMemoryUsage)
+	fmt.Fprintf(tw, "max CPU time\t%s\tper evaluation\n", limits.MaxCPUTime)
+	fmt.Fprintf(tw, "max evaluation time\t%s\tper evaluation\n", limits.MaxEvaluationTime)
+	fmt.Fprintf(tw, "max metric history\t%d\tsamples per metric\n", limits.MaxMetricHistorySize)
+	fmt.Fprintf(tw, "max custom metrics\t%d\t(%d set)\n", limits.MaxCustomMetrics, len(e.customMetrics.values()))
+	tw.Flush()
+}
+
+func (e *Engine) writeDebugCollectors(buf *bytes.Buffer) {
+	fmt.Fprintf(buf, "\ncollectors\n")
+	tw := debugTable(buf)
+
+	runtimeState := "stopped"
+	if e.runtimeCollector.IsRunning() {
+		runtimeState = "running"
+	}
+	current := e.runtimeCollector.GetCurrent()
+	fmt.Fprintf(tw, "runtime\t%s, every %s, %d samples, last at %s\n", runtimeState,
+		e.config.CollectionInterval, len(e.runtimeCollector.GetHistory()), debugTime(current.Timestamp))
+
+	httpStats := e.GetHTTPMetrics()
+	breakdown := e.GetHTTPBreakdown()
+	fmt.Fprintf(tw, "http\t%d requests, %d pending, %d route labels, %d exclusions\n", httpStats.RequestCount,
+		httpStats.PendingRequests, len(breakdown.Routes), len(e.httpMetrics.GetExclusions()))
+	for _, name := range e.GetHTTPServerNames() {
+		if stats, exists := e.GetHTTPServerMetrics(name); exists {
+			fmt.Fprintf(tw, "http.%s\t%d requests, %d pending\n", name, stats.RequestCount, stats.PendingRequests)
+		}
+	}
+
+	fmt.Fprintf(tw, "heap leak detector\t%d samples\n", e.leak.sampleCount())
+	fmt.Fprintf(tw, "goroutine leak detector\t%d suspects, last profile at %s\n",
+		e.goroutineLeaks.suspectCount(), debugTime(e.goroutineLeaks.lastProfiled()))
+
+	e.providerMutex.RLock()
+	names := make([]string, 0, len(e.providers))
+	for name := range e.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		state := e.providers[name]
+		line := fmt.Sprintf("%d metrics, last collected at %s", len(state.values), debugTime(state.collected))
+		if state.err != nil {
+			line += ", last collection failed: " + debugLine(state.err.Error())
+		}
+		fmt.Fprintf(tw, "provider %s\t%s\n", name, line)
+	}
+	e.providerMutex.RUnlock()
+
+	e.mutex.RLock()
+	watcher, snapshots, encryption, stateFlush := e.rulesWatch, e.snapshots, e.encryption, e.stateFlush
+	dashboardRunning, dashboardConnected := e.dashboardRunning, e.dashboardConnected
+	e.mutex.RUnlock()
+	if watcher != nil {
+		fmt.Fprintf(tw, "rules watch\t%s every %s\n", watcher.dir, watcher.interval)
+	} else {
+		fmt.Fprintf(tw, "rules watch\toff\n")
+	}
+	if snapshots != nil {
+		fmt.Fprintf(tw, "report snapshots\tevery %s to %T\n", snapshots.Interval, snapshots.Store)
+	} else {
+		fmt.Fprintf(tw, "report snapshots\toff\n")
+	}
+	if stateFlush != nil {
+		fmt.Fprintf(tw, "state flush\tevery %s to %s\n", stateFlush.Interval, stateFlush.Path)
+	} else {
+		fmt.Fprintf(tw, "state flush\toff\n")
+	}
+	if encryption != nil {
+		fmt.Fprintf(tw, "storage encryption\tAES-256-GCM, key %s\n", encryption.KeyName)
+	} else {
+		fmt.Fprintf(tw, "storage encryption\toff\n")
+	}
+	switch {
+	case e.config.DisableDashboard:
+		fmt.Fprintf(tw, "dashboard\tdisabled\n")
+	case dashboardRunning:
+		fmt.Fprintf(tw, "dashboard\trunning on port %d, connected %t\n", e.dashboard.GetPort(), dashboardConnected)
+	default:
+		fmt.Fprintf(tw, "dashboard\tnot running\n")
+	}
+	tw.Flush()
+}
+
+func (e *Engine) writeDebugHandlers(buf *bytes.Buffer) {
+	registrations := e.actionRegistry.Registrations()
+	fmt.Fprintf(buf, "\naction handlers\n")
+	tw := debugTable(buf)
+
+	actionTypes := make([]string, 0, len(registrations.ByType))
+	for actionType := range registrations.ByType {
+		actionTypes = append(actionTypes, string(actionType))
+	}
+	sort.Strings(actionTypes)
+	for _, actionType := range actionTypes {
+		fmt.Fprintf(tw, "%s\t%s\n", actionType, strings.Join(registrations.ByType[actions.ActionType(actionType)], ", "))
+	}
+
+	names := make([]string, 0, len(registrations.Named))
+	for name := range registrations.Named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(tw, "named %s\t%s\n", name, registrations.Named[name])
+	}
+	fmt.Fprintf(tw, "observers\t%s\n", strings.Join(registrations.Observers, ", "))
+
+	if routing := e.GetRoutingConfig(); routing != nil {
+		fmt.Fprintf(tw, "routing\t%d routes, fallback %s\n", len(routing.Routes), debugOr(strings.Join(routing.Fallback, ", "), "-"))
+	} else {
+		fmt.Fprintf(tw, "routing\toff, actions go to every handler of their type\n")
+	}
+	if storm := e.GetStormStatus(); storm != nil {
+		fmt.Fprintf(tw, "storm detection\tactive %t, %d alerts pending\n", storm.Active, storm.Pending)
+	} else {
+		fmt.Fprintf(tw, "storm detection\toff\n")
+	}
+	for _, quota := range e.GetActionQuotas() {
+		fmt.Fprintf(tw, "quota %s\t%d of %d per %s, %d dropped\n", quota.Name, quota.Used, quota.Limit, quota.Window, quota.Dropped)
+	}
+	tw.Flush()
+}
+
+func (e *Engine) writeDebugErrors(buf *bytes.Buffer) {
+	recent := e.GetRecentErrors()
+	fmt.Fprintf(buf, "\nrecent errors (%d)\n", len(recent))
+	tw := debugTable(buf)
+	for _, ruleErr := range recent {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", debugTime(ruleErr.Time), ruleErr.Rule, ruleErr.Kind, debugLine(ruleErr.Err.Error()))
+	}
+	tw.Flush()
+}
+
+// debugTable returns a writer aligning the tab-separated columns of a
+// section, indented under its heading
+func debugTable(buf *bytes.Buffer) *tabwriter.Writer {
+	return tabwriter.NewWriter(&debugIndent{buf: buf}, 0, 0, 2, ' ', 0)
+}
+
+// debugIndent indents every line written through it
+type debugIndent struct {
+	buf     *bytes.Buffer
+	midLine bool
+}
+
+func (d *debugIndent) Write(p []byte) (int, error) {
+	for _, c := range p {
+		if !d.midLine {
+			d.buf.WriteString("  ")
+		}
+		d.buf.WriteByte(c)
+		d.midLine = c != '\n'
+	}
+	return len(p), nil
+}
+
+// debugTime formats a time for the dump, "-" if it is zero
+func debugTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// debugLine keeps a message on one line of the dump
+func debugLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func debugOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
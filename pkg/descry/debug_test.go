@@ -0,0 +1,59 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.AddRule("broken", `when heap.alloc / 0 > 1 { log("never") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	if err := engine.AddRule("healthy", `when heap.alloc > 0 { alert("always") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	pool := &poolProvider{name: "db", inUse: 4}
+	if err := engine.RegisterMetricProvider(pool); err != nil {
+		t.Fatalf("failed to register provider: %v", err)
+	}
+	pool.inUse = -1 // The next collection panics
+	engine.EvaluateRules()
+
+	recorder := httptest.NewRecorder()
+	engine.DebugHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/debug/descry", nil))
+	if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("expected a text dump, got %d %s", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	dump := recorder.Body.String()
+	for _, want := range []string{
+		"rules (2)",
+		"max rules            100",
+		"runtime",
+		"provider db",
+		"last collection failed: panic: pool closed",
+		"alert",
+		"named console",
+		"recent errors (1)",
+		"broken  evaluation",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("expected %q in the dump:\n%s", want, dump)
+		}
+	}
+	for _, line := range strings.Split(dump, "\n") {
+		if strings.HasPrefix(line, "  healthy ") && !strings.Contains(line, "enabled") {
+			t.Errorf("expected the healthy rule's statistics, got %q", line)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	engine.DebugHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/debug/descry", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected POST to be rejected, got %d", recorder.Code)
+	}
+}
@@ -16,7 +16,7 @@
 //
 //	func main() {
 //		engine := descry.NewEngine()
-//		engine.Start()
+//		engine.Start(context.Background())
 //		defer engine.Stop()
 //
 //		// Add a memory monitoring rule
@@ -53,18 +53,35 @@
 //	when <condition> { <action> }
 //
 // Available metrics:
-//   - Runtime: heap.alloc, heap.sys, goroutines.count, gc.pause, gc.cpu_fraction
+//   - Runtime: heap.alloc, heap.sys, goroutines.count, goroutines.leak_suspects, gc.pause, gc.cpu_fraction,
+//     gc.pause_p99, gc.heap_goal, sched.latency_p99
 //   - HTTP: http.response_time, http.request_rate, http.error_rate, http.pending_requests
-//   - Custom: Any metrics you define with engine.UpdateCustomMetric()
+//   - Alerts: alerts.active_count, alerts.critical_count
+//   - Leak detection: leak.score, leak.heap_growth, leak.objects_growth, leak.gc_stability
+//   - Custom: Any metrics you define with engine.UpdateCustomMetric(), and labeled
+//     series selected as custom.queue_depth{queue="email"}
 //
 // Available functions:
 //   - alert(message): Trigger an alert with the given message
 //   - log(message): Write a log entry  
+//   - set_metric(name, value): Write a derived custom.* metric
+//   - suppress_alerts(): Suppress active alerts raised by other rules
+//   - capture_profile(type): Capture a pprof profile such as "heap" or "goroutine"
 //   - avg(metric, duration): Calculate average over time period
 //   - max(metric, duration): Find maximum over time period
 //   - trend(metric, duration): Calculate trend direction (+1, 0, -1)
+//   - anomaly(metric, duration): Deviation of the latest value from its baseline
+//   - changepoint(metric, duration): Size of the largest shift in a metric's level
+//   - deviates(metric, percent, window, baseline): Whether a metric strayed from its learned baseline
+//   - route(path, statistic): p50/p95/p99, error rate and more for one HTTP route
+//   - canary(metric, canary, baseline): Percentage difference between two labeled series
+//   - stale(metric, window): Whether a custom metric went without an update for the window
+//   - event(type): Whether an event such as a deploy occurred recently
+//   - goroutine_leak(window): Number of goroutine creation sites that grew steadily over the window
+//   - format(value, kind): A number as text, as a byte size, duration or percentage
 //
 // Time units: ms, s, m (milliseconds, seconds, minutes)
+// Percentages: % (e.g. http.error_rate > 2%)
 // Memory units: MB, GB (megabytes, gigabytes)
 //
 // # Dashboard Features
@@ -74,9 +91,13 @@
 //   1. Live Monitoring: Real-time charts and system health overview
 //   2. Time Travel: Historical playback with configurable speed control  
 //   3. Rule Editor: Interactive rule creation with syntax validation
-//   4. Alert Manager: Full alert lifecycle with collaboration features
+//   4. Alert Manager: Full alert lifecycle with collaboration features, plus a
+//      banner and optional chime for active critical alerts
 //   5. Metric Correlation: Statistical analysis and anomaly detection
 //
+// Appending ?kiosk=1 to the dashboard URL gives a read-only wallboard that
+// rotates between health, live charts and top alerts, for NOC displays.
+//
 // # Production Considerations
 //
 // Descry is designed for production use with built-in safety features:
@@ -0,0 +1,150 @@
+package descry
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+// encryptedHeader starts every document encrypted at rest, followed by the
+// nonce and the AES-256-GCM ciphertext. It is also authenticated as
+// additional data, so a document cannot be passed off as another format.
+var encryptedHeader = []byte("descry/aes-256-gcm/v1\n")
+
+// encryptedSuffix is appended to the keys of encrypted snapshot files
+const encryptedSuffix = ".enc"
+
+// EncryptionConfig configures encryption at rest for the state the engine
+// writes out: the documents returned by Snapshot and the files uploaded by
+// periodic snapshots. Documents are encrypted with AES-256-GCM.
+type EncryptionConfig struct {
+	// Secrets provides the encryption key
+	Secrets actions.SecretsProvider
+	// KeyName names the secret holding the key: 32 bytes, encoded as
+	// base64 or hex, or given as is
+	KeyName string
+	// PreviousKeyNames name keys that were rotated out. They are only tried
+	// when decrypting, so state written before a rotation can still be read.
+	PreviousKeyNames []string
+}
+
+// SetStorageEncryption encrypts the state the engine writes from now on, or
+// stops encrypting it when config is nil. The key is fetched from the secrets
+// provider every time it is used, so rotating the secret takes effect without
+// reconfiguring the engine; an error is returned if it cannot be fetched now.
+func (e *Engine) SetStorageEncryption(config *EncryptionConfig) error {
+	var cfg *EncryptionConfig
+	if config != nil {
+		if config.Secrets == nil {
+			return fmt.Errorf("secrets provider is required for storage encryption")
+		}
+		if config.KeyName == "" {
+			return fmt.Errorf("encryption key name is required")
+		}
+		copied := *config
+		copied.PreviousKeyNames = append([]string(nil), config.PreviousKeyNames...)
+		if _, err := copied.key(copied.KeyName); err != nil {
+			return err
+		}
+		cfg = &copied
+	}
+
+	e.mutex.Lock()
+	e.encryption = cfg
+	e.mutex.Unlock()
+	return nil
+}
+
+// storageEncryption returns the encryption configuration, nil if state is
+// written in the clear
+func (e *Engine) storageEncryption() *EncryptionConfig {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.encryption
+}
+
+// key fetches and decodes the named key
+func (c *EncryptionConfig) key(name string) ([]byte, error) {
+	secret, err := c.Secrets.GetSecret(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch encryption key %s: %w", name, err)
+	}
+	trimmed := strings.TrimSpace(secret)
+	if key, err := hex.DecodeString(trimmed); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(trimmed); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if len(secret) == 32 {
+		return []byte(secret), nil
+	}
+	return nil, fmt.Errorf("encryption key %s must be 32 bytes, encoded as base64 or hex", name)
+}
+
+// Encrypt encrypts data with the current key
+func (c *EncryptionConfig) Encrypt(data []byte) ([]byte, error) {
+	key, err := c.key(c.KeyName)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	out := make([]byte, 0, len(encryptedHeader)+len(nonce)+len(data)+aead.Overhead())
+	out = append(out, encryptedHeader...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, encryptedHeader), nil
+}
+
+// Decrypt decrypts data written by Encrypt, trying the current key and then
+// each previous key
+func (c *EncryptionConfig) Decrypt(data []byte) ([]byte, error) {
+	if !isEncrypted(data) {
+		return nil, fmt.Errorf("data is not encrypted")
+	}
+	sealed := data[len(encryptedHeader):]
+	for _, name := range append([]string{c.KeyName}, c.PreviousKeyNames...) {
+		key, err := c.key(name)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(sealed) < aead.NonceSize() {
+			return nil, fmt.Errorf("encrypted data is truncated")
+		}
+		nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+		if plain, err := aead.Open(nil, nonce, ciphertext, encryptedHeader); err == nil {
+			return plain, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to decrypt: wrong key or corrupted data")
+}
+
+// isEncrypted reports whether data was written by EncryptionConfig.Encrypt
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedHeader)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -7,7 +7,7 @@
 // Create a new engine and add monitoring rules:
 //
 //	engine := descry.NewEngine()
-//	engine.Start()
+//	engine.Start(context.Background())
 //
 //	// Add a rule to monitor memory usage
 //	err := engine.AddRule("memory_check", `
@@ -27,6 +27,24 @@
 // Access the web dashboard at http://localhost:9090 for real-time monitoring,
 // time-travel debugging, rule management, and metric correlation analysis.
 //
+// # Configuration
+//
+// NewEngineWithConfig sets the dashboard address, disables the dashboard,
+// tunes collection and evaluation intervals and history sizes, and injects a
+// logger for the engine's output:
+//
+//	engine := descry.NewEngineWithConfig(descry.EngineConfig{
+//		DashboardHost:      "127.0.0.1",
+//		DashboardPort:      8080,
+//		EvaluationInterval: 5 * time.Second,
+//	})
+//
+// Diagnostics such as rule triggers, evaluation errors and resource limit
+// violations are logged with log/slog, with the rule and its resource usage as
+// attributes. SetLogger sends them to a structured logging pipeline:
+//
+//	engine.SetLogger(slog.New(slog.NewJSONHandler(os.Stderr, nil)))
+//
 // # Resource Management
 //
 // Descry includes built-in resource limits and sandboxing to ensure safe
@@ -41,7 +59,9 @@
 // Available metrics: heap.alloc, heap.sys, goroutines.count, gc.pause,
 // http.response_time, http.request_rate, and custom metrics.
 //
-// Available functions: alert(), log(), avg(), max(), trend().
+// Available functions: alert(), log(), set_metric(), suppress_alerts(),
+// capture_profile(), avg(), max(), trend(), anomaly(), changepoint(),
+// deviates(), route(), canary(), stale(), event(), goroutine_leak(), format().
 //
 // See the project documentation for complete DSL syntax and examples.
 package descry
@@ -49,16 +69,27 @@ package descry
 import (
 	"context"
 	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log"
+	"log/slog"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/chosenoffset/descry/pkg/descry/actions"
+	"github.com/chosenoffset/descry/pkg/descry/clock"
 	"github.com/chosenoffset/descry/pkg/descry/dashboard"
 	"github.com/chosenoffset/descry/pkg/descry/metrics"
 	"github.com/chosenoffset/descry/pkg/descry/parser"
+	"github.com/chosenoffset/descry/pkg/descry/units"
 )
 
 // Engine is the main Descry monitoring engine that manages rule execution,
@@ -69,6 +100,10 @@ type Engine struct {
 	httpMetrics      *metrics.HTTPMetrics
 	rules            []*Rule
 	evaluator        *Evaluator
+	// Evaluators for workers after the first, created as needed;
+	// evaluationMutex runs one evaluation cycle at a time
+	workerEvaluators []*Evaluator
+	evaluationMutex  sync.Mutex
 	actionRegistry   *actions.ActionRegistry
 	dashboard        *dashboard.Server
 	dashboardRunning bool
@@ -76,20 +111,195 @@ type Engine struct {
 	dashboardStartTime time.Time
 	lastMetricsSent  time.Time
 	running          bool
+	startTime        time.Time
 	stopCh           chan struct{}
+	dryRun           bool
 	mutex            sync.RWMutex
 	
+	// lifecycle serializes Start and Stop; background tracks the goroutines
+	// Stop waits for
+	lifecycle        sync.Mutex
+	background       sync.WaitGroup
+	
 	// Resource limits
 	limits           *ResourceLimits
 	
 	// Sandboxing
-	customMetrics    map[string]float64
-	metricsMutex     sync.RWMutex
+	customMetrics    *customMetricStore
+	// Series reported with UpdateLabeledMetric, compared by canary()
+	labeledMetrics   *customMetricStore
+	maxCustomHistory int // samples kept per custom and provider metric, guarded by providerMutex
+	typedMetrics     typedMetricRegistry
+	
+	// Scores heap growth for the leak.* metrics
+	leak             *leakDetector
+	// Profiles goroutines for goroutines.leak_suspects
+	goroutineLeaks   goroutineLeakDetector
+	
+	// Registered metric providers, keyed by namespace
+	providers        map[string]*metricProviderState
+	providerMutex    sync.RWMutex
+	
+	// Metrics of the middleware created with HTTPMiddlewareNamed, keyed by name
+	httpServers      map[string]*metrics.HTTPMetrics
+	httpServersMutex sync.Mutex
 	
 	// Event history storage
 	eventHistory     []EventRecord
+	eventIndex       *eventIndex
 	eventMutex       sync.RWMutex
 	maxEventHistory  int
+	
+	// Per-rule condition health
+	availability     *availabilityTracker
+	ruleStates       *ruleStateTracker
+	ruleStats        *ruleStatsTracker
+	// When each rule was last evaluated, for rules with an interval
+	schedule         *ruleSchedule
+	
+	// Profiles captured by capture_profile()
+	profiles         *profileStore
+	
+	// Periodic report snapshots
+	snapshots        *SnapshotConfig
+	snapshotStop     chan struct{}
+	
+	// Encryption at rest for snapshots and saved state
+	encryption       *EncryptionConfig
+	
+	// Periodic state flushes and the panic hook
+	stateFlush       *StateFlushConfig
+	stateFlushStop   chan struct{}
+	flushMutex       sync.Mutex
+	panicHook        atomic.Pointer[PanicHook]
+	
+	// Watched rules directory
+	rulesWatch       *rulesWatcher
+	rulesWatchStop   chan struct{}
+	
+	// Route SLAs and the names of the rules generated from them
+	sla              *SLAConfig
+	slaRules         map[string]bool
+	
+	// Rule group defaults, replaced rather than modified
+	groups           map[string]RuleGroup
+	
+	// Construction options
+	config           EngineConfig
+	clock            clock.Clock
+	logger           atomic.Pointer[slog.Logger]
+	
+	// Redaction applied to events and metric names leaving the engine
+	redaction        atomic.Pointer[redactor]
+	
+	// Callbacks registered with OnError, and the latest failures reported
+	errorHandlers    []func(RuleError)
+	recentErrors     []RuleError
+	errorMutex       sync.RWMutex
+}
+
+// EngineConfig controls how NewEngineWithConfig builds an engine. Zero values
+// select the defaults returned by DefaultEngineConfig.
+type EngineConfig struct {
+	// DashboardPort is the port the dashboard listens on (default 9090)
+	DashboardPort int
+	// DashboardHost is the interface the dashboard binds to; empty binds all
+	DashboardHost string
+	// DisableDashboard prevents Start from launching the dashboard server.
+	// Alert state and the other dashboard-backed APIs keep working.
+	DisableDashboard bool
+	// CollectionInterval is how often runtime metrics are sampled (default 100ms)
+	CollectionInterval time.Duration
+	// MetricHistorySize is the number of runtime samples, and samples per custom
+	// metric, kept for avg(), max(), trend() and anomaly() (default 1000)
+	MetricHistorySize int
+	// EventHistorySize is the number of events kept for GetEventHistory (default 1000)
+	EventHistorySize int
+	// HTTPSampleSize is the number of response times kept for HTTP statistics
+	// (default 1000)
+	HTTPSampleSize int
+	// HTTPExclusions lists requests HTTPMiddleware passes through without
+	// recording, such as health checks; see SetHTTPExclusions
+	HTTPExclusions []metrics.HTTPExclusion
+	// RouteLabeler groups requests into per-route statistics; see
+	// SetRouteLabeler (default metrics.DefaultRouteLabeler)
+	RouteLabeler metrics.RouteLabeler
+	// EvaluationInterval is how often rules are evaluated (default 1s)
+	EvaluationInterval time.Duration
+	// EvaluationWorkers is the number of rules evaluated at once (default 1).
+	// With more than one worker, actions of different rules can run
+	// concurrently and in any order within a cycle.
+	EvaluationWorkers int
+	// RulesDir is the directory import statements are resolved against. When
+	// empty, AddRuleFile uses the loaded file's directory and AddRules the
+	// working directory.
+	RulesDir string
+	// DryRun evaluates every rule without running its actions; see SetDryRun
+	DryRun bool
+	// Logger is the writer for log() and alert() actions only. When nil they
+	// use the standard logger.
+	Logger *log.Logger
+	// DiagnosticLogger receives the engine's diagnostics: rule triggers,
+	// evaluation errors, resource limit violations, rule reloads and
+	// dashboard status. When nil they go to slog.Default(); see SetLogger.
+	DiagnosticLogger *slog.Logger
+	// Clock is the time source for rule evaluation, metric collection and
+	// history windows. When nil the system clock is used; tests can pass a
+	// clock.Fake to advance time deterministically.
+	Clock clock.Clock
+	// ValueFormat controls how numbers in alert and log messages, format()
+	// and the dashboard are shown: binary or SI byte units, decimal places
+	// and locale separators. The zero value uses binary units, two decimal
+	// places and English separators.
+	ValueFormat units.Format
+	// DashboardHistory sets how long the dashboard keeps metric history at
+	// full resolution and as 10 second and 1 minute rollups, for time travel,
+	// correlation and queries. Zero fields use dashboard.DefaultHistoryRetention.
+	DashboardHistory dashboard.HistoryRetention
+}
+
+// DefaultEngineConfig returns the configuration used by NewEngine
+func DefaultEngineConfig() EngineConfig {
+	return EngineConfig{
+		DashboardPort:      9090,
+		CollectionInterval: 100 * time.Millisecond,
+		MetricHistorySize:  1000,
+		EventHistorySize:   1000,
+		HTTPSampleSize:     1000,
+		EvaluationInterval: 1 * time.Second,
+		EvaluationWorkers:  1,
+		Clock:              clock.Real,
+	}
+}
+
+// withDefaults fills zero fields from DefaultEngineConfig
+func (c EngineConfig) withDefaults() EngineConfig {
+	defaults := DefaultEngineConfig()
+	if c.DashboardPort <= 0 {
+		c.DashboardPort = defaults.DashboardPort
+	}
+	if c.CollectionInterval <= 0 {
+		c.CollectionInterval = defaults.CollectionInterval
+	}
+	if c.MetricHistorySize <= 0 {
+		c.MetricHistorySize = defaults.MetricHistorySize
+	}
+	if c.EventHistorySize <= 0 {
+		c.EventHistorySize = defaults.EventHistorySize
+	}
+	if c.HTTPSampleSize <= 0 {
+		c.HTTPSampleSize = defaults.HTTPSampleSize
+	}
+	if c.EvaluationInterval <= 0 {
+		c.EvaluationInterval = defaults.EvaluationInterval
+	}
+	if c.EvaluationWorkers <= 0 {
+		c.EvaluationWorkers = defaults.EvaluationWorkers
+	}
+	if c.Clock == nil {
+		c.Clock = clock.Real
+	}
+	return c
 }
 
 // EventRecord represents a historical event from rule triggers or actions
@@ -100,6 +310,15 @@ type EventRecord struct {
 	Message   string                 `json:"message"`
 	Timestamp time.Time              `json:"timestamp"`
 	Data      map[string]interface{} `json:"data,omitempty"`
+	// Labels are the labels of the rule that produced the event
+	Labels    map[string]string      `json:"labels,omitempty"`
+}
+
+// customMetricSample is a timestamped custom metric value, retained so that
+// avg(), max(), trend() and anomaly() can operate on custom metrics
+type customMetricSample struct {
+	Value     float64
+	Timestamp time.Time
 }
 
 // Rule represents a compiled monitoring rule with its parsed AST
@@ -113,6 +332,41 @@ type Rule struct {
 	AST         *parser.Program
 	// LastTrigger tracks when this rule last matched its condition
 	LastTrigger time.Time
+	// Description, Severity and Tags come from the metadata of a named rule
+	// block. Severity is the default for alerts the rule raises.
+	Description string
+	Severity    string
+	Tags        []string
+	// Labels are key/value pairs, such as team=payments, attached to every
+	// event, alert and metric action the rule produces. They come from the
+	// labels metadata of a named rule block and RuleOptions.
+	Labels      map[string]string
+	// Disabled rules stay loaded but are skipped during evaluation
+	Disabled    bool
+	// DryRun rules are evaluated but their actions do not run; a met
+	// condition is reported as a "rule_dry_run" event instead
+	DryRun      bool
+	// File is the rule file the rule was loaded from, if any
+	File        string
+	// Interval is how often the rule is evaluated, from the every entry of a
+	// named rule block. Zero evaluates it every EvaluationInterval; shorter
+	// intervals are rounded up to it.
+	Interval    time.Duration
+	// Group is the rule group the rule joined with group metadata; see
+	// SetRuleGroup
+	Group       string
+	// Cooldown is how long the rule rests after triggering before it is
+	// evaluated again, from the cooldown entry of a named rule block. Zero
+	// uses the group's cooldown, if any.
+	Cooldown    time.Duration
+	// definitions is the source of the top-level constants and bindings,
+	// including imported ones, shared by a rule split out of a larger source
+	definitions string
+}
+
+// Enabled reports whether the rule is evaluated
+func (r *Rule) Enabled() bool {
+	return !r.Disabled
 }
 
 // ResourceLimits defines limits for resource usage
@@ -122,7 +376,7 @@ type ResourceLimits struct {
 	MaxMemoryUsage        uint64        // Maximum memory usage in bytes
 	MaxCPUTime            time.Duration // Maximum CPU time per evaluation
 	MaxEvaluationTime     time.Duration // Maximum wall-clock time per evaluation
-	MaxMetricHistorySize  int           // Maximum number of metric history entries
+	MaxMetricHistorySize  int           // Maximum number of samples kept per custom or provider metric
 	MaxCustomMetrics      int           // Maximum number of custom metrics
 }
 
@@ -156,7 +410,7 @@ func getAvailablePort() int {
 //
 // The engine is not started by default - call Start() to begin monitoring.
 func NewEngine() *Engine {
-	return NewEngineWithPort(9090)
+	return NewEngineWithConfig(DefaultEngineConfig())
 }
 
 // NewEngineWithPort creates a new Descry monitoring engine with custom dashboard port.
@@ -164,49 +418,128 @@ func NewEngine() *Engine {
 //
 // Example:
 //     engine := descry.NewEngineWithPort(8080)
-//     engine.Start()
+//     engine.Start(context.Background())
 func NewEngineWithPort(dashboardPort int) *Engine {
+	config := DefaultEngineConfig()
+	config.DashboardPort = dashboardPort
+	return NewEngineWithConfig(config)
+}
+
+// NewEngineWithConfig creates a new Descry monitoring engine from config.
+// Fields left at their zero value use the defaults from DefaultEngineConfig.
+//
+// Example:
+//     engine := descry.NewEngineWithConfig(descry.EngineConfig{
+//         DisableDashboard:   true,
+//         EvaluationInterval: 5 * time.Second,
+//         Logger:             log.New(os.Stderr, "descry ", log.LstdFlags),
+//     })
+func NewEngineWithConfig(config EngineConfig) *Engine {
+	config = config.withDefaults()
 	engine := &Engine{
-		runtimeCollector: metrics.NewRuntimeCollector(1000, 100*time.Millisecond),
-		httpMetrics:      metrics.NewHTTPMetrics(1000),
+		runtimeCollector: metrics.NewRuntimeCollector(config.MetricHistorySize, config.CollectionInterval),
+		httpMetrics:      metrics.NewHTTPMetrics(config.HTTPSampleSize),
 		rules:            make([]*Rule, 0),
 		actionRegistry:   actions.NewActionRegistry(),
-		dashboard:        dashboard.NewServer(dashboardPort),
+		dashboard:        dashboard.NewServer(config.DashboardPort),
 		stopCh:           make(chan struct{}),
 		limits:           DefaultResourceLimits(),
-		customMetrics:    make(map[string]float64),
+		customMetrics:    newCustomMetricStore(customHistorySize(config, DefaultResourceLimits())),
+		labeledMetrics:   newCustomMetricStore(customHistorySize(config, DefaultResourceLimits())),
+		maxCustomHistory: customHistorySize(config, DefaultResourceLimits()),
+		providers:        make(map[string]*metricProviderState),
+		leak:             newLeakDetector(config.MetricHistorySize),
 		eventHistory:     make([]EventRecord, 0),
-		maxEventHistory:  1000, // Store up to 1000 events
+		eventIndex:       newEventIndex(config.EventHistorySize),
+		maxEventHistory:  config.EventHistorySize,
+		availability:     newAvailabilityTracker(),
+		ruleStates:       newRuleStateTracker(),
+		ruleStats:        newRuleStatsTracker(),
+		schedule:         newRuleSchedule(),
+		profiles:         newProfileStore(),
+		config:           config,
+		clock:            config.Clock,
+		dryRun:           config.DryRun,
+	}
+	engine.logger.Store(config.DiagnosticLogger)
+	if config.DashboardHost != "" {
+		engine.dashboard.SetHost(config.DashboardHost)
 	}
+	engine.dashboard.SetValueFormat(config.ValueFormat)
+	engine.dashboard.SetHistoryRetention(config.DashboardHistory)
+	engine.httpMetrics.SetExclusions(config.HTTPExclusions)
+	engine.httpMetrics.SetRouteLabeler(config.RouteLabeler)
+	engine.runtimeCollector.SetClock(config.Clock)
+	engine.httpMetrics.SetClock(config.Clock)
 	
 	// Enable runtime memory limit enforcement
 	EnableMemoryLimitEnforcement(engine.limits.MaxMemoryUsage)
 	
 	engine.evaluator = NewEvaluator(engine)
 	
-	// Register default action handlers
-	engine.actionRegistry.RegisterHandler(actions.AlertAction, &actions.ConsoleAlertHandler{})
-	engine.actionRegistry.RegisterHandler(actions.LogAction, actions.NewLogHandler(nil))
+	// Register default action handlers. They are also registered by name so
+	// routing configurations can reference them.
+	consoleHandler := &actions.ConsoleAlertHandler{Logger: config.Logger}
+	logHandler := actions.NewLogHandler(config.Logger)
+	engine.actionRegistry.RegisterHandler(actions.AlertAction, consoleHandler)
+	engine.actionRegistry.RegisterHandler(actions.LogAction, logHandler)
+	engine.actionRegistry.RegisterNamedHandler("console", consoleHandler)
+	engine.actionRegistry.RegisterNamedHandler("log", logHandler)
 	
-	// Register dashboard handlers
-	dashboardHandler := actions.NewDashboardHandler(engine.dashboard.SendEventUpdate)
+	// Event history and the dashboard observe every action regardless of routing
+	engine.actionRegistry.RegisterObserver(&eventRecordingHandler{engine: engine})
+	engine.actionRegistry.RegisterObserver(actions.NewDashboardHandler(engine.sendEventUpdate))
+	engine.actionRegistry.RegisterObserver(&stormCollapseHandler{engine: engine})
 	
-	// Create event recording wrappers for actions
-	alertWrapper := &eventRecordingHandler{
-		engine: engine,
-		actionType: "alert",
-		wrapped: &actions.ConsoleAlertHandler{},
-	}
-	logWrapper := &eventRecordingHandler{
-		engine: engine,
-		actionType: "log",
-		wrapped: actions.NewLogHandler(nil),
-	}
+	// Expose routing configuration through the dashboard API
+	engine.dashboard.SetRoutingProvider(
+		func() interface{} { return engine.GetRoutingConfig() },
+		func(data []byte) error {
+			config, err := actions.ParseRoutingConfig(data)
+			if err != nil {
+				return err
+			}
+			return engine.SetRoutingConfig(config)
+		},
+	)
 	
-	engine.actionRegistry.RegisterHandler(actions.AlertAction, alertWrapper)
-	engine.actionRegistry.RegisterHandler(actions.AlertAction, dashboardHandler)
-	engine.actionRegistry.RegisterHandler(actions.LogAction, logWrapper)
-	engine.actionRegistry.RegisterHandler(actions.LogAction, dashboardHandler)
+	engine.dashboard.SetAvailabilityProvider(func() interface{} {
+		return engine.GetAvailability()
+	})
+	engine.dashboard.SetRuleStateProvider(func(since time.Time) interface{} {
+		return engine.GetRuleStateHistory(since)
+	}, engine.ruleStates.current)
+	engine.dashboard.SetRuleStatsProvider(func() interface{} {
+		return engine.GetRuleStats()
+	})
+	engine.dashboard.SetHTTPBreakdownProvider(func() interface{} {
+		return engine.GetHTTPBreakdown()
+	})
+	engine.actionRegistry.OnQuotaExceeded(engine.reportQuotaOverflow)
+	engine.dashboard.SetActionQuotaProvider(func() interface{} {
+		return engine.GetActionQuotas()
+	})
+	engine.dashboard.SetProfileProvider(func() interface{} {
+		return engine.GetProfiles()
+	}, func(id string) ([]byte, string, bool) {
+		profile, data, ok := engine.GetProfile(id)
+		return data, profile.Filename(), ok
+	})
+	engine.dashboard.SetSimulator(func(ctx context.Context, request json.RawMessage) (interface{}, error) {
+		var sim Simulation
+		if err := json.Unmarshal(request, &sim); err != nil {
+			return nil, fmt.Errorf("invalid simulation: %w", err)
+		}
+		return engine.Simulate(ctx, sim)
+	})
+	engine.dashboard.SetCaptureProvider(engine.SnapshotMetrics)
+	engine.dashboard.SetRuleMetricsProvider(func(name string) []string {
+		rule, ok := engine.GetRule(name)
+		if !ok {
+			return nil
+		}
+		return ruleMetricPaths(rule.AST)
+	})
 	
 	// Set rules provider for dashboard
 	engine.dashboard.SetRulesProvider(func() interface{} {
@@ -217,11 +550,39 @@ func NewEngineWithPort(dashboardPort int) *Engine {
 				"name":         rule.Name,
 				"source":       rule.Source,
 				"last_trigger": rule.LastTrigger,
+				"description":  rule.Description,
+				"severity":     engine.ruleSeverity(rule.Name),
+				"tags":         rule.Tags,
+				"labels":       rule.Labels,
+				"enabled":      rule.Enabled(),
+				"dry_run":      rule.DryRun || engine.IsDryRun(),
+				"interval":     rule.Interval.Seconds(),
+				"group":        rule.Group,
+				"cooldown":     rule.Cooldown.Seconds(),
 			}
 		}
 		return ruleData
 	})
 	
+	// Let the dashboard rule editor add, replace and remove rules
+	engine.dashboard.SetRuleManager(engine.saveRule, engine.RemoveRule, engine.SetRuleEnabled)
+	engine.dashboard.SetRuleGroupManager(func() interface{} {
+		return engine.GetRuleGroups()
+	}, engine.SetRuleGroupEnabled)
+	engine.dashboard.SetRuleBundleManager(func(w io.Writer, format string) error {
+		bundle := engine.ExportRuleBundle()
+		if format == "tar" {
+			return bundle.WriteTar(w)
+		}
+		return bundle.WriteJSON(w)
+	}, func(r io.Reader, dryRun, replace bool) (interface{}, error) {
+		bundle, err := ReadRuleBundle(r)
+		if err != nil {
+			return nil, err
+		}
+		return engine.ImportRuleBundle(bundle, RuleBundleImportOptions{DryRun: dryRun, Replace: replace})
+	})
+	
 	return engine
 }
 
@@ -230,8 +591,18 @@ func NewEngineWithPort(dashboardPort int) *Engine {
 // - Launching the web dashboard server
 // - Beginning the rule evaluation loop
 //
-// Start is idempotent - calling it multiple times has no effect.
-func (e *Engine) Start() {
+// The engine stops, as if by Stop, when ctx is cancelled, which suits
+// contexts from signal.NotifyContext:
+//
+//	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+//	defer cancel()
+//	engine.Start(ctx)
+//
+// Start is idempotent - calling it multiple times has no effect. An engine
+// that has been stopped may be started again.
+func (e *Engine) Start(ctx context.Context) {
+	e.lifecycle.Lock()
+	defer e.lifecycle.Unlock()
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 
@@ -240,32 +611,101 @@ func (e *Engine) Start() {
 	}
 
 	e.running = true
+	e.startTime = e.clock.Now()
 	e.runtimeCollector.Start()
 	
-	// Start dashboard with enhanced error handling
-	go e.startDashboard()
+	// Start dashboard with enhanced error handling. Reopen first so a
+	// restarted engine gets a working dashboard back.
+	if !e.config.DisableDashboard {
+		e.dashboard.Reopen()
+		e.goBackground(e.startDashboard)
+	}
 	
 	// Start rule evaluation loop
-	go e.evaluationLoop()
+	stopCh := e.stopCh
+	e.goBackground(func() { e.evaluationLoop(stopCh) })
+	
+	if e.snapshots != nil {
+		e.startSnapshotsLocked()
+	}
+	if e.rulesWatch != nil {
+		e.startRulesWatchLocked()
+	}
+	if e.stateFlush != nil {
+		e.startStateFlushLocked()
+	}
+	
+	// Not tracked by background, since Stop waits for that
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				e.Stop()
+			case <-stopCh:
+			}
+		}()
+	}
 }
 
 // Stop halts the monitoring engine's operation and cleanly shuts down
 // all background processes including metric collection and the dashboard server.
+// It returns once the collector, evaluation loop, dashboard, snapshot and rules
+// watch goroutines have exited, and flushes the state file if SetStateFlush
+// is configured. In-flight rule evaluations finish first. MaxEvaluationTime
+// only stops an evaluation at its next step, so an action handler that
+// blocks can delay Stop until it returns.
 //
 // Stop is idempotent - calling it multiple times has no effect.
 func (e *Engine) Stop() {
+	e.lifecycle.Lock()
+	defer e.lifecycle.Unlock()
 	e.mutex.Lock()
-	defer e.mutex.Unlock()
 
 	if !e.running {
+		e.mutex.Unlock()
 		return
 	}
 
 	e.running = false
 	close(e.stopCh)
 	e.stopCh = make(chan struct{}) // Recreate channel for potential restart
+	if e.snapshotStop != nil {
+		close(e.snapshotStop)
+		e.snapshotStop = nil
+	}
+	if e.rulesWatchStop != nil {
+		close(e.rulesWatchStop)
+		e.rulesWatchStop = nil
+	}
+	if e.stateFlushStop != nil {
+		close(e.stateFlushStop)
+		e.stateFlushStop = nil
+	}
+	stateFlush := e.stateFlush
+	
+	// The background goroutines take e.mutex, so wait without holding it
+	e.mutex.Unlock()
 	e.runtimeCollector.Stop()
 	e.dashboard.Stop()
+	e.background.Wait()
+	
+	if stateFlush != nil {
+		if err := e.writeStateFile(stateFlush.Path); err != nil {
+			e.log().Error("State flush failed", slog.String("component", "state"), slog.Any("error", err))
+		}
+	}
+}
+
+// goBackground runs fn in a goroutine that Stop waits for, flushing state
+// before a panic in it crashes the process. Callers hold e.mutex with the
+// engine running.
+func (e *Engine) goBackground(fn func()) {
+	e.background.Add(1)
+	go func() {
+		defer e.background.Done()
+		defer e.crashGuard()
+		fn()
+	}()
 }
 
 // AddRule parses and adds a new monitoring rule to the engine.
@@ -275,41 +715,449 @@ func (e *Engine) Stop() {
 //   - name: Unique identifier for the rule
 //   - source: DSL rule text (e.g., "when heap.alloc > 200MB { alert(\"High memory\") }")
 //
+// If source contains named rule blocks, each block is added as its own rule;
+// see AddRules.
+//
 // Returns an error if:
-//   - The rule has syntax errors
-//   - The rule name already exists
-//   - Resource limits are exceeded (max rules, complexity)
+//   - The rule has syntax errors (a parser.ParseErrors holding ParseError values)
+//   - The rule name already exists (ErrRuleExists)
+//   - Resource limits are exceeded (a LimitError for max rules or complexity)
 func (e *Engine) AddRule(name, source string) error {
+	_, err := e.AddRules(name, source)
+	return err
+}
+
+// AddRules parses source that may define several named rule blocks, such as
+// a .dscr file, and adds each block as a separate rule. Statements outside
+// any block form a rule called defaultName, and top-level let bindings and
+// constants are shared by every rule in the source. Either all rules are
+// added or, on error, none are. It returns the names of the rules added.
+func (e *Engine) AddRules(defaultName, source string) ([]string, error) {
+	return e.addRules(defaultName, source, "")
+}
+
+// addRules compiles and adds source. path is the file source was read from,
+// if any, and determines where imports are resolved.
+func (e *Engine) addRules(defaultName, source, path string) ([]string, error) {
+	rules, err := e.compileRules(defaultName, source, path)
+	if err != nil {
+		return nil, err
+	}
+	return e.addCompiledRules(rules)
+}
+
+// addCompiledRules adds compiled rules, or none if any would exceed the rule
+// limit or already exists
+func (e *Engine) addCompiledRules(rules []*Rule) ([]string, error) {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 	
 	// Check rule count limit
-	if len(e.rules) >= e.limits.MaxRules {
-		return fmt.Errorf("maximum number of rules exceeded (%d)", e.limits.MaxRules)
+	if len(e.rules)+len(rules) > e.limits.MaxRules {
+		return nil, &LimitError{Kind: LimitRules, Limit: e.limits.MaxRules}
 	}
-	
+
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		if e.ruleIndexLocked(rule.Name) >= 0 {
+			return nil, fmt.Errorf("%w: %s", ErrRuleExists, rule.Name)
+		}
+		names[i] = rule.Name
+	}
+	e.rules = append(e.rules, rules...)
+	return names, nil
+}
+
+// UpdateRule replaces the source of an existing rule. The new source is
+// parsed and validated first; if it is invalid the old rule keeps running.
+// The swap is atomic, so an evaluation sees either the old rule or the new
+// one. Availability history for the rule is reset because it describes the
+// old condition.
+//
+// source may be a plain rule or a single named rule block with the same name.
+func (e *Engine) UpdateRule(name, source string) error {
+	rules, err := e.compileRules(name, source, "")
+	if err != nil {
+		return err
+	}
+	if len(rules) != 1 || rules[0].Name != name {
+		return fmt.Errorf("source for rule %s must define exactly that rule", name)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	i := e.ruleIndexLocked(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+	rules[0].LastTrigger = e.rules[i].LastTrigger
+	rules[0].Disabled = e.rules[i].Disabled
+	rules[0].DryRun = e.rules[i].DryRun
+	rules[0].File = e.rules[i].File
+
+	// Copy rather than modify in place; GetRules callers may hold the old slice
+	updated := make([]*Rule, len(e.rules))
+	copy(updated, e.rules)
+	updated[i] = rules[0]
+	e.rules = updated
+	e.availability.remove(name)
+	e.ruleStates.remove(name)
+	e.ruleStats.remove(name)
+	return nil
+}
+
+// RemoveRule removes a single rule and its availability history and statistics
+func (e *Engine) RemoveRule(name string) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	i := e.ruleIndexLocked(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+
+	updated := make([]*Rule, 0, len(e.rules)-1)
+	updated = append(updated, e.rules[:i]...)
+	e.rules = append(updated, e.rules[i+1:]...)
+	e.availability.remove(name)
+	e.ruleStates.remove(name)
+	e.ruleStats.remove(name)
+	delete(e.slaRules, name)
+	return nil
+}
+
+// SetRuleEnabled enables or disables a rule without removing it. Disabled
+// rules keep their source, metadata and history but are not evaluated.
+func (e *Engine) SetRuleEnabled(name string, enabled bool) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	i := e.ruleIndexLocked(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+
+	e.modifyRuleLocked(i, func(rule *Rule) { rule.Disabled = !enabled })
+	return nil
+}
+
+// SetRuleDryRun puts a rule in or out of dry-run mode. A rule in dry-run mode
+// is evaluated and counted in its statistics, but its actions do not run; when
+// its condition is met a "rule_dry_run" event is recorded instead. Use it to
+// roll out a new alerting rule safely and promote it once it fires as
+// expected.
+func (e *Engine) SetRuleDryRun(name string, dryRun bool) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	i := e.ruleIndexLocked(name)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrRuleNotFound, name)
+	}
+
+	e.modifyRuleLocked(i, func(rule *Rule) { rule.DryRun = dryRun })
+	return nil
+}
+
+// SetDryRun puts every rule in or out of dry-run mode, in addition to rules
+// put in dry-run mode with SetRuleDryRun
+func (e *Engine) SetDryRun(enabled bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.dryRun = enabled
+}
+
+// IsDryRun reports whether the engine evaluates every rule in dry-run mode
+func (e *Engine) IsDryRun() bool {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.dryRun
+}
+
+// DisableRule stops evaluating a rule while keeping its source and trigger
+// history, so it can be re-enabled later with EnableRule
+func (e *Engine) DisableRule(name string) error {
+	return e.SetRuleEnabled(name, false)
+}
+
+// EnableRule resumes evaluation of a rule disabled with DisableRule
+func (e *Engine) EnableRule(name string) error {
+	return e.SetRuleEnabled(name, true)
+}
+
+// saveRule adds a rule, or replaces it if a rule with the same name exists
+func (e *Engine) saveRule(name, source string) error {
+	e.mutex.RLock()
+	exists := e.ruleIndexLocked(name) >= 0
+	e.mutex.RUnlock()
+	if exists {
+		return e.UpdateRule(name, source)
+	}
+	return e.AddRule(name, source)
+}
+
+// ruleIndexLocked returns the index of the named rule, or -1. The caller must
+// hold e.mutex.
+func (e *Engine) ruleIndexLocked(name string) int {
+	for i, rule := range e.rules {
+		if rule.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// modifyRuleLocked swaps a modified copy of the rule at index i into the
+// rules. Neither the rule nor the slice is changed in place, since GetRule and
+// GetRules callers may hold either without the lock.
+func (e *Engine) modifyRuleLocked(i int, modify func(*Rule)) {
+	rule := *e.rules[i]
+	modify(&rule)
+	updated := make([]*Rule, len(e.rules))
+	copy(updated, e.rules)
+	updated[i] = &rule
+	e.rules = updated
+}
+
+// replaceRulesLocked atomically replaces the rules for which owned returns
+// true with rules, and returns the names of the new rules. Replacements are
+// inserted where the first replaced rule was, or appended. Rules that keep
+// their name keep their trigger history, enabled state and dry-run mode;
+// availability and statistics are reset for rules that changed or went away.
+// Nothing changes if a new rule's name is taken by another rule or the rule
+// limit would be exceeded. The caller must hold e.mutex.
+func (e *Engine) replaceRulesLocked(owned func(*Rule) bool, rules []*Rule) ([]string, error) {
+	previous := make(map[string]*Rule)
+	others := make(map[string]bool)
+	kept := make([]*Rule, 0, len(e.rules))
+	insertAt := -1
+	for _, rule := range e.rules {
+		if owned(rule) {
+			previous[rule.Name] = rule
+			if insertAt < 0 {
+				insertAt = len(kept)
+			}
+			continue
+		}
+		others[rule.Name] = true
+		kept = append(kept, rule)
+	}
+	if insertAt < 0 {
+		insertAt = len(kept)
+	}
+	if len(kept)+len(rules) > e.limits.MaxRules {
+		return nil, &LimitError{Kind: LimitRules, Limit: e.limits.MaxRules}
+	}
+
+	names := make([]string, len(rules))
+	for i, rule := range rules {
+		if others[rule.Name] {
+			return nil, fmt.Errorf("%w: %s", ErrRuleExists, rule.Name)
+		}
+		if old, ok := previous[rule.Name]; ok {
+			rule.LastTrigger = old.LastTrigger
+			rule.Disabled = old.Disabled
+			rule.DryRun = old.DryRun
+		}
+		names[i] = rule.Name
+	}
+
+	updated := make([]*Rule, 0, len(kept)+len(rules))
+	updated = append(updated, kept[:insertAt]...)
+	updated = append(updated, rules...)
+	e.rules = append(updated, kept[insertAt:]...)
+
+	// Availability and statistics describe the old condition, so reset them
+	// for rules that changed or went away
+	for name, old := range previous {
+		replaced := false
+		for _, rule := range rules {
+			if rule.Name == name && rule.Source == old.Source {
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			e.availability.remove(name)
+			e.ruleStates.remove(name)
+			e.ruleStats.remove(name)
+		}
+	}
+	return names, nil
+}
+
+// compileRules parses, resolves imports, splits and validates source without
+// changing the engine's rules
+func (e *Engine) compileRules(defaultName, source, path string) ([]*Rule, error) {
 	lexer := parser.NewLexer(source)
 	p := parser.New(lexer)
 	program := p.ParseProgram()
 
 	if len(p.Errors()) > 0 {
-		return fmt.Errorf("parse errors: %v", p.Errors())
+		return nil, fmt.Errorf("parse errors: %w", parser.ParseErrors(p.Errors()))
 	}
-	
-	// Check rule complexity using efficient NodeCounter interface
-	complexity := program.CountNodes()
-	if complexity > e.limits.MaxRuleComplexity {
-		return fmt.Errorf("rule complexity (%d nodes) exceeds limit (%d)", complexity, e.limits.MaxRuleComplexity)
+
+	root := e.config.RulesDir
+	if root == "" && path != "" {
+		root = filepath.Dir(path)
+	}
+	if root == "" {
+		root = "."
+	}
+	// Keep the text of shared definitions so that rules split out of the
+	// source can be exported on their own
+	texts := make(map[parser.Statement]string)
+	recordStatementTexts(texts, program.Statements, source)
+	if err := resolveImports(program, root, path, texts); err != nil {
+		return nil, err
 	}
 
-	rule := &Rule{
-		Name:   name,
-		Source: source,
-		AST:    program,
+	rules, err := splitRules(defaultName, source, program, texts)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		for _, rule := range rules {
+			rule.File = filepath.Clean(path)
+		}
 	}
 
-	e.rules = append(e.rules, rule)
-	return nil
+	for _, rule := range rules {
+		if err := validateProgram(rule.AST); err != nil {
+			return nil, fmt.Errorf("invalid rule %s: %w", rule.Name, err)
+		}
+		
+		// Check rule complexity using efficient NodeCounter interface
+		complexity := rule.AST.CountNodes()
+		if complexity > e.limits.MaxRuleComplexity {
+			return nil, &LimitError{Kind: LimitRuleComplexity, Limit: e.limits.MaxRuleComplexity, Rule: rule.Name, Value: complexity}
+		}
+	}
+	return rules, nil
+}
+
+// AddRuleFile loads a .dscr file with AddRules, using the file name without
+// its extension as the name for statements outside named rule blocks. Import
+// statements are resolved relative to EngineConfig.RulesDir, or to the file's
+// directory if that is not set.
+func (e *Engine) AddRuleFile(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule file: %w", err)
+	}
+	return e.addRules(ruleFileName(path), string(content), path)
+}
+
+// splitRules turns a parsed program into one rule per named rule block and,
+// when there are several, one per top-level when-statement, named
+// defaultName#1, defaultName#2, ... in source order. Any other top-level
+// statements form a rule called defaultName. A program with no blocks and at
+// most one when-statement is a single rule called defaultName. texts holds
+// the source text of the top-level definitions.
+func splitRules(defaultName, source string, program *parser.Program, texts map[parser.Statement]string) ([]*Rule, error) {
+	var lets []parser.Statement
+	var definitions []string
+	blocks, whens := 0, 0
+	for _, stmt := range program.Statements {
+		switch stmt.(type) {
+		case *parser.RuleStatement:
+			blocks++
+		case *parser.WhenStatement:
+			whens++
+		case *parser.LetStatement, *parser.ConstStatement:
+			lets = append(lets, stmt)
+			if text, ok := texts[stmt]; ok {
+				definitions = append(definitions, text)
+			} else {
+				definitions = append(definitions, stmt.String())
+			}
+		}
+	}
+	shared := strings.Join(definitions, "\n")
+
+	if blocks == 0 && whens <= 1 {
+		return []*Rule{{Name: defaultName, Source: source, AST: program}}, nil
+	}
+
+	var rules []*Rule
+	var loose []parser.Statement
+	var cuts [][2]int
+	seen := make(map[string]bool)
+	whenIndex := 0
+	for _, stmt := range program.Statements {
+		var rule *Rule
+		var start, end, line int
+		switch s := stmt.(type) {
+		case *parser.RuleStatement:
+			name := s.Name.Value
+			if name == "" {
+				return nil, fmt.Errorf("rule at line %d has an empty name", s.Token.Line)
+			}
+			severity := strings.ToLower(s.Severity)
+			if severity != "" && !actions.IsValidSeverity(severity) {
+				return nil, fmt.Errorf("invalid severity %q for rule %s", s.Severity, name)
+			}
+			start, end, line = s.Token.Position, s.End.Position+1, s.Token.Line
+			rule = &Rule{
+				Name:        name,
+				Source:      source[start:end],
+				AST:         &parser.Program{Statements: append(append([]parser.Statement{}, lets...), s.Body.Statements...)},
+				Description: s.Description,
+				Severity:    severity,
+				Tags:        s.Tags,
+				Labels:      s.Labels,
+				Interval:    unitDuration(s.Every),
+				Group:       s.Group,
+				Cooldown:    unitDuration(s.Cooldown),
+				definitions: shared,
+			}
+		case *parser.WhenStatement:
+			if whens == 1 {
+				loose = append(loose, s)
+				continue
+			}
+			whenIndex++
+			start, end, line = s.Token.Position, s.End.Position+1, s.Token.Line
+			rule = &Rule{
+				Name:        fmt.Sprintf("%s#%d", defaultName, whenIndex),
+				Source:      source[start:end],
+				AST:         &parser.Program{Statements: append(append([]parser.Statement{}, lets...), s)},
+				definitions: shared,
+			}
+		case *parser.LetStatement, *parser.ConstStatement:
+			continue
+		default:
+			loose = append(loose, s)
+			continue
+		}
+
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("duplicate rule name %q at line %d", rule.Name, line)
+		}
+		seen[rule.Name] = true
+		rules = append(rules, rule)
+		cuts = append(cuts, [2]int{start, end})
+	}
+
+	if len(loose) > 0 {
+		if seen[defaultName] {
+			return nil, fmt.Errorf("duplicate rule name %q", defaultName)
+		}
+		// Cut the split-out rules so only the remaining statements are left
+		remaining := source
+		for i := len(cuts) - 1; i >= 0; i-- {
+			remaining = remaining[:cuts[i][0]] + remaining[cuts[i][1]:]
+		}
+		statements := append(append([]parser.Statement{}, lets...), loose...)
+		rules = append(rules, &Rule{
+			Name:   defaultName,
+			Source: strings.TrimSpace(remaining),
+			AST:    &parser.Program{Statements: statements},
+		})
+	}
+
+	return rules, nil
 }
 
 // LoadRule is an alias for AddRule for backward compatibility
@@ -322,6 +1170,10 @@ func (e *Engine) ClearRules() {
 	e.mutex.Lock()
 	defer e.mutex.Unlock()
 	e.rules = make([]*Rule, 0)
+	e.slaRules = nil
+	e.availability.clear()
+	e.ruleStates.clear()
+	e.ruleStats.clear()
 }
 
 // IsRunning returns true if the engine is currently running
@@ -336,41 +1188,73 @@ func (e *Engine) EvaluateRules() {
 	e.evaluateRules()
 }
 
-// UpdateCustomMetric updates a custom metric value with limits checking
 // UpdateCustomMetric sets the value of a custom application metric
 // that can be referenced in rules (e.g., "custom.orders_per_second").
+// Each update is also recorded in the metric's history for use with
+// avg(), max(), trend() and anomaly().
 //
 // Custom metrics are subject to the MaxCustomMetrics resource limit.
 func (e *Engine) UpdateCustomMetric(name string, value float64) error {
-	e.metricsMutex.Lock()
-	defer e.metricsMutex.Unlock()
-	
-	// Check custom metric count limit
-	if len(e.customMetrics) >= e.limits.MaxCustomMetrics {
-		if _, exists := e.customMetrics[name]; !exists {
-			return fmt.Errorf("maximum number of custom metrics exceeded (%d)", e.limits.MaxCustomMetrics)
-		}
+	return e.customMetrics.set(name, value, e.clock.Now(), e.limits.MaxCustomMetrics)
+}
+
+// UpdateCustomMetrics sets several custom metrics at once, recording every
+// value with the same timestamp. Metrics are stored in shards locked
+// independently, and a batch takes each shard it touches once, so
+// applications reporting many metrics at a high rate should prefer it to
+// repeated UpdateCustomMetric calls.
+//
+// If the batch would add more metrics than the MaxCustomMetrics limit
+// allows, it returns an error and no value is updated.
+func (e *Engine) UpdateCustomMetrics(values map[string]float64) error {
+	if len(values) == 0 {
+		return nil
 	}
-	
-	e.customMetrics[name] = value
-	return nil
+	return e.customMetrics.setAll(values, e.clock.Now(), e.limits.MaxCustomMetrics)
+}
+
+// getCustomMetricHistory returns the samples of a custom metric recorded
+// within the given duration, oldest first
+func (e *Engine) getCustomMetricHistory(name string, duration time.Duration) []customMetricSample {
+	return e.customMetrics.history(name, e.clock.Now().Add(-duration))
 }
 
-// GetCustomMetric retrieves a custom metric value
 // GetCustomMetric retrieves the current value of a custom metric.
 // Returns the value and true if the metric exists, or 0 and false if not found.
 func (e *Engine) GetCustomMetric(name string) (float64, bool) {
-	e.metricsMutex.RLock()
-	defer e.metricsMutex.RUnlock()
-	value, exists := e.customMetrics[name]
-	return value, exists
+	return e.customMetrics.get(name)
 }
 
-// SetResourceLimits updates the resource limits
+// SetResourceLimits updates the resource limits. Custom and provider metric
+// histories longer than MaxMetricHistorySize lose their oldest samples.
 func (e *Engine) SetResourceLimits(limits *ResourceLimits) {
 	e.mutex.Lock()
-	defer e.mutex.Unlock()
 	e.limits = limits
+	e.mutex.Unlock()
+
+	size := customHistorySize(e.config, limits)
+	e.customMetrics.setMaxHistory(size)
+	e.labeledMetrics.setMaxHistory(size)
+	e.providerMutex.Lock()
+	e.maxCustomHistory = size
+	for _, state := range e.providers {
+		for name, history := range state.history {
+			if excess := len(history) - size; excess > 0 {
+				state.history[name] = append(history[:0:0], history[excess:]...)
+			}
+		}
+	}
+	e.providerMutex.Unlock()
+}
+
+// customHistorySize is the number of samples kept per custom and provider
+// metric: the runtime collector's history depth, capped by
+// MaxMetricHistorySize
+func customHistorySize(config EngineConfig, limits *ResourceLimits) int {
+	if limits.MaxMetricHistorySize > 0 && limits.MaxMetricHistorySize < config.MetricHistorySize {
+		return limits.MaxMetricHistorySize
+	}
+	return config.MetricHistorySize
 }
 
 // GetResourceLimits returns the current resource limits
@@ -386,7 +1270,7 @@ func (e *Engine) GetResourceLimits() *ResourceLimits {
 func (e *Engine) startDashboard() {
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("DASHBOARD [startup] Panic during dashboard startup: %v\n", r)
+			e.log().Error("Panic during dashboard startup", slog.String("component", "dashboard"), slog.Any("panic", r))
 			e.mutex.Lock()
 			e.dashboardRunning = false
 			e.dashboardConnected = false
@@ -396,19 +1280,20 @@ func (e *Engine) startDashboard() {
 	
 	e.mutex.Lock()
 	e.dashboardRunning = true
-	e.dashboardStartTime = time.Now()
+	e.dashboardStartTime = e.clock.Now()
 	e.mutex.Unlock()
 	
-	fmt.Printf("DASHBOARD [startup] Starting Descry dashboard on port %d\n", e.dashboard.GetPort())
+	e.log().Info("Starting Descry dashboard", slog.String("component", "dashboard"), slog.Int("port", e.dashboard.GetPort()))
 	
-	if err := e.dashboard.Start(); err != nil {
-		fmt.Printf("DASHBOARD [startup] Failed to start dashboard server: %v\n", err)
-		e.mutex.Lock()
-		e.dashboardRunning = false
-		e.dashboardConnected = false
-		e.mutex.Unlock()
-		return
+	// Start blocks until the server is shut down by Stop
+	err := e.dashboard.Start()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		e.log().Error("Failed to start dashboard server", slog.String("component", "dashboard"), slog.Any("error", err))
 	}
+	e.mutex.Lock()
+	e.dashboardRunning = false
+	e.dashboardConnected = false
+	e.mutex.Unlock()
 }
 
 // StartDashboard starts the dashboard server (uses configured port)
@@ -428,6 +1313,78 @@ func (e *Engine) GetHTTPMetrics() metrics.HTTPStats {
 	return e.httpMetrics.GetStats()
 }
 
+// SnapshotMetrics returns the current value of every metric available to
+// rules, keyed by the name used in the DSL (e.g. "heap.alloc",
+// "http.error_rate", "custom.queue_depth"). Values use the same units as
+// rules: bytes for memory and milliseconds for GC pauses, scheduler latency
+// and response times.
+//
+// The map is freshly allocated on each call, so embedding applications can
+// include it in their own logs or heartbeats.
+func (e *Engine) SnapshotMetrics() map[string]float64 {
+	runtimeMetrics := e.runtimeCollector.GetCurrent()
+	httpStats := e.httpMetrics.GetStats()
+	alertCounts := e.GetAlertCounts()
+
+	snapshot := map[string]float64{
+		"heap.alloc":                float64(runtimeMetrics.HeapAlloc),
+		"heap.sys":                  float64(runtimeMetrics.HeapSys),
+		"heap.idle":                 float64(runtimeMetrics.HeapIdle),
+		"heap.inuse":                float64(runtimeMetrics.HeapInuse),
+		"heap.released":             float64(runtimeMetrics.HeapReleased),
+		"heap.objects":              float64(runtimeMetrics.HeapObjects),
+		"goroutines.count":          float64(runtimeMetrics.NumGoroutine),
+		"goroutines.leak_suspects":  float64(e.goroutineLeaks.suspectCount()),
+		"gc.num":                    float64(runtimeMetrics.NumGC),
+		"gc.pause":                  float64(runtimeMetrics.PauseTotalNs) / 1000000,
+		"gc.cpu_fraction":           runtimeMetrics.GCCPUFraction,
+		"gc.heap_goal":              float64(runtimeMetrics.NextGC),
+		"gc.pause_p50":              float64(runtimeMetrics.GCPauseP50Ns) / 1000000,
+		"gc.pause_p99":              float64(runtimeMetrics.GCPauseP99Ns) / 1000000,
+		"sched.latency_p50":         float64(runtimeMetrics.SchedLatencyP50Ns) / 1000000,
+		"sched.latency_p99":         float64(runtimeMetrics.SchedLatencyP99Ns) / 1000000,
+		"uptime.seconds":            e.GetUptime().Seconds(),
+		"alerts.active_count":       float64(alertCounts.Active),
+		"alerts.acknowledged_count": float64(alertCounts.Acknowledged),
+		"alerts.critical_count":     float64(alertCounts.Critical),
+		"alerts.high_count":         float64(alertCounts.High),
+	}
+
+	for path, value := range httpSnapshot("http", httpStats) {
+		snapshot[path] = value
+	}
+	for _, segment := range e.httpMetrics.GetAllSegmentStats() {
+		snapshot["http.segment."+segment.Segment] = segment.Average
+	}
+	for name, server := range e.namedHTTPServers() {
+		for path, value := range httpSnapshot("http."+name, server.GetStats()) {
+			snapshot[path] = value
+		}
+		for _, segment := range server.GetAllSegmentStats() {
+			snapshot["http."+name+".segment."+segment.Segment] = segment.Average
+		}
+	}
+	for name, value := range e.customMetrics.values() {
+		snapshot["custom."+name] = value
+	}
+	for key, value := range e.labeledMetrics.values() {
+		snapshot[key] = value
+	}
+	for name, value := range e.labeledCustomTotals() {
+		snapshot["custom."+name] = value
+	}
+	for name, value := range e.histogramValues() {
+		snapshot["custom."+name] = value
+	}
+	for path, value := range e.leak.snapshot() {
+		snapshot[path] = value
+	}
+	for path, value := range e.providerSnapshot() {
+		snapshot[path] = value
+	}
+	return snapshot
+}
+
 // HTTPMiddleware returns HTTP middleware that automatically collects
 // request metrics including response times, status codes, and request rates.
 // These metrics are available in rules as http.response_time, http.request_rate, etc.
@@ -439,131 +1396,211 @@ func (e *Engine) HTTPMiddleware() func(http.HandlerFunc) http.HandlerFunc {
 	return e.httpMetrics.Middleware
 }
 
+// FromContext returns the recorder of the request ctx belongs to, letting
+// code deep in a handler's call stack attach custom measurements, such as
+// database time or cache hits, to the request being served. Each segment's
+// per-request total is averaged over recent requests that recorded it and
+// is available in rules as http.segment.<name>.
+//
+// The recorder is nil for requests HTTPMiddleware does not record; its
+// methods then do nothing, so callers need not check.
+//
+// Example:
+//
+//	func loadOrder(ctx context.Context, id string) (*Order, error) {
+//		defer descry.FromContext(ctx).Time("db")()
+//		...
+//	}
+//
+//	descry.FromContext(ctx).Add("cache_hits", 1)
+func FromContext(ctx context.Context) *metrics.SegmentRecorder {
+	return metrics.RecorderFromContext(ctx)
+}
+
+// GetSegmentStats returns the statistics of a request segment recorded
+// through FromContext, and false if no request has recorded it
+func (e *Engine) GetSegmentStats(segment string) (metrics.SegmentStats, bool) {
+	return e.httpMetrics.GetSegmentStats(segment)
+}
+
+// GetRouteStats returns the statistics of an HTTP route tracked for an SLA or
+// a route() call in a rule, and false if the route is not tracked
+func (e *Engine) GetRouteStats(route string) (metrics.RouteStats, bool) {
+	return e.httpMetrics.GetRouteStats(route)
+}
+
+// SetRouteLabeler replaces how HTTPMiddleware and HTTPMiddlewareNamed group
+// requests into per-route statistics, read in rules as
+// http.route("<label>").<statistic> and shown on the dashboard's endpoint
+// breakdown. The default labeler uses the
+// pattern of the ServeMux route that served a request, or its path with
+// identifiers such as /orders/42 normalized to /orders/:id. A labeler
+// returning "" leaves a request out; nil restores the default. Statistics
+// kept under earlier labels are cleared.
+//
+// Example:
+//
+//	engine.SetRouteLabeler(func(r *http.Request) string {
+//		if strings.HasPrefix(r.URL.Path, "/static/") {
+//			return "" // not worth a breakdown
+//		}
+//		return metrics.NormalizePath(r.URL.Path)
+//	})
+func (e *Engine) SetRouteLabeler(labeler metrics.RouteLabeler) {
+	e.httpMetrics.SetRouteLabeler(labeler)
+	for _, server := range e.namedHTTPServers() {
+		server.SetRouteLabeler(labeler)
+	}
+}
+
+// GetHTTPBreakdown returns HTTP statistics by route label, by method and by
+// status class
+func (e *Engine) GetHTTPBreakdown() metrics.HTTPBreakdown {
+	return e.httpMetrics.GetBreakdown()
+}
+
+// SetHTTPExclusions replaces the requests HTTPMiddleware and
+// HTTPMiddlewareNamed pass through without recording, so that probes such as
+// health checks and metrics scrapes don't distort http.request_rate,
+// http.response_time and the other HTTP metrics. Calling it with no
+// exclusions records every request again.
+//
+// Example:
+//
+//	engine.SetHTTPExclusions(
+//		metrics.HTTPExclusion{Path: "/healthz"},
+//		metrics.HTTPExclusion{Path: "/debug/*"},
+//		metrics.HTTPExclusion{Method: http.MethodOptions},
+//	)
+func (e *Engine) SetHTTPExclusions(exclusions ...metrics.HTTPExclusion) {
+	e.httpMetrics.SetExclusions(exclusions)
+	for _, server := range e.namedHTTPServers() {
+		server.SetExclusions(exclusions)
+	}
+}
+
 func (e *Engine) GetRules() []*Rule {
 	e.mutex.RLock()
 	defer e.mutex.RUnlock()
 	return e.rules
 }
 
-func (e *Engine) evaluationLoop() {
-	ticker := time.NewTicker(1 * time.Second) // Evaluate rules every second
+// GetRule returns the rule with the given name, if one is loaded. Rules are
+// replaced rather than modified in place, so the returned rule is a stable
+// snapshot that should not be modified.
+func (e *Engine) GetRule(name string) (*Rule, bool) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	i := e.ruleIndexLocked(name)
+	if i < 0 {
+		return nil, false
+	}
+	return e.rules[i], true
+}
+
+// ruleSeverity returns the default alert severity of the named rule: the
+// severity it declares, or else its group's
+func (e *Engine) ruleSeverity(name string) string {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	for _, rule := range e.rules {
+		if rule.Name == name {
+			if rule.Severity != "" {
+				return rule.Severity
+			}
+			return e.groups[rule.Group].Severity
+		}
+	}
+	return ""
+}
+
+func (e *Engine) evaluationLoop(stopCh chan struct{}) {
+	ticker := e.clock.NewTicker(e.config.EvaluationInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			e.evaluateRules()
+			if err := e.actionRegistry.CheckStorm(e.clock.Now()); err != nil {
+				e.log().Error("Alert storm notification failed", slog.String("rule", actions.StormRuleName), slog.Any("error", err))
+			}
 			e.sendMetricsToDashboard()
-		case <-e.stopCh:
+		case <-stopCh:
 			return
 		}
 	}
 }
 
 func (e *Engine) evaluateRules() {
+	e.collectProviders()
+	e.leak.observe(e.clock.Now(), e.runtimeCollector.GetCurrent())
+	e.goroutineLeaks.observe(e.clock.Now())
+
 	e.mutex.RLock()
 	rules := make([]*Rule, len(e.rules))
 	copy(rules, e.rules)
+	groups := e.groups
 	e.mutex.RUnlock()
 
+	now := e.clock.Now()
+	due := rules[:0]
 	for _, rule := range rules {
-		e.evaluateRule(rule)
-	}
-}
-
-func (e *Engine) evaluateRule(rule *Rule) {
-	// Create context with timeout for evaluation
-	ctx, cancel := context.WithTimeout(context.Background(), e.limits.MaxEvaluationTime)
-	defer cancel()
-	
-	// Create resource tracker for this evaluation
-	tracker := NewResourceTracker(ctx, e.limits.MaxMemoryUsage, e.limits.MaxCPUTime)
-	defer tracker.Cancel()
-	
-	// Channel for result communication
-	type evalResult struct {
-		result interface{}
-		err    error
-	}
-	
-	resultCh := make(chan evalResult, 1)
-	
-	// Start evaluation in goroutine with proper cleanup
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				resultCh <- evalResult{nil, fmt.Errorf("panic during rule evaluation: %v", r)}
-			}
-		}()
-		
-		// Set current rule name for action handlers
-		e.evaluator.SetCurrentRuleName(rule.Name)
-		
-		// Context-aware evaluation
-		result := e.evaluator.EvalWithContext(tracker.Context(), rule.AST)
-		resultCh <- evalResult{result, nil}
-	}()
-	
-	// Resource monitoring ticker
-	ticker := time.NewTicker(10 * time.Millisecond)
-	defer ticker.Stop()
-	
-	for {
-		select {
-		case result := <-resultCh:
-			// Evaluation completed successfully
-			if result.err != nil {
-				e.logError("Rule evaluation error", rule.Name, result.err, tracker)
-				return
-			}
-			e.handleEvaluationResult(rule, result.result, tracker)
-			return
-			
-		case <-ticker.C:
-			// Periodic resource limit checking
-			if err := tracker.CheckLimits(); err != nil {
-				if IsResourceLimitError(err) {
-					e.logResourceLimit("Rule evaluation resource limit exceeded", rule.Name, err, tracker)
-				} else {
-					e.logError("Rule evaluation cancelled", rule.Name, err, tracker)
-				}
-				return
-			}
-			
-		case <-ctx.Done():
-			// Timeout or cancellation
-			e.logError("Rule evaluation timeout", rule.Name, ctx.Err(), tracker)
-			return
+		if rule.Disabled || !e.ruleDue(rule, now) {
+			continue
 		}
+		if cooldown := ruleCooldown(rule, groups); cooldown > 0 && now.Sub(rule.LastTrigger) < cooldown {
+			continue
+		}
+		e.schedule.evaluated(rule.Name, now)
+		due = append(due, rule)
 	}
+	e.runEvaluations(due)
 }
 
-// handleEvaluationResult processes the result of rule evaluation
-func (e *Engine) handleEvaluationResult(rule *Rule, result interface{}, tracker *ResourceTracker) {
+// handleEvaluationResult processes the result of rule evaluation and returns
+// its outcome. Failed actions are logged individually; the rule still counts
+// as triggered.
+func (e *Engine) handleEvaluationResult(rule *Rule, dryRun bool, result interface{}, actionResults []ActionResult, tracker *ResourceTracker) (ruleOutcome, error) {
 	if result == nil {
-		return
+		return outcomeHealthy, nil
 	}
 	
 	// Type check with safe casting
-	if typed, ok := result.(interface{ Type() string }); ok {
+	if typed, ok := result.(Object); ok {
 		switch typed.Type() {
-		case "ERROR":
+		case ERROR_OBJ:
+			err := fmt.Errorf("unknown rule evaluation error")
 			if inspector, ok := result.(interface{ Inspect() string }); ok {
-				e.logError("Rule evaluation logic error", rule.Name, 
-					fmt.Errorf("rule error: %s", inspector.Inspect()), tracker)
-			} else {
-				e.logError("Rule evaluation logic error", rule.Name, 
-					fmt.Errorf("unknown rule evaluation error"), tracker)
+				err = fmt.Errorf("rule error: %s", inspector.Inspect())
+			}
+			e.logError(RuleErrorEvaluation, "Rule evaluation logic error", rule.Name, err, tracker)
+			return outcomeError, err
+			
+		case RULE_TRIGGERED_OBJ:
+			if dryRun {
+				e.recordDryRunTrigger(rule, tracker)
+				return outcomeTriggered, nil
 			}
-			return
 			
-		case "RULE_TRIGGERED":
 			e.mutex.Lock()
-			rule.LastTrigger = time.Now()
+			if i := e.ruleIndexLocked(rule.Name); i >= 0 {
+				now := e.clock.Now()
+				e.modifyRuleLocked(i, func(rule *Rule) { rule.LastTrigger = now })
+			}
 			e.mutex.Unlock()
+			e.availability.record(rule.Name, false, e.clock.Now())
+			
+			for _, actionResult := range actionResults {
+				if !actionResult.Success {
+					e.logError(RuleErrorAction, "Rule action failed", rule.Name,
+						fmt.Errorf("%s: %s", actionResult.Action, actionResult.Error), tracker)
+				}
+			}
 			
 			// Send event to dashboard
-			e.dashboard.SendEventUpdate("rule_triggered", "Rule condition met", rule.Name, nil)
+			e.sendEventUpdate("rule_triggered", "Rule condition met", rule.Name,
+				map[string]interface{}{"actions": actionResults})
 			
 			// Log successful trigger with resource stats
 			memStats := tracker.GetMemoryStats()
@@ -575,39 +1612,85 @@ func (e *Engine) handleEvaluationResult(rule *Rule, result interface{}, tracker
 				"memory_initial": memStats.InitialAlloc,
 				"cpu_time_used":  cpuStats.CPUTimeUsed.Seconds(),
 				"wall_time":      cpuStats.WallTimeUsed.Seconds(),
+				"actions":        actionResults,
 			})
 			
 			e.logRuleTrigger(rule.Name, memStats, cpuStats)
+			return outcomeTriggered, nil
+			
+		default:
+			// The condition was evaluated and did not trigger
+			e.availability.record(rule.Name, true, e.clock.Now())
 		}
 	}
+	return outcomeHealthy, nil
 }
 
-// logError logs evaluation errors with resource context
-func (e *Engine) logError(message, ruleName string, err error, tracker *ResourceTracker) {
-	memStats := tracker.GetMemoryStats()
-	cpuStats := tracker.GetCPUStats()
-	
-	fmt.Printf("ERROR [%s] %s: %v | Memory: %.1f%% (current: %d bytes) | CPU: %v/%v (%.1f%% efficiency)\n",
-		ruleName, message, err,
-		memStats.BudgetUsed, memStats.CurrentAlloc,
-		cpuStats.CPUTimeUsed, cpuStats.MaxCPUTime, cpuStats.CPUEfficiency)
+// recordDryRunTrigger reports that a rule in dry-run mode would have
+// triggered. Its trigger time and availability are left alone, since nothing
+// was actually raised.
+func (e *Engine) recordDryRunTrigger(rule *Rule, tracker *ResourceTracker) {
+	message := "Rule would have triggered"
+	data := map[string]interface{}{"source": rule.Source}
+	e.RecordEvent("rule_dry_run", rule.Name, message, data)
+	e.sendEventUpdate("rule_dry_run", message, rule.Name, data)
+
+	attrs := append([]any{slog.String("rule", rule.Name)},
+		resourceAttrs(tracker.GetMemoryStats(), tracker.GetCPUStats())...)
+	e.log().Info(message, attrs...)
+}
+
+// SetLogger sets the logger for the engine's diagnostics: rule triggers,
+// evaluation errors, resource limit violations, rule reloads and dashboard
+// status. Passing nil restores EngineConfig.DiagnosticLogger, or
+// slog.Default() when that is nil. log() and alert() actions are not affected.
+func (e *Engine) SetLogger(logger *slog.Logger) {
+	if logger == nil {
+		logger = e.config.DiagnosticLogger
+	}
+	e.logger.Store(logger)
+}
+
+// log returns the logger for the engine's diagnostics
+func (e *Engine) log() *slog.Logger {
+	if logger := e.logger.Load(); logger != nil {
+		return logger
+	}
+	return slog.Default()
 }
 
-// logResourceLimit logs resource limit violations
+// resourceAttrs describes an evaluation's resource usage as log attributes
+func resourceAttrs(memStats MemoryStats, cpuStats CPUStats) []any {
+	return []any{
+		slog.Duration("duration", cpuStats.WallTimeUsed),
+		slog.Duration("cpu_time", cpuStats.CPUTimeUsed),
+		slog.Duration("cpu_limit", cpuStats.MaxCPUTime),
+		slog.Float64("cpu_efficiency", cpuStats.CPUEfficiency),
+		slog.Float64("memory_budget_used", memStats.BudgetUsed),
+		slog.Uint64("memory_alloc", memStats.CurrentAlloc),
+	}
+}
+
+// logError logs evaluation errors with resource context and passes them to
+// the OnError callbacks
+func (e *Engine) logError(kind RuleErrorKind, message, ruleName string, err error, tracker *ResourceTracker) {
+	attrs := append([]any{slog.String("rule", ruleName), slog.Any("error", err)}, resourceAttrs(tracker.GetMemoryStats(), tracker.GetCPUStats())...)
+	e.log().Error(message, attrs...)
+	e.reportError(RuleError{Rule: ruleName, Kind: kind, Err: err})
+}
+
+// logResourceLimit logs resource limit violations and passes them to the
+// OnError callbacks
 func (e *Engine) logResourceLimit(message, ruleName string, err error, tracker *ResourceTracker) {
-	memStats := tracker.GetMemoryStats()
-	cpuStats := tracker.GetCPUStats()
-	
-	fmt.Printf("LIMIT [%s] %s: %v | Memory: %.1f%% budget used | CPU: %v used of %v allowed\n",
-		ruleName, message, err,
-		memStats.BudgetUsed,
-		cpuStats.CPUTimeUsed, cpuStats.MaxCPUTime)
+	attrs := append([]any{slog.String("rule", ruleName), slog.Any("error", err)}, resourceAttrs(tracker.GetMemoryStats(), tracker.GetCPUStats())...)
+	e.log().Warn(message, attrs...)
+	e.reportError(RuleError{Rule: ruleName, Kind: RuleErrorResourceLimit, Err: err})
 }
 
 // logRuleTrigger logs successful rule triggers with performance metrics
 func (e *Engine) logRuleTrigger(ruleName string, memStats MemoryStats, cpuStats CPUStats) {
-	fmt.Printf("TRIGGER [%s] Rule condition met | Memory: %.1f%% budget | CPU: %v (%.1f%% efficiency)\n",
-		ruleName, memStats.BudgetUsed, cpuStats.CPUTimeUsed, cpuStats.CPUEfficiency)
+	attrs := append([]any{slog.String("rule", ruleName)}, resourceAttrs(memStats, cpuStats)...)
+	e.log().Info("Rule triggered", attrs...)
 }
 
 func (e *Engine) sendMetricsToDashboard() {
@@ -631,33 +1714,84 @@ func (e *Engine) sendMetricsToDashboard() {
 		"heap.released":    runtimeMetrics.HeapReleased,
 		"heap.objects":     runtimeMetrics.HeapObjects,
 		"goroutines.count": runtimeMetrics.NumGoroutine,
+		"goroutines.leak_suspects": e.goroutineLeaks.suspectCount(),
 		"gc.num":           runtimeMetrics.NumGC,
 		"gc.pause":         runtimeMetrics.PauseTotalNs,
 		"gc.cpu_fraction":  runtimeMetrics.GCCPUFraction,
-		// HTTP metrics
-		"http.request_count":    httpStats.RequestCount,
-		"http.error_count":      httpStats.ErrorCount,
-		"http.error_rate":       httpStats.ErrorRate,
-		"http.request_rate":     httpStats.RequestRate,
-		"http.response_time":    httpStats.AvgResponseTime,
-		"http.max_response_time": httpStats.MaxResponseTime,
-		"http.pending_requests": httpStats.PendingRequests,
+		"gc.heap_goal":     runtimeMetrics.NextGC,
+		"gc.pause_p50":     runtimeMetrics.GCPauseP50Ns,
+		"gc.pause_p99":     runtimeMetrics.GCPauseP99Ns,
+		"sched.latency_p50": runtimeMetrics.SchedLatencyP50Ns,
+		"sched.latency_p99": runtimeMetrics.SchedLatencyP99Ns,
+	}
+	
+	for path, value := range httpDashboardMetrics("http", httpStats) {
+		dashboardMetrics[path] = value
+	}
+	for _, segment := range e.httpMetrics.GetAllSegmentStats() {
+		dashboardMetrics["http.segment."+segment.Segment] = segment.Average
+	}
+	for name, server := range e.namedHTTPServers() {
+		for path, value := range httpDashboardMetrics("http."+name, server.GetStats()) {
+			dashboardMetrics[path] = value
+		}
+		for _, segment := range server.GetAllSegmentStats() {
+			dashboardMetrics["http."+name+".segment."+segment.Segment] = segment.Average
+		}
+	}
+	
+	for i, site := range e.GoroutinesBySite() {
+		if i == maxGoroutineSiteMetrics {
+			break
+		}
+		dashboardMetrics["goroutines.by_site{site="+site.Function+"}"] = site.Count
+	}
+	
+	dashboardMetrics["uptime.seconds"] = e.GetUptime().Seconds()
+	for _, availability := range e.GetAvailability() {
+		dashboardMetrics["availability{rule="+availability.Rule+"}"] = availability.Availability
+	}
+	
+	// Custom metrics are exposed under the same namespace used in rules,
+	// with their names redacted
+	r := e.redactor()
+	for name, value := range e.customMetrics.values() {
+		dashboardMetrics[r.text("custom."+name)] = value
+	}
+	for key, value := range e.labeledMetrics.values() {
+		dashboardMetrics[r.text(key)] = value
+	}
+	for name, value := range e.labeledCustomTotals() {
+		dashboardMetrics[r.text("custom."+name)] = value
+	}
+	for name, value := range e.histogramValues() {
+		dashboardMetrics[r.text("custom."+name)] = value
+	}
+	for path, value := range e.leak.snapshot() {
+		dashboardMetrics[path] = value
+	}
+	for path, value := range e.providerSnapshot() {
+		dashboardMetrics[path] = value
 	}
 	
 	// Send metrics to dashboard with error handling
-	if err := e.dashboard.SendMetricUpdate(dashboardMetrics); err != nil {
+	stale := e.staleCustomMetrics()
+	for i, name := range stale {
+		stale[i] = r.text(name)
+	}
+	if err := e.dashboard.SendMetricUpdate(dashboardMetrics, stale...); err != nil {
 		e.mutex.Lock()
 		e.dashboardConnected = false
 		e.mutex.Unlock()
 		// Log error but don't halt execution
-		fmt.Printf("DASHBOARD [metrics] Failed to send metrics to dashboard: %v\n", err)
+		e.log().Warn("Failed to send metrics to dashboard", slog.String("component", "dashboard"), slog.Any("error", err))
 		return
 	}
 	
 	// Track successful sends
 	e.mutex.Lock()
 	e.dashboardConnected = true
-	e.lastMetricsSent = time.Now()
+	e.lastMetricsSent = e.clock.Now()
 	e.mutex.Unlock()
 }
 
@@ -665,6 +1799,12 @@ func (e *Engine) GetDashboard() *dashboard.Server {
 	return e.dashboard
 }
 
+// GetAlertCounts returns the number of ongoing dashboard alerts by status and
+// severity, which rules read as alerts.active_count, alerts.critical_count, etc.
+func (e *Engine) GetAlertCounts() dashboard.AlertCounts {
+	return e.dashboard.GetAlertCounts()
+}
+
 // generateEventID creates a simple unique ID for events
 func generateEventID() string {
 	b := make([]byte, 8)
@@ -674,6 +1814,13 @@ func generateEventID() string {
 
 // RecordEvent adds an event to the history with automatic ID generation
 func (e *Engine) RecordEvent(eventType, ruleName, message string, data map[string]interface{}) {
+	var labels map[string]string
+	if ruleName != "" {
+		labels = e.ruleLabels(ruleName)
+	}
+
+	r := e.redactor()
+	
 	e.eventMutex.Lock()
 	defer e.eventMutex.Unlock()
 	
@@ -681,13 +1828,15 @@ func (e *Engine) RecordEvent(eventType, ruleName, message string, data map[strin
 		ID:        generateEventID(),
 		Type:      eventType,
 		RuleName:  ruleName,
-		Message:   message,
-		Timestamp: time.Now(),
-		Data:      data,
+		Message:   r.text(message),
+		Timestamp: e.clock.Now(),
+		Data:      r.data(data),
+		Labels:    labels,
 	}
 	
 	// Add to history
 	e.eventHistory = append(e.eventHistory, event)
+	e.eventIndex.add(eventType, event.Timestamp)
 	
 	// Maintain max history size (circular buffer behavior)
 	if len(e.eventHistory) > e.maxEventHistory {
@@ -695,52 +1844,183 @@ func (e *Engine) RecordEvent(eventType, ruleName, message string, data map[strin
 	}
 }
 
-// GetEventHistory returns recent events with optional filtering
-func (e *Engine) GetEventHistory(limit int, eventType string) []EventRecord {
-	e.eventMutex.RLock()
-	defer e.eventMutex.RUnlock()
-	
-	var filtered []EventRecord
-	
-	// Filter by type if specified
-	if eventType != "" {
-		for _, event := range e.eventHistory {
-			if event.Type == eventType {
-				filtered = append(filtered, event)
-			}
+// EmitEvent records an application event, such as a failed order or a cache
+// rebuild, in the event history and streams it to the dashboard alongside rule
+// triggers and alerts, so business events can be lined up with the runtime
+// behaviour around them. eventType is free-form, e.g. "order_failed"; data is
+// optional and copied.
+func (e *Engine) EmitEvent(eventType, message string, data map[string]interface{}) {
+	var copied map[string]interface{}
+	if data != nil {
+		copied = make(map[string]interface{}, len(data))
+		for key, value := range data {
+			copied[key] = value
 		}
-	} else {
-		filtered = make([]EventRecord, len(e.eventHistory))
-		copy(filtered, e.eventHistory)
 	}
-	
-	// Apply limit (get most recent events)
-	if limit > 0 && len(filtered) > limit {
-		filtered = filtered[len(filtered)-limit:]
+	e.RecordEvent(eventType, "", message, copied)
+	e.sendEventUpdate(eventType, message, "", copied)
+}
+
+// EventQuery selects events from the engine's event history. Zero fields
+// match every event.
+type EventQuery struct {
+	// Types keeps events of any of these types, e.g. "alert" or "rule_trigger"
+	Types []string
+	// Rule keeps events raised by this rule
+	Rule string
+	// Since keeps events at or after this time
+	Since time.Time
+	// Until keeps events before this time
+	Until time.Time
+	// Labels keeps events from rules with every one of these labels
+	Labels map[string]string
+	// Limit caps the number of events returned, keeping the most recent
+	Limit int
+}
+
+// matches reports whether event satisfies every filter of the query
+func (q EventQuery) matches(event EventRecord) bool {
+	if len(q.Types) > 0 && !containsString(q.Types, event.Type) {
+		return false
 	}
-	
-	// Reverse to get newest first
-	for i := len(filtered)/2 - 1; i >= 0; i-- {
-		opp := len(filtered) - 1 - i
-		filtered[i], filtered[opp] = filtered[opp], filtered[i]
+	if q.Rule != "" && event.RuleName != q.Rule {
+		return false
+	}
+	if !q.Since.IsZero() && event.Timestamp.Before(q.Since) {
+		return false
 	}
+	if !q.Until.IsZero() && !event.Timestamp.Before(q.Until) {
+		return false
+	}
+	return matchLabels(event.Labels, q.Labels)
+}
+
+// QueryEvents returns the events in the engine's history that match query,
+// newest first. The history holds rule triggers, actions such as alerts and
+// logs, rule reload errors and application events, up to
+// EngineConfig.EventHistorySize entries.
+func (e *Engine) QueryEvents(query EventQuery) []EventRecord {
+	e.eventMutex.RLock()
+	defer e.eventMutex.RUnlock()
 	
+	// Walk backwards so the limit keeps the most recent matches
+	filtered := make([]EventRecord, 0)
+	for i := len(e.eventHistory) - 1; i >= 0; i-- {
+		if query.Limit > 0 && len(filtered) >= query.Limit {
+			break
+		}
+		if query.matches(e.eventHistory[i]) {
+			filtered = append(filtered, e.eventHistory[i])
+		}
+	}
 	return filtered
 }
 
-// eventRecordingHandler wraps action handlers to record events in history
+// GetEventHistory returns up to limit recent events, newest first, optionally
+// only those of eventType. A limit of zero returns every event. See
+// QueryEvents for more filters.
+func (e *Engine) GetEventHistory(limit int, eventType string) []EventRecord {
+	query := EventQuery{Limit: limit}
+	if eventType != "" {
+		query.Types = []string{eventType}
+	}
+	return e.QueryEvents(query)
+}
+
+// eventRecordingHandler records every executed action in the event history
 type eventRecordingHandler struct {
-	engine     *Engine
-	actionType string
-	wrapped    actions.ActionHandler
+	engine *Engine
 }
 
 func (h *eventRecordingHandler) Handle(action actions.Action) error {
-	// Record the event in history
-	h.engine.RecordEvent(h.actionType, action.RuleName, action.Message, nil)
-	
-	// Delegate to wrapped handler
-	return h.wrapped.Handle(action)
+	h.engine.RecordEvent(string(action.Type), action.RuleName, action.Message, action.Details)
+	return nil
+}
+
+// stormCollapseHandler suppresses the dashboard's individual alerts while an
+// alert storm is active so that only the storm alert remains
+type stormCollapseHandler struct {
+	engine *Engine
+}
+
+func (h *stormCollapseHandler) Handle(action actions.Action) error {
+	if action.Type != actions.AlertAction {
+		return nil
+	}
+	if status := h.engine.actionRegistry.GetStormStatus(); status != nil && status.Active {
+		h.engine.dashboard.SuppressActiveAlerts(actions.StormRuleName, "Collapsed into alert storm")
+	}
+	return nil
+}
+
+// RegisterActionHandler registers a named action handler (for example a webhook
+// or pager integration) that routing configurations can reference
+func (e *Engine) RegisterActionHandler(name string, handler actions.ActionHandler) {
+	e.actionRegistry.RegisterNamedHandler(name, handler)
+}
+
+// LoadRoutingConfig loads a routing configuration from a JSON file and installs
+// it, replacing the default fan-out of actions to all registered handlers
+func (e *Engine) LoadRoutingConfig(filename string) error {
+	config, err := actions.LoadRoutingConfig(filename)
+	if err != nil {
+		return err
+	}
+	return e.SetRoutingConfig(config)
+}
+
+// SetRoutingConfig installs a routing configuration. Passing nil restores the
+// default fan-out.
+func (e *Engine) SetRoutingConfig(config *actions.RoutingConfig) error {
+	return e.actionRegistry.SetRouting(config)
+}
+
+// GetRoutingConfig returns the active routing configuration, or nil if none is set
+func (e *Engine) GetRoutingConfig() *actions.RoutingConfig {
+	return e.actionRegistry.GetRouting()
+}
+
+// SetStormConfig enables alert storm detection. Bursts of many distinct alerts
+// are collapsed into a single storm alert, and handlers receive periodic
+// digests instead of individual alerts until the storm subsides. Passing nil
+// disables detection.
+func (e *Engine) SetStormConfig(config *actions.StormConfig) {
+	e.actionRegistry.SetStormDetection(config)
+}
+
+// GetStormStatus returns the state of alert storm detection, or nil if it is
+// disabled
+func (e *Engine) GetStormStatus() *actions.StormStatus {
+	return e.actionRegistry.GetStormStatus()
+}
+
+// SetActionQuotas caps how often action handlers execute, globally and per
+// named handler, within a sliding window. Executions beyond a quota are
+// dropped; each time a quota starts dropping, an "action_quota_exceeded"
+// event is recorded and a warning logged. Passing nil removes the quotas.
+func (e *Engine) SetActionQuotas(config *actions.QuotaConfig) error {
+	return e.actionRegistry.SetQuotas(config)
+}
+
+// GetActionQuotas returns the use of every configured action quota, or nil
+// if none are set
+func (e *Engine) GetActionQuotas() []actions.QuotaStatus {
+	// Actions are stamped with the wall clock when created
+	return e.actionRegistry.GetQuotaStatus(time.Now())
+}
+
+// reportQuotaOverflow records a quota that started dropping executions
+func (e *Engine) reportQuotaOverflow(overflow actions.QuotaOverflow) {
+	e.log().Warn("Action quota exceeded", slog.String("quota", overflow.Quota),
+		slog.Int("limit", overflow.Limit), slog.Duration("window", overflow.Window),
+		slog.String("rule", overflow.Action.RuleName))
+	e.EmitEvent("action_quota_exceeded", overflow.String(), map[string]interface{}{
+		"quota":   overflow.Quota,
+		"limit":   overflow.Limit,
+		"window":  overflow.Window.String(),
+		"handler": overflow.Handler,
+		"rule":    overflow.Action.RuleName,
+	})
 }
 
 // GetDashboardStatus returns dashboard health and connection information
@@ -753,6 +2033,6 @@ func (e *Engine) GetDashboardStatus() map[string]interface{} {
 		"connected":         e.dashboardConnected,
 		"start_time":        e.dashboardStartTime,
 		"last_metrics_sent": e.lastMetricsSent,
-		"uptime_seconds":    time.Since(e.dashboardStartTime).Seconds(),
+		"uptime_seconds":    e.clock.Now().Sub(e.dashboardStartTime).Seconds(),
 	}
 }
\ No newline at end of file
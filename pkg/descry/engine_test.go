@@ -0,0 +1,995 @@
+package descry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/clock"
+	"github.com/chosenoffset/descry/pkg/descry/metrics"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes and reads
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestEngineConfig(t *testing.T) {
+	defaults := NewEngineWithConfig(EngineConfig{})
+	if !reflect.DeepEqual(defaults.config, DefaultEngineConfig()) {
+		t.Errorf("expected zero config to use defaults, got %+v", defaults.config)
+	}
+
+	var output, diagnostics syncBuffer
+	engine := NewEngineWithConfig(EngineConfig{
+		DisableDashboard:   true,
+		EvaluationInterval: 10 * time.Millisecond,
+		EventHistorySize:   2,
+		Logger:             log.New(&output, "descry ", 0),
+		DiagnosticLogger:   slog.New(slog.NewTextHandler(&diagnostics, nil)),
+	})
+	if err := engine.AddRule("fired", `when heap.alloc > 0 { alert("Heap in use") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+
+	engine.Start(context.Background())
+	deadline := time.Now().Add(2 * time.Second)
+	for len(engine.GetEventHistory(0, "")) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	engine.Stop()
+
+	if events := engine.GetEventHistory(0, ""); len(events) != 2 {
+		t.Errorf("expected event history capped at 2, got %d", len(events))
+	}
+	if status := engine.GetDashboardStatus(); status["running"] != false {
+		t.Error("expected dashboard not to start when disabled")
+	}
+	// Alerts keep the Logger's prefix; diagnostics go to their own logger
+	if logged := output.String(); !strings.HasPrefix(logged, "descry ALERT [fired]: Heap in use") || strings.Contains(logged, "Rule triggered") {
+		t.Errorf("expected only alerts in the logger, got %q", logged)
+	}
+	if logged := diagnostics.String(); !strings.Contains(logged, `msg="Rule triggered" rule=fired`) {
+		t.Errorf("expected diagnostics in the diagnostic logger, got %q", logged)
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	configured := slog.New(slog.NewTextHandler(io.Discard, nil))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0), DiagnosticLogger: configured})
+	if err := engine.AddRule("fired", `when heap.alloc > 0 { log("Heap in use") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	if err := engine.AddRule("broken", `when heap.alloc / 0 > 1 { log("never") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+
+	var output syncBuffer
+	engine.SetLogger(slog.New(slog.NewJSONHandler(&output, nil)))
+	engine.EvaluateRules()
+
+	records := make(map[string]map[string]interface{})
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("expected JSON log records, got %q", line)
+		}
+		records[record["rule"].(string)] = record
+	}
+
+	triggered := records["fired"]
+	if triggered == nil || triggered["level"] != "INFO" || triggered["msg"] != "Rule triggered" {
+		t.Fatalf("expected a trigger record, got %v", records)
+	}
+	for _, field := range []string{"duration", "cpu_time", "cpu_limit", "memory_budget_used", "memory_alloc"} {
+		if _, ok := triggered[field]; !ok {
+			t.Errorf("expected trigger record to include %s, got %v", field, triggered)
+		}
+	}
+	if failed := records["broken"]; failed == nil || failed["level"] != "ERROR" || failed["error"] == nil {
+		t.Errorf("expected an error record, got %v", records)
+	}
+
+	engine.SetLogger(nil)
+	if engine.log() != configured {
+		t.Error("expected nil to restore EngineConfig.DiagnosticLogger")
+	}
+}
+
+func TestStartContext(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{
+		DisableDashboard:   true,
+		EvaluationInterval: 5 * time.Millisecond,
+		Logger:             log.New(io.Discard, "", 0),
+	})
+	if err := engine.AddRule("counted", `when heap.alloc < 0 { log("never") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	engine.Start(ctx)
+	deadline := time.Now().Add(2 * time.Second)
+	for engine.GetRuleStats()[0].Evaluations == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	for engine.IsRunning() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if engine.IsRunning() {
+		t.Fatal("expected cancelling the context to stop the engine")
+	}
+
+	// Once Stop returns the evaluation loop has exited
+	engine.Stop()
+	evaluations := engine.GetRuleStats()[0].Evaluations
+	time.Sleep(25 * time.Millisecond)
+	if after := engine.GetRuleStats()[0].Evaluations; after != evaluations {
+		t.Errorf("expected no evaluations after Stop, got %d more", after-evaluations)
+	}
+}
+
+func TestRestart(t *testing.T) {
+	port := getAvailablePort()
+	engine := NewEngineWithConfig(EngineConfig{
+		DashboardHost:      "127.0.0.1",
+		DashboardPort:      port,
+		EvaluationInterval: 10 * time.Millisecond,
+		Logger:             log.New(io.Discard, "", 0),
+	})
+	if err := engine.AddRule("counted", `when heap.alloc < 0 { log("never") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+
+	// latestMetrics returns when the dashboard last received metrics
+	latestMetrics := func() time.Time {
+		resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/api/metrics", port))
+		if err != nil {
+			return time.Time{}
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Data struct {
+				Timestamp time.Time `json:"timestamp"`
+			} `json:"data"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return body.Data.Timestamp
+	}
+
+	for round := 1; round <= 2; round++ {
+		started := time.Now()
+		engine.Start(context.Background())
+		deadline := started.Add(2 * time.Second)
+		for latestMetrics().Before(started) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if latestMetrics().Before(started) {
+			t.Fatalf("round %d: expected the dashboard to receive metrics", round)
+		}
+		evaluations := engine.GetRuleStats()[0].Evaluations
+		for engine.GetRuleStats()[0].Evaluations == evaluations && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if engine.GetRuleStats()[0].Evaluations == evaluations {
+			t.Fatalf("round %d: expected rules to be evaluated", round)
+		}
+		engine.Stop()
+	}
+}
+
+func TestRemoveAndUpdateRule(t *testing.T) {
+	engine := NewEngine()
+	if err := engine.AddRule("memory", `when heap.alloc > 0 { log("heap in use") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	if err := engine.AddRule("memory", `when heap.alloc > 1 { log("duplicate") }`); err == nil {
+		t.Error("expected duplicate rule name to be rejected")
+	}
+	engine.EvaluateRules()
+	before := engine.GetRules()
+
+	if err := engine.UpdateRule("memory", `when heap.alloc < 0 { log("never") }`); err != nil {
+		t.Fatalf("failed to update rule: %v", err)
+	}
+	rules := engine.GetRules()
+	if len(rules) != 1 || !strings.Contains(rules[0].Source, "never") {
+		t.Fatalf("expected rule source to be replaced, got %+v", rules)
+	}
+	if !strings.Contains(before[0].Source, "heap in use") {
+		t.Error("expected previously returned rules to be unaffected by the swap")
+	}
+	if _, ok := engine.GetRuleAvailability("memory"); ok {
+		t.Error("expected availability history to be reset on update")
+	}
+
+	if err := engine.UpdateRule("memory", `when heap.alloc > {`); err == nil {
+		t.Error("expected invalid source to be rejected")
+	}
+	if !strings.Contains(engine.GetRules()[0].Source, "never") {
+		t.Error("expected the old rule to remain after a failed update")
+	}
+	if err := engine.UpdateRule("memory", `rule "other" { when heap.alloc > 0 { log("x") } }`); err == nil {
+		t.Error("expected source defining a different rule to be rejected")
+	}
+	if err := engine.UpdateRule("missing", `when heap.alloc > 0 { log("x") }`); err == nil {
+		t.Error("expected updating an unknown rule to fail")
+	}
+
+	if err := engine.RemoveRule("memory"); err != nil {
+		t.Fatalf("failed to remove rule: %v", err)
+	}
+	if len(engine.GetRules()) != 0 {
+		t.Errorf("expected no rules after removal, got %d", len(engine.GetRules()))
+	}
+	if err := engine.RemoveRule("memory"); err == nil {
+		t.Error("expected removing an unknown rule to fail")
+	}
+}
+
+func TestGetRule(t *testing.T) {
+	engine := NewEngine()
+	if err := engine.AddRule("memory", `when heap.alloc > 100MB { alert("High memory") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+
+	rule, ok := engine.GetRule("memory")
+	if !ok || rule.Name != "memory" || rule.Source != `when heap.alloc > 100MB { alert("High memory") }` {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+	if _, ok := engine.GetRule("missing"); ok {
+		t.Error("expected unknown rule not to be found")
+	}
+
+	if err := engine.UpdateRule("memory", `when heap.alloc > 200MB { alert("High memory") }`); err != nil {
+		t.Fatalf("failed to update rule: %v", err)
+	}
+	if rule.Source != `when heap.alloc > 100MB { alert("High memory") }` {
+		t.Error("expected earlier lookup to be unaffected by the update")
+	}
+	if updated, _ := engine.GetRule("memory"); updated.Source != `when heap.alloc > 200MB { alert("High memory") }` {
+		t.Errorf("expected lookup to return the updated rule, got %q", updated.Source)
+	}
+}
+
+func TestSnapshotMetrics(t *testing.T) {
+	engine := NewEngine()
+	if err := engine.UpdateCustomMetric("queue_depth", 42); err != nil {
+		t.Fatalf("failed to update custom metric: %v", err)
+	}
+
+	snapshot := engine.SnapshotMetrics()
+	if snapshot["custom.queue_depth"] != 42 {
+		t.Errorf("expected custom metric in snapshot, got %v", snapshot["custom.queue_depth"])
+	}
+	for _, name := range []string{"heap.alloc", "goroutines.count", "gc.cpu_fraction", "http.error_rate", "uptime.seconds", "alerts.active_count"} {
+		if _, ok := snapshot[name]; !ok {
+			t.Errorf("expected %s in snapshot", name)
+		}
+	}
+
+	snapshot["custom.queue_depth"] = 0
+	if engine.SnapshotMetrics()["custom.queue_depth"] != 42 {
+		t.Error("expected each snapshot to be independent")
+	}
+}
+
+func TestRuntimeDistributionMetrics(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	runtime.GC()
+	engine.runtimeCollector.SetClock(clock.Real)
+
+	current := engine.GetRuntimeMetrics()
+	if current.HeapAlloc == 0 || current.Sys == 0 || current.NumGC == 0 || current.LastGC == 0 {
+		t.Errorf("expected memory and GC statistics from runtime/metrics, got %+v", current)
+	}
+	if current.GCPauseP99Ns == 0 || current.GCPauseP99Ns < current.GCPauseP50Ns {
+		t.Errorf("expected GC pause percentiles after a collection, got p50 %d p99 %d", current.GCPauseP50Ns, current.GCPauseP99Ns)
+	}
+	if current.SchedLatencyP99Ns < current.SchedLatencyP50Ns {
+		t.Errorf("expected p99 scheduler latency at least the median, got p50 %d p99 %d", current.SchedLatencyP50Ns, current.SchedLatencyP99Ns)
+	}
+
+	for _, source := range []string{"gc.heap_goal > 0", "gc.pause_p99 > 0", "gc.pause_p99 >= gc.pause_p50", "sched.latency_p99 >= 0"} {
+		if result := evalSource(t, engine, source); result != TRUE {
+			t.Errorf("%s: expected true, got %s", source, result.Inspect())
+		}
+	}
+	if result := evalSource(t, engine, "sched.unknown > 0"); !isError(result) {
+		t.Errorf("expected an unknown sched metric to fail, got %s", result.Inspect())
+	}
+	snapshot := engine.SnapshotMetrics()
+	for _, name := range []string{"gc.heap_goal", "gc.pause_p50", "gc.pause_p99", "sched.latency_p50", "sched.latency_p99"} {
+		if _, ok := snapshot[name]; !ok {
+			t.Errorf("expected %s in snapshot", name)
+		}
+	}
+	if err := engine.RegisterMetricProvider(&poolProvider{name: "sched"}); err == nil {
+		t.Error("expected sched to be a built-in namespace")
+	}
+}
+
+func TestHTTPExclusions(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{
+		DisableDashboard: true,
+		HTTPExclusions:   []metrics.HTTPExclusion{{Path: "/healthz"}},
+	})
+	engine.SetHTTPExclusions(append(engine.httpMetrics.GetExclusions(),
+		metrics.HTTPExclusion{Path: "/debug/*"},
+		metrics.HTTPExclusion{Method: http.MethodOptions},
+		metrics.HTTPExclusion{},
+	)...)
+
+	handled := 0
+	handler := engine.HTTPMiddleware()(func(w http.ResponseWriter, r *http.Request) {
+		handled++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	requests := []struct {
+		method, path string
+	}{
+		{http.MethodGet, "/healthz"},
+		{http.MethodGet, "/debug/pprof/heap"},
+		{http.MethodOptions, "/api/orders"},
+		{http.MethodGet, "/api/orders"},
+		{http.MethodPost, "/healthz/deep"},
+	}
+	for _, req := range requests {
+		handler(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	if handled != len(requests) {
+		t.Errorf("expected excluded requests to reach the handler, got %d of %d", handled, len(requests))
+	}
+	stats := engine.GetHTTPMetrics()
+	if stats.RequestCount != 2 || stats.ErrorCount != 2 {
+		t.Errorf("expected only the two unexcluded requests to be recorded, got %d requests and %d errors",
+			stats.RequestCount, stats.ErrorCount)
+	}
+
+	engine.SetHTTPExclusions()
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if got := engine.GetHTTPMetrics().RequestCount; got != 3 {
+		t.Errorf("expected requests to be recorded once exclusions are cleared, got %d", got)
+	}
+}
+
+func TestRequestSegments(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{
+		DisableDashboard: true,
+		Clock:            fake,
+		HTTPExclusions:   []metrics.HTTPExclusion{{Path: "/healthz"}},
+	})
+
+	// Measurements from deep in the call stack are summed per request
+	queryDB := func(ctx context.Context, d time.Duration) {
+		defer FromContext(ctx).Time("db")()
+		fake.Advance(d)
+	}
+	handler := engine.HTTPMiddleware()(func(w http.ResponseWriter, r *http.Request) {
+		queryDB(r.Context(), 100*time.Millisecond)
+		queryDB(r.Context(), 50*time.Millisecond)
+		FromContext(r.Context()).Add("cache_hits", 1)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+	handler = engine.HTTPMiddleware()(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Duration("db", 50*time.Millisecond)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	stats, ok := engine.GetSegmentStats("db")
+	if !ok || stats.RequestCount != 2 || stats.Average != 100 || stats.Max != 150 {
+		t.Errorf("expected db time averaged over two requests, got %+v", stats)
+	}
+	if result := evalSource(t, engine, "http.segment.db > 99ms && http.segment.cache_hits == 1"); result != TRUE {
+		t.Errorf("expected segments in rules, got %s", result.Inspect())
+	}
+	if result := evalSource(t, engine, "http.segment.unknown"); !isError(result) {
+		t.Errorf("expected an error for an unrecorded segment, got %s", result.Inspect())
+	}
+	if engine.SnapshotMetrics()["http.segment.db"] != 100 {
+		t.Error("expected segments in metric snapshots")
+	}
+
+	// Outside a recorded request the recorder discards measurements
+	FromContext(context.Background()).Add("cache_hits", 1)
+	FromContext(context.Background()).Time("db")()
+}
+
+func TestHTTPLatencyPercentiles(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake})
+
+	// One slow request hides in the average but not in the tail
+	for i := 1; i <= 100; i++ {
+		d := time.Duration(i) * time.Millisecond
+		if i == 100 {
+			d = 2 * time.Second
+		}
+		handler := engine.HTTPMiddleware()(func(w http.ResponseWriter, r *http.Request) {
+			fake.Advance(d)
+		})
+		handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+	}
+
+	within := func(got, want float64) bool { return math.Abs(got-want) <= want*0.04 }
+	stats := engine.GetHTTPMetrics()
+	for _, tt := range []struct {
+		name      string
+		got, want time.Duration
+	}{
+		{"p50", time.Duration(stats.P50ResponseTime), 50 * time.Millisecond},
+		{"p90", time.Duration(stats.P90ResponseTime), 90 * time.Millisecond},
+		{"p99", time.Duration(stats.P99ResponseTime), 99 * time.Millisecond},
+	} {
+		if !within(float64(tt.got), float64(tt.want)) {
+			t.Errorf("expected %s near %v, got %v", tt.name, tt.want, tt.got)
+		}
+	}
+	if result := evalSource(t, engine, "http.p95_response_time > 90ms && http.p99_response_time < 110ms"); result != TRUE {
+		t.Errorf("expected percentiles in rules, got %s", result.Inspect())
+	}
+	if p99 := engine.SnapshotMetrics()["http.p99_response_time"]; !within(p99, 99) {
+		t.Errorf("expected percentiles in metric snapshots in ms, got %v", p99)
+	}
+
+	// Percentiles only cover the last minute
+	fake.Advance(time.Minute)
+	if stats := engine.GetHTTPMetrics(); stats.P50ResponseTime != 0 || stats.P99ResponseTime != 0 {
+		t.Errorf("expected older requests to leave the percentiles, got %+v", stats)
+	}
+}
+
+func TestHTTPSizes(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake})
+
+	upload := engine.HTTPMiddleware()(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(bytes.Repeat(body, 100))
+	})
+	upload(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/upload", strings.NewReader("0123456789")))
+
+	// A body the handler ignores still counts at its declared length
+	ignore := engine.HTTPMiddleware()(func(w http.ResponseWriter, r *http.Request) {})
+	ignore(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/ignore", strings.NewReader(strings.Repeat("x", 30))))
+
+	stats := engine.GetHTTPMetrics()
+	if stats.RequestBytes != 40 || stats.ResponseBytes != 1000 || stats.AvgRequestSize != 20 || stats.AvgResponseSize != 500 {
+		t.Errorf("expected request and response sizes, got %+v", stats)
+	}
+	if result := evalSource(t, engine, "http.avg_response_size == 500 && http.bytes_per_second * 60 == 1040"); result != TRUE {
+		t.Errorf("expected sizes and bandwidth in rules, got %s", result.Inspect())
+	}
+
+	// Bytes count toward bandwidth while a response is still being written
+	streaming := engine.HTTPMiddleware()(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 6000))
+		if bandwidth := engine.GetHTTPMetrics().BytesPerSecond; bandwidth != 100 {
+			t.Errorf("expected in-flight bytes in the bandwidth, got %v", bandwidth)
+		}
+	})
+	fake.Advance(time.Minute) // Earlier requests leave the window
+	streaming(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/download", nil))
+}
+
+func TestHTTPMiddlewareNamed(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true})
+	engine.SetHTTPExclusions(metrics.HTTPExclusion{Path: "/healthz"})
+	public := engine.HTTPMiddleware()(func(w http.ResponseWriter, r *http.Request) {})
+	admin := engine.HTTPMiddlewareNamed("admin")(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).Add("audit_writes", 2)
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	if engine.HTTPMiddlewareNamed("admin") == nil || len(engine.GetHTTPServerNames()) != 1 {
+		t.Fatal("expected the same name to reuse the server's metrics")
+	}
+
+	for i := 0; i < 3; i++ {
+		public(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/orders", nil))
+	}
+	admin(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+	admin(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users?fail=1", nil))
+	admin(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		{"http.request_count", 3},
+		{"http.error_rate", 0},
+		{"http.admin.request_count", 2},
+		{"http.admin.error_rate", 50},
+		{"http.admin.segment.audit_writes", 2},
+	}
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if isError(result) {
+			t.Errorf("%s: unexpected error: %s", tt.source, result.Inspect())
+			continue
+		}
+		if value := engine.evaluator.objectToFloat(result); value != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.source, tt.expected, value)
+		}
+	}
+	for _, source := range []string{"http.admin.bogus", "http.admin.segment.missing", "http.public.request_count"} {
+		if result := evalSource(t, engine, source); !isError(result) {
+			t.Errorf("%s: expected an error, got %s", source, result.Inspect())
+		}
+	}
+
+	if snapshot := engine.SnapshotMetrics(); snapshot["http.admin.error_count"] != 1 || snapshot["http.request_count"] != 3 {
+		t.Errorf("expected both servers in the snapshot, got %v", snapshot)
+	}
+
+	for _, name := range []string{"segment", "admin.v2", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected HTTPMiddlewareNamed(%q) to panic", name)
+				}
+			}()
+			engine.HTTPMiddlewareNamed(name)
+		}()
+	}
+}
+
+func TestHTTPBreakdown(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true})
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/transfer", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})
+	handler := engine.HTTPMiddleware()(mux.ServeHTTP)
+	serve := func(method, target string) {
+		handler(httptest.NewRecorder(), httptest.NewRequest(method, target, nil))
+	}
+	for i := 0; i < 3; i++ {
+		serve(http.MethodPost, "/api/transfer")
+	}
+	serve(http.MethodPost, "/api/transfer?fail=1")
+	serve(http.MethodGet, "/api/orders/42") // unmatched, labelled by its normalized path
+	serve(http.MethodGet, "/api/orders/43")
+	serve("PURGE", "/cache")
+
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		{`http.route("POST /api/transfer").request_count`, 4},
+		{`http.route("POST /api/transfer").error_rate`, 25},
+		{`http.route("/api/orders/:id").error_rate`, 100},
+		{`http.method("post").request_count`, 4},
+		{`http.method("PURGE").request_count`, 1}, // counted as OTHER
+		{"http.status_2xx", 3},
+		{"http.status_4xx", 3},
+		{"http.status_5xx", 1},
+	}
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if got := engine.evaluator.objectToFloat(result); isError(result) || got != tt.expected {
+			t.Errorf("%q: expected %v, got %s", tt.source, tt.expected, result.Inspect())
+		}
+	}
+
+	breakdown := engine.GetHTTPBreakdown()
+	if len(breakdown.Routes) != 3 || breakdown.Routes[0].Route != "POST /api/transfer" || breakdown.StatusClasses["4xx"] != 3 {
+		t.Errorf("unexpected breakdown %+v", breakdown)
+	}
+
+	// Routes that are not labels are tracked as path patterns, as in route()
+	engine.SetRouteLabeler(func(r *http.Request) string { return "" })
+	serve(http.MethodGet, "/api/orders/44")
+	if result := evalSource(t, engine, `http.route("/api/orders/*").request_count`); engine.evaluator.objectToFloat(result) != 0 {
+		t.Errorf("expected a newly tracked pattern to start empty, got %s", result.Inspect())
+	}
+	serve(http.MethodGet, "/api/orders/45")
+	if result := evalSource(t, engine, `http.route("/api/orders/*").request_count`); engine.evaluator.objectToFloat(result) != 1 {
+		t.Errorf("expected the pattern to count new requests, got %s", result.Inspect())
+	}
+	if len(engine.GetHTTPBreakdown().Routes) != 0 {
+		t.Error("expected labels to be cleared with the labeler")
+	}
+
+	for _, source := range []string{
+		`when http.route("/api").latency > 1 { log("x") }`,
+		`when http.route("/api", "p99").p99 > 1 { log("x") }`,
+		`when http.path("/api").p99 > 1 { log("x") }`,
+	} {
+		if err := engine.AddRule("invalid", source); err == nil {
+			t.Errorf("expected %q to be rejected", source)
+		}
+	}
+	if err := engine.AddRule("transfer_errors", `when http.route("/api/transfer").error_rate > 5 { alert("Transfers failing") }`); err != nil {
+		t.Errorf("expected a valid breakdown rule: %v", err)
+	}
+}
+
+func TestEmitEvent(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true})
+	data := map[string]interface{}{"order_id": "A-17"}
+	engine.EmitEvent("order_failed", "Payment declined", data)
+	data["order_id"] = "changed"
+
+	events := engine.GetEventHistory(0, "order_failed")
+	if len(events) != 1 {
+		t.Fatalf("expected one application event, got %d", len(events))
+	}
+	if events[0].Message != "Payment declined" || events[0].RuleName != "" || events[0].Data["order_id"] != "A-17" {
+		t.Errorf("unexpected event: %+v", events[0])
+	}
+}
+
+func TestQueryEvents(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true})
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, event := range []struct{ eventType, rule string }{
+		{"rule_trigger", "memory"},
+		{"alert", "memory"},
+		{"alert", "gc"},
+		{"log", "gc"},
+		{"order_failed", ""},
+	} {
+		engine.RecordEvent(event.eventType, event.rule, fmt.Sprintf("event %d", i), nil)
+		engine.eventHistory[i].Timestamp = start.Add(time.Duration(i) * time.Minute)
+	}
+
+	messages := func(events []EventRecord) string {
+		var out []string
+		for _, event := range events {
+			out = append(out, event.Message)
+		}
+		return strings.Join(out, ",")
+	}
+	queries := []struct {
+		query    EventQuery
+		expected string
+	}{
+		{EventQuery{}, "event 4,event 3,event 2,event 1,event 0"},
+		{EventQuery{Types: []string{"alert", "log"}}, "event 3,event 2,event 1"},
+		{EventQuery{Rule: "memory"}, "event 1,event 0"},
+		{EventQuery{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, "event 2,event 1"},
+		{EventQuery{Types: []string{"alert"}, Limit: 1}, "event 2"},
+		{EventQuery{Rule: "missing"}, ""},
+	}
+	for _, q := range queries {
+		if got := messages(engine.QueryEvents(q.query)); got != q.expected {
+			t.Errorf("QueryEvents(%+v) = %q, want %q", q.query, got, q.expected)
+		}
+	}
+
+	if got := messages(engine.GetEventHistory(2, "")); got != "event 4,event 3" {
+		t.Errorf("unexpected GetEventHistory result: %q", got)
+	}
+	if events := engine.QueryEvents(EventQuery{Rule: "missing"}); events == nil {
+		t.Error("expected an empty, non-nil result")
+	}
+}
+
+func TestMultipleWhenStatements(t *testing.T) {
+	engine := NewEngine()
+	source := `const LIMIT = 0
+when heap.alloc > LIMIT { log("heap in use") }
+when goroutines.count > LIMIT { log("goroutines running") }
+when heap.alloc < LIMIT { log("never") }`
+	names, err := engine.AddRules("runtime", source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(names, ",") != "runtime#1,runtime#2,runtime#3" {
+		t.Fatalf("unexpected rule names: %v", names)
+	}
+	if rule := engine.GetRules()[1]; rule.Source != `when goroutines.count > LIMIT { log("goroutines running") }` {
+		t.Errorf("unexpected source for %s: %q", rule.Name, rule.Source)
+	}
+
+	if err := engine.SetRuleEnabled("runtime#2", false); err != nil {
+		t.Fatalf("failed to disable rule: %v", err)
+	}
+	engine.EvaluateRules()
+
+	rules := engine.GetRules()
+	if rules[0].LastTrigger.IsZero() || !rules[1].LastTrigger.IsZero() || !rules[2].LastTrigger.IsZero() {
+		t.Errorf("expected only the enabled matching rule to trigger")
+	}
+	if _, ok := engine.GetRuleAvailability("runtime#2"); ok {
+		t.Error("expected disabled rule not to be evaluated")
+	}
+	if err := engine.SetRuleEnabled("runtime", true); err == nil {
+		t.Error("expected enabling an unknown rule to fail")
+	}
+
+	// A single when-statement keeps the given name
+	if err := engine.AddRule("single", `when heap.alloc > 0 { log("x") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	if err := engine.RemoveRule("single"); err != nil {
+		t.Errorf("expected single rule to be addressable by name: %v", err)
+	}
+}
+
+func TestDisableRule(t *testing.T) {
+	engine := NewEngine()
+	if err := engine.AddRule("heap", `when heap.alloc > 0 { log("heap in use") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	engine.EvaluateRules()
+	triggered := engine.GetRules()[0].LastTrigger
+	if triggered.IsZero() {
+		t.Fatal("expected rule to trigger")
+	}
+
+	if err := engine.DisableRule("heap"); err != nil {
+		t.Fatalf("failed to disable rule: %v", err)
+	}
+	engine.EvaluateRules()
+	rule := engine.GetRules()[0]
+	if rule.Enabled() || !rule.LastTrigger.Equal(triggered) || rule.Source == "" {
+		t.Errorf("expected disabled rule to keep its source and history without triggering, got %+v", rule)
+	}
+
+	if err := engine.EnableRule("heap"); err != nil {
+		t.Fatalf("failed to enable rule: %v", err)
+	}
+	engine.EvaluateRules()
+	if rule := engine.GetRules()[0]; !rule.Enabled() || !rule.LastTrigger.After(triggered) {
+		t.Error("expected re-enabled rule to trigger again")
+	}
+	if err := engine.DisableRule("missing"); err == nil {
+		t.Error("expected disabling an unknown rule to fail")
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.AddRule("new_alert", `when heap.alloc > 0 { set_metric("custom.fired", 1) }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	if err := engine.SetRuleDryRun("new_alert", true); err != nil {
+		t.Fatalf("failed to enable dry run: %v", err)
+	}
+	engine.EvaluateRules()
+
+	if _, fired := engine.GetCustomMetric("fired"); fired {
+		t.Error("expected dry-run rule not to run its actions")
+	}
+	if rule := engine.GetRules()[0]; !rule.LastTrigger.IsZero() {
+		t.Error("expected dry-run rule not to record a trigger")
+	}
+	if events := engine.GetEventHistory(0, "rule_dry_run"); len(events) != 1 || events[0].RuleName != "new_alert" {
+		t.Errorf("expected a rule_dry_run event, got %+v", events)
+	}
+	if events := engine.GetEventHistory(0, "rule_trigger"); len(events) != 0 {
+		t.Errorf("expected no rule_trigger events, got %+v", events)
+	}
+	if stats := engine.GetRuleStats()[0]; stats.Triggers != 1 {
+		t.Errorf("expected dry-run triggers to be counted, got %+v", stats)
+	}
+
+	// Dry-run mode survives updates, and promoting the rule runs its actions
+	if err := engine.UpdateRule("new_alert", `when heap.alloc > 1 { set_metric("custom.fired", 1) }`); err != nil {
+		t.Fatalf("failed to update rule: %v", err)
+	}
+	if !engine.GetRules()[0].DryRun {
+		t.Error("expected dry-run mode to survive an update")
+	}
+	if err := engine.SetRuleDryRun("new_alert", false); err != nil {
+		t.Fatal(err)
+	}
+	engine.EvaluateRules()
+	if _, fired := engine.GetCustomMetric("fired"); !fired {
+		t.Error("expected promoted rule to run its actions")
+	}
+
+	// Engine-wide dry run covers every rule
+	engine.SetDryRun(true)
+	engine.EvaluateRules()
+	if !engine.IsDryRun() || len(engine.GetEventHistory(0, "rule_dry_run")) != 2 {
+		t.Error("expected engine-wide dry run to report instead of triggering")
+	}
+	if err := engine.SetRuleDryRun("missing", true); err == nil {
+		t.Error("expected dry run of an unknown rule to fail")
+	}
+}
+
+// Rules are replaced rather than modified in place, so toggling one while the
+// evaluation loop records its trigger and evaluation times does not race
+func TestRuleUpdatesDuringEvaluation(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.AddRule("busy", `when heap.alloc > 0 { log("busy") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			engine.SetRuleDryRun("busy", i%2 == 0)
+			engine.SetRuleEnabled("busy", true)
+			engine.GetRules()[0].LastTrigger.IsZero()
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		engine.EvaluateRules()
+	}
+	wg.Wait()
+
+	engine.EvaluateRules()
+	if rule, _ := engine.GetRule("busy"); rule.DryRun || rule.LastTrigger.IsZero() {
+		t.Error("expected the rule to have triggered")
+	}
+}
+
+func TestRuleImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"common/units.dscr":      `const MB_LIMIT = 1MB`,
+		"common/thresholds.dscr": "import \"common/units.dscr\"\nconst HIGH_MEM = MB_LIMIT * 2",
+		"memory.dscr": `import "common/thresholds.dscr"
+import "common/units.dscr"
+when 3MB > HIGH_MEM { log("over") }
+when 1.5MB > HIGH_MEM { log("under") }`,
+		"cycle_a.dscr":    `import "cycle_b.dscr"`,
+		"cycle_b.dscr":    `import "cycle_a.dscr"`,
+		"self.dscr":       "import \"self.dscr\"\nwhen heap.alloc > 0 { log(\"x\") }",
+		"rules.dscr":      `when heap.alloc > 0 { log("not shareable") }`,
+		"bad_rule.dscr":   "import \"rules.dscr\"\nwhen heap.alloc > 0 { log(\"x\") }",
+		"escape.dscr":     "import \"../outside.dscr\"\nwhen heap.alloc > 0 { log(\"x\") }",
+		"uses_cycle.dscr": "import \"cycle_a.dscr\"\nwhen heap.alloc > 0 { log(\"x\") }",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	engine := NewEngine()
+	if _, err := engine.AddRuleFile(filepath.Join(dir, "memory.dscr")); err != nil {
+		t.Fatalf("failed to load rules with imports: %v", err)
+	}
+	rules := engine.GetRules()
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+	if result := engine.evaluator.Eval(rules[0].AST); result != RULE_TRIGGERED {
+		t.Errorf("expected imported constant to be usable, got %s", result.Inspect())
+	}
+	if result := engine.evaluator.Eval(rules[1].AST); result != NULL {
+		t.Errorf("expected rule below the imported threshold not to trigger, got %s", result.Inspect())
+	}
+
+	failures := map[string]string{
+		"uses_cycle.dscr": "import cycle: cycle_a.dscr -> cycle_b.dscr -> cycle_a.dscr",
+		"self.dscr":       "import cycle: self.dscr -> self.dscr",
+		"bad_rule.dscr":   "only const, let and import statements",
+		"escape.dscr":     "leaves the rules directory",
+	}
+	for name, expected := range failures {
+		_, err := engine.AddRuleFile(filepath.Join(dir, name))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected error containing %q, got %v", name, expected, err)
+		}
+	}
+
+	// RulesDir anchors imports for rules added from strings
+	rooted := NewEngineWithConfig(EngineConfig{RulesDir: dir})
+	if err := rooted.AddRule("inline", `import "common/thresholds.dscr"
+when 3MB > HIGH_MEM { log("over") }`); err != nil {
+		t.Errorf("expected import relative to RulesDir to resolve: %v", err)
+	}
+}
+
+func TestEvaluationWorkers(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, EvaluationWorkers: 4, Logger: log.New(io.Discard, "", 0)})
+	for i := 0; i < 20; i++ {
+		rule := fmt.Sprintf(`when heap.alloc > 0 { log("rule %d") }`, i)
+		if err := engine.AddRule(fmt.Sprintf("rule_%d", i), rule); err != nil {
+			t.Fatalf("failed to add rule %d: %v", i, err)
+		}
+	}
+
+	engine.EvaluateRules()
+	for _, stats := range engine.GetRuleStats() {
+		if stats.Evaluations != 1 || stats.Triggers != 1 || stats.Errors != 0 {
+			t.Errorf("expected one triggered evaluation of %s, got %+v", stats.Rule, stats)
+		}
+	}
+
+	// Evaluations past their deadline stop and count as timeouts
+	limits := engine.GetResourceLimits()
+	limits.MaxEvaluationTime = time.Nanosecond
+	engine.SetResourceLimits(limits)
+	engine.EvaluateRules()
+	for _, stats := range engine.GetRuleStats() {
+		if stats.Evaluations != 2 || stats.Timeouts != 1 || stats.Triggers != 1 {
+			t.Errorf("expected a timed out evaluation of %s, got %+v", stats.Rule, stats)
+		}
+	}
+}
+
+func TestUpdateCustomMetrics(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake, MetricHistorySize: 3})
+	limits := engine.GetResourceLimits()
+	limits.MaxCustomMetrics = 3
+	engine.SetResourceLimits(limits)
+
+	if err := engine.UpdateCustomMetrics(map[string]float64{"orders": 1, "queue": 5}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i <= 5; i++ {
+		fake.Advance(time.Second)
+		if err := engine.UpdateCustomMetrics(map[string]float64{"orders": float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if value, _ := engine.GetCustomMetric("orders"); value != 5 {
+		t.Errorf("expected orders = 5, got %v", value)
+	}
+	if value, _ := engine.GetCustomMetric("queue"); value != 5 {
+		t.Errorf("expected queue = 5, got %v", value)
+	}
+
+	// History keeps the newest samples, oldest first
+	history := engine.getCustomMetricHistory("orders", time.Hour)
+	if len(history) != 3 || history[0].Value != 3 || history[2].Value != 5 {
+		t.Errorf("expected the last 3 samples of orders, got %+v", history)
+	}
+
+	// A batch that would exceed the limit is rejected as a whole
+	if err := engine.UpdateCustomMetrics(map[string]float64{"orders": 6, "a": 1, "b": 2}); err == nil {
+		t.Error("expected a batch over the metric limit to fail")
+	}
+	if _, exists := engine.GetCustomMetric("a"); exists {
+		t.Error("expected a rejected batch to add no metric")
+	}
+	if value, _ := engine.GetCustomMetric("orders"); value != 5 {
+		t.Errorf("expected a rejected batch to update nothing, got orders = %v", value)
+	}
+	if err := engine.UpdateCustomMetrics(map[string]float64{"orders": 6, "a": 1}); err != nil {
+		t.Errorf("expected a batch within the limit to succeed: %v", err)
+	}
+	if err := engine.UpdateCustomMetric("b", 1); err == nil {
+		t.Error("expected a single update over the metric limit to fail")
+	}
+}
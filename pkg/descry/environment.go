@@ -0,0 +1,36 @@
+package descry
+
+// Environment holds the let-bindings visible while a rule is evaluated.
+// Each block gets an enclosed environment so bindings made inside a rule
+// body do not leak out of it.
+type Environment struct {
+	store map[string]Object
+	outer *Environment
+}
+
+// NewEnvironment creates an empty top-level environment
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object)}
+}
+
+// NewEnclosedEnvironment creates an environment whose lookups fall back to outer
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+// Get looks up a binding in this environment and its enclosing ones
+func (env *Environment) Get(name string) (Object, bool) {
+	obj, ok := env.store[name]
+	if !ok && env.outer != nil {
+		return env.outer.Get(name)
+	}
+	return obj, ok
+}
+
+// Set binds name to val in this environment
+func (env *Environment) Set(name string, val Object) Object {
+	env.store[name] = val
+	return val
+}
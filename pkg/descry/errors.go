@@ -0,0 +1,74 @@
+package descry
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/chosenoffset/descry/pkg/descry/parser"
+)
+
+// Errors returned by the engine API wrap these sentinels, so callers can
+// branch on the cause with errors.Is instead of matching messages:
+//
+//	if err := engine.AddRule("memory", source); errors.Is(err, descry.ErrRuleExists) {
+//		err = engine.UpdateRule("memory", source)
+//	}
+var (
+	// ErrRuleExists is returned when a rule is added under a name in use
+	ErrRuleExists = errors.New("rule already exists")
+	// ErrRuleNotFound is returned by operations on a rule name not in use
+	ErrRuleNotFound = errors.New("rule not found")
+	// ErrRuleGroupNotFound is returned by operations on an unknown rule group
+	ErrRuleGroupNotFound = errors.New("rule group not found")
+	// ErrLimitExceeded matches every *LimitError and *ResourceLimitError
+	ErrLimitExceeded = errors.New("limit exceeded")
+)
+
+// ParseError is a syntax error at a line and column of a rule's source.
+// Rules that fail to parse return a parser.ParseErrors holding one per
+// error, and errors.As finds the first:
+//
+//	var parseErr *descry.ParseError
+//	if errors.As(err, &parseErr) {
+//		editor.Mark(parseErr.Line, parseErr.Column)
+//	}
+type ParseError = parser.ParseError
+
+// LimitKind names the ResourceLimits setting a LimitError refers to
+type LimitKind string
+
+const (
+	// LimitRules is MaxRules
+	LimitRules LimitKind = "rules"
+	// LimitCustomMetrics is MaxCustomMetrics
+	LimitCustomMetrics LimitKind = "custom_metrics"
+	// LimitRuleComplexity is MaxRuleComplexity
+	LimitRuleComplexity LimitKind = "rule_complexity"
+)
+
+// LimitError reports an operation refused because it would exceed one of
+// the engine's ResourceLimits. It matches ErrLimitExceeded with errors.Is.
+// Limits hit while a rule is evaluated are reported as ResourceLimitError.
+type LimitError struct {
+	Kind  LimitKind
+	Limit int
+	// Rule and Value are the rule and its node count, for LimitRuleComplexity
+	Rule  string
+	Value int
+}
+
+func (e *LimitError) Error() string {
+	switch e.Kind {
+	case LimitRuleComplexity:
+		return fmt.Sprintf("rule %s complexity (%d nodes) exceeds limit (%d)", e.Rule, e.Value, e.Limit)
+	case LimitCustomMetrics:
+		return fmt.Sprintf("maximum number of custom metrics exceeded (%d)", e.Limit)
+	default:
+		return fmt.Sprintf("maximum number of %s exceeded (%d)", e.Kind, e.Limit)
+	}
+}
+
+// Is reports whether target is ErrLimitExceeded
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
@@ -0,0 +1,71 @@
+package descry
+
+import (
+	"errors"
+	"io"
+	"log"
+	"testing"
+)
+
+func TestTypedErrors(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	rule := `when heap.alloc > 0 { log("test") }`
+	if err := engine.AddRule("memory", rule); err != nil {
+		t.Fatalf("Failed to add rule: %v", err)
+	}
+
+	err := engine.AddRule("memory", rule)
+	if !errors.Is(err, ErrRuleExists) || err.Error() != "rule already exists: memory" {
+		t.Errorf("expected ErrRuleExists naming the rule, got %v", err)
+	}
+	for _, err := range []error{
+		engine.UpdateRule("missing", rule),
+		engine.RemoveRule("missing"),
+		engine.SetRuleEnabled("missing", false),
+		engine.SetRuleDryRun("missing", true),
+	} {
+		if !errors.Is(err, ErrRuleNotFound) {
+			t.Errorf("expected ErrRuleNotFound, got %v", err)
+		}
+	}
+	if err := engine.RemoveRuleGroup("missing"); !errors.Is(err, ErrRuleGroupNotFound) {
+		t.Errorf("expected ErrRuleGroupNotFound, got %v", err)
+	}
+
+	// Parse errors carry their position
+	err = engine.AddRule("broken", "when heap.alloc > 0 {\n  log(\"x\")\n")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Line != 3 {
+		t.Errorf("expected a ParseError on line 3, got %v", err)
+	}
+
+	// Limit errors match ErrLimitExceeded and report which limit
+	limits := engine.GetResourceLimits()
+	limits.MaxRules = 1
+	limits.MaxCustomMetrics = 1
+	engine.SetResourceLimits(limits)
+	var limitErr *LimitError
+	err = engine.AddRule("second", rule)
+	if !errors.Is(err, ErrLimitExceeded) || !errors.As(err, &limitErr) || limitErr.Kind != LimitRules || limitErr.Limit != 1 {
+		t.Errorf("expected a LimitError for MaxRules, got %v", err)
+	}
+	if err := engine.UpdateCustomMetric("first", 1); err != nil {
+		t.Fatalf("Failed to update custom metric: %v", err)
+	}
+	err = engine.UpdateCustomMetric("second", 1)
+	if !errors.As(err, &limitErr) || limitErr.Kind != LimitCustomMetrics {
+		t.Errorf("expected a LimitError for MaxCustomMetrics, got %v", err)
+	}
+
+	limits.MaxRules = 10
+	limits.MaxRuleComplexity = 3
+	engine.SetResourceLimits(limits)
+	err = engine.AddRule("complex", rule)
+	if !errors.As(err, &limitErr) || limitErr.Kind != LimitRuleComplexity || limitErr.Rule != "complex" || limitErr.Value <= 3 {
+		t.Errorf("expected a LimitError for MaxRuleComplexity, got %v", err)
+	}
+
+	if !errors.Is(&ResourceLimitError{Resource: "memory"}, ErrLimitExceeded) {
+		t.Error("expected ResourceLimitError to match ErrLimitExceeded")
+	}
+}
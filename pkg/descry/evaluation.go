@@ -0,0 +1,241 @@
+package descry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+// resourceCheckInterval is how often in-flight evaluations are checked
+// against their memory and CPU limits
+const resourceCheckInterval = 10 * time.Millisecond
+
+// resourceMonitor checks the resource trackers of in-flight evaluations. One
+// monitor serves a whole evaluation cycle: each tick takes a single memory
+// and CPU reading and checks every tracker against it, instead of each
+// evaluation polling on its own ticker.
+type resourceMonitor struct {
+	mutex    sync.Mutex
+	trackers map[*ResourceTracker]struct{}
+	latest   resourceSample
+}
+
+func newResourceMonitor() *resourceMonitor {
+	return &resourceMonitor{
+		trackers: make(map[*ResourceTracker]struct{}),
+		latest:   sampleResources(),
+	}
+}
+
+// track creates a tracker for one evaluation and starts checking it. Its
+// memory budget starts at the monitor's latest reading, at most one check
+// interval old.
+func (m *resourceMonitor) track(ctx context.Context, limits *ResourceLimits) *ResourceTracker {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	tracker := newResourceTrackerFrom(ctx, limits.MaxMemoryUsage, limits.MaxCPUTime, m.latest.alloc)
+	m.trackers[tracker] = struct{}{}
+	return tracker
+}
+
+// untrack stops checking tracker
+func (m *resourceMonitor) untrack(tracker *ResourceTracker) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.trackers, tracker)
+}
+
+// run checks tracked evaluations every resourceCheckInterval until stop is
+// closed
+func (m *resourceMonitor) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(resourceCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// check takes one reading and checks every tracked evaluation against it
+func (m *resourceMonitor) check() {
+	m.mutex.Lock()
+	if len(m.trackers) == 0 {
+		m.mutex.Unlock()
+		return
+	}
+	m.mutex.Unlock()
+
+	sample := sampleResources()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.latest = sample
+	for tracker := range m.trackers {
+		tracker.checkSample(sample)
+	}
+}
+
+// runEvaluations evaluates rules on the engine's evaluation workers and
+// returns when all of them have finished. Cycles run one at a time.
+func (e *Engine) runEvaluations(rules []*Rule) {
+	if len(rules) == 0 {
+		return
+	}
+
+	e.evaluationMutex.Lock()
+	defer e.evaluationMutex.Unlock()
+
+	monitor := newResourceMonitor()
+	stop := make(chan struct{})
+	monitorDone := make(chan struct{})
+	go func() {
+		defer close(monitorDone)
+		monitor.run(stop)
+	}()
+	defer func() {
+		close(stop)
+		<-monitorDone
+	}()
+
+	workers := e.config.EvaluationWorkers
+	if workers > len(rules) {
+		workers = len(rules)
+	}
+	if workers <= 1 {
+		for _, rule := range rules {
+			e.evaluateRuleWith(e.evaluator, monitor, rule)
+		}
+		return
+	}
+
+	jobs := make(chan *Rule)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		evaluator := e.workerEvaluator(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rule := range jobs {
+				e.evaluateRuleWith(evaluator, monitor, rule)
+			}
+		}()
+	}
+	for _, rule := range rules {
+		jobs <- rule
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// workerEvaluator returns the evaluator of worker i. The first worker uses
+// the engine's evaluator; the rest are created on first use. The caller
+// must hold evaluationMutex.
+func (e *Engine) workerEvaluator(i int) *Evaluator {
+	if i == 0 {
+		return e.evaluator
+	}
+	for len(e.workerEvaluators) < i {
+		e.workerEvaluators = append(e.workerEvaluators, NewEvaluator(e))
+	}
+	return e.workerEvaluators[i-1]
+}
+
+// evaluateRule evaluates a single rule outside the evaluation loop
+func (e *Engine) evaluateRule(rule *Rule) {
+	e.runEvaluations([]*Rule{rule})
+}
+
+// evaluateRuleWith evaluates rule on evaluator in the calling goroutine. The
+// evaluation stops at its next step once MaxEvaluationTime passes or monitor
+// finds it over a resource limit.
+func (e *Engine) evaluateRuleWith(evaluator *Evaluator, monitor *resourceMonitor, rule *Rule) {
+	start := time.Now()
+	dryRun := rule.DryRun || e.IsDryRun()
+	recordStats := func(outcome ruleOutcome, err error) {
+		now := time.Now()
+		e.ruleStats.record(rule.Name, outcome, now.Sub(start), now, err)
+		if outcome == outcomeHealthy || outcome == outcomeTriggered {
+			e.recordRuleState(rule, outcome == outcomeTriggered)
+		}
+	}
+
+	// Create context with timeout for evaluation
+	ctx, cancel := context.WithTimeout(context.Background(), e.limits.MaxEvaluationTime)
+	defer cancel()
+
+	tracker := monitor.track(ctx, e.limits)
+	defer tracker.Cancel()
+
+	result, actionResults, err := evaluateSafely(evaluator, tracker.Context(), rule, dryRun)
+	monitor.untrack(tracker)
+
+	switch {
+	case tracker.limitViolation() != nil:
+		err := tracker.limitViolation()
+		e.logResourceLimit("Rule evaluation resource limit exceeded", rule.Name, err, tracker)
+		e.recordLimitEvent(rule.Name, err)
+		recordStats(outcomeError, err)
+	case ctx.Err() != nil:
+		e.logError(RuleErrorTimeout, "Rule evaluation timeout", rule.Name, ctx.Err(), tracker)
+		e.recordLimitEvent(rule.Name, ctx.Err())
+		recordStats(outcomeTimeout, ctx.Err())
+	case err != nil:
+		e.logError(RuleErrorEvaluation, "Rule evaluation error", rule.Name, err, tracker)
+		recordStats(outcomeError, err)
+	default:
+		recordStats(e.handleEvaluationResult(rule, dryRun, result, actionResults, tracker))
+	}
+}
+
+// recordLimitEvent raises a LimitAction for an evaluation of ruleName stopped
+// by a resource limit or MaxEvaluationTime, naming the resource and its limit
+// in the action details. Like a rule's actions it reaches the event history
+// and dashboard as a "limit" event, and any handlers and routes for it. Rules
+// that hit a limit stay enabled, so there is no event for disabling one.
+func (e *Engine) recordLimitEvent(ruleName string, err error) {
+	data := map[string]interface{}{"error": err.Error()}
+	var limitErr *ResourceLimitError
+	if errors.As(err, &limitErr) {
+		data["resource"] = limitErr.Resource
+		data["current"] = limitErr.Current
+		data["limit"] = limitErr.Limit
+	} else {
+		data["resource"] = "evaluation_time"
+		data["limit"] = e.limits.MaxEvaluationTime.String()
+	}
+	message := fmt.Sprintf("Rule %s stopped at its %s limit", ruleName, data["resource"])
+	action := e.actionRegistry.CreateAction(actions.LimitAction, message, ruleName)
+	action.Severity = "medium"
+	action.Tags = e.ruleLabels(ruleName)
+	action.Details = data
+	if err := e.actionRegistry.ExecuteAction(action); err != nil {
+		e.log().Warn("Limit action failed", slog.String("rule", ruleName), slog.Any("error", err))
+	}
+}
+
+// evaluateSafely runs rule on evaluator, converting a panic into an error
+func evaluateSafely(evaluator *Evaluator, ctx context.Context, rule *Rule, dryRun bool) (result interface{}, actionResults []ActionResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			evaluator.engine.recovered("rule "+rule.Name, r)
+			err = fmt.Errorf("panic during rule evaluation: %v", r)
+		}
+	}()
+
+	// Set current rule name for action handlers
+	evaluator.SetCurrentRuleName(rule.Name)
+	evaluator.setDryRun(dryRun)
+
+	result = evaluator.EvalWithContext(ctx, rule.AST)
+	return result, evaluator.ActionResults(), nil
+}
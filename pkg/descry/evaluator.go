@@ -3,6 +3,9 @@ package descry
 import (
 	"context"
 	"fmt"
+	"math"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -80,11 +83,35 @@ type Evaluator struct {
 	engine          *Engine
 	mutex           sync.RWMutex
 	currentRuleName string
+	env             *Environment
+	actionResults   []ActionResult
+	regexMutex      sync.Mutex
+	regexCache      map[string]*regexp.Regexp
+	now             func() time.Time // clock used by during clauses and event()
+	eventWindow     time.Duration    // within clause of the condition being evaluated
+	dryRun          bool             // skip rule bodies; see Engine.SetRuleDryRun
+	simulation      metricOverrides  // synthetic or recorded metric values; see Engine.Simulate and Engine.ReplayCapture
+}
+
+// maxRegexCacheSize bounds the number of compiled patterns kept for matches
+const maxRegexCacheSize = 256
+
+// ActionResult records the outcome of one statement in a triggered rule body.
+// Rule bodies run every statement in order even when an earlier one fails, so
+// a failing webhook does not prevent the log or metric update that follows it.
+type ActionResult struct {
+	// Action is the function called (alert, log, ...) or "let" for bindings
+	Action string `json:"action"`
+	// Success is false when the statement returned an error
+	Success bool `json:"success"`
+	// Error describes the failure, if any
+	Error string `json:"error,omitempty"`
 }
 
 func NewEvaluator(engine *Engine) *Evaluator {
 	return &Evaluator{
 		engine: engine,
+		now:    engine.clock.Now,
 	}
 }
 
@@ -94,12 +121,53 @@ func (e *Evaluator) SetCurrentRuleName(name string) {
 	e.currentRuleName = name
 }
 
+// setDryRun controls whether triggered rules run their bodies
+func (e *Evaluator) setDryRun(dryRun bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.dryRun = dryRun
+}
+
+func (e *Evaluator) isDryRun() bool {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.dryRun
+}
+
 func (e *Evaluator) getCurrentRuleName() string {
 	e.mutex.RLock()
 	defer e.mutex.RUnlock()
 	return e.currentRuleName
 }
 
+func (e *Evaluator) getEnv() *Environment {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.env
+}
+
+func (e *Evaluator) setEnv(env *Environment) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.env = env
+}
+
+// ActionResults returns the per-statement results of rule bodies executed
+// during the most recent evaluation of a program
+func (e *Evaluator) ActionResults() []ActionResult {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	results := make([]ActionResult, len(e.actionResults))
+	copy(results, e.actionResults)
+	return results
+}
+
+func (e *Evaluator) recordActionResult(result ActionResult) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.actionResults = append(e.actionResults, result)
+}
+
 func (e *Evaluator) Eval(node parser.Node) Object {
 	// Use background context for backward compatibility
 	return e.EvalWithContext(context.Background(), node)
@@ -121,12 +189,34 @@ func (e *Evaluator) EvalWithContext(ctx context.Context, node parser.Node) Objec
 	case *parser.WhenStatement:
 		return e.evalWhenStatementWithContext(ctx, node)
 
+	case *parser.LetStatement:
+		return e.evalLetStatementWithContext(ctx, node)
+
+	case *parser.ConstStatement:
+		return e.evalConstStatementWithContext(ctx, node)
+
+	case *parser.ImportStatement:
+		// The engine replaces imports with the imported statements
+		return newError("unresolved import: %s", node.Path.Value)
+
 	case *parser.ExpressionStatement:
 		return e.EvalWithContext(ctx, node.Expression)
 
 	case *parser.BlockStatement:
 		return e.evalBlockStatementWithContext(ctx, node.Statements)
 
+	case *parser.RuleStatement:
+		// The engine registers rule blocks separately; when evaluated inline
+		// they behave like a block
+		return e.evalBlockStatementWithContext(ctx, node.Body.Statements)
+
+	case *parser.PrefixExpression:
+		right := e.EvalWithContext(ctx, node.Right)
+		if isError(right) {
+			return right
+		}
+		return e.evalPrefixExpression(node.Operator, right)
+
 	case *parser.InfixExpression:
 		left := e.EvalWithContext(ctx, node.Left)
 		if isError(left) {
@@ -141,6 +231,9 @@ func (e *Evaluator) EvalWithContext(ctx context.Context, node parser.Node) Objec
 	case *parser.DotExpression:
 		return e.evalDotExpression(node)
 
+	case *parser.LabelSelector:
+		return e.evalLabelSelector(node)
+
 	case *parser.CallExpression:
 		return e.evalCallExpression(node)
 
@@ -153,6 +246,9 @@ func (e *Evaluator) EvalWithContext(ctx context.Context, node parser.Node) Objec
 	case *parser.FloatLiteral:
 		return &Float{Value: node.Value}
 
+	case *parser.Boolean:
+		return nativeBoolToPyObject(node.Value)
+
 	case *parser.StringLiteral:
 		return &String{Value: node.Value}
 
@@ -181,6 +277,13 @@ func (e *Evaluator) evalProgram(stmts []parser.Statement) Object {
 func (e *Evaluator) evalProgramWithContext(ctx context.Context, stmts []parser.Statement) Object {
 	var result Object
 
+	// Each evaluation of a rule starts with no bindings or action results
+	e.setEnv(NewEnvironment())
+	defer e.setEnv(nil)
+	e.mutex.Lock()
+	e.actionResults = nil
+	e.mutex.Unlock()
+
 	for _, statement := range stmts {
 		// Check context cancellation between statements
 		select {
@@ -224,8 +327,19 @@ func (e *Evaluator) evalWhenStatementWithContext(ctx context.Context, node *pars
 		return &Error{Message: fmt.Sprintf("when statement evaluation cancelled: %v", ctx.Err())}
 	default:
 	}
+
+	// Rules with a during clause are skipped entirely outside their window
+	if node.During != nil {
+		window, err := parseTimeWindow(node.During.Value)
+		if err != nil {
+			return newError("%v", err)
+		}
+		if !window.contains(e.now()) {
+			return NULL
+		}
+	}
 	
-	condition := e.EvalWithContext(ctx, node.Condition)
+	condition := e.evalConditionWithContext(ctx, node)
 	if isError(condition) {
 		return condition
 	}
@@ -238,8 +352,10 @@ func (e *Evaluator) evalWhenStatementWithContext(ctx context.Context, node *pars
 		default:
 		}
 		
-		result := e.EvalWithContext(ctx, node.Body)
-		if isError(result) {
+		if e.isDryRun() {
+			return RULE_TRIGGERED
+		}
+		if result := e.evalRuleBodyWithContext(ctx, node.Body); isError(result) {
 			return result
 		}
 		// Return a special indicator that the rule was triggered
@@ -249,6 +365,71 @@ func (e *Evaluator) evalWhenStatementWithContext(ctx context.Context, node *pars
 	return NULL
 }
 
+// evalConditionWithContext evaluates a when statement's condition with its
+// within clause, if any, as the look-back window of event() calls
+func (e *Evaluator) evalConditionWithContext(ctx context.Context, node *parser.WhenStatement) Object {
+	e.mutex.Lock()
+	outer := e.eventWindow
+	e.eventWindow = unitDuration(node.Within)
+	e.mutex.Unlock()
+
+	defer func() {
+		e.mutex.Lock()
+		e.eventWindow = outer
+		e.mutex.Unlock()
+	}()
+	return e.EvalWithContext(ctx, node.Condition)
+}
+
+// evalRuleBodyWithContext runs the statements of a triggered rule in order.
+// A failing statement is recorded and the remaining statements still run;
+// only cancellation of the evaluation stops the body early.
+func (e *Evaluator) evalRuleBodyWithContext(ctx context.Context, body *parser.BlockStatement) Object {
+	if body == nil {
+		return NULL
+	}
+
+	outer := e.getEnv()
+	e.setEnv(NewEnclosedEnvironment(outer))
+	defer e.setEnv(outer)
+
+	for _, statement := range body.Statements {
+		select {
+		case <-ctx.Done():
+			return &Error{Message: fmt.Sprintf("rule body evaluation cancelled: %v", ctx.Err())}
+		default:
+		}
+
+		result := e.EvalWithContext(ctx, statement)
+		actionResult := ActionResult{Action: statementAction(statement), Success: !isError(result)}
+		if !actionResult.Success {
+			actionResult.Error = result.(*Error).Message
+		}
+		e.recordActionResult(actionResult)
+	}
+
+	return NULL
+}
+
+// statementAction names a rule body statement for its ActionResult
+func statementAction(stmt parser.Statement) string {
+	switch s := stmt.(type) {
+	case *parser.LetStatement:
+		return "let"
+	case *parser.ConstStatement:
+		return "const"
+	case *parser.ExpressionStatement:
+		if call, ok := s.Expression.(*parser.CallExpression); ok {
+			if ident, ok := call.Function.(*parser.Identifier); ok {
+				return ident.Value
+			}
+		}
+	case *parser.WhenStatement:
+		return "when"
+	}
+	return "expression"
+}
+
 func (e *Evaluator) evalBlockStatement(stmts []parser.Statement) Object {
 	var result Object
 
@@ -266,6 +447,11 @@ func (e *Evaluator) evalBlockStatement(stmts []parser.Statement) Object {
 func (e *Evaluator) evalBlockStatementWithContext(ctx context.Context, stmts []parser.Statement) Object {
 	var result Object
 
+	// Bindings made inside a block are only visible within it
+	outer := e.getEnv()
+	e.setEnv(NewEnclosedEnvironment(outer))
+	defer e.setEnv(outer)
+
 	for _, statement := range stmts {
 		// Check context cancellation between statements
 		select {
@@ -284,8 +470,70 @@ func (e *Evaluator) evalBlockStatementWithContext(ctx context.Context, stmts []p
 	return result
 }
 
+// evalLetStatementWithContext evaluates the bound expression once and stores
+// the result so later statements in the rule can refer to it by name
+func (e *Evaluator) evalLetStatementWithContext(ctx context.Context, node *parser.LetStatement) Object {
+	value := e.EvalWithContext(ctx, node.Value)
+	if isError(value) {
+		return value
+	}
+
+	env := e.getEnv()
+	if env == nil {
+		return newError("let binding outside of a rule: %s", node.Name.Value)
+	}
+	env.Set(node.Name.Value, value)
+	return NULL
+}
+
+// evalConstStatementWithContext binds a constant. validateProgram has already
+// checked that its value is a constant expression and that no later binding
+// reassigns it.
+func (e *Evaluator) evalConstStatementWithContext(ctx context.Context, node *parser.ConstStatement) Object {
+	value := e.EvalWithContext(ctx, node.Value)
+	if isError(value) {
+		return value
+	}
+
+	env := e.getEnv()
+	if env == nil {
+		return newError("const declaration outside of a rule: %s", node.Name.Value)
+	}
+	env.Set(node.Name.Value, value)
+	return NULL
+}
+
+func (e *Evaluator) evalPrefixExpression(operator string, right Object) Object {
+	switch operator {
+	case "!":
+		return nativeBoolToPyObject(!isTruthy(right))
+	case "-":
+		return e.evalMinusPrefixOperatorExpression(right)
+	default:
+		return newError("unknown operator: %s%s", operator, right.Type())
+	}
+}
+
+func (e *Evaluator) evalMinusPrefixOperatorExpression(right Object) Object {
+	switch r := right.(type) {
+	case *Integer:
+		return &Integer{Value: -r.Value}
+	case *Float:
+		return &Float{Value: -r.Value}
+	default:
+		return newError("unknown operator: -%s", right.Type())
+	}
+}
+
 func (e *Evaluator) evalInfixExpression(operator string, left, right Object) Object {
 	switch {
+	case operator == "matches" || operator == "contains":
+		return e.evalStringMatch(operator, left, right)
+	case left.Type() == STRING_OBJ && right.Type() == STRING_OBJ:
+		return e.evalStringInfixExpression(operator, left, right)
+	case operator == "+" && (left.Type() == STRING_OBJ || right.Type() == STRING_OBJ):
+		// Building a message such as "Heap at " + format(heap.alloc, "bytes")
+		return &String{Value: e.messageText(left) + e.messageText(right)}
 	case left.Type() == INTEGER_OBJ && right.Type() == INTEGER_OBJ:
 		return e.evalIntegerInfixExpression(operator, left, right)
 	case left.Type() == FLOAT_OBJ || right.Type() == FLOAT_OBJ:
@@ -316,6 +564,10 @@ func (e *Evaluator) evalIntegerInfixExpression(operator string, left, right Obje
 		if rightVal == 0 {
 			return newError("division by zero")
 		}
+		// Metric ratios such as heap.alloc / heap.sys need true division
+		if leftVal%rightVal != 0 {
+			return &Float{Value: float64(leftVal) / float64(rightVal)}
+		}
 		return &Integer{Value: leftVal / rightVal}
 	case "<":
 		return nativeBoolToPyObject(leftVal < rightVal)
@@ -371,6 +623,74 @@ func (e *Evaluator) evalFloatInfixExpression(operator string, left, right Object
 	}
 }
 
+func (e *Evaluator) evalStringInfixExpression(operator string, left, right Object) Object {
+	leftVal := left.(*String).Value
+	rightVal := right.(*String).Value
+
+	switch operator {
+	case "+":
+		return &String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToPyObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToPyObject(leftVal != rightVal)
+	case "<":
+		return nativeBoolToPyObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToPyObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToPyObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToPyObject(leftVal >= rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalStringMatch evaluates the matches and contains operators, which are
+// also available as the functions matches(s, pattern) and contains(s, sub)
+func (e *Evaluator) evalStringMatch(operator string, left, right Object) Object {
+	str, ok := left.(*String)
+	if !ok {
+		return newError("left operand of %s must be a string, got %s", operator, left.Type())
+	}
+	arg, ok := right.(*String)
+	if !ok {
+		return newError("right operand of %s must be a string, got %s", operator, right.Type())
+	}
+
+	if operator == "contains" {
+		return nativeBoolToPyObject(strings.Contains(str.Value, arg.Value))
+	}
+
+	re, err := e.compileRegex(arg.Value)
+	if err != nil {
+		return newError("invalid regular expression %q: %s", arg.Value, err.Error())
+	}
+	return nativeBoolToPyObject(re.MatchString(str.Value))
+}
+
+// compileRegex compiles a pattern, reusing patterns compiled by earlier evaluations
+func (e *Evaluator) compileRegex(pattern string) (*regexp.Regexp, error) {
+	e.regexMutex.Lock()
+	defer e.regexMutex.Unlock()
+
+	if re, exists := e.regexCache[pattern]; exists {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.regexCache == nil || len(e.regexCache) >= maxRegexCacheSize {
+		e.regexCache = make(map[string]*regexp.Regexp)
+	}
+	e.regexCache[pattern] = re
+	return re, nil
+}
+
 func (e *Evaluator) evalBooleanInfixExpression(operator string, left, right Object) Object {
 	leftVal := left.(*Boolean).Value
 	rightVal := right.(*Boolean).Value
@@ -390,19 +710,125 @@ func (e *Evaluator) evalBooleanInfixExpression(operator string, left, right Obje
 }
 
 func (e *Evaluator) evalDotExpression(node *parser.DotExpression) Object {
-	// Handle metric access like heap.alloc, goroutines.count
+	if call, ok := node.Left.(*parser.CallExpression); ok {
+		if function, _ := dotPath(call.Function); function == goroutineSiteFunction {
+			return e.evalGoroutineSite(call, node.Right)
+		}
+		return e.evalHTTPBreakdown(call, node.Right)
+	}
+
+	// Handle metric access like heap.alloc, goroutines.count or custom.orders.pending
 	// Don't evaluate the left side separately - just extract the identifiers
-	if leftIdent, ok := node.Left.(*parser.Identifier); ok {
-		if rightIdent, ok := node.Right.(*parser.Identifier); ok {
-			return e.getMetricValue(leftIdent.Value, rightIdent.Value)
+	path, ok := dotPath(node)
+	if !ok {
+		return newError("invalid dot expression: expected identifier.identifier")
+	}
+
+	category, metric, ok := splitMetricPath(path)
+	if !ok {
+		return newError("invalid dot expression: expected identifier.identifier")
+	}
+	return e.getMetricValue(category, metric)
+}
+
+// dotPath flattens a chain of dot expressions into a metric path such as "custom.orders.pending"
+func dotPath(expr parser.Expression) (string, bool) {
+	switch n := expr.(type) {
+	case *parser.Identifier:
+		return n.Value, true
+	case *parser.DotExpression:
+		left, ok := dotPath(n.Left)
+		if !ok {
+			return "", false
+		}
+		right, ok := dotPath(n.Right)
+		if !ok {
+			return "", false
 		}
+		return left + "." + right, true
+	default:
+		return "", false
 	}
+}
 
-	return newError("invalid dot expression: expected identifier.identifier")
+// splitMetricPath splits a metric path into its category and metric name.
+// Only the first dot separates the two, so custom metric names may contain dots.
+func splitMetricPath(path string) (string, string, bool) {
+	parts := strings.SplitN(path, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// windowFunctions aggregate a metric's history over a time window. Their first
+// argument names a metric rather than reading its current value. The value
+// is the number of arguments each takes.
+var windowFunctions = map[string]int{
+	"avg":         2,
+	"max":         2,
+	"trend":       2,
+	"anomaly":     2,
+	"changepoint": 2,
+	"deviates":    4,
+	"stale":       2,
+}
+
+// ruleMetricPaths returns the metrics a rule reads, such as heap.alloc or
+// custom.orders.pending, in the order they first appear. Metrics named by
+// string in window functions are included, and label selectors add the
+// series they select, such as custom.queue_depth{queue=email}.
+func ruleMetricPaths(program *parser.Program) []string {
+	var paths []string
+	seen := make(map[string]bool)
+	add := func(path string) {
+		if _, _, ok := splitMetricPath(path); ok && !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	walkNode(program, func(node parser.Node) error {
+		switch n := node.(type) {
+		case *parser.DotExpression:
+			if path, ok := dotPath(n); ok {
+				add(path)
+			}
+		case *parser.LabelSelector:
+			if path, ok := dotPath(n.Metric); ok {
+				if key, err := seriesKey(path, n.Labels); err == nil {
+					add(key)
+				}
+			}
+		case *parser.CallExpression:
+			if ident, ok := n.Function.(*parser.Identifier); ok && windowFunctions[ident.Value] > 0 && len(n.Arguments) > 0 {
+				if literal, ok := n.Arguments[0].(*parser.StringLiteral); ok {
+					add(literal.Value)
+				}
+			}
+		}
+		return nil
+	})
+	return paths
 }
 
 func (e *Evaluator) evalCallExpression(node *parser.CallExpression) Object {
 	if ident, ok := node.Function.(*parser.Identifier); ok {
+		if arity := windowFunctions[ident.Value]; arity > 0 && len(node.Arguments) == arity {
+			return e.evalWindowFunction(ident.Value, node.Arguments)
+		}
+
+		if ident.Value == "alert" {
+			return e.evalAlertCall(node.Arguments)
+		}
+
+		if ident.Value == "event" {
+			return e.evalEventCall(node.Arguments)
+		}
+
+		if ident.Value == "goroutine_leak" {
+			return e.evalGoroutineLeakCall(node.Arguments)
+		}
+
 		args := e.evalExpressions(node.Arguments)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
@@ -414,6 +840,150 @@ func (e *Evaluator) evalCallExpression(node *parser.CallExpression) Object {
 	return newError("invalid function call")
 }
 
+// evalWindowFunction evaluates the arguments of a window function. A bare metric
+// path such as heap.alloc is passed by name, and a time unit such as 6h is
+// converted to seconds so it is interpreted as a duration.
+func (e *Evaluator) evalWindowFunction(name string, arguments []parser.Expression) Object {
+	var metricArg Object
+	if path, ok := dotPath(arguments[0]); ok && strings.Contains(path, ".") {
+		metricArg = &String{Value: path}
+	} else if selector, ok := arguments[0].(*parser.LabelSelector); ok {
+		// A label selector names one series
+		path, _ := dotPath(selector.Metric)
+		key, err := seriesKey(path, selector.Labels)
+		if err != nil {
+			return newError("%s", err.Error())
+		}
+		metricArg = &String{Value: key}
+	} else {
+		metricArg = e.Eval(arguments[0])
+		if isError(metricArg) {
+			return metricArg
+		}
+	}
+
+	args := []Object{metricArg}
+	for i, argument := range arguments[1:] {
+		arg := e.Eval(argument)
+		if isError(arg) {
+			return arg
+		}
+		if unit, ok := argument.(*parser.UnitExpression); ok {
+			switch {
+			case isTimeUnit(unit.Unit):
+				// Time units evaluate to milliseconds
+				arg = &Float{Value: e.objectToFloat(arg) / 1000}
+			case name == "deviates" && i == 0 && unit.Unit == "%":
+				// deviates() takes its threshold as a percentage
+			default:
+				return newError("%s argument to %s() must be a time duration, got unit %s", argumentOrdinals[i+1], name, unit.Unit)
+			}
+		}
+		args = append(args, arg)
+	}
+
+	return e.callFunction(name, args)
+}
+
+// argumentOrdinals name argument positions in error messages
+var argumentOrdinals = []string{"first", "second", "third", "fourth"}
+
+// evalEventCall evaluates event(type) and event(type, window), which report
+// whether an event of the given type, such as one sent with EmitEvent, was
+// recorded within the window. Without a window argument, the within clause of
+// the enclosing when statement is used, or DefaultEventWindow.
+func (e *Evaluator) evalEventCall(arguments []parser.Expression) Object {
+	if len(arguments) < 1 || len(arguments) > 2 {
+		return newError("wrong number of arguments for event: got=%d, want=1..2", len(arguments))
+	}
+	eventType, ok := e.Eval(arguments[0]).(*String)
+	if !ok || eventType.Value == "" {
+		return newError("first argument to event() must be an event type string")
+	}
+
+	e.mutex.RLock()
+	window := e.eventWindow
+	e.mutex.RUnlock()
+	if len(arguments) == 2 {
+		windowArg := e.Eval(arguments[1])
+		if isError(windowArg) {
+			return windowArg
+		}
+		if unit, ok := arguments[1].(*parser.UnitExpression); ok {
+			if !isTimeUnit(unit.Unit) {
+				return newError("second argument to event() must be a time duration, got unit %s", unit.Unit)
+			}
+			// Time units evaluate to milliseconds
+			windowArg = &Float{Value: e.objectToFloat(windowArg) / 1000}
+		}
+		if window, ok = e.extractDuration(windowArg); !ok || window <= 0 {
+			return newError("second argument to event() must be a positive time duration")
+		}
+	}
+	if window <= 0 {
+		window = DefaultEventWindow
+	}
+
+	count := e.engine.countEventsSince(eventType.Value, e.now().Add(-window))
+	return nativeBoolToPyObject(count > 0)
+}
+
+// evalAlertCall evaluates alert(message), alert(message, severity) and
+// alert(severity: level, message). A severity given as a bare word such as
+// high is taken literally rather than evaluated.
+func (e *Evaluator) evalAlertCall(arguments []parser.Expression) Object {
+	var message Object
+	severity := ""
+
+	for _, arg := range arguments {
+		var valueExpr parser.Expression = arg
+		isSeverity := message != nil
+		if named, ok := arg.(*parser.NamedArgument); ok {
+			if named.Name != "severity" {
+				return newError("unknown argument for alert: %s", named.Name)
+			}
+			valueExpr = named.Value
+			isSeverity = true
+		}
+
+		if !isSeverity {
+			message = e.Eval(valueExpr)
+			if isError(message) {
+				return message
+			}
+			continue
+		}
+
+		if severity != "" {
+			return newError("severity given more than once for alert")
+		}
+		if ident, ok := valueExpr.(*parser.Identifier); ok {
+			severity = ident.Value
+		} else {
+			value := e.Eval(valueExpr)
+			if isError(value) {
+				return value
+			}
+			str, ok := value.(*String)
+			if !ok {
+				return newError("alert severity must be a string, got %s", value.Type())
+			}
+			severity = str.Value
+		}
+	}
+
+	if message == nil {
+		return newError("alert requires a message argument")
+	}
+
+	severity = strings.ToLower(severity)
+	if severity != "" && !actions.IsValidSeverity(severity) {
+		return newError("invalid alert severity: %s", severity)
+	}
+
+	return e.handleAlert(message, severity)
+}
+
 func (e *Evaluator) evalExpressions(exps []parser.Expression) []Object {
 	var result []Object
 
@@ -434,12 +1004,27 @@ func (e *Evaluator) callFunction(name string, args []Object) Object {
 		if len(args) != 1 {
 			return newError("wrong number of arguments for alert: got=%d, want=1", len(args))
 		}
-		return e.handleAlert(args[0])
+		return e.handleAlert(args[0], "")
 	case "log":
 		if len(args) != 1 {
 			return newError("wrong number of arguments for log: got=%d, want=1", len(args))
 		}
 		return e.handleLog(args[0])
+	case "contains", "matches":
+		if len(args) != 2 {
+			return newError("wrong number of arguments for %s: got=%d, want=2", name, len(args))
+		}
+		return e.evalStringMatch(name, args[0], args[1])
+	case "set_metric":
+		if len(args) != 2 {
+			return newError("wrong number of arguments for set_metric: got=%d, want=2", len(args))
+		}
+		return e.handleSetMetric(args[0], args[1])
+	case "suppress_alerts":
+		if len(args) != 0 {
+			return newError("wrong number of arguments for suppress_alerts: got=%d, want=0", len(args))
+		}
+		return e.handleSuppressAlerts()
 	case "avg":
 		if len(args) != 2 {
 			return newError("wrong number of arguments for avg: got=%d, want=2", len(args))
@@ -455,15 +1040,89 @@ func (e *Evaluator) callFunction(name string, args []Object) Object {
 			return newError("wrong number of arguments for trend: got=%d, want=2", len(args))
 		}
 		return e.handleTrend(args[0], args[1])
+	case "anomaly":
+		if len(args) != 2 {
+			return newError("wrong number of arguments for anomaly: got=%d, want=2", len(args))
+		}
+		return e.handleAnomaly(args[0], args[1])
+	case "changepoint":
+		if len(args) != 2 {
+			return newError("wrong number of arguments for changepoint: got=%d, want=2", len(args))
+		}
+		return e.handleChangepoint(args[0], args[1])
+	case "deviates":
+		if len(args) != 4 {
+			return newError("wrong number of arguments for deviates: got=%d, want=4", len(args))
+		}
+		return e.handleDeviates(args[0], args[1], args[2], args[3])
+	case "stale":
+		if len(args) != 2 {
+			return newError("wrong number of arguments for stale: got=%d, want=2", len(args))
+		}
+		return e.handleStale(args[0], args[1])
+	case "canary":
+		if len(args) != 3 {
+			return newError("wrong number of arguments for canary: got=%d, want=3", len(args))
+		}
+		return e.handleCanary(args[0], args[1], args[2])
+	case "capture_profile":
+		if len(args) != 1 {
+			return newError("wrong number of arguments for capture_profile: got=%d, want=1", len(args))
+		}
+		return e.handleCaptureProfile(args[0])
+	case "route":
+		if len(args) != 2 {
+			return newError("wrong number of arguments for route: got=%d, want=2", len(args))
+		}
+		return e.handleRoute(args[0], args[1])
+	case "format":
+		if len(args) != 1 && len(args) != 2 {
+			return newError("wrong number of arguments for format: got=%d, want=1 or 2", len(args))
+		}
+		kind := Object(&String{Value: "number"})
+		if len(args) == 2 {
+			kind = args[1]
+		}
+		return e.handleFormat(args[0], kind)
 	default:
 		return newError("unknown function: %s", name)
 	}
 }
 
-func (e *Evaluator) handleAlert(arg Object) Object {
-	message := arg.Inspect()
+// handleSuppressAlerts suppresses every active alert raised by other rules and
+// returns how many were suppressed
+func (e *Evaluator) handleSuppressAlerts() Object {
+	ruleName := e.getCurrentRuleName()
+	count := e.engine.dashboard.SuppressActiveAlerts(ruleName, "Suppressed by rule "+ruleName)
+	return &Integer{Value: int64(count)}
+}
+
+// handleCaptureProfile captures a pprof profile for the firing rule, kept
+// for the dashboard and written to the configured profile store
+func (e *Evaluator) handleCaptureProfile(typeObj Object) Object {
+	profileType, ok := typeObj.(*String)
+	if !ok {
+		return newError("argument to capture_profile() must be a profile type string")
+	}
+	if _, err := e.engine.captureProfile(e.getCurrentRuleName(), profileType.Value); err != nil {
+		return newError("failed to capture profile: %s", err.Error())
+	}
+	return NULL
+}
+
+func (e *Evaluator) handleAlert(arg Object, severity string) Object {
+	message := e.messageText(arg)
 	ruleName := e.getCurrentRuleName() // Safe access with proper locking
 	action := e.engine.actionRegistry.CreateAction(actions.AlertAction, message, ruleName)
+	action.Tags = e.engine.ruleLabels(ruleName)
+	if severity == "" {
+		// Fall back to the severity declared in the rule's metadata
+		severity = e.engine.ruleSeverity(ruleName)
+	}
+	if severity != "" {
+		action.Severity = severity
+	}
+	action.Details = e.alertDetails(ruleName)
 	
 	if err := e.engine.actionRegistry.ExecuteAction(action); err != nil {
 		return newError("failed to execute alert action: %s", err.Error())
@@ -472,10 +1131,48 @@ func (e *Evaluator) handleAlert(arg Object) Object {
 	return NULL
 }
 
+// alertDetails returns context attached to an alert raised by the named
+// rule: the top goroutine leak suspects if the rule reads
+// goroutines.leak_suspects or calls goroutine_leak()
+func (e *Evaluator) alertDetails(ruleName string) map[string]interface{} {
+	rule, ok := e.engine.GetRule(ruleName)
+	if !ok || rule.AST == nil {
+		return nil
+	}
+	if !readsGoroutineLeaks(rule.AST) {
+		return nil
+	}
+	if suspects := e.engine.goroutineLeaks.topSuspects(maxGoroutineLeakSuspects); len(suspects) > 0 {
+		return map[string]interface{}{"goroutine_leak_suspects": suspects}
+	}
+	return nil
+}
+
+// readsGoroutineLeaks reports whether a rule reads goroutines.leak_suspects
+// or calls goroutine_leak()
+func readsGoroutineLeaks(program *parser.Program) bool {
+	for _, path := range ruleMetricPaths(program) {
+		if path == "goroutines.leak_suspects" {
+			return true
+		}
+	}
+	found := false
+	walkNode(program, func(node parser.Node) error {
+		if call, ok := node.(*parser.CallExpression); ok {
+			if ident, ok := call.Function.(*parser.Identifier); ok && ident.Value == "goroutine_leak" {
+				found = true
+			}
+		}
+		return nil
+	})
+	return found
+}
+
 func (e *Evaluator) handleLog(arg Object) Object {
-	message := arg.Inspect()
+	message := e.messageText(arg)
 	ruleName := e.getCurrentRuleName() // Safe access with proper locking
 	action := e.engine.actionRegistry.CreateAction(actions.LogAction, message, ruleName)
+	action.Tags = e.engine.ruleLabels(ruleName)
 	
 	if err := e.engine.actionRegistry.ExecuteAction(action); err != nil {
 		return newError("failed to execute log action: %s", err.Error())
@@ -484,6 +1181,84 @@ func (e *Evaluator) handleLog(arg Object) Object {
 	return NULL
 }
 
+// messageText returns an object as message text, formatting numbers with
+// the engine's value format
+func (e *Evaluator) messageText(obj Object) string {
+	switch o := obj.(type) {
+	case *String:
+		return o.Value
+	case *Integer, *Float:
+		return e.engine.config.ValueFormat.Number(e.objectToFloat(o))
+	default:
+		return obj.Inspect()
+	}
+}
+
+// handleFormat formats a number with the engine's value format as a kind of
+// value: "number", "bytes", "duration" (from milliseconds, like the DSL's
+// time units) or "percent" (a value already in percent)
+func (e *Evaluator) handleFormat(valueObj, kindObj Object) Object {
+	if valueObj.Type() != INTEGER_OBJ && valueObj.Type() != FLOAT_OBJ {
+		return newError("first argument to format() must be a number, got %s", valueObj.Type())
+	}
+	kind, ok := kindObj.(*String)
+	if !ok {
+		return newError("second argument to format() must be a string, got %s", kindObj.Type())
+	}
+	value := e.objectToFloat(valueObj)
+	valueFormat := e.engine.config.ValueFormat
+	switch kind.Value {
+	case "number":
+		return &String{Value: valueFormat.Number(value)}
+	case "bytes":
+		return &String{Value: valueFormat.Bytes(value)}
+	case "duration":
+		return &String{Value: valueFormat.Duration(time.Duration(value * float64(time.Millisecond)))}
+	case "percent":
+		return &String{Value: valueFormat.Percent(value)}
+	default:
+		return newError("unknown format kind %q: want number, bytes, duration or percent", kind.Value)
+	}
+}
+
+// handleSetMetric writes a derived value to the custom metrics store, where
+// other rules, the dashboard and exporters read it as custom.<name>
+func (e *Evaluator) handleSetMetric(nameObj, valueObj Object) Object {
+	path, ok := nameObj.(*String)
+	if !ok {
+		return newError("first argument to set_metric() must be a metric name string")
+	}
+	category, metric, ok := splitMetricPath(path.Value)
+	if !ok || category != "custom" {
+		return newError("set_metric() can only write custom.* metrics, got %q", path.Value)
+	}
+
+	var value float64
+	switch v := valueObj.(type) {
+	case *Integer, *Float:
+		value = e.objectToFloat(v)
+	default:
+		return newError("second argument to set_metric() must be a number, got %s", valueObj.Type())
+	}
+
+	if err := e.engine.UpdateCustomMetric(metric, value); err != nil {
+		return newError("failed to set metric %s: %s", path.Value, err.Error())
+	}
+
+	// The write has already happened, so the action is only reported, not routed
+	action := e.engine.actionRegistry.CreateAction(actions.MetricAction,
+		fmt.Sprintf("%s = %g", path.Value, value), e.getCurrentRuleName())
+	action.Severity = ""
+	action.Tags = e.engine.ruleLabels(action.RuleName)
+	action.Metric = path.Value
+	action.Value = value
+	if err := e.engine.actionRegistry.NotifyObservers(action); err != nil {
+		return newError("failed to record set_metric action: %s", err.Error())
+	}
+
+	return NULL
+}
+
 func (e *Evaluator) handleAvg(metricObj, durationObj Object) Object {
 	// Extract metric path from first argument (should be like "heap.alloc")
 	metricPath, ok := e.extractMetricPath(metricObj)
@@ -532,6 +1307,151 @@ func (e *Evaluator) handleTrend(metricObj, durationObj Object) Object {
 	return e.calculateMetricTrend(metricPath, duration)
 }
 
+func (e *Evaluator) handleAnomaly(metricObj, durationObj Object) Object {
+	// Extract metric path from first argument
+	metricPath, ok := e.extractMetricPath(metricObj)
+	if !ok {
+		return newError("first argument to anomaly() must be a metric path")
+	}
+	
+	// Extract duration from second argument
+	duration, ok := e.extractDuration(durationObj)
+	if !ok {
+		return newError("second argument to anomaly() must be a time duration")
+	}
+	
+	return e.calculateMetricAnomaly(metricPath, duration)
+}
+
+func (e *Evaluator) handleChangepoint(metricObj, durationObj Object) Object {
+	// Extract metric path from first argument
+	metricPath, ok := e.extractMetricPath(metricObj)
+	if !ok {
+		return newError("first argument to changepoint() must be a metric path")
+	}
+	
+	// Extract duration from second argument
+	duration, ok := e.extractDuration(durationObj)
+	if !ok {
+		return newError("second argument to changepoint() must be a time duration")
+	}
+	
+	return e.calculateMetricChangepoint(metricPath, duration)
+}
+
+func (e *Evaluator) handleDeviates(metricObj, percentObj, windowObj, baselineObj Object) Object {
+	metricPath, ok := e.extractMetricPath(metricObj)
+	if !ok {
+		return newError("first argument to deviates() must be a metric path")
+	}
+	var percent float64
+	switch p := percentObj.(type) {
+	case *Integer:
+		percent = float64(p.Value)
+	case *Float:
+		percent = p.Value
+	default:
+		return newError("second argument to deviates() must be a percentage")
+	}
+	window, ok := e.extractDuration(windowObj)
+	if !ok || window <= 0 {
+		return newError("third argument to deviates() must be a time duration")
+	}
+	baselineWindow, ok := e.extractDuration(baselineObj)
+	if !ok || baselineWindow < window {
+		return newError("fourth argument to deviates() must be a time duration at least as long as the window")
+	}
+
+	return e.calculateMetricDeviation(metricPath, percent, window, baselineWindow)
+}
+
+// routeStatistics are the statistics route() reads from a route's recent
+// requests, in the units of the matching http metrics: milliseconds for
+// response times and a percentage for the error rate
+var routeStatistics = map[string]func(metrics.RouteStats) Object{
+	"p50":           func(s metrics.RouteStats) Object { return &Float{Value: float64(s.P50) / 1000000} },
+	"p95":           func(s metrics.RouteStats) Object { return &Float{Value: float64(s.P95) / 1000000} },
+	"p99":           func(s metrics.RouteStats) Object { return &Float{Value: float64(s.P99) / 1000000} },
+	"response_time": func(s metrics.RouteStats) Object { return &Float{Value: float64(s.AvgResponseTime) / 1000000} },
+	"error_rate":    func(s metrics.RouteStats) Object { return &Float{Value: s.ErrorRate} },
+	"request_count": func(s metrics.RouteStats) Object { return &Integer{Value: s.RequestCount} },
+	"samples":       func(s metrics.RouteStats) Object { return &Integer{Value: int64(s.Samples)} },
+}
+
+// routeStatisticNames lists the statistics route() accepts, for error messages
+func routeStatisticNames() string {
+	names := make([]string, 0, len(routeStatistics))
+	for name := range routeStatistics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// handleRoute returns a statistic of an HTTP route, e.g.
+// route("/api/checkout", "p99"). The first call for a route starts tracking
+// it, so its statistics cover requests from then on.
+func (e *Evaluator) handleRoute(routeObj, statObj Object) Object {
+	route, ok := routeObj.(*String)
+	if !ok || route.Value == "" {
+		return newError("first argument to route() must be a route path")
+	}
+	stat, ok := statObj.(*String)
+	if !ok {
+		return newError("second argument to route() must be a statistic name")
+	}
+	value, known := routeStatistics[stat.Value]
+	if !known {
+		return newError("unknown route statistic %q (expected %s)", stat.Value, routeStatisticNames())
+	}
+
+	e.engine.httpMetrics.TrackRoute(route.Value)
+	stats, _ := e.engine.httpMetrics.GetRouteStats(route.Value)
+	return value(stats)
+}
+
+// httpBreakdowns are the calls that select a slice of HTTP traffic, read
+// with a route statistic such as http.route("/api/transfer").error_rate
+var httpBreakdowns = map[string]bool{
+	"http.route":  true,
+	"http.method": true,
+}
+
+// evalHTTPBreakdown returns a statistic of the requests selected by
+// http.route(label) or http.method(method). A route that is not a label
+// seen by the route labeler is tracked as a path pattern, as in route().
+func (e *Evaluator) evalHTTPBreakdown(call *parser.CallExpression, statExpr parser.Expression) Object {
+	function, _ := dotPath(call.Function)
+	stat, ok := statExpr.(*parser.Identifier)
+	if !httpBreakdowns[function] || !ok {
+		return newError("invalid dot expression: %s.%s", call.String(), statExpr.String())
+	}
+	value, known := routeStatistics[stat.Value]
+	if !known {
+		return newError("unknown route statistic %q (expected %s)", stat.Value, routeStatisticNames())
+	}
+	if len(call.Arguments) != 1 {
+		return newError("wrong number of arguments for %s: got=%d, want=1", function, len(call.Arguments))
+	}
+	arg := e.Eval(call.Arguments[0])
+	if isError(arg) {
+		return arg
+	}
+	name, ok := arg.(*String)
+	if !ok || name.Value == "" {
+		return newError("argument to %s() must be a string", function)
+	}
+
+	if function == "http.method" {
+		stats, _ := e.engine.httpMetrics.GetMethodStats(name.Value)
+		return value(stats)
+	}
+	if stats, exists := e.engine.httpMetrics.GetRouteLabelStats(name.Value); exists {
+		return value(stats)
+	}
+	return e.handleRoute(name, &String{Value: stat.Value})
+}
+
 func (e *Evaluator) extractMetricPath(obj Object) (string, bool) {
 	if str, ok := obj.(*String); ok {
 		return str.Value, true
@@ -539,9 +1459,9 @@ func (e *Evaluator) extractMetricPath(obj Object) (string, bool) {
 	return "", false
 }
 
+// extractDuration converts a window argument to a duration. Plain numbers are
+// interpreted as seconds; unit expressions are normalized by evalWindowFunction.
 func (e *Evaluator) extractDuration(obj Object) (time.Duration, bool) {
-	// For now, assume duration is provided as integer seconds
-	// In a full implementation, this would parse unit expressions like "5m"
 	switch o := obj.(type) {
 	case *Integer:
 		return time.Duration(o.Value) * time.Second, true
@@ -552,63 +1472,99 @@ func (e *Evaluator) extractDuration(obj Object) (time.Duration, bool) {
 	}
 }
 
-func (e *Evaluator) calculateMetricAverage(metricPath string, duration time.Duration) Object {
-	parts := strings.Split(metricPath, ".")
-	if len(parts) != 2 {
-		return newError("metric path must be in format 'category.metric'")
+// timedValue is a single historical observation of a metric
+type timedValue struct {
+	value     float64
+	timestamp time.Time
+}
+
+// metricHistory returns the observations of a metric within the given duration,
+// oldest first. Runtime metrics come from the runtime collector, custom
+// metrics from the engine's custom metric history, leak metrics from the leak
+// detector and provider metrics from their provider.
+func (e *Evaluator) metricHistory(category, metric string, duration time.Duration) []timedValue {
+	var values []timedValue
+	
+	if e.simulation != nil {
+		if simulated, ok := e.simulation.history(category+"."+metric, e.now(), duration); ok {
+			return simulated
+		}
+	}
+	
+	if strings.Contains(metric, "{") {
+		for _, sample := range e.engine.labeledMetrics.history(category+"."+metric, e.now().Add(-duration)) {
+			values = append(values, timedValue{value: sample.Value, timestamp: sample.Timestamp})
+		}
+		return values
 	}
 	
-	category, metric := parts[0], parts[1]
+	if category == "custom" {
+		for _, sample := range e.engine.getCustomMetricHistory(metric, duration) {
+			values = append(values, timedValue{value: sample.Value, timestamp: sample.Timestamp})
+		}
+		return values
+	}
 	
-	// Get historical data for the specified duration
-	history := e.engine.runtimeCollector.GetHistoryWindow(duration)
-	if len(history) == 0 {
-		return &Float{Value: 0}
+	if category == "leak" {
+		for _, sample := range e.engine.leak.metricHistory(metric, e.now().Add(-duration)) {
+			values = append(values, timedValue{value: sample.Value, timestamp: sample.Timestamp})
+		}
+		return values
 	}
 	
-	var sum float64
-	var count int
+	if samples, registered := e.engine.providerHistory(category, metric, duration); registered {
+		for _, sample := range samples {
+			values = append(values, timedValue{value: sample.Value, timestamp: sample.Timestamp})
+		}
+		return values
+	}
 	
-	for _, h := range history {
-		value := e.getHistoricalMetricValue(category, metric, &h)
+	history := e.engine.runtimeCollector.GetHistoryWindow(duration)
+	for i := range history {
+		value := e.getHistoricalMetricValue(category, metric, &history[i])
 		if value != nil {
-			sum += e.objectToFloat(value)
-			count++
+			values = append(values, timedValue{value: e.objectToFloat(value), timestamp: history[i].Timestamp})
 		}
 	}
+	return values
+}
+
+func (e *Evaluator) calculateMetricAverage(metricPath string, duration time.Duration) Object {
+	category, metric, ok := splitMetricPath(metricPath)
+	if !ok {
+		return newError("metric path must be in format 'category.metric'")
+	}
 	
-	if count == 0 {
+	// Get historical data for the specified duration
+	history := e.metricHistory(category, metric, duration)
+	if len(history) == 0 {
 		return &Float{Value: 0}
 	}
 	
-	return &Float{Value: sum / float64(count)}
+	var sum float64
+	for _, h := range history {
+		sum += h.value
+	}
+	
+	return &Float{Value: sum / float64(len(history))}
 }
 
 func (e *Evaluator) calculateMetricMax(metricPath string, duration time.Duration) Object {
-	parts := strings.Split(metricPath, ".")
-	if len(parts) != 2 {
+	category, metric, ok := splitMetricPath(metricPath)
+	if !ok {
 		return newError("metric path must be in format 'category.metric'")
 	}
 	
-	category, metric := parts[0], parts[1]
-	
 	// Get historical data for the specified duration
-	history := e.engine.runtimeCollector.GetHistoryWindow(duration)
+	history := e.metricHistory(category, metric, duration)
 	if len(history) == 0 {
 		return &Float{Value: 0}
 	}
 	
-	var max float64
-	first := true
-	
-	for _, h := range history {
-		value := e.getHistoricalMetricValue(category, metric, &h)
-		if value != nil {
-			val := e.objectToFloat(value)
-			if first || val > max {
-				max = val
-				first = false
-			}
+	max := history[0].value
+	for _, h := range history[1:] {
+		if h.value > max {
+			max = h.value
 		}
 	}
 	
@@ -616,39 +1572,198 @@ func (e *Evaluator) calculateMetricMax(metricPath string, duration time.Duration
 }
 
 func (e *Evaluator) calculateMetricTrend(metricPath string, duration time.Duration) Object {
-	parts := strings.Split(metricPath, ".")
-	if len(parts) != 2 {
+	category, metric, ok := splitMetricPath(metricPath)
+	if !ok {
 		return newError("metric path must be in format 'category.metric'")
 	}
 	
-	category, metric := parts[0], parts[1]
-	
 	// Get historical data for the specified duration
-	history := e.engine.runtimeCollector.GetHistoryWindow(duration)
+	history := e.metricHistory(category, metric, duration)
 	if len(history) < 2 {
 		return &Float{Value: 0}
 	}
 	
 	// Calculate trend as the difference between latest and earliest values
-	earliest := e.getHistoricalMetricValue(category, metric, &history[0])
-	latest := e.getHistoricalMetricValue(category, metric, &history[len(history)-1])
+	earliest := history[0]
+	latest := history[len(history)-1]
 	
-	if earliest == nil || latest == nil {
+	// Return the rate of change per minute
+	minutesDiff := latest.timestamp.Sub(earliest.timestamp).Minutes()
+	if minutesDiff == 0 {
 		return &Float{Value: 0}
 	}
 	
-	earliestVal := e.objectToFloat(earliest)
-	latestVal := e.objectToFloat(latest)
+	changeRate := (latest.value - earliest.value) / minutesDiff
+	return &Float{Value: changeRate}
+}
+
+// minAnomalySamples is the number of baseline observations anomaly() needs
+// before it reports a deviation
+const minAnomalySamples = 5
+
+// calculateMetricAnomaly returns how many standard deviations the latest
+// observation of a metric lies from its baseline over the window. The baseline
+// is an exponentially weighted moving average (EWMA) of the earlier
+// observations, so recent behaviour counts for more than old behaviour. The
+// result is positive for spikes and negative for drops.
+func (e *Evaluator) calculateMetricAnomaly(metricPath string, duration time.Duration) Object {
+	category, metric, ok := splitMetricPath(metricPath)
+	if !ok {
+		return newError("metric path must be in format 'category.metric'")
+	}
 	
-	// Return the rate of change per minute
-	timeDiff := history[len(history)-1].Timestamp.Sub(history[0].Timestamp)
-	minutesDiff := timeDiff.Minutes()
-	if minutesDiff == 0 {
+	history := e.metricHistory(category, metric, duration)
+	if len(history) < minAnomalySamples+1 {
 		return &Float{Value: 0}
 	}
 	
-	changeRate := (latestVal - earliestVal) / minutesDiff
-	return &Float{Value: changeRate}
+	baseline := history[:len(history)-1]
+	latest := history[len(history)-1].value
+	
+	// Smoothing factor for an EWMA spanning the baseline
+	alpha := 2 / float64(len(baseline)+1)
+	mean := baseline[0].value
+	var variance float64
+	for _, h := range baseline[1:] {
+		diff := h.value - mean
+		increment := alpha * diff
+		mean += increment
+		variance = (1 - alpha) * (variance + diff*increment)
+	}
+	
+	// A flat baseline has no spread to measure a deviation against
+	stddev := math.Sqrt(variance)
+	if stddev == 0 {
+		return &Float{Value: 0}
+	}
+	
+	return &Float{Value: (latest - mean) / stddev}
+}
+
+// minChangepointSegment is the number of observations needed on each side of
+// a change point before changepoint() reports it
+const minChangepointSegment = 3
+
+// calculateMetricChangepoint finds the most likely point in the window at
+// which a metric's level changed and returns the size of the shift, in
+// standard deviations of the observations around their segment means. The
+// change point is where the cumulative sum (CUSUM) of deviations from the
+// window's mean strays furthest from zero, which splits the window into the
+// two segments that best fit a single step. The result is positive when the
+// metric stepped up and negative when it dropped.
+func (e *Evaluator) calculateMetricChangepoint(metricPath string, duration time.Duration) Object {
+	category, metric, ok := splitMetricPath(metricPath)
+	if !ok {
+		return newError("metric path must be in format 'category.metric'")
+	}
+	
+	history := e.metricHistory(category, metric, duration)
+	n := len(history)
+	if n < 2*minChangepointSegment {
+		return &Float{Value: 0}
+	}
+	
+	var total float64
+	for _, h := range history {
+		total += h.value
+	}
+	mean := total / float64(n)
+	
+	// The split after index split-1 with the largest |CUSUM|
+	split := 0
+	var cusum, largest float64
+	for i := 0; i < n-minChangepointSegment; i++ {
+		cusum += history[i].value - mean
+		if i+1 >= minChangepointSegment && math.Abs(cusum) > largest {
+			largest = math.Abs(cusum)
+			split = i + 1
+		}
+	}
+	if split == 0 {
+		// The CUSUM never leaves zero, so the level never changed
+		return &Float{Value: 0}
+	}
+	
+	segmentMean := func(values []timedValue) float64 {
+		var sum float64
+		for _, h := range values {
+			sum += h.value
+		}
+		return sum / float64(len(values))
+	}
+	before, after := segmentMean(history[:split]), segmentMean(history[split:])
+	
+	// Pooled spread of the observations around their own segment's mean
+	var squares float64
+	for i, h := range history {
+		segment := before
+		if i >= split {
+			segment = after
+		}
+		squares += (h.value - segment) * (h.value - segment)
+	}
+	stddev := math.Sqrt(squares / float64(n-2))
+	if stddev == 0 {
+		// A clean step between flat segments; measure the shift against 1% of
+		// the earlier level so it stays comparable
+		stddev = math.Max(math.Abs(before)*0.01, 1e-9)
+	}
+	
+	return &Float{Value: (after - before) / stddev}
+}
+
+// calculateMetricDeviation reports whether a metric's average over the
+// recent window differs by more than percent from its learned baseline. The
+// baseline is the median of the averages of the windows of the same length
+// that make up baselineWindow before the recent one, so a single unusual
+// window does not shift it, while organic growth moves it along. Windows
+// without samples are skipped; with no recent samples, no baseline or a
+// zero baseline, nothing deviates.
+func (e *Evaluator) calculateMetricDeviation(metricPath string, percent float64, window, baselineWindow time.Duration) Object {
+	category, metric, ok := splitMetricPath(metricPath)
+	if !ok {
+		return newError("metric path must be in format 'category.metric'")
+	}
+
+	history := e.metricHistory(category, metric, window+baselineWindow)
+	now := e.now()
+	windows := int(baselineWindow / window)
+	sums := make([]float64, windows+1)
+	counts := make([]int, windows+1)
+	for _, h := range history {
+		// Window 0 is the recent one, window i ended i windows ago
+		i := int(now.Sub(h.timestamp) / window)
+		if i < 0 || i > windows {
+			continue
+		}
+		sums[i] += h.value
+		counts[i]++
+	}
+	if counts[0] == 0 {
+		return FALSE
+	}
+
+	var averages []float64
+	for i := 1; i <= windows; i++ {
+		if counts[i] > 0 {
+			averages = append(averages, sums[i]/float64(counts[i]))
+		}
+	}
+	if len(averages) == 0 {
+		return FALSE
+	}
+	sort.Float64s(averages)
+	baseline := averages[len(averages)/2]
+	if len(averages)%2 == 0 {
+		baseline = (averages[len(averages)/2-1] + baseline) / 2
+	}
+	if baseline == 0 {
+		return FALSE
+	}
+
+	recent := sums[0] / float64(counts[0])
+	deviation := math.Abs(recent-baseline) / math.Abs(baseline) * 100
+	return nativeBoolToPyObject(deviation > percent)
 }
 
 func (e *Evaluator) getHistoricalMetricValue(category, metric string, runtimeMetrics *metrics.RuntimeMetrics) Object {
@@ -680,12 +1795,20 @@ func (e *Evaluator) getHistoricalMetricValue(category, metric string, runtimeMet
 			return &Integer{Value: int64(runtimeMetrics.NumGC)}
 		}
 	}
+	if value := runtimeDistributionValue(category, metric, runtimeMetrics); value != nil {
+		return value
+	}
 	
 	return nil
 }
 
 func (e *Evaluator) evalIdentifier(node *parser.Identifier) Object {
-	// For now, identifiers are not supported without dot notation
+	// Bare identifiers refer to let-bindings; metrics always use dot notation
+	if env := e.getEnv(); env != nil {
+		if value, ok := env.Get(node.Value); ok {
+			return value
+		}
+	}
 	return newError("identifier not found: %s", node.Value)
 }
 
@@ -711,6 +1834,12 @@ func (e *Evaluator) evalUnitExpression(node *parser.UnitExpression) Object {
 }
 
 func (e *Evaluator) getMetricValue(category, metric string) Object {
+	if e.simulation != nil {
+		if value, ok := e.simulation.value(category+"."+metric, e.now()); ok {
+			return &Float{Value: value}
+		}
+	}
+
 	runtimeMetrics := e.engine.GetRuntimeMetrics()
 	httpStats := e.engine.GetHTTPMetrics()
 
@@ -734,6 +1863,8 @@ func (e *Evaluator) getMetricValue(category, metric string) Object {
 		switch metric {
 		case "count":
 			return &Integer{Value: int64(runtimeMetrics.NumGoroutine)}
+		case "leak_suspects":
+			return &Integer{Value: int64(e.engine.goroutineLeaks.suspectCount())}
 		}
 	case "gc":
 		switch metric {
@@ -744,49 +1875,161 @@ func (e *Evaluator) getMetricValue(category, metric string) Object {
 		case "cpu_fraction":
 			return &Float{Value: runtimeMetrics.GCCPUFraction}
 		}
+		if value := runtimeDistributionValue(category, metric, &runtimeMetrics); value != nil {
+			return value
+		}
+	case "sched":
+		if value := runtimeDistributionValue(category, metric, &runtimeMetrics); value != nil {
+			return value
+		}
 	case "http":
+		if value := httpMetricValue(httpStats, metric); value != nil {
+			return value
+		}
+		if segment, ok := strings.CutPrefix(metric, "segment."); ok {
+			if stats, exists := e.engine.GetSegmentStats(segment); exists {
+				return &Float{Value: stats.Average}
+			}
+			return newError("unknown request segment: %s", segment)
+		}
+		// http.<server>.<metric> reads the middleware created with
+		// HTTPMiddlewareNamed(server)
+		if name, serverMetric, ok := strings.Cut(metric, "."); ok {
+			if server := e.engine.httpServer(name, false); server != nil {
+				return namedHTTPMetricValue(name, server, serverMetric)
+			}
+		}
+	case "uptime":
+		switch metric {
+		case "seconds":
+			return &Float{Value: e.engine.GetUptime().Seconds()}
+		}
+	case "alerts":
+		counts := e.engine.GetAlertCounts()
 		switch metric {
-		case "request_count":
-			return &Integer{Value: httpStats.RequestCount}
-		case "error_count":
-			return &Integer{Value: httpStats.ErrorCount}
-		case "error_rate":
-			return &Float{Value: httpStats.ErrorRate}
-		case "request_rate":
-			return &Float{Value: httpStats.RequestRate}
-		case "response_time":
-			return &Float{Value: float64(httpStats.AvgResponseTime) / 1000000} // Convert nanoseconds to ms
-		case "max_response_time":
-			return &Float{Value: float64(httpStats.MaxResponseTime) / 1000000} // Convert nanoseconds to ms
-		case "pending_requests":
-			return &Integer{Value: httpStats.PendingRequests}
+		case "active_count":
+			return &Integer{Value: int64(counts.Active)}
+		case "acknowledged_count":
+			return &Integer{Value: int64(counts.Acknowledged)}
+		case "critical_count":
+			return &Integer{Value: int64(counts.Critical)}
+		case "high_count":
+			return &Integer{Value: int64(counts.High)}
+		}
+	case "custom":
+		if value, exists := e.engine.histogramMetric(metric); exists {
+			return &Float{Value: value}
+		}
+		if value, exists := e.engine.GetCustomMetric(metric); exists {
+			return &Float{Value: value}
+		}
+		if sum, matched := e.engine.sumSeries("custom."+metric, nil); matched > 0 {
+			return &Float{Value: sum}
+		}
+		return newError("unknown custom metric: %s", metric)
+	case "leak":
+		if value, exists := e.engine.leak.metric(metric); exists {
+			return &Float{Value: value}
 		}
+		return newError("unknown leak metric: %s", metric)
+	}
+
+	if value, found, registered := e.engine.providerMetric(category, metric); registered {
+		if found {
+			return &Float{Value: value}
+		}
+		return newError("unknown %s metric: %s", category, metric)
 	}
 
 	return newError("unknown metric: %s.%s", category, metric)
 }
 
-func (e *Evaluator) getUnitMultiplier(unit string) float64 {
-	switch strings.ToUpper(unit) {
-	case "B":
-		return 1
-	case "KB":
-		return 1024
-	case "MB":
-		return 1024 * 1024
-	case "GB":
-		return 1024 * 1024 * 1024
-	case "MS":
-		return 1
-	case "S":
-		return 1000
-	case "M":
-		return 1000 * 60
-	case "H":
-		return 1000 * 60 * 60
-	default:
-		return 0
+// runtimeDistributionValue returns the GC heap goal, or a GC pause or
+// scheduler latency percentile in milliseconds, or nil if metric is not one
+func runtimeDistributionValue(category, metric string, runtimeMetrics *metrics.RuntimeMetrics) Object {
+	switch category + "." + metric {
+	case "gc.heap_goal":
+		return &Integer{Value: int64(runtimeMetrics.NextGC)}
+	case "gc.pause_p50":
+		return &Float{Value: float64(runtimeMetrics.GCPauseP50Ns) / 1000000}
+	case "gc.pause_p99":
+		return &Float{Value: float64(runtimeMetrics.GCPauseP99Ns) / 1000000}
+	case "sched.latency_p50":
+		return &Float{Value: float64(runtimeMetrics.SchedLatencyP50Ns) / 1000000}
+	case "sched.latency_p99":
+		return &Float{Value: float64(runtimeMetrics.SchedLatencyP99Ns) / 1000000}
+	}
+	return nil
+}
+
+// httpMetricValue returns an HTTP metric read from stats, in the units rules
+// use, or nil if metric is not one
+func httpMetricValue(stats metrics.HTTPStats, metric string) Object {
+	switch metric {
+	case "request_count":
+		return &Integer{Value: stats.RequestCount}
+	case "error_count":
+		return &Integer{Value: stats.ErrorCount}
+	case "error_rate":
+		return &Float{Value: stats.ErrorRate}
+	case "request_rate":
+		return &Float{Value: stats.RequestRate}
+	case "response_time":
+		return &Float{Value: float64(stats.AvgResponseTime) / 1000000} // Convert nanoseconds to ms
+	case "max_response_time":
+		return &Float{Value: float64(stats.MaxResponseTime) / 1000000} // Convert nanoseconds to ms
+	case "p50_response_time":
+		return &Float{Value: float64(stats.P50ResponseTime) / 1000000}
+	case "p90_response_time":
+		return &Float{Value: float64(stats.P90ResponseTime) / 1000000}
+	case "p95_response_time":
+		return &Float{Value: float64(stats.P95ResponseTime) / 1000000}
+	case "p99_response_time":
+		return &Float{Value: float64(stats.P99ResponseTime) / 1000000}
+	case "pending_requests":
+		return &Integer{Value: stats.PendingRequests}
+	case "avg_request_size":
+		return &Float{Value: stats.AvgRequestSize}
+	case "avg_response_size":
+		return &Float{Value: stats.AvgResponseSize}
+	case "bytes_per_second":
+		return &Float{Value: stats.BytesPerSecond}
+	case "status_1xx":
+		return &Integer{Value: stats.Status1xx}
+	case "status_2xx":
+		return &Integer{Value: stats.Status2xx}
+	case "status_3xx":
+		return &Integer{Value: stats.Status3xx}
+	case "status_4xx":
+		return &Integer{Value: stats.Status4xx}
+	case "status_5xx":
+		return &Integer{Value: stats.Status5xx}
+	}
+	return nil
+}
+
+// namedHTTPMetricValue returns a metric of the named middleware's requests
+func namedHTTPMetricValue(name string, server *metrics.HTTPMetrics, metric string) Object {
+	if value := httpMetricValue(server.GetStats(), metric); value != nil {
+		return value
 	}
+	if segment, ok := strings.CutPrefix(metric, "segment."); ok {
+		if stats, exists := server.GetSegmentStats(segment); exists {
+			return &Float{Value: stats.Average}
+		}
+		return newError("unknown request segment of http.%s: %s", name, segment)
+	}
+	return newError("unknown metric: http.%s.%s", name, metric)
+}
+
+func (e *Evaluator) getUnitMultiplier(unit string) float64 {
+	return unitMultiplier(unit)
+}
+
+// isTimeUnit reports whether the unit expresses a duration (as milliseconds)
+func isTimeUnit(unit string) bool {
+	_, ok := timeUnits[strings.ToUpper(unit)]
+	return ok
 }
 
 func (e *Evaluator) objectToFloat(obj Object) float64 {
@@ -816,8 +2059,15 @@ func isTruthy(obj Object) bool {
 	case FALSE:
 		return false
 	default:
-		if boolean, ok := obj.(*Boolean); ok {
-			return boolean.Value
+		switch o := obj.(type) {
+		case *Boolean:
+			return o.Value
+		case *Integer:
+			return o.Value != 0
+		case *Float:
+			return o.Value != 0
+		case *String:
+			return o.Value != ""
 		}
 		return true
 	}
@@ -0,0 +1,1096 @@
+package descry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+	"github.com/chosenoffset/descry/pkg/descry/clock"
+	"github.com/chosenoffset/descry/pkg/descry/parser"
+	"github.com/chosenoffset/descry/pkg/descry/units"
+)
+
+// evalSource parses and evaluates DSL source against the given engine
+func evalSource(t *testing.T, engine *Engine, source string) Object {
+	t.Helper()
+
+	p := parser.New(parser.NewLexer(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parse errors for %q: %v", source, p.Errors())
+	}
+
+	return engine.evaluator.Eval(program)
+}
+
+// lastTrigger returns when the named rule last triggered. Triggering swaps in
+// a new Rule, so a pointer from an earlier GetRule does not see it.
+func lastTrigger(engine *Engine, name string) time.Time {
+	rule, _ := engine.GetRule(name)
+	return rule.LastTrigger
+}
+
+func TestArithmeticExpressions(t *testing.T) {
+	engine := NewEngine()
+
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		{"1 + 2", 3},
+		{"10 - 4", 6},
+		{"3 * 4", 12},
+		{"10 / 4", 2.5},
+		{"10 / 5", 2},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"1.5 * 2", 3},
+		{"2MB / 1MB", 2},
+	}
+
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if isError(result) {
+			t.Errorf("%q: unexpected error: %s", tt.source, result.Inspect())
+			continue
+		}
+		if got := engine.evaluator.objectToFloat(result); got != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.source, tt.expected, got)
+		}
+	}
+}
+
+func TestArithmeticInConditions(t *testing.T) {
+	engine := NewEngine()
+
+	result := evalSource(t, engine, `when heap.alloc / heap.sys > 0 && heap.alloc / heap.sys <= 1 { log("ratio") }`)
+	if result != RULE_TRIGGERED {
+		t.Errorf("expected ratio rule to trigger, got %s", result.Inspect())
+	}
+
+	if err := engine.AddRule("ratio", `when heap.alloc / heap.sys > 0.9 { alert("Heap nearly exhausted") }`); err != nil {
+		t.Errorf("expected arithmetic rule to be accepted: %v", err)
+	}
+
+	result = evalSource(t, engine, `when 1 / 0 > 0 { log("never") }`)
+	if !isError(result) {
+		t.Errorf("expected division by zero error, got %s", result.Inspect())
+	}
+}
+
+func TestCustomMetricReferences(t *testing.T) {
+	engine := NewEngine()
+
+	if err := engine.UpdateCustomMetric("orders_per_second", 10); err != nil {
+		t.Fatalf("failed to update custom metric: %v", err)
+	}
+	if err := engine.UpdateCustomMetric("orders_per_second", 30); err != nil {
+		t.Fatalf("failed to update custom metric: %v", err)
+	}
+	if err := engine.UpdateCustomMetric("queue.depth", 7); err != nil {
+		t.Fatalf("failed to update custom metric: %v", err)
+	}
+
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		{"custom.orders_per_second", 30},
+		{"custom.queue.depth", 7},
+		{`avg("custom.orders_per_second", 60)`, 20},
+		{`max("custom.orders_per_second", 60)`, 30},
+	}
+
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if isError(result) {
+			t.Errorf("%q: unexpected error: %s", tt.source, result.Inspect())
+			continue
+		}
+		if got := engine.evaluator.objectToFloat(result); got != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.source, tt.expected, got)
+		}
+	}
+
+	result := evalSource(t, engine, "custom.missing")
+	if !isError(result) {
+		t.Errorf("expected error for unknown custom metric, got %s", result.Inspect())
+	}
+
+	result = evalSource(t, engine, `when custom.orders_per_second > 25 { log("busy") }`)
+	if result != RULE_TRIGGERED {
+		t.Errorf("expected custom metric rule to trigger, got %s", result.Inspect())
+	}
+}
+
+func TestDeviates(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake, Logger: log.New(io.Discard, "", 0)})
+	record := func(minutes int, value func(minute int) float64) {
+		for i := 0; i < minutes*2; i++ {
+			fake.Advance(30 * time.Second)
+			if err := engine.UpdateCustomMetric("orders", value(i/2)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// 30 minutes around 100 orders, with one unusual 5-minute window
+	record(30, func(minute int) float64 {
+		if minute >= 10 && minute < 15 {
+			return 400
+		}
+		return 100
+	})
+	record(5, func(int) float64 { return 130 })
+
+	tests := []struct {
+		source   string
+		expected Object
+	}{
+		{`deviates("custom.orders", 20%, 5m, 30m)`, TRUE},
+		{`deviates(custom.orders, 40, 5m, 30m)`, FALSE}, // the unusual window doesn't move the baseline
+		{`deviates("custom.orders", 20%, 5m, 5m)`, TRUE},
+		{`deviates("custom.unknown", 20%, 5m, 30m)`, FALSE},
+	}
+	for _, tt := range tests {
+		if result := evalSource(t, engine, tt.source); result != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.source, tt.expected.Inspect(), result.Inspect())
+		}
+	}
+
+	// A baseline learned from steady growth follows it
+	record(30, func(minute int) float64 { return 130 + float64(minute) })
+	if result := evalSource(t, engine, `deviates("custom.orders", 20%, 5m, 15m)`); result != FALSE {
+		t.Errorf("expected organic growth to stay within the baseline, got %s", result.Inspect())
+	}
+
+	for _, source := range []string{
+		`deviates("custom.orders", 20%, 5m, 1m)`,
+		`deviates("custom.orders", 20MB, 5m, 30m)`,
+		`deviates("custom.orders", 20%, 5MB, 30m)`,
+	} {
+		if result := evalSource(t, engine, source); !isError(result) {
+			t.Errorf("%q: expected an error, got %s", source, result.Inspect())
+		}
+	}
+}
+
+func TestCustomMetricHistoryWindows(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake, Logger: log.New(io.Discard, "", 0)})
+
+	// One sample every 30s for 10 minutes: 1, 2, ..., 20
+	for i := 1; i <= 20; i++ {
+		fake.Advance(30 * time.Second)
+		if err := engine.UpdateCustomMetric("queue_depth", float64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		{`avg("custom.queue_depth", 5m)`, 15.5}, // samples 11 to 20
+		{`max("custom.queue_depth", 5m)`, 20},
+		{`avg("custom.queue_depth", 1h)`, 10.5},
+		{`trend("custom.queue_depth", 5m)`, 2}, // per minute
+	}
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if got := engine.evaluator.objectToFloat(result); isError(result) || got != tt.expected {
+			t.Errorf("%q: expected %v, got %s", tt.source, tt.expected, result.Inspect())
+		}
+	}
+
+	// MaxMetricHistorySize bounds the samples kept per metric
+	limits := *DefaultResourceLimits()
+	limits.MaxMetricHistorySize = 4
+	engine.SetResourceLimits(&limits)
+	if got := engine.evaluator.objectToFloat(evalSource(t, engine, `avg("custom.queue_depth", 1h)`)); got != 18.5 {
+		t.Errorf("expected the average of the 4 newest samples, got %v", got)
+	}
+	fake.Advance(30 * time.Second)
+	engine.UpdateCustomMetric("queue_depth", 21)
+	if history := engine.getCustomMetricHistory("queue_depth", time.Hour); len(history) != 4 || history[0].Value != 18 || history[3].Value != 21 {
+		t.Errorf("expected the 4 newest samples, got %+v", history)
+	}
+}
+
+func TestPrefixExpressions(t *testing.T) {
+	engine := NewEngine()
+
+	tests := []struct {
+		source   string
+		expected Object
+	}{
+		{"!(1 > 2)", TRUE},
+		{"!(heap.alloc > 0)", FALSE},
+		{"!0", TRUE},
+		{"!5", FALSE},
+		{"!!(1 < 2)", TRUE},
+		{"-5 < 0", TRUE},
+		{"-2.5 * 2 == -5", TRUE},
+		{"1 - -1 == 2", TRUE},
+	}
+
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if result != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.source, tt.expected.Inspect(), result.Inspect())
+		}
+	}
+
+	result := evalSource(t, engine, `when !(heap.alloc > 1GB) { log("heap below 1GB") }`)
+	if result != RULE_TRIGGERED {
+		t.Errorf("expected negated condition to trigger, got %s", result.Inspect())
+	}
+
+	result = evalSource(t, engine, `-"text"`)
+	if !isError(result) {
+		t.Errorf("expected error negating a string, got %s", result.Inspect())
+	}
+}
+
+func TestTimeUnits(t *testing.T) {
+	engine := NewEngine()
+
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		{"500ms", 500},
+		{"2s", 2000},
+		{"5m", 300000},
+		{"5M", 300000},
+		{"6h", 21600000},
+		{"1d", 86400000},
+		{"1D == 24h", 1},
+		{"200mb == 200MB", 1},
+	}
+
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if isError(result) {
+			t.Errorf("%q: unexpected error: %s", tt.source, result.Inspect())
+			continue
+		}
+		got := engine.evaluator.objectToFloat(result)
+		if result == TRUE {
+			got = 1
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.source, tt.expected, got)
+		}
+	}
+
+	if err := engine.UpdateCustomMetric("queue_depth", 4); err != nil {
+		t.Fatalf("failed to update custom metric: %v", err)
+	}
+	result := evalSource(t, engine, "avg(custom.queue_depth, 1d)")
+	if got := engine.evaluator.objectToFloat(result); got != 4 {
+		t.Errorf("expected day window average of 4, got %s", result.Inspect())
+	}
+
+	if err := engine.AddRule("slow_leak", `when trend(heap.alloc, 6h) > 0 { alert("slow leak") }`); err != nil {
+		t.Errorf("expected long-window rule to be accepted: %v", err)
+	}
+
+	result = evalSource(t, engine, "avg(custom.queue_depth, 5MB)")
+	if !isError(result) {
+		t.Errorf("expected error for non-time window unit, got %s", result.Inspect())
+	}
+}
+
+// capturingHandler records the actions it receives
+type capturingHandler struct {
+	actions []actions.Action
+}
+
+func (h *capturingHandler) Handle(action actions.Action) error {
+	h.actions = append(h.actions, action)
+	return nil
+}
+
+func TestAlertSeverity(t *testing.T) {
+	engine := NewEngine()
+	captured := &capturingHandler{}
+	engine.actionRegistry.RegisterObserver(captured)
+
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{`alert("disk nearly full", "critical")`, "critical"},
+		{`alert(severity: high, "queue backing up")`, "high"},
+		{`alert("retrying", severity: "LOW")`, "low"},
+		{`alert("memory leak suspected")`, "critical"},
+	}
+
+	for _, tt := range tests {
+		captured.actions = nil
+		result := evalSource(t, engine, tt.source)
+		if isError(result) {
+			t.Errorf("%q: unexpected error: %s", tt.source, result.Inspect())
+			continue
+		}
+		if len(captured.actions) != 1 || captured.actions[0].Severity != tt.expected {
+			t.Errorf("%q: expected severity %s, got %+v", tt.source, tt.expected, captured.actions)
+		}
+	}
+
+	result := evalSource(t, engine, `alert("oops", severity: urgent)`)
+	if !isError(result) {
+		t.Errorf("expected error for invalid severity, got %s", result.Inspect())
+	}
+
+	if err := engine.AddRule("bad_arg", `when heap.alloc > 0 { alert("x", priority: high) }`); err == nil {
+		t.Error("expected rule with unknown named argument to be rejected")
+	}
+}
+
+func TestLetBindings(t *testing.T) {
+	engine := NewEngine()
+
+	result := evalSource(t, engine, `
+		let ratio = heap.inuse / heap.sys
+		when ratio > 0 && ratio <= 1 { log("ratio") }`)
+	if result != RULE_TRIGGERED {
+		t.Errorf("expected rule using a let-binding to trigger, got %s", result.Inspect())
+	}
+
+	result = evalSource(t, engine, `when heap.alloc > 0 { let size = heap.alloc / 1MB; log(size) }`)
+	if result != RULE_TRIGGERED {
+		t.Errorf("expected let-binding inside a rule body to evaluate, got %s", result.Inspect())
+	}
+
+	result = evalSource(t, engine, `let a = 2; let b = a * 3; b + 1`)
+	if isError(result) || engine.evaluator.objectToFloat(result) != 7 {
+		t.Errorf("expected chained bindings to evaluate to 7, got %s", result.Inspect())
+	}
+
+	result = evalSource(t, engine, `when heap.alloc > 0 { let inner = 1 } inner`)
+	if !isError(result) {
+		t.Errorf("expected binding made in a rule body to be out of scope, got %s", result.Inspect())
+	}
+
+	if err := engine.AddRule("let_rule", `let ratio = heap.inuse / heap.sys; when ratio > 0.9 { alert("Heap nearly exhausted") }`); err != nil {
+		t.Errorf("expected rule with let-binding to be accepted: %v", err)
+	}
+
+	if err := engine.AddRule("bad_let", `let x = nope(1); when x > 0 { log("x") }`); err == nil {
+		t.Error("expected let-binding calling an unknown function to be rejected")
+	}
+}
+
+func TestRuleBodyActionSequencing(t *testing.T) {
+	engine := NewEngine()
+	captured := &capturingHandler{}
+	engine.actionRegistry.RegisterObserver(captured)
+
+	result := evalSource(t, engine, `when heap.alloc > 0 { log("first"); alert("second", severity: bogus); log("third") }`)
+	if result != RULE_TRIGGERED {
+		t.Fatalf("expected rule to trigger despite a failing action, got %s", result.Inspect())
+	}
+
+	if len(captured.actions) != 2 || captured.actions[0].Message != "first" || captured.actions[1].Message != "third" {
+		t.Errorf("expected actions to run in order around the failure, got %+v", captured.actions)
+	}
+
+	results := engine.evaluator.ActionResults()
+	if len(results) != 3 {
+		t.Fatalf("expected 3 action results, got %+v", results)
+	}
+	if !results[0].Success || results[1].Success || !results[2].Success {
+		t.Errorf("expected only the second action to fail, got %+v", results)
+	}
+	if results[1].Action != "alert" || results[1].Error == "" {
+		t.Errorf("expected failed alert result with error, got %+v", results[1])
+	}
+}
+
+func TestSetMetric(t *testing.T) {
+	engine := NewEngine()
+	captured := &capturingHandler{}
+	engine.actionRegistry.RegisterObserver(captured)
+
+	result := evalSource(t, engine, `when heap.sys > 0 { set_metric("custom.pressure_score", heap.alloc / heap.sys) }`)
+	if result != RULE_TRIGGERED {
+		t.Fatalf("expected set_metric rule to trigger, got %s", result.Inspect())
+	}
+
+	value, exists := engine.GetCustomMetric("pressure_score")
+	if !exists || value <= 0 || value > 1 {
+		t.Errorf("expected pressure_score between 0 and 1, got %v (exists=%v)", value, exists)
+	}
+	if len(captured.actions) != 1 || captured.actions[0].Type != actions.MetricAction || captured.actions[0].Metric != "custom.pressure_score" {
+		t.Errorf("expected a metric action to be observed, got %+v", captured.actions)
+	}
+
+	// Derived metrics are readable by other rules
+	result = evalSource(t, engine, `when custom.pressure_score > 0 { log("pressure") }`)
+	if result != RULE_TRIGGERED {
+		t.Errorf("expected rule reading the derived metric to trigger, got %s", result.Inspect())
+	}
+
+	for _, source := range []string{
+		`set_metric("heap.alloc", 1)`,
+		`set_metric("custom.label", "text")`,
+	} {
+		if result := evalSource(t, engine, source); !isError(result) {
+			t.Errorf("%q: expected error, got %s", source, result.Inspect())
+		}
+	}
+
+	if err := engine.AddRule("bad_set", `when heap.alloc > 0 { set_metric("custom.x") }`); err == nil {
+		t.Error("expected set_metric with one argument to be rejected")
+	}
+}
+
+func TestStringOperators(t *testing.T) {
+	engine := NewEngine()
+
+	tests := []struct {
+		source   string
+		expected bool
+	}{
+		{`"checkout" == "checkout"`, true},
+		{`"checkout" != "search"`, true},
+		{`"abc" < "abd"`, true},
+		{`"/api/v1/orders" matches "^/api/v1/.*"`, true},
+		{`"/api/v2/orders" matches "^/api/v1/.*"`, false},
+		{`"payment timeout" contains "timeout"`, true},
+		{`contains("payment timeout", "refused")`, false},
+		{`matches("GET", "^(GET|HEAD)$")`, true},
+		{`let route = "/api/v1/users"; route matches "/api/v1/" && heap.alloc > 0`, true},
+	}
+
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if isError(result) {
+			t.Errorf("%q: unexpected error: %s", tt.source, result.Inspect())
+			continue
+		}
+		if result != nativeBoolToPyObject(tt.expected) {
+			t.Errorf("%q: expected %v, got %s", tt.source, tt.expected, result.Inspect())
+		}
+	}
+
+	if result := evalSource(t, engine, `heap.alloc contains "1"`); !isError(result) {
+		t.Errorf("expected error for contains on a number, got %s", result.Inspect())
+	}
+
+	if err := engine.AddRule("bad_regex", `when "x" matches "(" { log("x") }`); err == nil {
+		t.Error("expected rule with invalid regular expression to be rejected")
+	}
+}
+
+func TestFormatFunction(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	captured := &capturingHandler{}
+	engine.actionRegistry.RegisterObserver(captured)
+
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{`format(1234567)`, "1,234,567"},
+		{`format(2.5, "number")`, "2.50"},
+		{`format(300MB, "bytes")`, "300.00 MiB"},
+		{`format(1500ms, "duration")`, "1.50 s"},
+		{`format(12.5, "percent")`, "12.50%"},
+		{`"Heap at " + format(2048, "bytes")`, "Heap at 2.00 KiB"},
+		{`"count: " + 42`, "count: 42"},
+	}
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		str, ok := result.(*String)
+		if !ok || str.Value != tt.expected {
+			t.Errorf("%q: expected %q, got %s", tt.source, tt.expected, result.Inspect())
+		}
+	}
+
+	for _, source := range []string{`format("x")`, `format(1, "furlongs")`, `format(1, 2)`} {
+		if result := evalSource(t, engine, source); !isError(result) {
+			t.Errorf("%q: expected an error, got %s", source, result.Inspect())
+		}
+	}
+
+	// Numbers in messages use the engine's value format
+	german := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0),
+		ValueFormat: units.Format{Locale: "de", System: units.SI, Precision: 1}})
+	german.actionRegistry.RegisterObserver(captured)
+	captured.actions = nil
+	evalSource(t, german, `alert(1234.56)`)
+	evalSource(t, german, `log("Heap: " + format(1500000, "bytes"))`)
+	if len(captured.actions) != 2 || captured.actions[0].Message != "1.234,6" || captured.actions[1].Message != "Heap: 1,5 MB" {
+		t.Errorf("expected messages in the configured format, got %+v", captured.actions)
+	}
+
+	if err := engine.AddRule("bad_format", `when heap.alloc > 0 { log(format(1, "bytes", 2)) }`); err == nil {
+		t.Error("expected format() with three arguments to be rejected")
+	}
+}
+
+func TestDuringClause(t *testing.T) {
+	engine := NewEngine()
+	// Wednesday 2024-01-03 03:30 local time
+	engine.evaluator.now = func() time.Time { return time.Date(2024, 1, 3, 3, 30, 0, 0, time.Local) }
+
+	tests := []struct {
+		window  string
+		trigger bool
+	}{
+		{"02:00-06:00", true},
+		{"06:00-08:00", false},
+		{"22:00-04:00", true},
+		{"Mon-Fri 03:00-04:00", true},
+		{"Sat,Sun 00:00-24:00", false},
+		{"Tue 23:00-04:00", true},
+		{"Wed 23:00-04:00", false},
+	}
+
+	for _, tt := range tests {
+		result := evalSource(t, engine, `when heap.alloc > 0 during "`+tt.window+`" { log("in window") }`)
+		if isError(result) {
+			t.Errorf("window %q: unexpected error %s", tt.window, result.Inspect())
+			continue
+		}
+		if (result == RULE_TRIGGERED) != tt.trigger {
+			t.Errorf("window %q: expected triggered=%v, got %s", tt.window, tt.trigger, result.Inspect())
+		}
+	}
+
+	for _, bad := range []string{"25:00-06:00", "02:00", "Funday 02:00-06:00", "02:00-02:00"} {
+		if err := engine.AddRule("bad_window", `when heap.alloc > 0 during "`+bad+`" { log("x") }`); err == nil {
+			t.Errorf("expected invalid window %q to be rejected", bad)
+		}
+	}
+}
+
+func TestEventConditions(t *testing.T) {
+	engine := NewEngine()
+	now := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+	engine.evaluator.now = func() time.Time { return now }
+	engine.eventIndex.add("deploy_finished", now.Add(-5*time.Minute))
+	engine.eventIndex.add("cache_rebuilt", now.Add(-30*time.Second))
+	engine.UpdateCustomMetric("error_rate", 3)
+
+	tests := []struct {
+		source  string
+		trigger bool
+	}{
+		{`when event("deploy_finished") && custom.error_rate > 2% within 10m { alert("bad deploy") }`, true},
+		{`when event("deploy_finished") && custom.error_rate > 5% within 10m { alert("bad deploy") }`, false},
+		{`when event("deploy_finished") within 2m { log("recent deploy") }`, false},
+		{`when event("deploy_finished") { log("recent deploy") }`, false},
+		{`when event("cache_rebuilt") { log("recent rebuild") }`, true},
+		{`when event("deploy_finished", 6m) within 1m { log("explicit window wins") }`, true},
+		{`when event("rollback") within 1d { log("never") }`, false},
+	}
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if isError(result) {
+			t.Errorf("%s: unexpected error %s", tt.source, result.Inspect())
+			continue
+		}
+		if (result == RULE_TRIGGERED) != tt.trigger {
+			t.Errorf("%s: expected triggered=%v, got %s", tt.source, tt.trigger, result.Inspect())
+		}
+	}
+
+	// Events emitted by the application are indexed as they are recorded
+	engine.evaluator.now = time.Now
+	engine.EmitEvent("rollback", "Rolled back to v41", nil)
+	if result := evalSource(t, engine, `when event("rollback") { log("rolled back") }`); result != RULE_TRIGGERED {
+		t.Errorf("expected an emitted event to satisfy event(), got %s", result.Inspect())
+	}
+
+	for _, bad := range []string{
+		`when event("deploy_finished") within 0m { log("x") }`,
+		`when event("deploy_finished") within 5MB { log("x") }`,
+		`when event("deploy_finished", 5MB) { log("x") }`,
+		`when event() { log("x") }`,
+	} {
+		if err := engine.AddRule("bad_event", bad); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+}
+
+func TestParseErrorPositions(t *testing.T) {
+	engine := NewEngine()
+	err := engine.AddRule("broken", "when heap.alloc > 1MB {\n  log(\"ok\")\n}\nwhen goroutines.count > {\n  log(\"bad\")\n}")
+	if err == nil {
+		t.Fatal("expected rule with a syntax error to be rejected")
+	}
+
+	var parseErrors parser.ParseErrors
+	if !errors.As(err, &parseErrors) || len(parseErrors) == 0 {
+		t.Fatalf("expected structured parse errors, got %v", err)
+	}
+	first := parseErrors[0]
+	if first.Line != 4 || first.Column != 25 || first.Token != "{" {
+		t.Errorf("expected error at 4:25 on '{', got %d:%d on %q", first.Line, first.Column, first.Token)
+	}
+	if first.Snippet != "when goroutines.count > {\n                        ^" {
+		t.Errorf("unexpected snippet:\n%s", first.Snippet)
+	}
+	if !strings.Contains(err.Error(), "line 4, column 25") {
+		t.Errorf("expected error message to include the position, got %v", err)
+	}
+
+	p := parser.New(parser.NewLexer(`when heap.alloc > 1MB {`))
+	p.ParseProgram()
+	if errs := p.Errors(); len(errs) == 0 || errs[len(errs)-1].Token != "end of input" {
+		t.Errorf("expected error at end of input, got %v", errs)
+	}
+}
+
+func TestAlertStateMetrics(t *testing.T) {
+	engine := NewEngine()
+	for i := 0; i < 3; i++ {
+		engine.dashboard.SendEventUpdate("alert", "Database critical", "db_check", nil)
+	}
+	engine.dashboard.SendEventUpdate("alert", "Queue backing up", "queue_check", nil)
+
+	result := evalSource(t, engine, `alerts.active_count`)
+	if engine.evaluator.objectToFloat(result) != 4 {
+		t.Errorf("expected 4 active alerts, got %s", result.Inspect())
+	}
+	result = evalSource(t, engine, `alerts.critical_count`)
+	if engine.evaluator.objectToFloat(result) != 3 {
+		t.Errorf("expected 3 critical alerts, got %s", result.Inspect())
+	}
+
+	engine.evaluator.SetCurrentRuleName("alert_storm")
+	result = evalSource(t, engine, `when alerts.active_count > 3 { alert("Alert storm", severity: critical); suppress_alerts() }`)
+	if result != RULE_TRIGGERED {
+		t.Fatalf("expected storm rule to trigger, got %s", result.Inspect())
+	}
+	counts := engine.GetAlertCounts()
+	if counts.Active != 1 || counts.Critical != 1 {
+		t.Errorf("expected only the storm alert to remain active, got %+v", counts)
+	}
+
+	if err := engine.AddRule("bad_suppress", `when alerts.active_count > 0 { suppress_alerts(1) }`); err == nil {
+		t.Error("expected suppress_alerts with arguments to be rejected")
+	}
+}
+
+func TestNamedRuleBlocks(t *testing.T) {
+	engine := NewEngine()
+	source := `let limit = 1
+when 1 > limit { log("loose") }
+rule "storm" {
+  description: "Always fires"
+  severity: critical
+  tags: "test", "storm"
+  when 2 > limit {
+    alert("Storm")
+  }
+}
+rule "quiet" {
+  when 0 > limit { alert("Never") }
+}`
+	names, err := engine.AddRules("shared", source)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(names, ",") != "storm,quiet,shared" {
+		t.Fatalf("unexpected rule names: %v", names)
+	}
+
+	var storm *Rule
+	for _, rule := range engine.GetRules() {
+		if rule.Name == "storm" {
+			storm = rule
+		}
+	}
+	if storm == nil {
+		t.Fatal("expected storm rule to be registered")
+	}
+	if storm.Description != "Always fires" || storm.Severity != "critical" || strings.Join(storm.Tags, ",") != "test,storm" {
+		t.Errorf("unexpected metadata: %+v", storm)
+	}
+
+	engine.evaluateRule(storm)
+	if counts := engine.GetAlertCounts(); counts.Critical != 1 {
+		t.Errorf("expected alert to use the rule's severity, got %+v", counts)
+	}
+
+	invalid := map[string]string{
+		"duplicate": `rule "a" { when 1 > 0 { log("x") } } rule "a" { when 1 > 0 { log("y") } }`,
+		"nested":    `rule "a" { rule "b" { when 1 > 0 { log("x") } } }`,
+		"severity":  `rule "a" { severity: urgent when 1 > 0 { log("x") } }`,
+		"unclosed":  `rule "a" { when 1 > 0 { log("x") }`,
+	}
+	for name, src := range invalid {
+		before := len(engine.GetRules())
+		if _, err := engine.AddRules(name, src); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		if len(engine.GetRules()) != before {
+			t.Errorf("%s: expected no rules to be added on error", name)
+		}
+	}
+
+	names, err = engine.AddRuleFile("../../descry-example/rules/memory.dscr")
+	if err != nil {
+		t.Fatalf("failed to load example rules: %v", err)
+	}
+	if len(names) != 6 {
+		t.Errorf("expected 6 rules from example file, got %v", names)
+	}
+}
+
+func TestRuleEvaluationInterval(t *testing.T) {
+	engine := NewEngine()
+	source := `rule "fast" {
+  when 1 > 0 { log("fast") }
+}
+rule "slow" {
+  every: 30s
+  when 1 > 0 { log("slow") }
+}`
+	if _, err := engine.AddRules("intervals", source); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fast, _ := engine.GetRule("fast")
+	slow, _ := engine.GetRule("slow")
+	if fast.Interval != 0 || slow.Interval != 30*time.Second {
+		t.Fatalf("unexpected intervals: fast %v, slow %v", fast.Interval, slow.Interval)
+	}
+
+	engine.EvaluateRules()
+	fastTrigger, slowTrigger := lastTrigger(engine, "fast"), lastTrigger(engine, "slow")
+	if fastTrigger.IsZero() || slowTrigger.IsZero() {
+		t.Fatal("expected both rules to run on the first evaluation")
+	}
+
+	engine.EvaluateRules()
+	if !lastTrigger(engine, "fast").After(fastTrigger) {
+		t.Error("expected the rule without an interval to run on every evaluation")
+	}
+	if !lastTrigger(engine, "slow").Equal(slowTrigger) {
+		t.Error("expected the rule with an interval to wait for it to elapse")
+	}
+
+	engine.schedule.evaluated("slow", time.Now().Add(-30*time.Second))
+	engine.EvaluateRules()
+	if !lastTrigger(engine, "slow").After(slowTrigger) {
+		t.Error("expected the rule to run once its interval elapsed")
+	}
+
+	for _, src := range []string{
+		`rule "a" { every: 30MB when 1 > 0 { log("x") } }`,
+		`rule "a" { every: 0s when 1 > 0 { log("x") } }`,
+		`rule "a" { every: "30s" when 1 > 0 { log("x") } }`,
+	} {
+		if _, err := engine.AddRules("invalid", src); err == nil {
+			t.Errorf("expected error for %s", src)
+		}
+	}
+}
+
+func TestAnomalyFunction(t *testing.T) {
+	engine := NewEngine()
+
+	for _, v := range []float64{100, 104, 98, 101, 97, 103, 99, 102} {
+		if err := engine.UpdateCustomMetric("latency", v); err != nil {
+			t.Fatalf("failed to update custom metric: %v", err)
+		}
+	}
+	normal := engine.evaluator.objectToFloat(evalSource(t, engine, `anomaly("custom.latency", 10m)`))
+	if normal > 3 || normal < -3 {
+		t.Errorf("expected a normal value to score within 3 deviations, got %v", normal)
+	}
+
+	if err := engine.UpdateCustomMetric("latency", 250); err != nil {
+		t.Fatalf("failed to update custom metric: %v", err)
+	}
+	result := evalSource(t, engine, `when anomaly("custom.latency", 10m) > 3 { log("latency anomaly") }`)
+	if result != RULE_TRIGGERED {
+		t.Errorf("expected spike to trigger anomaly rule, got %s", result.Inspect())
+	}
+
+	// Too little history to establish a baseline
+	if err := engine.UpdateCustomMetric("fresh", 1); err != nil {
+		t.Fatalf("failed to update custom metric: %v", err)
+	}
+	if got := engine.evaluator.objectToFloat(evalSource(t, engine, `anomaly("custom.fresh", 10m)`)); got != 0 {
+		t.Errorf("expected 0 without enough history, got %v", got)
+	}
+
+	if err := engine.AddRule("bad_anomaly", `when anomaly("custom.latency") > 3 { log("x") }`); err == nil {
+		t.Error("expected anomaly with one argument to be rejected")
+	}
+}
+
+func TestChangepointFunction(t *testing.T) {
+	engine := NewEngine()
+
+	// Request rate drops from about 100 to about 60 halfway through
+	for _, v := range []float64{100, 103, 98, 101, 99, 102, 61, 58, 62, 59, 60, 61} {
+		if err := engine.UpdateCustomMetric("request_rate", v); err != nil {
+			t.Fatalf("failed to update custom metric: %v", err)
+		}
+	}
+	drop := engine.evaluator.objectToFloat(evalSource(t, engine, `changepoint("custom.request_rate", 10m)`))
+	if drop > -10 {
+		t.Errorf("expected a large negative shift, got %v", drop)
+	}
+	result := evalSource(t, engine, `when changepoint("custom.request_rate", 10m) < -5 { log("traffic dropped") }`)
+	if result != RULE_TRIGGERED {
+		t.Errorf("expected the drop to trigger the rule, got %s", result.Inspect())
+	}
+
+	// Noise around a steady level is not a regime change
+	for _, v := range []float64{100, 104, 98, 101, 97, 103, 99, 102, 100, 98} {
+		if err := engine.UpdateCustomMetric("steady", v); err != nil {
+			t.Fatalf("failed to update custom metric: %v", err)
+		}
+	}
+	if got := engine.evaluator.objectToFloat(evalSource(t, engine, `changepoint("custom.steady", 10m)`)); got > 3 || got < -3 {
+		t.Errorf("expected noise to score within 3 deviations, got %v", got)
+	}
+
+	// A clean step between flat levels is measured against the earlier level
+	for _, v := range []float64{50, 50, 50, 80, 80, 80} {
+		if err := engine.UpdateCustomMetric("step", v); err != nil {
+			t.Fatalf("failed to update custom metric: %v", err)
+		}
+	}
+	if got := engine.evaluator.objectToFloat(evalSource(t, engine, `changepoint("custom.step", 10m)`)); got != 60 {
+		t.Errorf("expected a shift of 60 (30 against 1%% of 50), got %v", got)
+	}
+
+	for _, v := range []float64{5, 5, 5, 5, 5, 5} {
+		if err := engine.UpdateCustomMetric("flat", v); err != nil {
+			t.Fatalf("failed to update custom metric: %v", err)
+		}
+	}
+	if got := engine.evaluator.objectToFloat(evalSource(t, engine, `changepoint("custom.flat", 10m)`)); got != 0 {
+		t.Errorf("expected 0 for a flat metric, got %v", got)
+	}
+	for _, v := range []float64{10, 10, 90, 90} {
+		if err := engine.UpdateCustomMetric("fresh", v); err != nil {
+			t.Fatalf("failed to update custom metric: %v", err)
+		}
+	}
+	if got := engine.evaluator.objectToFloat(evalSource(t, engine, `changepoint("custom.fresh", 10m)`)); got != 0 {
+		t.Errorf("expected 0 without enough history, got %v", got)
+	}
+
+	if err := engine.AddRule("bad_changepoint", `when changepoint("custom.request_rate") < 0 { log("x") }`); err == nil {
+		t.Error("expected changepoint with one argument to be rejected")
+	}
+}
+
+func TestAlertStormCollapse(t *testing.T) {
+	engine := NewEngine()
+	engine.SetStormConfig(&actions.StormConfig{Threshold: 3})
+
+	for i := 0; i < 4; i++ {
+		engine.evaluator.SetCurrentRuleName(fmt.Sprintf("check_%d", i))
+		evalSource(t, engine, fmt.Sprintf(`when 1 > 0 { alert("Service %d down", severity: high) }`, i))
+	}
+
+	if status := engine.GetStormStatus(); status == nil || !status.Active || status.Pending != 1 {
+		t.Fatalf("expected an active storm with one held-back alert, got %+v", status)
+	}
+	if counts := engine.GetAlertCounts(); counts.Active != 1 || counts.Critical != 1 {
+		t.Errorf("expected only the storm alert to remain active, got %+v", counts)
+	}
+}
+
+func TestActionQuotas(t *testing.T) {
+	engine := NewEngine()
+	pager := &capturingHandler{}
+	engine.RegisterActionHandler("pager", pager)
+	if err := engine.SetRoutingConfig(&actions.RoutingConfig{Fallback: []string{"pager"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.SetActionQuotas(&actions.QuotaConfig{Handlers: map[string]int{"pager": 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	engine.evaluator.SetCurrentRuleName("runaway")
+	for i := 0; i < 5; i++ {
+		evalSource(t, engine, fmt.Sprintf(`when 1 > 0 { alert("Queue backing up %d") }`, i))
+	}
+
+	if len(pager.actions) != 2 {
+		t.Errorf("expected the pager quota to stop after 2 alerts, got %d", len(pager.actions))
+	}
+	if quotas := engine.GetActionQuotas(); len(quotas) != 1 || quotas[0].Used != 2 || quotas[0].Dropped != 3 || !quotas[0].Exceeded {
+		t.Errorf("unexpected quota status: %+v", quotas)
+	}
+	events := engine.QueryEvents(EventQuery{Types: []string{"action_quota_exceeded"}})
+	if len(events) != 1 || !strings.Contains(events[0].Message, "pager") {
+		t.Errorf("expected one overflow event, got %+v", events)
+	}
+	if err := engine.SetActionQuotas(&actions.QuotaConfig{Handlers: map[string]int{"sms": 1}}); err == nil {
+		t.Error("expected an error for a quota on an unregistered handler")
+	}
+}
+
+func TestBooleansAndConstants(t *testing.T) {
+	engine := NewEngine()
+
+	tests := []struct {
+		source   string
+		expected bool
+	}{
+		{"true", true},
+		{"!false", true},
+		{"true && false", false},
+		{"(1 > 0) == true", true},
+		{"false != false", false},
+	}
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		b, ok := result.(*Boolean)
+		if !ok || b.Value != tt.expected {
+			t.Errorf("%q: expected %v, got %s", tt.source, tt.expected, result.Inspect())
+		}
+	}
+
+	source := `const LIMIT = 2MB
+const HALF = LIMIT / 2
+rule "over_half" { when 1.5MB > HALF { log("over half") } }
+rule "over_limit" { when 1.5MB > LIMIT { log("over limit") } }`
+	if _, err := engine.AddRules("consts", source); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, rule := range engine.GetRules() {
+		var expected Object = NULL
+		if rule.Name == "over_half" {
+			expected = RULE_TRIGGERED
+		}
+		if result := engine.evaluator.Eval(rule.AST); result != expected {
+			t.Errorf("%s: expected %s, got %s", rule.Name, expected.Inspect(), result.Inspect())
+		}
+	}
+
+	invalid := map[string]string{
+		"metric":    `const LIMIT = heap.alloc`,
+		"call":      `const LIMIT = avg("heap.alloc", 5m)`,
+		"undefined": `const LIMIT = OTHER * 2`,
+		"duplicate": `const LIMIT = 1
+const LIMIT = 2`,
+		"reassign": `const LIMIT = 1
+when heap.alloc > 0 { let LIMIT = 2 }`,
+		"nested": `when heap.alloc > 0 { const LIMIT = 1 }`,
+	}
+	for name, src := range invalid {
+		if err := engine.AddRule(name, src); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRuleMetricPaths(t *testing.T) {
+	p := parser.New(parser.NewLexer(`let busy = goroutines.count
+when heap.alloc > 100MB && trend("heap.alloc", 5m) > 0 && avg(custom.orders.pending, 60) > busy {
+  alert("pressure")
+}`))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		t.Fatalf("parse errors: %v", p.Errors())
+	}
+	if paths := ruleMetricPaths(program); strings.Join(paths, ",") != "goroutines.count,heap.alloc,custom.orders.pending" {
+		t.Errorf("unexpected metric paths: %v", paths)
+	}
+}
+
+func TestWindowFunctionsWithFakeClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0), Clock: fake})
+
+	// The queue grows by 30 every 30 seconds
+	for _, depth := range []float64{10, 40, 70} {
+		if depth > 10 {
+			fake.Advance(30 * time.Second)
+		}
+		if err := engine.UpdateCustomMetric("queue.depth", depth); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		// A window excludes the sample taken exactly at its start
+		{`avg("custom.queue.depth", 60)`, 55},
+		{`avg("custom.queue.depth", 90)`, 40},
+		{`max("custom.queue.depth", 30)`, 70},
+		{`trend("custom.queue.depth", 90)`, 60},
+	}
+	for _, tt := range tests {
+		if got := engine.evaluator.objectToFloat(evalSource(t, engine, tt.source)); got != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.source, tt.expected, got)
+		}
+	}
+
+	fake.Advance(time.Minute)
+	if got := engine.evaluator.objectToFloat(evalSource(t, engine, `avg("custom.queue.depth", 60)`)); got != 0 {
+		t.Errorf("expected the samples to have left the window, got %v", got)
+	}
+
+	source := `rule "backlog" {
+  cooldown: 1m
+  when custom.queue.depth > 50 { log("queue backing up") }
+}`
+	if _, err := engine.AddRules("backlog", source); err != nil {
+		t.Fatal(err)
+	}
+	engine.EvaluateRules()
+	triggered := fake.Now()
+	if got := lastTrigger(engine, "backlog"); !got.Equal(triggered) {
+		t.Fatalf("expected the rule to trigger at %v, got %v", triggered, got)
+	}
+
+	fake.Advance(59 * time.Second)
+	engine.EvaluateRules()
+	if !lastTrigger(engine, "backlog").Equal(triggered) {
+		t.Error("expected the cooldown to hold the rule back")
+	}
+	fake.Advance(time.Second)
+	engine.EvaluateRules()
+	if !lastTrigger(engine, "backlog").Equal(fake.Now()) {
+		t.Error("expected the rule to trigger once the cooldown elapsed")
+	}
+}
+
+func TestUnitWordsAsNames(t *testing.T) {
+	engine := NewEngine()
+	for name, value := range map[string]float64{"d": 2, "mb": 3, "H": 4} {
+		if err := engine.UpdateCustomMetric(name, value); err != nil {
+			t.Fatalf("failed to update custom metric: %v", err)
+		}
+	}
+
+	// Unit words only read as units directly after a number
+	for _, source := range []string{
+		"custom.d > 1",
+		"custom.mb == 3",
+		"custom.H == 4",
+		"let h = 1; h == 1",
+		"let ms = 2; ms * 1s == 2000",
+	} {
+		if result := evalSource(t, engine, source); result != TRUE {
+			t.Errorf("%q: expected true, got %s", source, result.Inspect())
+		}
+	}
+	if err := engine.AddRule("units_as_names", `when custom.d > 1 && custom.MB < 10 { log("ok") }`); err != nil {
+		t.Errorf("expected unit words accepted as metric names: %v", err)
+	}
+}
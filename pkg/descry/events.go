@@ -0,0 +1,48 @@
+package descry
+
+import (
+	"sort"
+	"time"
+)
+
+// DefaultEventWindow is how far back event() looks when neither the call nor
+// its when statement's within clause gives a window
+const DefaultEventWindow = time.Minute
+
+// eventIndex records when events of each type occurred, so rules can ask
+// whether one happened within a time window. It is kept apart from the event
+// history so frequent rule triggers cannot push out a rare deploy event.
+type eventIndex struct {
+	maxPerType int
+	// times holds each type's event times, oldest first
+	times map[string][]time.Time
+}
+
+func newEventIndex(maxPerType int) *eventIndex {
+	return &eventIndex{maxPerType: maxPerType, times: make(map[string][]time.Time)}
+}
+
+// add records an event of eventType at the given time, dropping the oldest
+// time of that type once maxPerType are kept
+func (i *eventIndex) add(eventType string, at time.Time) {
+	times := append(i.times[eventType], at)
+	if len(times) > i.maxPerType {
+		times = times[len(times)-i.maxPerType:]
+	}
+	i.times[eventType] = times
+}
+
+// countSince returns the number of events of eventType at or after since
+func (i *eventIndex) countSince(eventType string, since time.Time) int {
+	times := i.times[eventType]
+	first := sort.Search(len(times), func(n int) bool { return !times[n].Before(since) })
+	return len(times) - first
+}
+
+// countEventsSince returns the number of events of eventType recorded at or
+// after since, including events older than the event history retains
+func (e *Engine) countEventsSince(eventType string, since time.Time) int {
+	e.eventMutex.RLock()
+	defer e.eventMutex.RUnlock()
+	return e.eventIndex.countSince(eventType, since)
+}
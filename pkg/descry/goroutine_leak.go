@@ -0,0 +1,367 @@
+package descry
+
+import (
+	"bytes"
+	"math"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/parser"
+)
+
+// Goroutine leak detection profiles every goroutine once a minute and groups
+// them by creation site, the go statement that started them. A site whose
+// goroutine count has not fallen across the last few profiles and has grown
+// by at least goroutineLeakMinGrowth is a leak suspect. Rules read the
+// number of suspect sites as goroutines.leak_suspects, and alerts raised by
+// those rules carry the top suspects' stacks.
+//
+// Profiles are kept for goroutineLeakHistory, so goroutine_leak(window) can
+// apply the same test over a window of the rule's choosing and
+// goroutines.by_site(site) can read a single site's count and growth.
+const (
+	// goroutineProfileInterval is how often goroutines are profiled
+	goroutineProfileInterval = time.Minute
+	// goroutineLeakProfiles is the number of profiles a site's counts are
+	// compared across
+	goroutineLeakProfiles = 5
+	// goroutineLeakMinGrowth is the growth across those profiles a site
+	// needs to be a suspect, so pools warming up are not reported
+	goroutineLeakMinGrowth = 5
+	// maxGoroutineLeakSuspects bounds the suspects attached to an alert
+	maxGoroutineLeakSuspects = 3
+	// maxGoroutineStackBytes bounds the example stack kept per suspect
+	maxGoroutineStackBytes = 4096
+	// goroutineLeakHistory is how long profiles are kept, and the longest
+	// window goroutine_leak() accepts
+	goroutineLeakHistory = time.Hour
+	// maxGoroutineSiteMetrics bounds the sites sent to the dashboard
+	maxGoroutineSiteMetrics = 20
+)
+
+// goroutineSiteFunction reads a creation site's statistics in rules, as in
+// goroutines.by_site("main.startWorker").growth
+const goroutineSiteFunction = "goroutines.by_site"
+
+// goroutineSiteStatistics are the statistics goroutines.by_site() provides
+var goroutineSiteStatistics = map[string]func(GoroutineSiteStats) Object{
+	"count":  func(stats GoroutineSiteStats) Object { return &Integer{Value: int64(stats.Count)} },
+	"growth": func(stats GoroutineSiteStats) Object { return &Integer{Value: int64(stats.Growth)} },
+}
+
+// GoroutineLeakSuspect is a creation site whose goroutine count keeps growing
+type GoroutineLeakSuspect struct {
+	// Site is the function and file:line of the go statement, e.g.
+	// "main.startWorker at /app/worker.go:42"
+	Site string `json:"site"`
+	// Count is the site's goroutine count in the latest profile
+	Count int `json:"count"`
+	// Growth is the increase in Count across the compared profiles
+	Growth int `json:"growth"`
+	// Stack is the stack of one goroutine the site created
+	Stack string `json:"stack"`
+}
+
+// GoroutineSiteStats describes the goroutines started by one function
+type GoroutineSiteStats struct {
+	// Function is the function containing the go statements, e.g.
+	// "main.startWorker"
+	Function string `json:"function"`
+	// Count is the function's goroutine count in the latest profile
+	Count int `json:"count"`
+	// Growth is the increase in Count across the last goroutineLeakProfiles
+	// profiles, negative if goroutines finished
+	Growth int `json:"growth"`
+}
+
+// goroutineProfile is the goroutine count and an example stack per site.
+// Only the latest profile keeps its stacks.
+type goroutineProfile struct {
+	at     time.Time
+	counts map[string]int
+	stacks map[string]string
+}
+
+// goroutineLeakDetector keeps recent goroutine profiles and the suspects
+// found in them
+type goroutineLeakDetector struct {
+	mutex       sync.RWMutex
+	lastProfile time.Time
+	profiles    []goroutineProfile
+	suspects    []GoroutineLeakSuspect
+}
+
+// observe profiles goroutines if goroutineProfileInterval has passed since
+// the last profile
+func (d *goroutineLeakDetector) observe(now time.Time) {
+	d.mutex.RLock()
+	due := d.lastProfile.IsZero() || now.Sub(d.lastProfile) >= goroutineProfileInterval
+	d.mutex.RUnlock()
+	if !due {
+		return
+	}
+	d.record(now, parseGoroutineProfile(goroutineDump()))
+}
+
+// record adds a profile, drops those older than goroutineLeakHistory and
+// finds the suspects across the last goroutineLeakProfiles
+func (d *goroutineLeakDetector) record(now time.Time, profile goroutineProfile) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.lastProfile = now
+	profile.at = now
+	if len(d.profiles) > 0 {
+		d.profiles[len(d.profiles)-1].stacks = nil
+	}
+	d.profiles = append(d.profiles, profile)
+	cutoff := now.Add(-goroutineLeakHistory)
+	for len(d.profiles) > 1 && d.profiles[0].at.Before(cutoff) {
+		d.profiles = d.profiles[1:]
+	}
+	d.suspects = nil
+	if len(d.profiles) >= goroutineLeakProfiles {
+		d.suspects = findGoroutineLeaks(d.profiles[len(d.profiles)-goroutineLeakProfiles:])
+	}
+}
+
+// findGoroutineLeaks returns the sites whose counts never fell across
+// profiles and grew by at least goroutineLeakMinGrowth, fastest growing first
+func findGoroutineLeaks(profiles []goroutineProfile) []GoroutineLeakSuspect {
+	if len(profiles) < 2 {
+		return nil
+	}
+	latest := profiles[len(profiles)-1]
+	var suspects []GoroutineLeakSuspect
+	for site, count := range latest.counts {
+		growing := true
+		for i := 1; i < len(profiles) && growing; i++ {
+			growing = profiles[i].counts[site] >= profiles[i-1].counts[site]
+		}
+		growth := count - profiles[0].counts[site]
+		if growing && growth >= goroutineLeakMinGrowth {
+			suspects = append(suspects, GoroutineLeakSuspect{
+				Site:   site,
+				Count:  count,
+				Growth: growth,
+				Stack:  latest.stacks[site],
+			})
+		}
+	}
+	sort.Slice(suspects, func(i, j int) bool {
+		if suspects[i].Growth != suspects[j].Growth {
+			return suspects[i].Growth > suspects[j].Growth
+		}
+		return suspects[i].Site < suspects[j].Site
+	})
+	return suspects
+}
+
+// goroutineDump returns the stacks of all goroutines in runtime.Stack format
+func goroutineDump() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// parseGoroutineProfile groups the goroutines of a runtime.Stack dump by
+// creation site. Goroutines without one, such as main, are skipped.
+func parseGoroutineProfile(dump []byte) goroutineProfile {
+	profile := goroutineProfile{counts: make(map[string]int), stacks: make(map[string]string)}
+	for _, block := range bytes.Split(dump, []byte("\n\n")) {
+		lines := strings.Split(strings.TrimSpace(string(block)), "\n")
+		for i, line := range lines {
+			if !strings.HasPrefix(line, "created by ") || i+1 >= len(lines) {
+				continue
+			}
+			function := strings.TrimPrefix(line, "created by ")
+			if at := strings.Index(function, " in goroutine "); at >= 0 {
+				function = function[:at]
+			}
+			location := strings.TrimSpace(lines[i+1])
+			if at := strings.LastIndex(location, " +0x"); at >= 0 {
+				location = location[:at]
+			}
+			site := function + " at " + location
+			profile.counts[site]++
+			if _, exists := profile.stacks[site]; !exists {
+				stack := strings.Join(lines, "\n")
+				if len(stack) > maxGoroutineStackBytes {
+					stack = stack[:maxGoroutineStackBytes]
+				}
+				profile.stacks[site] = stack
+			}
+			break
+		}
+	}
+	return profile
+}
+
+// leaksWithin returns the sites that grew steadily across the profiles taken
+// within window of now, fastest growing first
+func (d *goroutineLeakDetector) leaksWithin(now time.Time, window time.Duration) []GoroutineLeakSuspect {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	cutoff := now.Add(-window)
+	first := len(d.profiles)
+	for first > 0 && !d.profiles[first-1].at.Before(cutoff) {
+		first--
+	}
+	return findGoroutineLeaks(d.profiles[first:])
+}
+
+// siteStats returns the statistics of the goroutines started by function,
+// summed over its go statements. A full site such as
+// "main.startWorker at /app/worker.go:42" selects that go statement alone.
+func (d *goroutineLeakDetector) siteStats(function string) GoroutineSiteStats {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	stats := GoroutineSiteStats{Function: function}
+	if len(d.profiles) == 0 {
+		return stats
+	}
+	latest := d.profiles[len(d.profiles)-1]
+	oldest := d.profiles[max(0, len(d.profiles)-goroutineLeakProfiles)]
+	matches := func(site string) bool {
+		return site == function || siteFunction(site) == function
+	}
+	for site, count := range latest.counts {
+		if matches(site) {
+			stats.Count += count
+			stats.Growth += count
+		}
+	}
+	for site, count := range oldest.counts {
+		if matches(site) {
+			stats.Growth -= count
+		}
+	}
+	return stats
+}
+
+// sites returns the statistics of every function that started goroutines in
+// the latest profile, most goroutines first
+func (d *goroutineLeakDetector) sites() []GoroutineSiteStats {
+	d.mutex.RLock()
+	functions := make(map[string]bool)
+	if len(d.profiles) > 0 {
+		for site := range d.profiles[len(d.profiles)-1].counts {
+			functions[siteFunction(site)] = true
+		}
+	}
+	d.mutex.RUnlock()
+
+	sites := make([]GoroutineSiteStats, 0, len(functions))
+	for function := range functions {
+		sites = append(sites, d.siteStats(function))
+	}
+	sort.Slice(sites, func(i, j int) bool {
+		if sites[i].Count != sites[j].Count {
+			return sites[i].Count > sites[j].Count
+		}
+		return sites[i].Function < sites[j].Function
+	})
+	return sites
+}
+
+// siteFunction returns the function of a creation site
+func siteFunction(site string) string {
+	function, _, _ := strings.Cut(site, " at ")
+	return function
+}
+
+// lastProfiled returns when goroutines were last profiled, zero if never
+func (d *goroutineLeakDetector) lastProfiled() time.Time {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.lastProfile
+}
+
+// suspectCount returns the number of suspect creation sites
+func (d *goroutineLeakDetector) suspectCount() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return len(d.suspects)
+}
+
+// topSuspects returns up to n suspects, fastest growing first
+func (d *goroutineLeakDetector) topSuspects(n int) []GoroutineLeakSuspect {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	if n > len(d.suspects) {
+		n = len(d.suspects)
+	}
+	return append([]GoroutineLeakSuspect(nil), d.suspects[:n]...)
+}
+
+// GoroutineLeakSuspects returns the goroutine creation sites whose counts
+// have grown steadily across recent profiles, fastest growing first. The
+// engine profiles goroutines once a minute while rules are evaluated, so
+// suspects appear after about five minutes.
+func (e *Engine) GoroutineLeakSuspects() []GoroutineLeakSuspect {
+	return e.goroutineLeaks.topSuspects(math.MaxInt)
+}
+
+// GoroutinesBySite returns the goroutines started by each function in the
+// latest profile, with their growth over the last five profiles, most
+// goroutines first. Rules read the same statistics as
+// goroutines.by_site("<function>").count and .growth.
+func (e *Engine) GoroutinesBySite() []GoroutineSiteStats {
+	return e.goroutineLeaks.sites()
+}
+
+// evalGoroutineLeakCall evaluates goroutine_leak(window), the number of
+// creation sites whose goroutine counts never fell and grew by at least
+// goroutineLeakMinGrowth across the profiles taken within the window
+func (e *Evaluator) evalGoroutineLeakCall(arguments []parser.Expression) Object {
+	if len(arguments) != 1 {
+		return newError("wrong number of arguments for goroutine_leak: got=%d, want=1", len(arguments))
+	}
+	windowArg := e.Eval(arguments[0])
+	if isError(windowArg) {
+		return windowArg
+	}
+	if unit, ok := arguments[0].(*parser.UnitExpression); ok {
+		if !isTimeUnit(unit.Unit) {
+			return newError("argument to goroutine_leak() must be a time duration, got unit %s", unit.Unit)
+		}
+		// Time units evaluate to milliseconds
+		windowArg = &Float{Value: e.objectToFloat(windowArg) / 1000}
+	}
+	window, ok := e.extractDuration(windowArg)
+	if !ok || window <= 0 || window > goroutineLeakHistory {
+		return newError("argument to goroutine_leak() must be a time duration of at most %s", goroutineLeakHistory)
+	}
+	return &Integer{Value: int64(len(e.engine.goroutineLeaks.leaksWithin(e.now(), window)))}
+}
+
+// evalGoroutineSite returns a statistic of goroutines.by_site(function)
+func (e *Evaluator) evalGoroutineSite(call *parser.CallExpression, statExpr parser.Expression) Object {
+	stat, ok := statExpr.(*parser.Identifier)
+	if !ok {
+		return newError("invalid dot expression: %s.%s", call.String(), statExpr.String())
+	}
+	value, known := goroutineSiteStatistics[stat.Value]
+	if !known {
+		return newError("unknown goroutine site statistic %q (expected count or growth)", stat.Value)
+	}
+	if len(call.Arguments) != 1 {
+		return newError("wrong number of arguments for %s: got=%d, want=1", goroutineSiteFunction, len(call.Arguments))
+	}
+	arg := e.Eval(call.Arguments[0])
+	if isError(arg) {
+		return arg
+	}
+	function, ok := arg.(*String)
+	if !ok || function.Value == "" {
+		return newError("argument to %s() must be a string", goroutineSiteFunction)
+	}
+	return value(e.engine.goroutineLeaks.siteStats(function.Value))
+}
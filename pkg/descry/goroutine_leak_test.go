@@ -0,0 +1,149 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/clock"
+)
+
+// startBlockedGoroutines starts n goroutines from one creation site that
+// block until done is closed
+func startBlockedGoroutines(n int, done chan struct{}) {
+	for i := 0; i < n; i++ {
+		go func() { <-done }()
+	}
+}
+
+func TestParseGoroutineProfile(t *testing.T) {
+	dump := `goroutine 1 [running]:
+main.main()
+	/app/main.go:10 +0x1d
+
+goroutine 7 [chan receive]:
+main.worker()
+	/app/worker.go:20 +0x25
+created by main.start in goroutine 1
+	/app/worker.go:12 +0x4f
+
+goroutine 8 [chan receive]:
+main.worker()
+	/app/worker.go:20 +0x25
+created by main.start in goroutine 1
+	/app/worker.go:12 +0x4f
+`
+	profile := parseGoroutineProfile([]byte(dump))
+	site := "main.start at /app/worker.go:12"
+	if len(profile.counts) != 1 || profile.counts[site] != 2 {
+		t.Fatalf("expected 2 goroutines from %s, got %v", site, profile.counts)
+	}
+	if !strings.HasPrefix(profile.stacks[site], "goroutine 7 [chan receive]:\nmain.worker()") {
+		t.Errorf("unexpected example stack: %q", profile.stacks[site])
+	}
+}
+
+func TestGoroutineLeakDetector(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.AddRule("goroutine_leak", `when goroutines.leak_suspects > 0 { alert("goroutine leak") }`); err != nil {
+		t.Fatal(err)
+	}
+
+	// One profile per minute, with the site growing between profiles
+	for i := 0; i < goroutineLeakProfiles; i++ {
+		startBlockedGoroutines(3, done)
+		engine.EvaluateRules()
+		if i < goroutineLeakProfiles-1 && len(engine.GoroutineLeakSuspects()) != 0 {
+			t.Fatalf("expected no suspects after %d profiles", i+1)
+		}
+		// Profiles are taken at most once a minute
+		engine.EvaluateRules()
+		fake.Advance(goroutineProfileInterval)
+	}
+
+	suspects := engine.GoroutineLeakSuspects()
+	if len(suspects) == 0 || !strings.Contains(suspects[0].Site, "startBlockedGoroutines") ||
+		suspects[0].Growth != 12 || !strings.Contains(suspects[0].Stack, "goroutine_leak_test.go") {
+		t.Fatalf("expected startBlockedGoroutines as the top suspect, got %+v", suspects)
+	}
+	if value, _ := engine.SnapshotMetrics()["goroutines.leak_suspects"]; value != float64(len(suspects)) {
+		t.Errorf("expected goroutines.leak_suspects = %d, got %v", len(suspects), value)
+	}
+
+	// The alert carries the top suspects
+	events := engine.GetEventHistory(0, "alert")
+	if len(events) == 0 {
+		t.Fatal("expected an alert event")
+	}
+	attached, _ := events[0].Data["goroutine_leak_suspects"].([]GoroutineLeakSuspect)
+	if len(attached) == 0 || attached[0].Site != suspects[0].Site {
+		t.Errorf("expected the alert to carry the suspects, got %+v", events[0].Data)
+	}
+}
+
+// startParkedGoroutines is a second creation site, so its counts are not
+// shared with goroutines of other tests still exiting
+func startParkedGoroutines(n int, done chan struct{}) {
+	for i := 0; i < n; i++ {
+		go func() { <-done }()
+	}
+}
+
+func TestGoroutineLeakWindow(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake, Logger: log.New(io.Discard, "", 0)})
+	for i := 0; i < 4; i++ {
+		startParkedGoroutines(3, done)
+		engine.EvaluateRules()
+		fake.Advance(goroutineProfileInterval)
+	}
+
+	site := `goroutines.by_site("github.com/chosenoffset/descry/pkg/descry.startParkedGoroutines")`
+	tests := []struct {
+		source   string
+		expected bool
+	}{
+		{"goroutine_leak(3m) > 0", true},
+		{"goroutine_leak(1m) > 0", false}, // 3 goroutines are too few to suspect
+		{site + ".count == 12", true},
+		{site + ".growth == 9", true},
+		{`goroutines.by_site("main.unknown").count == 0`, true},
+	}
+	for _, tt := range tests {
+		if result := evalSource(t, engine, tt.source); result != nativeBoolToPyObject(tt.expected) {
+			t.Errorf("%s: expected %v, got %s", tt.source, tt.expected, result.Inspect())
+		}
+	}
+
+	var found bool
+	for _, stats := range engine.GoroutinesBySite() {
+		if strings.HasSuffix(stats.Function, ".startParkedGoroutines") {
+			found = stats.Count == 12 && stats.Growth == 9
+		}
+	}
+	if !found {
+		t.Errorf("expected startParkedGoroutines among the sites, got %+v", engine.GoroutinesBySite())
+	}
+
+	for _, rule := range []string{
+		`when goroutine_leak(5MB) > 0 { log("leak") }`,
+		`when goroutine_leak() > 0 { log("leak") }`,
+		`when goroutines.by_site("main.worker").bogus > 0 { log("leak") }`,
+	} {
+		if err := engine.AddRule("invalid", rule); err == nil {
+			t.Errorf("expected %q to be rejected", rule)
+		}
+	}
+	if result := evalSource(t, engine, "goroutine_leak(2h)"); !isError(result) {
+		t.Errorf("expected a window beyond the profile history to fail, got %s", result.Inspect())
+	}
+}
@@ -0,0 +1,134 @@
+package descry
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/chosenoffset/descry/pkg/descry/metrics"
+)
+
+// reservedHTTPServerNames are the http.* namespaces used by the default
+// middleware's own metrics
+var reservedHTTPServerNames = map[string]bool{
+	"segment": true, "route": true, "method": true,
+}
+
+// HTTPMiddlewareNamed returns HTTP middleware that records requests under
+// their own namespace, for applications serving several muxes, such as a
+// public API and an admin interface, whose traffic should be watched
+// separately. Requests it records are read in rules as http.<name>.<metric>,
+// e.g. http.admin.error_rate or http.admin.segment.db, and are not counted in
+// the http.* metrics of HTTPMiddleware.
+//
+// Calling it again with the same name returns middleware recording into the
+// same statistics. Named middleware uses the exclusions and route labeler set
+// with SetHTTPExclusions and SetRouteLabeler. It panics if name is not an
+// identifier or is one of segment, route and method.
+//
+// Example:
+//
+//	admin := http.NewServeMux()
+//	admin.HandleFunc("/users", engine.HTTPMiddlewareNamed("admin")(usersHandler))
+//
+//	engine.AddRule("admin_errors", `when http.admin.error_rate > 1 { alert("Admin errors") }`)
+func (e *Engine) HTTPMiddlewareNamed(name string) func(http.HandlerFunc) http.HandlerFunc {
+	if !providerNamePattern.MatchString(name) || reservedHTTPServerNames[name] {
+		panic(fmt.Sprintf("descry: invalid HTTP middleware name %q", name))
+	}
+	return e.httpServer(name, true).Middleware
+}
+
+// httpServer returns the metrics of the named middleware, creating them
+// configured like the default middleware's if create is set
+func (e *Engine) httpServer(name string, create bool) *metrics.HTTPMetrics {
+	e.httpServersMutex.Lock()
+	defer e.httpServersMutex.Unlock()
+	if server, exists := e.httpServers[name]; exists || !create {
+		return server
+	}
+	server := metrics.NewHTTPMetrics(e.config.HTTPSampleSize)
+	server.SetClock(e.clock)
+	server.SetExclusions(e.httpMetrics.GetExclusions())
+	server.SetRouteLabeler(e.httpMetrics.GetRouteLabeler())
+	if e.httpServers == nil {
+		e.httpServers = make(map[string]*metrics.HTTPMetrics)
+	}
+	e.httpServers[name] = server
+	return server
+}
+
+// namedHTTPServers returns the metrics of every named middleware by name
+func (e *Engine) namedHTTPServers() map[string]*metrics.HTTPMetrics {
+	e.httpServersMutex.Lock()
+	defer e.httpServersMutex.Unlock()
+	servers := make(map[string]*metrics.HTTPMetrics, len(e.httpServers))
+	for name, server := range e.httpServers {
+		servers[name] = server
+	}
+	return servers
+}
+
+// GetHTTPServerNames returns the names of the middleware created with
+// HTTPMiddlewareNamed, sorted
+func (e *Engine) GetHTTPServerNames() []string {
+	servers := e.namedHTTPServers()
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetHTTPServerMetrics returns the HTTP statistics of the middleware created
+// with HTTPMiddlewareNamed(name), and false if there is none
+func (e *Engine) GetHTTPServerMetrics(name string) (metrics.HTTPStats, bool) {
+	server := e.httpServer(name, false)
+	if server == nil {
+		return metrics.HTTPStats{}, false
+	}
+	return server.GetStats(), true
+}
+
+// httpSnapshot returns the HTTP metrics of stats under prefix, in the units
+// rules use
+func httpSnapshot(prefix string, stats metrics.HTTPStats) map[string]float64 {
+	return map[string]float64{
+		prefix + ".request_count":     float64(stats.RequestCount),
+		prefix + ".error_count":       float64(stats.ErrorCount),
+		prefix + ".error_rate":        stats.ErrorRate,
+		prefix + ".request_rate":      stats.RequestRate,
+		prefix + ".response_time":     float64(stats.AvgResponseTime) / 1000000,
+		prefix + ".max_response_time": float64(stats.MaxResponseTime) / 1000000,
+		prefix + ".p50_response_time": float64(stats.P50ResponseTime) / 1000000,
+		prefix + ".p90_response_time": float64(stats.P90ResponseTime) / 1000000,
+		prefix + ".p95_response_time": float64(stats.P95ResponseTime) / 1000000,
+		prefix + ".p99_response_time": float64(stats.P99ResponseTime) / 1000000,
+		prefix + ".pending_requests":  float64(stats.PendingRequests),
+		prefix + ".avg_request_size":  stats.AvgRequestSize,
+		prefix + ".avg_response_size": stats.AvgResponseSize,
+		prefix + ".bytes_per_second":  stats.BytesPerSecond,
+	}
+}
+
+// httpDashboardMetrics returns the HTTP metrics of stats under prefix as the
+// dashboard records them, with durations in nanoseconds
+func httpDashboardMetrics(prefix string, stats metrics.HTTPStats) map[string]interface{} {
+	return map[string]interface{}{
+		prefix + ".request_count":     stats.RequestCount,
+		prefix + ".error_count":       stats.ErrorCount,
+		prefix + ".error_rate":        stats.ErrorRate,
+		prefix + ".request_rate":      stats.RequestRate,
+		prefix + ".response_time":     stats.AvgResponseTime,
+		prefix + ".max_response_time": stats.MaxResponseTime,
+		prefix + ".p50_response_time": stats.P50ResponseTime,
+		prefix + ".p90_response_time": stats.P90ResponseTime,
+		prefix + ".p95_response_time": stats.P95ResponseTime,
+		prefix + ".p99_response_time": stats.P99ResponseTime,
+		prefix + ".pending_requests":  stats.PendingRequests,
+		prefix + ".avg_request_size":  stats.AvgRequestSize,
+		prefix + ".avg_response_size": stats.AvgResponseSize,
+		prefix + ".bytes_per_second":  stats.BytesPerSecond,
+	}
+}
@@ -0,0 +1,175 @@
+package descry
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chosenoffset/descry/pkg/descry/parser"
+)
+
+// importResolver expands import statements into the statements of the files
+// they name. Paths are resolved relative to root and may not leave it.
+type importResolver struct {
+	root string
+	// stack holds the files currently being expanded, to detect cycles
+	stack []string
+	// loaded records files already expanded so diamond imports apply once
+	loaded map[string]bool
+	// texts receives the source text of each imported statement
+	texts map[parser.Statement]string
+}
+
+// resolveImports replaces the import statements in program with the constants
+// and bindings of the imported files, recording their source text in texts.
+// importer is the path of the file being loaded, if any, so that a file
+// importing itself is reported as a cycle.
+func resolveImports(program *parser.Program, root, importer string, texts map[parser.Statement]string) error {
+	r := &importResolver{root: root, loaded: make(map[string]bool), texts: texts}
+	if importer != "" {
+		abs, err := filepath.Abs(importer)
+		if err != nil {
+			return err
+		}
+		r.stack = append(r.stack, abs)
+		r.loaded[abs] = true
+	}
+
+	statements, err := r.expand(program.Statements)
+	if err != nil {
+		return err
+	}
+	program.Statements = statements
+	return nil
+}
+
+// expand returns statements with each import replaced by the imported file's
+// statements
+func (r *importResolver) expand(statements []parser.Statement) ([]parser.Statement, error) {
+	var expanded []parser.Statement
+	for _, stmt := range statements {
+		imp, ok := stmt.(*parser.ImportStatement)
+		if !ok {
+			expanded = append(expanded, stmt)
+			continue
+		}
+
+		imported, err := r.load(imp)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, imported...)
+	}
+	return expanded, nil
+}
+
+// load parses and expands one imported file
+func (r *importResolver) load(imp *parser.ImportStatement) ([]parser.Statement, error) {
+	path, err := r.resolvePath(imp.Path.Value)
+	if err != nil {
+		return nil, fmt.Errorf("import %q at line %d: %w", imp.Path.Value, imp.Token.Line, err)
+	}
+
+	for i, p := range r.stack {
+		if p == path {
+			cycle := append(append([]string{}, r.stack[i:]...), path)
+			for j := range cycle {
+				cycle[j] = r.display(cycle[j])
+			}
+			return nil, fmt.Errorf("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	if r.loaded[path] {
+		return nil, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("import %q at line %d: %w", imp.Path.Value, imp.Token.Line, err)
+	}
+
+	p := parser.New(parser.NewLexer(string(content)))
+	program := p.ParseProgram()
+	if len(p.Errors()) > 0 {
+		return nil, fmt.Errorf("import %q: parse errors: %w", imp.Path.Value, parser.ParseErrors(p.Errors()))
+	}
+
+	// Imported files share definitions; rules belong in the importing file
+	for _, stmt := range program.Statements {
+		switch stmt.(type) {
+		case *parser.ConstStatement, *parser.LetStatement, *parser.ImportStatement:
+		default:
+			return nil, fmt.Errorf("import %q: only const, let and import statements may be imported, found %q",
+				imp.Path.Value, stmt.TokenLiteral())
+		}
+	}
+
+	recordStatementTexts(r.texts, program.Statements, string(content))
+	r.stack = append(r.stack, path)
+	r.loaded[path] = true
+	statements, err := r.expand(program.Statements)
+	r.stack = r.stack[:len(r.stack)-1]
+	return statements, err
+}
+
+// recordStatementTexts records the source text of each top-level statement,
+// from its first token up to the next statement
+func recordStatementTexts(texts map[parser.Statement]string, statements []parser.Statement, source string) {
+	for i, stmt := range statements {
+		start, end := statementPosition(stmt), len(source)
+		if i+1 < len(statements) {
+			end = statementPosition(statements[i+1])
+		}
+		if start >= 0 && start <= end && end <= len(source) {
+			texts[stmt] = strings.TrimSpace(source[start:end])
+		}
+	}
+}
+
+// statementPosition returns the offset of a statement's first token, or -1
+func statementPosition(stmt parser.Statement) int {
+	switch s := stmt.(type) {
+	case *parser.LetStatement:
+		return s.Token.Position
+	case *parser.ConstStatement:
+		return s.Token.Position
+	case *parser.ImportStatement:
+		return s.Token.Position
+	case *parser.RuleStatement:
+		return s.Token.Position
+	case *parser.WhenStatement:
+		return s.Token.Position
+	case *parser.ExpressionStatement:
+		return s.Token.Position
+	}
+	return -1
+}
+
+// resolvePath turns an import path into an absolute path inside the root
+func (r *importResolver) resolvePath(name string) (string, error) {
+	if name == "" || filepath.IsAbs(name) {
+		return "", fmt.Errorf("import paths must be relative to the rules directory")
+	}
+	root, err := filepath.Abs(r.root)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(root, filepath.FromSlash(name))
+	if rel, err := filepath.Rel(root, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("import path leaves the rules directory")
+	}
+	return path, nil
+}
+
+// display shortens a path relative to the root for error messages
+func (r *importResolver) display(path string) string {
+	root, err := filepath.Abs(r.root)
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(root, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
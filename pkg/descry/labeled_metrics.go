@@ -0,0 +1,130 @@
+package descry
+
+import (
+	"strings"
+
+	"github.com/chosenoffset/descry/pkg/descry/parser"
+)
+
+// Custom metrics with labels, such as the depth of each queue, are labeled
+// series of custom.<name>. Rules select them with label selectors such as
+// custom.queue_depth{queue="email"}, and a metric read without a selector is
+// the sum of its series.
+
+// UpdateCustomMetricWithLabels records the value of a custom metric for one
+// label set:
+//
+//	engine.UpdateCustomMetricWithLabels("queue_depth", 12, map[string]string{"queue": "email"})
+//
+// Rules read the series as custom.queue_depth{queue="email"}, and the sum
+// of all of its series as custom.queue_depth unless an unlabeled value was
+// also recorded with UpdateCustomMetric. Each label set counts toward the
+// MaxCustomMetrics resource limit.
+func (e *Engine) UpdateCustomMetricWithLabels(name string, value float64, labels map[string]string) error {
+	return e.UpdateLabeledMetric("custom."+name, labels, value)
+}
+
+// GetCustomMetricWithLabels returns the latest value of a custom metric for
+// one label set, and false if none was recorded
+func (e *Engine) GetCustomMetricWithLabels(name string, labels map[string]string) (float64, bool) {
+	return e.GetLabeledMetric("custom."+name, labels)
+}
+
+// splitSeriesKey splits a labeled series key such as
+// custom.queue_depth{queue=email} into its metric path and labels
+func splitSeriesKey(key string) (string, map[string]string, bool) {
+	open := strings.Index(key, "{")
+	if open < 0 || !strings.HasSuffix(key, "}") {
+		return "", nil, false
+	}
+	labels, err := parseSeriesSelector(key[open+1 : len(key)-1])
+	if err != nil {
+		return "", nil, false
+	}
+	return key[:open], labels, true
+}
+
+// sumSeries returns the sum of the latest values of the series of metric
+// carrying all of the given labels, and how many series matched
+func (e *Engine) sumSeries(metric string, labels map[string]string) (float64, int) {
+	var sum float64
+	matched := 0
+	for key, value := range e.labeledMetrics.values() {
+		path, series, ok := splitSeriesKey(key)
+		if !ok || path != metric || !hasLabels(series, labels) {
+			continue
+		}
+		sum += value
+		matched++
+	}
+	return sum, matched
+}
+
+// hasLabels reports whether series carries every label in labels
+func hasLabels(series, labels map[string]string) bool {
+	for name, value := range labels {
+		if series[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// labeledCustomTotals returns, for each custom metric recorded only with
+// labels, the sum of its series, keyed by metric name. They are shown
+// alongside the series on the dashboard and in report snapshots.
+func (e *Engine) labeledCustomTotals() map[string]float64 {
+	totals := make(map[string]float64)
+	for key, value := range e.labeledMetrics.values() {
+		path, _, ok := splitSeriesKey(key)
+		if !ok || !strings.HasPrefix(path, "custom.") {
+			continue
+		}
+		name := strings.TrimPrefix(path, "custom.")
+		if _, exists := e.customMetrics.get(name); exists {
+			continue
+		}
+		totals[name] += value
+	}
+	return totals
+}
+
+// labeledCustomSeries returns the labeled series of custom metrics keyed
+// like custom metric names, such as queue_depth{queue=email}
+func (e *Engine) labeledCustomSeries() map[string]float64 {
+	series := make(map[string]float64)
+	for key, value := range e.labeledMetrics.values() {
+		if strings.HasPrefix(key, "custom.") {
+			series[strings.TrimPrefix(key, "custom.")] = value
+		}
+	}
+	return series
+}
+
+// evalLabelSelector evaluates a selector such as
+// custom.queue_depth{queue="email"}: the value of the series with exactly
+// these labels, or else the sum of the series carrying all of them
+func (e *Evaluator) evalLabelSelector(node *parser.LabelSelector) Object {
+	metric, ok := dotPath(node.Metric)
+	if !ok {
+		return newError("invalid label selector: %s", node.String())
+	}
+	key, err := seriesKey(metric, node.Labels)
+	if err != nil {
+		return newError("%s", err.Error())
+	}
+	if e.simulation != nil {
+		if value, ok := e.simulation.value(key, e.now()); ok {
+			return &Float{Value: value}
+		}
+	}
+
+	value, err := e.seriesValue(metric, node.Labels)
+	if err == nil {
+		return &Float{Value: value}
+	}
+	if sum, matched := e.engine.sumSeries(metric, node.Labels); matched > 0 {
+		return &Float{Value: sum}
+	}
+	return newError("%s", err.Error())
+}
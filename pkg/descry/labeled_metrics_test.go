@@ -0,0 +1,101 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+func TestLabeledCustomMetrics(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	report := func(queue, region string, depth float64) {
+		t.Helper()
+		if err := engine.UpdateCustomMetricWithLabels("queue_depth", depth, map[string]string{"queue": queue, "region": region}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report("email", "eu", 12)
+	report("email", "us", 8)
+	report("sms", "eu", 5)
+
+	if err := engine.UpdateCustomMetricWithLabels("queue_depth", 1, nil); err == nil {
+		t.Error("expected a label set to be required")
+	}
+	if value, ok := engine.GetCustomMetricWithLabels("queue_depth", map[string]string{"region": "us", "queue": "email"}); !ok || value != 8 {
+		t.Errorf("expected the email/us series to be 8, got %v (%t)", value, ok)
+	}
+
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		{`custom.queue_depth{queue="email", region="eu"}`, 12},
+		{`custom.queue_depth{region="eu", queue="email"}`, 12},
+		{`custom.queue_depth{queue="email"}`, 20},
+		{`custom.queue_depth{region="eu"}`, 17},
+		{`custom.queue_depth`, 25},
+		{`custom.queue_depth{queue="sms"} * 2`, 10},
+		{`avg(custom.queue_depth{queue="email", region="us"}, 5m)`, 8},
+	}
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if isError(result) {
+			t.Errorf("%s: unexpected error: %s", tt.source, result.Inspect())
+			continue
+		}
+		if value := engine.evaluator.objectToFloat(result); value != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.source, tt.expected, value)
+		}
+	}
+	if result := evalSource(t, engine, `custom.queue_depth{queue="push"}`); !isError(result) {
+		t.Errorf("expected an error for a selector matching no series, got %s", result.Inspect())
+	}
+
+	// Selectors do not clash with the body of a when statement
+	handler := &capturingHandler{}
+	engine.actionRegistry.RegisterHandler(actions.AlertAction, handler)
+	if err := engine.AddRule("email_backlog", `when custom.queue_depth{queue="email"} > 15 {alert("email backlog")}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.AddRule("any_backlog", `when custom.queue_depth > 100 { alert("backlog") }`); err != nil {
+		t.Fatal(err)
+	}
+	engine.EvaluateRules()
+	if len(handler.actions) != 1 || handler.actions[0].Message != "email backlog" {
+		t.Errorf("expected only the email backlog alert, got %+v", handler.actions)
+	}
+	rule, _ := engine.GetRule("email_backlog")
+	if paths := ruleMetricPaths(rule.AST); len(paths) != 1 || paths[0] != "custom.queue_depth{queue=email}" {
+		t.Errorf("expected the rule to read the selected series, got %v", paths)
+	}
+
+	for _, source := range []string{
+		`when custom.queue_depth{queue=email} > 1 { log("x") }`,
+		`when custom.queue_depth{queue="email", queue="sms"} > 1 { log("x") }`,
+		`when custom.queue_depth{queue="a{b"} > 1 { log("x") }`,
+	} {
+		if err := engine.AddRule("invalid", source); err == nil {
+			t.Errorf("expected %s to be rejected", source)
+		}
+	}
+
+	// Series and totals are exported with the other custom metrics
+	metrics := engine.SnapshotMetrics()
+	if metrics["custom.queue_depth{queue=email,region=eu}"] != 12 || metrics["custom.queue_depth"] != 25 {
+		t.Errorf("expected the series and their total in SnapshotMetrics, got %v", metrics)
+	}
+	snapshot := engine.buildSnapshot(engine.clock.Now(), DefaultSnapshotInterval)
+	if snapshot.Custom["queue_depth{queue=sms,region=eu}"] != 5 || snapshot.Custom["queue_depth"] != 25 {
+		t.Errorf("expected the series and their total in report snapshots, got %v", snapshot.Custom)
+	}
+
+	// An unlabeled value takes precedence over the total
+	if err := engine.UpdateCustomMetric("queue_depth", 3); err != nil {
+		t.Fatal(err)
+	}
+	if value := engine.evaluator.objectToFloat(evalSource(t, engine, `custom.queue_depth`)); value != 3 {
+		t.Errorf("expected the unlabeled value, got %v", value)
+	}
+}
@@ -0,0 +1,90 @@
+package descry
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// labelNamePattern matches valid label names, which follow DSL identifier
+// and Prometheus label name rules
+var labelNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// RuleOptions holds settings for AddRuleWithOptions
+type RuleOptions struct {
+	// Labels are attached to every rule the source defines, such as
+	// team=payments. They replace labels of the same name declared in a
+	// rule's labels metadata.
+	Labels map[string]string
+}
+
+// AddRuleWithOptions adds rules like AddRules and applies options to each of
+// them. Labels set here belong to the rules as added; reloading the rules
+// from a file or replacing their source keeps only the labels in the source.
+func (e *Engine) AddRuleWithOptions(name, source string, options RuleOptions) error {
+	if err := validateLabels(options.Labels); err != nil {
+		return err
+	}
+	rules, err := e.compileRules(name, source, "")
+	if err != nil {
+		return err
+	}
+	for _, rule := range rules {
+		rule.Labels = mergeLabels(rule.Labels, options.Labels)
+	}
+	_, err = e.addCompiledRules(rules)
+	return err
+}
+
+// validateLabels checks label names
+func validateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+	}
+	return nil
+}
+
+// mergeLabels returns base with overrides applied, or nil if both are empty.
+// Neither argument is modified.
+func mergeLabels(base, overrides map[string]string) map[string]string {
+	if len(base) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(overrides))
+	for name, value := range base {
+		merged[name] = value
+	}
+	for name, value := range overrides {
+		merged[name] = value
+	}
+	return merged
+}
+
+// ruleLabels returns a copy of the named rule's labels, or nil if it has
+// none or does not exist
+func (e *Engine) ruleLabels(name string) map[string]string {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	for _, rule := range e.rules {
+		if rule.Name == name {
+			return mergeLabels(rule.Labels, nil)
+		}
+	}
+	return nil
+}
+
+// matchLabels reports whether labels holds every name and value in want
+func matchLabels(labels, want map[string]string) bool {
+	for name, value := range want {
+		if got, ok := labels[name]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
+
+// equalLabels reports whether two label sets are the same
+func equalLabels(a, b map[string]string) bool {
+	return len(a) == len(b) && matchLabels(a, b)
+}
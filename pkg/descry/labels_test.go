@@ -0,0 +1,73 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+func TestRuleLabels(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	source := `rule "backlog" {
+  labels: team = "payments", tier = "1"
+  when custom.orders.pending > 100 { alert("orders backing up") log("backlog") }
+}`
+	err := engine.AddRuleWithOptions("payments", source, RuleOptions{Labels: map[string]string{"tier": "2", "env": "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, _ := engine.GetRule("backlog")
+	if !equalLabels(rule.Labels, map[string]string{"team": "payments", "tier": "2", "env": "prod"}) {
+		t.Fatalf("expected option labels to be merged over the source's, got %v", rule.Labels)
+	}
+
+	// Routes can match on the rule's labels
+	pager := &capturingHandler{}
+	engine.RegisterActionHandler("payments-pager", pager)
+	routing := &actions.RoutingConfig{Routes: []actions.Route{
+		{Match: actions.RouteMatch{Tags: map[string]string{"team": "payments"}}, Handlers: []string{"payments-pager"}},
+	}}
+	if err := engine.SetRoutingConfig(routing); err != nil {
+		t.Fatal(err)
+	}
+	engine.UpdateCustomMetric("orders.pending", 150)
+	engine.EvaluateRules()
+	if len(pager.actions) != 2 || pager.actions[0].Tags["env"] != "prod" || pager.actions[1].Tags["team"] != "payments" {
+		t.Fatalf("expected both actions to be routed with the rule's labels, got %+v", pager.actions)
+	}
+
+	// Alert, log and trigger events carry the labels
+	events := engine.QueryEvents(EventQuery{Labels: map[string]string{"team": "payments", "tier": "2"}})
+	if len(events) != 3 {
+		t.Errorf("expected three labelled events, got %+v", events)
+	}
+	if events := engine.QueryEvents(EventQuery{Labels: map[string]string{"team": "search"}}); len(events) != 0 {
+		t.Errorf("expected no events for another team, got %+v", events)
+	}
+
+	// Bundles keep labels set through options
+	bundle := engine.ExportRuleBundle()
+	bundle.Routing = nil
+	restored := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if _, err := restored.ImportRuleBundle(bundle, RuleBundleImportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if rule, _ := restored.GetRule("backlog"); rule.Labels["env"] != "prod" {
+		t.Errorf("expected the imported rule to keep its labels, got %v", rule.Labels)
+	}
+
+	for _, src := range []string{
+		`rule "a" { labels: team when 1 > 0 { log("x") } }`,
+		`rule "a" { labels: team = payments when 1 > 0 { log("x") } }`,
+		`rule "a" { labels: team = "a", team = "b" when 1 > 0 { log("x") } }`,
+	} {
+		if _, err := engine.AddRules("invalid", src); err == nil {
+			t.Errorf("expected error for %s", src)
+		}
+	}
+	if err := engine.AddRuleWithOptions("other", `when 1 > 0 { log("x") }`, RuleOptions{Labels: map[string]string{"team-name": "x"}}); err == nil {
+		t.Error("expected an invalid label name to be rejected")
+	}
+}
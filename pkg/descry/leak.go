@@ -0,0 +1,195 @@
+package descry
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/metrics"
+)
+
+// Leak detection scores the heuristics people usually combine by hand to
+// spot a memory leak: the heap in use growing steadily, the number of live
+// objects growing with it, and the garbage collector running at least as
+// often as before, so the growth survives collection and is not simply more
+// load. Rules read the result as leak.score and its parts as
+// leak.heap_growth, leak.objects_growth and leak.gc_stability.
+const (
+	// leakWindow is the span of runtime history the detector scores
+	leakWindow = 30 * time.Minute
+	// leakMaxSamples bounds the detector's history; observations closer
+	// together than leakWindow/leakMaxSamples are skipped
+	leakMaxSamples = 1800
+	// minLeakSamples is the number of observations the detector needs, and
+	// they must span at least half of leakWindow, before it scores anything
+	minLeakSamples = 10
+	// minLeakGrowth is the growth over the window, as a fraction of the
+	// starting level, below which the heap and objects are treated as flat
+	minLeakGrowth = 0.01
+)
+
+// leakSample is one observation of the runtime metrics the detector scores
+type leakSample struct {
+	timestamp time.Time
+	heapInuse float64
+	objects   float64
+	numGC     float64
+}
+
+// leakDetector turns periodic runtime observations into the leak.* metrics
+type leakDetector struct {
+	mutex      sync.RWMutex
+	samples    []leakSample
+	values     map[string]float64
+	history    map[string][]customMetricSample
+	maxHistory int
+}
+
+func newLeakDetector(maxHistory int) *leakDetector {
+	return &leakDetector{
+		values:     leakValues(0, 0, 0),
+		history:    make(map[string][]customMetricSample),
+		maxHistory: maxHistory,
+	}
+}
+
+// leakValues returns the leak.* metrics for the given parts, each from 0
+// to 1. The score is their product scaled to 0-100, so all three must agree
+// for it to be high.
+func leakValues(heapGrowth, objectsGrowth, gcStability float64) map[string]float64 {
+	return map[string]float64{
+		"score":          100 * heapGrowth * objectsGrowth * gcStability,
+		"heap_growth":    heapGrowth,
+		"objects_growth": objectsGrowth,
+		"gc_stability":   gcStability,
+	}
+}
+
+// observe records the runtime metrics at now and rescores the window
+func (d *leakDetector) observe(now time.Time, runtimeMetrics metrics.RuntimeMetrics) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if n := len(d.samples); n > 0 && now.Sub(d.samples[n-1].timestamp) < leakWindow/leakMaxSamples {
+		return
+	}
+	d.samples = append(d.samples, leakSample{
+		timestamp: now,
+		heapInuse: float64(runtimeMetrics.HeapInuse),
+		objects:   float64(runtimeMetrics.HeapObjects),
+		numGC:     float64(runtimeMetrics.NumGC),
+	})
+	cutoff := now.Add(-leakWindow)
+	first := sort.Search(len(d.samples), func(i int) bool { return d.samples[i].timestamp.After(cutoff) })
+	d.samples = append(d.samples[:0], d.samples[first:]...)
+
+	d.values = scoreLeak(d.samples)
+	for name, value := range d.values {
+		history := append(d.history[name], customMetricSample{Value: value, Timestamp: now})
+		if len(history) > d.maxHistory {
+			copy(history, history[1:])
+			history = history[:d.maxHistory]
+		}
+		d.history[name] = history
+	}
+}
+
+// scoreLeak scores observations spanning at most leakWindow, oldest first
+func scoreLeak(samples []leakSample) map[string]float64 {
+	if len(samples) < minLeakSamples ||
+		samples[len(samples)-1].timestamp.Sub(samples[0].timestamp) < leakWindow/2 {
+		return leakValues(0, 0, 0)
+	}
+	heapGrowth := steadyGrowth(samples, func(s leakSample) float64 { return s.heapInuse })
+	objectsGrowth := steadyGrowth(samples, func(s leakSample) float64 { return s.objects })
+	return leakValues(heapGrowth, objectsGrowth, gcStability(samples))
+}
+
+// steadyGrowth fits a line to a series and returns how well it fits (R²)
+// if the series rose by at least minLeakGrowth, or 0 if it did not
+func steadyGrowth(samples []leakSample, value func(leakSample) float64) float64 {
+	start := samples[0].timestamp
+	n := float64(len(samples))
+	var sumX, sumY float64
+	for _, s := range samples {
+		sumX += s.timestamp.Sub(start).Seconds()
+		sumY += value(s)
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var sxx, sxy, syy float64
+	for _, s := range samples {
+		dx := s.timestamp.Sub(start).Seconds() - meanX
+		dy := value(s) - meanY
+		sxx += dx * dx
+		sxy += dx * dy
+		syy += dy * dy
+	}
+	if sxx == 0 || syy == 0 || sxy <= 0 {
+		return 0
+	}
+
+	slope := sxy / sxx
+	span := samples[len(samples)-1].timestamp.Sub(start).Seconds()
+	if level := math.Abs(value(samples[0])); slope*span < level*minLeakGrowth {
+		return 0
+	}
+	return sxy * sxy / (sxx * syy)
+}
+
+// gcStability compares the GC frequency of the window's second half with
+// its first. It is 1 while collections are no more frequent than before and
+// falls as they speed up, which points to growing load rather than a leak.
+// It is 0 if either half saw no collection, since growth the collector has
+// not yet run over says nothing about leaks.
+func gcStability(samples []leakSample) float64 {
+	first, last := samples[0], samples[len(samples)-1]
+	mid := samples[len(samples)/2]
+	before := (mid.numGC - first.numGC) / mid.timestamp.Sub(first.timestamp).Seconds()
+	after := (last.numGC - mid.numGC) / last.timestamp.Sub(mid.timestamp).Seconds()
+	if before <= 0 || after <= 0 {
+		return 0
+	}
+	return math.Min(1, before/after)
+}
+
+// sampleCount returns the number of observations being scored
+func (d *leakDetector) sampleCount() int {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return len(d.samples)
+}
+
+// metric returns the latest value of a leak.* metric
+func (d *leakDetector) metric(name string) (float64, bool) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	value, ok := d.values[name]
+	return value, ok
+}
+
+// metricHistory returns the recorded values of a leak.* metric after cutoff,
+// oldest first
+func (d *leakDetector) metricHistory(name string, cutoff time.Time) []customMetricSample {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	var result []customMetricSample
+	for _, sample := range d.history[name] {
+		if sample.Timestamp.After(cutoff) {
+			result = append(result, sample)
+		}
+	}
+	return result
+}
+
+// snapshot returns the latest leak.* metrics keyed by their path in rules
+func (d *leakDetector) snapshot() map[string]float64 {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	snapshot := make(map[string]float64, len(d.values))
+	for name, value := range d.values {
+		snapshot["leak."+name] = value
+	}
+	return snapshot
+}
@@ -0,0 +1,74 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/clock"
+	"github.com/chosenoffset/descry/pkg/descry/metrics"
+)
+
+func TestLeakDetector(t *testing.T) {
+	start := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// observe feeds 30 minutes of samples every 10s; heap and gc give the
+	// heap in use and GC count of sample i
+	observe := func(minutes int, heap func(i int) uint64, gc func(i int) uint32) map[string]float64 {
+		detector := newLeakDetector(1000)
+		for i := 0; i <= minutes*6; i++ {
+			detector.observe(start.Add(time.Duration(i)*10*time.Second), metrics.RuntimeMetrics{
+				HeapInuse:   heap(i),
+				HeapObjects: heap(i) / 64,
+				NumGC:       gc(i),
+			})
+		}
+		return detector.snapshot()
+	}
+	leaking := func(i int) uint64 { return 100<<20 + uint64(i)<<20 + uint64(i%3)<<18 }
+	steadyGC := func(i int) uint32 { return uint32(i) }
+
+	leak := observe(30, leaking, steadyGC)
+	if leak["leak.score"] < 90 || leak["leak.heap_growth"] < 0.9 || leak["leak.gc_stability"] != 1 {
+		t.Errorf("expected a high score for a steady leak, got %v", leak)
+	}
+
+	// GC running twice as often in the second half points to load instead
+	load := observe(30, leaking, func(i int) uint32 {
+		if i < 90 {
+			return uint32(i)
+		}
+		return uint32(90 + 2*(i-90))
+	})
+	if load["leak.gc_stability"] > 0.6 || load["leak.score"] > 60 {
+		t.Errorf("expected rising GC frequency to lower the score, got %v", load)
+	}
+
+	for name, values := range map[string]map[string]float64{
+		"flat heap":     observe(30, func(i int) uint64 { return 100<<20 + uint64(i%3)<<18 }, steadyGC),
+		"no GC":         observe(30, leaking, func(int) uint32 { return 7 }),
+		"short history": observe(10, leaking, steadyGC),
+	} {
+		if values["leak.score"] != 0 {
+			t.Errorf("expected no score for %s, got %v", name, values)
+		}
+	}
+
+	// The engine observes the runtime every evaluation cycle
+	fake := clock.NewFake(start)
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.AddRule("leak", `when leak.score >= 0 && avg("leak.gc_stability", 60) >= 0 { log("scored") }`); err != nil {
+		t.Fatal(err)
+	}
+	engine.EvaluateRules()
+	if rule, _ := engine.GetRule("leak"); rule.LastTrigger.IsZero() {
+		t.Error("expected leak metrics to be readable in rules")
+	}
+	if _, ok := engine.SnapshotMetrics()["leak.score"]; !ok {
+		t.Error("expected leak.score in the metric snapshot")
+	}
+	if err := engine.RegisterMetricProvider(&poolProvider{name: "leak"}); err == nil {
+		t.Error("expected leak to be a reserved namespace")
+	}
+}
@@ -1,6 +1,7 @@
 package descry
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
@@ -132,7 +133,7 @@ func testEvaluationTimeoutLimit(t *testing.T) {
 		t.Fatalf("Failed to add rule: %v", err)
 	}
 	
-	engine.Start()
+	engine.Start(context.Background())
 	defer engine.Stop()
 	
 	// Let the engine run for a bit - timeouts should be logged but not crash
@@ -0,0 +1,246 @@
+package metrics
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+// maxRouteLabels bounds the distinct route labels kept, so a labeler that
+// leaks identifiers into labels cannot grow memory without limit. Requests
+// with new labels beyond it count toward OtherRouteLabel.
+const maxRouteLabels = 200
+
+// OtherRouteLabel collects requests whose route label arrived after
+// maxRouteLabels distinct labels were already kept
+const OtherRouteLabel = "(other)"
+
+// OtherMethod collects requests with a method outside the standard HTTP
+// methods
+const OtherMethod = "OTHER"
+
+// standardMethods are the methods tracked under their own name
+var standardMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true,
+	http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true,
+	http.MethodConnect: true, http.MethodOptions: true, http.MethodTrace: true,
+}
+
+// methodKey returns the name a method's statistics are kept under
+func methodKey(method string) string {
+	method = strings.ToUpper(method)
+	if !standardMethods[method] {
+		return OtherMethod
+	}
+	return method
+}
+
+// RouteLabeler names the route a request belongs to, such as
+// "/api/orders/:id", grouping requests into per-route statistics. It is
+// called after the request has been served. An empty label leaves the
+// request out of per-route statistics.
+type RouteLabeler func(r *http.Request) string
+
+// DefaultRouteLabeler labels a request with the pattern of the ServeMux
+// route that served it, such as "GET /api/orders/{id}", when the middleware
+// wraps a ServeMux, and otherwise with its path normalized by NormalizePath
+func DefaultRouteLabeler(r *http.Request) string {
+	if r.Pattern != "" {
+		return r.Pattern
+	}
+	return NormalizePath(r.URL.Path)
+}
+
+// NormalizePath replaces path segments that look like identifiers, such as
+// numbers, UUIDs and long hexadecimal strings, with ":id", so that
+// "/api/orders/42" and "/api/orders/43" share the route "/api/orders/:id"
+func NormalizePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if isIdentifierSegment(segment) {
+			segments[i] = ":id"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isIdentifierSegment reports whether a path segment is a number, a UUID or
+// a hexadecimal string of at least 16 characters
+func isIdentifierSegment(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	digits, hex := true, true
+	for _, c := range segment {
+		if !unicode.IsDigit(c) {
+			digits = false
+		}
+		if !unicode.Is(unicode.ASCII_Hex_Digit, c) && c != '-' {
+			hex = false
+		}
+	}
+	if digits {
+		return true
+	}
+	if !hex {
+		return false
+	}
+	plain := strings.ReplaceAll(segment, "-", "")
+	isUUID := len(segment) == 36 && len(plain) == 32
+	return isUUID || (len(plain) == len(segment) && len(segment) >= 16)
+}
+
+// HTTPBreakdown splits HTTP statistics by route label, by method and by
+// status class
+type HTTPBreakdown struct {
+	Routes        []RouteStats     `json:"routes"`         // By route label, busiest first
+	Methods       []RouteStats     `json:"methods"`        // By method, busiest first
+	StatusClasses map[string]int64 `json:"status_classes"` // Responses per class, e.g. "5xx"
+}
+
+// SetRouteLabeler replaces how requests are grouped into per-route
+// statistics. Nil restores DefaultRouteLabeler. Statistics already kept
+// under the previous labels are cleared.
+func (h *HTTPMetrics) SetRouteLabeler(labeler RouteLabeler) {
+	if labeler == nil {
+		labeler = DefaultRouteLabeler
+	}
+	h.labelsMu.Lock()
+	defer h.labelsMu.Unlock()
+	h.labeler = labeler
+	h.labels = nil
+}
+
+// GetRouteLabeler returns the labeler grouping requests into per-route
+// statistics
+func (h *HTTPMetrics) GetRouteLabeler() RouteLabeler {
+	h.labelsMu.RLock()
+	defer h.labelsMu.RUnlock()
+	return h.labeler
+}
+
+// recordBreakdown adds a completed request to its route label, method and
+// status class statistics. served is the request as passed to the handler,
+// which carries the pattern a ServeMux matched.
+func (h *HTTPMetrics) recordBreakdown(served *http.Request, statusCode int, durationNs int64) {
+	if class := statusCode / 100; class >= 1 && class <= 5 {
+		atomic.AddInt64(&h.statusClasses[class-1], 1)
+	}
+	sample := routeSample{duration: durationNs, failed: statusCode >= 400}
+
+	method := methodKey(served.Method)
+	h.labelsMu.RLock()
+	labeler := h.labeler
+	methodTracker := h.methods[method]
+	h.labelsMu.RUnlock()
+	if labeler == nil {
+		labeler = DefaultRouteLabeler
+	}
+	label := labeler(served)
+
+	h.labelsMu.RLock()
+	labelTracker := h.labels[label]
+	h.labelsMu.RUnlock()
+	if methodTracker == nil || (label != "" && labelTracker == nil) {
+		h.labelsMu.Lock()
+		if h.methods == nil {
+			h.methods = make(map[string]*routeTracker)
+		}
+		if methodTracker = h.methods[method]; methodTracker == nil {
+			methodTracker = &routeTracker{}
+			h.methods[method] = methodTracker
+		}
+		if label != "" {
+			if h.labels == nil {
+				h.labels = make(map[string]*routeTracker)
+			}
+			if _, exists := h.labels[label]; !exists && len(h.labels) >= maxRouteLabels {
+				label = OtherRouteLabel
+			}
+			if labelTracker = h.labels[label]; labelTracker == nil {
+				labelTracker = &routeTracker{}
+				h.labels[label] = labelTracker
+			}
+		}
+		h.labelsMu.Unlock()
+	}
+
+	methodTracker.record(sample, h.maxSamples)
+	if labelTracker != nil {
+		labelTracker.record(sample, h.maxSamples)
+	}
+}
+
+// GetRouteLabelStats returns the statistics of requests with the given route
+// label. It returns false if no request has had the label.
+func (h *HTTPMetrics) GetRouteLabelStats(label string) (RouteStats, bool) {
+	h.labelsMu.RLock()
+	tracker, exists := h.labels[label]
+	h.labelsMu.RUnlock()
+	if !exists {
+		return RouteStats{}, false
+	}
+	return tracker.stats(label), true
+}
+
+// GetMethodStats returns the statistics of requests with the given method.
+// Methods outside the standard ones are counted as OtherMethod. It returns
+// false if no request has used the method.
+func (h *HTTPMetrics) GetMethodStats(method string) (RouteStats, bool) {
+	method = methodKey(method)
+	h.labelsMu.RLock()
+	tracker, exists := h.methods[method]
+	h.labelsMu.RUnlock()
+	if !exists {
+		return RouteStats{}, false
+	}
+	return tracker.stats(method), true
+}
+
+// GetBreakdown returns the statistics of every route label, method and
+// status class
+func (h *HTTPMetrics) GetBreakdown() HTTPBreakdown {
+	h.labelsMu.RLock()
+	labels := make(map[string]*routeTracker, len(h.labels))
+	for label, tracker := range h.labels {
+		labels[label] = tracker
+	}
+	methods := make(map[string]*routeTracker, len(h.methods))
+	for method, tracker := range h.methods {
+		methods[method] = tracker
+	}
+	h.labelsMu.RUnlock()
+
+	breakdown := HTTPBreakdown{
+		Routes:        breakdownStats(labels),
+		Methods:       breakdownStats(methods),
+		StatusClasses: h.statusClassCounts(),
+	}
+	return breakdown
+}
+
+// statusClassCounts returns the responses counted per status class
+func (h *HTTPMetrics) statusClassCounts() map[string]int64 {
+	counts := make(map[string]int64, len(h.statusClasses))
+	for i := range h.statusClasses {
+		counts[string(rune('1'+i))+"xx"] = atomic.LoadInt64(&h.statusClasses[i])
+	}
+	return counts
+}
+
+// breakdownStats returns the statistics of each tracker, busiest first
+func breakdownStats(trackers map[string]*routeTracker) []RouteStats {
+	stats := make([]RouteStats, 0, len(trackers))
+	for name, tracker := range trackers {
+		stats = append(stats, tracker.stats(name))
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].RequestCount != stats[j].RequestCount {
+			return stats[i].RequestCount > stats[j].RequestCount
+		}
+		return stats[i].Route < stats[j].Route
+	})
+	return stats
+}
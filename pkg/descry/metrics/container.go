@@ -0,0 +1,200 @@
+package metrics
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupUnlimited is the value above which a cgroup v1 memory limit means no
+// limit; the kernel reports "unlimited" as the largest page-aligned int64
+const cgroupUnlimited = 1 << 62
+
+// ContainerCollector reads the memory and CPU limits the process's cgroup
+// imposes, so rules in containers can compare usage with the container's
+// quota rather than the machine's. It is a metric provider read in rules
+// under the name container:
+//
+//	engine.RegisterMetricProvider(metrics.NewContainerCollector())
+//
+// Both cgroup v2 and v1 hierarchies are supported. Outside a cgroup, or where
+// the files are not readable, Collect returns no metrics and rules reading
+// them fail to evaluate.
+type ContainerCollector struct {
+	root       string
+	procCgroup string
+}
+
+// NewContainerCollector returns a collector for the cgroup filesystem at
+// /sys/fs/cgroup
+func NewContainerCollector() *ContainerCollector {
+	return NewContainerCollectorAt("/sys/fs/cgroup")
+}
+
+// NewContainerCollectorAt returns a collector for a cgroup filesystem mounted
+// at root, for systems mounting it elsewhere
+func NewContainerCollectorAt(root string) *ContainerCollector {
+	return &ContainerCollector{root: root, procCgroup: "/proc/self/cgroup"}
+}
+
+// Name returns the namespace of the collector's metrics in rules
+func (c *ContainerCollector) Name() string {
+	return "container"
+}
+
+// Collect reads the cgroup's current usage and limits:
+//
+//   - memory_limit: the memory limit in bytes, 0 if unlimited
+//   - memory_usage: memory charged to the cgroup in bytes, page cache included
+//   - memory_usage_ratio: memory_usage as a fraction of memory_limit, 0 if
+//     unlimited
+//   - cpu_limit: the CPU quota in cores, 0 if unlimited
+//   - cpu_throttled_periods: scheduling periods in which the cgroup used up
+//     its quota and was throttled, since it was created
+//   - cpu_throttled_time: total time throttled in milliseconds
+func (c *ContainerCollector) Collect() map[string]float64 {
+	var values map[string]float64
+	if _, err := os.Stat(filepath.Join(c.root, "cgroup.controllers")); err == nil {
+		values = c.collectV2()
+	} else {
+		values = c.collectV1()
+	}
+	if limit, usage := values["memory_limit"], values["memory_usage"]; limit > 0 {
+		values["memory_usage_ratio"] = usage / limit
+	} else if len(values) > 0 {
+		values["memory_usage_ratio"] = 0
+	}
+	return values
+}
+
+// collectV2 reads the unified hierarchy
+func (c *ContainerCollector) collectV2() map[string]float64 {
+	dir := c.groupDir("", "")
+	values := make(map[string]float64)
+	if usage, ok := readCgroupInt(filepath.Join(dir, "memory.current")); ok {
+		values["memory_usage"] = float64(usage)
+		values["memory_limit"] = 0
+		if limit, ok := readCgroupInt(filepath.Join(dir, "memory.max")); ok {
+			values["memory_limit"] = float64(limit)
+		}
+	}
+	// cpu.max holds "<quota> <period>", with a quota of "max" if unlimited
+	if fields, ok := readCgroupFields(filepath.Join(dir, "cpu.max")); ok && len(fields) == 2 {
+		values["cpu_limit"] = cpuQuota(fields[0], fields[1])
+	}
+	if stat, ok := readCgroupStat(filepath.Join(dir, "cpu.stat")); ok {
+		values["cpu_throttled_periods"] = float64(stat["nr_throttled"])
+		values["cpu_throttled_time"] = float64(stat["throttled_usec"]) / 1000
+	}
+	return values
+}
+
+// collectV1 reads the memory and cpu controllers of a v1 hierarchy
+func (c *ContainerCollector) collectV1() map[string]float64 {
+	values := make(map[string]float64)
+	memory := c.groupDir("memory", "memory")
+	if usage, ok := readCgroupInt(filepath.Join(memory, "memory.usage_in_bytes")); ok {
+		values["memory_usage"] = float64(usage)
+		values["memory_limit"] = 0
+		if limit, ok := readCgroupInt(filepath.Join(memory, "memory.limit_in_bytes")); ok && limit < cgroupUnlimited {
+			values["memory_limit"] = float64(limit)
+		}
+	}
+	cpu := c.groupDir("cpu", "cpu")
+	quota, okQuota := readCgroupFields(filepath.Join(cpu, "cpu.cfs_quota_us"))
+	period, okPeriod := readCgroupFields(filepath.Join(cpu, "cpu.cfs_period_us"))
+	if okQuota && okPeriod && len(quota) == 1 && len(period) == 1 {
+		values["cpu_limit"] = cpuQuota(quota[0], period[0])
+	}
+	if stat, ok := readCgroupStat(filepath.Join(cpu, "cpu.stat")); ok {
+		values["cpu_throttled_periods"] = float64(stat["nr_throttled"])
+		values["cpu_throttled_time"] = float64(stat["throttled_time"]) / 1e6
+	}
+	return values
+}
+
+// groupDir returns the directory of the process's cgroup for a v1
+// controller mounted at root/mount, or for the v2 hierarchy if controller is
+// empty. Inside a container's cgroup namespace the process's path is not
+// visible under the mount, and the mount itself is the cgroup.
+func (c *ContainerCollector) groupDir(mount, controller string) string {
+	base := filepath.Join(c.root, mount)
+	file, err := os.Open(c.procCgroup)
+	if err != nil {
+		return base
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Lines are hierarchy-ID:controller-list:path; v2 has an empty list
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		matches := parts[1] == controller
+		for _, name := range strings.Split(parts[1], ",") {
+			matches = matches || (controller != "" && name == controller)
+		}
+		if !matches {
+			continue
+		}
+		dir := filepath.Join(base, parts[2])
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		return base
+	}
+	return base
+}
+
+// cpuQuota returns a CFS quota in cores, 0 if unlimited
+func cpuQuota(quota, period string) float64 {
+	q, errQuota := strconv.ParseFloat(quota, 64)
+	p, errPeriod := strconv.ParseFloat(period, 64)
+	if errQuota != nil || errPeriod != nil || q <= 0 || p <= 0 {
+		return 0
+	}
+	return q / p
+}
+
+// readCgroupFields returns the whitespace-separated fields of a cgroup file
+func readCgroupFields(path string) ([]string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return strings.Fields(string(data)), true
+}
+
+// readCgroupInt reads a cgroup file holding one integer, treating "max" as
+// unlimited, reported as 0
+func readCgroupInt(path string) (int64, bool) {
+	fields, ok := readCgroupFields(path)
+	if !ok || len(fields) != 1 {
+		return 0, false
+	}
+	if fields[0] == "max" {
+		return 0, true
+	}
+	value, err := strconv.ParseInt(fields[0], 10, 64)
+	return value, err == nil
+}
+
+// readCgroupStat reads a flat keyed file such as cpu.stat
+func readCgroupStat(path string) (map[string]int64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	stat := make(map[string]int64)
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			if value, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				stat[fields[0]] = value
+			}
+		}
+	}
+	return stat, true
+}
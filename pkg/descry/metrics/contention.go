@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"runtime"
+	runtimemetrics "runtime/metrics"
+	"sync"
+	"time"
+)
+
+// mutexWaitMetric is the runtime/metrics total of time goroutines spent
+// blocked on sync.Mutex and sync.RWMutex
+const mutexWaitMetric = "/sync/mutex/wait/total:seconds"
+
+// ContentionCollector measures lock and blocking contention. It is a metric
+// provider read in rules under the name contention:
+//
+//	engine.RegisterMetricProvider(metrics.NewContentionCollector(10000, 100))
+//
+// Block profiling and mutex profiling are off by default in Go and cost some
+// performance while enabled, so the collector turns them on at the rates it
+// is given and Close turns them off again. The rates are process-wide, and
+// other code setting them changes what the collector samples.
+type ContentionCollector struct {
+	blockRate     int
+	mutexFraction int
+
+	mu           sync.Mutex
+	last         time.Time
+	startBlock   int64
+	blockEvents  int64
+	mutexEvents  int64
+	mutexWaitSec float64
+	sample       []runtimemetrics.Sample
+}
+
+// NewContentionCollector enables block profiling at blockRate, the
+// nanoseconds of blocking per sampled event as for
+// runtime.SetBlockProfileRate, and mutex profiling at mutexFraction, one in
+// mutexFraction contention events sampled as for
+// runtime.SetMutexProfileFraction. A rate of 0 leaves that profile off and
+// its metrics at 0.
+func NewContentionCollector(blockRate, mutexFraction int) *ContentionCollector {
+	runtime.SetBlockProfileRate(blockRate)
+	runtime.SetMutexProfileFraction(mutexFraction)
+	c := &ContentionCollector{
+		blockRate:     blockRate,
+		mutexFraction: mutexFraction,
+		sample:        []runtimemetrics.Sample{{Name: mutexWaitMetric}},
+	}
+	c.last = time.Now()
+	c.blockEvents, c.mutexEvents, c.mutexWaitSec = c.totals()
+	c.startBlock = c.blockEvents
+	return c
+}
+
+// Name returns the namespace of the collector's metrics in rules
+func (c *ContentionCollector) Name() string {
+	return "contention"
+}
+
+// Collect returns the contention since the previous collection as rates per
+// second, and the totals since the collector was created:
+//
+//   - block_rate: sampled blocking events per second, on channels, selects
+//     and locks
+//   - block_events: sampled blocking events in total
+//   - mutex_wait: milliseconds per second goroutines spent waiting for
+//     sync.Mutex and sync.RWMutex; measured by the runtime, it does not need
+//     mutex profiling
+//   - mutex_contention_rate: estimated contended lock releases per second,
+//     the sampled events scaled by the mutex fraction
+func (c *ContentionCollector) Collect() map[string]float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	blockEvents, mutexEvents, mutexWaitSec := c.totals()
+	elapsed := now.Sub(c.last).Seconds()
+	values := map[string]float64{
+		"block_rate":            0,
+		"block_events":          float64(blockEvents - c.startBlock),
+		"mutex_wait":            0,
+		"mutex_contention_rate": 0,
+	}
+	if elapsed > 0 {
+		values["block_rate"] = float64(blockEvents-c.blockEvents) / elapsed
+		values["mutex_wait"] = (mutexWaitSec - c.mutexWaitSec) * 1000 / elapsed
+		values["mutex_contention_rate"] = float64(mutexEvents-c.mutexEvents) * float64(c.mutexFraction) / elapsed
+	}
+	c.last, c.blockEvents, c.mutexEvents, c.mutexWaitSec = now, blockEvents, mutexEvents, mutexWaitSec
+	return values
+}
+
+// Close turns block and mutex profiling off
+func (c *ContentionCollector) Close() {
+	runtime.SetBlockProfileRate(0)
+	runtime.SetMutexProfileFraction(0)
+}
+
+// totals returns the sampled block and mutex events recorded by the
+// runtime's profiles and the total mutex wait in seconds
+func (c *ContentionCollector) totals() (blockEvents, mutexEvents int64, mutexWaitSec float64) {
+	if c.blockRate > 0 {
+		blockEvents = profileEvents(runtime.BlockProfile)
+	}
+	if c.mutexFraction > 0 {
+		mutexEvents = profileEvents(runtime.MutexProfile)
+	}
+	runtimemetrics.Read(c.sample)
+	if c.sample[0].Value.Kind() == runtimemetrics.KindFloat64 {
+		mutexWaitSec = c.sample[0].Value.Float64()
+	}
+	return blockEvents, mutexEvents, mutexWaitSec
+}
+
+// profileEvents sums the event counts of runtime.BlockProfile or
+// runtime.MutexProfile, growing the buffer until every record fits
+func profileEvents(profile func([]runtime.BlockProfileRecord) (int, bool)) int64 {
+	n, _ := profile(nil)
+	for {
+		records := make([]runtime.BlockProfileRecord, n+16)
+		var ok bool
+		if n, ok = profile(records); ok {
+			var total int64
+			for _, record := range records[:n] {
+				total += record.Count
+			}
+			return total
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Package expvarbridge exposes the numeric variables a program publishes
+// with the standard expvar package to Descry rules and the dashboard.
+//
+// It is kept apart from the metrics package because importing expvar
+// registers the /debug/vars handler on http.DefaultServeMux; programs that
+// do not publish expvar variables need not take on that endpoint.
+package expvarbridge
+
+import (
+	"encoding/json"
+	"expvar"
+	"sort"
+	"strings"
+)
+
+// MaxMetrics bounds the metrics one collection returns, so a large
+// published map cannot flood the engine. Variables are walked in name order
+// and those past the limit are left out.
+const MaxMetrics = 1000
+
+// skippedVars are published by the expvar package itself. Their contents
+// are already available as runtime metrics or are not numeric.
+var skippedVars = map[string]bool{"memstats": true, "cmdline": true}
+
+// Collector walks the published expvar variables. It is a metric provider
+// read in rules under the name expvar:
+//
+//	engine.RegisterMetricProvider(expvarbridge.NewCollector())
+//
+// An expvar.Int or expvar.Float named orders_processed is read as
+// expvar.orders_processed. The numeric entries of an expvar.Map, or of a
+// Func or other Var whose JSON value is an object, are read under the
+// variable's name, e.g. expvar.http.requests for the key requests of the
+// map http. Booleans read as 1 or 0; strings and arrays are left out.
+// Characters not allowed in rule identifiers are replaced by underscores.
+type Collector struct{}
+
+// NewCollector returns a collector for the variables published with expvar
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Name returns the namespace of the collector's metrics in rules
+func (c *Collector) Name() string {
+	return "expvar"
+}
+
+// Collect walks expvar.Do and returns the current value of every numeric
+// variable, up to MaxMetrics
+func (c *Collector) Collect() map[string]float64 {
+	values := make(map[string]float64)
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !skippedVars[kv.Key] {
+			collectVar(values, metricName(kv.Key), kv.Value)
+		}
+	})
+	return values
+}
+
+// collectVar adds the numeric values of one variable under name
+func collectVar(values map[string]float64, name string, v expvar.Var) {
+	switch v := v.(type) {
+	case *expvar.Int:
+		add(values, name, float64(v.Value()))
+	case *expvar.Float:
+		add(values, name, v.Value())
+	case *expvar.Map:
+		v.Do(func(kv expvar.KeyValue) {
+			collectVar(values, name+"."+metricName(kv.Key), kv.Value)
+		})
+	default:
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(v.String()), &decoded); err == nil {
+			collectJSON(values, name, decoded)
+		}
+	}
+}
+
+// collectJSON adds the numeric values of a decoded JSON value under name
+func collectJSON(values map[string]float64, name string, value interface{}) {
+	switch value := value.(type) {
+	case float64:
+		add(values, name, value)
+	case bool:
+		if value {
+			add(values, name, 1)
+		} else {
+			add(values, name, 0)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			collectJSON(values, name+"."+metricName(key), value[key])
+		}
+	}
+}
+
+// add records a value unless MaxMetrics values were already collected
+func add(values map[string]float64, name string, value float64) {
+	if len(values) < MaxMetrics {
+		values[name] = value
+	}
+}
+
+// metricName turns a variable name or map key into a rule identifier:
+// characters other than letters, digits and underscores become underscores,
+// and a leading digit is prefixed with one
+func metricName(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, key)
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
@@ -1,10 +1,14 @@
 package metrics
 
 import (
+	"context"
 	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/clock"
 )
 
 // HTTPMetrics tracks HTTP request/response statistics for performance monitoring.
@@ -16,12 +20,66 @@ type HTTPMetrics struct {
 	maxResponseTime   int64        // Maximum response time (nanoseconds)
 	pendingRequests   int64        // Currently processing requests
 	startTime        time.Time     // When metrics collection started
+	clock            clock.Clock   // Time source for durations and rates
 	
 	// Response time samples for statistical analysis
 	responseTimes    []int64
 	responseTimeMu   sync.RWMutex
 	bufferIndex      int64         // Atomic counter for circular buffer
 	maxSamples       int
+	
+	// Requests passed through without being recorded
+	exclusions       []HTTPExclusion
+	exclusionsMu     sync.RWMutex
+	
+	// Per-route statistics, keyed by route pattern
+	routes           map[string]*routeTracker
+	routesMu         sync.RWMutex
+	
+	// Per-route-label and per-method statistics, and responses per status
+	// class (1xx to 5xx)
+	labeler          RouteLabeler
+	labels           map[string]*routeTracker
+	methods          map[string]*routeTracker
+	labelsMu         sync.RWMutex
+	statusClasses    [5]int64
+	
+	// Per-request custom measurements, keyed by segment name
+	segments         map[string]*segmentTracker
+	segmentsMu       sync.RWMutex
+	
+	// Response times of the last minute, for percentiles
+	latency          latencyHistogram
+	
+	// Request body and response bytes of completed requests, and bytes
+	// transferred in the last minute, including requests still in flight
+	requestBytes     int64
+	responseBytes    int64
+	bandwidth        bandwidthWindow
+}
+
+// HTTPExclusion matches requests the middleware should not record, such as
+// health checks and metrics scrapes, so that high-frequency probes don't
+// distort request rates and response times. An exclusion with neither Path
+// nor Method set matches nothing.
+type HTTPExclusion struct {
+	// Path is the request path to match. A trailing "*" matches every path
+	// with that prefix, e.g. "/debug/*". Empty matches any path.
+	Path   string `json:"path,omitempty"`
+	// Method is the request method to match, e.g. "OPTIONS". Empty matches
+	// any method.
+	Method string `json:"method,omitempty"`
+}
+
+// matches reports whether the exclusion applies to r
+func (x HTTPExclusion) matches(r *http.Request) bool {
+	if x.Path == "" && x.Method == "" {
+		return false
+	}
+	if x.Method != "" && !strings.EqualFold(x.Method, r.Method) {
+		return false
+	}
+	return x.Path == "" || matchPath(x.Path, r.URL.Path)
 }
 
 // NewHTTPMetrics creates a new HTTP metrics collector with the specified
@@ -35,9 +93,19 @@ func NewHTTPMetrics(maxSamples int) *HTTPMetrics {
 		responseTimes: make([]int64, 0, maxSamples),
 		maxSamples:   maxSamples,
 		startTime:    time.Now(),
+		clock:        clock.Real,
+		labeler:      DefaultRouteLabeler,
 	}
 }
 
+// SetClock replaces the time source used to measure response times and
+// request rates, restarting the rate's uptime. It should be called before the
+// middleware serves requests.
+func (h *HTTPMetrics) SetClock(c clock.Clock) {
+	h.clock = c
+	h.startTime = c.Now()
+}
+
 // HTTPStats represents current HTTP performance statistics
 // computed from collected metrics data
 type HTTPStats struct {
@@ -47,7 +115,21 @@ type HTTPStats struct {
 	RequestRate       float64 `json:"request_rate"`       // Per second
 	AvgResponseTime   int64   `json:"avg_response_time"`  // Nanoseconds
 	MaxResponseTime   int64   `json:"max_response_time"`  // Nanoseconds
+	P50ResponseTime   int64   `json:"p50_response_time"`  // Nanoseconds, over the last minute
+	P90ResponseTime   int64   `json:"p90_response_time"`
+	P95ResponseTime   int64   `json:"p95_response_time"`
+	P99ResponseTime   int64   `json:"p99_response_time"`
+	RequestBytes      int64   `json:"request_bytes"`      // Request bodies, in total
+	ResponseBytes     int64   `json:"response_bytes"`     // Response bodies, in total
+	AvgRequestSize    float64 `json:"avg_request_size"`   // Bytes per request body
+	AvgResponseSize   float64 `json:"avg_response_size"`  // Bytes per response body
+	BytesPerSecond    float64 `json:"bytes_per_second"`   // Request and response bytes, over the last minute
 	PendingRequests   int64   `json:"pending_requests"`
+	Status1xx         int64   `json:"status_1xx"`        // Responses per status class
+	Status2xx         int64   `json:"status_2xx"`
+	Status3xx         int64   `json:"status_3xx"`
+	Status4xx         int64   `json:"status_4xx"`
+	Status5xx         int64   `json:"status_5xx"`
 	Timestamp         time.Time `json:"timestamp"`
 }
 
@@ -57,6 +139,8 @@ type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
 	written    bool
+	metrics    *HTTPMetrics
+	bytes      int64
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -70,13 +154,51 @@ func (rw *responseWriter) Write(data []byte) (int, error) {
 		rw.statusCode = http.StatusOK
 		rw.written = true
 	}
-	return rw.ResponseWriter.Write(data)
+	n, err := rw.ResponseWriter.Write(data)
+	rw.bytes += int64(n)
+	rw.metrics.bandwidth.add(rw.metrics.clock.Now(), int64(n))
+	return n, err
+}
+
+// SetExclusions replaces the set of requests the middleware passes through
+// without recording. Passing no exclusions records every request.
+func (h *HTTPMetrics) SetExclusions(exclusions []HTTPExclusion) {
+	h.exclusionsMu.Lock()
+	defer h.exclusionsMu.Unlock()
+	h.exclusions = append([]HTTPExclusion(nil), exclusions...)
+}
+
+// GetExclusions returns the configured exclusions
+func (h *HTTPMetrics) GetExclusions() []HTTPExclusion {
+	h.exclusionsMu.RLock()
+	defer h.exclusionsMu.RUnlock()
+	return append([]HTTPExclusion(nil), h.exclusions...)
+}
+
+// isExcluded reports whether r matches any configured exclusion
+func (h *HTTPMetrics) isExcluded(r *http.Request) bool {
+	h.exclusionsMu.RLock()
+	defer h.exclusionsMu.RUnlock()
+	for _, exclusion := range h.exclusions {
+		if exclusion.matches(r) {
+			return true
+		}
+	}
+	return false
 }
 
-// Middleware creates HTTP middleware that collects performance metrics
+// Middleware creates HTTP middleware that collects performance metrics.
+// Requests matching an exclusion are passed to next without being recorded.
+// Recorded requests carry a SegmentRecorder in their context, see
+// RecorderFromContext.
 func (h *HTTPMetrics) Middleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		startTime := time.Now()
+		if h.isExcluded(r) {
+			next(w, r)
+			return
+		}
+		
+		startTime := h.clock.Now()
 		atomic.AddInt64(&h.pendingRequests, 1)
 		defer atomic.AddInt64(&h.pendingRequests, -1)
 		
@@ -84,18 +206,29 @@ func (h *HTTPMetrics) Middleware(next http.HandlerFunc) http.HandlerFunc {
 		wrapped := &responseWriter{
 			ResponseWriter: w,
 			statusCode:     http.StatusOK,
+			metrics:        h,
 		}
 		
-		// Process request
-		next(wrapped, r)
+		// Process request with a recorder for custom measurements, counting
+		// the body bytes the handler reads
+		recorder := h.newSegmentRecorder()
+		served := r.WithContext(context.WithValue(r.Context(), segmentContextKey{}, recorder))
+		var body *countingBody
+		if r.Body != nil {
+			body = &countingBody{ReadCloser: r.Body, metrics: h}
+			served.Body = body
+		}
+		next(wrapped, served)
 		
 		// Calculate metrics
-		duration := time.Since(startTime)
+		duration := h.clock.Now().Sub(startTime)
 		durationNs := duration.Nanoseconds()
 		
 		// Update counters
 		atomic.AddInt64(&h.requestCount, 1)
 		atomic.AddInt64(&h.totalResponseTime, durationNs)
+		atomic.AddInt64(&h.requestBytes, h.requestSize(r, body, startTime.Add(duration)))
+		atomic.AddInt64(&h.responseBytes, wrapped.bytes)
 		
 		// Update max response time
 		for {
@@ -109,10 +242,16 @@ func (h *HTTPMetrics) Middleware(next http.HandlerFunc) http.HandlerFunc {
 		}
 		
 		// Count errors (status >= 400)
-		if wrapped.statusCode >= 400 {
+		failed := wrapped.statusCode >= 400
+		if failed {
 			atomic.AddInt64(&h.errorCount, 1)
 		}
 		
+		h.recordRoutes(r, durationNs, failed)
+		h.recordBreakdown(served, wrapped.statusCode, durationNs)
+		h.recordSegments(recorder)
+		h.latency.record(startTime.Add(duration), durationNs)
+		
 		// Store response time sample (with lock)
 		h.responseTimeMu.Lock()
 		if len(h.responseTimes) < h.maxSamples {
@@ -139,15 +278,31 @@ func (h *HTTPMetrics) GetStats() HTTPStats {
 		ErrorCount:      errorCount,
 		MaxResponseTime: maxResponseTime,
 		PendingRequests: pendingRequests,
-		Timestamp:       time.Now(),
+		Status1xx:       atomic.LoadInt64(&h.statusClasses[0]),
+		Status2xx:       atomic.LoadInt64(&h.statusClasses[1]),
+		Status3xx:       atomic.LoadInt64(&h.statusClasses[2]),
+		Status4xx:       atomic.LoadInt64(&h.statusClasses[3]),
+		Status5xx:       atomic.LoadInt64(&h.statusClasses[4]),
+		RequestBytes:    atomic.LoadInt64(&h.requestBytes),
+		ResponseBytes:   atomic.LoadInt64(&h.responseBytes),
+		Timestamp:       h.clock.Now(),
 	}
+	stats.BytesPerSecond = h.bandwidth.perSecond(stats.Timestamp)
+	
+	percentiles := h.latency.percentiles(stats.Timestamp, 50, 90, 95, 99)
+	stats.P50ResponseTime = percentiles[0]
+	stats.P90ResponseTime = percentiles[1]
+	stats.P95ResponseTime = percentiles[2]
+	stats.P99ResponseTime = percentiles[3]
 	
 	if requestCount > 0 {
 		stats.ErrorRate = float64(errorCount) / float64(requestCount) * 100
 		stats.AvgResponseTime = totalResponseTime / requestCount
+		stats.AvgRequestSize = float64(stats.RequestBytes) / float64(requestCount)
+		stats.AvgResponseSize = float64(stats.ResponseBytes) / float64(requestCount)
 		
 		// Calculate request rate based on actual uptime
-		uptime := time.Since(h.startTime)
+		uptime := h.clock.Now().Sub(h.startTime)
 		if uptime > 0 {
 			stats.RequestRate = float64(requestCount) / uptime.Seconds()
 		}
@@ -174,9 +329,33 @@ func (h *HTTPMetrics) Reset() {
 	atomic.StoreInt64(&h.maxResponseTime, 0)
 	atomic.StoreInt64(&h.pendingRequests, 0)
 	atomic.StoreInt64(&h.bufferIndex, 0)
-	h.startTime = time.Now()
+	atomic.StoreInt64(&h.requestBytes, 0)
+	atomic.StoreInt64(&h.responseBytes, 0)
+	h.startTime = h.clock.Now()
 	
 	h.responseTimeMu.Lock()
 	h.responseTimes = h.responseTimes[:0]
 	h.responseTimeMu.Unlock()
+	
+	// Tracked routes stay tracked but lose their history
+	h.routesMu.Lock()
+	for route := range h.routes {
+		h.routes[route] = &routeTracker{}
+	}
+	h.routesMu.Unlock()
+	
+	h.labelsMu.Lock()
+	h.labels = nil
+	h.methods = nil
+	h.labelsMu.Unlock()
+	for i := range h.statusClasses {
+		atomic.StoreInt64(&h.statusClasses[i], 0)
+	}
+	
+	h.segmentsMu.Lock()
+	h.segments = nil
+	h.segmentsMu.Unlock()
+	
+	h.latency.reset()
+	h.bandwidth.reset()
 }
\ No newline at end of file
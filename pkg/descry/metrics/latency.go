@@ -0,0 +1,141 @@
+package metrics
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// Response time percentiles come from a log-linear histogram of
+// microseconds in the style of HDR histograms: durations below
+// latencySubBuckets*2 µs get a bucket each, and every power of two above is
+// split into latencySubBuckets buckets, so a percentile is within about 3%
+// of the true value while memory stays fixed however many requests arrive.
+const (
+	latencySubBuckets = 16
+	latencyMaxMicros  = int64(time.Hour / time.Microsecond) // Longer responses count as an hour
+	latencySlice      = 10 * time.Second                    // Granularity of the sliding window
+	latencySlices     = 6                                   // Slices covered: the last minute
+)
+
+// latencyBuckets is the number of buckets needed up to latencyMaxMicros
+var latencyBuckets = latencyBucket(latencyMaxMicros) + 1
+
+// latencyBucket returns the bucket index of a duration in microseconds
+func latencyBucket(micros int64) int {
+	if micros < 0 {
+		micros = 0
+	}
+	if micros > latencyMaxMicros {
+		micros = latencyMaxMicros
+	}
+	u := uint64(micros)
+	if u < 2*latencySubBuckets {
+		return int(u)
+	}
+	shift := bits.Len64(u) - 5 // Keeps u>>shift within [16, 32)
+	return shift*latencySubBuckets + int(u>>shift)
+}
+
+// latencyBucketValue returns the duration, in nanoseconds, a bucket stands
+// for: the midpoint of the microseconds it covers
+func latencyBucketValue(index int) int64 {
+	if index < 2*latencySubBuckets {
+		return int64(index) * int64(time.Microsecond)
+	}
+	shift := index/latencySubBuckets - 1
+	lower := int64(index%latencySubBuckets+latencySubBuckets) << shift
+	width := int64(1) << shift
+	return (lower*2 + width) * int64(time.Microsecond) / 2
+}
+
+// latencySliceCounts holds the bucket counts of one slice of the window
+type latencySliceCounts struct {
+	epoch  int64 // Slice number since the Unix epoch; counts are stale when older than the window
+	total  int64
+	counts []int64
+}
+
+// latencyHistogram keeps response time bucket counts for the last minute in
+// rotating slices, so percentiles follow current latency rather than the
+// whole lifetime of the process
+type latencyHistogram struct {
+	mu     sync.Mutex
+	slices [latencySlices]latencySliceCounts
+}
+
+// sliceEpoch returns the slice number now falls in
+func sliceEpoch(now time.Time) int64 {
+	return now.UnixNano() / int64(latencySlice)
+}
+
+// record adds a response time observed at now
+func (l *latencyHistogram) record(now time.Time, durationNs int64) {
+	epoch := sliceEpoch(now)
+	index := latencyBucket(durationNs / int64(time.Microsecond))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	slice := &l.slices[epoch%latencySlices]
+	if slice.counts == nil {
+		slice.counts = make([]int64, latencyBuckets)
+	}
+	if slice.epoch != epoch {
+		clear(slice.counts)
+		slice.epoch = epoch
+		slice.total = 0
+	}
+	slice.counts[index]++
+	slice.total++
+}
+
+// percentiles returns the given percentiles, between 0 and 100, of the
+// response times recorded in the window ending at now, in nanoseconds. All
+// are 0 when no request completed in the window.
+func (l *latencyHistogram) percentiles(now time.Time, ps ...float64) []int64 {
+	epoch := sliceEpoch(now)
+	counts := make([]int64, latencyBuckets)
+	var total int64
+
+	l.mu.Lock()
+	for i := range l.slices {
+		slice := &l.slices[i]
+		if slice.counts == nil || slice.epoch > epoch || slice.epoch <= epoch-latencySlices {
+			continue
+		}
+		for bucket, count := range slice.counts {
+			counts[bucket] += count
+		}
+		total += slice.total
+	}
+	l.mu.Unlock()
+
+	values := make([]int64, len(ps))
+	if total == 0 {
+		return values
+	}
+	for i, p := range ps {
+		// Nearest rank, as for route percentiles
+		rank := int64(math.Ceil(p / 100 * float64(total)))
+		if rank < 1 {
+			rank = 1
+		}
+		var seen int64
+		for bucket, count := range counts {
+			seen += count
+			if seen >= rank {
+				values[i] = latencyBucketValue(bucket)
+				break
+			}
+		}
+	}
+	return values
+}
+
+// reset discards every recorded response time
+func (l *latencyHistogram) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.slices = [latencySlices]latencySliceCounts{}
+}
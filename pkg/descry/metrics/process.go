@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProcessCollector samples what the operating system sees of the process,
+// which the Go runtime's statistics miss: resident memory, CPU use, open file
+// descriptors and threads. It is a metric provider read in rules under the
+// name process:
+//
+//	engine.RegisterMetricProvider(metrics.NewProcessCollector())
+//
+// On Linux the values come from /proc. Elsewhere a metric the platform
+// cannot provide is left out, and rules reading it fail to evaluate.
+type ProcessCollector struct {
+	mu      sync.Mutex
+	lastCPU time.Duration
+	lastAt  time.Time
+}
+
+// NewProcessCollector returns a collector for the current process
+func NewProcessCollector() *ProcessCollector {
+	c := &ProcessCollector{lastAt: time.Now()}
+	c.lastCPU, _ = processCPUTime()
+	return c
+}
+
+// Name returns the namespace of the collector's metrics in rules
+func (c *ProcessCollector) Name() string {
+	return "process"
+}
+
+// Collect samples the process:
+//
+//   - rss: resident set size in bytes
+//   - cpu_percent: CPU time used since the previous collection as a
+//     percentage of the wall time, up to 100 per core in use
+//   - open_fds: open file descriptors
+//   - max_fds: the soft limit on open file descriptors
+//   - num_threads: operating system threads
+func (c *ProcessCollector) Collect() map[string]float64 {
+	values := make(map[string]float64)
+	if rss, ok := processRSS(); ok {
+		values["rss"] = float64(rss)
+	}
+	if cpu, ok := processCPUTime(); ok {
+		now := time.Now()
+		c.mu.Lock()
+		values["cpu_percent"] = 0
+		if elapsed := now.Sub(c.lastAt); elapsed > 0 {
+			values["cpu_percent"] = float64(cpu-c.lastCPU) / float64(elapsed) * 100
+		}
+		c.lastCPU, c.lastAt = cpu, now
+		c.mu.Unlock()
+	}
+	if fds, ok := processOpenFDs(); ok {
+		values["open_fds"] = float64(fds)
+	}
+	if limit, ok := processFDLimit(); ok {
+		values["max_fds"] = float64(limit)
+	}
+	values["num_threads"] = float64(processThreads())
+	return values
+}
+
+// processRSS returns the resident set size from /proc/self/statm
+func processRSS() (int64, bool) {
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(statm))
+	if len(fields) < 2 {
+		return 0, false
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return pages * int64(os.Getpagesize()), true
+}
+
+// processOpenFDs counts the entries of the process's descriptor directory,
+// /proc/self/fd on Linux and /dev/fd on BSDs and macOS
+func processOpenFDs() (int, bool) {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		f, err := os.Open(dir)
+		if err != nil {
+			continue
+		}
+		names, err := f.Readdirnames(-1)
+		f.Close()
+		if err != nil {
+			continue
+		}
+		// The directory being read was itself an open descriptor
+		return len(names) - 1, true
+	}
+	return 0, false
+}
+
+// processThreads returns the Threads count of /proc/self/status, or else
+// the number of threads the Go runtime has created, which it does not give
+// back to the operating system
+func processThreads() int {
+	if status, err := os.ReadFile("/proc/self/status"); err == nil {
+		scanner := bufio.NewScanner(bytes.NewReader(status))
+		for scanner.Scan() {
+			if value, ok := strings.CutPrefix(scanner.Text(), "Threads:"); ok {
+				if threads, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+					return threads
+				}
+			}
+		}
+	}
+	return pprof.Lookup("threadcreate").Count()
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package metrics
+
+import "time"
+
+// processCPUTime is unavailable on this platform
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
+
+// processFDLimit is unavailable on this platform
+func processFDLimit() (uint64, bool) {
+	return 0, false
+}
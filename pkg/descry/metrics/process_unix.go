@@ -0,0 +1,26 @@
+//go:build unix
+
+package metrics
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime returns the user and system CPU time the process has used
+func processCPUTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
+
+// processFDLimit returns the soft limit on open file descriptors
+func processFDLimit() (uint64, bool) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, false
+	}
+	return uint64(limit.Cur), true
+}
@@ -0,0 +1,131 @@
+package metrics
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RouteStats are HTTP statistics for one tracked route, route label or
+// method. Apart from RequestCount, they are computed over the most recent
+// requests, so they reflect current behaviour rather than the whole uptime.
+type RouteStats struct {
+	Route           string  `json:"route"`             // Route, route label or method
+	RequestCount    int64   `json:"request_count"`     // Since tracking started
+	Samples         int     `json:"samples"`           // Recent requests the stats cover
+	ErrorRate       float64 `json:"error_rate"`        // Percentage of recent requests
+	AvgResponseTime int64   `json:"avg_response_time"` // Nanoseconds
+	P50             int64   `json:"p50"`               // Nanoseconds
+	P95             int64   `json:"p95"`               // Nanoseconds
+	P99             int64   `json:"p99"`               // Nanoseconds
+}
+
+// routeSample is one recorded request of a tracked route
+type routeSample struct {
+	duration int64
+	failed   bool
+}
+
+// routeTracker keeps a circular buffer of a route's recent requests
+type routeTracker struct {
+	mu       sync.Mutex
+	requests int64
+	samples  []routeSample
+	next     int
+}
+
+func (t *routeTracker) record(sample routeSample, maxSamples int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests++
+	if len(t.samples) < maxSamples {
+		t.samples = append(t.samples, sample)
+		return
+	}
+	t.samples[t.next] = sample
+	t.next = (t.next + 1) % maxSamples
+}
+
+func (t *routeTracker) stats(route string) RouteStats {
+	t.mu.Lock()
+	stats := RouteStats{Route: route, RequestCount: t.requests, Samples: len(t.samples)}
+	durations := make([]int64, len(t.samples))
+	var total int64
+	failed := 0
+	for i, sample := range t.samples {
+		durations[i] = sample.duration
+		total += sample.duration
+		if sample.failed {
+			failed++
+		}
+	}
+	t.mu.Unlock()
+
+	if len(durations) == 0 {
+		return stats
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	stats.ErrorRate = float64(failed) / float64(len(durations)) * 100
+	stats.AvgResponseTime = total / int64(len(durations))
+	stats.P50 = percentile(durations, 50)
+	stats.P95 = percentile(durations, 95)
+	stats.P99 = percentile(durations, 99)
+	return stats
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []int64, p int) int64 {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// matchPath reports whether path matches pattern, which is either an exact
+// path or, with a trailing "*", a path prefix
+func matchPath(pattern, path string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return pattern == path
+}
+
+// TrackRoute starts keeping per-route statistics for requests whose path
+// matches route: an exact path such as "/api/checkout", or a prefix ending in
+// "*" such as "/api/orders/*". A request matching several tracked routes
+// counts toward each. Tracking an already tracked route has no effect.
+func (h *HTTPMetrics) TrackRoute(route string) {
+	h.routesMu.Lock()
+	defer h.routesMu.Unlock()
+	if h.routes == nil {
+		h.routes = make(map[string]*routeTracker)
+	}
+	if _, exists := h.routes[route]; !exists {
+		h.routes[route] = &routeTracker{}
+	}
+}
+
+// GetRouteStats returns the statistics of a tracked route. It returns false
+// if the route is not tracked.
+func (h *HTTPMetrics) GetRouteStats(route string) (RouteStats, bool) {
+	h.routesMu.RLock()
+	tracker, exists := h.routes[route]
+	h.routesMu.RUnlock()
+	if !exists {
+		return RouteStats{}, false
+	}
+	return tracker.stats(route), true
+}
+
+// recordRoutes adds a completed request to every tracked route it matches
+func (h *HTTPMetrics) recordRoutes(r *http.Request, durationNs int64, failed bool) {
+	h.routesMu.RLock()
+	defer h.routesMu.RUnlock()
+	for route, tracker := range h.routes {
+		if matchPath(route, r.URL.Path) {
+			tracker.record(routeSample{duration: durationNs, failed: failed}, h.maxSamples)
+		}
+	}
+}
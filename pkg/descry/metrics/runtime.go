@@ -2,9 +2,12 @@
 // for use in Descry monitoring rules. It includes collectors for memory usage, garbage collection,
 // goroutine counts, and HTTP request statistics.
 //
-// Runtime metrics are collected automatically in the background and include:
+// Runtime metrics are collected automatically in the background through
+// runtime/metrics, without stopping the world, and include:
 //   - Memory metrics: heap allocation, system memory, objects count
-//   - Garbage collection: GC frequency, pause times, CPU fraction
+//   - Garbage collection: GC frequency, pause times and their distribution,
+//     CPU fraction, heap goal
+//   - Scheduler latency: how long runnable goroutines wait to run
 //   - Goroutine counts and CGO call statistics
 //
 // HTTP metrics are collected via middleware and include:
@@ -24,8 +27,11 @@ package metrics
 
 import (
 	"runtime"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/clock"
 )
 
 // RuntimeMetrics contains a snapshot of Go runtime statistics
@@ -54,6 +60,14 @@ type RuntimeMetrics struct {
 	NumGC          uint32    `json:"num_gc"`
 	NumForcedGC    uint32    `json:"num_forced_gc"`
 	GCCPUFraction  float64   `json:"gc_cpu_fraction"`
+	// GC pause percentiles over about the last minute
+	GCPauseP50Ns   uint64    `json:"gc_pause_p50_ns"`
+	GCPauseP99Ns   uint64    `json:"gc_pause_p99_ns"`
+	
+	// Scheduler metrics: how long runnable goroutines waited to run, over
+	// about the last minute
+	SchedLatencyP50Ns uint64 `json:"sched_latency_p50_ns"`
+	SchedLatencyP99Ns uint64 `json:"sched_latency_p99_ns"`
 	
 	// Goroutine metrics
 	NumGoroutine   int       `json:"num_goroutine"`
@@ -68,22 +82,33 @@ type RuntimeMetrics struct {
 type RuntimeCollector struct {
 	mu             sync.RWMutex
 	current        RuntimeMetrics
-	history        []RuntimeMetrics
+	history        []RuntimeMetrics // ring buffer, oldest sample at next once full
+	next           int              // index the next sample overwrites once history is full
 	maxHistory     int
 	collectInterval time.Duration
+	clock          clock.Clock
 	stopCh         chan struct{}
 	running        bool
+	collecting     sync.WaitGroup // the collection goroutine, waited for by Stop
+	readMu         sync.Mutex     // serializes reads, which update the percentile windows
+	reader         *runtimeReader
 }
 
 // NewRuntimeCollector creates a new runtime metrics collector with the specified
 // history buffer size and collection interval.
 func NewRuntimeCollector(maxHistory int, collectInterval time.Duration) *RuntimeCollector {
-	return &RuntimeCollector{
+	rc := &RuntimeCollector{
 		history:         make([]RuntimeMetrics, 0, maxHistory),
 		maxHistory:      maxHistory,
 		collectInterval: collectInterval,
+		clock:           clock.Real,
 		stopCh:          make(chan struct{}),
+		reader:          newRuntimeReader(),
 	}
+	
+	// Take an initial snapshot so GetCurrent is meaningful before Start
+	rc.collectMetrics()
+	return rc
 }
 
 // Start begins automatic collection of runtime metrics in a background goroutine
@@ -94,84 +119,97 @@ func (rc *RuntimeCollector) Start() {
 		return
 	}
 	rc.running = true
+	stopCh := rc.stopCh
+	rc.collecting.Add(1)
 	rc.mu.Unlock()
 
-	go rc.collectLoop()
+	go rc.collectLoop(stopCh)
 }
 
-// Stop halts the metrics collection and cleans up background resources
+// Stop halts the metrics collection and cleans up background resources. It
+// returns once the collection goroutine has exited.
 func (rc *RuntimeCollector) Stop() {
 	rc.mu.Lock()
-	defer rc.mu.Unlock()
-	
 	if !rc.running {
+		rc.mu.Unlock()
 		return
 	}
 	rc.running = false
 	close(rc.stopCh)
 	rc.stopCh = make(chan struct{}) // Recreate for potential restart
+	rc.mu.Unlock()
+	
+	rc.collecting.Wait()
+}
+
+// IsRunning reports whether metrics are being collected in the background
+func (rc *RuntimeCollector) IsRunning() bool {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return rc.running
+}
+
+// SetClock replaces the time source used to schedule collection and
+// timestamp samples. History and percentile windows taken with the previous
+// clock are discarded and a fresh sample taken; the collection loop picks up the clock when next
+// started.
+func (rc *RuntimeCollector) SetClock(c clock.Clock) {
+	rc.mu.Lock()
+	rc.clock = c
+	rc.history = rc.history[:0]
+	rc.next = 0
+	rc.mu.Unlock()
+	rc.readMu.Lock()
+	rc.reader = newRuntimeReader()
+	rc.readMu.Unlock()
+
+	rc.collectMetrics()
 }
 
-func (rc *RuntimeCollector) collectLoop() {
-	ticker := time.NewTicker(rc.collectInterval)
+func (rc *RuntimeCollector) now() time.Time {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return rc.clock.Now()
+}
+
+func (rc *RuntimeCollector) collectLoop(stopCh chan struct{}) {
+	defer rc.collecting.Done()
+	rc.mu.RLock()
+	ticker := rc.clock.NewTicker(rc.collectInterval)
+	rc.mu.RUnlock()
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			rc.collectMetrics()
-		case <-rc.stopCh:
+		case <-stopCh:
 			return
 		}
 	}
 }
 
+// collectMetrics records a sample. Memory and GC statistics are read through
+// runtime/metrics, which does not stop the world as runtime.ReadMemStats does.
 func (rc *RuntimeCollector) collectMetrics() {
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-
 	metrics := RuntimeMetrics{
-		// Memory metrics
-		HeapAlloc:      m.HeapAlloc,
-		HeapSys:        m.HeapSys,
-		HeapIdle:       m.HeapIdle,
-		HeapInuse:      m.HeapInuse,
-		HeapReleased:   m.HeapReleased,
-		HeapObjects:    m.HeapObjects,
-		StackInuse:     m.StackInuse,
-		StackSys:       m.StackSys,
-		MSpanInuse:     m.MSpanInuse,
-		MSpanSys:       m.MSpanSys,
-		MCacheInuse:    m.MCacheInuse,
-		MCacheSys:      m.MCacheSys,
-		OtherSys:       m.OtherSys,
-		Sys:            m.Sys,
-		
-		// GC metrics
-		NextGC:         m.NextGC,
-		LastGC:         m.LastGC,
-		PauseTotalNs:   m.PauseTotalNs,
-		NumGC:          m.NumGC,
-		NumForcedGC:    m.NumForcedGC,
-		GCCPUFraction:  m.GCCPUFraction,
-		
-		// Goroutine metrics
-		NumGoroutine:   runtime.NumGoroutine(),
-		NumCgoCall:     runtime.NumCgoCall(),
-		
-		// Timestamp
-		Timestamp:      time.Now(),
+		NumGoroutine: runtime.NumGoroutine(),
+		NumCgoCall:   runtime.NumCgoCall(),
+		Timestamp:    rc.now(),
 	}
+	rc.readMu.Lock()
+	rc.reader.read(&metrics, metrics.Timestamp)
+	rc.readMu.Unlock()
 
 	rc.mu.Lock()
 	rc.current = metrics
 	
-	// Add to history
-	rc.history = append(rc.history, metrics)
-	if len(rc.history) > rc.maxHistory {
-		// Remove oldest entry
-		copy(rc.history, rc.history[1:])
-		rc.history = rc.history[:rc.maxHistory]
+	// Add to history, overwriting the oldest entry once full
+	if len(rc.history) < rc.maxHistory {
+		rc.history = append(rc.history, metrics)
+	} else if rc.maxHistory > 0 {
+		rc.history[rc.next] = metrics
+		rc.next = (rc.next + 1) % rc.maxHistory
 	}
 	rc.mu.Unlock()
 }
@@ -187,9 +225,24 @@ func (rc *RuntimeCollector) GetHistory() []RuntimeMetrics {
 	defer rc.mu.RUnlock()
 	
 	// Return a copy to prevent data races
-	history := make([]RuntimeMetrics, len(rc.history))
-	copy(history, rc.history)
-	return history
+	return rc.historyFrom(0)
+}
+
+// historyFrom copies the samples from the i-th oldest on, oldest first.
+// Callers must hold rc.mu.
+func (rc *RuntimeCollector) historyFrom(i int) []RuntimeMetrics {
+	history := make([]RuntimeMetrics, 0, len(rc.history)-i)
+	start := rc.next + i
+	if start < len(rc.history) {
+		history = append(history, rc.history[start:]...)
+		return append(history, rc.history[:rc.next]...)
+	}
+	return append(history, rc.history[start-len(rc.history):rc.next]...)
+}
+
+// at returns the i-th oldest sample. Callers must hold rc.mu.
+func (rc *RuntimeCollector) at(i int) RuntimeMetrics {
+	return rc.history[(rc.next+i)%len(rc.history)]
 }
 
 func (rc *RuntimeCollector) GetHistoryWindow(duration time.Duration) []RuntimeMetrics {
@@ -200,16 +253,13 @@ func (rc *RuntimeCollector) GetHistoryWindow(duration time.Duration) []RuntimeMe
 		return []RuntimeMetrics{}
 	}
 	
-	cutoff := time.Now().Add(-duration)
-	var result []RuntimeMetrics
-	
-	for _, metrics := range rc.history {
-		if metrics.Timestamp.After(cutoff) {
-			result = append(result, metrics)
-		}
-	}
-	
-	return result
+	// Samples are recorded in timestamp order, so the window starts at the
+	// first sample after the cutoff
+	cutoff := rc.clock.Now().Add(-duration)
+	first := sort.Search(len(rc.history), func(i int) bool {
+		return rc.at(i).Timestamp.After(cutoff)
+	})
+	return rc.historyFrom(first)
 }
 
 // Utility functions for common metrics calculations
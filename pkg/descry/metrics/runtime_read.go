@@ -0,0 +1,240 @@
+package metrics
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+	runtimemetrics "runtime/metrics"
+	"time"
+)
+
+// runtimePercentileWindow is the span the scheduler latency and GC pause
+// percentiles cover, between one and two windows depending on when the
+// window last moved on
+const runtimePercentileWindow = time.Minute
+
+// runtimeMetricNames are the runtime/metrics samples read on each collection.
+// The memory and GC counters are required; the histograms are optional.
+var runtimeMetricNames = []string{
+	"/memory/classes/heap/objects:bytes",
+	"/memory/classes/heap/unused:bytes",
+	"/memory/classes/heap/free:bytes",
+	"/memory/classes/heap/released:bytes",
+	"/memory/classes/heap/stacks:bytes",
+	"/memory/classes/os-stacks:bytes",
+	"/memory/classes/metadata/mspan/inuse:bytes",
+	"/memory/classes/metadata/mspan/free:bytes",
+	"/memory/classes/metadata/mcache/inuse:bytes",
+	"/memory/classes/metadata/mcache/free:bytes",
+	"/memory/classes/other:bytes",
+	"/memory/classes/total:bytes",
+	"/gc/heap/objects:objects",
+	"/gc/heap/goal:bytes",
+	"/gc/cycles/total:gc-cycles",
+	"/gc/cycles/forced:gc-cycles",
+	"/cpu/classes/gc/total:cpu-seconds",
+	"/cpu/classes/total:cpu-seconds",
+	schedLatenciesMetric,
+	gcPausesMetric,
+}
+
+const (
+	schedLatenciesMetric = "/sched/latencies:seconds"
+	gcPausesMetric       = "/sched/pauses/total/gc:seconds"
+	// gcPausesMetricLegacy is the GC pause histogram before Go 1.22
+	gcPausesMetricLegacy = "/gc/pauses:seconds"
+)
+
+// runtimeReader reads runtime statistics through runtime/metrics, which,
+// unlike runtime.ReadMemStats, does not stop the world. Where a runtime does
+// not support a required metric it falls back to ReadMemStats.
+type runtimeReader struct {
+	samples  []runtimemetrics.Sample
+	index    map[string]int
+	gcStats  debug.GCStats
+	sched    histogramWindow
+	gcPauses histogramWindow
+}
+
+func newRuntimeReader() *runtimeReader {
+	r := &runtimeReader{index: make(map[string]int, len(runtimeMetricNames))}
+	for i, name := range runtimeMetricNames {
+		r.index[name] = i
+		r.samples = append(r.samples, runtimemetrics.Sample{Name: name})
+	}
+	return r
+}
+
+// read fills m with the current statistics
+func (r *runtimeReader) read(m *RuntimeMetrics, now time.Time) {
+	runtimemetrics.Read(r.samples)
+	if pauses := &r.samples[r.index[gcPausesMetric]]; pauses.Name == gcPausesMetric && pauses.Value.Kind() == runtimemetrics.KindBad {
+		pauses.Name = gcPausesMetricLegacy
+		runtimemetrics.Read(r.samples)
+	}
+
+	if !r.readMemory(m) {
+		readMemStats(m)
+	} else {
+		// Total pause time and the last GC are not in runtime/metrics;
+		// ReadGCStats takes the heap lock but does not stop the world
+		debug.ReadGCStats(&r.gcStats)
+		m.PauseTotalNs = uint64(r.gcStats.PauseTotal)
+		if !r.gcStats.LastGC.IsZero() {
+			m.LastGC = uint64(r.gcStats.LastGC.UnixNano())
+		}
+	}
+
+	if h := r.histogram(schedLatenciesMetric); h != nil {
+		p50, p99 := r.sched.percentiles(h, now)
+		m.SchedLatencyP50Ns, m.SchedLatencyP99Ns = secondsToNs(p50), secondsToNs(p99)
+	}
+	if h := r.histogram(gcPausesMetric); h != nil {
+		p50, p99 := r.gcPauses.percentiles(h, now)
+		m.GCPauseP50Ns, m.GCPauseP99Ns = secondsToNs(p50), secondsToNs(p99)
+	}
+}
+
+// readMemory fills the memory and GC fields of m, returning false if a
+// required metric is not supported
+func (r *runtimeReader) readMemory(m *RuntimeMetrics) bool {
+	for _, sample := range r.samples {
+		if sample.Name != schedLatenciesMetric && sample.Name != gcPausesMetric &&
+			sample.Name != gcPausesMetricLegacy && sample.Value.Kind() == runtimemetrics.KindBad {
+			return false
+		}
+	}
+	objects := r.uint64("/memory/classes/heap/objects:bytes")
+	unused := r.uint64("/memory/classes/heap/unused:bytes")
+	free := r.uint64("/memory/classes/heap/free:bytes")
+	released := r.uint64("/memory/classes/heap/released:bytes")
+	stacks := r.uint64("/memory/classes/heap/stacks:bytes")
+
+	m.HeapAlloc = objects
+	m.HeapInuse = objects + unused
+	m.HeapIdle = free + released
+	m.HeapReleased = released
+	m.HeapSys = m.HeapInuse + m.HeapIdle
+	m.HeapObjects = r.uint64("/gc/heap/objects:objects")
+	m.StackInuse = stacks
+	m.StackSys = stacks + r.uint64("/memory/classes/os-stacks:bytes")
+	m.MSpanInuse = r.uint64("/memory/classes/metadata/mspan/inuse:bytes")
+	m.MSpanSys = m.MSpanInuse + r.uint64("/memory/classes/metadata/mspan/free:bytes")
+	m.MCacheInuse = r.uint64("/memory/classes/metadata/mcache/inuse:bytes")
+	m.MCacheSys = m.MCacheInuse + r.uint64("/memory/classes/metadata/mcache/free:bytes")
+	m.OtherSys = r.uint64("/memory/classes/other:bytes")
+	m.Sys = r.uint64("/memory/classes/total:bytes")
+
+	m.NextGC = r.uint64("/gc/heap/goal:bytes")
+	m.NumGC = uint32(r.uint64("/gc/cycles/total:gc-cycles"))
+	m.NumForcedGC = uint32(r.uint64("/gc/cycles/forced:gc-cycles"))
+	if total := r.float64("/cpu/classes/total:cpu-seconds"); total > 0 {
+		m.GCCPUFraction = r.float64("/cpu/classes/gc/total:cpu-seconds") / total
+	}
+	return true
+}
+
+func (r *runtimeReader) uint64(name string) uint64 {
+	return r.samples[r.index[name]].Value.Uint64()
+}
+
+func (r *runtimeReader) float64(name string) float64 {
+	return r.samples[r.index[name]].Value.Float64()
+}
+
+// histogram returns the named histogram, nil if it is not supported
+func (r *runtimeReader) histogram(name string) *runtimemetrics.Float64Histogram {
+	value := r.samples[r.index[name]].Value
+	if value.Kind() != runtimemetrics.KindFloat64Histogram {
+		return nil
+	}
+	return value.Float64Histogram()
+}
+
+// readMemStats fills the memory and GC fields of m with runtime.ReadMemStats
+func readMemStats(m *RuntimeMetrics) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	m.HeapAlloc = stats.HeapAlloc
+	m.HeapSys = stats.HeapSys
+	m.HeapIdle = stats.HeapIdle
+	m.HeapInuse = stats.HeapInuse
+	m.HeapReleased = stats.HeapReleased
+	m.HeapObjects = stats.HeapObjects
+	m.StackInuse = stats.StackInuse
+	m.StackSys = stats.StackSys
+	m.MSpanInuse = stats.MSpanInuse
+	m.MSpanSys = stats.MSpanSys
+	m.MCacheInuse = stats.MCacheInuse
+	m.MCacheSys = stats.MCacheSys
+	m.OtherSys = stats.OtherSys
+	m.Sys = stats.Sys
+
+	m.NextGC = stats.NextGC
+	m.LastGC = stats.LastGC
+	m.PauseTotalNs = stats.PauseTotalNs
+	m.NumGC = stats.NumGC
+	m.NumForcedGC = stats.NumForcedGC
+	m.GCCPUFraction = stats.GCCPUFraction
+}
+
+// histogramWindow turns a cumulative runtime histogram into percentiles over
+// recent observations, by subtracting the counts seen at least
+// runtimePercentileWindow ago
+type histogramWindow struct {
+	base  []uint64 // counts at the start of the window, nil for process start
+	mid   []uint64 // counts the window moves on to next
+	midAt time.Time
+}
+
+// percentiles returns the median and 99th percentile of the observations in
+// the window, 0 if there were none
+func (w *histogramWindow) percentiles(h *runtimemetrics.Float64Histogram, now time.Time) (p50, p99 float64) {
+	if w.mid == nil || len(w.mid) != len(h.Counts) {
+		w.base, w.mid, w.midAt = nil, append([]uint64(nil), h.Counts...), now
+	} else if now.Sub(w.midAt) >= runtimePercentileWindow {
+		w.base, w.mid, w.midAt = w.mid, append(w.base[:0], h.Counts...), now
+	}
+
+	counts := make([]uint64, len(h.Counts))
+	var total uint64
+	for i, count := range h.Counts {
+		if w.base != nil {
+			count -= w.base[i]
+		}
+		counts[i] = count
+		total += count
+	}
+	return histogramPercentile(h.Buckets, counts, total, 0.5), histogramPercentile(h.Buckets, counts, total, 0.99)
+}
+
+// histogramPercentile returns the midpoint of the bucket holding quantile q
+// of the counts, using the finite boundary for the open-ended buckets
+func histogramPercentile(buckets []float64, counts []uint64, total uint64, q float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(total)))
+	var seen uint64
+	for i, count := range counts {
+		seen += count
+		if seen < rank {
+			continue
+		}
+		low, high := buckets[i], buckets[i+1]
+		switch {
+		case math.IsInf(low, -1):
+			return high
+		case math.IsInf(high, 1):
+			return low
+		default:
+			return (low + high) / 2
+		}
+	}
+	return 0
+}
+
+func secondsToNs(seconds float64) uint64 {
+	return uint64(seconds * float64(time.Second))
+}
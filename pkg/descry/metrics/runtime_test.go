@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/clock"
+)
+
+func TestRuntimeHistoryWrapAround(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	rc := NewRuntimeCollector(5, time.Second)
+	rc.SetClock(fake)
+
+	// Eight samples a second apart in a buffer of five: the three oldest are
+	// overwritten and the oldest remaining sample sits mid-buffer
+	for i := 1; i < 8; i++ {
+		fake.Advance(time.Second)
+		rc.collectMetrics()
+	}
+	if rc.next == 0 {
+		t.Fatal("expected the history to have wrapped")
+	}
+
+	history := rc.GetHistory()
+	if len(history) != 5 {
+		t.Fatalf("expected 5 samples, got %d", len(history))
+	}
+	for i, sample := range history {
+		if want := start.Add(time.Duration(3+i) * time.Second); !sample.Timestamp.Equal(want) {
+			t.Errorf("sample %d: expected %v, got %v", i, want, sample.Timestamp)
+		}
+	}
+
+	now := fake.Now()
+	tests := []struct {
+		window time.Duration
+		want   int
+	}{
+		{0, 0},
+		{500 * time.Millisecond, 1},
+		{time.Second, 1},
+		{2500 * time.Millisecond, 3},
+		{4 * time.Second, 4},
+		{5 * time.Second, 5},
+		{time.Hour, 5},
+	}
+	for _, tt := range tests {
+		window := rc.GetHistoryWindow(tt.window)
+		if len(window) != tt.want {
+			t.Errorf("window %v: expected %d samples, got %d", tt.window, tt.want, len(window))
+			continue
+		}
+		// The window is the newest samples, oldest first, all after the cutoff
+		for i, sample := range window {
+			if want := history[len(history)-tt.want+i].Timestamp; !sample.Timestamp.Equal(want) {
+				t.Errorf("window %v sample %d: expected %v, got %v", tt.window, i, want, sample.Timestamp)
+			}
+			if !sample.Timestamp.After(now.Add(-tt.window)) {
+				t.Errorf("window %v: sample %v is outside the window", tt.window, sample.Timestamp)
+			}
+		}
+	}
+
+	// Wrapping exactly once around leaves the oldest sample at index zero
+	for remaining := 5 - rc.next; remaining > 0; remaining-- {
+		fake.Advance(time.Second)
+		rc.collectMetrics()
+	}
+	history = rc.GetHistory()
+	if rc.next != 0 || len(history) != 5 || !history[0].Timestamp.Equal(fake.Now().Add(-4*time.Second)) ||
+		!history[4].Timestamp.Equal(fake.Now()) {
+		t.Errorf("unexpected history after a full wrap: next %d, %d samples", rc.next, len(history))
+	}
+	if window := rc.GetHistoryWindow(2500 * time.Millisecond); len(window) != 3 || !window[2].Timestamp.Equal(fake.Now()) {
+		t.Errorf("expected the newest 3 samples, got %d", len(window))
+	}
+}
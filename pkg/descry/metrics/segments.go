@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/clock"
+)
+
+// segmentContextKey is the request context key of the middleware's
+// SegmentRecorder
+type segmentContextKey struct{}
+
+// SegmentRecorder collects custom measurements for one request, such as time
+// spent in the database or cache hits, so that handlers deep in the call
+// stack can attach them to the request being served. When the request
+// completes, the middleware adds each segment's total to the HTTP segment
+// statistics. A nil SegmentRecorder, returned for requests the middleware
+// does not record, discards measurements, so handlers need not check for it.
+type SegmentRecorder struct {
+	mu     sync.Mutex
+	clock  clock.Clock
+	values map[string]float64
+	order  []string
+}
+
+// RecorderFromContext returns the SegmentRecorder of the request ctx belongs
+// to, or nil if the request is not recorded by the middleware
+func RecorderFromContext(ctx context.Context) *SegmentRecorder {
+	if ctx == nil {
+		return nil
+	}
+	recorder, _ := ctx.Value(segmentContextKey{}).(*SegmentRecorder)
+	return recorder
+}
+
+// Add adds n to the named segment, e.g. Add("cache_hits", 1)
+func (r *SegmentRecorder) Add(name string, n float64) {
+	if r == nil || name == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.values == nil {
+		r.values = make(map[string]float64)
+	}
+	if _, exists := r.values[name]; !exists {
+		r.order = append(r.order, name)
+	}
+	r.values[name] += n
+}
+
+// Duration adds d to the named segment. Durations are recorded in
+// milliseconds, the unit rules use for times.
+func (r *SegmentRecorder) Duration(name string, d time.Duration) {
+	r.Add(name, float64(d)/float64(time.Millisecond))
+}
+
+// Time starts timing the named segment and returns a function that adds the
+// elapsed time when called, e.g. defer recorder.Time("db")()
+func (r *SegmentRecorder) Time(name string) func() {
+	if r == nil {
+		return func() {}
+	}
+	start := r.clock.Now()
+	return func() {
+		r.Duration(name, r.clock.Now().Sub(start))
+	}
+}
+
+// totals returns a copy of the recorded segments in the order they were
+// first recorded
+func (r *SegmentRecorder) totals() ([]string, map[string]float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	values := make(map[string]float64, len(r.values))
+	for name, value := range r.values {
+		values[name] = value
+	}
+	return append([]string(nil), r.order...), values
+}
+
+// SegmentStats summarize a segment over recent requests that recorded it
+type SegmentStats struct {
+	Segment      string  `json:"segment"`
+	RequestCount int64   `json:"request_count"` // Requests that recorded the segment since startup
+	Samples      int     `json:"samples"`       // Recent requests the stats cover
+	Average      float64 `json:"average"`       // Per-request total, averaged
+	Max          float64 `json:"max"`           // Largest per-request total
+}
+
+// segmentTracker keeps a circular buffer of a segment's recent per-request
+// totals
+type segmentTracker struct {
+	mu       sync.Mutex
+	requests int64
+	samples  []float64
+	next     int
+}
+
+func (t *segmentTracker) record(value float64, maxSamples int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests++
+	if len(t.samples) < maxSamples {
+		t.samples = append(t.samples, value)
+		return
+	}
+	t.samples[t.next] = value
+	t.next = (t.next + 1) % maxSamples
+}
+
+func (t *segmentTracker) stats(segment string) SegmentStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := SegmentStats{Segment: segment, RequestCount: t.requests, Samples: len(t.samples)}
+	if len(t.samples) == 0 {
+		return stats
+	}
+	var total float64
+	stats.Max = t.samples[0]
+	for _, value := range t.samples {
+		total += value
+		if value > stats.Max {
+			stats.Max = value
+		}
+	}
+	stats.Average = total / float64(len(t.samples))
+	return stats
+}
+
+// newSegmentRecorder returns a recorder for a request about to be served
+func (h *HTTPMetrics) newSegmentRecorder() *SegmentRecorder {
+	return &SegmentRecorder{clock: h.clock}
+}
+
+// recordSegments adds a completed request's segment totals to the segment
+// statistics
+func (h *HTTPMetrics) recordSegments(recorder *SegmentRecorder) {
+	names, values := recorder.totals()
+	if len(names) == 0 {
+		return
+	}
+	h.segmentsMu.Lock()
+	defer h.segmentsMu.Unlock()
+	if h.segments == nil {
+		h.segments = make(map[string]*segmentTracker)
+	}
+	for _, name := range names {
+		tracker, exists := h.segments[name]
+		if !exists {
+			tracker = &segmentTracker{}
+			h.segments[name] = tracker
+		}
+		tracker.record(values[name], h.maxSamples)
+	}
+}
+
+// GetSegmentStats returns the statistics of a segment recorded through a
+// request's SegmentRecorder. It returns false if no request has recorded it.
+func (h *HTTPMetrics) GetSegmentStats(segment string) (SegmentStats, bool) {
+	h.segmentsMu.RLock()
+	tracker, exists := h.segments[segment]
+	h.segmentsMu.RUnlock()
+	if !exists {
+		return SegmentStats{}, false
+	}
+	return tracker.stats(segment), true
+}
+
+// GetAllSegmentStats returns the statistics of every recorded segment,
+// sorted by name
+func (h *HTTPMetrics) GetAllSegmentStats() []SegmentStats {
+	h.segmentsMu.RLock()
+	names := make([]string, 0, len(h.segments))
+	for name := range h.segments {
+		names = append(names, name)
+	}
+	h.segmentsMu.RUnlock()
+	sort.Strings(names)
+
+	stats := make([]SegmentStats, 0, len(names))
+	for _, name := range names {
+		if s, ok := h.GetSegmentStats(name); ok {
+			stats = append(stats, s)
+		}
+	}
+	return stats
+}
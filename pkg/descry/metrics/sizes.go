@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// bandwidthWindow sums the bytes transferred in each slice of the last
+// minute, the same rotating slices as response time percentiles. Bytes count
+// as they are read and written, so a long upload or download shows up while
+// it is in flight rather than when it completes.
+type bandwidthWindow struct {
+	mu     sync.Mutex
+	epochs [latencySlices]int64
+	bytes  [latencySlices]int64
+}
+
+// add counts n bytes transferred at now
+func (b *bandwidthWindow) add(now time.Time, n int64) {
+	if n <= 0 {
+		return
+	}
+	epoch := sliceEpoch(now)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	slot := epoch % latencySlices
+	if b.epochs[slot] != epoch {
+		b.epochs[slot] = epoch
+		b.bytes[slot] = 0
+	}
+	b.bytes[slot] += n
+}
+
+// perSecond returns the bytes transferred per second over the window ending
+// at now
+func (b *bandwidthWindow) perSecond(now time.Time) float64 {
+	epoch := sliceEpoch(now)
+	var total int64
+	b.mu.Lock()
+	for slot, slotEpoch := range b.epochs {
+		if slotEpoch <= epoch && slotEpoch > epoch-latencySlices {
+			total += b.bytes[slot]
+		}
+	}
+	b.mu.Unlock()
+	return float64(total) / (latencySlice * latencySlices).Seconds()
+}
+
+// reset discards every counted byte
+func (b *bandwidthWindow) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.epochs = [latencySlices]int64{}
+	b.bytes = [latencySlices]int64{}
+}
+
+// countingBody wraps a request body to count the bytes the handler reads
+type countingBody struct {
+	io.ReadCloser
+	metrics *HTTPMetrics
+	n       int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	c.metrics.bandwidth.add(c.metrics.clock.Now(), int64(n))
+	return n, err
+}
+
+// requestSize returns the size of a served request's body: the bytes the
+// handler read, or the declared Content-Length if the handler read less.
+// Bytes declared but not read are counted toward bandwidth at now.
+func (h *HTTPMetrics) requestSize(r *http.Request, body *countingBody, now time.Time) int64 {
+	var size int64
+	if body != nil {
+		size = body.n
+	}
+	if r.ContentLength > size {
+		h.bandwidth.add(now, r.ContentLength-size)
+		size = r.ContentLength
+	}
+	return size
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SQLCollector samples the connection pool statistics of a *sql.DB. It is a
+// metric provider: registered with Engine.RegisterMetricProvider, it is
+// sampled once per evaluation cycle and rules read its metrics under its
+// name, e.g. db.in_use or db.wait_duration:
+//
+//	engine.RegisterMetricProvider(metrics.NewSQLCollector("db", db))
+//
+// Pool exhaustion shows as in_use reaching max_open_conns and as wait_count
+// and wait_duration growing, which trend() turns into rates.
+type SQLCollector struct {
+	name string
+	db   *sql.DB
+}
+
+// NewSQLCollector returns a collector for db's pool, read in rules under
+// name. Services with several databases register one collector per pool,
+// each with its own name, such as "orders_db".
+func NewSQLCollector(name string, db *sql.DB) *SQLCollector {
+	return &SQLCollector{name: name, db: db}
+}
+
+// Name returns the namespace of the collector's metrics in rules
+func (c *SQLCollector) Name() string {
+	return c.name
+}
+
+// Collect samples db.Stats(). Durations are in milliseconds, the unit rules
+// use for times; wait_count, wait_duration and the *_closed counts are
+// totals since the pool was opened.
+func (c *SQLCollector) Collect() map[string]float64 {
+	stats := c.db.Stats()
+	values := map[string]float64{
+		"max_open_conns":       float64(stats.MaxOpenConnections),
+		"open_conns":           float64(stats.OpenConnections),
+		"in_use":               float64(stats.InUse),
+		"idle":                 float64(stats.Idle),
+		"wait_count":           float64(stats.WaitCount),
+		"wait_duration":        float64(stats.WaitDuration) / float64(time.Millisecond),
+		"max_idle_closed":      float64(stats.MaxIdleClosed),
+		"max_idle_time_closed": float64(stats.MaxIdleTimeClosed),
+		"max_lifetime_closed":  float64(stats.MaxLifetimeClosed),
+		"utilization":          0,
+		"avg_wait":             0,
+	}
+	// Percentage of the pool's connection limit in use; 0 when unlimited
+	if stats.MaxOpenConnections > 0 {
+		values["utilization"] = float64(stats.InUse) / float64(stats.MaxOpenConnections) * 100
+	}
+	// Average time a connection request waited, in milliseconds
+	if stats.WaitCount > 0 {
+		values["avg_wait"] = values["wait_duration"] / float64(stats.WaitCount)
+	}
+	return values
+}
@@ -2,6 +2,7 @@ package descry
 
 import (
 	"fmt"
+	"log/slog"
 	"runtime"
 	"runtime/debug"
 	"syscall"
@@ -183,7 +184,7 @@ func SafeEngineExecution(limits *ResourceLimits, fn func(*Engine) error) error {
 		if r := recover(); r != nil {
 			// Restore limits before re-panicking
 			if restoreErr := enforcer.RestoreLimits(); restoreErr != nil {
-				fmt.Printf("ERROR: Failed to restore OS limits after panic: %v\n", restoreErr)
+				engine.log().Error("Failed to restore OS limits after panic", slog.Any("error", restoreErr))
 			}
 			panic(r)
 		}
@@ -191,7 +192,7 @@ func SafeEngineExecution(limits *ResourceLimits, fn func(*Engine) error) error {
 
 	defer func() {
 		if restoreErr := enforcer.RestoreLimits(); restoreErr != nil {
-			fmt.Printf("ERROR: Failed to restore OS limits: %v\n", restoreErr)
+			engine.log().Error("Failed to restore OS limits", slog.Any("error", restoreErr))
 		}
 	}()
 
@@ -2,6 +2,8 @@ package parser
 
 import (
 	"bytes"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -64,7 +66,12 @@ func (p *Program) CountNodes() int {
 type WhenStatement struct {
 	Token     Token // the 'when' token
 	Condition Expression
+	// During optionally restricts the rule to a time window, e.g. "Mon-Fri 09:00-17:00"
+	During    *StringLiteral
+	// Within is the look-back window of event() calls in the condition, e.g. 10m
+	Within    *UnitExpression
 	Body      *BlockStatement
+	End       Token // the closing '}' token of the body
 }
 
 func (ws *WhenStatement) statementNode()       {}
@@ -77,6 +84,12 @@ func (ws *WhenStatement) String() string {
 		out.WriteString(ws.Condition.String())
 	}
 	out.WriteString(" ")
+	if ws.Within != nil {
+		out.WriteString("within " + ws.Within.String() + " ")
+	}
+	if ws.During != nil {
+		out.WriteString("during " + ws.During.String() + " ")
+	}
 	if ws.Body != nil {
 		out.WriteString(ws.Body.String())
 	}
@@ -92,6 +105,12 @@ func (ws *WhenStatement) CountNodes() int {
 			count += 1
 		}
 	}
+	if ws.During != nil {
+		count += 1
+	}
+	if ws.Within != nil {
+		count += 1
+	}
 	if ws.Body != nil {
 		// BlockStatement implements NodeCounter, so we can call it directly
 		count += ws.Body.CountNodes()
@@ -99,6 +118,185 @@ func (ws *WhenStatement) CountNodes() int {
 	return count
 }
 
+// LetStatement binds a name to the value of an expression for the statements
+// that follow it in the same rule
+type LetStatement struct {
+	Token Token // the 'let' token
+	Name  *Identifier
+	Value Expression
+}
+
+func (ls *LetStatement) statementNode()       {}
+func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ls.TokenLiteral() + " ")
+	if ls.Name != nil {
+		out.WriteString(ls.Name.String())
+	}
+	out.WriteString(" = ")
+	if ls.Value != nil {
+		out.WriteString(ls.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
+func (ls *LetStatement) CountNodes() int {
+	count := 2 // Count the let statement and its name
+	if ls.Value != nil {
+		if counter, ok := ls.Value.(NodeCounter); ok {
+			count += counter.CountNodes()
+		} else {
+			count += 1
+		}
+	}
+	return count
+}
+
+// ConstStatement declares a named constant at the top level of a rule file,
+// such as const HIGH_MEM = 800MB. Constants are shared by every rule in the
+// file and cannot be reassigned.
+type ConstStatement struct {
+	Token Token // the 'const' token
+	Name  *Identifier
+	Value Expression
+}
+
+func (cs *ConstStatement) statementNode()       {}
+func (cs *ConstStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ConstStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(cs.TokenLiteral() + " ")
+	if cs.Name != nil {
+		out.WriteString(cs.Name.String())
+	}
+	out.WriteString(" = ")
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
+func (cs *ConstStatement) CountNodes() int {
+	count := 2 // Count the const statement and its name
+	if cs.Value != nil {
+		if counter, ok := cs.Value.(NodeCounter); ok {
+			count += counter.CountNodes()
+		} else {
+			count += 1
+		}
+	}
+	return count
+}
+
+// ImportStatement includes the constants and bindings of another rule file,
+// such as import "common/thresholds.dscr". The engine resolves imports before
+// rules are evaluated.
+type ImportStatement struct {
+	Token Token // the 'import' token
+	Path  *StringLiteral
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	if is.Path == nil {
+		return is.TokenLiteral() + ";"
+	}
+	return is.TokenLiteral() + " " + strconv.Quote(is.Path.Value) + ";"
+}
+
+func (is *ImportStatement) CountNodes() int { return 1 }
+
+// RuleStatement is a named rule block, letting one file define several rules:
+//
+//	rule "memory_leak" {
+//	  description: "Heap keeps growing"
+//	  severity: high
+//	  tags: "memory", "leak"
+//	  labels: team = "platform", tier = "1"
+//	  group: "memory"
+//	  when heap.alloc > 100MB && trend("heap.alloc", 300) > 0 { alert("Possible leak") }
+//	}
+type RuleStatement struct {
+	Token       Token // the 'rule' token
+	Name        *StringLiteral
+	Description string
+	Severity    string
+	Tags        []string
+	// Labels are key/value pairs attached to everything the rule produces
+	Labels      map[string]string
+	Group       string
+	// Every is the rule's evaluation interval, e.g. 30s; nil for the default
+	Every       *UnitExpression
+	// Cooldown is how long the rule rests after triggering; nil for none
+	Cooldown    *UnitExpression
+	Body        *BlockStatement // the statements of the rule, without metadata
+	End         Token           // the closing '}' token
+}
+
+func (rs *RuleStatement) statementNode()       {}
+func (rs *RuleStatement) TokenLiteral() string { return rs.Token.Literal }
+func (rs *RuleStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("rule ")
+	if rs.Name != nil {
+		out.WriteString(strconv.Quote(rs.Name.Value))
+	}
+	out.WriteString(" { ")
+	if rs.Description != "" {
+		out.WriteString("description: " + strconv.Quote(rs.Description) + " ")
+	}
+	if rs.Severity != "" {
+		out.WriteString("severity: " + rs.Severity + " ")
+	}
+	if len(rs.Tags) > 0 {
+		quoted := make([]string, len(rs.Tags))
+		for i, tag := range rs.Tags {
+			quoted[i] = strconv.Quote(tag)
+		}
+		out.WriteString("tags: " + strings.Join(quoted, ", ") + " ")
+	}
+	if len(rs.Labels) > 0 {
+		keys := make([]string, 0, len(rs.Labels))
+		for key := range rs.Labels {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		pairs := make([]string, len(keys))
+		for i, key := range keys {
+			pairs[i] = key + " = " + strconv.Quote(rs.Labels[key])
+		}
+		out.WriteString("labels: " + strings.Join(pairs, ", ") + " ")
+	}
+	if rs.Group != "" {
+		out.WriteString("group: " + strconv.Quote(rs.Group) + " ")
+	}
+	if rs.Every != nil {
+		out.WriteString("every: " + rs.Every.String() + " ")
+	}
+	if rs.Cooldown != nil {
+		out.WriteString("cooldown: " + rs.Cooldown.String() + " ")
+	}
+	if rs.Body != nil {
+		for _, s := range rs.Body.Statements {
+			out.WriteString(s.String())
+		}
+	}
+	out.WriteString(" }")
+	return out.String()
+}
+
+func (rs *RuleStatement) CountNodes() int {
+	count := 1 // Count the rule statement itself
+	if rs.Body != nil {
+		count += rs.Body.CountNodes()
+	}
+	return count
+}
+
 type BlockStatement struct {
 	Token      Token // the '{' token
 	Statements []Statement
@@ -172,6 +370,16 @@ func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
 func (fl *FloatLiteral) CountNodes() int { return 1 }
 
+type Boolean struct {
+	Token Token // the true or false token
+	Value bool
+}
+
+func (b *Boolean) expressionNode()      {}
+func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) String() string       { return b.Token.Literal }
+func (b *Boolean) CountNodes() int { return 1 }
+
 type StringLiteral struct {
 	Token Token
 	Value string
@@ -272,6 +480,18 @@ func (pe *PrefixExpression) String() string {
 	return out.String()
 }
 
+func (pe *PrefixExpression) CountNodes() int {
+	count := 1 // Count the prefix expression itself
+	if pe.Right != nil {
+		if counter, ok := pe.Right.(NodeCounter); ok {
+			count += counter.CountNodes()
+		} else {
+			count += 1
+		}
+	}
+	return count
+}
+
 type CallExpression struct {
 	Token     Token // the '(' token
 	Function  Expression // Identifier or FunctionLiteral
@@ -332,4 +552,72 @@ func (de *DotExpression) String() string {
 		out.WriteString(de.Right.String())
 	}
 	return out.String()
-}
\ No newline at end of file
+}
+// LabelSelector selects the series of a metric with the given labels, e.g.
+// custom.queue_depth{queue="email"}
+type LabelSelector struct {
+	Token  Token // the '{' token
+	Metric Expression
+	Labels map[string]string
+}
+
+func (ls *LabelSelector) expressionNode()      {}
+func (ls *LabelSelector) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LabelSelector) String() string {
+	var out bytes.Buffer
+	if ls.Metric != nil {
+		out.WriteString(ls.Metric.String())
+	}
+	names := make([]string, 0, len(ls.Labels))
+	for name := range ls.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + strconv.Quote(ls.Labels[name])
+	}
+	out.WriteString("{" + strings.Join(pairs, ", ") + "}")
+	return out.String()
+}
+
+func (ls *LabelSelector) CountNodes() int {
+	count := 1
+	if counter, ok := ls.Metric.(NodeCounter); ok {
+		count += counter.CountNodes()
+	} else if ls.Metric != nil {
+		count += 1
+	}
+	return count
+}
+
+// NamedArgument is a call argument given by name, e.g. severity: high
+type NamedArgument struct {
+	Token Token // the argument name token
+	Name  string
+	Value Expression
+}
+
+func (na *NamedArgument) expressionNode()      {}
+func (na *NamedArgument) TokenLiteral() string { return na.Token.Literal }
+func (na *NamedArgument) String() string {
+	var out bytes.Buffer
+	out.WriteString(na.Name)
+	out.WriteString(": ")
+	if na.Value != nil {
+		out.WriteString(na.Value.String())
+	}
+	return out.String()
+}
+
+func (na *NamedArgument) CountNodes() int {
+	count := 1 // Count the named argument itself
+	if na.Value != nil {
+		if counter, ok := na.Value.(NodeCounter); ok {
+			count += counter.CountNodes()
+		} else {
+			count += 1
+		}
+	}
+	return count
+}
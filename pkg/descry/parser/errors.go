@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError describes a syntax error at a position in the source
+type ParseError struct {
+	// Message describes what went wrong
+	Message string `json:"message"`
+	// Line and Column locate the offending token (both 1-based)
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	// Token is the literal text of the offending token
+	Token string `json:"token"`
+	// Expected is the token type the parser was looking for, if any
+	Expected string `json:"expected,omitempty"`
+	// Snippet is the source line followed by a caret under the offending token
+	Snippet string `json:"snippet"`
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// ParseErrors is the set of errors reported for one program. It is returned
+// by Engine.AddRule so callers can recover the individual positions with
+// errors.As.
+type ParseErrors []*ParseError
+
+// Error lists each error with its source snippet
+func (errs ParseErrors) Error() string {
+	var out strings.Builder
+	for i, err := range errs {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(err.Error())
+		if err.Snippet != "" {
+			out.WriteString("\n")
+			out.WriteString(err.Snippet)
+		}
+	}
+	return out.String()
+}
+
+// Unwrap returns the individual errors, so errors.As finds a *ParseError
+func (errs ParseErrors) Unwrap() []error {
+	unwrapped := make([]error, len(errs))
+	for i, err := range errs {
+		unwrapped[i] = err
+	}
+	return unwrapped
+}
+
+// addError records an error at tok, with expected naming the wanted token
+// type when the error is a mismatch
+func (p *Parser) addError(tok Token, expected string, format string, args ...interface{}) {
+	literal := tok.Literal
+	if tok.Type == EOF {
+		literal = "end of input"
+	}
+	p.errors = append(p.errors, &ParseError{
+		Message:  fmt.Sprintf(format, args...),
+		Line:     tok.Line,
+		Column:   tok.Column,
+		Token:    literal,
+		Expected: expected,
+		Snippet:  sourceSnippet(p.l.input, tok.Line, tok.Column),
+	})
+}
+
+// sourceSnippet returns the given source line with a caret under column.
+// Tabs before the column are kept so the caret lines up in a terminal.
+func sourceSnippet(input string, line, column int) string {
+	lines := strings.Split(input, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	text := strings.TrimRight(lines[line-1], "\r")
+
+	var caret strings.Builder
+	for i := 0; i < column-1 && i < len(text); i++ {
+		if text[i] == '\t' {
+			caret.WriteByte('\t')
+		} else {
+			caret.WriteByte(' ')
+		}
+	}
+	for i := len(text); i < column-1; i++ {
+		caret.WriteByte(' ')
+	}
+	caret.WriteByte('^')
+	return text + "\n" + caret.String()
+}
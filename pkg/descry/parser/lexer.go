@@ -11,13 +11,17 @@
 //	when heap.alloc > 200MB { alert("Memory usage high") }
 //	when avg(http.response_time, 5m) > 500ms { log("Slow responses") }
 //	when goroutines.count > 1000 && trend(heap.alloc, 2m) > 0 { alert("Resource leak") }
+//	when heap.alloc / heap.sys > 0.9 { alert("Heap nearly exhausted") }
 //
-// The lexer recognizes tokens including keywords (when, if), operators (>, <, ==, &&, ||),
-// literals (strings, numbers, units like MB/GB/ms), identifiers, and delimiters.
+// The lexer recognizes tokens including keywords (when, if, let, const, import, during, within, rule, true, false), operators (>, <, ==, &&, ||, + - * /,
+// matches, contains), literals (strings, numbers, units like MB/GB, ms/s/m/h/d and %), identifiers,
+// and delimiters.
 //
 // The parser builds an AST that can be evaluated efficiently during runtime monitoring.
 package parser
 
+import "strings"
+
 // TokenType represents the different types of tokens in the Descry DSL
 type TokenType int
 
@@ -35,9 +39,19 @@ const (
 	// Keywords
 	WHEN
 	IF
+	LET
+	CONST
+	IMPORT
+	DURING
+	WITHIN
+	RULE
+	TRUE
+	FALSE
 
 	// Operators
-	ASSIGN // =
+	MATCHES  // matches
+	CONTAINS // contains
+	ASSIGN   // =
 	EQ     // ==
 	NOT_EQ // !=
 	LT     // <
@@ -48,8 +62,14 @@ const (
 	OR     // ||
 	NOT    // !
 
+	PLUS     // +
+	MINUS    // -
+	ASTERISK // *
+	SLASH    // /
+
 	// Delimiters
 	COMMA     // ,
+	COLON     // :
 	SEMICOLON // ;
 	DOT       // .
 
@@ -59,11 +79,14 @@ const (
 	RBRACE // }
 
 	// Units
-	MB // megabytes
-	GB // gigabytes
-	MS // milliseconds
-	S  // seconds
-	M  // minutes
+	MB      // megabytes
+	GB      // gigabytes
+	MS      // milliseconds
+	S       // seconds
+	M       // minutes
+	H       // hours
+	D       // days
+	PERCENT // percent
 )
 
 // Token represents a single lexical unit in the Descry DSL with position information
@@ -83,11 +106,31 @@ type Token struct {
 var keywords = map[string]TokenType{
 	"when": WHEN,
 	"if":   IF,
-	"MB":   MB,
-	"GB":   GB,
-	"ms":   MS,
-	"s":    S,
-	"m":    M,
+	"let":  LET,
+	"const":  CONST,
+	"import": IMPORT,
+	"during": DURING,
+	"within": WITHIN,
+	"rule":   RULE,
+	"true":   TRUE,
+	"false":  FALSE,
+	// String operators; also callable as functions, e.g. contains(a, b)
+	"matches":  MATCHES,
+	"contains": CONTAINS,
+}
+
+// units maps lower-cased unit suffixes to their tokens. Units are matched
+// case-insensitively, so 5m, 5M, 200mb and 200MB are all accepted. A word is
+// only a unit directly after a number, so custom.d and let h = 1 still name
+// a metric and a variable.
+var units = map[string]TokenType{
+	"mb": MB,
+	"gb": GB,
+	"ms": MS,
+	"s":  S,
+	"m":  M,
+	"h":  H,
+	"d":  D,
 }
 
 // Lexer performs lexical analysis on Descry DSL source text,
@@ -99,6 +142,7 @@ type Lexer struct {
 	ch           byte // current char under examination
 	line         int
 	column       int
+	prev         TokenType // type of the last token returned
 }
 
 // NewLexer creates a new lexer for the given Descry DSL source text
@@ -136,6 +180,12 @@ func (l *Lexer) peekChar() byte {
 }
 
 func (l *Lexer) NextToken() Token {
+	tok := l.nextToken()
+	l.prev = tok.Type
+	return tok
+}
+
+func (l *Lexer) nextToken() Token {
 	var tok Token
 
 	l.skipWhitespace()
@@ -193,8 +243,20 @@ func (l *Lexer) NextToken() Token {
 		} else {
 			tok = newToken(ILLEGAL, l.ch, l.position, l.line, l.column)
 		}
+	case '+':
+		tok = newToken(PLUS, l.ch, l.position, l.line, l.column)
+	case '-':
+		tok = newToken(MINUS, l.ch, l.position, l.line, l.column)
+	case '%':
+		tok = newToken(PERCENT, l.ch, l.position, l.line, l.column)
+	case '*':
+		tok = newToken(ASTERISK, l.ch, l.position, l.line, l.column)
+	case '/':
+		tok = newToken(SLASH, l.ch, l.position, l.line, l.column)
 	case ',':
 		tok = newToken(COMMA, l.ch, l.position, l.line, l.column)
+	case ':':
+		tok = newToken(COLON, l.ch, l.position, l.line, l.column)
 	case ';':
 		tok = newToken(SEMICOLON, l.ch, l.position, l.line, l.column)
 	case '.':
@@ -220,6 +282,9 @@ func (l *Lexer) NextToken() Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = lookupIdent(tok.Literal)
+			if unit, ok := units[strings.ToLower(tok.Literal)]; ok && tok.Type == IDENT && (l.prev == INT || l.prev == FLOAT) {
+				tok.Type = unit
+			}
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type, tok.Literal = l.readNumber()
@@ -320,6 +385,26 @@ func (t TokenType) String() string {
 		return "WHEN"
 	case IF:
 		return "IF"
+	case LET:
+		return "LET"
+	case CONST:
+		return "CONST"
+	case IMPORT:
+		return "IMPORT"
+	case DURING:
+		return "DURING"
+	case WITHIN:
+		return "WITHIN"
+	case RULE:
+		return "RULE"
+	case TRUE:
+		return "TRUE"
+	case FALSE:
+		return "FALSE"
+	case MATCHES:
+		return "matches"
+	case CONTAINS:
+		return "contains"
 	case ASSIGN:
 		return "="
 	case EQ:
@@ -340,8 +425,18 @@ func (t TokenType) String() string {
 		return "||"
 	case NOT:
 		return "!"
+	case PLUS:
+		return "+"
+	case MINUS:
+		return "-"
+	case ASTERISK:
+		return "*"
+	case SLASH:
+		return "/"
 	case COMMA:
 		return ","
+	case COLON:
+		return ":"
 	case SEMICOLON:
 		return ";"
 	case DOT:
@@ -364,6 +459,12 @@ func (t TokenType) String() string {
 		return "s"
 	case M:
 		return "m"
+	case H:
+		return "h"
+	case D:
+		return "d"
+	case PERCENT:
+		return "%"
 	default:
 		return "UNKNOWN"
 	}
@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"fmt"
 	"strconv"
 )
 
@@ -25,8 +24,14 @@ var precedences = map[TokenType]int{
 	GT:     LESSGREATER,
 	LTE:    LESSGREATER,
 	GTE:    LESSGREATER,
+	MATCHES:  EQUALS,
+	CONTAINS: EQUALS,
 	AND:    LOGICAL,
 	OR:     LOGICAL,
+	PLUS:     SUM,
+	MINUS:    SUM,
+	ASTERISK: PRODUCT,
+	SLASH:    PRODUCT,
 	LPAREN: CALL,
 	DOT:    DOTPREC,
 }
@@ -44,7 +49,7 @@ type Parser struct {
 	curToken  Token
 	peekToken Token
 
-	errors []string
+	errors []*ParseError
 
 	prefixParseFns map[TokenType]prefixParseFn
 	infixParseFns  map[TokenType]infixParseFn
@@ -55,7 +60,7 @@ type Parser struct {
 func New(l *Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*ParseError{},
 	}
 
 	p.prefixParseFns = make(map[TokenType]prefixParseFn)
@@ -63,8 +68,14 @@ func New(l *Lexer) *Parser {
 	p.registerPrefix(INT, p.parseIntegerLiteral)
 	p.registerPrefix(FLOAT, p.parseFloatLiteral)
 	p.registerPrefix(STRING, p.parseStringLiteral)
+	p.registerPrefix(TRUE, p.parseBoolean)
+	p.registerPrefix(FALSE, p.parseBoolean)
 	p.registerPrefix(NOT, p.parsePrefixExpression)
+	p.registerPrefix(MINUS, p.parsePrefixExpression)
 	p.registerPrefix(LPAREN, p.parseGroupedExpression)
+	// matches and contains are also built-in function names
+	p.registerPrefix(MATCHES, p.parseIdentifier)
+	p.registerPrefix(CONTAINS, p.parseIdentifier)
 
 	p.infixParseFns = make(map[TokenType]infixParseFn)
 	p.registerInfix(EQ, p.parseInfixExpression)
@@ -73,8 +84,14 @@ func New(l *Lexer) *Parser {
 	p.registerInfix(GT, p.parseInfixExpression)
 	p.registerInfix(LTE, p.parseInfixExpression)
 	p.registerInfix(GTE, p.parseInfixExpression)
+	p.registerInfix(MATCHES, p.parseInfixExpression)
+	p.registerInfix(CONTAINS, p.parseInfixExpression)
 	p.registerInfix(AND, p.parseInfixExpression)
 	p.registerInfix(OR, p.parseInfixExpression)
+	p.registerInfix(PLUS, p.parseInfixExpression)
+	p.registerInfix(MINUS, p.parseInfixExpression)
+	p.registerInfix(ASTERISK, p.parseInfixExpression)
+	p.registerInfix(SLASH, p.parseInfixExpression)
 	p.registerInfix(LPAREN, p.parseCallExpression)
 	p.registerInfix(DOT, p.parseDotExpression)
 
@@ -95,7 +112,15 @@ func (p *Parser) ParseProgram() *Program {
 	program.Statements = []Statement{}
 
 	for !p.curTokenIs(EOF) {
-		stmt := p.parseStatement()
+		var stmt Statement
+		switch p.curToken.Type {
+		case CONST:
+			stmt = p.parseConstStatement()
+		case IMPORT:
+			stmt = p.parseImportStatement()
+		default:
+			stmt = p.parseStatement()
+		}
 		if stmt != nil {
 			program.Statements = append(program.Statements, stmt)
 		}
@@ -109,6 +134,19 @@ func (p *Parser) parseStatement() Statement {
 	switch p.curToken.Type {
 	case WHEN:
 		return p.parseWhenStatement()
+	case LET:
+		return p.parseLetStatement()
+	case RULE:
+		return p.parseRuleStatement()
+	case CONST:
+		// Constants are file-wide; ParseProgram handles the top-level ones
+		p.addError(p.curToken, "", "const declarations must be at the top level of a file")
+		p.parseConstStatement()
+		return nil
+	case IMPORT:
+		p.addError(p.curToken, "", "import statements must be at the top level of a file")
+		p.parseImportStatement()
+		return nil
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -123,11 +161,39 @@ func (p *Parser) parseWhenStatement() *WhenStatement {
 	// Parse the condition expression
 	stmt.Condition = p.parseExpression(LOWEST)
 
+	// Optional event look-back window: within 10m
+	if p.peekTokenIs(WITHIN) {
+		p.nextToken()
+		if !p.expectPeek(INT) {
+			return nil
+		}
+		within, ok := p.parseIntegerLiteral().(*UnitExpression)
+		if !ok || !p.isTimeUnitToken(within.Token.Type) {
+			p.addError(p.curToken, "", "within expects a duration such as 30s or 10m")
+			return nil
+		}
+		if within.Value.(*IntegerLiteral).Value <= 0 {
+			p.addError(p.curToken, "", "within must be a positive duration")
+			return nil
+		}
+		stmt.Within = within
+	}
+
+	// Optional time-of-day gate: during "02:00-06:00"
+	if p.peekTokenIs(DURING) {
+		p.nextToken()
+		if !p.expectPeek(STRING) {
+			return nil
+		}
+		stmt.During = &StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
 	if !p.expectPeek(LBRACE) {
 		return nil
 	}
 
 	stmt.Body = p.parseBlockStatement()
+	stmt.End = p.curToken
 
 	return stmt
 }
@@ -146,9 +212,230 @@ func (p *Parser) parseBlockStatement() *BlockStatement {
 		p.nextToken()
 	}
 
+	if p.curTokenIs(EOF) {
+		p.addError(p.curToken, RBRACE.String(), "expected %s to close the block opened at line %d, column %d",
+			RBRACE, block.Token.Line, block.Token.Column)
+	}
+
 	return block
 }
 
+// parseRuleStatement parses a named rule block. Metadata entries (description,
+// severity, tags, labels, every, group, cooldown) may appear anywhere among the rule's
+// statements.
+func (p *Parser) parseRuleStatement() Statement {
+	stmt := &RuleStatement{Token: p.curToken}
+
+	if !p.expectPeek(STRING) {
+		return nil
+	}
+	stmt.Name = &StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(LBRACE) {
+		return nil
+	}
+	stmt.Body = &BlockStatement{Token: p.curToken, Statements: []Statement{}}
+
+	p.nextToken()
+	for !p.curTokenIs(RBRACE) && !p.curTokenIs(EOF) {
+		switch {
+		case p.curTokenIs(IDENT) && p.peekTokenIs(COLON):
+			if !p.parseRuleMetadata(stmt) {
+				return nil
+			}
+		case p.curTokenIs(RULE):
+			p.addError(p.curToken, "", "rule blocks cannot be nested")
+			return nil
+		default:
+			if s := p.parseStatement(); s != nil {
+				stmt.Body.Statements = append(stmt.Body.Statements, s)
+			}
+		}
+		p.nextToken()
+	}
+
+	if p.curTokenIs(EOF) {
+		p.addError(p.curToken, RBRACE.String(), "expected %s to close rule %q opened at line %d, column %d",
+			RBRACE, stmt.Name.Value, stmt.Token.Line, stmt.Token.Column)
+		return nil
+	}
+	stmt.End = p.curToken
+
+	return stmt
+}
+
+// parseRuleMetadata parses one "key: value" entry of a rule block. The
+// current token is the key.
+func (p *Parser) parseRuleMetadata(stmt *RuleStatement) bool {
+	key := p.curToken
+	p.nextToken() // the colon
+
+	switch key.Literal {
+	case "description":
+		if !p.expectPeek(STRING) {
+			return false
+		}
+		stmt.Description = p.curToken.Literal
+	case "severity":
+		// Severity may be a bare word, as in alert(msg, severity: high)
+		if !p.peekTokenIs(IDENT) && !p.peekTokenIs(STRING) {
+			p.peekError(IDENT)
+			return false
+		}
+		p.nextToken()
+		stmt.Severity = p.curToken.Literal
+	case "tags":
+		if !p.expectPeek(STRING) {
+			return false
+		}
+		stmt.Tags = append(stmt.Tags, p.curToken.Literal)
+		for p.peekTokenIs(COMMA) {
+			p.nextToken()
+			if !p.expectPeek(STRING) {
+				return false
+			}
+			stmt.Tags = append(stmt.Tags, p.curToken.Literal)
+		}
+	case "labels":
+		if stmt.Labels == nil {
+			stmt.Labels = make(map[string]string)
+		}
+		if !p.parseRuleLabel(stmt) {
+			return false
+		}
+		for p.peekTokenIs(COMMA) {
+			p.nextToken()
+			if !p.parseRuleLabel(stmt) {
+				return false
+			}
+		}
+	case "every":
+		every := p.parseMetadataDuration(key.Literal)
+		if every == nil {
+			return false
+		}
+		stmt.Every = every
+	case "group":
+		if !p.expectPeek(STRING) {
+			return false
+		}
+		stmt.Group = p.curToken.Literal
+	case "cooldown":
+		cooldown := p.parseMetadataDuration(key.Literal)
+		if cooldown == nil {
+			return false
+		}
+		stmt.Cooldown = cooldown
+	default:
+		p.addError(key, "", "unknown rule metadata %q (expected description, severity, tags, labels, every, group or cooldown)", key.Literal)
+		return false
+	}
+
+	if p.peekTokenIs(SEMICOLON) {
+		p.nextToken()
+	}
+	return true
+}
+
+// parseRuleLabel parses one name = "value" pair of a labels entry. The
+// current token precedes the name.
+func (p *Parser) parseRuleLabel(stmt *RuleStatement) bool {
+	if !p.expectPeek(IDENT) {
+		return false
+	}
+	name := p.curToken
+	if !p.expectPeek(ASSIGN) || !p.expectPeek(STRING) {
+		return false
+	}
+	if _, exists := stmt.Labels[name.Literal]; exists {
+		p.addError(name, "", "duplicate label %q", name.Literal)
+		return false
+	}
+	stmt.Labels[name.Literal] = p.curToken.Literal
+	return true
+}
+
+// parseMetadataDuration parses the value of a rule metadata entry that takes
+// a positive duration such as 30s or 5m. The current token is the colon.
+func (p *Parser) parseMetadataDuration(key string) *UnitExpression {
+	if !p.expectPeek(INT) {
+		return nil
+	}
+	value := p.parseIntegerLiteral()
+	duration, ok := value.(*UnitExpression)
+	if !ok || !p.isTimeUnitToken(duration.Token.Type) {
+		p.addError(p.curToken, "", "%s expects a duration such as 30s or 5m", key)
+		return nil
+	}
+	if duration.Value.(*IntegerLiteral).Value <= 0 {
+		p.addError(p.curToken, "", "%s must be a positive duration", key)
+		return nil
+	}
+	return duration
+}
+
+// parseLetStatement parses a binding such as: let ratio = heap.inuse / heap.sys
+func (p *Parser) parseLetStatement() Statement {
+	stmt := &LetStatement{Token: p.curToken}
+
+	if !p.expectPeek(IDENT) {
+		return nil
+	}
+	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseConstStatement parses a constant declaration such as: const HIGH_MEM = 800MB
+func (p *Parser) parseConstStatement() Statement {
+	stmt := &ConstStatement{Token: p.curToken}
+
+	if !p.expectPeek(IDENT) {
+		return nil
+	}
+	stmt.Name = &Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseImportStatement parses an import such as: import "common/thresholds.dscr"
+func (p *Parser) parseImportStatement() Statement {
+	stmt := &ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(STRING) {
+		return nil
+	}
+	stmt.Path = &StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ExpressionStatement {
 	stmt := &ExpressionStatement{Token: p.curToken}
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -191,8 +478,7 @@ func (p *Parser) parseIntegerLiteral() Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, "", "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 
@@ -216,8 +502,7 @@ func (p *Parser) parseFloatLiteral() Expression {
 
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.curToken, "", "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 
@@ -240,6 +525,10 @@ func (p *Parser) parseStringLiteral() Expression {
 	return &StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+func (p *Parser) parseBoolean() Expression {
+	return &Boolean{Token: p.curToken, Value: p.curTokenIs(TRUE)}
+}
+
 func (p *Parser) parsePrefixExpression() Expression {
 	expression := &PrefixExpression{
 		Token:    p.curToken,
@@ -294,9 +583,51 @@ func (p *Parser) parseDotExpression(left Expression) Expression {
 	p.nextToken()
 	expression.Right = p.parseExpression(DOTPREC)
 
+	if p.peekTokenIs(LBRACE) && p.labelSelectorFollows() {
+		p.nextToken()
+		return p.parseLabelSelector(expression)
+	}
+
 	return expression
 }
 
+// labelSelectorFollows reports whether the next '{' opens a label selector,
+// as in custom.queue_depth{queue="email"}, rather than the body of a when
+// statement. A selector starts with a label name and '=', which no
+// statement does.
+func (p *Parser) labelSelectorFollows() bool {
+	l := *p.l
+	return l.NextToken().Type == IDENT && l.NextToken().Type == ASSIGN
+}
+
+// parseLabelSelector parses the name = "value" pairs selecting series of
+// metric. The current token is the '{'.
+func (p *Parser) parseLabelSelector(metric Expression) Expression {
+	selector := &LabelSelector{Token: p.curToken, Metric: metric, Labels: make(map[string]string)}
+	for {
+		if !p.expectPeek(IDENT) {
+			return nil
+		}
+		name := p.curToken
+		if !p.expectPeek(ASSIGN) || !p.expectPeek(STRING) {
+			return nil
+		}
+		if _, exists := selector.Labels[name.Literal]; exists {
+			p.addError(name, "", "duplicate label %q", name.Literal)
+			return nil
+		}
+		selector.Labels[name.Literal] = p.curToken.Literal
+		if !p.peekTokenIs(COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(RBRACE) {
+		return nil
+	}
+	return selector
+}
+
 func (p *Parser) parseExpressionList(end TokenType) []Expression {
 	var args []Expression
 
@@ -306,12 +637,12 @@ func (p *Parser) parseExpressionList(end TokenType) []Expression {
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	args = append(args, p.parseArgument())
 
 	for p.peekTokenIs(COMMA) {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		args = append(args, p.parseArgument())
 	}
 
 	if !p.expectPeek(end) {
@@ -321,6 +652,20 @@ func (p *Parser) parseExpressionList(end TokenType) []Expression {
 	return args
 }
 
+// parseArgument parses a call argument, which is either an expression or a
+// named argument such as severity: high
+func (p *Parser) parseArgument() Expression {
+	if !p.curTokenIs(IDENT) || !p.peekTokenIs(COLON) {
+		return p.parseExpression(LOWEST)
+	}
+
+	arg := &NamedArgument{Token: p.curToken, Name: p.curToken.Literal}
+	p.nextToken()
+	p.nextToken()
+	arg.Value = p.parseExpression(LOWEST)
+	return arg
+}
+
 func (p *Parser) curTokenIs(t TokenType) bool {
 	return p.curToken.Type == t
 }
@@ -339,19 +684,18 @@ func (p *Parser) expectPeek(t TokenType) bool {
 	}
 }
 
-func (p *Parser) Errors() []string {
+// Errors returns the syntax errors found while parsing, with their positions
+func (p *Parser) Errors() []*ParseError {
 	return p.errors
 }
 
 func (p *Parser) peekError(t TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
+	p.addError(p.peekToken, t.String(), "expected next token to be %s, got %s instead",
 		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
 }
 
 func (p *Parser) noPrefixParseFnError(t TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addError(p.curToken, "", "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -379,5 +723,9 @@ func (p *Parser) registerInfix(tokenType TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) isUnitToken(t TokenType) bool {
-	return t == MB || t == GB || t == MS || t == S || t == M
+	return t == MB || t == GB || t == PERCENT || p.isTimeUnitToken(t)
+}
+
+func (p *Parser) isTimeUnitToken(t TokenType) bool {
+	return t == MS || t == S || t == M || t == H || t == D
 }
\ No newline at end of file
@@ -0,0 +1,255 @@
+package descry
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults for ProfileConfig
+const (
+	DefaultProfilePrefix      = "descry/profiles"
+	DefaultMaxProfiles        = 10
+	DefaultProfileMinInterval = time.Minute
+)
+
+// profileTypes are the runtime/pprof profiles capture_profile() can take
+var profileTypes = map[string]bool{
+	"heap":         true,
+	"allocs":       true,
+	"goroutine":    true,
+	"block":        true,
+	"mutex":        true,
+	"threadcreate": true,
+}
+
+// profileTypeNames lists the profile types for error messages
+func profileTypeNames() string {
+	names := make([]string, 0, len(profileTypes))
+	for name := range profileTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// ProfileConfig configures the pprof profiles rules capture with
+// capture_profile(). Profiles are always kept in memory for the dashboard;
+// Store writes them to durable storage as well.
+type ProfileConfig struct {
+	// Store also receives each profile, such as an S3 bucket. Nil keeps
+	// profiles in memory only.
+	Store SnapshotStore
+	// Prefix is prepended to every key in Store. Defaults to DefaultProfilePrefix.
+	Prefix string
+	// MaxProfiles is the number of profiles kept in memory, dropping the
+	// oldest. Defaults to DefaultMaxProfiles.
+	MaxProfiles int
+	// MinInterval is the shortest time between captures of one profile type
+	// by one rule, so a rule that keeps firing does not profile on every
+	// evaluation. Defaults to DefaultProfileMinInterval.
+	MinInterval time.Duration
+}
+
+// withDefaults returns the configuration with unset fields defaulted
+func (c ProfileConfig) withDefaults() ProfileConfig {
+	if c.Prefix == "" {
+		c.Prefix = DefaultProfilePrefix
+	}
+	if c.MaxProfiles <= 0 {
+		c.MaxProfiles = DefaultMaxProfiles
+	}
+	if c.MinInterval <= 0 {
+		c.MinInterval = DefaultProfileMinInterval
+	}
+	return c
+}
+
+// Profile describes a pprof profile captured when a rule fired. Its data,
+// in the gzipped protobuf format read by go tool pprof, is returned by
+// GetProfile.
+type Profile struct {
+	ID        string    `json:"id"`
+	Rule      string    `json:"rule"`
+	Type      string    `json:"type"`
+	Timestamp time.Time `json:"timestamp"`
+	Size      int       `json:"size"`
+	// Key is where the profile is written in ProfileConfig.Store, empty
+	// when no store is configured
+	Key string `json:"key,omitempty"`
+}
+
+// Filename is a name for the profile's data when it is saved to disk
+func (p Profile) Filename() string {
+	return fmt.Sprintf("%s-%s-%s.pb.gz", url.PathEscape(p.Rule), p.Type, p.Timestamp.UTC().Format("20060102T150405Z"))
+}
+
+// profileStore keeps the latest captured profiles
+type profileStore struct {
+	mutex    sync.Mutex
+	config   ProfileConfig
+	profiles []Profile // oldest first
+	data     map[string][]byte
+	// last is when each rule last captured each profile type
+	last map[string]time.Time
+}
+
+func newProfileStore() *profileStore {
+	return &profileStore{
+		config: ProfileConfig{}.withDefaults(),
+		data:   make(map[string][]byte),
+		last:   make(map[string]time.Time),
+	}
+}
+
+// SetProfileConfig configures where capture_profile() writes profiles, how
+// many are kept in memory and how often each rule may capture. Profiles
+// already captured are kept, up to the new MaxProfiles.
+func (e *Engine) SetProfileConfig(config ProfileConfig) {
+	s := e.profiles
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.config = config.withDefaults()
+	s.evictLocked()
+}
+
+// GetProfiles returns the profiles kept in memory, newest first
+func (e *Engine) GetProfiles() []Profile {
+	s := e.profiles
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	profiles := make([]Profile, len(s.profiles))
+	for i, profile := range s.profiles {
+		profiles[len(profiles)-1-i] = profile
+	}
+	return profiles
+}
+
+// GetProfile returns a profile kept in memory and its data
+func (e *Engine) GetProfile(id string) (Profile, []byte, bool) {
+	s := e.profiles
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, profile := range s.profiles {
+		if profile.ID == id {
+			return profile, s.data[id], true
+		}
+	}
+	return Profile{}, nil, false
+}
+
+// evictLocked drops the oldest profiles beyond MaxProfiles. Callers hold
+// s.mutex.
+func (s *profileStore) evictLocked() {
+	excess := len(s.profiles) - s.config.MaxProfiles
+	if excess <= 0 {
+		return
+	}
+	for _, profile := range s.profiles[:excess] {
+		delete(s.data, profile.ID)
+	}
+	s.profiles = append(s.profiles[:0], s.profiles[excess:]...)
+}
+
+// captureProfile takes a profile of profileType for ruleName, keeps it in
+// memory, writes it to the configured store in the background and records
+// a "profile" event. It returns false without capturing if the rule took
+// the same profile less than MinInterval ago.
+func (e *Engine) captureProfile(ruleName, profileType string) (bool, error) {
+	profiler := pprof.Lookup(profileType)
+	if !profileTypes[profileType] || profiler == nil {
+		return false, fmt.Errorf("unknown profile type %q (expected %s)", profileType, profileTypeNames())
+	}
+
+	s := e.profiles
+	now := e.clock.Now()
+	limitKey := ruleName + "\x00" + profileType
+	s.mutex.Lock()
+	if last, ok := s.last[limitKey]; ok && now.Sub(last) < s.config.MinInterval {
+		s.mutex.Unlock()
+		return false, nil
+	}
+	s.last[limitKey] = now
+	config := s.config
+	s.mutex.Unlock()
+
+	var buf bytes.Buffer
+	if err := profiler.WriteTo(&buf, 0); err != nil {
+		return false, fmt.Errorf("failed to write %s profile: %w", profileType, err)
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	profile := Profile{
+		ID:        fmt.Sprintf("profile-%x", id),
+		Rule:      ruleName,
+		Type:      profileType,
+		Timestamp: now,
+		Size:      buf.Len(),
+	}
+	encryption := e.storageEncryption()
+	if config.Store != nil {
+		profile.Key = profileKey(config.Prefix, profile)
+		if encryption != nil {
+			profile.Key += encryptedSuffix
+		}
+	}
+
+	data := buf.Bytes()
+	s.mutex.Lock()
+	s.profiles = append(s.profiles, profile)
+	s.data[profile.ID] = data
+	s.evictLocked()
+	s.mutex.Unlock()
+
+	if config.Store != nil {
+		e.goBackground(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), snapshotUploadTimeout)
+			defer cancel()
+			if err := e.uploadProfile(ctx, config.Store, encryption, profile.Key, data); err != nil {
+				e.log().Error("Profile upload failed", slog.String("component", "profile"),
+					slog.String("rule", ruleName), slog.Any("error", err))
+			}
+		})
+	}
+
+	message := fmt.Sprintf("Captured %s profile", profileType)
+	eventData := map[string]interface{}{"id": profile.ID, "type": profileType, "size": profile.Size}
+	if profile.Key != "" {
+		eventData["key"] = profile.Key
+	}
+	e.RecordEvent("profile", ruleName, message, eventData)
+	e.sendEventUpdate("profile", message, ruleName, eventData)
+	return true, nil
+}
+
+// uploadProfile writes a profile to store under key, encrypted with
+// encryption unless it is nil
+func (e *Engine) uploadProfile(ctx context.Context, store SnapshotStore, encryption *EncryptionConfig, key string, data []byte) error {
+	if encryption != nil {
+		var err error
+		if data, err = encryption.Encrypt(data); err != nil {
+			return fmt.Errorf("failed to encrypt profile: %w", err)
+		}
+	}
+	if err := store.Put(ctx, key, data, "application/octet-stream"); err != nil {
+		return fmt.Errorf("failed to upload profile: %w", err)
+	}
+	return nil
+}
+
+// profileKey returns the key for a profile, e.g.
+// descry/profiles/2025/01/31/120000Z-heap-memory.pb.gz
+func profileKey(prefix string, profile Profile) string {
+	t := profile.Timestamp.UTC()
+	return path.Join(prefix, t.Format("2006/01/02"),
+		fmt.Sprintf("%s-%s-%s.pb.gz", t.Format("150405Z"), profile.Type, url.PathEscape(profile.Rule)))
+}
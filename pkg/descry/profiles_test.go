@@ -0,0 +1,62 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/clock"
+)
+
+func TestCaptureProfile(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0), Clock: fake})
+	if err := engine.AddRule("bad_profile", `when heap.alloc > 0 { capture_profile("cpu") }`); err == nil {
+		t.Error("expected an unknown profile type to be rejected")
+	}
+	if err := engine.AddRule("memory", `when heap.alloc > 0 { capture_profile("heap") capture_profile("goroutine") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	store := newMemorySnapshotStore()
+	engine.SetProfileConfig(ProfileConfig{Store: store, MaxProfiles: 3})
+
+	// A rule that keeps firing captures each profile once per MinInterval
+	engine.EvaluateRules()
+	engine.EvaluateRules()
+	profiles := engine.GetProfiles()
+	if len(profiles) != 2 {
+		t.Fatalf("expected a heap and a goroutine profile, got %+v", profiles)
+	}
+	if profiles[0].Type != "goroutine" || profiles[1].Type != "heap" || profiles[1].Rule != "memory" {
+		t.Errorf("expected profiles newest first, got %+v", profiles)
+	}
+	profile, data, ok := engine.GetProfile(profiles[1].ID)
+	if !ok || len(data) != profile.Size || len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		t.Errorf("expected gzipped profile data of the recorded size, got %d bytes for %+v", len(data), profile)
+	}
+	if profile.Filename() != "memory-heap-20260501T120000Z.pb.gz" {
+		t.Errorf("unexpected filename %s", profile.Filename())
+	}
+
+	engine.background.Wait()
+	if _, ok := store.objects[profile.Key]; !ok || profile.Key != "descry/profiles/2026/05/01/120000Z-heap-memory.pb.gz" {
+		t.Errorf("expected the profile written to the store under %s, got %v", profile.Key, len(store.objects))
+	}
+	events := engine.QueryEvents(EventQuery{Types: []string{"profile"}})
+	if len(events) != 2 || events[0].RuleName != "memory" || !strings.Contains(events[0].Message, "goroutine") {
+		t.Errorf("expected a profile event per capture, got %+v", events)
+	}
+
+	// Later captures drop the oldest beyond MaxProfiles
+	fake.Advance(DefaultProfileMinInterval)
+	engine.EvaluateRules()
+	profiles = engine.GetProfiles()
+	if len(profiles) != 3 || profiles[2].Type != "goroutine" || !profiles[0].Timestamp.After(profiles[2].Timestamp) {
+		t.Errorf("expected the three latest profiles, got %+v", profiles)
+	}
+	if _, _, ok := engine.GetProfile(profile.ID); ok {
+		t.Error("expected the oldest profile to be dropped")
+	}
+}
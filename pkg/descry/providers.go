@@ -0,0 +1,235 @@
+package descry
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// MetricProvider supplies metrics from outside the Go runtime, such as
+// database pool stats, Kafka consumer lag or cgroup limits. A provider
+// registered with Engine.RegisterMetricProvider is available in rules under
+// its own namespace: a provider named "db" returning "pool.in_use" is read as
+// db.pool.in_use.
+type MetricProvider interface {
+	// Name is the provider's namespace in rules. It must be an identifier and
+	// may not shadow a built-in namespace such as heap or custom.
+	Name() string
+	// Collect returns the current value of every metric the provider offers.
+	// It is called once per evaluation cycle and should return quickly.
+	Collect() map[string]float64
+}
+
+// MetricHistoryProvider is a MetricProvider that keeps its own history, for
+// example by querying an external store. avg(), max(), trend() and anomaly()
+// read its History instead of the samples the engine records from Collect.
+type MetricHistoryProvider interface {
+	MetricProvider
+	// History returns the samples of metric within duration, oldest first
+	History(metric string, duration time.Duration) []MetricSample
+}
+
+// MetricSample is a metric value observed at a point in time
+type MetricSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// providerNamePattern matches names usable as the first identifier of a metric path
+var providerNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// builtinNamespaces are the metric categories the evaluator resolves itself
+var builtinNamespaces = map[string]bool{
+	"heap": true, "goroutines": true, "gc": true, "http": true,
+	"uptime": true, "alerts": true, "custom": true, "leak": true,
+	"sched": true,
+}
+
+// metricProviderState is a registered provider with its latest values and
+// the history the engine records for it
+type metricProviderState struct {
+	provider MetricProvider
+	values   map[string]float64
+	history  map[string][]customMetricSample
+	// collected is when Collect last succeeded; err is the failure of the
+	// last collection, if it failed
+	collected time.Time
+	err       error
+}
+
+// RegisterMetricProvider makes a provider's metrics available to rules under
+// its name. The provider is collected immediately and then at the start of
+// every evaluation cycle; each collection is recorded in a history of the
+// same depth as custom metrics unless the provider implements
+// MetricHistoryProvider.
+func (e *Engine) RegisterMetricProvider(provider MetricProvider) error {
+	if provider == nil {
+		return fmt.Errorf("metric provider is nil")
+	}
+	name := provider.Name()
+	if !providerNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid metric provider name %q: must be an identifier", name)
+	}
+	if builtinNamespaces[name] {
+		return fmt.Errorf("metric provider name %q is a built-in namespace", name)
+	}
+
+	state := &metricProviderState{
+		provider: provider,
+		values:   make(map[string]float64),
+		history:  make(map[string][]customMetricSample),
+	}
+	e.providerMutex.Lock()
+	if _, exists := e.providers[name]; exists {
+		e.providerMutex.Unlock()
+		return fmt.Errorf("metric provider %q is already registered", name)
+	}
+	e.providers[name] = state
+	e.providerMutex.Unlock()
+
+	e.collectProvider(state, e.clock.Now())
+	return nil
+}
+
+// UnregisterMetricProvider removes a provider and the history recorded for
+// it. Rules that read its metrics fail to evaluate until it is registered again.
+func (e *Engine) UnregisterMetricProvider(name string) error {
+	e.providerMutex.Lock()
+	defer e.providerMutex.Unlock()
+	if _, exists := e.providers[name]; !exists {
+		return fmt.Errorf("metric provider %q is not registered", name)
+	}
+	delete(e.providers, name)
+	return nil
+}
+
+// MetricProviders returns the names of the registered providers, sorted
+func (e *Engine) MetricProviders() []string {
+	e.providerMutex.RLock()
+	defer e.providerMutex.RUnlock()
+	names := make([]string, 0, len(e.providers))
+	for name := range e.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// collectProviders collects every registered provider once
+func (e *Engine) collectProviders() {
+	e.providerMutex.RLock()
+	states := make([]*metricProviderState, 0, len(e.providers))
+	for _, state := range e.providers {
+		states = append(states, state)
+	}
+	e.providerMutex.RUnlock()
+
+	now := e.clock.Now()
+	for _, state := range states {
+		e.collectProvider(state, now)
+	}
+}
+
+// collectProvider records a provider's current values. A provider that
+// panics keeps the values of its last successful collection.
+func (e *Engine) collectProvider(state *metricProviderState, now time.Time) {
+	values, err := e.callCollect(state.provider)
+	if err != nil {
+		e.log().Warn("Metric provider collection failed",
+			slog.String("provider", state.provider.Name()),
+			slog.Any("error", err))
+		e.providerMutex.Lock()
+		state.err = err
+		e.providerMutex.Unlock()
+		return
+	}
+
+	e.providerMutex.Lock()
+	defer e.providerMutex.Unlock()
+	state.values = values
+	state.collected = now
+	state.err = nil
+	if _, ok := state.provider.(MetricHistoryProvider); ok {
+		return
+	}
+	for name, value := range values {
+		history := append(state.history[name], customMetricSample{Value: value, Timestamp: now})
+		if excess := len(history) - e.maxCustomHistory; excess > 0 {
+			copy(history, history[excess:])
+			history = history[:e.maxCustomHistory]
+		}
+		state.history[name] = history
+	}
+}
+
+// callCollect calls Collect, copying the result so the provider may reuse
+// its map, and turns a panic into an error reported to the panic hook
+func (e *Engine) callCollect(provider MetricProvider) (values map[string]float64, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.recovered("provider "+provider.Name(), r)
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	collected := provider.Collect()
+	values = make(map[string]float64, len(collected))
+	for name, value := range collected {
+		values[name] = value
+	}
+	return values, nil
+}
+
+// providerMetric returns the latest value of a provider's metric. registered
+// reports whether namespace names a provider at all.
+func (e *Engine) providerMetric(namespace, metric string) (value float64, found, registered bool) {
+	e.providerMutex.RLock()
+	defer e.providerMutex.RUnlock()
+	state, registered := e.providers[namespace]
+	if !registered {
+		return 0, false, false
+	}
+	value, found = state.values[metric]
+	return value, found, true
+}
+
+// providerHistory returns the samples of a provider's metric within
+// duration, oldest first, from the provider itself if it keeps a history
+func (e *Engine) providerHistory(namespace, metric string, duration time.Duration) ([]MetricSample, bool) {
+	e.providerMutex.RLock()
+	state, registered := e.providers[namespace]
+	if !registered {
+		e.providerMutex.RUnlock()
+		return nil, false
+	}
+	if historyProvider, ok := state.provider.(MetricHistoryProvider); ok {
+		e.providerMutex.RUnlock()
+		return historyProvider.History(metric, duration), true
+	}
+	defer e.providerMutex.RUnlock()
+
+	cutoff := e.clock.Now().Add(-duration)
+	var result []MetricSample
+	for _, sample := range state.history[metric] {
+		if sample.Timestamp.After(cutoff) {
+			result = append(result, MetricSample{Timestamp: sample.Timestamp, Value: sample.Value})
+		}
+	}
+	return result, true
+}
+
+// providerSnapshot returns every provider's latest values keyed by their
+// path in rules, e.g. "db.pool.in_use"
+func (e *Engine) providerSnapshot() map[string]float64 {
+	e.providerMutex.RLock()
+	defer e.providerMutex.RUnlock()
+	snapshot := make(map[string]float64)
+	for namespace, state := range e.providers {
+		for name, value := range state.values {
+			snapshot[namespace+"."+name] = value
+		}
+	}
+	return snapshot
+}
@@ -0,0 +1,298 @@
+package descry
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"expvar"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/metrics"
+	"github.com/chosenoffset/descry/pkg/descry/metrics/expvarbridge"
+)
+
+type poolProvider struct {
+	name  string
+	inUse float64
+}
+
+func (p *poolProvider) Name() string { return p.name }
+
+func (p *poolProvider) Collect() map[string]float64 {
+	if p.inUse < 0 {
+		panic("pool closed")
+	}
+	return map[string]float64{"pool.in_use": p.inUse, "pool.max": 10}
+}
+
+type lagProvider struct{ poolProvider }
+
+func (lagProvider) History(metric string, duration time.Duration) []MetricSample {
+	now := time.Now()
+	return []MetricSample{{Timestamp: now.Add(-2 * time.Second), Value: 100}, {Timestamp: now.Add(-time.Second), Value: 300}}
+}
+
+func TestMetricProviders(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	pool := &poolProvider{name: "db", inUse: 4}
+	if err := engine.RegisterMetricProvider(pool); err != nil {
+		t.Fatalf("failed to register provider: %v", err)
+	}
+	for _, provider := range []MetricProvider{&poolProvider{name: "db"}, &poolProvider{name: "heap"}, &poolProvider{name: "db.pool"}, nil} {
+		if err := engine.RegisterMetricProvider(provider); err == nil {
+			t.Errorf("expected an error registering %+v", provider)
+		}
+	}
+
+	source := `rule "pool" {
+  when db.pool.in_use >= db.pool.max * 0.8 && avg("db.pool.in_use", 60s) > 7 { log("pool nearly exhausted") }
+}`
+	if _, err := engine.AddRules("pool", source); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The sample taken at registration keeps the average below 7
+	pool.inUse = 9
+	engine.EvaluateRules()
+	if !lastTrigger(engine, "pool").IsZero() {
+		t.Fatal("expected the average to hold the rule back")
+	}
+	engine.EvaluateRules()
+	if lastTrigger(engine, "pool").IsZero() {
+		t.Fatal("expected the rule to trigger on the provider's metrics")
+	}
+	if value, ok := engine.SnapshotMetrics()["db.pool.in_use"]; !ok || value != 9 {
+		t.Errorf("expected provider metrics in the snapshot, got %v", value)
+	}
+
+	// A panicking provider keeps its last values
+	pool.inUse = -1
+	engine.EvaluateRules()
+	if value, _, _ := engine.providerMetric("db", "pool.in_use"); value != 9 {
+		t.Errorf("expected the last collected value, got %v", value)
+	}
+
+	// Providers with their own history serve window functions
+	lag := &lagProvider{poolProvider{name: "kafka", inUse: 1}}
+	if err := engine.RegisterMetricProvider(lag); err != nil {
+		t.Fatal(err)
+	}
+	evaluator := NewEvaluator(engine)
+	if result := evaluator.calculateMetricAverage("kafka.pool.in_use", time.Minute); result.(*Float).Value != 200 {
+		t.Errorf("expected the provider's history, got %v", result.Inspect())
+	}
+	if names := engine.MetricProviders(); strings.Join(names, ",") != "db,kafka" {
+		t.Errorf("unexpected providers: %v", names)
+	}
+
+	if err := engine.UnregisterMetricProvider("db"); err != nil {
+		t.Fatal(err)
+	}
+	if result := evaluator.getMetricValue("db", "pool.in_use"); !isError(result) {
+		t.Errorf("expected an unregistered provider's metrics to be unknown, got %v", result.Inspect())
+	}
+	if err := engine.UnregisterMetricProvider("db"); err == nil {
+		t.Error("expected an error unregistering an unknown provider")
+	}
+}
+
+// fakeDriver opens connections that support nothing but being pooled
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+func TestSQLCollector(t *testing.T) {
+	sql.Register("descry_fake", fakeDriver{})
+	db, err := sql.Open("descry_fake", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(4)
+
+	// Hold three of the pool's four connections
+	for i := 0; i < 3; i++ {
+		conn, err := db.Conn(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+	}
+
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.RegisterMetricProvider(metrics.NewSQLCollector("db", db)); err != nil {
+		t.Fatalf("failed to register collector: %v", err)
+	}
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		{"db.open_conns", 3},
+		{"db.in_use", 3},
+		{"db.max_open_conns", 4},
+		{"db.utilization", 75},
+		{"db.wait_count", 0},
+	}
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if got := engine.evaluator.objectToFloat(result); isError(result) || got != tt.expected {
+			t.Errorf("%q: expected %v, got %s", tt.source, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestContentionCollector(t *testing.T) {
+	collector := metrics.NewContentionCollector(1, 1)
+	defer collector.Close()
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.RegisterMetricProvider(collector); err != nil {
+		t.Fatalf("failed to register collector: %v", err)
+	}
+
+	// Block on a channel until another goroutine sends
+	ch := make(chan struct{})
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		ch <- struct{}{}
+	}()
+	<-ch
+	engine.EvaluateRules()
+
+	for _, source := range []string{"contention.block_events > 0", "contention.block_rate > 0", "contention.mutex_wait >= 0"} {
+		if result := evalSource(t, engine, source); result != TRUE {
+			t.Errorf("%q: expected true, got %s", source, result.Inspect())
+		}
+	}
+}
+
+func TestProcessCollector(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.RegisterMetricProvider(metrics.NewProcessCollector()); err != nil {
+		t.Fatalf("failed to register collector: %v", err)
+	}
+	sources := []string{"process.num_threads > 0"}
+	if runtime.GOOS == "linux" {
+		sources = append(sources, "process.rss > 1MB", "process.open_fds > 0 && process.open_fds < process.max_fds",
+			"process.cpu_percent >= 0")
+	}
+	for _, source := range sources {
+		if result := evalSource(t, engine, source); result != TRUE {
+			t.Errorf("%q: expected true, got %s", source, result.Inspect())
+		}
+	}
+}
+
+func TestExpvarCollector(t *testing.T) {
+	expvar.NewInt("descry_test_orders").Set(42)
+	expvar.NewFloat("descry-test-load").Set(0.75)
+	requests := expvar.NewMap("descry_test_http")
+	requests.Add("requests", 10)
+	requests.Add("2xx", 9)
+	requests.Set("path", new(expvar.String))
+	expvar.Publish("descry_test_status", expvar.Func(func() interface{} {
+		return map[string]interface{}{"healthy": true, "queue": 3, "version": "1.2"}
+	}))
+
+	values := expvarbridge.NewCollector().Collect()
+	expected := map[string]float64{
+		"descry_test_orders":         42,
+		"descry_test_load":           0.75,
+		"descry_test_http.requests":  10,
+		"descry_test_http._2xx":      9,
+		"descry_test_status.healthy": 1,
+		"descry_test_status.queue":   3,
+	}
+	for name, want := range expected {
+		if got, ok := values[name]; !ok || got != want {
+			t.Errorf("expected %s = %v, got %v (%t)", name, want, got, ok)
+		}
+	}
+	for _, name := range []string{"descry_test_http.path", "descry_test_status.version", "cmdline"} {
+		if _, ok := values[name]; ok {
+			t.Errorf("expected non-numeric variable %s to be left out", name)
+		}
+	}
+	for name := range values {
+		if strings.HasPrefix(name, "memstats") {
+			t.Errorf("expected memstats to be left out, got %s", name)
+		}
+	}
+
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.RegisterMetricProvider(expvarbridge.NewCollector()); err != nil {
+		t.Fatalf("failed to register collector: %v", err)
+	}
+	if result := evalSource(t, engine, "expvar.descry_test_http.requests == 10 && expvar.descry_test_orders > 40"); result != TRUE {
+		t.Errorf("expected expvar metrics in rules, got %s", result.Inspect())
+	}
+}
+
+func TestContainerCollector(t *testing.T) {
+	write := func(path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v2 := t.TempDir()
+	write(filepath.Join(v2, "cgroup.controllers"), "cpu memory\n")
+	write(filepath.Join(v2, "memory.current"), "402653184\n")
+	write(filepath.Join(v2, "memory.max"), "536870912\n")
+	write(filepath.Join(v2, "cpu.max"), "150000 100000\n")
+	write(filepath.Join(v2, "cpu.stat"), "usage_usec 9000\nnr_periods 40\nnr_throttled 12\nthrottled_usec 250000\n")
+
+	v1 := t.TempDir()
+	write(filepath.Join(v1, "memory", "memory.usage_in_bytes"), "104857600\n")
+	write(filepath.Join(v1, "memory", "memory.limit_in_bytes"), "9223372036854771712\n")
+	write(filepath.Join(v1, "cpu", "cpu.cfs_quota_us"), "-1\n")
+	write(filepath.Join(v1, "cpu", "cpu.cfs_period_us"), "100000\n")
+	write(filepath.Join(v1, "cpu", "cpu.stat"), "nr_periods 10\nnr_throttled 3\nthrottled_time 5000000\n")
+
+	tests := []struct {
+		root     string
+		expected map[string]float64
+	}{
+		{v2, map[string]float64{"memory_limit": 536870912, "memory_usage": 402653184, "memory_usage_ratio": 0.75,
+			"cpu_limit": 1.5, "cpu_throttled_periods": 12, "cpu_throttled_time": 250}},
+		{v1, map[string]float64{"memory_limit": 0, "memory_usage": 104857600, "memory_usage_ratio": 0,
+			"cpu_limit": 0, "cpu_throttled_periods": 3, "cpu_throttled_time": 5}},
+		{t.TempDir(), map[string]float64{}},
+	}
+	for _, tt := range tests {
+		values := metrics.NewContainerCollectorAt(tt.root).Collect()
+		if len(values) != len(tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.root, tt.expected, values)
+			continue
+		}
+		for name, want := range tt.expected {
+			if values[name] != want {
+				t.Errorf("%s: expected %s = %v, got %v", tt.root, name, want, values[name])
+			}
+		}
+	}
+
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.RegisterMetricProvider(metrics.NewContainerCollectorAt(v2)); err != nil {
+		t.Fatalf("failed to register collector: %v", err)
+	}
+	if result := evalSource(t, engine, "container.memory_usage_ratio > 0.7 && container.memory_limit == 512MB"); result != TRUE {
+		t.Errorf("expected container metrics in rules, got %s", result.Inspect())
+	}
+}
@@ -0,0 +1,183 @@
+package descry
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+// DefaultRedactionReplacement replaces redacted text unless
+// RedactionConfig.Replacement is set
+const DefaultRedactionReplacement = "[REDACTED]"
+
+// RedactionConfig removes sensitive data, such as email addresses a rule
+// interpolated into an alert, from events before they leave the engine. It
+// applies to event messages and metadata as they are recorded in the event
+// history, streamed to the dashboard and delivered to action handlers, and to
+// custom metric names shown on the dashboard and written to report snapshots.
+type RedactionConfig struct {
+	// Patterns are regular expressions whose matches are replaced in
+	// messages, string metadata values and metric names
+	Patterns []string
+	// Fields are metadata keys, such as "email" or "user_id", whose values
+	// are replaced entirely. They are matched case-insensitively at any
+	// depth of the metadata.
+	Fields []string
+	// Replacement replaces redacted text. Defaults to
+	// DefaultRedactionReplacement.
+	Replacement string
+	// Hook is applied to every message, string value and metric name after
+	// Patterns, for redaction regular expressions cannot express. Text may
+	// pass through it more than once, so it should leave redacted text alone.
+	Hook func(string) string
+}
+
+// redactor is a compiled RedactionConfig. A nil redactor changes nothing.
+type redactor struct {
+	patterns    []*regexp.Regexp
+	fields      map[string]bool
+	replacement string
+	hook        func(string) string
+}
+
+// SetRedaction installs a redaction pipeline, or removes it when config is
+// nil. Events recorded before the call are not rewritten.
+func (e *Engine) SetRedaction(config *RedactionConfig) error {
+	if config == nil {
+		e.redaction.Store(nil)
+		e.actionRegistry.SetRedactor(nil)
+		return nil
+	}
+
+	r := &redactor{
+		fields:      make(map[string]bool, len(config.Fields)),
+		replacement: config.Replacement,
+		hook:        config.Hook,
+	}
+	if r.replacement == "" {
+		r.replacement = DefaultRedactionReplacement
+	}
+	for _, pattern := range config.Patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, compiled)
+	}
+	for _, field := range config.Fields {
+		if field == "" {
+			return fmt.Errorf("redaction field name cannot be empty")
+		}
+		r.fields[strings.ToLower(field)] = true
+	}
+
+	e.redaction.Store(r)
+	e.actionRegistry.SetRedactor(r.action)
+	return nil
+}
+
+// redactor returns the installed redaction pipeline, nil if there is none
+func (e *Engine) redactor() *redactor {
+	return e.redaction.Load()
+}
+
+// text redacts a message or metric name
+func (r *redactor) text(s string) string {
+	if r == nil {
+		return s
+	}
+	for _, pattern := range r.patterns {
+		s = pattern.ReplaceAllLiteralString(s, r.replacement)
+	}
+	if r.hook != nil {
+		s = r.hook(s)
+	}
+	return s
+}
+
+// data returns a redacted copy of event metadata
+func (r *redactor) data(data map[string]interface{}) map[string]interface{} {
+	if r == nil || data == nil {
+		return data
+	}
+	redacted := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		redacted[key] = r.field(key, value)
+	}
+	return redacted
+}
+
+// field redacts the metadata value stored under key
+func (r *redactor) field(key string, value interface{}) interface{} {
+	if r.fields[strings.ToLower(key)] {
+		return r.replacement
+	}
+	return r.value(value)
+}
+
+// value redacts strings in a metadata value, descending into maps and
+// slices. Other values are returned unchanged.
+func (r *redactor) value(value interface{}) interface{} {
+	if r == nil {
+		return value
+	}
+	switch v := value.(type) {
+	case string:
+		return r.text(v)
+	case map[string]interface{}:
+		return r.data(v)
+	case map[string]string:
+		redacted := make(map[string]string, len(v))
+		for key, s := range v {
+			if r.fields[strings.ToLower(key)] {
+				redacted[key] = r.replacement
+			} else {
+				redacted[key] = r.text(s)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, element := range v {
+			redacted[i] = r.value(element)
+		}
+		return redacted
+	case []string:
+		redacted := make([]string, len(v))
+		for i, s := range v {
+			redacted[i] = r.text(s)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// action redacts the message, metric name and details of an action before
+// it reaches observers and handlers
+func (r *redactor) action(action actions.Action) actions.Action {
+	action.Message = r.text(action.Message)
+	action.Metric = r.text(action.Metric)
+	action.Details = r.data(action.Details)
+	return action
+}
+
+// metricNames returns metrics with redacted names
+func (r *redactor) metricNames(values map[string]float64) map[string]float64 {
+	if r == nil {
+		return values
+	}
+	redacted := make(map[string]float64, len(values))
+	for name, value := range values {
+		redacted[r.text(name)] = value
+	}
+	return redacted
+}
+
+// sendEventUpdate streams an event to the dashboard after redacting it
+func (e *Engine) sendEventUpdate(eventType, message, rule string, data interface{}) {
+	r := e.redactor()
+	e.dashboard.SendEventUpdate(eventType, r.text(message), rule, r.value(data))
+}
@@ -0,0 +1,69 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+func TestRedaction(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	handler := &capturingHandler{}
+	engine.actionRegistry.RegisterHandler(actions.AlertAction, handler)
+
+	if err := engine.SetRedaction(&RedactionConfig{Patterns: []string{"("}}); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+	err := engine.SetRedaction(&RedactionConfig{
+		Patterns: []string{`[a-z.]+@[a-z.]+`},
+		Fields:   []string{"user_id"},
+		Hook:     func(s string) string { return strings.ReplaceAll(s, "4111", "****") },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := engine.AddRule("signup", `when custom.signups > 0 { alert("signup from jane@example.com, card 4111") }`); err != nil {
+		t.Fatal(err)
+	}
+	engine.UpdateCustomMetric("signups", 1)
+	engine.EvaluateRules()
+	if len(handler.actions) != 1 {
+		t.Fatalf("expected one alert, got %d", len(handler.actions))
+	}
+	if message := handler.actions[0].Message; message != "signup from [REDACTED], card ****" {
+		t.Errorf("expected the alert to be redacted before the handler, got %q", message)
+	}
+	if alerts := engine.GetEventHistory(1, "alert"); len(alerts) != 1 || strings.Contains(alerts[0].Message, "jane") {
+		t.Errorf("expected the recorded alert to be redacted, got %+v", alerts)
+	}
+
+	engine.EmitEvent("order_failed", "order for bob@example.com failed", map[string]interface{}{
+		"User_ID": 42,
+		"order":   map[string]interface{}{"contact": "bob@example.com", "total": 10.5},
+	})
+	event := engine.GetEventHistory(1, "order_failed")[0]
+	if event.Message != "order for [REDACTED] failed" || event.Data["User_ID"] != "[REDACTED]" {
+		t.Errorf("expected the event message and user_id field to be redacted, got %+v", event)
+	}
+	if order := event.Data["order"].(map[string]interface{}); order["contact"] != "[REDACTED]" || order["total"] != 10.5 {
+		t.Errorf("expected nested metadata to be redacted, got %+v", order)
+	}
+
+	engine.UpdateCustomMetric("logins_by_amy@example.com", 3)
+	snapshot := engine.buildSnapshot(engine.clock.Now(), DefaultSnapshotInterval)
+	if _, exists := snapshot.Custom["logins_by_[REDACTED]"]; !exists {
+		t.Errorf("expected custom metric names to be redacted in report snapshots, got %v", snapshot.Custom)
+	}
+
+	if err := engine.SetRedaction(nil); err != nil {
+		t.Fatal(err)
+	}
+	engine.EmitEvent("note", "carol@example.com", nil)
+	if event := engine.GetEventHistory(1, "note")[0]; event.Message != "carol@example.com" {
+		t.Errorf("expected redaction to be removed, got %q", event.Message)
+	}
+}
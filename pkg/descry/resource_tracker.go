@@ -2,8 +2,10 @@ package descry
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"runtime"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -14,6 +16,38 @@ type ResourceTracker struct {
 	cpuTracker    *CPUTracker
 	ctx           context.Context
 	cancel        context.CancelFunc
+	
+	// The first limit violation found, which cancelled the context
+	violationMutex sync.Mutex
+	violation      error
+}
+
+// resourceSample is one reading of the process's heap allocation and CPU
+// time, shared by the trackers checked against it
+type resourceSample struct {
+	alloc uint64
+	cpu   time.Duration
+	cpuOK bool // false if CPU time could not be read
+}
+
+// sampleResources reads the process's heap allocation and CPU time
+func sampleResources() resourceSample {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	cpu, ok := processCPUTime()
+	return resourceSample{alloc: m.Alloc, cpu: cpu, cpuOK: ok}
+}
+
+// processCPUTime returns the user and system CPU time used by the process
+func processCPUTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Sec)*time.Second + 
+		time.Duration(usage.Utime.Usec)*time.Microsecond +
+		time.Duration(usage.Stime.Sec)*time.Second + 
+		time.Duration(usage.Stime.Usec)*time.Microsecond, true
 }
 
 // MemoryTracker monitors memory usage with absolute budget limits
@@ -34,36 +68,35 @@ type CPUTracker struct {
 
 // NewResourceTracker creates a new resource tracker with the specified limits
 func NewResourceTracker(ctx context.Context, memoryLimit uint64, cpuLimit time.Duration) *ResourceTracker {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return newResourceTrackerFrom(ctx, memoryLimit, cpuLimit, m.Alloc)
+}
+
+// newResourceTrackerFrom creates a resource tracker whose memory budget
+// starts at initialAlloc, so trackers created together can share one heap
+// reading. CPU time is measured from now.
+func newResourceTrackerFrom(ctx context.Context, memoryLimit uint64, cpuLimit time.Duration, initialAlloc uint64) *ResourceTracker {
 	// Create child context with cancellation
 	childCtx, cancel := context.WithCancel(ctx)
 	
-	tracker := &ResourceTracker{
+	return &ResourceTracker{
 		ctx:    childCtx,
 		cancel: cancel,
+		memoryTracker: &MemoryTracker{
+			initialMemory: initialAlloc,
+			maxMemory:     initialAlloc + memoryLimit,
+			budget:        memoryLimit,
+			checkInterval: 10 * time.Millisecond,
+		},
+		cpuTracker: newCPUTracker(cpuLimit),
 	}
-	
-	// Initialize memory tracker
-	var m runtime.MemStats
-	runtime.ReadMemStats(&m)
-	
-	tracker.memoryTracker = &MemoryTracker{
-		initialMemory: m.Alloc,
-		maxMemory:     m.Alloc + memoryLimit,
-		budget:        memoryLimit,
-		checkInterval: 10 * time.Millisecond,
-	}
-	
-	// Initialize CPU tracker
-	tracker.cpuTracker = newCPUTracker(cpuLimit)
-	
-	return tracker
 }
 
 // newCPUTracker creates a CPU tracker that measures actual CPU time
 func newCPUTracker(maxCPUTime time.Duration) *CPUTracker {
-	var usage syscall.Rusage
-	err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
-	if err != nil {
+	startCPU, ok := processCPUTime()
+	if !ok {
 		// Fallback to wall-clock time if syscall fails
 		return &CPUTracker{
 			startTime:   time.Now(),
@@ -73,12 +106,6 @@ func newCPUTracker(maxCPUTime time.Duration) *CPUTracker {
 		}
 	}
 	
-	// Calculate current CPU time (user + system)
-	startCPU := time.Duration(usage.Utime.Sec)*time.Second + 
-	           time.Duration(usage.Utime.Usec)*time.Microsecond +
-	           time.Duration(usage.Stime.Sec)*time.Second + 
-	           time.Duration(usage.Stime.Usec)*time.Microsecond
-	
 	return &CPUTracker{
 		startTime:   time.Now(),
 		startCPU:    startCPU,
@@ -91,14 +118,18 @@ func newCPUTracker(maxCPUTime time.Duration) *CPUTracker {
 func (mt *MemoryTracker) CheckMemoryLimit() error {
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
-	
+	return mt.checkAlloc(m.Alloc)
+}
+
+// checkAlloc verifies that a heap allocation reading is within limits
+func (mt *MemoryTracker) checkAlloc(alloc uint64) error {
 	// Check absolute memory limit
-	if m.Alloc > mt.maxMemory {
+	if alloc > mt.maxMemory {
 		return &ResourceLimitError{
 			Resource: "memory",
-			Current:  m.Alloc,
+			Current:  alloc,
 			Limit:    mt.maxMemory,
-			Message:  fmt.Sprintf("memory limit exceeded: current=%d bytes, limit=%d bytes", m.Alloc, mt.maxMemory),
+			Message:  fmt.Sprintf("memory limit exceeded: current=%d bytes, limit=%d bytes", alloc, mt.maxMemory),
 		}
 	}
 	
@@ -107,9 +138,14 @@ func (mt *MemoryTracker) CheckMemoryLimit() error {
 
 // CheckCPULimit verifies that CPU usage is within limits
 func (ct *CPUTracker) CheckCPULimit() error {
-	var usage syscall.Rusage
-	err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
-	if err != nil {
+	currentCPU, ok := processCPUTime()
+	return ct.checkCPU(currentCPU, ok)
+}
+
+// checkCPU verifies that a process CPU time reading is within limits. When
+// the reading is unavailable, wall-clock time is checked instead.
+func (ct *CPUTracker) checkCPU(currentCPU time.Duration, ok bool) error {
+	if !ok {
 		// Fallback to wall-clock time measurement
 		wallTime := time.Since(ct.startTime)
 		if wallTime > ct.maxCPUTime {
@@ -123,12 +159,6 @@ func (ct *CPUTracker) CheckCPULimit() error {
 		return nil
 	}
 	
-	// Calculate current CPU time
-	currentCPU := time.Duration(usage.Utime.Sec)*time.Second + 
-	             time.Duration(usage.Utime.Usec)*time.Microsecond +
-	             time.Duration(usage.Stime.Sec)*time.Second + 
-	             time.Duration(usage.Stime.Usec)*time.Microsecond
-	
 	cpuUsed := currentCPU - ct.startCPU
 	if cpuUsed > ct.maxCPUTime {
 		return &ResourceLimitError{
@@ -171,6 +201,31 @@ func (rt *ResourceTracker) CheckLimits() error {
 	return nil
 }
 
+// checkSample verifies a shared resource reading against the tracker's
+// limits. The first violation is kept and cancels the context.
+func (rt *ResourceTracker) checkSample(sample resourceSample) error {
+	err := rt.memoryTracker.checkAlloc(sample.alloc)
+	if err == nil {
+		err = rt.cpuTracker.checkCPU(sample.cpu, sample.cpuOK)
+	}
+	if err != nil {
+		rt.violationMutex.Lock()
+		if rt.violation == nil {
+			rt.violation = err
+		}
+		rt.violationMutex.Unlock()
+		rt.cancel()
+	}
+	return err
+}
+
+// limitViolation returns the violation found by checkSample, if any
+func (rt *ResourceTracker) limitViolation() error {
+	rt.violationMutex.Lock()
+	defer rt.violationMutex.Unlock()
+	return rt.violation
+}
+
 // Cancel cancels the resource tracker context
 func (rt *ResourceTracker) Cancel() {
 	rt.cancel()
@@ -198,15 +253,8 @@ func (rt *ResourceTracker) GetMemoryStats() MemoryStats {
 func (rt *ResourceTracker) GetCPUStats() CPUStats {
 	wallTime := time.Since(rt.cpuTracker.startTime)
 	
-	var usage syscall.Rusage
 	var cpuTime time.Duration
-	
-	err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
-	if err == nil {
-		currentCPU := time.Duration(usage.Utime.Sec)*time.Second + 
-		             time.Duration(usage.Utime.Usec)*time.Microsecond +
-		             time.Duration(usage.Stime.Sec)*time.Second + 
-		             time.Duration(usage.Stime.Usec)*time.Microsecond
+	if currentCPU, ok := processCPUTime(); ok {
 		cpuTime = currentCPU - rt.cpuTracker.startCPU
 	} else {
 		cpuTime = wallTime // Fallback
@@ -232,10 +280,15 @@ func (e *ResourceLimitError) Error() string {
 	return e.Message
 }
 
-// IsResourceLimitError checks if an error is a resource limit violation
+// Is reports whether target is ErrLimitExceeded
+func (e *ResourceLimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// IsResourceLimitError checks if an error is, or wraps, a resource limit violation
 func IsResourceLimitError(err error) bool {
-	_, ok := err.(*ResourceLimitError)
-	return ok
+	var limitErr *ResourceLimitError
+	return errors.As(err, &limitErr)
 }
 
 // MemoryStats provides memory usage statistics
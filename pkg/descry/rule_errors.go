@@ -0,0 +1,107 @@
+package descry
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// RuleErrorKind classifies a RuleError
+type RuleErrorKind string
+
+const (
+	// RuleErrorParse reports a watched rule file that could not be read or
+	// compiled; the rules previously loaded from it are kept
+	RuleErrorParse RuleErrorKind = "parse"
+	// RuleErrorEvaluation reports a rule whose evaluation failed, e.g. on a
+	// division by zero or an unknown metric
+	RuleErrorEvaluation RuleErrorKind = "evaluation"
+	// RuleErrorTimeout reports an evaluation that exceeded MaxEvaluationTime
+	RuleErrorTimeout RuleErrorKind = "timeout"
+	// RuleErrorResourceLimit reports an evaluation stopped for exceeding its
+	// memory or CPU budget
+	RuleErrorResourceLimit RuleErrorKind = "resource_limit"
+	// RuleErrorAction reports an action of a triggered rule that failed; the
+	// rule still counts as triggered
+	RuleErrorAction RuleErrorKind = "action"
+)
+
+// maxRecentErrors is the number of failures GetRecentErrors keeps
+const maxRecentErrors = 20
+
+// RuleError describes a failure the engine hit while loading or evaluating a
+// rule in the background, where there is no caller to return an error to
+type RuleError struct {
+	// Rule is the rule's name, or for RuleErrorParse the watched file's
+	// default rule name
+	Rule string
+	Kind RuleErrorKind
+	// File is the rule file that failed to load, for RuleErrorParse
+	File string
+	Err  error
+	Time time.Time
+}
+
+func (e RuleError) Error() string {
+	return fmt.Sprintf("rule %s: %s error: %v", e.Rule, e.Kind, e.Err)
+}
+
+func (e RuleError) Unwrap() error {
+	return e.Err
+}
+
+// OnError registers a callback for rule failures: watched rule files that fail
+// to load, evaluation errors, timeouts, resource limit violations and failed
+// actions. The failures are still logged. Callbacks run synchronously on the
+// goroutine that hit the failure, usually the evaluation loop, so they should
+// return quickly; hand slow work to another goroutine.
+//
+// Example:
+//
+//	engine.OnError(func(err descry.RuleError) {
+//		ruleFailures.WithLabelValues(err.Rule, string(err.Kind)).Inc()
+//	})
+func (e *Engine) OnError(handler func(RuleError)) {
+	e.errorMutex.Lock()
+	defer e.errorMutex.Unlock()
+	e.errorHandlers = append(e.errorHandlers, handler)
+}
+
+// GetRecentErrors returns the latest rule failures, newest first, whether or
+// not OnError callbacks are registered. At most 20 are kept.
+func (e *Engine) GetRecentErrors() []RuleError {
+	e.errorMutex.RLock()
+	defer e.errorMutex.RUnlock()
+	recent := make([]RuleError, len(e.recentErrors))
+	for i, ruleErr := range e.recentErrors {
+		recent[len(recent)-1-i] = ruleErr
+	}
+	return recent
+}
+
+// reportError records a failure and passes it to the OnError callbacks. A
+// panicking callback is logged rather than allowed to stop rule evaluation.
+func (e *Engine) reportError(ruleErr RuleError) {
+	if ruleErr.Time.IsZero() {
+		ruleErr.Time = e.clock.Now()
+	}
+
+	e.errorMutex.Lock()
+	e.recentErrors = append(e.recentErrors, ruleErr)
+	if excess := len(e.recentErrors) - maxRecentErrors; excess > 0 {
+		e.recentErrors = append(e.recentErrors[:0], e.recentErrors[excess:]...)
+	}
+	handlers := e.errorHandlers
+	e.errorMutex.Unlock()
+
+	for _, handler := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					e.log().Error("Panic in rule error callback", slog.String("rule", ruleErr.Rule), slog.Any("panic", r))
+				}
+			}()
+			handler(ruleErr)
+		}()
+	}
+}
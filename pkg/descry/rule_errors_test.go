@@ -0,0 +1,107 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+func TestOnError(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.AddRule("broken", `when heap.alloc / 0 > 1 { log("never") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	if err := engine.AddRule("healthy", `when heap.alloc < 0 { log("never") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+
+	var reported []RuleError
+	engine.OnError(func(err RuleError) { panic("callbacks must not stop evaluation") })
+	engine.OnError(func(err RuleError) { reported = append(reported, err) })
+
+	engine.EvaluateRules()
+
+	if len(reported) != 1 {
+		t.Fatalf("expected one error, got %+v", reported)
+	}
+	ruleErr := reported[0]
+	if ruleErr.Rule != "broken" || ruleErr.Kind != RuleErrorEvaluation || ruleErr.Err == nil || ruleErr.Time.IsZero() {
+		t.Errorf("unexpected error: %+v", ruleErr)
+	}
+	if !strings.Contains(ruleErr.Error(), "rule broken: evaluation error") {
+		t.Errorf("unexpected message: %s", ruleErr.Error())
+	}
+
+	// A watched file that fails to compile is reported with its path
+	path := filepath.Join(t.TempDir(), "memory.dscr")
+	if err := os.WriteFile(path, []byte(`when heap.alloc > { log("x") }`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	engine.applyRuleFile(path)
+	if len(reported) != 2 || reported[1].Kind != RuleErrorParse || reported[1].Rule != "memory" || reported[1].File != path {
+		t.Errorf("expected a parse error for the watched file, got %+v", reported[1:])
+	}
+}
+
+func TestLimitEvents(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.AddRule("slow", `when heap.alloc > 0 { log("never") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	var reported []RuleError
+	engine.OnError(func(err RuleError) { reported = append(reported, err) })
+
+	limits := engine.GetResourceLimits()
+	limits.MaxEvaluationTime = time.Nanosecond
+	engine.SetResourceLimits(limits)
+	engine.EvaluateRules()
+
+	events := engine.QueryEvents(EventQuery{Types: []string{"limit"}})
+	if len(events) != 1 {
+		t.Fatalf("expected one limit event, got %+v", events)
+	}
+	event := events[0]
+	if event.RuleName != "slow" || event.Data["resource"] != "evaluation_time" || event.Data["limit"] != "1ns" {
+		t.Errorf("unexpected limit event: %+v", event)
+	}
+	if len(reported) != 1 || reported[0].Kind != RuleErrorTimeout {
+		t.Errorf("expected the timeout passed to OnError, got %+v", reported)
+	}
+
+	// Memory and CPU violations name the resource and its reading
+	engine.recordLimitEvent("slow", &ResourceLimitError{Resource: "memory", Current: 2048, Limit: 1024, Message: "memory limit exceeded"})
+	events = engine.QueryEvents(EventQuery{Types: []string{"limit"}})
+	if len(events) != 2 || events[0].Data["resource"] != "memory" || events[0].Data["limit"] != uint64(1024) {
+		t.Errorf("expected a memory limit event, got %+v", events)
+	}
+
+	// Handlers registered for limit actions receive them, and so do routes
+	handler := &capturingHandler{}
+	engine.actionRegistry.RegisterHandler(actions.LimitAction, handler)
+	engine.EvaluateRules()
+	if len(handler.actions) != 1 || handler.actions[0].RuleName != "slow" || handler.actions[0].Details["resource"] != "evaluation_time" {
+		t.Fatalf("expected the handler to receive the limit action, got %+v", handler.actions)
+	}
+	if events := engine.QueryEvents(EventQuery{Types: []string{"limit"}}); len(events) != 3 {
+		t.Errorf("expected each limit to be recorded once, got %d events", len(events))
+	}
+
+	pager := &capturingHandler{}
+	engine.RegisterActionHandler("pager", pager)
+	routing := &actions.RoutingConfig{Routes: []actions.Route{
+		{Match: actions.RouteMatch{Types: []actions.ActionType{actions.LimitAction}}, Handlers: []string{"pager"}},
+	}}
+	if err := engine.SetRoutingConfig(routing); err != nil {
+		t.Fatalf("failed to set routing: %v", err)
+	}
+	engine.EvaluateRules()
+	if len(pager.actions) != 1 || pager.actions[0].Type != actions.LimitAction || len(handler.actions) != 1 {
+		t.Errorf("expected the limit action routed to the pager only, got %+v", pager.actions)
+	}
+}
@@ -0,0 +1,185 @@
+package descry
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+// RuleGroup holds defaults shared by the rules that join it with group
+// metadata, such as group: "memory", so a large rule set can be organized and
+// managed a group at a time. A rule's own severity and cooldown take
+// precedence over its group's.
+type RuleGroup struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Severity is the default for alerts raised by the group's rules
+	Severity string `json:"severity,omitempty"`
+	// Cooldown is how long a rule in the group rests after triggering before
+	// it is evaluated again, marshalled as nanoseconds
+	Cooldown time.Duration `json:"cooldown,omitempty"`
+}
+
+// RuleGroupInfo describes a group and the rules in it
+type RuleGroupInfo struct {
+	RuleGroup
+	// Rules names the group's rules, in rule order
+	Rules []string `json:"rules"`
+	// Enabled counts the group's rules that are enabled
+	Enabled int `json:"enabled"`
+}
+
+// SetRuleGroup sets the defaults of a group, replacing any set before. Rules
+// may join a group before or after its defaults are set.
+func (e *Engine) SetRuleGroup(group RuleGroup) error {
+	group, err := normalizeRuleGroup(group)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	// Copy rather than modify in place; evaluations may hold the old map
+	updated := make(map[string]RuleGroup, len(e.groups)+1)
+	for name, existing := range e.groups {
+		updated[name] = existing
+	}
+	updated[group.Name] = group
+	e.groups = updated
+	return nil
+}
+
+// normalizeRuleGroup validates a group's defaults and lower-cases its
+// severity
+func normalizeRuleGroup(group RuleGroup) (RuleGroup, error) {
+	if group.Name == "" {
+		return group, fmt.Errorf("rule group name is required")
+	}
+	group.Severity = strings.ToLower(group.Severity)
+	if group.Severity != "" && !actions.IsValidSeverity(group.Severity) {
+		return group, fmt.Errorf("invalid severity %q for rule group %s", group.Severity, group.Name)
+	}
+	if group.Cooldown < 0 {
+		return group, fmt.Errorf("cooldown for rule group %s must not be negative", group.Name)
+	}
+	return group, nil
+}
+
+// GetRuleGroups returns every group that has defaults or rules, ordered by
+// name
+func (e *Engine) GetRuleGroups() []RuleGroupInfo {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	infos := make(map[string]*RuleGroupInfo)
+	info := func(name string) *RuleGroupInfo {
+		if infos[name] == nil {
+			group, ok := e.groups[name]
+			if !ok {
+				group = RuleGroup{Name: name}
+			}
+			infos[name] = &RuleGroupInfo{RuleGroup: group, Rules: []string{}}
+		}
+		return infos[name]
+	}
+	for name := range e.groups {
+		info(name)
+	}
+	for _, rule := range e.rules {
+		if rule.Group == "" {
+			continue
+		}
+		group := info(rule.Group)
+		group.Rules = append(group.Rules, rule.Name)
+		if rule.Enabled() {
+			group.Enabled++
+		}
+	}
+
+	result := make([]RuleGroupInfo, 0, len(infos))
+	for _, group := range infos {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// SetRuleGroupEnabled enables or disables every rule in a group
+func (e *Engine) SetRuleGroupEnabled(name string, enabled bool) error {
+	if name == "" {
+		return fmt.Errorf("rule group name is required")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	updated := make([]*Rule, len(e.rules))
+	found := false
+	for i, rule := range e.rules {
+		updated[i] = rule
+		if rule.Group == name {
+			changed := *rule
+			changed.Disabled = !enabled
+			updated[i] = &changed
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("rule group has no rules: %s", name)
+	}
+	e.rules = updated
+	return nil
+}
+
+// RemoveRuleGroup removes every rule in a group, with their availability
+// history and statistics, and the group's defaults
+func (e *Engine) RemoveRuleGroup(name string) error {
+	if name == "" {
+		return fmt.Errorf("rule group name is required")
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	_, defined := e.groups[name]
+	updated := make([]*Rule, 0, len(e.rules))
+	removed := false
+	for _, rule := range e.rules {
+		if rule.Group != name {
+			updated = append(updated, rule)
+			continue
+		}
+		e.availability.remove(rule.Name)
+		e.ruleStats.remove(rule.Name)
+		delete(e.slaRules, rule.Name)
+		removed = true
+	}
+	if !removed && !defined {
+		return fmt.Errorf("%w: %s", ErrRuleGroupNotFound, name)
+	}
+	e.rules = updated
+
+	if defined {
+		groups := make(map[string]RuleGroup, len(e.groups))
+		for group, existing := range e.groups {
+			if group != name {
+				groups[group] = existing
+			}
+		}
+		e.groups = groups
+	}
+	return nil
+}
+
+// ruleCooldown returns how long a rule rests after triggering: its own
+// cooldown or else its group's
+func ruleCooldown(rule *Rule, groups map[string]RuleGroup) time.Duration {
+	if rule.Cooldown > 0 {
+		return rule.Cooldown
+	}
+	return groups[rule.Group].Cooldown
+}
@@ -0,0 +1,98 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRuleGroups(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	source := `rule "heap" {
+  group: "memory"
+  when 1 > 0 { log("heap") }
+}
+rule "goroutines" {
+  group: "memory"
+  severity: critical
+  cooldown: 30s
+  when 1 > 0 { log("goroutines") }
+}
+rule "latency" {
+  when 1 > 0 { log("latency") }
+}`
+	if _, err := engine.AddRules("groups", source); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	goroutines, _ := engine.GetRule("goroutines")
+	if goroutines.Group != "memory" || goroutines.Cooldown != 30*time.Second {
+		t.Fatalf("unexpected group metadata: %+v", goroutines)
+	}
+
+	if err := engine.SetRuleGroup(RuleGroup{Name: "memory", Description: "Heap and goroutines", Severity: "High", Cooldown: time.Minute}); err != nil {
+		t.Fatalf("failed to set group: %v", err)
+	}
+	// A rule's own severity takes precedence over its group's
+	if engine.ruleSeverity("heap") != "high" || engine.ruleSeverity("goroutines") != "critical" || engine.ruleSeverity("latency") != "" {
+		t.Errorf("unexpected severities: %q %q %q",
+			engine.ruleSeverity("heap"), engine.ruleSeverity("goroutines"), engine.ruleSeverity("latency"))
+	}
+
+	groups := engine.GetRuleGroups()
+	if len(groups) != 1 || groups[0].Name != "memory" || groups[0].Description != "Heap and goroutines" ||
+		strings.Join(groups[0].Rules, ",") != "heap,goroutines" || groups[0].Enabled != 2 {
+		t.Fatalf("unexpected groups: %+v", groups)
+	}
+
+	// Grouped rules rest for their cooldown after triggering
+	engine.EvaluateRules()
+	heapTrigger, latencyTrigger := lastTrigger(engine, "heap"), lastTrigger(engine, "latency")
+	if heapTrigger.IsZero() || latencyTrigger.IsZero() {
+		t.Fatal("expected every rule to trigger on the first evaluation")
+	}
+	engine.EvaluateRules()
+	if !lastTrigger(engine, "heap").Equal(heapTrigger) {
+		t.Error("expected the group's cooldown to skip the rule")
+	}
+	if !lastTrigger(engine, "latency").After(latencyTrigger) {
+		t.Error("expected the ungrouped rule to run on every evaluation")
+	}
+
+	if err := engine.SetRuleGroupEnabled("memory", false); err != nil {
+		t.Fatalf("failed to disable group: %v", err)
+	}
+	if groups := engine.GetRuleGroups(); groups[0].Enabled != 0 {
+		t.Errorf("expected every rule in the group to be disabled, got %+v", groups[0])
+	}
+	if rule, _ := engine.GetRule("latency"); !rule.Enabled() {
+		t.Error("expected rules outside the group to stay enabled")
+	}
+	if err := engine.SetRuleGroupEnabled("business", true); err == nil {
+		t.Error("expected an error for a group without rules")
+	}
+
+	if err := engine.RemoveRuleGroup("memory"); err != nil {
+		t.Fatalf("failed to remove group: %v", err)
+	}
+	if rules := engine.GetRules(); len(rules) != 1 || rules[0].Name != "latency" {
+		t.Errorf("expected only the ungrouped rule to remain, got %d rules", len(rules))
+	}
+	if groups := engine.GetRuleGroups(); len(groups) != 0 {
+		t.Errorf("expected the group to be removed, got %+v", groups)
+	}
+
+	if err := engine.SetRuleGroup(RuleGroup{Name: "memory", Severity: "urgent"}); err == nil {
+		t.Error("expected an error for an invalid group severity")
+	}
+	for _, src := range []string{
+		`rule "a" { group: memory when 1 > 0 { log("x") } }`,
+		`rule "a" { cooldown: 0s when 1 > 0 { log("x") } }`,
+		`rule "a" { cooldown: 5MB when 1 > 0 { log("x") } }`,
+	} {
+		if _, err := engine.AddRules("invalid", src); err == nil {
+			t.Errorf("expected error for %s", src)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package descry
+
+import (
+	"embed"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/chosenoffset/descry/pkg/descry/parser"
+)
+
+// RulePackPrefix starts the name of every rule pack embedded in descry, as in
+// "descry/packs/go-runtime"
+const RulePackPrefix = "descry/packs/"
+
+//go:embed packs/*.dscr
+var rulePackFiles embed.FS
+
+// rulePackDefinition names the embedded files that make up a rule pack
+type rulePackDefinition struct {
+	name        string
+	description string
+	files       []string
+}
+
+var rulePackDefinitions = []rulePackDefinition{
+	{"go-runtime", "Memory leak, GC pressure and goroutine leak rules for any Go service",
+		[]string{"memory-leak", "gc-pressure", "goroutine-leak"}},
+	{"memory-leak", "Heap growth heuristics that flag likely memory leaks", []string{"memory-leak"}},
+	{"gc-pressure", "Garbage collector CPU use, frequency and pause time", []string{"gc-pressure"}},
+	{"goroutine-leak", "Steady goroutine growth and a goroutine limit", []string{"goroutine-leak"}},
+	{"http-slo", "Starter error rate and latency objectives for HTTPMiddleware metrics", []string{"http-slo"}},
+}
+
+// packConstantPattern matches a tunable constant declaration in a rule pack
+var packConstantPattern = regexp.MustCompile(`(?m)^const ([A-Za-z_][A-Za-z0-9_]*) = (.+)$`)
+
+// RulePack describes a rule pack embedded in descry
+type RulePack struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Rules       []string `json:"rules"`
+	// Constants are the thresholds the pack can be tuned with, and their
+	// default values
+	Constants map[string]string `json:"constants"`
+}
+
+// RulePackOptions tunes a rule pack as it is loaded
+type RulePackOptions struct {
+	// Constants overrides the values of the pack's constants, e.g.
+	// {"HEAP_LIMIT": "2GB"}. Values are DSL expressions.
+	Constants map[string]string
+}
+
+// RulePacks lists the rule packs embedded in descry
+func RulePacks() []RulePack {
+	packs := make([]RulePack, 0, len(rulePackDefinitions))
+	for _, definition := range rulePackDefinitions {
+		source, err := definition.source()
+		if err != nil {
+			continue
+		}
+		pack := RulePack{
+			Name:        RulePackPrefix + definition.name,
+			Description: definition.description,
+			Constants:   make(map[string]string),
+		}
+		for _, match := range packConstantPattern.FindAllStringSubmatch(source, -1) {
+			pack.Constants[match[1]] = match[2]
+		}
+		program := parser.New(parser.NewLexer(source)).ParseProgram()
+		for _, stmt := range program.Statements {
+			if rule, ok := stmt.(*parser.RuleStatement); ok {
+				pack.Rules = append(pack.Rules, rule.Name.Value)
+			}
+		}
+		packs = append(packs, pack)
+	}
+	return packs
+}
+
+// LoadRulePack adds the rules of an embedded rule pack, such as
+// "descry/packs/go-runtime", with their default thresholds. See
+// LoadRulePackWithOptions.
+func (e *Engine) LoadRulePack(name string) ([]string, error) {
+	return e.LoadRulePackWithOptions(name, RulePackOptions{})
+}
+
+// LoadRulePackWithOptions adds the rules of an embedded rule pack, with the
+// pack's constants overridden by options, and returns the names of the rules
+// added. Rules loaded from the same pack before are replaced, so calling it
+// again with new constants retunes the pack while keeping each rule's
+// enabled state. Pack rules belong to a group named after their pack, whose
+// severity and cooldown can be tuned with SetRuleGroup.
+func (e *Engine) LoadRulePackWithOptions(name string, options RulePackOptions) ([]string, error) {
+	definition, ok := findRulePack(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown rule pack: %s", name)
+	}
+	source, err := definition.source()
+	if err != nil {
+		return nil, err
+	}
+	source, err = applyPackConstants(definition.name, source, options.Constants)
+	if err != nil {
+		return nil, err
+	}
+
+	file := RulePackPrefix + definition.name
+	rules, err := e.compileRules(file, source, "")
+	if err != nil {
+		return nil, fmt.Errorf("rule pack %s: %w", definition.name, err)
+	}
+	for _, rule := range rules {
+		rule.File = file
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.replaceRulesLocked(func(rule *Rule) bool { return rule.File == file }, rules)
+}
+
+// findRulePack looks up a pack by its full name or by the part after
+// RulePackPrefix
+func findRulePack(name string) (rulePackDefinition, bool) {
+	name = strings.TrimPrefix(name, RulePackPrefix)
+	for _, definition := range rulePackDefinitions {
+		if definition.name == name {
+			return definition, true
+		}
+	}
+	return rulePackDefinition{}, false
+}
+
+// source joins the pack's files
+func (d rulePackDefinition) source() (string, error) {
+	var parts []string
+	for _, file := range d.files {
+		content, err := rulePackFiles.ReadFile("packs/" + file + ".dscr")
+		if err != nil {
+			return "", fmt.Errorf("rule pack %s: %w", d.name, err)
+		}
+		parts = append(parts, strings.TrimSpace(string(content)))
+	}
+	return strings.Join(parts, "\n\n") + "\n", nil
+}
+
+// applyPackConstants replaces the values of the pack's constants with
+// overrides. Each override must name a constant of the pack and be a valid
+// constant expression on its own.
+func applyPackConstants(pack, source string, overrides map[string]string) (string, error) {
+	if len(overrides) == 0 {
+		return source, nil
+	}
+
+	declared := make(map[string]bool)
+	for _, match := range packConstantPattern.FindAllStringSubmatch(source, -1) {
+		declared[match[1]] = true
+	}
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !declared[name] {
+			return "", fmt.Errorf("rule pack %s has no constant %s", pack, name)
+		}
+		declaration := fmt.Sprintf("const %s = %s", name, overrides[name])
+		p := parser.New(parser.NewLexer(declaration))
+		program := p.ParseProgram()
+		if len(p.Errors()) > 0 || len(program.Statements) != 1 {
+			return "", fmt.Errorf("invalid value for %s: %q", name, overrides[name])
+		}
+	}
+
+	return packConstantPattern.ReplaceAllStringFunc(source, func(line string) string {
+		name := packConstantPattern.FindStringSubmatch(line)[1]
+		if value, ok := overrides[name]; ok {
+			return fmt.Sprintf("const %s = %s", name, value)
+		}
+		return line
+	}), nil
+}
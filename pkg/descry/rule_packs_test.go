@@ -0,0 +1,71 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestRulePacks(t *testing.T) {
+	newEngine := func() *Engine {
+		return NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	}
+
+	// Every embedded pack compiles
+	packs := RulePacks()
+	if len(packs) != len(rulePackDefinitions) {
+		t.Fatalf("expected %d packs, got %d", len(rulePackDefinitions), len(packs))
+	}
+	for _, pack := range packs {
+		names, err := newEngine().LoadRulePack(pack.Name)
+		if err != nil {
+			t.Fatalf("failed to load %s: %v", pack.Name, err)
+		}
+		if len(names) == 0 || strings.Join(names, ",") != strings.Join(pack.Rules, ",") || len(pack.Constants) == 0 {
+			t.Errorf("unexpected pack %s: %+v, loaded %v", pack.Name, pack, names)
+		}
+	}
+
+	engine := newEngine()
+	runtime, err := engine.LoadRulePack("descry/packs/go-runtime")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.LoadRulePack("http-slo"); err != nil {
+		t.Fatalf("expected packs to load side by side: %v", err)
+	}
+	if rule, _ := engine.GetRule("goroutine-leak/limit"); rule.File != "descry/packs/go-runtime" || rule.Group != "goroutine-leak" {
+		t.Errorf("unexpected pack rule: %+v", rule)
+	}
+
+	// Reloading with new constants retunes the pack in place
+	engine.SetRuleEnabled("memory-leak/limit", false)
+	names, err := engine.LoadRulePackWithOptions("go-runtime", RulePackOptions{Constants: map[string]string{"GOROUTINE_LIMIT": "0"}})
+	if err != nil {
+		t.Fatalf("failed to retune pack: %v", err)
+	}
+	if len(names) != len(runtime) || len(engine.GetRules()) != len(runtime)+3 {
+		t.Errorf("expected the pack's rules to be replaced, got %d rules", len(engine.GetRules()))
+	}
+	if rule, _ := engine.GetRule("memory-leak/limit"); rule.Enabled() {
+		t.Error("expected a retuned rule to stay disabled")
+	}
+	engine.EvaluateRules()
+	if rule, _ := engine.GetRule("goroutine-leak/limit"); rule.LastTrigger.IsZero() {
+		t.Error("expected the tuned goroutine limit to trigger")
+	}
+
+	for _, options := range []RulePackOptions{
+		{Constants: map[string]string{"UNKNOWN": "1"}},
+		{Constants: map[string]string{"HEAP_LIMIT": "1 when 1 > 0 { log(\"x\") }"}},
+		{Constants: map[string]string{"HEAP_LIMIT": "heap.alloc"}},
+	} {
+		if _, err := newEngine().LoadRulePackWithOptions("memory-leak", options); err == nil {
+			t.Errorf("expected an error for %v", options.Constants)
+		}
+	}
+	if _, err := engine.LoadRulePack("descry/packs/unknown"); err == nil {
+		t.Error("expected an error for an unknown pack")
+	}
+}
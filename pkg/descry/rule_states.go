@@ -0,0 +1,215 @@
+package descry
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRuleStateRetention is how long rule state intervals are kept unless
+// RuleStateConfig.Retention is set
+const DefaultRuleStateRetention = 24 * time.Hour
+
+// DefaultMaxRuleStateIntervals is how many state intervals are kept per rule
+// unless RuleStateConfig.MaxIntervals is set
+const DefaultMaxRuleStateIntervals = 1000
+
+// RuleStateInterval is a run of consecutive evaluations of a rule with the
+// same result. End is the time of the last evaluation in the run, or the
+// time the result changed.
+type RuleStateInterval struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Firing bool      `json:"firing"`
+	// Evaluations counts the evaluations in the run
+	Evaluations int `json:"evaluations"`
+}
+
+// RuleStateHistory is when a rule's condition held, oldest interval first
+type RuleStateHistory struct {
+	Rule      string              `json:"rule"`
+	Intervals []RuleStateInterval `json:"intervals"`
+}
+
+// RuleStateConfig configures the history of rule evaluation results. Every
+// evaluation that completes, including those of dry-run rules, is recorded;
+// consecutive evaluations with the same result share one interval, so a
+// steady rule costs one entry however often it runs. Failed evaluations are
+// not recorded.
+type RuleStateConfig struct {
+	// Retention is how long intervals are kept after they end. Defaults to
+	// DefaultRuleStateRetention.
+	Retention time.Duration
+	// MaxIntervals caps the intervals kept per rule, dropping the oldest
+	// first, so a flapping rule cannot grow without bound. Defaults to
+	// DefaultMaxRuleStateIntervals.
+	MaxIntervals int
+}
+
+// ruleStateTracker records rule evaluation results as state intervals
+type ruleStateTracker struct {
+	mutex  sync.RWMutex
+	config *RuleStateConfig // nil disables recording
+	rules  map[string][]RuleStateInterval
+}
+
+func newRuleStateTracker() *ruleStateTracker {
+	return &ruleStateTracker{
+		config: &RuleStateConfig{Retention: DefaultRuleStateRetention, MaxIntervals: DefaultMaxRuleStateIntervals},
+		rules:  make(map[string][]RuleStateInterval),
+	}
+}
+
+// SetRuleStateHistory configures the history of rule evaluation results,
+// which is kept with the defaults of RuleStateConfig unless changed, or stops
+// recording it and forgets it when config is nil. The history backs the
+// firing-state bands under the dashboard's charts and is added to captures
+// recorded from the dashboard, so ReplayCapture can check replayed results
+// against what the rules actually did.
+func (e *Engine) SetRuleStateHistory(config *RuleStateConfig) error {
+	var cfg *RuleStateConfig
+	if config != nil {
+		if config.Retention < 0 || config.MaxIntervals < 0 {
+			return fmt.Errorf("rule state retention and interval limit cannot be negative")
+		}
+		copied := *config
+		if copied.Retention == 0 {
+			copied.Retention = DefaultRuleStateRetention
+		}
+		if copied.MaxIntervals == 0 {
+			copied.MaxIntervals = DefaultMaxRuleStateIntervals
+		}
+		cfg = &copied
+	}
+
+	t := e.ruleStates
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.config = cfg
+	if cfg == nil {
+		t.rules = make(map[string][]RuleStateInterval)
+		return nil
+	}
+	for rule := range t.rules {
+		t.pruneLocked(rule, e.clock.Now())
+	}
+	return nil
+}
+
+// record adds one evaluation result of a rule. Evaluations further than gap
+// apart, such as across an engine restart, start a new interval rather than
+// claiming the state held in between.
+func (t *ruleStateTracker) record(rule string, firing bool, now time.Time, gap time.Duration) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.config == nil {
+		return
+	}
+
+	intervals := t.rules[rule]
+	if n := len(intervals); n > 0 && now.Sub(intervals[n-1].End) <= gap {
+		last := &intervals[n-1]
+		if last.Firing == firing {
+			last.End = now
+			last.Evaluations++
+			return
+		}
+		last.End = now
+	}
+	t.rules[rule] = append(intervals, RuleStateInterval{Start: now, End: now, Firing: firing, Evaluations: 1})
+	t.pruneLocked(rule, now)
+}
+
+// pruneLocked drops a rule's intervals that ended before the retention
+// window or exceed the interval limit. Callers hold t.mutex.
+func (t *ruleStateTracker) pruneLocked(rule string, now time.Time) {
+	intervals := t.rules[rule]
+	cutoff := now.Add(-t.config.Retention)
+	drop := sort.Search(len(intervals), func(i int) bool { return !intervals[i].End.Before(cutoff) })
+	if excess := len(intervals) - drop - t.config.MaxIntervals; excess > 0 {
+		drop += excess
+	}
+	if drop > 0 {
+		t.rules[rule] = append([]RuleStateInterval(nil), intervals[drop:]...)
+	}
+}
+
+// history returns a rule's intervals that ended at or after since
+func (t *ruleStateTracker) history(rule string, since time.Time) []RuleStateInterval {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	intervals := t.rules[rule]
+	first := sort.Search(len(intervals), func(i int) bool { return !intervals[i].End.Before(since) })
+	return append([]RuleStateInterval(nil), intervals[first:]...)
+}
+
+// current returns each rule's latest evaluation result
+func (t *ruleStateTracker) current() map[string]bool {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	states := make(map[string]bool, len(t.rules))
+	for rule, intervals := range t.rules {
+		if n := len(intervals); n > 0 {
+			states[rule] = intervals[n-1].Firing
+		}
+	}
+	return states
+}
+
+// restore merges saved intervals older than a rule's current ones into its
+// history
+func (t *ruleStateTracker) restore(saved RuleStateHistory, now time.Time) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.config == nil {
+		return
+	}
+	current := t.rules[saved.Rule]
+	var merged []RuleStateInterval
+	for _, interval := range saved.Intervals {
+		if len(current) == 0 || interval.End.Before(current[0].Start) {
+			merged = append(merged, interval)
+		}
+	}
+	t.rules[saved.Rule] = append(merged, current...)
+	t.pruneLocked(saved.Rule, now)
+}
+
+// remove forgets one rule's state history
+func (t *ruleStateTracker) remove(rule string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.rules, rule)
+}
+
+// clear forgets every rule's state history
+func (t *ruleStateTracker) clear() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.rules = make(map[string][]RuleStateInterval)
+}
+
+// GetRuleStateHistory returns when each rule's condition held, for the
+// intervals ending at or after since, ordered by rule name
+func (e *Engine) GetRuleStateHistory(since time.Time) []RuleStateHistory {
+	rules := e.GetRules()
+	result := make([]RuleStateHistory, 0, len(rules))
+	for _, rule := range rules {
+		if intervals := e.ruleStates.history(rule.Name, since); len(intervals) > 0 {
+			result = append(result, RuleStateHistory{Rule: rule.Name, Intervals: intervals})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Rule < result[j].Rule })
+	return result
+}
+
+// recordRuleState adds the result of a completed evaluation to the rule's
+// state history
+func (e *Engine) recordRuleState(rule *Rule, firing bool) {
+	interval := rule.Interval
+	if interval < e.config.EvaluationInterval {
+		interval = e.config.EvaluationInterval
+	}
+	e.ruleStates.record(rule.Name, firing, e.clock.Now(), 2*interval+rule.Cooldown)
+}
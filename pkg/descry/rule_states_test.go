@@ -0,0 +1,140 @@
+package descry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/clock"
+)
+
+func TestRuleStateHistory(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{
+		DisableDashboard:   true,
+		Clock:              fake,
+		EvaluationInterval: time.Second,
+		Logger:             log.New(io.Discard, "", 0),
+	})
+	start := fake.Now()
+	if err := engine.AddRule("queue", `when custom.queue_depth > 10 { log("backed up") }`); err != nil {
+		t.Fatal(err)
+	}
+
+	// Three healthy evaluations, two firing, one healthy, then a restart
+	// sized gap
+	for _, depth := range []float64{1, 2, 3, 20, 30, 4} {
+		engine.UpdateCustomMetric("queue_depth", depth)
+		engine.EvaluateRules()
+		fake.Advance(time.Second)
+	}
+	fake.Advance(time.Minute)
+	engine.EvaluateRules()
+
+	history := engine.GetRuleStateHistory(time.Time{})
+	if len(history) != 1 || history[0].Rule != "queue" {
+		t.Fatalf("expected the history of one rule, got %+v", history)
+	}
+	intervals := history[0].Intervals
+	expected := []RuleStateInterval{
+		{Start: start, End: start.Add(3 * time.Second), Firing: false, Evaluations: 3},
+		{Start: start.Add(3 * time.Second), End: start.Add(5 * time.Second), Firing: true, Evaluations: 2},
+		{Start: start.Add(5 * time.Second), End: start.Add(5 * time.Second), Firing: false, Evaluations: 1},
+		{Start: start.Add(66 * time.Second), End: start.Add(66 * time.Second), Firing: false, Evaluations: 1},
+	}
+	if len(intervals) != len(expected) {
+		t.Fatalf("expected %d intervals, got %+v", len(expected), intervals)
+	}
+	for i := range expected {
+		if intervals[i] != expected[i] {
+			t.Errorf("interval %d: expected %+v, got %+v", i, expected[i], intervals[i])
+		}
+	}
+	if since := engine.GetRuleStateHistory(start.Add(10 * time.Second)); len(since[0].Intervals) != 1 {
+		t.Errorf("expected only the interval after the gap, got %+v", since)
+	}
+
+	// State survives a restart
+	data, err := engine.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake, Logger: log.New(io.Discard, "", 0)})
+	if err := restored.AddRule("queue", `when custom.queue_depth > 10 { log("backed up") }`); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.Restore(data); err != nil {
+		t.Fatal(err)
+	}
+	if history := restored.GetRuleStateHistory(time.Time{}); len(history) != 1 || len(history[0].Intervals) != 4 {
+		t.Errorf("expected the restored history, got %+v", history)
+	}
+
+	// The interval limit drops the oldest intervals
+	if err := engine.SetRuleStateHistory(&RuleStateConfig{MaxIntervals: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if intervals := engine.GetRuleStateHistory(time.Time{})[0].Intervals; len(intervals) != 2 || !intervals[1].Start.Equal(start.Add(66*time.Second)) {
+		t.Errorf("expected the newest two intervals, got %+v", intervals)
+	}
+	if err := engine.SetRuleStateHistory(&RuleStateConfig{Retention: -time.Second}); err == nil {
+		t.Error("expected a negative retention to be rejected")
+	}
+	if err := engine.SetRuleStateHistory(nil); err != nil {
+		t.Fatal(err)
+	}
+	engine.EvaluateRules()
+	if history := engine.GetRuleStateHistory(time.Time{}); len(history) != 0 {
+		t.Errorf("expected no history once disabled, got %+v", history)
+	}
+}
+
+func TestReplayComparesRecordedRuleStates(t *testing.T) {
+	// The production rule fired from 3s; the local rule fires from 5s
+	start := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	writer, err := NewCaptureWriter(&buf, "http://prod:9090", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i <= 6; i++ {
+		frame := CaptureFrame{
+			Timestamp:  start.Add(time.Duration(i) * time.Second),
+			Metrics:    map[string]float64{"custom.queue_depth": float64(i * 10)},
+			RuleStates: map[string]bool{"queue": i >= 3},
+		}
+		if err := writer.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+	path := filepath.Join(t.TempDir(), "capture.dscrpack")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.AddRule("queue", `when custom.queue_depth > 40 { alert("backed up") }`); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.AddRule("unrecorded", `when custom.queue_depth > 0 { alert("new rule") }`); err != nil {
+		t.Fatal(err)
+	}
+	result, err := engine.ReplayCapture(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue, unrecorded := result.Rules[0], result.Rules[1]
+	if queue.Compared != 7 || queue.Mismatches != 2 || queue.FirstMismatch == nil || *queue.FirstMismatch != 3*time.Second {
+		t.Errorf("expected the 3s and 4s evaluations to differ from production, got %+v", queue)
+	}
+	if unrecorded.Compared != 0 || unrecorded.Mismatches != 0 {
+		t.Errorf("expected a rule missing from the capture not to be compared, got %+v", unrecorded)
+	}
+}
@@ -0,0 +1,129 @@
+package descry
+
+import (
+	"sync"
+	"time"
+)
+
+// RuleStats counts a rule's evaluations since it was loaded or last changed,
+// to find rules that are slow, flapping or never firing. Durations are wall
+// clock times, marshalled as nanoseconds.
+type RuleStats struct {
+	Rule string `json:"rule"`
+	// Evaluations counts every run of the rule, whatever its outcome
+	Evaluations int64 `json:"evaluations"`
+	// Triggers counts evaluations in which the condition was met
+	Triggers int64 `json:"triggers"`
+	// Errors counts evaluations that failed, including resource limit
+	// violations; Timeouts counts those that exceeded MaxEvaluationTime
+	Errors   int64 `json:"errors"`
+	Timeouts int64 `json:"timeouts"`
+	// TriggerRate is the percentage of evaluations that triggered
+	TriggerRate     float64       `json:"trigger_rate"`
+	LastDuration    time.Duration `json:"last_duration"`
+	AverageDuration time.Duration `json:"average_duration"`
+	MaxDuration     time.Duration `json:"max_duration"`
+	LastEvaluated   time.Time     `json:"last_evaluated,omitempty"`
+	LastTriggered   time.Time     `json:"last_triggered,omitempty"`
+	// LastError describes the most recent failed evaluation
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ruleOutcome is the result of one rule evaluation
+type ruleOutcome int
+
+const (
+	outcomeHealthy ruleOutcome = iota
+	outcomeTriggered
+	outcomeError
+	outcomeTimeout
+)
+
+// ruleStatsTracker accumulates evaluation statistics per rule
+type ruleStatsTracker struct {
+	mutex sync.RWMutex
+	rules map[string]*ruleStatsEntry
+}
+
+type ruleStatsEntry struct {
+	stats         RuleStats
+	totalDuration time.Duration
+}
+
+func newRuleStatsTracker() *ruleStatsTracker {
+	return &ruleStatsTracker{rules: make(map[string]*ruleStatsEntry)}
+}
+
+// record counts one evaluation of a rule that finished at now. err describes
+// failed and timed out evaluations.
+func (t *ruleStatsTracker) record(rule string, outcome ruleOutcome, duration time.Duration, now time.Time, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	entry, exists := t.rules[rule]
+	if !exists {
+		entry = &ruleStatsEntry{stats: RuleStats{Rule: rule}}
+		t.rules[rule] = entry
+	}
+
+	stats := &entry.stats
+	stats.Evaluations++
+	stats.LastEvaluated = now
+	switch outcome {
+	case outcomeTriggered:
+		stats.Triggers++
+		stats.LastTriggered = now
+	case outcomeError:
+		stats.Errors++
+	case outcomeTimeout:
+		stats.Timeouts++
+	}
+	if err != nil {
+		stats.LastError = err.Error()
+	}
+	stats.TriggerRate = 100 * float64(stats.Triggers) / float64(stats.Evaluations)
+
+	entry.totalDuration += duration
+	stats.LastDuration = duration
+	stats.AverageDuration = entry.totalDuration / time.Duration(stats.Evaluations)
+	if duration > stats.MaxDuration {
+		stats.MaxDuration = duration
+	}
+}
+
+// get returns a rule's statistics; rules that were never evaluated have zero
+// counts
+func (t *ruleStatsTracker) get(rule string) RuleStats {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if entry, exists := t.rules[rule]; exists {
+		return entry.stats
+	}
+	return RuleStats{Rule: rule}
+}
+
+// remove forgets one rule's statistics
+func (t *ruleStatsTracker) remove(rule string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	delete(t.rules, rule)
+}
+
+// clear forgets every rule's statistics
+func (t *ruleStatsTracker) clear() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.rules = make(map[string]*ruleStatsEntry)
+}
+
+// GetRuleStats returns evaluation statistics for every loaded rule, in rule
+// order. Rules that have never been evaluated, or never triggered, are
+// included with zero counts.
+func (e *Engine) GetRuleStats() []RuleStats {
+	rules := e.GetRules()
+	result := make([]RuleStats, len(rules))
+	for i, rule := range rules {
+		result[i] = e.ruleStats.get(rule.Name)
+	}
+	return result
+}
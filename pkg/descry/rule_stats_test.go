@@ -0,0 +1,74 @@
+package descry
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestRuleStatsTracker(t *testing.T) {
+	tracker := newRuleStatsTracker()
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	tracker.record("slow", outcomeHealthy, 10*time.Millisecond, now, nil)
+	tracker.record("slow", outcomeTriggered, 30*time.Millisecond, now.Add(time.Second), nil)
+	tracker.record("slow", outcomeTimeout, 50*time.Millisecond, now.Add(2*time.Second), context.DeadlineExceeded)
+	tracker.record("slow", outcomeTriggered, 10*time.Millisecond, now.Add(3*time.Second), nil)
+
+	stats := tracker.get("slow")
+	if stats.Evaluations != 4 || stats.Triggers != 2 || stats.Timeouts != 1 || stats.Errors != 0 {
+		t.Errorf("unexpected counts: %+v", stats)
+	}
+	if stats.TriggerRate != 50 || stats.AverageDuration != 25*time.Millisecond ||
+		stats.LastDuration != 10*time.Millisecond || stats.MaxDuration != 50*time.Millisecond {
+		t.Errorf("unexpected rates or durations: %+v", stats)
+	}
+	if !stats.LastTriggered.Equal(now.Add(3*time.Second)) || stats.LastError != context.DeadlineExceeded.Error() {
+		t.Errorf("unexpected last trigger or error: %+v", stats)
+	}
+
+	if stats := tracker.get("unknown"); stats.Rule != "unknown" || stats.Evaluations != 0 {
+		t.Errorf("expected zero stats for an unevaluated rule, got %+v", stats)
+	}
+}
+
+func TestEngineRuleStats(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	rules := map[string]string{
+		"always": `when heap.alloc > 0 { log("triggered") }`,
+		"never":  `when heap.alloc < 0 { log("never") }`,
+		"broken": `when heap.alloc / 0 > 1 { log("never") }`,
+	}
+	for _, name := range []string{"always", "never", "broken"} {
+		if err := engine.AddRule(name, rules[name]); err != nil {
+			t.Fatalf("failed to add rule %s: %v", name, err)
+		}
+	}
+
+	engine.EvaluateRules()
+	engine.EvaluateRules()
+
+	stats := engine.GetRuleStats()
+	if len(stats) != 3 || stats[0].Rule != "always" || stats[1].Rule != "never" || stats[2].Rule != "broken" {
+		t.Fatalf("expected stats for every rule in rule order, got %+v", stats)
+	}
+	if stats[0].Evaluations != 2 || stats[0].Triggers != 2 || stats[0].LastDuration <= 0 {
+		t.Errorf("unexpected stats for always: %+v", stats[0])
+	}
+	if stats[1].Evaluations != 2 || stats[1].Triggers != 0 || !stats[1].LastTriggered.IsZero() {
+		t.Errorf("unexpected stats for never: %+v", stats[1])
+	}
+	if stats[2].Errors != 2 || stats[2].LastError == "" {
+		t.Errorf("unexpected stats for broken: %+v", stats[2])
+	}
+
+	// Changing a rule's condition starts its statistics afresh
+	if err := engine.UpdateRule("always", `when heap.alloc > 1 { log("triggered") }`); err != nil {
+		t.Fatalf("failed to update rule: %v", err)
+	}
+	if stats := engine.GetRuleStats(); stats[0].Evaluations != 0 {
+		t.Errorf("expected statistics to reset on update, got %+v", stats[0])
+	}
+}
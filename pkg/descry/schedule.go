@@ -0,0 +1,167 @@
+package descry
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/parser"
+)
+
+// timeWindow is a time-of-day range used by the during clause of a when
+// statement, optionally restricted to certain weekdays. Windows whose end is
+// before their start wrap past midnight, so "22:00-02:00" covers four hours.
+type timeWindow struct {
+	days  [7]bool // indexed by time.Weekday; all true when no days are given
+	start int     // minutes after midnight, inclusive
+	end   int     // minutes after midnight, exclusive
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// parseTimeWindow parses specs such as "02:00-06:00", "Mon-Fri 09:00-17:00"
+// and "Sat,Sun 00:00-24:00". Times are interpreted in the local time zone.
+func parseTimeWindow(spec string) (*timeWindow, error) {
+	fields := strings.Fields(spec)
+	window := &timeWindow{}
+
+	switch len(fields) {
+	case 1:
+		for i := range window.days {
+			window.days[i] = true
+		}
+	case 2:
+		if err := window.parseDays(fields[0]); err != nil {
+			return nil, fmt.Errorf("invalid time window %q: %v", spec, err)
+		}
+		fields = fields[1:]
+	default:
+		return nil, fmt.Errorf("invalid time window %q: expected [days] HH:MM-HH:MM", spec)
+	}
+
+	bounds := strings.Split(fields[0], "-")
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("invalid time window %q: expected HH:MM-HH:MM", spec)
+	}
+	var err error
+	if window.start, err = parseClock(bounds[0]); err != nil {
+		return nil, fmt.Errorf("invalid time window %q: %v", spec, err)
+	}
+	if window.end, err = parseClock(bounds[1]); err != nil {
+		return nil, fmt.Errorf("invalid time window %q: %v", spec, err)
+	}
+	if window.start == window.end {
+		return nil, fmt.Errorf("invalid time window %q: start and end are equal", spec)
+	}
+	return window, nil
+}
+
+// parseDays parses a comma-separated list of weekdays and weekday ranges
+func (w *timeWindow) parseDays(spec string) error {
+	for _, part := range strings.Split(spec, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := weekdayNames[strings.ToLower(from)]
+		if !ok {
+			return fmt.Errorf("unknown weekday %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = weekdayNames[strings.ToLower(to)]; !ok {
+				return fmt.Errorf("unknown weekday %q", to)
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock parses HH:MM into minutes after midnight. 24:00 is accepted as
+// the end of the day.
+func parseClock(value string) (int, error) {
+	var hour, minute int
+	if _, err := fmt.Sscanf(value, "%d:%d", &hour, &minute); err != nil || len(value) != 5 {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q", value)
+	}
+	return hour*60 + minute, nil
+}
+
+// contains reports whether t falls inside the window. For windows that wrap
+// past midnight, the weekday is that of the window's start.
+func (w *timeWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	if w.start < w.end {
+		return w.days[day] && minute >= w.start && minute < w.end
+	}
+	if minute >= w.start {
+		return w.days[day]
+	}
+	if minute < w.end {
+		return w.days[(day+6)%7]
+	}
+	return false
+}
+
+// unitDuration converts a parsed duration, such as the every entry of a rule
+// block or a within clause, to a time.Duration. A nil duration yields zero.
+func unitDuration(unit *parser.UnitExpression) time.Duration {
+	if unit == nil {
+		return 0
+	}
+	return time.Duration(unit.Value.(*parser.IntegerLiteral).Value) * timeUnits[strings.ToUpper(unit.Unit)]
+}
+
+// ruleDue reports whether a rule with its own interval should be evaluated at
+// now. Half an evaluation tick of slack keeps ticker jitter from delaying a
+// rule by a whole tick.
+func (e *Engine) ruleDue(rule *Rule, now time.Time) bool {
+	if rule.Interval <= 0 {
+		return true
+	}
+	last := e.schedule.last(rule.Name)
+	return last.IsZero() || now.Sub(last) >= rule.Interval-e.config.EvaluationInterval/2
+}
+
+// ruleSchedule records when the evaluation loop last ran each rule, by name.
+// It changes on every evaluation, so it is kept outside Rule, which is
+// replaced rather than modified in place.
+type ruleSchedule struct {
+	mutex         sync.Mutex
+	lastEvaluated map[string]time.Time
+}
+
+func newRuleSchedule() *ruleSchedule {
+	return &ruleSchedule{lastEvaluated: make(map[string]time.Time)}
+}
+
+// last returns when the named rule was last evaluated, or the zero time
+func (s *ruleSchedule) last(name string) time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastEvaluated[name]
+}
+
+// evaluated records that the named rule was evaluated at the given time
+func (s *ruleSchedule) evaluated(name string, at time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lastEvaluated[name] = at
+}
@@ -1,6 +1,7 @@
 package descry
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -204,7 +205,7 @@ func TestSandboxingSafety(t *testing.T) {
 		}
 		
 		// The rule should parse and evaluate without actually accessing files
-		engine.Start()
+		engine.Start(context.Background())
 		defer engine.Stop()
 		
 		// Let it run briefly
@@ -224,7 +225,7 @@ func TestSandboxingSafety(t *testing.T) {
 			t.Errorf("Rule with URL should parse safely: %v", err)
 		}
 		
-		engine.Start()
+		engine.Start(context.Background())
 		defer engine.Stop()
 		
 		time.Sleep(100 * time.Millisecond)
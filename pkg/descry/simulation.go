@@ -0,0 +1,316 @@
+package descry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Simulation profile shapes
+const (
+	ProfileRamp  = "ramp"
+	ProfileSpike = "spike"
+	ProfileSine  = "sine"
+)
+
+// maxSimulationSteps bounds the work of one simulation
+const maxSimulationSteps = 10000
+
+// SimulationProfile gives one metric synthetic values over a simulation.
+// Durations are offsets from the start of the simulation and are marshalled
+// as nanoseconds.
+type SimulationProfile struct {
+	// Metric is the DSL name of the metric, e.g. "heap.alloc" or "custom.queue_depth"
+	Metric string `json:"metric"`
+	// Shape is ProfileRamp, ProfileSpike or ProfileSine
+	Shape string `json:"shape"`
+	// Base is where a ramp starts, the value outside a spike and the midline
+	// of a sine wave; Peak is where a ramp ends, the value during a spike and
+	// the crest of a sine wave. Values use the metric's DSL units, e.g. bytes
+	// for heap.alloc and milliseconds for http.response_time.
+	Base float64 `json:"base"`
+	Peak float64 `json:"peak"`
+	// Start and Length place a spike
+	Start  time.Duration `json:"start,omitempty"`
+	Length time.Duration `json:"length,omitempty"`
+	// Period is the length of one sine wave
+	Period time.Duration `json:"period,omitempty"`
+}
+
+// valueAt returns the profile's value at offset into a simulation lasting total
+func (p SimulationProfile) valueAt(offset, total time.Duration) float64 {
+	switch p.Shape {
+	case ProfileRamp:
+		return p.Base + (p.Peak-p.Base)*float64(offset)/float64(total)
+	case ProfileSpike:
+		if offset >= p.Start && offset < p.Start+p.Length {
+			return p.Peak
+		}
+		return p.Base
+	default:
+		return p.Base + (p.Peak-p.Base)*math.Sin(2*math.Pi*float64(offset)/float64(p.Period))
+	}
+}
+
+// Simulation describes a run of rules against synthetic metrics. Metrics
+// without a profile keep their current values.
+type Simulation struct {
+	// Duration is the simulated time span
+	Duration time.Duration `json:"duration"`
+	// Step is the simulated evaluation interval (default EvaluationInterval)
+	Step     time.Duration       `json:"step,omitempty"`
+	Profiles []SimulationProfile `json:"profiles"`
+	// Source, if set, is simulated instead of the loaded rules, so a rule can
+	// be tried out before it is saved
+	Source string `json:"source,omitempty"`
+}
+
+// SimulationResult reports which rules would have fired during a simulation
+// or capture replay and when
+type SimulationResult struct {
+	// Start is the time offsets are measured from: the start of a simulation
+	// or the first frame of a replayed capture
+	Start time.Time        `json:"start"`
+	Steps []SimulationStep `json:"steps"`
+	Rules []SimulatedRule  `json:"rules"`
+}
+
+// SimulationStep is one simulated evaluation
+type SimulationStep struct {
+	Offset time.Duration `json:"offset"`
+	// Metrics holds the profiled metrics' values. Replays leave it empty, as
+	// the capture holds every recorded value.
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// Triggered names the rules whose conditions were met
+	Triggered []string `json:"triggered,omitempty"`
+}
+
+// SimulatedRule summarizes one rule's simulated evaluations
+type SimulatedRule struct {
+	Rule     string `json:"rule"`
+	Triggers int    `json:"triggers"`
+	// FirstTrigger is the offset of the first trigger, if there was one
+	FirstTrigger *time.Duration `json:"first_trigger,omitempty"`
+	// Error describes the last failed evaluation, if any
+	Error string `json:"error,omitempty"`
+	// Compared counts the evaluations of a replay checked against the
+	// rule's recorded results, and Mismatches those whose result differed.
+	// FirstMismatch is the offset of the first that differed.
+	Compared      int            `json:"compared,omitempty"`
+	Mismatches    int            `json:"mismatches,omitempty"`
+	FirstMismatch *time.Duration `json:"first_mismatch,omitempty"`
+}
+
+// metricOverrides supplies an evaluator with synthetic or recorded metric
+// values in place of the live ones. Metrics it does not know are read live.
+type metricOverrides interface {
+	// value returns a metric's value at the given simulated time
+	value(path string, at time.Time) (float64, bool)
+	// history returns a metric's values within duration before at, oldest first
+	history(path string, at time.Time, duration time.Duration) ([]timedValue, bool)
+}
+
+// recordedRuleStates is implemented by metric overrides that also know
+// whether each rule's condition held when the metrics were recorded
+type recordedRuleStates interface {
+	ruleState(rule string, at time.Time) (firing bool, ok bool)
+}
+
+// simulatedMetrics supplies profiled metric values to an evaluator running a
+// simulation
+type simulatedMetrics struct {
+	start    time.Time
+	step     time.Duration
+	total    time.Duration
+	profiles map[string]SimulationProfile
+}
+
+// value returns a profiled metric's value at the given simulated time
+func (m *simulatedMetrics) value(path string, at time.Time) (float64, bool) {
+	profile, ok := m.profiles[path]
+	if !ok {
+		return 0, false
+	}
+	return profile.valueAt(at.Sub(m.start), m.total), true
+}
+
+// history returns a profiled metric's values at each step within duration
+// before at, oldest first. The simulation has no history before its start.
+func (m *simulatedMetrics) history(path string, at time.Time, duration time.Duration) ([]timedValue, bool) {
+	profile, ok := m.profiles[path]
+	if !ok {
+		return nil, false
+	}
+	end := at.Sub(m.start)
+	first := end - duration
+	if first < 0 {
+		first = 0
+	} else if remainder := first % m.step; remainder != 0 {
+		first += m.step - remainder
+	}
+
+	var values []timedValue
+	for offset := first; offset <= end; offset += m.step {
+		values = append(values, timedValue{value: profile.valueAt(offset, m.total), timestamp: m.start.Add(offset)})
+	}
+	return values, true
+}
+
+// Simulate evaluates rules against synthetic metric profiles, such as a
+// heap.alloc ramp or an http.error_rate spike, and reports which rules would
+// have fired and when. It helps authoring rules without production-like load.
+// Rule bodies never run, and nothing is recorded: no events, statistics or
+// availability.
+//
+// Example:
+//
+//	result, err := engine.Simulate(ctx, descry.Simulation{
+//		Duration: 10 * time.Minute,
+//		Profiles: []descry.SimulationProfile{
+//			{Metric: "heap.alloc", Shape: descry.ProfileRamp, Base: 50e6, Peak: 500e6},
+//		},
+//	})
+func (e *Engine) Simulate(ctx context.Context, sim Simulation) (*SimulationResult, error) {
+	if sim.Duration <= 0 {
+		return nil, fmt.Errorf("simulation duration must be positive")
+	}
+	if sim.Step <= 0 {
+		sim.Step = e.config.EvaluationInterval
+	}
+	if sim.Duration/sim.Step > maxSimulationSteps {
+		return nil, fmt.Errorf("simulation of %v in steps of %v exceeds %d steps", sim.Duration, sim.Step, maxSimulationSteps)
+	}
+
+	metrics := &simulatedMetrics{
+		start:    time.Now(),
+		step:     sim.Step,
+		total:    sim.Duration,
+		profiles: make(map[string]SimulationProfile),
+	}
+	known := e.SnapshotMetrics()
+	for _, profile := range sim.Profiles {
+		if _, ok := known[profile.Metric]; !ok && !strings.HasPrefix(profile.Metric, "custom.") {
+			return nil, fmt.Errorf("unknown metric %q", profile.Metric)
+		}
+		switch profile.Shape {
+		case ProfileRamp:
+		case ProfileSpike:
+			if profile.Length <= 0 {
+				return nil, fmt.Errorf("spike on %s needs a positive length", profile.Metric)
+			}
+		case ProfileSine:
+			if profile.Period <= 0 {
+				return nil, fmt.Errorf("sine on %s needs a positive period", profile.Metric)
+			}
+		default:
+			return nil, fmt.Errorf("unknown profile shape %q (expected %s, %s or %s)", profile.Shape, ProfileRamp, ProfileSpike, ProfileSine)
+		}
+		metrics.profiles[profile.Metric] = profile
+	}
+
+	var rules []*Rule
+	if sim.Source != "" {
+		compiled, err := e.compileRules("simulation", sim.Source, "")
+		if err != nil {
+			return nil, err
+		}
+		rules = compiled
+	} else {
+		rules = e.enabledRules()
+	}
+
+	var offsets []time.Duration
+	for offset := time.Duration(0); offset <= sim.Duration; offset += sim.Step {
+		offsets = append(offsets, offset)
+	}
+	return e.simulateRules(ctx, rules, metrics, metrics.start, offsets, func(offset time.Duration) map[string]float64 {
+		values := make(map[string]float64, len(metrics.profiles))
+		for name, profile := range metrics.profiles {
+			values[name] = profile.valueAt(offset, sim.Duration)
+		}
+		return values
+	})
+}
+
+// enabledRules returns the loaded rules that are not disabled
+func (e *Engine) enabledRules() []*Rule {
+	var rules []*Rule
+	for _, rule := range e.GetRules() {
+		if !rule.Disabled {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// simulateRules evaluates rules in dry-run mode at each offset from start,
+// reading metrics from overrides. stepMetrics, if set, gives the values
+// reported for each step.
+func (e *Engine) simulateRules(ctx context.Context, rules []*Rule, overrides metricOverrides, start time.Time,
+	offsets []time.Duration, stepMetrics func(offset time.Duration) map[string]float64) (*SimulationResult, error) {
+	var simTime time.Time
+	evaluator := NewEvaluator(e)
+	evaluator.now = func() time.Time { return simTime }
+	evaluator.dryRun = true
+	evaluator.simulation = overrides
+	recorded, _ := overrides.(recordedRuleStates)
+
+	result := &SimulationResult{Start: start, Rules: make([]SimulatedRule, len(rules))}
+	lastEvaluated := make([]time.Duration, len(rules))
+	for i, rule := range rules {
+		result.Rules[i].Rule = rule.Name
+		lastEvaluated[i] = -1
+	}
+
+	for _, offset := range offsets {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		simTime = start.Add(offset)
+
+		step := SimulationStep{Offset: offset}
+		if stepMetrics != nil {
+			step.Metrics = stepMetrics(offset)
+		}
+
+		for i, rule := range rules {
+			// Rules with an every interval are evaluated as often as they would be live
+			if lastEvaluated[i] >= 0 && offset-lastEvaluated[i] < rule.Interval {
+				continue
+			}
+			lastEvaluated[i] = offset
+
+			evaluator.SetCurrentRuleName(rule.Name)
+			outcome := evaluator.EvalWithContext(ctx, rule.AST)
+			if outcome != nil && outcome.Type() == ERROR_OBJ {
+				result.Rules[i].Error = outcome.(*Error).Message
+				continue
+			}
+			firing := outcome != nil && outcome.Type() == RULE_TRIGGERED_OBJ
+			if firing {
+				if result.Rules[i].Triggers == 0 {
+					first := offset
+					result.Rules[i].FirstTrigger = &first
+				}
+				result.Rules[i].Triggers++
+				step.Triggered = append(step.Triggered, rule.Name)
+			}
+			if recorded != nil {
+				if actual, ok := recorded.ruleState(rule.Name, simTime); ok {
+					result.Rules[i].Compared++
+					if actual != firing {
+						if result.Rules[i].Mismatches == 0 {
+							first := offset
+							result.Rules[i].FirstMismatch = &first
+						}
+						result.Rules[i].Mismatches++
+					}
+				}
+			}
+		}
+		result.Steps = append(result.Steps, step)
+	}
+	return result, nil
+}
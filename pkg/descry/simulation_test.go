@@ -0,0 +1,81 @@
+package descry
+
+import (
+	"context"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSimulate(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if err := engine.AddRule("high_memory", `when heap.alloc > 500 { alert("memory high") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+	if err := engine.AddRule("high_average", `when avg("heap.alloc", 30) > 500 { alert("average high") }`); err != nil {
+		t.Fatalf("failed to add rule: %v", err)
+	}
+
+	// heap.alloc climbs by 100 bytes every 10s step, crossing 500 at 60s
+	sim := Simulation{
+		Duration: 100 * time.Second,
+		Step:     10 * time.Second,
+		Profiles: []SimulationProfile{{Metric: "heap.alloc", Shape: ProfileRamp, Base: 0, Peak: 1000}},
+	}
+	result, err := engine.Simulate(context.Background(), sim)
+	if err != nil {
+		t.Fatalf("simulation failed: %v", err)
+	}
+	if len(result.Steps) != 11 || result.Steps[6].Metrics["heap.alloc"] != 600 {
+		t.Fatalf("unexpected steps: %+v", result.Steps)
+	}
+	if len(result.Steps[6].Triggered) != 1 || result.Steps[6].Triggered[0] != "high_memory" {
+		t.Errorf("expected only high_memory to fire at 60s, got %v", result.Steps[6].Triggered)
+	}
+
+	memory, average := result.Rules[0], result.Rules[1]
+	if memory.Triggers != 5 || memory.FirstTrigger == nil || *memory.FirstTrigger != 60*time.Second {
+		t.Errorf("unexpected high_memory result: %+v", memory)
+	}
+	// The 30s average over 40..70s is 550, the first above 500
+	if average.Triggers != 4 || average.FirstTrigger == nil || *average.FirstTrigger != 70*time.Second {
+		t.Errorf("unexpected high_average result: %+v", average)
+	}
+	if average.Error != "" {
+		t.Errorf("unexpected error: %s", average.Error)
+	}
+
+	// Rule source is simulated instead of the loaded rules
+	sim.Source = `when heap.alloc > 900 { alert("almost full") }`
+	result, err = engine.Simulate(context.Background(), sim)
+	if err != nil {
+		t.Fatalf("simulation of source failed: %v", err)
+	}
+	if len(result.Rules) != 1 || result.Rules[0].Triggers != 1 || *result.Rules[0].FirstTrigger != 100*time.Second {
+		t.Errorf("unexpected result for source: %+v", result.Rules)
+	}
+
+	// Simulations never run actions or record events
+	if events := engine.GetEventHistory(0, ""); len(events) != 0 {
+		t.Errorf("expected no events from a simulation, got %d", len(events))
+	}
+
+	invalid := []struct {
+		sim  Simulation
+		want string
+	}{
+		{Simulation{}, "duration"},
+		{Simulation{Duration: time.Hour, Step: time.Millisecond}, "exceeds"},
+		{Simulation{Duration: time.Minute, Profiles: []SimulationProfile{{Metric: "heap.nonsense", Shape: ProfileRamp}}}, "unknown metric"},
+		{Simulation{Duration: time.Minute, Profiles: []SimulationProfile{{Metric: "heap.alloc", Shape: "square"}}}, "unknown profile shape"},
+		{Simulation{Duration: time.Minute, Profiles: []SimulationProfile{{Metric: "heap.alloc", Shape: ProfileSpike}}}, "positive length"},
+		{Simulation{Duration: time.Minute, Source: `when {`}, ""},
+	}
+	for _, test := range invalid {
+		if _, err := engine.Simulate(context.Background(), test.sim); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("expected error containing %q for %+v, got %v", test.want, test.sim, err)
+		}
+	}
+}
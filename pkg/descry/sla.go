@@ -0,0 +1,251 @@
+package descry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+// DefaultSLAMinSamples is the number of recent requests a route needs before
+// its objectives are checked, when SLAConfig.MinSamples is not set
+const DefaultSLAMinSamples = 20
+
+// SLAConfig declares service level objectives for HTTP routes. The engine
+// generates a rule block for each route, named after it (e.g. /api/checkout
+// becomes sla_api_checkout), that alerts whenever one of its objectives is
+// not met. Statistics come from route() and cover the route's most recent
+// requests through HTTPMiddleware.
+type SLAConfig struct {
+	// Routes maps a route, an exact path or a prefix ending in "*", to its
+	// comma-separated objectives, e.g. "p99 < 300ms, error_rate < 1%".
+	// Objectives compare p50, p95, p99 or response_time (average) against a
+	// duration in ms or s, or error_rate against a percentage.
+	Routes map[string]string `json:"routes"`
+	// MinSamples is the number of recent requests a route needs before its
+	// objectives are checked (default DefaultSLAMinSamples)
+	MinSamples int `json:"min_samples,omitempty"`
+	// Severity of breach alerts (default high)
+	Severity string `json:"severity,omitempty"`
+}
+
+// slaObjective is one parsed objective, such as p99 < 300ms
+type slaObjective struct {
+	stat      string
+	operator  string
+	threshold float64 // milliseconds for response times, percent for error_rate
+	text      string
+}
+
+var slaObjectivePattern = regexp.MustCompile(`^([a-z0-9_]+)\s*(<=|>=|<|>)\s*([0-9]+(?:\.[0-9]+)?)\s*(ms|s|%)?$`)
+
+// slaBreachOperators negate an objective's operator to give the breach condition
+var slaBreachOperators = map[string]string{"<": ">=", "<=": ">", ">": "<=", ">=": "<"}
+
+// ParseSLAConfig decodes an SLA configuration from JSON, e.g.
+//
+//	{"routes": {"/api/checkout": "p99 < 300ms, error_rate < 1%"}}
+func ParseSLAConfig(data []byte) (*SLAConfig, error) {
+	var config SLAConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid SLA config: %w", err)
+	}
+	return &config, nil
+}
+
+// parseSLAObjectives parses a comma-separated list of objectives
+func parseSLAObjectives(spec string) ([]slaObjective, error) {
+	var objectives []slaObjective
+	for _, part := range strings.Split(spec, ",") {
+		text := strings.TrimSpace(part)
+		match := slaObjectivePattern.FindStringSubmatch(text)
+		if match == nil {
+			return nil, fmt.Errorf("invalid objective %q: expected e.g. \"p99 < 300ms\" or \"error_rate < 1%%\"", text)
+		}
+
+		objective := slaObjective{stat: match[1], operator: match[2], text: text}
+		objective.threshold, _ = strconv.ParseFloat(match[3], 64)
+		unit := match[4]
+		switch objective.stat {
+		case "p50", "p95", "p99", "response_time":
+			switch unit {
+			case "s":
+				objective.threshold *= 1000
+			case "ms", "":
+			default:
+				return nil, fmt.Errorf("invalid objective %q: %s needs a duration in ms or s", text, objective.stat)
+			}
+		case "error_rate":
+			if unit != "%" && unit != "" {
+				return nil, fmt.Errorf("invalid objective %q: error_rate needs a percentage", text)
+			}
+		default:
+			return nil, fmt.Errorf("invalid objective %q: unknown statistic %s (expected p50, p95, p99, response_time or error_rate)",
+				text, objective.stat)
+		}
+		objectives = append(objectives, objective)
+	}
+	return objectives, nil
+}
+
+// slaRuleName derives a rule name from a route, e.g. /api/checkout becomes
+// sla_api_checkout and / becomes sla_root
+func slaRuleName(route string) string {
+	var name strings.Builder
+	underscore := true
+	for _, r := range strings.ToLower(route) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			name.WriteRune(r)
+			underscore = false
+		} else if !underscore {
+			name.WriteByte('_')
+			underscore = true
+		}
+	}
+	suffix := strings.TrimSuffix(name.String(), "_")
+	if suffix == "" {
+		suffix = "root"
+	}
+	return "sla_" + suffix
+}
+
+// ruleSources generates the DSL source of the rule for each route, keyed by
+// rule name
+func (c *SLAConfig) ruleSources() (map[string]string, error) {
+	minSamples := c.MinSamples
+	if minSamples <= 0 {
+		minSamples = DefaultSLAMinSamples
+	}
+	severity := strings.ToLower(c.Severity)
+	if severity == "" {
+		severity = "high"
+	}
+	if !actions.IsValidSeverity(severity) {
+		return nil, fmt.Errorf("invalid SLA severity %q", c.Severity)
+	}
+
+	routes := make([]string, 0, len(c.Routes))
+	for route := range c.Routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	sources := make(map[string]string, len(routes))
+	owners := make(map[string]string, len(routes))
+	for _, route := range routes {
+		if !strings.HasPrefix(route, "/") || strings.ContainsAny(route, "\"\\\n") {
+			return nil, fmt.Errorf("invalid SLA route %q: expected a path such as /api/checkout", route)
+		}
+		objectives, err := parseSLAObjectives(c.Routes[route])
+		if err != nil {
+			return nil, fmt.Errorf("SLA for %s: %w", route, err)
+		}
+		name := slaRuleName(route)
+		if other, taken := owners[name]; taken {
+			return nil, fmt.Errorf("SLA routes %s and %s both map to rule %s", other, route, name)
+		}
+		owners[name] = route
+
+		texts := make([]string, len(objectives))
+		for i, objective := range objectives {
+			texts[i] = objective.text
+		}
+
+		var source strings.Builder
+		fmt.Fprintf(&source, "rule %q {\n", name)
+		fmt.Fprintf(&source, "  description: %q\n", fmt.Sprintf("SLA for %s: %s", route, strings.Join(texts, ", ")))
+		fmt.Fprintf(&source, "  severity: %s\n", severity)
+		fmt.Fprintf(&source, "  tags: \"sla\"\n")
+		for _, objective := range objectives {
+			fmt.Fprintf(&source, "  when route(%q, \"samples\") >= %d && route(%q, %q) %s %s {\n",
+				route, minSamples, route, objective.stat, slaBreachOperators[objective.operator],
+				strconv.FormatFloat(objective.threshold, 'f', -1, 64))
+			fmt.Fprintf(&source, "    alert(%q)\n", fmt.Sprintf("SLA breach on %s: %s not met", route, objective.text))
+			fmt.Fprintf(&source, "  }\n")
+		}
+		fmt.Fprintf(&source, "}\n")
+		sources[name] = source.String()
+	}
+	return sources, nil
+}
+
+// LoadSLAConfig reads an SLA configuration from a JSON file and installs it
+// with SetSLAConfig
+func (e *Engine) LoadSLAConfig(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read SLA config: %w", err)
+	}
+	config, err := ParseSLAConfig(data)
+	if err != nil {
+		return err
+	}
+	return e.SetSLAConfig(config)
+}
+
+// SetSLAConfig generates a rule for each route in config and atomically
+// replaces the rules generated from the previous configuration. Routes that
+// keep their rule keep its trigger history and enabled state. Passing nil
+// removes the generated rules. If any objective is invalid, or a generated
+// rule name is already used by another rule, nothing changes.
+func (e *Engine) SetSLAConfig(config *SLAConfig) error {
+	var rules []*Rule
+	var copied *SLAConfig
+	if config != nil {
+		sources, err := config.ruleSources()
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(sources))
+		for name := range sources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			compiled, err := e.compileRules(name, sources[name], "")
+			if err != nil {
+				return fmt.Errorf("SLA rule %s: %w", name, err)
+			}
+			rules = append(rules, compiled...)
+		}
+
+		copied = &SLAConfig{Routes: make(map[string]string, len(config.Routes)),
+			MinSamples: config.MinSamples, Severity: config.Severity}
+		for route, objectives := range config.Routes {
+			copied.Routes[route] = objectives
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	names, err := e.replaceRulesLocked(func(rule *Rule) bool { return e.slaRules[rule.Name] }, rules)
+	if err != nil {
+		return err
+	}
+	e.slaRules = make(map[string]bool, len(names))
+	for _, name := range names {
+		e.slaRules[name] = true
+	}
+	e.sla = copied
+
+	// Start collecting statistics now rather than at the first evaluation
+	if copied != nil {
+		for route := range copied.Routes {
+			e.httpMetrics.TrackRoute(route)
+		}
+	}
+	return nil
+}
+
+// GetSLAConfig returns the active SLA configuration, or nil if none is set
+func (e *Engine) GetSLAConfig() *SLAConfig {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.sla
+}
@@ -0,0 +1,112 @@
+package descry
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRouteSLAs(t *testing.T) {
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true})
+	config, err := ParseSLAConfig([]byte(`{
+		"routes": {
+			"/api/checkout": "p99 < 300ms, error_rate < 1%",
+			"/api/search/*": "p95 < 1ms"
+		},
+		"min_samples": 5
+	}`))
+	if err != nil {
+		t.Fatalf("failed to parse SLA config: %v", err)
+	}
+	if err := engine.SetSLAConfig(config); err != nil {
+		t.Fatalf("failed to set SLA config: %v", err)
+	}
+
+	checkout, ok := engine.GetRule("sla_api_checkout")
+	if !ok || checkout.Severity != "high" || checkout.Description != "SLA for /api/checkout: p99 < 300ms, error_rate < 1%" {
+		t.Fatalf("expected a generated checkout rule, got %+v", checkout)
+	}
+	if _, ok := engine.GetRule("sla_api_search"); !ok {
+		t.Fatal("expected a generated search rule")
+	}
+
+	middleware := engine.HTTPMiddleware()
+	serve := func(path string, handler http.HandlerFunc) {
+		middleware(handler)(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	for i := 0; i < 4; i++ {
+		serve("/api/checkout", func(w http.ResponseWriter, r *http.Request) {})
+	}
+
+	// Routes below the minimum sample count are not checked
+	serve("/api/search/items", func(w http.ResponseWriter, r *http.Request) { time.Sleep(2 * time.Millisecond) })
+	engine.EvaluateRules()
+	if !lastTrigger(engine, "sla_api_checkout").IsZero() || !lastTrigger(engine, "sla_api_search").IsZero() {
+		t.Fatal("expected no breach before the minimum sample count")
+	}
+
+	serve("/api/checkout", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) })
+	for i := 0; i < 4; i++ {
+		serve("/api/search/items", func(w http.ResponseWriter, r *http.Request) { time.Sleep(2 * time.Millisecond) })
+	}
+	engine.EvaluateRules()
+	if lastTrigger(engine, "sla_api_checkout").IsZero() || lastTrigger(engine, "sla_api_search").IsZero() {
+		t.Error("expected both routes to breach their objectives")
+	}
+	stats, ok := engine.GetRouteStats("/api/checkout")
+	if !ok || stats.Samples != 5 || stats.ErrorRate != 20 {
+		t.Errorf("unexpected checkout stats: %+v", stats)
+	}
+	var breach bool
+	for _, event := range engine.GetEventHistory(0, "alert") {
+		if event.RuleName == "sla_api_checkout" && strings.Contains(event.Message, "error_rate < 1% not met") {
+			breach = true
+		}
+	}
+	if !breach {
+		t.Error("expected an alert naming the missed objective")
+	}
+
+	// Replacing the configuration keeps surviving rules and drops the rest
+	if err := engine.SetSLAConfig(&SLAConfig{Routes: map[string]string{"/api/checkout": "p99 < 1s"}}); err != nil {
+		t.Fatalf("failed to replace SLA config: %v", err)
+	}
+	if _, ok := engine.GetRule("sla_api_search"); ok {
+		t.Error("expected the rule of the dropped route to be removed")
+	}
+	if rule, _ := engine.GetRule("sla_api_checkout"); rule.LastTrigger.IsZero() {
+		t.Error("expected the replaced rule to keep its trigger history")
+	}
+
+	if err := engine.AddRule("sla_api_orders", `when 1 > 0 { log("mine") }`); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []*SLAConfig{
+		{Routes: map[string]string{"/api/orders": "p99 < 1s"}},
+		{Routes: map[string]string{"/api/checkout": "p99 < 5%"}},
+		{Routes: map[string]string{"/api/checkout": "latency < 5ms"}},
+		{Routes: map[string]string{"api/checkout": "p99 < 5ms"}},
+		{Routes: map[string]string{"/api/checkout": "p99 < 5ms"}, Severity: "urgent"},
+	}
+	for _, config := range invalid {
+		if err := engine.SetSLAConfig(config); err == nil {
+			t.Errorf("expected error for %+v", config.Routes)
+		}
+	}
+	if rule, ok := engine.GetRule("sla_api_checkout"); !ok || !strings.Contains(rule.Description, "p99 < 1s") {
+		t.Error("expected a failed update to leave the previous SLA rules in place")
+	}
+
+	if err := engine.SetSLAConfig(nil); err != nil {
+		t.Fatal(err)
+	}
+	if names := len(engine.GetRules()); names != 1 || engine.GetSLAConfig() != nil {
+		t.Errorf("expected only the hand-written rule to remain, got %d rules", names)
+	}
+
+	if _, err := engine.AddRules("bad", `when route("/api", "p42") > 0 { log("x") }`); err == nil {
+		t.Error("expected an unknown route statistic to be rejected")
+	}
+}
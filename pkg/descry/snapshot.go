@@ -0,0 +1,387 @@
+package descry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log/slog"
+	"path"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/metrics"
+)
+
+// Defaults for SnapshotConfig
+const (
+	DefaultSnapshotInterval = time.Hour
+	DefaultSnapshotPrefix   = "descry/snapshots"
+	snapshotUploadTimeout   = time.Minute
+)
+
+// SnapshotObject describes a stored snapshot file
+type SnapshotObject struct {
+	Key          string
+	LastModified time.Time
+}
+
+// SnapshotStore is durable storage for snapshot files, such as an S3 or GCS
+// bucket. Keys are slash-separated paths.
+type SnapshotStore interface {
+	// Put stores data under key, replacing any existing object
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// List returns the objects whose keys start with prefix
+	List(ctx context.Context, prefix string) ([]SnapshotObject, error)
+	// Delete removes the object stored under key
+	Delete(ctx context.Context, key string) error
+}
+
+// SnapshotConfig configures periodic report snapshots. Each snapshot is a
+// JSON document with the engine's metrics, rules, availability and recent
+// events, plus a PNG rendering of the key runtime charts, so audits keep a
+// point-in-time record even after the service is gone.
+type SnapshotConfig struct {
+	// Store receives the snapshot files
+	Store SnapshotStore
+	// Interval between snapshots. Defaults to DefaultSnapshotInterval.
+	Interval time.Duration
+	// Prefix is prepended to every key. Defaults to DefaultSnapshotPrefix.
+	Prefix string
+	// Retention deletes snapshots older than this after each upload.
+	// Zero keeps snapshots forever.
+	Retention time.Duration
+}
+
+// Snapshot is the JSON document written for each snapshot
+type Snapshot struct {
+	Timestamp      time.Time                `json:"timestamp"`
+	UptimeSeconds  float64                  `json:"uptime_seconds"`
+	Runtime        metrics.RuntimeMetrics   `json:"runtime"`
+	RuntimeHistory []metrics.RuntimeMetrics `json:"runtime_history"`
+	HTTP           metrics.HTTPStats        `json:"http"`
+	Custom         map[string]float64       `json:"custom"`
+	Providers      map[string]float64       `json:"providers,omitempty"`
+	Rules          []SnapshotRule           `json:"rules"`
+	Availability   []RuleAvailability       `json:"availability"`
+	Events         []EventRecord            `json:"events"`
+}
+
+// SnapshotRule is a rule's definition at the time of a snapshot
+type SnapshotRule struct {
+	Name        string            `json:"name"`
+	Source      string            `json:"source"`
+	Description string            `json:"description,omitempty"`
+	Severity    string            `json:"severity,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	LastTrigger time.Time         `json:"last_trigger"`
+}
+
+// SetSnapshotConfig enables periodic snapshots, or disables them when config
+// is nil. Snapshots are taken while the engine is running; replacing the
+// configuration stops the previous schedule.
+func (e *Engine) SetSnapshotConfig(config *SnapshotConfig) error {
+	var cfg *SnapshotConfig
+	if config != nil {
+		if config.Store == nil {
+			return fmt.Errorf("snapshot store is required")
+		}
+		copied := *config
+		if copied.Interval <= 0 {
+			copied.Interval = DefaultSnapshotInterval
+		}
+		if copied.Prefix == "" {
+			copied.Prefix = DefaultSnapshotPrefix
+		}
+		cfg = &copied
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.snapshotStop != nil {
+		close(e.snapshotStop)
+		e.snapshotStop = nil
+	}
+	e.snapshots = cfg
+	if e.running && cfg != nil {
+		e.startSnapshotsLocked()
+	}
+	return nil
+}
+
+// startSnapshotsLocked starts the snapshot schedule. Callers hold e.mutex.
+func (e *Engine) startSnapshotsLocked() {
+	stop := make(chan struct{})
+	e.snapshotStop = stop
+	config := *e.snapshots
+	e.goBackground(func() { e.snapshotLoop(config, stop) })
+}
+
+func (e *Engine) snapshotLoop(config SnapshotConfig, stop chan struct{}) {
+	ticker := e.clock.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			ctx, cancel := context.WithTimeout(context.Background(), snapshotUploadTimeout)
+			if err := e.writeSnapshot(ctx, config, e.clock.Now()); err != nil {
+				e.log().Error("Snapshot failed", slog.String("component", "snapshot"), slog.Any("error", err))
+			}
+			cancel()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// WriteSnapshot takes a snapshot immediately using the configured store
+func (e *Engine) WriteSnapshot(ctx context.Context) error {
+	e.mutex.RLock()
+	config := e.snapshots
+	e.mutex.RUnlock()
+
+	if config == nil {
+		return fmt.Errorf("snapshots are not configured")
+	}
+	return e.writeSnapshot(ctx, *config, e.clock.Now())
+}
+
+// writeSnapshot uploads the JSON and PNG files for one snapshot, encrypted
+// if storage encryption is configured, then applies the retention policy
+func (e *Engine) writeSnapshot(ctx context.Context, config SnapshotConfig, now time.Time) error {
+	snapshot := e.buildSnapshot(now, config.Interval)
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	chart, err := renderSnapshotChart(snapshot.RuntimeHistory)
+	if err != nil {
+		return fmt.Errorf("failed to render snapshot chart: %w", err)
+	}
+
+	base := snapshotKey(config.Prefix, now)
+	jsonKey, jsonType, pngKey, pngType := base+".json", "application/json", base+".png", "image/png"
+	if encryption := e.storageEncryption(); encryption != nil {
+		if data, err = encryption.Encrypt(data); err != nil {
+			return fmt.Errorf("failed to encrypt snapshot: %w", err)
+		}
+		if chart, err = encryption.Encrypt(chart); err != nil {
+			return fmt.Errorf("failed to encrypt snapshot chart: %w", err)
+		}
+		jsonKey, pngKey = jsonKey+encryptedSuffix, pngKey+encryptedSuffix
+		jsonType, pngType = "application/octet-stream", "application/octet-stream"
+	}
+	if err := config.Store.Put(ctx, jsonKey, data, jsonType); err != nil {
+		return fmt.Errorf("failed to upload snapshot: %w", err)
+	}
+	if err := config.Store.Put(ctx, pngKey, chart, pngType); err != nil {
+		return fmt.Errorf("failed to upload snapshot chart: %w", err)
+	}
+
+	if config.Retention > 0 {
+		return pruneSnapshots(ctx, config, now)
+	}
+	return nil
+}
+
+// snapshotKey returns the key, without extension, for a snapshot taken at t,
+// e.g. descry/snapshots/2025/01/31/120000Z
+func snapshotKey(prefix string, t time.Time) string {
+	t = t.UTC()
+	return path.Join(prefix, t.Format("2006/01/02"), t.Format("150405Z"))
+}
+
+// pruneSnapshots deletes snapshots older than the retention period
+func pruneSnapshots(ctx context.Context, config SnapshotConfig, now time.Time) error {
+	objects, err := config.Store.List(ctx, config.Prefix+"/")
+	if err != nil {
+		return fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	cutoff := now.Add(-config.Retention)
+	for _, object := range objects {
+		if object.LastModified.Before(cutoff) {
+			if err := config.Store.Delete(ctx, object.Key); err != nil {
+				return fmt.Errorf("failed to delete expired snapshot %s: %w", object.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// buildSnapshot collects the engine state, including events from the last period
+func (e *Engine) buildSnapshot(now time.Time, period time.Duration) Snapshot {
+	snapshot := Snapshot{
+		Timestamp:      now,
+		UptimeSeconds:  e.GetUptime().Seconds(),
+		Runtime:        e.GetRuntimeMetrics(),
+		RuntimeHistory: e.runtimeCollector.GetHistory(),
+		HTTP:           e.GetHTTPMetrics(),
+		Custom:         make(map[string]float64),
+		Rules:          []SnapshotRule{},
+		Availability:   e.GetAvailability(),
+		Events:         []EventRecord{},
+	}
+
+	for name, value := range e.customMetrics.values() {
+		snapshot.Custom[name] = value
+	}
+	for name, value := range e.labeledCustomSeries() {
+		snapshot.Custom[name] = value
+	}
+	for name, value := range e.labeledCustomTotals() {
+		snapshot.Custom[name] = value
+	}
+	for name, value := range e.histogramValues() {
+		snapshot.Custom[name] = value
+	}
+	if providers := e.providerSnapshot(); len(providers) > 0 {
+		snapshot.Providers = providers
+	}
+	snapshot.Custom = e.redactor().metricNames(snapshot.Custom)
+
+	for _, rule := range e.GetRules() {
+		snapshot.Rules = append(snapshot.Rules, SnapshotRule{
+			Name:        rule.Name,
+			Source:      rule.Source,
+			Description: rule.Description,
+			Severity:    rule.Severity,
+			Tags:        rule.Tags,
+			Labels:      rule.Labels,
+			LastTrigger: rule.LastTrigger,
+		})
+	}
+
+	since := now.Add(-period)
+	for _, event := range e.GetEventHistory(0, "") {
+		if event.Timestamp.After(since) {
+			snapshot.Events = append(snapshot.Events, event)
+		}
+	}
+
+	return snapshot
+}
+
+// snapshotChartSeries are the runtime metrics drawn in the snapshot PNG, one
+// panel each from top to bottom
+var snapshotChartSeries = []func(metrics.RuntimeMetrics) float64{
+	func(m metrics.RuntimeMetrics) float64 { return float64(m.HeapAlloc) },
+	func(m metrics.RuntimeMetrics) float64 { return float64(m.HeapInuse) },
+	func(m metrics.RuntimeMetrics) float64 { return float64(m.NumGoroutine) },
+	func(m metrics.RuntimeMetrics) float64 { return m.GCCPUFraction },
+}
+
+const (
+	snapshotChartWidth  = 600
+	snapshotPanelHeight = 100
+	snapshotPanelGap    = 10
+)
+
+// renderSnapshotChart draws heap.alloc, heap.inuse, goroutines.count and
+// gc.cpu_fraction as stacked line charts, each scaled to its own range
+func renderSnapshotChart(history []metrics.RuntimeMetrics) ([]byte, error) {
+	height := len(snapshotChartSeries)*(snapshotPanelHeight+snapshotPanelGap) - snapshotPanelGap
+	img := image.NewRGBA(image.Rect(0, 0, snapshotChartWidth, height))
+	background := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	border := color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+	line := color.RGBA{0x34, 0x98, 0xdb, 0xff}
+
+	for x := 0; x < snapshotChartWidth; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, background)
+		}
+	}
+
+	for i, series := range snapshotChartSeries {
+		top := i * (snapshotPanelHeight + snapshotPanelGap)
+		bottom := top + snapshotPanelHeight - 1
+		for x := 0; x < snapshotChartWidth; x++ {
+			img.Set(x, top, border)
+			img.Set(x, bottom, border)
+		}
+		for y := top; y <= bottom; y++ {
+			img.Set(0, y, border)
+			img.Set(snapshotChartWidth-1, y, border)
+		}
+
+		if len(history) == 0 {
+			continue
+		}
+		low, high := series(history[0]), series(history[0])
+		for _, sample := range history {
+			v := series(sample)
+			if v < low {
+				low = v
+			}
+			if v > high {
+				high = v
+			}
+		}
+
+		var prevX, prevY int
+		for j, sample := range history {
+			x := 1
+			if len(history) > 1 {
+				x = 1 + j*(snapshotChartWidth-3)/(len(history)-1)
+			}
+			y := (top + bottom) / 2
+			if high > low {
+				y = bottom - 1 - int((series(sample)-low)/(high-low)*float64(snapshotPanelHeight-3))
+			}
+			if j > 0 {
+				drawLine(img, prevX, prevY, x, y, line)
+			} else {
+				img.Set(x, y, line)
+			}
+			prevX, prevY = x, y
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// drawLine draws a line between two points using Bresenham's algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,304 @@
+package descry
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/actions"
+)
+
+// maxS3ResponseSize bounds the size of list responses read from object storage
+const maxS3ResponseSize = 10 << 20
+
+// S3Config configures an S3-compatible snapshot store. The same store works
+// with AWS S3, Google Cloud Storage (using HMAC keys and the endpoint
+// https://storage.googleapis.com) and self-hosted services such as MinIO.
+type S3Config struct {
+	// Endpoint is the storage service URL, e.g. https://s3.us-east-1.amazonaws.com
+	Endpoint string
+	// Region used for request signing. Defaults to "us-east-1"; GCS accepts "auto".
+	Region string
+	// Bucket receives the snapshots. Objects are addressed path-style.
+	Bucket string
+	// AccessKey, SecretKey and SessionToken are the credentials. They may be
+	// secret:// references resolved through Secrets. Empty keys fall back to
+	// the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+	// environment variables.
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// Secrets resolves secret:// credential references
+	Secrets actions.SecretsProvider
+	// Transport configures proxies and TLS for the storage connection
+	Transport actions.TransportConfig
+}
+
+// S3SnapshotStore stores snapshots in an S3-compatible bucket using
+// AWS Signature Version 4
+type S3SnapshotStore struct {
+	endpoint     *url.URL
+	region       string
+	bucket       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+// NewS3SnapshotStore creates a snapshot store for an S3-compatible bucket
+func NewS3SnapshotStore(config S3Config) (*S3SnapshotStore, error) {
+	if config.Endpoint == "" {
+		return nil, fmt.Errorf("storage endpoint is required")
+	}
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("storage bucket is required")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(config.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid storage endpoint: %s", config.Endpoint)
+	}
+
+	credentials := []struct {
+		value *string
+		env   string
+	}{
+		{&config.AccessKey, "AWS_ACCESS_KEY_ID"},
+		{&config.SecretKey, "AWS_SECRET_ACCESS_KEY"},
+		{&config.SessionToken, "AWS_SESSION_TOKEN"},
+	}
+	for _, credential := range credentials {
+		if *credential.value == "" {
+			*credential.value = os.Getenv(credential.env)
+		}
+		resolved, err := actions.ResolveSecret(config.Secrets, *credential.value)
+		if err != nil {
+			return nil, err
+		}
+		*credential.value = resolved
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("storage access key and secret key are required")
+	}
+
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	client, err := actions.NewHTTPClient(config.Transport)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3SnapshotStore{
+		endpoint:     endpoint,
+		region:       region,
+		bucket:       config.Bucket,
+		accessKey:    config.AccessKey,
+		secretKey:    config.SecretKey,
+		sessionToken: config.SessionToken,
+		client:       client,
+	}, nil
+}
+
+func (s *S3SnapshotStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	resp, err := s.do(ctx, http.MethodPut, key, nil, data, map[string]string{"Content-Type": contentType})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3SnapshotStore) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3SnapshotStore) List(ctx context.Context, prefix string) ([]SnapshotObject, error) {
+	var objects []SnapshotObject
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key          string    `xml:"Key"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(io.LimitReader(resp.Body, maxS3ResponseSize)).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid list response: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			objects = append(objects, SnapshotObject{Key: object.Key, LastModified: object.LastModified})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do sends a signed request for key in the bucket. Non-2xx responses are
+// returned as errors.
+func (s *S3SnapshotStore) do(ctx context.Context, method, key string, query url.Values, body []byte, headers map[string]string) (*http.Response, error) {
+	u := *s.endpoint
+	u.Path = s.endpoint.Path + "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = s3URIEncode(u.Path, false)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage request: %w", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	s.sign(req, body, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("storage request failed: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("storage returned status %d for %s %s", resp.StatusCode, method, u.Path)
+	}
+	return resp, nil
+}
+
+// sign adds AWS Signature Version 4 headers to the request
+func (s *S3SnapshotStore) sign(req *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	// Canonical headers: host plus every header set on the request, sorted
+	headerValues := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headerValues[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headerValues))
+	for name := range headerValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headerValues[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3URIEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query parameters sorted by name, as SigV4 requires
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, s3URIEncode(name, true)+"="+s3URIEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3URIEncode percent-encodes every byte except unreserved characters and,
+// unless encodeSlash is set, "/"
+func s3URIEncode(value string, encodeSlash bool) string {
+	var out strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			out.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			out.WriteByte(c)
+		default:
+			fmt.Fprintf(&out, "%%%02X", c)
+		}
+	}
+	return out.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
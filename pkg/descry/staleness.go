@@ -0,0 +1,95 @@
+package descry
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Custom metrics are kept after their producer stops reporting, holding the
+// last value it sent. A TTL set with SetCustomMetricTTL marks a metric stale
+// once it has gone that long without an update, and rules detect silent
+// producers with stale(metric, window).
+
+// SetCustomMetricTTL sets how long a custom metric stays fresh after an
+// update. Once it goes longer without one it is reported as stale: the
+// dashboard greys it out and IsCustomMetricStale returns true. The metric
+// keeps its last value. The TTL also covers the metric's labeled series. A
+// ttl of zero or less removes it.
+//
+//	engine.SetCustomMetricTTL("heartbeat", 30*time.Second)
+func (e *Engine) SetCustomMetricTTL(name string, ttl time.Duration) {
+	e.customMetrics.setTTL(name, ttl)
+}
+
+// IsCustomMetricStale reports whether a custom metric with a TTL has gone
+// longer than it without an update. Metrics without a TTL, or never
+// reported, are not stale.
+func (e *Engine) IsCustomMetricStale(name string) bool {
+	ttl, ok := e.customMetrics.ttl(name)
+	if !ok {
+		return false
+	}
+	updated, exists := e.customMetrics.lastUpdate(name)
+	return exists && e.clock.Now().Sub(updated) > ttl
+}
+
+// staleCustomMetrics returns the custom metrics and labeled custom series
+// past their TTL, named as on the dashboard and sorted
+func (e *Engine) staleCustomMetrics() []string {
+	now := e.clock.Now()
+	var stale []string
+	for name := range e.customMetrics.values() {
+		if e.IsCustomMetricStale(name) {
+			stale = append(stale, "custom."+name)
+		}
+	}
+	for key := range e.labeledMetrics.values() {
+		path, _, ok := splitSeriesKey(key)
+		if !ok || !strings.HasPrefix(path, "custom.") {
+			continue
+		}
+		ttl, ok := e.customMetrics.ttl(strings.TrimPrefix(path, "custom."))
+		if !ok {
+			continue
+		}
+		if updated, exists := e.labeledMetrics.lastUpdate(key); exists && now.Sub(updated) > ttl {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// handleStale evaluates stale(metric, window): whether a custom metric or
+// labeled custom series has gone without an update for longer than window.
+// A metric that was never reported is stale.
+func (e *Evaluator) handleStale(metricObj, windowObj Object) Object {
+	path, ok := e.extractMetricPath(metricObj)
+	if !ok {
+		return newError("first argument to stale() must be a metric path")
+	}
+	category, metric, ok := splitMetricPath(path)
+	if !ok || category != "custom" {
+		return newError("stale() only applies to custom.* metrics, got %q", path)
+	}
+	window, ok := e.extractDuration(windowObj)
+	if !ok || window <= 0 {
+		return newError("second argument to stale() must be a positive time duration")
+	}
+
+	if e.simulation != nil {
+		if samples, ok := e.simulation.history(path, e.now(), window); ok {
+			return nativeBoolToPyObject(len(samples) == 0)
+		}
+	}
+
+	var updated time.Time
+	var exists bool
+	if strings.Contains(metric, "{") {
+		updated, exists = e.engine.labeledMetrics.lastUpdate(path)
+	} else {
+		updated, exists = e.engine.customMetrics.lastUpdate(metric)
+	}
+	return nativeBoolToPyObject(!exists || e.now().Sub(updated) > window)
+}
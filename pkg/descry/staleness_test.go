@@ -0,0 +1,88 @@
+package descry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/clock"
+)
+
+func TestCustomMetricStaleness(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake})
+	engine.SetCustomMetricTTL("heartbeat", 30*time.Second)
+	if err := engine.UpdateCustomMetric("heartbeat", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.UpdateCustomMetricWithLabels("heartbeat", 1, map[string]string{"worker": "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := engine.UpdateCustomMetric("orders", 5); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Advance(20 * time.Second)
+	if engine.IsCustomMetricStale("heartbeat") {
+		t.Error("expected heartbeat to be fresh within its TTL")
+	}
+	if stale := engine.staleCustomMetrics(); len(stale) != 0 {
+		t.Errorf("expected no stale metrics, got %v", stale)
+	}
+	if result := evalSource(t, engine, `stale("custom.heartbeat", 10s)`); result != TRUE {
+		t.Errorf("expected stale() to use its own window, got %s", result.Inspect())
+	}
+	if result := evalSource(t, engine, `stale(custom.heartbeat, 30s)`); result != FALSE {
+		t.Errorf("expected heartbeat to be fresh for stale(), got %s", result.Inspect())
+	}
+
+	fake.Advance(20 * time.Second)
+	if !engine.IsCustomMetricStale("heartbeat") || engine.IsCustomMetricStale("orders") {
+		t.Error("expected only heartbeat, which has a TTL, to be stale")
+	}
+	if value, ok := engine.GetCustomMetric("heartbeat"); !ok || value != 1 {
+		t.Errorf("expected a stale metric to keep its last value, got %v (%t)", value, ok)
+	}
+	stale := engine.staleCustomMetrics()
+	if len(stale) != 2 || stale[0] != "custom.heartbeat" || stale[1] != "custom.heartbeat{worker=a}" {
+		t.Errorf("expected heartbeat and its labeled series to be stale, got %v", stale)
+	}
+
+	tests := []struct {
+		source   string
+		expected Object
+	}{
+		{`stale("custom.heartbeat", 30s)`, TRUE},
+		{`stale(custom.heartbeat{worker="a"}, 30s)`, TRUE},
+		{`stale(custom.heartbeat{worker="a"}, 1m)`, FALSE},
+		{`stale("custom.never_reported", 1h)`, TRUE},
+	}
+	for _, tt := range tests {
+		if result := evalSource(t, engine, tt.source); result != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.source, tt.expected.Inspect(), result.Inspect())
+		}
+	}
+	if result := evalSource(t, engine, `stale("heap.alloc", 30s)`); !isError(result) {
+		t.Errorf("expected stale() to reject runtime metrics, got %s", result.Inspect())
+	}
+
+	// Updating the metric makes it fresh again, and removing the TTL stops
+	// marking it stale
+	if err := engine.UpdateCustomMetric("heartbeat", 2); err != nil {
+		t.Fatal(err)
+	}
+	if engine.IsCustomMetricStale("heartbeat") {
+		t.Error("expected an update to make heartbeat fresh")
+	}
+	engine.SetCustomMetricTTL("heartbeat", 0)
+	fake.Advance(time.Hour)
+	if engine.IsCustomMetricStale("heartbeat") || len(engine.staleCustomMetrics()) != 0 {
+		t.Error("expected no stale metrics once the TTL is removed")
+	}
+
+	if err := engine.AddRule("dead_producer", `when stale("custom.heartbeat", 30s) { log("producer stopped") }`); err != nil {
+		t.Fatalf("expected stale() to be accepted in rules: %v", err)
+	}
+	if err := engine.AddRule("invalid", `when stale("custom.heartbeat") { log("x") }`); err == nil {
+		t.Error("expected stale() without a window to be rejected")
+	}
+}
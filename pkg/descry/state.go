@@ -0,0 +1,260 @@
+package descry
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// EngineStateVersion is the format version of the state written by
+// Engine.Snapshot
+const EngineStateVersion = 1
+
+// engineState is the document written by Snapshot and read by Restore
+type engineState struct {
+	Version int       `json:"version"`
+	SavedAt time.Time `json:"saved_at"`
+	// Rules holds every rule except those generated from route SLAs, with
+	// the rule group defaults
+	Rules *RuleBundle `json:"rules"`
+	// RuleState holds the trigger history and switches of every rule,
+	// including SLA rules
+	RuleState     map[string]savedRuleState `json:"rule_state"`
+	CustomMetrics map[string]float64        `json:"custom_metrics"`
+	CustomHistory map[string][]MetricSample `json:"custom_history"`
+	Events        []EventRecord             `json:"events"`
+	// EventTimes holds the times event() conditions match against, which
+	// reach further back than Events for rare event types
+	EventTimes   map[string][]time.Time `json:"event_times"`
+	Availability []RuleAvailability     `json:"availability"`
+	// RuleStates holds when each rule's condition held
+	RuleStates []RuleStateHistory `json:"rule_states,omitempty"`
+}
+
+// savedRuleState is the runtime state of one rule
+type savedRuleState struct {
+	LastTrigger   time.Time `json:"last_trigger"`
+	LastEvaluated time.Time `json:"last_evaluated"`
+	Disabled      bool      `json:"disabled,omitempty"`
+	DryRun        bool      `json:"dry_run,omitempty"`
+}
+
+// Snapshot serializes the engine's rules and runtime state so that a
+// redeployed service can pick up where the previous process left off with
+// Restore. It holds the rules and rule group defaults, each rule's last
+// trigger and evaluation times, which carry cooldowns and every intervals
+// across the restart, its enabled and dry-run state, custom metrics and their
+// history, the event history, per-rule availability and the history of rule
+// evaluation results.
+//
+// Runtime and HTTP metrics describe the process that took the snapshot and
+// are not included, nor is the alert routing configuration, which the
+// application sets up itself. Unlike the periodic snapshots of
+// SetSnapshotConfig, which are written for postmortems, the result is meant
+// to be read back by Restore. It is encrypted if SetStorageEncryption is
+// configured.
+func (e *Engine) Snapshot() ([]byte, error) {
+	state := engineState{
+		Version:       EngineStateVersion,
+		SavedAt:       e.clock.Now().UTC(),
+		Rules:         e.ExportRuleBundle(),
+		RuleState:     make(map[string]savedRuleState),
+		CustomMetrics: make(map[string]float64),
+		CustomHistory: make(map[string][]MetricSample),
+		EventTimes:    make(map[string][]time.Time),
+		Availability:  e.GetAvailability(),
+		RuleStates:    e.GetRuleStateHistory(time.Time{}),
+	}
+	state.Rules.Routing = nil
+
+	e.mutex.RLock()
+	for _, rule := range e.rules {
+		state.RuleState[rule.Name] = savedRuleState{
+			LastTrigger:   rule.LastTrigger,
+			LastEvaluated: e.schedule.last(rule.Name),
+			Disabled:      rule.Disabled,
+			DryRun:        rule.DryRun,
+		}
+	}
+	e.mutex.RUnlock()
+
+	state.CustomMetrics = e.customMetrics.values()
+	for name, history := range e.customMetrics.histories() {
+		samples := make([]MetricSample, len(history))
+		for i, sample := range history {
+			samples[i] = MetricSample{Timestamp: sample.Timestamp, Value: sample.Value}
+		}
+		state.CustomHistory[name] = samples
+	}
+
+	e.eventMutex.RLock()
+	state.Events = append([]EventRecord{}, e.eventHistory...)
+	for eventType, times := range e.eventIndex.times {
+		state.EventTimes[eventType] = append([]time.Time{}, times...)
+	}
+	e.eventMutex.RUnlock()
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	if encryption := e.storageEncryption(); encryption != nil {
+		return encryption.Encrypt(data)
+	}
+	return data, nil
+}
+
+// Restore reads state written by Snapshot, typically right after the rules
+// are loaded at startup. Rules the engine already has keep their current
+// source, so rule files take precedence over the snapshot; rules it lacks are
+// added from the snapshot, as are rule groups it has not defined. Every
+// rule's trigger times, enabled and dry-run state are then restored.
+//
+// Saved custom metric samples, events, availability and rule states are
+// merged with those recorded since startup and trimmed to the configured
+// history sizes; a custom metric keeps its current value if it has been set
+// since startup.
+// Restore should be called once per process, since availability counts are
+// added rather than replaced. Nothing changes if the snapshot's rules are
+// invalid. Encrypted state needs the key configured with
+// SetStorageEncryption; state written in the clear is read either way, so
+// encryption can be turned on for a running deployment.
+func (e *Engine) Restore(data []byte) error {
+	if isEncrypted(data) {
+		encryption := e.storageEncryption()
+		if encryption == nil {
+			return fmt.Errorf("engine state is encrypted but no storage encryption is configured")
+		}
+		plain, err := encryption.Decrypt(data)
+		if err != nil {
+			return fmt.Errorf("failed to read engine state: %w", err)
+		}
+		data = plain
+	}
+
+	var state engineState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to read engine state: %w", err)
+	}
+	if state.Version != EngineStateVersion {
+		return fmt.Errorf("unsupported engine state version %d", state.Version)
+	}
+
+	if state.Rules != nil {
+		if err := e.restoreRules(state.Rules); err != nil {
+			return err
+		}
+	}
+
+	// Restored rules are copies swapped in like SetRuleEnabled's, since
+	// GetRules callers may hold the current ones
+	e.mutex.Lock()
+	updated := make([]*Rule, len(e.rules))
+	for i, rule := range e.rules {
+		updated[i] = rule
+		saved, ok := state.RuleState[rule.Name]
+		if !ok {
+			continue
+		}
+		restored := *rule
+		if saved.LastTrigger.After(restored.LastTrigger) {
+			restored.LastTrigger = saved.LastTrigger
+		}
+		restored.Disabled = saved.Disabled
+		restored.DryRun = saved.DryRun
+		updated[i] = &restored
+		if saved.LastEvaluated.After(e.schedule.last(rule.Name)) {
+			e.schedule.evaluated(rule.Name, saved.LastEvaluated)
+		}
+	}
+	e.rules = updated
+	e.mutex.Unlock()
+
+	e.restoreCustomMetrics(state.CustomMetrics, state.CustomHistory)
+	e.restoreEvents(state.Events, state.EventTimes)
+
+	for _, availability := range state.Availability {
+		if _, exists := e.GetRule(availability.Rule); exists {
+			e.availability.restore(availability, e.clock.Now())
+		}
+	}
+	for _, states := range state.RuleStates {
+		if _, exists := e.GetRule(states.Rule); exists {
+			e.ruleStates.restore(states, e.clock.Now())
+		}
+	}
+	return nil
+}
+
+// restoreRules imports the saved rules and groups the engine does not have
+func (e *Engine) restoreRules(saved *RuleBundle) error {
+	e.mutex.RLock()
+	missing := &RuleBundle{Version: saved.Version}
+	for _, rule := range saved.Rules {
+		if e.ruleIndexLocked(rule.Name) < 0 {
+			missing.Rules = append(missing.Rules, rule)
+		}
+	}
+	for _, group := range saved.Groups {
+		if _, exists := e.groups[group.Name]; !exists {
+			missing.Groups = append(missing.Groups, group)
+		}
+	}
+	e.mutex.RUnlock()
+
+	if len(missing.Rules) == 0 && len(missing.Groups) == 0 {
+		return nil
+	}
+	if _, err := e.ImportRuleBundle(missing, RuleBundleImportOptions{}); err != nil {
+		return fmt.Errorf("failed to restore rules: %w", err)
+	}
+	return nil
+}
+
+// restoreCustomMetrics merges saved custom metric values and samples into the
+// current ones
+func (e *Engine) restoreCustomMetrics(values map[string]float64, history map[string][]MetricSample) {
+	if e.customMetrics.restore(values, history, e.limits.MaxCustomMetrics) {
+		e.log().Warn("Custom metric not restored: maximum number of custom metrics reached")
+	}
+}
+
+// restoreEvents merges saved events and event times into the current ones
+func (e *Engine) restoreEvents(events []EventRecord, times map[string][]time.Time) {
+	e.eventMutex.Lock()
+	defer e.eventMutex.Unlock()
+
+	seen := make(map[string]bool, len(e.eventHistory))
+	for _, event := range e.eventHistory {
+		seen[event.ID] = true
+	}
+	merged := make([]EventRecord, 0, len(events)+len(e.eventHistory))
+	for _, event := range events {
+		if !seen[event.ID] {
+			merged = append(merged, event)
+		}
+	}
+	merged = append(merged, e.eventHistory...)
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].Timestamp.Before(merged[j].Timestamp) })
+	if len(merged) > e.maxEventHistory {
+		merged = merged[len(merged)-e.maxEventHistory:]
+	}
+	e.eventHistory = merged
+
+	for eventType, saved := range times {
+		current := e.eventIndex.times[eventType]
+		combined := make([]time.Time, 0, len(saved)+len(current))
+		for _, at := range saved {
+			if len(current) == 0 || at.Before(current[0]) {
+				combined = append(combined, at)
+			}
+		}
+		combined = append(combined, current...)
+		sort.Slice(combined, func(i, j int) bool { return combined[i].Before(combined[j]) })
+		if len(combined) > e.eventIndex.maxPerType {
+			combined = combined[len(combined)-e.eventIndex.maxPerType:]
+		}
+		e.eventIndex.times[eventType] = combined
+	}
+}
@@ -0,0 +1,177 @@
+package descry
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	newEngine := func() *Engine {
+		return NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	}
+
+	source := `const LIMIT = 100
+rule "orders" {
+  cooldown: 10m
+  when custom.orders.pending > LIMIT { alert("orders backing up") }
+}
+rule "deploys" {
+  when event("deploy") within 1h { log("recent deploy") }
+}`
+	previous := newEngine()
+	if _, err := previous.AddRules("orders", source); err != nil {
+		t.Fatal(err)
+	}
+	previous.SetRuleGroup(RuleGroup{Name: "business", Severity: "high"})
+	previous.UpdateCustomMetric("orders.pending", 50)
+	previous.UpdateCustomMetric("orders.pending", 150)
+	previous.EmitEvent("deploy", "v1.2.3", nil)
+	previous.EvaluateRules()
+	previous.SetRuleDryRun("deploys", true)
+	orders, _ := previous.GetRule("orders")
+	triggered := orders.LastTrigger
+	if triggered.IsZero() {
+		t.Fatal("expected the rule to trigger before the snapshot")
+	}
+
+	data, err := previous.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot failed: %v", err)
+	}
+
+	// The new process loads a newer version of one rule before restoring
+	restarted := newEngine()
+	if err := restarted.AddRule("deploys", `when event("deploy") within 2h { log("recent deploy") }`); err != nil {
+		t.Fatal(err)
+	}
+	restarted.UpdateCustomMetric("orders.pending", 120)
+	loaded, _ := restarted.GetRule("deploys")
+	if err := restarted.Restore(data); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+
+	orders, ok := restarted.GetRule("orders")
+	if !ok || !orders.LastTrigger.Equal(triggered) {
+		t.Fatalf("expected the rule and its trigger time to be restored, got %+v", orders)
+	}
+	deploys, _ := restarted.GetRule("deploys")
+	if deploys.Source != `when event("deploy") within 2h { log("recent deploy") }` || !deploys.DryRun {
+		t.Errorf("expected the loaded source with the saved dry-run state, got %+v", deploys)
+	}
+	if loaded.DryRun {
+		t.Error("expected restore to swap in a copy rather than modify the loaded rule")
+	}
+	if len(restarted.GetRuleGroups()) != 1 {
+		t.Error("expected the rule group to be restored")
+	}
+
+	// The cooldown carries over the restart
+	restarted.EvaluateRules()
+	if !lastTrigger(restarted, "orders").Equal(triggered) {
+		t.Error("expected the restored cooldown to hold the rule back")
+	}
+
+	if value, _ := restarted.GetCustomMetric("orders.pending"); value != 120 {
+		t.Errorf("expected the current value to win, got %v", value)
+	}
+	if history := restarted.getCustomMetricHistory("orders.pending", time.Hour); len(history) != 3 || history[0].Value != 50 {
+		t.Errorf("expected saved samples before the current one, got %+v", history)
+	}
+	if restarted.countEventsSince("deploy", time.Now().Add(-time.Hour)) != 1 || len(restarted.GetEventHistory(0, "deploy")) != 1 {
+		t.Error("expected the deploy event to be restored")
+	}
+	if availability, ok := restarted.GetRuleAvailability("orders"); !ok || availability.Availability != 0 {
+		t.Errorf("expected availability to be restored, got %+v", availability)
+	}
+
+	for _, data := range []string{"not json", `{"version": 99}`,
+		`{"version": 1, "rules": {"version": 1, "rules": [{"name": "broken", "source": "when {"}]}}`} {
+		if err := newEngine().Restore([]byte(data)); err == nil {
+			t.Errorf("expected an error restoring %s", data)
+		}
+	}
+}
+
+// mapSecrets serves secrets from a map for tests
+type mapSecrets map[string]string
+
+func (m mapSecrets) GetSecret(name string) (string, error) {
+	if value, ok := m[name]; ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("no secret %s", name)
+}
+
+func TestStorageEncryption(t *testing.T) {
+	newEngine := func() *Engine {
+		return NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	}
+	secrets := mapSecrets{
+		"old": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)),
+		"new": strings.Repeat("ab", 32),
+		"bad": "short",
+	}
+
+	previous := newEngine()
+	previous.UpdateCustomMetric("revenue", 1250)
+	if err := previous.SetStorageEncryption(&EncryptionConfig{Secrets: secrets, KeyName: "bad"}); err == nil {
+		t.Error("expected a key that is not 32 bytes to be rejected")
+	}
+	if err := previous.SetStorageEncryption(&EncryptionConfig{Secrets: secrets, KeyName: "old"}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := previous.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("revenue")) {
+		t.Fatal("expected the saved state to be encrypted")
+	}
+
+	if err := newEngine().Restore(data); err == nil {
+		t.Error("expected encrypted state to need a key")
+	}
+	wrong := newEngine()
+	wrong.SetStorageEncryption(&EncryptionConfig{Secrets: secrets, KeyName: "new"})
+	if err := wrong.Restore(data); err == nil {
+		t.Error("expected the wrong key to fail")
+	}
+
+	// After a rotation, state written with the previous key is still read
+	restarted := newEngine()
+	if err := restarted.SetStorageEncryption(&EncryptionConfig{Secrets: secrets, KeyName: "new", PreviousKeyNames: []string{"old"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Restore(data); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if value, _ := restarted.GetCustomMetric("revenue"); value != 1250 {
+		t.Errorf("expected the custom metric to be restored, got %v", value)
+	}
+	tampered := append([]byte{}, data...)
+	tampered[len(tampered)-1] ^= 1
+	if err := restarted.Restore(tampered); err == nil {
+		t.Error("expected tampered state to be rejected")
+	}
+
+	store := newMemorySnapshotStore()
+	restarted.SetSnapshotConfig(&SnapshotConfig{Store: store})
+	if err := restarted.WriteSnapshot(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for key, object := range store.objects {
+		if !strings.HasSuffix(key, ".json.enc") && !strings.HasSuffix(key, ".png.enc") {
+			t.Errorf("expected encrypted snapshot keys, got %s", key)
+		}
+		if !isEncrypted(object) {
+			t.Errorf("expected %s to be encrypted", key)
+		}
+	}
+}
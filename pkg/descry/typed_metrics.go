@@ -0,0 +1,406 @@
+package descry
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// typedMetricRegistry holds the counters, gauges and histograms created
+// through the engine, keyed by metric name
+type typedMetricRegistry struct {
+	mutex   sync.RWMutex
+	metrics map[string]interface{}
+}
+
+// Counter is a custom metric that only goes up, such as the number of orders
+// placed. Its running total is available in rules as custom.<name>, with the
+// same history as metrics set with UpdateCustomMetric, so trend() gives its
+// rate per minute.
+type Counter struct {
+	engine *Engine
+	name   string
+	mutex  sync.Mutex
+	value  float64
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds delta to the counter. Negative and NaN deltas are ignored, so the
+// counter never decreases.
+func (c *Counter) Add(delta float64) {
+	if !(delta >= 0) {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.value += delta
+	c.engine.recordTypedMetric(c.name, c.value)
+}
+
+// Value returns the counter's total
+func (c *Counter) Value() float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.value
+}
+
+// Gauge is a custom metric that goes up and down, such as a queue depth. Its
+// value is available in rules as custom.<name>.
+type Gauge struct {
+	engine *Engine
+	name   string
+	mutex  sync.Mutex
+	value  float64
+}
+
+// Set sets the gauge's value
+func (g *Gauge) Set(value float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.value = value
+	g.engine.recordTypedMetric(g.name, g.value)
+}
+
+// Add adds delta, which may be negative, to the gauge
+func (g *Gauge) Add(delta float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.value += delta
+	g.engine.recordTypedMetric(g.name, g.value)
+}
+
+// Inc adds one to the gauge
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec subtracts one from the gauge
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Value returns the gauge's value
+func (g *Gauge) Value() float64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.value
+}
+
+// Histogram is a custom metric summarizing a distribution of observations,
+// such as job durations. Apart from the count and sum, its statistics cover
+// the most recent observations, as many as a custom metric's history keeps,
+// and are available in rules as custom.<name>.<statistic>, e.g.
+// custom.job_duration_ms.p99. See histogramStatistics for the statistics.
+type Histogram struct {
+	engine  *Engine
+	name    string
+	mutex   sync.Mutex
+	count   int64
+	sum     float64
+	samples []float64
+	next    int  // index the next observation overwrites once samples is full
+	hidden  bool // created beyond the MaxCustomMetrics limit
+
+	// Observations per second over the last histogramRateWindow seconds,
+	// indexed by Unix second modulo the window
+	rateCounts  [histogramRateWindow]int64
+	rateSeconds [histogramRateWindow]int64
+}
+
+// histogramRateWindow is the number of seconds a histogram's rate is
+// averaged over
+const histogramRateWindow = 60
+
+// HistogramStats summarize a histogram's observations
+type HistogramStats struct {
+	Count   int64   `json:"count"`   // Observations since the histogram was created
+	Sum     float64 `json:"sum"`     // Sum of every observation
+	Samples int     `json:"samples"` // Recent observations the remaining stats cover
+	Avg     float64 `json:"avg"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	P50     float64 `json:"p50"`
+	P90     float64 `json:"p90"`
+	P95     float64 `json:"p95"`
+	P99     float64 `json:"p99"`
+	Rate    float64 `json:"rate"` // Observations per second over the last minute
+}
+
+// histogramStatistics are the statistics of a histogram available in rules
+// as custom.<name>.<statistic>
+var histogramStatistics = map[string]func(HistogramStats) float64{
+	"count":   func(s HistogramStats) float64 { return float64(s.Count) },
+	"sum":     func(s HistogramStats) float64 { return s.Sum },
+	"samples": func(s HistogramStats) float64 { return float64(s.Samples) },
+	"avg":     func(s HistogramStats) float64 { return s.Avg },
+	"min":     func(s HistogramStats) float64 { return s.Min },
+	"max":     func(s HistogramStats) float64 { return s.Max },
+	"p50":     func(s HistogramStats) float64 { return s.P50 },
+	"p90":     func(s HistogramStats) float64 { return s.P90 },
+	"p95":     func(s HistogramStats) float64 { return s.P95 },
+	"p99":     func(s HistogramStats) float64 { return s.P99 },
+	"rate":    func(s HistogramStats) float64 { return s.Rate },
+}
+
+// Observe adds an observation to the histogram. NaN observations are
+// ignored.
+func (h *Histogram) Observe(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	maxSamples := int(h.engine.customMetrics.maxHistory.Load())
+	second := h.engine.clock.Now().Unix()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.count++
+	h.sum += value
+	slot := second % histogramRateWindow
+	if h.rateSeconds[slot] != second {
+		h.rateSeconds[slot], h.rateCounts[slot] = second, 0
+	}
+	h.rateCounts[slot]++
+	if len(h.samples) != maxSamples && h.next != 0 || len(h.samples) > maxSamples {
+		// The history size changed; unroll the ring, keeping the newest
+		// observations, so it can grow by appending again
+		ordered := make([]float64, 0, len(h.samples))
+		ordered = append(ordered, h.samples[h.next:]...)
+		ordered = append(ordered, h.samples[:h.next]...)
+		if len(ordered) > maxSamples {
+			ordered = ordered[len(ordered)-max(maxSamples, 0):]
+		}
+		h.samples, h.next = ordered, 0
+	}
+	if len(h.samples) < maxSamples {
+		h.samples = append(h.samples, value)
+		return
+	}
+	if maxSamples <= 0 {
+		return
+	}
+	h.samples[h.next] = value
+	h.next = (h.next + 1) % len(h.samples)
+}
+
+// Stats returns the histogram's statistics
+func (h *Histogram) Stats() HistogramStats {
+	now := h.engine.clock.Now().Unix()
+	h.mutex.Lock()
+	stats := HistogramStats{Count: h.count, Sum: h.sum, Samples: len(h.samples)}
+	sorted := append([]float64(nil), h.samples...)
+	var recent int64
+	for i, second := range h.rateSeconds {
+		if second > now-histogramRateWindow && second <= now {
+			recent += h.rateCounts[i]
+		}
+	}
+	h.mutex.Unlock()
+	stats.Rate = float64(recent) / histogramRateWindow
+
+	if len(sorted) == 0 {
+		return stats
+	}
+	sort.Float64s(sorted)
+	var total float64
+	for _, value := range sorted {
+		total += value
+	}
+	stats.Avg = total / float64(len(sorted))
+	stats.Min = sorted[0]
+	stats.Max = sorted[len(sorted)-1]
+	stats.P50 = floatPercentile(sorted, 50)
+	stats.P90 = floatPercentile(sorted, 90)
+	stats.P95 = floatPercentile(sorted, 95)
+	stats.P99 = floatPercentile(sorted, 99)
+	return stats
+}
+
+// Time starts timing a code section and returns a function that observes
+// the elapsed time in milliseconds when called:
+//
+//	defer histogram.Time()()
+func (h *Histogram) Time() func() {
+	start := h.engine.clock.Now()
+	return func() {
+		h.Observe(float64(h.engine.clock.Now().Sub(start)) / float64(time.Millisecond))
+	}
+}
+
+// floatPercentile returns the nearest-rank percentile of sorted values
+func floatPercentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// Counter returns the counter with the given name, creating it on first use.
+// A new counter continues from the metric's current value, such as one
+// restored from saved state.
+//
+// Example:
+//
+//	orders := engine.Counter("orders_total")
+//	orders.Inc()
+//
+// Counters, gauges and histograms share the custom metric namespace; asking
+// for a name already used by a metric of another type panics.
+func (e *Engine) Counter(name string) *Counter {
+	metric := e.typedMetric(name, "counter", func() interface{} {
+		counter := &Counter{engine: e, name: name}
+		counter.value, _ = e.customMetrics.get(name)
+		return counter
+	})
+	return metric.(*Counter)
+}
+
+// Gauge returns the gauge with the given name, creating it on first use with
+// the metric's current value
+//
+// Example:
+//
+//	engine.Gauge("queue_depth").Set(float64(len(queue)))
+func (e *Engine) Gauge(name string) *Gauge {
+	metric := e.typedMetric(name, "gauge", func() interface{} {
+		gauge := &Gauge{engine: e, name: name}
+		gauge.value, _ = e.customMetrics.get(name)
+		return gauge
+	})
+	return metric.(*Gauge)
+}
+
+// Histogram returns the histogram with the given name, creating it on first
+// use. Each histogram counts toward the MaxCustomMetrics limit; one created
+// beyond it still records observations but is not available to rules.
+//
+// Example:
+//
+//	start := time.Now()
+//	runJob()
+//	engine.Histogram("job_duration_ms").Observe(float64(time.Since(start).Milliseconds()))
+func (e *Engine) Histogram(name string) *Histogram {
+	metric := e.typedMetric(name, "histogram", func() interface{} {
+		return &Histogram{engine: e, name: name}
+	})
+	return metric.(*Histogram)
+}
+
+// Time starts timing a named code section and returns a function that
+// records the elapsed time when called, so that business-critical operations
+// can be brought under rules with one line. Durations are observed in
+// milliseconds by the histogram with the given name, so rules can read their
+// percentiles and how often the section runs:
+//
+//	func rebuildIndex() {
+//		defer engine.Time("rebuild_index")()
+//		...
+//	}
+//
+//	when custom.rebuild_index.p95 > 5s || custom.rebuild_index.rate < 0.01 { ... }
+func (e *Engine) Time(name string) func() {
+	return e.Histogram(name).Time()
+}
+
+// typedMetric returns the registered metric with the given name, creating it
+// with create if there is none. It panics if the name belongs to a metric of
+// another kind.
+func (e *Engine) typedMetric(name, kind string, create func() interface{}) interface{} {
+	registry := &e.typedMetrics
+	registry.mutex.RLock()
+	metric, exists := registry.metrics[name]
+	registry.mutex.RUnlock()
+	if !exists {
+		registry.mutex.Lock()
+		if metric, exists = registry.metrics[name]; !exists {
+			metric = create()
+			if registry.metrics == nil {
+				registry.metrics = make(map[string]interface{})
+			}
+			if histogram, ok := metric.(*Histogram); ok {
+				if err := e.customMetrics.reserve(1, e.limits.MaxCustomMetrics); err != nil {
+					histogram.hidden = true
+					e.log().Warn("Histogram not available to rules",
+						slog.String("component", "metrics"), slog.String("metric", name), slog.Any("error", err))
+				}
+			}
+			registry.metrics[name] = metric
+		}
+		registry.mutex.Unlock()
+	}
+	if actual := typedMetricKind(metric); actual != kind {
+		panic(fmt.Sprintf("descry: custom metric %q is a %s, not a %s", name, actual, kind))
+	}
+	return metric
+}
+
+// typedMetricKind names the type of a registered metric
+func typedMetricKind(metric interface{}) string {
+	switch metric.(type) {
+	case *Counter:
+		return "counter"
+	case *Gauge:
+		return "gauge"
+	default:
+		return "histogram"
+	}
+}
+
+// recordTypedMetric stores a counter or gauge value as a custom metric,
+// logging values dropped for the MaxCustomMetrics limit
+func (e *Engine) recordTypedMetric(name string, value float64) {
+	if err := e.customMetrics.set(name, value, e.clock.Now(), e.limits.MaxCustomMetrics); err != nil {
+		e.log().Warn("Failed to record custom metric",
+			slog.String("component", "metrics"), slog.String("metric", name), slog.Any("error", err))
+	}
+}
+
+// histogramMetric returns a histogram statistic for a custom metric path
+// such as job_duration_ms.p99. It reports false if the path does not name a
+// histogram statistic.
+func (e *Engine) histogramMetric(path string) (float64, bool) {
+	i := strings.LastIndexByte(path, '.')
+	if i < 0 {
+		return 0, false
+	}
+	statistic, known := histogramStatistics[path[i+1:]]
+	if !known {
+		return 0, false
+	}
+	e.typedMetrics.mutex.RLock()
+	histogram, ok := e.typedMetrics.metrics[path[:i]].(*Histogram)
+	e.typedMetrics.mutex.RUnlock()
+	if !ok || histogram.hidden {
+		return 0, false
+	}
+	return statistic(histogram.Stats()), true
+}
+
+// histogramValues returns every statistic of every histogram, keyed by
+// custom metric name such as job_duration_ms.p99
+func (e *Engine) histogramValues() map[string]float64 {
+	e.typedMetrics.mutex.RLock()
+	histograms := make(map[string]*Histogram)
+	for name, metric := range e.typedMetrics.metrics {
+		if histogram, ok := metric.(*Histogram); ok && !histogram.hidden {
+			histograms[name] = histogram
+		}
+	}
+	e.typedMetrics.mutex.RUnlock()
+
+	values := make(map[string]float64)
+	for name, histogram := range histograms {
+		stats := histogram.Stats()
+		for statistic, value := range histogramStatistics {
+			values[name+"."+statistic] = value(stats)
+		}
+	}
+	return values
+}
@@ -0,0 +1,121 @@
+package descry
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/chosenoffset/descry/pkg/descry/clock"
+)
+
+func TestTypedMetrics(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake, Logger: log.New(io.Discard, "", 0)})
+
+	// Counters only go up
+	orders := engine.Counter("orders_total")
+	for i := 0; i < 10; i++ {
+		fake.Advance(30 * time.Second)
+		orders.Inc()
+	}
+	orders.Add(-5)
+	if engine.Counter("orders_total") != orders || orders.Value() != 10 {
+		t.Fatalf("expected the same counter at 10, got %v", orders.Value())
+	}
+
+	queue := engine.Gauge("queue_depth")
+	queue.Set(5)
+	queue.Dec()
+	queue.Add(2.5)
+
+	jobs := engine.Histogram("job_duration_ms")
+	for i := 1; i <= 100; i++ {
+		jobs.Observe(float64(i))
+	}
+
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		{"custom.orders_total", 10},
+		{`trend("custom.orders_total", 5m)`, 2}, // per minute
+		{"custom.queue_depth", 6.5},
+		{"custom.job_duration_ms.count", 100},
+		{"custom.job_duration_ms.sum", 5050},
+		{"custom.job_duration_ms.p50", 50},
+		{"custom.job_duration_ms.p99", 99},
+		{"custom.job_duration_ms.max", 100},
+	}
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if got := engine.evaluator.objectToFloat(result); isError(result) || got != tt.expected {
+			t.Errorf("%q: expected %v, got %s", tt.source, tt.expected, result.Inspect())
+		}
+	}
+	if result := evalSource(t, engine, "custom.job_duration_ms.p42"); !isError(result) {
+		t.Errorf("expected an error for an unknown histogram statistic, got %s", result.Inspect())
+	}
+
+	snapshot := engine.SnapshotMetrics()
+	if snapshot["custom.orders_total"] != 10 || snapshot["custom.job_duration_ms.p95"] != 95 {
+		t.Errorf("expected typed metrics in snapshots, got %v", snapshot)
+	}
+
+	// Percentiles cover the most recent observations
+	limits := *DefaultResourceLimits()
+	limits.MaxMetricHistorySize = 10
+	engine.SetResourceLimits(&limits)
+	jobs.Observe(1000)
+	if stats := jobs.Stats(); stats.Samples != 10 || stats.Min != 92 || stats.Max != 1000 || stats.Count != 101 {
+		t.Errorf("expected the 10 newest observations, got %+v", stats)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a name used by another metric type")
+		}
+	}()
+	engine.Gauge("orders_total")
+}
+
+func TestTimeCodeSections(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Clock: fake, Logger: log.New(io.Discard, "", 0)})
+
+	rebuildIndex := func(d time.Duration) {
+		defer engine.Time("rebuild_index")()
+		fake.Advance(d)
+	}
+	// A rebuild every 1.5s for 45s, taking 100ms to 1s
+	for i := 1; i <= 30; i++ {
+		d := 100 * time.Millisecond * time.Duration(i%10+1)
+		rebuildIndex(d)
+		fake.Advance(1500*time.Millisecond - d)
+	}
+
+	tests := []struct {
+		source   string
+		expected float64
+	}{
+		{"custom.rebuild_index.count", 30},
+		{"custom.rebuild_index.max", 1000},
+		{"custom.rebuild_index.p50", 500},
+		{"custom.rebuild_index.rate", 0.5}, // per second
+	}
+	for _, tt := range tests {
+		result := evalSource(t, engine, tt.source)
+		if got := engine.evaluator.objectToFloat(result); isError(result) || got != tt.expected {
+			t.Errorf("%q: expected %v, got %s", tt.source, tt.expected, result.Inspect())
+		}
+	}
+	if result := evalSource(t, engine, "custom.rebuild_index.p95 >= 1s"); result != TRUE {
+		t.Errorf("expected durations comparable with time units, got %s", result.Inspect())
+	}
+
+	// The rate only counts the last minute
+	fake.Advance(45 * time.Second)
+	if rate := engine.Histogram("rebuild_index").Stats().Rate; rate != 0.15 {
+		t.Errorf("expected older observations to leave the rate, got %v", rate)
+	}
+}
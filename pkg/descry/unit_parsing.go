@@ -0,0 +1,110 @@
+package descry
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeUnits are the DSL's duration units, keyed upper-cased
+var timeUnits = map[string]time.Duration{
+	"MS": time.Millisecond,
+	"S":  time.Second,
+	"M":  time.Minute,
+	"H":  time.Hour,
+	"D":  24 * time.Hour,
+}
+
+// sizeUnits are the DSL's byte size units, keyed upper-cased. Multiples are
+// powers of 1024, matching the runtime's byte counts.
+var sizeUnits = map[string]float64{
+	"MB": 1024 * 1024,
+	"GB": 1024 * 1024 * 1024,
+}
+
+// unitMultiplier returns the factor a DSL unit scales its number by: time
+// units give milliseconds and size units bytes. Unknown units give zero.
+func unitMultiplier(unit string) float64 {
+	unit = strings.ToUpper(unit)
+	if d, ok := timeUnits[unit]; ok {
+		return float64(d / time.Millisecond)
+	}
+	if multiple, ok := sizeUnits[unit]; ok {
+		return multiple
+	}
+	if unit == "%" {
+		// Rates such as http.error_rate are already percentages
+		return 1
+	}
+	return 0
+}
+
+// ParseDurationDSL parses a duration the way rules read one, such as "5m",
+// "2d" or "250ms". Units are case-insensitive, so "5M" is five minutes, never
+// megabytes. Like every, within and cooldown in rules, it takes whole numbers
+// only: "1.5h" is rejected in favour of "90m". A number without a unit is
+// rejected too, since rules read it as milliseconds in comparisons but seconds
+// in window arguments.
+func ParseDurationDSL(s string) (time.Duration, error) {
+	value, unit, err := splitQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	if unit == "" {
+		return 0, fmt.Errorf("invalid duration %q: missing unit (ms, s, m, h or d)", s)
+	}
+	if value != math.Trunc(value) {
+		return 0, fmt.Errorf("invalid duration %q: expected a whole number of %s", s, unit)
+	}
+	multiple, ok := timeUnits[strings.ToUpper(unit)]
+	if !ok {
+		return 0, fmt.Errorf("invalid duration %q: unknown unit %s (expected ms, s, m, h or d)", s, unit)
+	}
+	duration := value * float64(multiple)
+	if duration > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid duration %q: out of range", s)
+	}
+	return time.Duration(duration), nil
+}
+
+// ParseSize parses a byte size the way rules read one, such as "200MB",
+// "1.5GB" or "512mb", returning bytes. Units are case-insensitive and
+// binary, so "1MB" is 1024 * 1024 bytes. A number without a unit is bytes.
+func ParseSize(s string) (int64, error) {
+	value, unit, err := splitQuantity(s)
+	if err != nil {
+		return 0, err
+	}
+	multiple := 1.0
+	if unit != "" {
+		var ok bool
+		if multiple, ok = sizeUnits[strings.ToUpper(unit)]; !ok {
+			return 0, fmt.Errorf("invalid size %q: unknown unit %s (expected MB or GB)", s, unit)
+		}
+	}
+	size := math.Round(value * multiple)
+	if size > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size %q: out of range", s)
+	}
+	return int64(size), nil
+}
+
+// splitQuantity splits a quantity such as "200MB" or "1.5 h" into its
+// non-negative number and its unit, which may be empty
+func splitQuantity(s string) (float64, string, error) {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.') {
+		end++
+	}
+	if end == 0 {
+		return 0, "", fmt.Errorf("invalid quantity %q: expected a number followed by a unit", s)
+	}
+	value, err := strconv.ParseFloat(s[:end], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid quantity %q: %s is not a number", s, s[:end])
+	}
+	return value, strings.TrimSpace(s[end:]), nil
+}
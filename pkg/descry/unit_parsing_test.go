@@ -0,0 +1,64 @@
+package descry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDurationDSL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{"5m", 5 * time.Minute},
+		{"5M", 5 * time.Minute},
+		{"250ms", 250 * time.Millisecond},
+		{"2d", 48 * time.Hour},
+		{" 30 s ", 30 * time.Second},
+	}
+	for _, tt := range tests {
+		duration, err := ParseDurationDSL(tt.input)
+		if err != nil || duration != tt.expected {
+			t.Errorf("ParseDurationDSL(%q) = %v, %v; expected %v", tt.input, duration, err, tt.expected)
+		}
+	}
+	for _, input := range []string{"", "100", "5mb", "-5m", "m", "1.2.3s", "5 minutes", "1.5h", "0.5s"} {
+		if duration, err := ParseDurationDSL(input); err == nil {
+			t.Errorf("ParseDurationDSL(%q) = %v; expected an error", input, duration)
+		}
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"200MB", 200 * 1024 * 1024},
+		{"200mb", 200 * 1024 * 1024},
+		{"1.5GB", 3 * 512 * 1024 * 1024},
+		{"4096", 4096},
+	}
+	for _, tt := range tests {
+		size, err := ParseSize(tt.input)
+		if err != nil || size != tt.expected {
+			t.Errorf("ParseSize(%q) = %d, %v; expected %d", tt.input, size, err, tt.expected)
+		}
+	}
+	for _, input := range []string{"", "5m", "200TB", "-1MB", "MB", "512KB", "64B"} {
+		if size, err := ParseSize(input); err == nil {
+			t.Errorf("ParseSize(%q) = %d; expected an error", input, size)
+		}
+	}
+
+	// Parsed values agree with the same quantities in rules
+	engine := NewEngine()
+	size, _ := ParseSize("200MB")
+	if result := evalSource(t, engine, "200MB"); engine.evaluator.objectToFloat(result) != float64(size) {
+		t.Errorf("expected 200MB in a rule to equal ParseSize, got %s", result.Inspect())
+	}
+	duration, _ := ParseDurationDSL("5m")
+	if result := evalSource(t, engine, "5m"); engine.evaluator.objectToFloat(result) != float64(duration.Milliseconds()) {
+		t.Errorf("expected 5m in a rule to equal ParseDurationDSL in milliseconds, got %s", result.Inspect())
+	}
+}
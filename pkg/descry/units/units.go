@@ -0,0 +1,193 @@
+// Package units formats metric values for people: byte sizes in binary or SI
+// units, durations, percentages and plain numbers, with a chosen number of
+// decimal places and the separators of a locale. The engine applies one
+// Format to alert and log messages, the dashboard and its exports, so a value
+// reads the same everywhere.
+package units
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// System selects the multiples byte sizes are shown in
+type System string
+
+const (
+	// Binary shows byte sizes in powers of 1024: KiB, MiB, GiB
+	Binary System = "binary"
+	// SI shows byte sizes in powers of 1000: kB, MB, GB
+	SI System = "si"
+)
+
+// DefaultPrecision is the number of decimal places used when a Format does
+// not set one
+const DefaultPrecision = 2
+
+// Format controls how values are shown. The zero Format uses binary units,
+// two decimal places and English separators.
+type Format struct {
+	// System is Binary (the default) or SI
+	System System `json:"system,omitempty"`
+	// Precision is the number of decimal places. Zero uses DefaultPrecision
+	// and a negative value shows none.
+	Precision int `json:"precision,omitempty"`
+	// Locale is a BCP 47 language tag, such as "de" or "fr-CA", choosing
+	// the decimal and digit group separators. Unknown or empty locales use
+	// English separators.
+	Locale string `json:"locale,omitempty"`
+}
+
+// separators are the decimal and digit group separators of a language
+type separators struct {
+	decimal string
+	group   string
+}
+
+// localeSeparators maps lower-cased languages, and regions that differ from
+// their language, to separators
+var localeSeparators = map[string]separators{
+	"en":    {".", ","},
+	"ja":    {".", ","},
+	"zh":    {".", ","},
+	"ko":    {".", ","},
+	"de":    {",", "."},
+	"es":    {",", "."},
+	"it":    {",", "."},
+	"nl":    {",", "."},
+	"pt":    {",", "."},
+	"da":    {",", "."},
+	"id":    {",", "."},
+	"tr":    {",", "."},
+	"fr":    {",", "\u00a0"},
+	"sv":    {",", "\u00a0"},
+	"nb":    {",", "\u00a0"},
+	"fi":    {",", "\u00a0"},
+	"pl":    {",", "\u00a0"},
+	"cs":    {",", "\u00a0"},
+	"ru":    {",", "\u00a0"},
+	"uk":    {",", "\u00a0"},
+	"de-ch": {".", "\u2019"},
+}
+
+// Separators returns the decimal and digit group separators of the Format's
+// locale
+func (f Format) Separators() (decimal, group string) {
+	tag := strings.ToLower(strings.ReplaceAll(f.Locale, "_", "-"))
+	if s, ok := localeSeparators[tag]; ok {
+		return s.decimal, s.group
+	}
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		// Try the region, e.g. de-CH, then the language
+		if s, ok := localeSeparators[tag[:i]+"-"+regionOf(tag[i+1:])]; ok {
+			return s.decimal, s.group
+		}
+		if s, ok := localeSeparators[tag[:i]]; ok {
+			return s.decimal, s.group
+		}
+	}
+	return ".", ","
+}
+
+// regionOf returns the region subtag of the subtags after a language, e.g.
+// "ch" for "latn-ch"
+func regionOf(subtags string) string {
+	parts := strings.Split(subtags, "-")
+	return parts[len(parts)-1]
+}
+
+// Decimals returns the number of decimal places the Format shows
+func (f Format) Decimals() int {
+	switch {
+	case f.Precision == 0:
+		return DefaultPrecision
+	case f.Precision < 0:
+		return 0
+	default:
+		return f.Precision
+	}
+}
+
+// Number formats a value with the Format's decimal places. Whole numbers,
+// such as counts, are shown without decimals.
+func (f Format) Number(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return f.fixed(v, 0)
+	}
+	return f.fixed(v, f.Decimals())
+}
+
+// Bytes formats a size in bytes in the largest unit of the Format's System
+// that keeps the value at least 1
+func (f Format) Bytes(v float64) string {
+	base, names := 1024.0, []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	if f.System == SI {
+		base, names = 1000, []string{"B", "kB", "MB", "GB", "TB", "PB"}
+	}
+	i := 0
+	for math.Abs(v) >= base && i < len(names)-1 {
+		v /= base
+		i++
+	}
+	if i == 0 {
+		return f.Number(v) + " " + names[0]
+	}
+	return f.fixed(v, f.Decimals()) + " " + names[i]
+}
+
+// Duration formats a duration in the largest of ns, μs, ms, s, min and h
+// that keeps the value at least 1
+func (f Format) Duration(d time.Duration) string {
+	v := float64(d)
+	steps := []struct {
+		size float64
+		name string
+	}{
+		{float64(time.Hour), "h"},
+		{float64(time.Minute), "min"},
+		{float64(time.Second), "s"},
+		{float64(time.Millisecond), "ms"},
+		{float64(time.Microsecond), "μs"},
+	}
+	for _, step := range steps {
+		if math.Abs(v) >= step.size {
+			return f.fixed(v/step.size, f.Decimals()) + " " + step.name
+		}
+	}
+	return f.Number(v) + " ns"
+}
+
+// Percent formats a value that is already a percentage, such as 12.5 for
+// 12.5%
+func (f Format) Percent(v float64) string {
+	return f.fixed(v, f.Decimals()) + "%"
+}
+
+// fixed formats v with decimals places and the locale's separators
+func (f Format) fixed(v float64, decimals int) string {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	decimal, group := f.Separators()
+	s := strconv.FormatFloat(v, 'f', decimals, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, fraction, _ := strings.Cut(s, ".")
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(group)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(decimal)
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
@@ -0,0 +1,38 @@
+package units
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	german := Format{Locale: "de-DE", Precision: 1}
+	swiss := Format{Locale: "de_CH"}
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"count", Format{}.Number(1234567), "1,234,567"},
+		{"fraction", Format{}.Number(-1234.5678), "-1,234.57"},
+		{"no decimals", Format{Precision: -1}.Number(2.5), "2"},
+		{"german", german.Number(1234567.25), "1.234.567,2"},
+		{"swiss", swiss.Number(1234.5), "1’234.50"},
+		{"french", Format{Locale: "fr"}.Number(1234.5), "1\u00a0234,50"},
+		{"unknown locale", Format{Locale: "xx"}.Number(1234.5), "1,234.50"},
+		{"bytes", Format{}.Bytes(512), "512 B"},
+		{"binary", Format{}.Bytes(250 * 1024 * 1024), "250.00 MiB"},
+		{"si", Format{System: SI}.Bytes(250 * 1024 * 1024), "262.14 MB"},
+		{"german bytes", german.Bytes(1536), "1,5 KiB"},
+		{"nanoseconds", Format{}.Duration(750), "750 ns"},
+		{"microseconds", Format{}.Duration(1500), "1.50 μs"},
+		{"milliseconds", Format{}.Duration(250 * time.Millisecond), "250.00 ms"},
+		{"minutes", Format{Precision: 1}.Duration(90 * time.Second), "1.5 min"},
+		{"percent", german.Percent(12.345), "12,3%"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: expected %q, got %q", test.name, test.want, test.got)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package descry
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/chosenoffset/descry/pkg/descry/parser"
+)
+
+// functionSignature describes the arguments a built-in function accepts.
+// Argument counts include named arguments.
+type functionSignature struct {
+	minArgs   int
+	maxArgs   int
+	namedArgs []string
+}
+
+// builtinFunctions lists every function callable from the DSL. Rules calling
+// anything else are rejected when they are added rather than failing on every
+// evaluation.
+var builtinFunctions = map[string]functionSignature{
+	"alert":           {1, 2, []string{"severity"}},
+	"log":             {1, 1, nil},
+	"set_metric":      {2, 2, nil},
+	"suppress_alerts": {0, 0, nil},
+	"contains":        {2, 2, nil},
+	"matches":         {2, 2, nil},
+	"avg":             {2, 2, nil},
+	"max":             {2, 2, nil},
+	"trend":           {2, 2, nil},
+	"anomaly":         {2, 2, nil},
+	"changepoint":     {2, 2, nil},
+	"deviates":        {4, 4, nil},
+	"route":           {2, 2, nil},
+	"canary":          {3, 3, nil},
+	"stale":           {2, 2, nil},
+	"event":           {1, 2, nil},
+	"goroutine_leak":  {1, 1, nil},
+	"format":          {1, 2, nil},
+	"capture_profile": {1, 1, nil},
+}
+
+// validateProgram performs static checks on a parsed rule that the parser
+// cannot express, such as unknown functions, wrong argument counts and
+// invalid regular expressions.
+func validateProgram(program *parser.Program) error {
+	if err := validateConstants(program); err != nil {
+		return err
+	}
+	return walkNode(program, func(node parser.Node) error {
+		switch n := node.(type) {
+		case *parser.WhenStatement:
+			if n.During != nil {
+				if _, err := parseTimeWindow(n.During.Value); err != nil {
+					return err
+				}
+			}
+		case *parser.CallExpression:
+			return validateCall(n)
+		case *parser.DotExpression:
+			return validateDotCall(n)
+		case *parser.LabelSelector:
+			return validateLabelSelector(n)
+		case *parser.InfixExpression:
+			if n.Operator == "matches" {
+				return validatePattern(n.Right)
+			}
+		}
+		return nil
+	})
+}
+
+// validateConstants checks that each constant is declared once, has a value
+// known without evaluating the rule, and is never rebound by a let
+func validateConstants(program *parser.Program) error {
+	consts := make(map[string]bool)
+	lets := make(map[string]bool)
+	return walkNode(program, func(node parser.Node) error {
+		switch n := node.(type) {
+		case *parser.ConstStatement:
+			name := n.Name.Value
+			if consts[name] || lets[name] {
+				return fmt.Errorf("%s is already declared", name)
+			}
+			if err := validateConstantExpression(n.Value, consts); err != nil {
+				return fmt.Errorf("constant %s: %v", name, err)
+			}
+			consts[name] = true
+		case *parser.LetStatement:
+			if consts[n.Name.Value] {
+				return fmt.Errorf("cannot reassign constant %s", n.Name.Value)
+			}
+			lets[n.Name.Value] = true
+		}
+		return nil
+	})
+}
+
+// validateConstantExpression checks that expr uses only literals, units,
+// operators and previously declared constants
+func validateConstantExpression(expr parser.Expression, consts map[string]bool) error {
+	return walkNode(expr, func(node parser.Node) error {
+		switch n := node.(type) {
+		case *parser.Identifier:
+			if !consts[n.Value] {
+				return fmt.Errorf("%s is not a constant", n.Value)
+			}
+		case *parser.DotExpression, *parser.LabelSelector:
+			return fmt.Errorf("metrics cannot be used in constants: %s", n.String())
+		case *parser.CallExpression:
+			return fmt.Errorf("function calls cannot be used in constants: %s", n.String())
+		}
+		return nil
+	})
+}
+
+// validatePattern checks that a literal regular expression compiles
+func validatePattern(expr parser.Expression) error {
+	lit, ok := expr.(*parser.StringLiteral)
+	if !ok {
+		return nil
+	}
+	if _, err := regexp.Compile(lit.Value); err != nil {
+		return fmt.Errorf("invalid regular expression %q: %v", lit.Value, err)
+	}
+	return nil
+}
+
+// validateDotCall checks the statistic read from http.route(),
+// http.method() or goroutines.by_site()
+func validateDotCall(dot *parser.DotExpression) error {
+	call, ok := dot.Left.(*parser.CallExpression)
+	if !ok {
+		return nil
+	}
+	function, ok := dotPath(call.Function)
+	if !ok || (!httpBreakdowns[function] && function != goroutineSiteFunction) {
+		return fmt.Errorf("invalid dot expression: %s", dot.String())
+	}
+	stat, ok := dot.Right.(*parser.Identifier)
+	if !ok {
+		return fmt.Errorf("invalid dot expression: %s", dot.String())
+	}
+	if function == goroutineSiteFunction {
+		if _, known := goroutineSiteStatistics[stat.Value]; !known {
+			return fmt.Errorf("unknown goroutine site statistic %q (expected count or growth)", stat.Value)
+		}
+		return validateCall(call)
+	}
+	if _, known := routeStatistics[stat.Value]; !known {
+		return fmt.Errorf("unknown route statistic %q (expected %s)", stat.Value, routeStatisticNames())
+	}
+	return validateCall(call)
+}
+
+// validateLabelSelector checks that a label selector such as
+// custom.queue_depth{queue="email"} selects series of a metric path
+func validateLabelSelector(selector *parser.LabelSelector) error {
+	path, ok := dotPath(selector.Metric)
+	if !ok {
+		return fmt.Errorf("invalid label selector: %s", selector.String())
+	}
+	_, err := seriesKey(path, selector.Labels)
+	return err
+}
+
+// validateCall checks a call against the built-in function signatures
+func validateCall(call *parser.CallExpression) error {
+	if function, ok := dotPath(call.Function); ok && (httpBreakdowns[function] || function == goroutineSiteFunction) {
+		if len(call.Arguments) != 1 {
+			return fmt.Errorf("wrong number of arguments for %s: got=%d, want=1", function, len(call.Arguments))
+		}
+		return nil
+	}
+
+	ident, ok := call.Function.(*parser.Identifier)
+	if !ok {
+		return fmt.Errorf("invalid function call: %s", call.String())
+	}
+
+	sig, exists := builtinFunctions[ident.Value]
+	if !exists {
+		return fmt.Errorf("unknown function: %s", ident.Value)
+	}
+
+	for _, arg := range call.Arguments {
+		named, ok := arg.(*parser.NamedArgument)
+		if !ok {
+			continue
+		}
+		if !containsString(sig.namedArgs, named.Name) {
+			return fmt.Errorf("unknown argument for %s: %s", ident.Value, named.Name)
+		}
+	}
+
+	if len(call.Arguments) < sig.minArgs || len(call.Arguments) > sig.maxArgs {
+		if sig.minArgs == sig.maxArgs {
+			return fmt.Errorf("wrong number of arguments for %s: got=%d, want=%d",
+				ident.Value, len(call.Arguments), sig.minArgs)
+		}
+		return fmt.Errorf("wrong number of arguments for %s: got=%d, want=%d..%d",
+			ident.Value, len(call.Arguments), sig.minArgs, sig.maxArgs)
+	}
+
+	if ident.Value == "matches" {
+		return validatePattern(call.Arguments[1])
+	}
+	if ident.Value == "goroutine_leak" {
+		if unit, ok := call.Arguments[0].(*parser.UnitExpression); ok && !isTimeUnit(unit.Unit) {
+			return fmt.Errorf("argument to goroutine_leak() must be a time duration, got unit %s", unit.Unit)
+		}
+	}
+	if ident.Value == "event" && len(call.Arguments) == 2 {
+		if unit, ok := call.Arguments[1].(*parser.UnitExpression); ok && !isTimeUnit(unit.Unit) {
+			return fmt.Errorf("second argument to event() must be a time duration, got unit %s", unit.Unit)
+		}
+	}
+	if ident.Value == "canary" {
+		for _, arg := range call.Arguments[1:] {
+			if selector, ok := arg.(*parser.StringLiteral); ok {
+				if _, err := parseSeriesSelector(selector.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if ident.Value == "capture_profile" {
+		if profileType, ok := call.Arguments[0].(*parser.StringLiteral); ok && !profileTypes[profileType.Value] {
+			return fmt.Errorf("unknown profile type %q (expected %s)", profileType.Value, profileTypeNames())
+		}
+	}
+	if ident.Value == "route" {
+		if stat, ok := call.Arguments[1].(*parser.StringLiteral); ok {
+			if _, known := routeStatistics[stat.Value]; !known {
+				return fmt.Errorf("unknown route statistic %q (expected %s)", stat.Value, routeStatisticNames())
+			}
+		}
+	}
+	return nil
+}
+
+// walkNode visits node and all of its children depth-first, stopping at the
+// first error returned by fn.
+func walkNode(node parser.Node, fn func(parser.Node) error) error {
+	if node == nil {
+		return nil
+	}
+	if err := fn(node); err != nil {
+		return err
+	}
+
+	var children []parser.Node
+	switch n := node.(type) {
+	case *parser.Program:
+		for _, stmt := range n.Statements {
+			children = append(children, stmt)
+		}
+	case *parser.WhenStatement:
+		if n.Condition != nil {
+			children = append(children, n.Condition)
+		}
+		if n.Body != nil {
+			children = append(children, n.Body)
+		}
+	case *parser.BlockStatement:
+		for _, stmt := range n.Statements {
+			children = append(children, stmt)
+		}
+	case *parser.RuleStatement:
+		if n.Body != nil {
+			children = append(children, n.Body)
+		}
+	case *parser.LetStatement:
+		if n.Value != nil {
+			children = append(children, n.Value)
+		}
+	case *parser.ConstStatement:
+		if n.Value != nil {
+			children = append(children, n.Value)
+		}
+	case *parser.ExpressionStatement:
+		if n.Expression != nil {
+			children = append(children, n.Expression)
+		}
+	case *parser.InfixExpression:
+		if n.Left != nil {
+			children = append(children, n.Left)
+		}
+		if n.Right != nil {
+			children = append(children, n.Right)
+		}
+	case *parser.PrefixExpression:
+		if n.Right != nil {
+			children = append(children, n.Right)
+		}
+	case *parser.CallExpression:
+		for _, arg := range n.Arguments {
+			if arg != nil {
+				children = append(children, arg)
+			}
+		}
+	case *parser.UnitExpression:
+		if n.Value != nil {
+			children = append(children, n.Value)
+		}
+	case *parser.NamedArgument:
+		if n.Value != nil {
+			children = append(children, n.Value)
+		}
+	}
+
+	for _, child := range children {
+		if err := walkNode(child, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,302 @@
+package descry
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultRulesWatchInterval is how often WatchRulesDir polls for changes when
+// no interval is given and file system notifications are unavailable
+const DefaultRulesWatchInterval = 2 * time.Second
+
+// rulesWatchSettle is how long the watcher waits after a file system
+// notification before rescanning, so an editor's write, rename and chmod of
+// one save are applied as a single reload
+const rulesWatchSettle = 100 * time.Millisecond
+
+// rulesWatcher tracks the rule files of a watched directory
+type rulesWatcher struct {
+	dir      string
+	interval time.Duration
+	// files records the content hash of each file when it was last loaded
+	files map[string][sha256.Size]byte
+}
+
+// LoadRulesFromDir loads every .dscr file directly inside dir with
+// AddRuleFile, in name order, and returns the names of the rules added. Empty
+// files are skipped. A file that fails to load does not stop the others; the
+// returned error lists every failure.
+func (e *Engine) LoadRulesFromDir(dir string) ([]string, error) {
+	paths, err := ruleFilesIn(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	var errs []error
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		if strings.TrimSpace(string(content)) == "" {
+			continue
+		}
+		added, err := e.addRules(ruleFileName(path), string(content), path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+		names = append(names, added...)
+	}
+	return names, errors.Join(errs...)
+}
+
+// WatchRulesDir loads the .dscr files directly inside dir and, while the
+// engine is running, watches the directory for changes: added and changed
+// files are reloaded and the rules of deleted files are removed. A file counts
+// as changed only when its contents differ from those last loaded. Rules loaded
+// earlier from the same files with AddRuleFile or LoadRulesFromDir are
+// replaced rather than duplicated.
+//
+// A file that fails to parse or validate does not stop the engine. The error
+// is reported as a "rule_error" event and the file's previous rules keep
+// running until it is fixed. Successful reloads are reported as "rule_reload"
+// events. Files that are only imported are not watched; edits to them take
+// effect when an importing file is next reloaded.
+//
+// Changes are picked up through file system notifications. Where those are
+// unavailable, for example on some network file systems, or if the directory
+// itself is removed, the directory is polled every interval instead. An
+// interval of zero uses DefaultRulesWatchInterval. Passing an empty dir stops
+// watching.
+func (e *Engine) WatchRulesDir(dir string, interval time.Duration) error {
+	var watcher *rulesWatcher
+	if dir != "" {
+		if interval <= 0 {
+			interval = DefaultRulesWatchInterval
+		}
+		watcher = &rulesWatcher{dir: dir, interval: interval, files: make(map[string][sha256.Size]byte)}
+		if err := e.scanRulesDir(watcher); err != nil {
+			return err
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.rulesWatchStop != nil {
+		close(e.rulesWatchStop)
+		e.rulesWatchStop = nil
+	}
+	e.rulesWatch = watcher
+	if e.running && watcher != nil {
+		e.startRulesWatchLocked()
+	}
+	return nil
+}
+
+// startRulesWatchLocked starts watching the watched directory. Callers hold
+// e.mutex.
+func (e *Engine) startRulesWatchLocked() {
+	stop := make(chan struct{})
+	e.rulesWatchStop = stop
+	watcher := e.rulesWatch
+	e.goBackground(func() { e.rulesWatchLoop(watcher, stop) })
+}
+
+// rulesWatchLoop rescans the watched directory whenever it is notified of a
+// change to a rule file, falling back to polling if notifications cannot be
+// set up or the directory goes away
+func (e *Engine) rulesWatchLoop(watcher *rulesWatcher, stop chan struct{}) {
+	notify, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = notify.Add(watcher.dir); err != nil {
+			notify.Close()
+		}
+	}
+	if err != nil {
+		e.log().Warn("File system notifications unavailable, polling rules directory", slog.String("component", "rules"),
+			slog.String("dir", watcher.dir), slog.Duration("interval", watcher.interval), slog.Any("error", err))
+		e.pollRulesDir(watcher, stop)
+		return
+	}
+	defer notify.Close()
+
+	// Pick up changes made between the initial load and the watch starting
+	e.rescanRulesDir(watcher)
+
+	settle := time.NewTimer(rulesWatchSettle)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case event, ok := <-notify.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) == filepath.Clean(watcher.dir) && event.Has(fsnotify.Remove|fsnotify.Rename) {
+				e.log().Warn("Rules directory removed, polling for it", slog.String("component", "rules"),
+					slog.String("dir", watcher.dir))
+				e.pollRulesDir(watcher, stop)
+				return
+			}
+			if filepath.Ext(event.Name) == ".dscr" {
+				settle.Reset(rulesWatchSettle)
+			}
+		case err, ok := <-notify.Errors:
+			if !ok {
+				return
+			}
+			// Events may have been dropped, so rescan everything
+			e.log().Warn("Rules directory watch error", slog.String("component", "rules"),
+				slog.String("dir", watcher.dir), slog.Any("error", err))
+			settle.Reset(rulesWatchSettle)
+		case <-settle.C:
+			e.rescanRulesDir(watcher)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// pollRulesDir rescans the watched directory every interval until stopped
+func (e *Engine) pollRulesDir(watcher *rulesWatcher, stop chan struct{}) {
+	ticker := e.clock.NewTicker(watcher.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			e.rescanRulesDir(watcher)
+		case <-stop:
+			return
+		}
+	}
+}
+
+// rescanRulesDir scans the watched directory, logging rather than returning
+// a failure to read it
+func (e *Engine) rescanRulesDir(watcher *rulesWatcher) {
+	if err := e.scanRulesDir(watcher); err != nil {
+		e.log().Error("Failed to scan rules directory", slog.String("component", "rules"),
+			slog.String("dir", watcher.dir), slog.Any("error", err))
+	}
+}
+
+// scanRulesDir reloads the files in the watched directory that were added,
+// changed or deleted since the last scan
+func (e *Engine) scanRulesDir(watcher *rulesWatcher) error {
+	paths, err := ruleFilesIn(watcher.dir)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[string][sha256.Size]byte, len(paths))
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		current[path] = sha256.Sum256(content)
+		if previous, ok := watcher.files[path]; ok && previous == current[path] {
+			continue
+		}
+		e.applyRuleFile(path)
+	}
+
+	var deleted []string
+	for path := range watcher.files {
+		if _, ok := current[path]; !ok {
+			deleted = append(deleted, path)
+		}
+	}
+	sort.Strings(deleted)
+	for _, path := range deleted {
+		e.applyRuleFile(path)
+	}
+
+	watcher.files = current
+	return nil
+}
+
+// applyRuleFile reloads a watched file and reports the outcome in the event
+// history and on the dashboard
+func (e *Engine) applyRuleFile(path string) {
+	name := ruleFileName(path)
+	names, err := e.reloadRuleFile(path)
+	if err != nil {
+		message := fmt.Sprintf("Failed to reload %s: %v", path, err)
+		e.log().Error("Failed to reload rule file", slog.String("component", "rules"),
+			slog.String("file", path), slog.Any("error", err))
+		data := map[string]interface{}{"file": path, "error": err.Error()}
+		e.RecordEvent("rule_error", name, message, data)
+		e.sendEventUpdate("rule_error", message, name, data)
+		e.reportError(RuleError{Rule: name, Kind: RuleErrorParse, File: path, Err: err})
+		return
+	}
+
+	message := fmt.Sprintf("Reloaded %s", path)
+	if len(names) == 0 {
+		message = fmt.Sprintf("Removed rules from %s", path)
+	}
+	data := map[string]interface{}{"file": path, "rules": names}
+	e.log().Info("Reloaded rule file", slog.String("component", "rules"), slog.String("file", path), slog.Any("rules", names))
+	e.RecordEvent("rule_reload", name, message, data)
+	e.sendEventUpdate("rule_reload", message, name, data)
+}
+
+// reloadRuleFile replaces the rules loaded from path with the file's current
+// contents, or removes them if the file is missing or empty, and returns the
+// names of the new rules. The swap is atomic; if the new contents are invalid
+// the old rules keep running.
+func (e *Engine) reloadRuleFile(path string) ([]string, error) {
+	path = filepath.Clean(path)
+
+	var rules []*Rule
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read rule file: %w", err)
+	}
+	if strings.TrimSpace(string(content)) != "" {
+		rules, err = e.compileRules(ruleFileName(path), string(content), path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.replaceRulesLocked(func(rule *Rule) bool { return rule.File == path }, rules)
+}
+
+// ruleFilesIn returns the .dscr files directly inside dir, in name order
+func ruleFilesIn(dir string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.dscr"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan rules directory: %w", err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to scan rules directory: %w", err)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// ruleFileName is the default rule name for a file: its base name without the
+// extension
+func ruleFileName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
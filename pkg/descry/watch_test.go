@@ -0,0 +1,169 @@
+package descry
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRulesFromDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"memory.dscr":     `when heap.alloc > 0 { log("heap in use") }`,
+		"goroutines.dscr": `rule "goroutine_leak" { when goroutines.count > 10000 { alert("Leak") } }`,
+		"broken.dscr":     `when heap.alloc > { log("x") }`,
+		"empty.dscr":      "\n",
+		"notes.txt":       `when heap.alloc > 0 { log("ignored") }`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true})
+	names, err := engine.LoadRulesFromDir(dir)
+	if err == nil || !strings.Contains(err.Error(), "broken.dscr") {
+		t.Errorf("expected an error naming the broken file, got %v", err)
+	}
+	if strings.Join(names, ",") != "goroutine_leak,memory" {
+		t.Errorf("expected the valid files to load in name order, got %v", names)
+	}
+	if rule, ok := engine.GetRule("memory"); !ok || rule.File != filepath.Join(dir, "memory.dscr") {
+		t.Errorf("expected rule to record its file, got %+v", rule)
+	}
+}
+
+func TestWatchRulesDir(t *testing.T) {
+	dir := t.TempDir()
+	version := time.Now().Add(-time.Hour)
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// Give every write a distinct modification time
+		version = version.Add(time.Second)
+		if err := os.Chtimes(path, version, version); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ruleNames := func(engine *Engine) string {
+		var names []string
+		for _, rule := range engine.GetRules() {
+			names = append(names, rule.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	write("memory.dscr", `when heap.alloc > 0 { log("heap in use") }`)
+	write("runtime.dscr", `
+when goroutines.count > 0 { log("goroutines running") }
+when gc.num < 0 { log("never") }`)
+
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	if _, err := engine.AddRuleFile(filepath.Join(dir, "memory.dscr")); err != nil {
+		t.Fatalf("failed to add rule file: %v", err)
+	}
+	if err := engine.WatchRulesDir(dir, time.Hour); err != nil {
+		t.Fatalf("failed to watch rules directory: %v", err)
+	}
+	if got := ruleNames(engine); got != "memory,runtime#1,runtime#2" {
+		t.Fatalf("expected files loaded once each, got %s", got)
+	}
+
+	engine.EvaluateRules()
+	if err := engine.DisableRule("runtime#2"); err != nil {
+		t.Fatal(err)
+	}
+	triggered := engine.GetRules()[1].LastTrigger
+	scan := func() {
+		t.Helper()
+		if err := engine.scanRulesDir(engine.rulesWatch); err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+	}
+
+	// A changed file replaces its rules in place, keeping their state
+	write("runtime.dscr", `
+when goroutines.count > 1 { log("goroutines running") }
+when gc.num < 0 { log("never") }
+when heap.objects > 0 { log("objects") }`)
+	scan()
+	if got := ruleNames(engine); got != "memory,runtime#1,runtime#2,runtime#3" {
+		t.Fatalf("unexpected rules after change: %s", got)
+	}
+	rules := engine.GetRules()
+	if !rules[1].LastTrigger.Equal(triggered) || rules[2].Enabled() {
+		t.Error("expected reloaded rules to keep their trigger history and enabled state")
+	}
+	if events := engine.GetEventHistory(0, "rule_reload"); len(events) != 3 || events[0].RuleName != "runtime" {
+		t.Errorf("expected a reload event per load, got %+v", events)
+	}
+
+	// An invalid change is reported and the old rules keep running
+	write("memory.dscr", `when heap.alloc > { log("broken") }`)
+	scan()
+	if rule, ok := engine.GetRule("memory"); !ok || !strings.Contains(rule.Source, "heap in use") {
+		t.Error("expected the previous rule to survive an invalid change")
+	}
+	events := engine.GetEventHistory(1, "rule_error")
+	if len(events) != 1 || events[0].RuleName != "memory" || !strings.Contains(events[0].Message, "parse errors") {
+		t.Errorf("expected a rule_error event, got %+v", events)
+	}
+
+	// Added and deleted files add and remove rules
+	write("http.dscr", `when http.error_rate > 5 { alert("Errors") }`)
+	if err := os.Remove(filepath.Join(dir, "runtime.dscr")); err != nil {
+		t.Fatal(err)
+	}
+	scan()
+	if got := ruleNames(engine); got != "memory,http" {
+		t.Errorf("unexpected rules after add and delete: %s", got)
+	}
+
+	// Unchanged files are not reloaded, even when rewritten with the same contents
+	before := len(engine.GetEventHistory(0, ""))
+	scan()
+	write("http.dscr", `when http.error_rate > 5 { alert("Errors") }`)
+	scan()
+	if after := len(engine.GetEventHistory(0, "")); after != before {
+		t.Errorf("expected no events for an unchanged directory, got %d new", after-before)
+	}
+
+	if err := engine.WatchRulesDir("", 0); err != nil || engine.rulesWatch != nil {
+		t.Errorf("expected watching to stop, got %v", err)
+	}
+}
+
+func TestWatchRulesDirNotifications(t *testing.T) {
+	dir := t.TempDir()
+	engine := NewEngineWithConfig(EngineConfig{DisableDashboard: true, Logger: log.New(io.Discard, "", 0)})
+	// The hour-long polling interval never elapses, so changes must arrive as
+	// file system notifications
+	if err := engine.WatchRulesDir(dir, time.Hour); err != nil {
+		t.Fatalf("failed to watch rules directory: %v", err)
+	}
+	engine.Start(context.Background())
+	defer engine.Stop()
+
+	if err := os.WriteFile(filepath.Join(dir, "memory.dscr"), []byte(`when heap.alloc > 0 { log("heap in use") }`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := engine.GetRule("memory"); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the new rule file to be loaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}